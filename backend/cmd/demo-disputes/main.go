@@ -7,6 +7,7 @@ import (
 
 	"github.com/Andrew-mugwe/agroai/services/payouts"
 	"github.com/Andrew-mugwe/agroai/models"
+	"github.com/Andrew-mugwe/agroai/pagination"
 	"github.com/Andrew-mugwe/agroai/services/disputes"
 	"github.com/Andrew-mugwe/agroai/services/escrow"
 	"github.com/Andrew-mugwe/agroai/services/payments"
@@ -206,11 +207,12 @@ func handleList(disputeSvc *disputes.DisputeService, userType string) {
 	// Generate demo user ID
 	userID := uuid.New()
 
-	disputes, err := disputeSvc.GetDisputesByUser(userID, userType)
+	page, err := disputeSvc.GetDisputesByUser(userID, userType, pagination.Params{})
 	if err != nil {
 		fmt.Printf("❌ Failed to get disputes: %v\n", err)
 		return
 	}
+	disputes := page.Items
 
 	fmt.Printf("📋 Disputes for %s %s:\n", userType, userID)
 	if len(disputes) == 0 {
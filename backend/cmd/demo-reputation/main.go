@@ -178,7 +178,11 @@ func computeReputation(service *reputation.ReputationService, sellerIDStr string
 			fmt.Printf("\n📝 RECENT REVIEWS\n")
 			fmt.Printf("==================\n")
 			for _, review := range sellerReputation.RecentReviews {
-				fmt.Printf("• %d stars - \"%s\" (Order #%d)\n", review.Rating, review.Review, review.OrderID)
+				verified := ""
+				if review.VerifiedPurchase {
+					verified = " (Verified purchase)"
+				}
+				fmt.Printf("• %d stars - \"%s\"%s\n", review.Rating, review.Review, verified)
 			}
 		}
 	}
@@ -5,6 +5,7 @@ import (
 	"log"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -19,6 +20,8 @@ type Config struct {
 	// Server
 	Port string
 	Host string
+	// Browser origins allowed to call the API and open websockets
+	AllowedOrigins []string
 
 	// Redis Cache
 	Redis RedisConfig
@@ -26,13 +29,24 @@ type Config struct {
 	// External APIs
 	WeatherAPIKey    string
 	MarketDataAPIKey string
+	MarketDataURL    string
 
 	// Email
 	SMTP SMTPConfig
 
+	// Push notifications
+	Push PushConfig
+
+	// SMS and USSD for feature phones
+	SMS  SMSConfig
+	USSD USSDConfig
+
 	// AWS
 	AWS AWSConfig
 
+	// Media uploads
+	Media MediaConfig
+
 	// Monitoring
 	SentryDSN     string
 	AnalyticsID   string
@@ -57,12 +71,53 @@ type SMTPConfig struct {
 	Password string
 }
 
+// PushConfig holds push notification configuration
+type PushConfig struct {
+	// FCMServerKey enables push delivery; without it push is skipped
+	FCMServerKey string
+	FCMEndpoint  string
+}
+
+// SMSConfig holds SMS gateway configuration
+type SMSConfig struct {
+	// Provider is "africastalking" or "fake"; the fake logs messages
+	Provider string
+	Username string
+	APIKey   string
+	// SenderID is the registered short code or alphanumeric sender
+	SenderID string
+	Endpoint string
+}
+
+// USSDConfig holds USSD callback configuration
+type USSDConfig struct {
+	// CallbackToken must be passed as ?token= by the gateway; the USSD
+	// callback is not mounted without it
+	CallbackToken string
+	SessionTTL    time.Duration
+}
+
 // AWSConfig holds AWS configuration
 type AWSConfig struct {
 	AccessKeyID     string
 	SecretAccessKey string
 	Region          string
 	S3BucketName    string
+	// S3Endpoint points at an S3-compatible store instead of AWS
+	S3Endpoint string
+}
+
+// MediaConfig holds image upload storage configuration
+type MediaConfig struct {
+	// Storage is "local" or "s3"
+	Storage  string
+	LocalDir string
+	// SigningSecret signs local media URLs
+	SigningSecret string
+	URLTTL        time.Duration
+	// ClamdAddr is the ClamAV daemon message attachments are scanned
+	// with; attachments are only checked by type when it is empty
+	ClamdAddr string
 }
 
 // LoadConfig loads configuration from environment variables
@@ -72,6 +127,13 @@ func LoadConfig() *Config {
 		JWTSecret:   getEnv("JWT_SECRET", "your_jwt_secret_here"),
 		Port:        getEnv("PORT", "8080"),
 		Host:        getEnv("HOST", "0.0.0.0"),
+		// Local dev servers, plus production origins from the environment
+		AllowedOrigins: append([]string{
+			"http://localhost:3000",
+			"http://localhost:3001",
+			"http://127.0.0.1:3000",
+			"http://127.0.0.1:3001",
+		}, getEnvAsList("CORS_ORIGINS")...),
 
 		Redis: RedisConfig{
 			URL:      getEnv("REDIS_URL", "redis://localhost:6379"),
@@ -83,6 +145,7 @@ func LoadConfig() *Config {
 
 		WeatherAPIKey:    getEnv("WEATHER_API_KEY", ""),
 		MarketDataAPIKey: getEnv("MARKET_DATA_API_KEY", ""),
+		MarketDataURL:    getEnv("MARKET_DATA_URL", ""),
 
 		SMTP: SMTPConfig{
 			Host:     getEnv("SMTP_HOST", "smtp.gmail.com"),
@@ -91,11 +154,38 @@ func LoadConfig() *Config {
 			Password: getEnv("SMTP_PASSWORD", ""),
 		},
 
+		Push: PushConfig{
+			FCMServerKey: getEnv("PUSH_FCM_SERVER_KEY", ""),
+			FCMEndpoint:  getEnv("PUSH_FCM_ENDPOINT", "https://fcm.googleapis.com/fcm/send"),
+		},
+
+		SMS: SMSConfig{
+			Provider: getEnv("SMS_PROVIDER", "fake"),
+			Username: getEnv("SMS_USERNAME", "sandbox"),
+			APIKey:   getEnv("SMS_API_KEY", ""),
+			SenderID: getEnv("SMS_SENDER_ID", ""),
+			Endpoint: getEnv("SMS_ENDPOINT", "https://api.africastalking.com/version1/messaging"),
+		},
+
+		USSD: USSDConfig{
+			CallbackToken: getEnv("USSD_CALLBACK_TOKEN", ""),
+			SessionTTL:    getEnvAsDuration("USSD_SESSION_TTL", 3*time.Minute),
+		},
+
 		AWS: AWSConfig{
 			AccessKeyID:     getEnv("AWS_ACCESS_KEY_ID", ""),
 			SecretAccessKey: getEnv("AWS_SECRET_ACCESS_KEY", ""),
 			Region:          getEnv("AWS_REGION", "us-east-1"),
 			S3BucketName:    getEnv("S3_BUCKET_NAME", ""),
+			S3Endpoint:      getEnv("S3_ENDPOINT", ""),
+		},
+
+		Media: MediaConfig{
+			Storage:       getEnv("MEDIA_STORAGE", "local"),
+			LocalDir:      getEnv("MEDIA_LOCAL_DIR", "uploads/media"),
+			SigningSecret: getEnv("MEDIA_SIGNING_SECRET", getEnv("JWT_SECRET", "your_jwt_secret_here")),
+			URLTTL:        getEnvAsDuration("MEDIA_URL_TTL", time.Hour),
+			ClamdAddr:     getEnv("CLAMD_ADDR", ""),
 		},
 
 		SentryDSN:   getEnv("SENTRY_DSN", ""),
@@ -145,6 +235,17 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+// getEnvAsList gets a comma-separated environment variable as a list
+func getEnvAsList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
 // getEnvAsInt gets an environment variable as an integer with a default value
 func getEnvAsInt(key string, defaultValue int) int {
 	if value := os.Getenv(key); value != "" {
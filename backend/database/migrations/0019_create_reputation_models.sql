@@ -0,0 +1,34 @@
+-- Migration: Create versioned reputation models
+-- Created: 2026-10-18
+-- Description: Reputation scoring moves into the Go engine; weights are versioned and every stored score records the model it was computed with
+
+CREATE TABLE IF NOT EXISTS reputation_models (
+    version TEXT PRIMARY KEY,
+    description TEXT,
+    weights JSONB NOT NULL,
+    active BOOLEAN NOT NULL DEFAULT false,
+    created_at TIMESTAMP NOT NULL DEFAULT now()
+);
+
+-- Only one model may be active at a time
+CREATE UNIQUE INDEX IF NOT EXISTS idx_reputation_models_active
+    ON reputation_models (active) WHERE active;
+
+-- Seed the baseline model matching calculate_reputation_score
+INSERT INTO reputation_models (version, description, weights, active)
+VALUES (
+    'v1',
+    'Baseline model ported from calculate_reputation_score',
+    '{"base_score": 50, "neutral_rating": 3, "rating_weight": 10, "order_weight": 0.5, "order_cap": 15, "dispute_penalty": 2, "dispute_window_days": 180, "verified_bonus": 10, "recency_half_life_days": 0}',
+    true
+)
+ON CONFLICT (version) DO NOTHING;
+
+-- Record which model produced each stored score
+ALTER TABLE reputation_history ADD COLUMN IF NOT EXISTS model_version TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_reputation_history_model_version
+    ON reputation_history (model_version);
+
+-- The engine replaces this view; keep it for existing dashboards but mark it deprecated
+COMMENT ON VIEW reputation_breakdown IS 'Deprecated: reputation is computed by the Go reputation engine';
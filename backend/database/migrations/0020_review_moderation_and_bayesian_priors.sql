@@ -0,0 +1,87 @@
+-- Migration: Review moderation status and Bayesian rating priors
+-- Created: 2026-10-18
+-- Description: Suspicious reviews are held for moderation and excluded from scores; ratings are smoothed with a configurable prior
+
+-- Moderation status on reviews; only published reviews count towards reputation and stats
+ALTER TABLE reviews ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'published'
+    CHECK (status IN ('published', 'held', 'rejected'));
+ALTER TABLE reviews ADD COLUMN IF NOT EXISTS moderated_by UUID REFERENCES users(id);
+ALTER TABLE reviews ADD COLUMN IF NOT EXISTS moderated_at TIMESTAMP;
+ALTER TABLE reviews ADD COLUMN IF NOT EXISTS moderation_note TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_reviews_status ON reviews(status);
+CREATE INDEX IF NOT EXISTS idx_reviews_seller_created ON reviews(seller_id, created_at DESC);
+
+-- Reasons a review was flagged
+CREATE TABLE IF NOT EXISTS review_flags (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    review_id UUID NOT NULL REFERENCES reviews(id) ON DELETE CASCADE,
+    reason TEXT NOT NULL,
+    source TEXT NOT NULL DEFAULT 'anomaly_detection',
+    created_at TIMESTAMP NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_review_flags_review_id ON review_flags(review_id);
+
+-- Shared-IP detection looks up activity by user and IP
+CREATE INDEX IF NOT EXISTS idx_activity_logs_user_ip ON activity_logs(user_id, ip_address, created_at);
+
+-- Reputation is recalculated by the event scheduler; keep the trigger only for stats refresh
+CREATE OR REPLACE FUNCTION update_seller_reputation_on_review()
+RETURNS TRIGGER AS $$
+BEGIN
+    PERFORM refresh_seller_stats();
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trigger_update_reputation_on_review ON reviews;
+CREATE TRIGGER trigger_update_reputation_on_review
+    AFTER INSERT OR UPDATE OF status ON reviews
+    FOR EACH ROW
+    EXECUTE FUNCTION update_seller_reputation_on_review();
+
+-- Rebuild seller stats counting only published reviews
+DROP MATERIALIZED VIEW IF EXISTS seller_stats;
+CREATE MATERIALIZED VIEW seller_stats AS
+SELECT 
+    s.id as seller_id,
+    s.user_id,
+    s.name,
+    s.verified,
+    COALESCE(AVG(r.rating), 0) as avg_rating,
+    COUNT(r.id) as total_reviews,
+    COUNT(CASE WHEN r.rating = 5 THEN 1 END) as five_star_reviews,
+    COUNT(CASE WHEN r.rating >= 4 THEN 1 END) as positive_reviews,
+    COUNT(CASE WHEN r.rating <= 2 THEN 1 END) as negative_reviews,
+    COUNT(CASE WHEN r.created_at >= NOW() - INTERVAL '30 days' THEN 1 END) as recent_reviews,
+    COUNT(DISTINCT o.id) as total_orders,
+    COUNT(DISTINCT CASE WHEN o.status = 'completed' THEN o.id END) as completed_orders,
+    COUNT(DISTINCT CASE WHEN o.created_at >= NOW() - INTERVAL '30 days' THEN o.id END) as recent_orders,
+    COALESCE(SUM(o.total_amount), 0) as total_sales,
+    COALESCE(SUM(CASE WHEN o.created_at >= NOW() - INTERVAL '30 days' THEN o.total_amount ELSE 0 END), 0) as recent_sales
+FROM sellers s
+LEFT JOIN reviews r ON s.user_id = r.seller_id AND r.status = 'published'
+LEFT JOIN orders o ON s.user_id = o.seller_id
+GROUP BY s.id, s.user_id, s.name, s.verified;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_seller_stats_seller_id ON seller_stats(seller_id);
+
+-- v2 smooths ratings towards 3.5 stars with the weight of five reviews
+INSERT INTO reputation_models (version, description, weights, active)
+VALUES (
+    'v2',
+    'Bayesian-smoothed ratings (prior 3.5 stars, weight 5)',
+    '{"base_score": 50, "neutral_rating": 3, "rating_weight": 10, "order_weight": 0.5, "order_cap": 15, "dispute_penalty": 2, "dispute_window_days": 180, "verified_bonus": 10, "recency_half_life_days": 0, "prior_mean": 3.5, "prior_weight": 5}',
+    false
+)
+ON CONFLICT (version) DO NOTHING;
+
+-- Score with v2 from now on, unless an admin has already moved off the
+-- baseline. Stored scores switch over as the scheduler recalculates them.
+-- Only one model may be active, so v1 is switched off first.
+UPDATE reputation_models SET active = false WHERE version = 'v1' AND active;
+UPDATE reputation_models SET active = true
+WHERE version = 'v2' AND NOT EXISTS (SELECT 1 FROM reputation_models WHERE active);
+
+COMMENT ON TABLE review_flags IS 'Reasons reviews were held for moderation';
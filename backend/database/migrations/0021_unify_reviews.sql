@@ -0,0 +1,88 @@
+-- Migration: Unified reviews with replies, reports and moderation
+-- Created: 2026-10-18
+-- Description: Folds legacy order ratings into reviews, adds verified purchases, seller replies, user reports and a moderation audit trail
+
+-- Verified purchase is taken from the order's payment status when the review is created
+ALTER TABLE reviews ADD COLUMN IF NOT EXISTS verified_purchase BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE reviews ADD COLUMN IF NOT EXISTS legacy_rating_id INT UNIQUE;
+
+-- Moderators can now hide reviews as well as reject held ones
+ALTER TABLE reviews DROP CONSTRAINT IF EXISTS reviews_status_check;
+ALTER TABLE reviews ADD CONSTRAINT reviews_status_check
+    CHECK (status IN ('published', 'held', 'hidden', 'rejected'));
+
+-- Backfill verified purchases for existing reviews of paid orders
+UPDATE reviews r
+SET verified_purchase = true
+FROM orders o
+WHERE r.order_id = o.id AND o.payment_status = 'paid';
+
+-- Copy legacy ratings; their integer order references cannot be carried over
+INSERT INTO reviews (buyer_id, seller_id, rating, comment, status, legacy_rating_id, created_at)
+SELECT reviewer_id, seller_id, rating, review, 'published', id, COALESCE(created_at, now())
+FROM ratings
+ON CONFLICT (legacy_rating_id) DO NOTHING;
+
+COMMENT ON TABLE ratings IS 'Deprecated: superseded by reviews; kept read-only for audit';
+DROP TRIGGER IF EXISTS trigger_update_reputation ON ratings;
+
+-- Reputation summary now reads published reviews
+CREATE OR REPLACE VIEW seller_reputation_summary AS
+SELECT
+    u.id as seller_id,
+    u.name as seller_name,
+    COALESCE(AVG(r.rating), 0) as avg_rating,
+    COUNT(r.id) as total_ratings,
+    COUNT(CASE WHEN r.rating = 5 THEN 1 END) as five_star_ratings,
+    COUNT(CASE WHEN r.rating >= 4 THEN 1 END) as positive_ratings,
+    COUNT(CASE WHEN r.rating <= 2 THEN 1 END) as negative_ratings,
+    COUNT(CASE WHEN r.created_at >= NOW() - INTERVAL '30 days' THEN 1 END) as recent_ratings,
+    COALESCE((
+        SELECT score
+        FROM reputation_history rh
+        WHERE rh.user_id = u.id
+        ORDER BY rh.created_at DESC
+        LIMIT 1
+    ), 0) as current_reputation_score
+FROM users u
+LEFT JOIN reviews r ON u.id = r.seller_id AND r.status = 'published'
+WHERE u.role = 'trader' OR u.role = 'seller'
+GROUP BY u.id, u.name;
+
+-- One public seller reply per review
+CREATE TABLE IF NOT EXISTS review_replies (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    review_id UUID NOT NULL UNIQUE REFERENCES reviews(id) ON DELETE CASCADE,
+    seller_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    body TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT now()
+);
+
+-- User reports against reviews
+CREATE TABLE IF NOT EXISTS review_reports (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    review_id UUID NOT NULL REFERENCES reviews(id) ON DELETE CASCADE,
+    reporter_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    reason TEXT NOT NULL CHECK (reason IN ('abusive', 'spam', 'fake', 'off_topic', 'personal_info', 'other')),
+    details TEXT,
+    status TEXT NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'resolved', 'dismissed')),
+    resolved_by UUID REFERENCES users(id),
+    resolved_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    UNIQUE (review_id, reporter_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_review_reports_open ON review_reports(review_id) WHERE status = 'open';
+
+-- Audit trail of moderator decisions
+CREATE TABLE IF NOT EXISTS review_moderation_actions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    review_id UUID NOT NULL REFERENCES reviews(id) ON DELETE CASCADE,
+    moderator_id UUID NOT NULL REFERENCES users(id),
+    action TEXT NOT NULL CHECK (action IN ('publish', 'hide', 'reject')),
+    previous_status TEXT NOT NULL,
+    reason TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_review_moderation_actions_review ON review_moderation_actions(review_id, created_at DESC);
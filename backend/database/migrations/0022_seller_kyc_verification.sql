@@ -0,0 +1,96 @@
+-- Migration: Seller KYC verification
+-- Created: 2026-10-18
+-- Description: Replaces the admin verified toggle with document-based KYC submissions, verification levels with expiry, verified payout accounts and per-level payout limits
+
+-- Verification level on sellers; verified stays in sync for older readers
+ALTER TABLE sellers ADD COLUMN IF NOT EXISTS verification_level TEXT NOT NULL DEFAULT 'none'
+    CHECK (verification_level IN ('none', 'identity', 'business'));
+ALTER TABLE sellers ADD COLUMN IF NOT EXISTS verification_expires_at TIMESTAMP;
+
+-- Sellers verified through the old toggle keep identity level for one renewal period
+UPDATE sellers
+SET verification_level = 'identity', verification_expires_at = now() + INTERVAL '365 days'
+WHERE verified = true AND verification_level = 'none';
+
+-- KYC submissions reviewed by admins
+CREATE TABLE IF NOT EXISTS kyc_submissions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    seller_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    requested_level TEXT NOT NULL CHECK (requested_level IN ('identity', 'business')),
+    approved_level TEXT CHECK (approved_level IN ('identity', 'business')),
+    status TEXT NOT NULL DEFAULT 'pending'
+        CHECK (status IN ('pending', 'approved', 'rejected', 'expired', 'revoked')),
+    payout_provider TEXT NOT NULL CHECK (payout_provider IN ('mpesa', 'stripe', 'paypal')),
+    payout_account_id TEXT NOT NULL,
+    payout_account_name TEXT NOT NULL,
+    checklist JSONB,
+    rejection_reasons JSONB,
+    review_note TEXT,
+    reviewed_by UUID REFERENCES users(id),
+    reviewed_at TIMESTAMP,
+    expires_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_kyc_submissions_status ON kyc_submissions(status, created_at);
+CREATE INDEX IF NOT EXISTS idx_kyc_submissions_seller ON kyc_submissions(seller_id, created_at DESC);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_kyc_submissions_one_pending
+    ON kyc_submissions(seller_id) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_kyc_submissions_expiry
+    ON kyc_submissions(expires_at) WHERE status = 'approved';
+
+-- Documents attached to a submission; only the last four characters of document numbers are kept
+CREATE TABLE IF NOT EXISTS kyc_documents (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    submission_id UUID NOT NULL REFERENCES kyc_submissions(id) ON DELETE CASCADE,
+    doc_type TEXT NOT NULL
+        CHECK (doc_type IN ('national_id', 'passport', 'business_registration', 'coop_membership')),
+    file_url TEXT NOT NULL,
+    number_last4 TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_kyc_documents_submission ON kyc_documents(submission_id);
+
+-- The payout account checked during KYC; verified sellers can only be paid here
+CREATE TABLE IF NOT EXISTS seller_payout_accounts (
+    seller_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    provider TEXT NOT NULL,
+    account_id TEXT NOT NULL,
+    account_name TEXT NOT NULL,
+    submission_id UUID REFERENCES kyc_submissions(id),
+    verified_at TIMESTAMP NOT NULL DEFAULT now()
+);
+
+-- Payout limits per verification level and currency
+CREATE TABLE IF NOT EXISTS kyc_payout_limits (
+    level TEXT NOT NULL CHECK (level IN ('none', 'identity', 'business')),
+    currency TEXT NOT NULL,
+    per_payout NUMERIC(15,2) NOT NULL CHECK (per_payout >= 0),
+    rolling_30_days NUMERIC(15,2) NOT NULL CHECK (rolling_30_days >= 0),
+    PRIMARY KEY (level, currency)
+);
+
+INSERT INTO kyc_payout_limits (level, currency, per_payout, rolling_30_days) VALUES
+    ('none', 'KES', 10000, 30000),
+    ('identity', 'KES', 150000, 1000000),
+    ('business', 'KES', 1000000, 10000000),
+    ('none', 'UGX', 300000, 900000),
+    ('identity', 'UGX', 4500000, 30000000),
+    ('business', 'UGX', 30000000, 300000000),
+    ('none', 'TZS', 200000, 600000),
+    ('identity', 'TZS', 3000000, 20000000),
+    ('business', 'TZS', 20000000, 200000000),
+    ('none', 'USD', 75, 250),
+    ('identity', 'USD', 1000, 7500),
+    ('business', 'USD', 7500, 75000)
+ON CONFLICT (level, currency) DO NOTHING;
+
+-- Model v3 adds a bonus for business-verified sellers on top of the verified
+-- bonus. It is seeded inactive for an admin to dry-run and activate.
+INSERT INTO reputation_models (version, description, weights, active)
+SELECT 'v3', 'Bayesian prior with business verification bonus',
+       weights || '{"business_verified_bonus": 5}'::jsonb, false
+FROM reputation_models WHERE version = 'v2'
+ON CONFLICT (version) DO NOTHING;
+
@@ -0,0 +1,183 @@
+-- Migration: Unify product catalogue
+-- Created: 2026-10-18
+-- Description: Makes marketplace_products a single catalogue with seller_id, title, price_cents, currency and images as the only product columns, backfills them from the legacy trader columns and drops the public_products compatibility view
+
+-- Views that read legacy columns are recreated below
+DROP VIEW IF EXISTS public_products;
+DROP VIEW IF EXISTS marketplace_thread_summary;
+
+-- Canonical catalogue columns
+ALTER TABLE marketplace_products ADD COLUMN IF NOT EXISTS seller_id UUID REFERENCES users(id);
+ALTER TABLE marketplace_products ADD COLUMN IF NOT EXISTS title TEXT;
+ALTER TABLE marketplace_products ADD COLUMN IF NOT EXISTS price_cents BIGINT;
+ALTER TABLE marketplace_products ADD COLUMN IF NOT EXISTS currency TEXT DEFAULT 'KES';
+ALTER TABLE marketplace_products ADD COLUMN IF NOT EXISTS images JSONB DEFAULT '[]'::jsonb;
+ALTER TABLE marketplace_products ADD COLUMN IF NOT EXISTS stock INT DEFAULT 0;
+ALTER TABLE marketplace_products ADD COLUMN IF NOT EXISTS is_active BOOLEAN DEFAULT true;
+ALTER TABLE marketplace_products ADD COLUMN IF NOT EXISTS search_tsv tsvector;
+
+-- Backfill from the legacy trader columns, then drop them so there is one write path
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM information_schema.columns
+               WHERE table_name = 'marketplace_products' AND column_name = 'trader_id') THEN
+        UPDATE marketplace_products SET seller_id = trader_id WHERE seller_id IS NULL;
+        ALTER TABLE marketplace_products DROP COLUMN trader_id;
+    END IF;
+
+    IF EXISTS (SELECT 1 FROM information_schema.columns
+               WHERE table_name = 'marketplace_products' AND column_name = 'name') THEN
+        UPDATE marketplace_products SET title = name WHERE title IS NULL;
+        ALTER TABLE marketplace_products DROP COLUMN name;
+    END IF;
+
+    IF EXISTS (SELECT 1 FROM information_schema.columns
+               WHERE table_name = 'marketplace_products' AND column_name = 'price') THEN
+        UPDATE marketplace_products SET price_cents = ROUND(price * 100)::bigint WHERE price_cents IS NULL;
+        ALTER TABLE marketplace_products DROP COLUMN price;
+    END IF;
+
+    IF EXISTS (SELECT 1 FROM information_schema.columns
+               WHERE table_name = 'marketplace_products' AND column_name = 'image_url') THEN
+        UPDATE marketplace_products SET images = jsonb_build_array(image_url)
+        WHERE image_url IS NOT NULL AND image_url <> ''
+          AND (images IS NULL OR images = '[]'::jsonb OR images = 'null'::jsonb);
+        ALTER TABLE marketplace_products DROP COLUMN image_url;
+    END IF;
+
+    IF EXISTS (SELECT 1 FROM information_schema.columns
+               WHERE table_name = 'marketplace_products' AND column_name = 'status') THEN
+        UPDATE marketplace_products SET is_active = (status = 'active');
+        ALTER TABLE marketplace_products DROP COLUMN status;
+    END IF;
+
+    IF EXISTS (SELECT 1 FROM information_schema.columns
+               WHERE table_name = 'marketplace_products' AND column_name = 'quantity') THEN
+        UPDATE marketplace_products SET stock = quantity WHERE stock IS NULL OR stock = 0;
+        ALTER TABLE marketplace_products DROP COLUMN quantity;
+    END IF;
+END $$;
+
+-- Listings without an owner cannot be sold or managed; they stay for order history but are hidden
+UPDATE marketplace_products SET is_active = false WHERE seller_id IS NULL;
+
+-- Legacy listings could be free or unnamed; they are hidden until their seller fixes them
+UPDATE marketplace_products
+SET is_active = false,
+    title = COALESCE(NULLIF(btrim(title), ''), 'Untitled listing'),
+    price_cents = COALESCE(price_cents, 0)
+WHERE title IS NULL OR btrim(title) = '' OR price_cents IS NULL OR price_cents <= 0;
+
+UPDATE marketplace_products SET currency = 'KES' WHERE currency IS NULL;
+UPDATE marketplace_products SET images = '[]'::jsonb WHERE images IS NULL OR images = 'null'::jsonb;
+UPDATE marketplace_products SET stock = 0 WHERE stock IS NULL OR stock < 0;
+UPDATE marketplace_products SET is_active = true WHERE is_active IS NULL;
+UPDATE marketplace_products SET category = 'other' WHERE category IS NULL;
+UPDATE marketplace_products SET description = '' WHERE description IS NULL;
+
+ALTER TABLE marketplace_products
+    ALTER COLUMN title SET NOT NULL,
+    ALTER COLUMN price_cents SET NOT NULL,
+    ALTER COLUMN currency SET NOT NULL,
+    ALTER COLUMN images SET NOT NULL,
+    ALTER COLUMN stock SET NOT NULL,
+    ALTER COLUMN is_active SET NOT NULL,
+    ALTER COLUMN category SET NOT NULL,
+    ALTER COLUMN description SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_marketplace_products_seller ON marketplace_products(seller_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_marketplace_products_active_created
+    ON marketplace_products(created_at DESC) WHERE is_active = true;
+CREATE INDEX IF NOT EXISTS idx_marketplace_products_search_tsv ON marketplace_products USING GIN (search_tsv);
+
+-- Search vector reads the canonical title only
+CREATE OR REPLACE FUNCTION update_search_tsv() RETURNS trigger AS $$
+BEGIN
+  NEW.search_tsv :=
+    setweight(to_tsvector('simple', coalesce(NEW.title, '')), 'A') ||
+    setweight(to_tsvector('simple', coalesce(NEW.category::text, '')), 'B') ||
+    setweight(to_tsvector('simple', coalesce(NEW.description, '')), 'C');
+  RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_marketplace_products_search ON marketplace_products;
+CREATE TRIGGER trg_marketplace_products_search
+BEFORE INSERT OR UPDATE ON marketplace_products
+FOR EACH ROW EXECUTE FUNCTION update_search_tsv();
+
+-- Rebuild search vectors for backfilled rows
+UPDATE marketplace_products SET title = title;
+
+-- Hidden free listings would fail the price check, so it is added NOT VALID
+-- and only validated once none are left; until then it holds for new and
+-- updated rows
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'marketplace_products_price_cents_positive') THEN
+        ALTER TABLE marketplace_products
+            ADD CONSTRAINT marketplace_products_price_cents_positive CHECK (price_cents > 0) NOT VALID;
+    END IF;
+    IF NOT EXISTS (SELECT 1 FROM marketplace_products WHERE price_cents <= 0) THEN
+        ALTER TABLE marketplace_products VALIDATE CONSTRAINT marketplace_products_price_cents_positive;
+    END IF;
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'marketplace_products_stock_non_negative') THEN
+        ALTER TABLE marketplace_products
+            ADD CONSTRAINT marketplace_products_stock_non_negative CHECK (stock >= 0);
+    END IF;
+END $$;
+
+-- Thread summary reads product details from the catalogue columns
+CREATE OR REPLACE VIEW marketplace_thread_summary AS
+SELECT
+    mt.id,
+    mt.thread_ref,
+    mt.product_id,
+    mt.order_id,
+    mt.buyer_id,
+    mt.seller_id,
+    mt.status,
+    mt.created_at,
+    mt.updated_at,
+
+    -- Product info
+    mp.title as product_name,
+    (mp.price_cents / 100.0)::numeric(12,2) as product_price,
+
+    -- Order info
+    o.quantity as order_quantity,
+    o.total_price as order_total,
+    o.status as order_status,
+
+    -- User info
+    buyer.name as buyer_name,
+    seller.name as seller_name,
+
+    -- Latest message
+    latest_msg.body as latest_message_body,
+    latest_msg.created_at as latest_message_at,
+    latest_msg.sender_id as latest_message_sender,
+    sender.name as latest_message_sender_name,
+
+    -- Participant counts
+    (SELECT COUNT(*) FROM marketplace_thread_participants mtp WHERE mtp.thread_id = mt.id) as participant_count,
+
+    -- Unread count per participant
+    (SELECT COUNT(*) FROM marketplace_messages mm
+     WHERE mm.thread_id = mt.id
+     AND mm.created_at > COALESCE(mtp.last_read_at, mt.created_at)) as unread_count
+
+FROM marketplace_threads mt
+LEFT JOIN marketplace_products mp ON mt.product_id = mp.id
+LEFT JOIN orders o ON mt.order_id = o.id
+LEFT JOIN users buyer ON mt.buyer_id = buyer.id
+LEFT JOIN users seller ON mt.seller_id = seller.id
+LEFT JOIN LATERAL (
+    SELECT mm.body, mm.created_at, mm.sender_id
+    FROM marketplace_messages mm
+    WHERE mm.thread_id = mt.id
+    ORDER BY mm.created_at DESC
+    LIMIT 1
+) latest_msg ON true
+LEFT JOIN users sender ON latest_msg.sender_id = sender.id
+LEFT JOIN marketplace_thread_participants mtp ON mtp.thread_id = mt.id;
@@ -0,0 +1,47 @@
+-- Migration: Product variants
+-- Created: 2026-10-18
+-- Description: Adds product_variants so one listing can be sold in several pack sizes and units, backfills a single per-piece variant for existing products and links order items to the variant they bought
+
+CREATE TABLE IF NOT EXISTS product_variants (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    product_id UUID NOT NULL REFERENCES marketplace_products(id) ON DELETE CASCADE,
+    sku VARCHAR(64) NOT NULL,
+    pack_size NUMERIC(12,3) NOT NULL CHECK (pack_size > 0),
+    unit TEXT NOT NULL CHECK (unit IN ('g', 'kg', 't', 'ml', 'l', 'piece', 'seedling')),
+    price_cents BIGINT NOT NULL CHECK (price_cents > 0),
+    stock INT NOT NULL DEFAULT 0 CHECK (stock >= 0),
+    barcode VARCHAR(14),
+    is_active BOOLEAN NOT NULL DEFAULT true,
+    -- Comparison price per kg, litre or item, kept in step by the application
+    base_unit TEXT NOT NULL CHECK (base_unit IN ('kg', 'l', 'piece', 'seedling')),
+    unit_price_cents NUMERIC(16,4) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (product_id, sku)
+);
+
+CREATE INDEX IF NOT EXISTS idx_product_variants_product ON product_variants(product_id);
+CREATE INDEX IF NOT EXISTS idx_product_variants_unit_price
+    ON product_variants(base_unit, unit_price_cents) WHERE is_active;
+-- Several sellers may stock the same manufactured item, so barcodes are not unique
+CREATE INDEX IF NOT EXISTS idx_product_variants_barcode
+    ON product_variants(barcode) WHERE barcode IS NOT NULL;
+
+-- Every existing listing becomes a single piece at its current price and stock
+INSERT INTO product_variants (product_id, sku, pack_size, unit, price_cents, stock, base_unit, unit_price_cents)
+SELECT p.id, upper(left(p.id::text, 8)) || '-1PIECE', 1, 'piece',
+       p.price_cents, GREATEST(COALESCE(p.stock, 0), 0), 'piece', p.price_cents
+FROM marketplace_products p
+WHERE p.price_cents > 0
+  AND NOT EXISTS (SELECT 1 FROM product_variants v WHERE v.product_id = p.id);
+
+-- Order items reference the variant bought; older items keep a NULL variant
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM information_schema.tables WHERE table_name = 'order_items')
+       AND NOT EXISTS (SELECT 1 FROM information_schema.columns
+                       WHERE table_name = 'order_items' AND column_name = 'variant_id') THEN
+        ALTER TABLE order_items ADD COLUMN variant_id UUID REFERENCES product_variants(id) ON DELETE SET NULL;
+        CREATE INDEX idx_order_items_variant_id ON order_items(variant_id);
+    END IF;
+END $$;
@@ -0,0 +1,67 @@
+-- Migration: Search dictionary
+-- Created: 2026-10-18
+-- Description: Enables pg_trgm and a trigram index on product titles for typo-tolerant matching, and adds search_terms, the synonym, spelling and translation dictionary the search subsystem expands queries with
+
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- Typo matching compares query words with titles through the <% operator,
+-- which this index serves
+CREATE INDEX IF NOT EXISTS idx_marketplace_products_title_trgm
+    ON marketplace_products USING GIN (title gin_trgm_ops);
+
+CREATE TABLE IF NOT EXISTS search_terms (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    term TEXT NOT NULL,
+    expansion TEXT NOT NULL,
+    kind TEXT NOT NULL CHECK (kind IN ('synonym', 'spelling', 'translation')),
+    locale TEXT NOT NULL DEFAULT 'en',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (term, expansion),
+    CHECK (term <> expansion)
+);
+
+CREATE INDEX IF NOT EXISTS idx_search_terms_locale ON search_terms(locale);
+
+-- Facet lookups on the seller's location
+CREATE INDEX IF NOT EXISTS idx_sellers_location_city ON sellers ((lower(location->>'city')));
+
+-- Starter dictionary; entries work in both directions and are maintained
+-- through /api/admin/search/terms
+INSERT INTO search_terms (term, expansion, kind, locale) VALUES
+    -- British and American spellings
+    ('fertiliser', 'fertilizer', 'spelling', 'en'),
+    ('fertilisers', 'fertilizer', 'spelling', 'en'),
+    ('pesticides', 'pesticide', 'spelling', 'en'),
+    ('herbicides', 'herbicide', 'spelling', 'en'),
+    ('sulphate', 'sulfate', 'spelling', 'en'),
+
+    -- Product names and abbreviations
+    ('dap', 'fertilizer', 'synonym', 'en'),
+    ('dap', 'diammonium phosphate', 'synonym', 'en'),
+    ('npk', 'fertilizer', 'synonym', 'en'),
+    ('urea', 'fertilizer', 'synonym', 'en'),
+    ('manure', 'fertilizer', 'synonym', 'en'),
+    ('seed', 'seeds', 'synonym', 'en'),
+    ('seedlings', 'seeds', 'synonym', 'en'),
+    ('corn', 'maize', 'synonym', 'en'),
+    ('knapsack', 'sprayer', 'synonym', 'en'),
+    ('tractor', 'machinery', 'synonym', 'en'),
+
+    -- Swahili
+    ('mbolea', 'fertilizer', 'translation', 'sw'),
+    ('mbegu', 'seeds', 'translation', 'sw'),
+    ('miche', 'seedlings', 'translation', 'sw'),
+    ('mahindi', 'maize', 'translation', 'sw'),
+    ('maharagwe', 'beans', 'translation', 'sw'),
+    ('nyanya', 'tomato', 'translation', 'sw'),
+    ('viazi', 'potato', 'translation', 'sw'),
+    ('kabichi', 'cabbage', 'translation', 'sw'),
+    ('sukuma wiki', 'kale', 'translation', 'sw'),
+    ('mtama', 'sorghum', 'translation', 'sw'),
+    ('ngano', 'wheat', 'translation', 'sw'),
+    ('mchele', 'rice', 'translation', 'sw'),
+    ('dawa ya wadudu', 'pesticide', 'translation', 'sw'),
+    ('jembe', 'hoe', 'translation', 'sw'),
+    ('zana', 'tools', 'translation', 'sw'),
+    ('trekta', 'tractor', 'translation', 'sw')
+ON CONFLICT (term, expansion) DO NOTHING;
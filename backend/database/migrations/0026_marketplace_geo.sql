@@ -0,0 +1,60 @@
+-- Migration: Marketplace geo browsing
+-- Created: 2026-10-18
+-- Description: Adds indexed seller coordinates kept in sync with sellers.location, and seller_service_areas (radius or polygon) for "within N km" and "delivers to me" browsing
+
+-- earthdistance ships with the standard Postgres contrib modules
+CREATE EXTENSION IF NOT EXISTS cube;
+CREATE EXTENSION IF NOT EXISTS earthdistance;
+
+ALTER TABLE sellers ADD COLUMN IF NOT EXISTS lat DOUBLE PRECISION;
+ALTER TABLE sellers ADD COLUMN IF NOT EXISTS lng DOUBLE PRECISION;
+
+-- sellers.location stays the source of truth; lat/lng are copied out so
+-- they can be indexed. Missing or out-of-range coordinates become NULL.
+CREATE OR REPLACE FUNCTION sync_seller_coordinates() RETURNS trigger AS $$
+BEGIN
+    NEW.lat := NULL;
+    NEW.lng := NULL;
+    IF jsonb_typeof(NEW.location->'lat') = 'number' AND jsonb_typeof(NEW.location->'lng') = 'number'
+       AND (NEW.location->>'lat')::float8 BETWEEN -90 AND 90
+       AND (NEW.location->>'lng')::float8 BETWEEN -180 AND 180 THEN
+        NEW.lat := (NEW.location->>'lat')::float8;
+        NEW.lng := (NEW.location->>'lng')::float8;
+    END IF;
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_sellers_coordinates ON sellers;
+CREATE TRIGGER trg_sellers_coordinates
+BEFORE INSERT OR UPDATE OF location ON sellers
+FOR EACH ROW EXECUTE FUNCTION sync_seller_coordinates();
+
+UPDATE sellers SET location = location;
+
+CREATE INDEX IF NOT EXISTS idx_sellers_earth ON sellers
+    USING GIST (ll_to_earth(lat, lng)) WHERE lat IS NOT NULL AND lng IS NOT NULL;
+
+-- Delivery areas; seller_id is the seller's user ID, as on marketplace_products
+CREATE TABLE IF NOT EXISTS seller_service_areas (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    seller_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL DEFAULT '',
+    kind TEXT NOT NULL CHECK (kind IN ('radius', 'polygon')),
+    center_lat DOUBLE PRECISION CHECK (center_lat BETWEEN -90 AND 90),
+    center_lng DOUBLE PRECISION CHECK (center_lng BETWEEN -180 AND 180),
+    radius_km DOUBLE PRECISION CHECK (radius_km > 0),
+    -- x = lng, y = lat
+    boundary POLYGON,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    CHECK (
+        (kind = 'radius' AND center_lat IS NOT NULL AND center_lng IS NOT NULL AND radius_km IS NOT NULL AND boundary IS NULL)
+        OR (kind = 'polygon' AND boundary IS NOT NULL)
+    )
+);
+
+CREATE INDEX IF NOT EXISTS idx_seller_service_areas_seller ON seller_service_areas(seller_id);
+CREATE INDEX IF NOT EXISTS idx_seller_service_areas_boundary ON seller_service_areas USING GIST (boundary);
+
+CREATE INDEX IF NOT EXISTS idx_marketplace_products_seller_active
+    ON marketplace_products(seller_id) WHERE is_active = true;
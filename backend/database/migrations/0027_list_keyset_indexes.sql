@@ -0,0 +1,22 @@
+-- Migration: Keyset pagination indexes
+-- Created: 2026-10-18
+-- Description: Adds (owner, created_at, id) indexes matching the ORDER BY of cursor-paginated list endpoints, so each page is an index range scan
+
+CREATE INDEX IF NOT EXISTS idx_orders_user_keyset ON orders(user_id, created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_orders_seller_keyset ON orders(seller_id, created_at DESC, id DESC);
+
+CREATE INDEX IF NOT EXISTS idx_notifications_user_keyset ON notifications(user_id, created_at DESC, id DESC);
+
+CREATE INDEX IF NOT EXISTS idx_activity_logs_keyset ON activity_logs(created_at DESC, id DESC);
+
+CREATE INDEX IF NOT EXISTS idx_disputes_buyer_keyset ON disputes(buyer_id, created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_disputes_seller_keyset ON disputes(seller_id, created_at DESC, id DESC);
+
+CREATE INDEX IF NOT EXISTS idx_reviews_seller_keyset ON reviews(seller_id, created_at DESC, id DESC);
+
+CREATE INDEX IF NOT EXISTS idx_kyc_submissions_status_keyset ON kyc_submissions(status, created_at, id);
+
+CREATE INDEX IF NOT EXISTS idx_marketplace_messages_thread_keyset ON marketplace_messages(thread_id, created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_messages_conversation_keyset ON messages(conversation_id, created_at DESC, id DESC);
+
+CREATE INDEX IF NOT EXISTS idx_marketplace_products_keyset ON marketplace_products(created_at DESC, id DESC);
@@ -0,0 +1,28 @@
+-- Migration: Product import jobs
+-- Created: 2026-10-18
+-- Description: Tracks bulk catalogue imports from CSV/XLSX so traders can follow the progress of large files and download a row-level error report
+
+CREATE TABLE IF NOT EXISTS product_import_jobs (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    seller_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    status VARCHAR(20) NOT NULL DEFAULT 'queued' CHECK (status IN ('queued', 'running', 'completed', 'failed')),
+    filename VARCHAR(255) NOT NULL DEFAULT '',
+    format VARCHAR(10) NOT NULL CHECK (format IN ('csv', 'xlsx')),
+    total_rows INTEGER NOT NULL DEFAULT 0,
+    processed_rows INTEGER NOT NULL DEFAULT 0,
+    created_count INTEGER NOT NULL DEFAULT 0,
+    updated_count INTEGER NOT NULL DEFAULT 0,
+    unchanged_count INTEGER NOT NULL DEFAULT 0,
+    failed_count INTEGER NOT NULL DEFAULT 0,
+    -- Row-level problems, written when the job finishes
+    row_errors JSONB NOT NULL DEFAULT '[]'::jsonb,
+    -- Set when the job as a whole failed
+    error TEXT,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    started_at TIMESTAMP WITH TIME ZONE,
+    finished_at TIMESTAMP WITH TIME ZONE,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_product_import_jobs_seller ON product_import_jobs(seller_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_product_import_jobs_unfinished ON product_import_jobs(status) WHERE status IN ('queued', 'running');
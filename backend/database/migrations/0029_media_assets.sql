@@ -0,0 +1,19 @@
+-- Migration: Media assets
+-- Created: 2026-10-18
+-- Description: Uploaded product and pest images with their resized JPEG/PNG and WebP renditions. Product images and pest reports reference assets as "media:<id>" alongside legacy bare URLs.
+
+CREATE TABLE IF NOT EXISTS media_assets (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    owner_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    kind VARCHAR(20) NOT NULL CHECK (kind IN ('product', 'pest')),
+    content_type VARCHAR(50) NOT NULL,
+    -- Dimensions of the upright source image
+    width INTEGER NOT NULL CHECK (width > 0),
+    height INTEGER NOT NULL CHECK (height > 0),
+    size_bytes BIGINT NOT NULL CHECK (size_bytes > 0),
+    -- Stored renditions: name, format, dimensions and storage key
+    variants JSONB NOT NULL DEFAULT '[]'::jsonb,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_media_assets_owner ON media_assets(owner_id, created_at DESC);
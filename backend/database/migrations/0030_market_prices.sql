@@ -0,0 +1,58 @@
+-- Migration: Price history and market price indices
+-- Created: 2026-10-18
+-- Description: Records every variant price change, stores observations from the external commodity price feed, and keeps per-category, per-region market price indices (per base unit) built from listings, delivered orders and the feed
+
+CREATE TABLE IF NOT EXISTS product_price_history (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    product_id UUID NOT NULL REFERENCES marketplace_products(id) ON DELETE CASCADE,
+    variant_id UUID NOT NULL REFERENCES product_variants(id) ON DELETE CASCADE,
+    price_cents BIGINT NOT NULL,
+    -- NULL for the price a variant was created with
+    previous_price_cents BIGINT,
+    unit_price_cents NUMERIC(16,4) NOT NULL,
+    base_unit TEXT NOT NULL,
+    recorded_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_product_price_history_product ON product_price_history(product_id, recorded_at DESC);
+CREATE INDEX IF NOT EXISTS idx_product_price_history_variant ON product_price_history(variant_id, recorded_at DESC);
+
+-- Start every existing variant's history at its current price
+INSERT INTO product_price_history (product_id, variant_id, price_cents, unit_price_cents, base_unit, recorded_at)
+SELECT v.product_id, v.id, v.price_cents, v.unit_price_cents, v.base_unit, v.updated_at
+FROM product_variants v
+WHERE NOT EXISTS (SELECT 1 FROM product_price_history h WHERE h.variant_id = v.id);
+
+-- Commodity prices imported from the external market data feed, per base unit
+CREATE TABLE IF NOT EXISTS commodity_prices (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    source TEXT NOT NULL,
+    commodity TEXT NOT NULL,
+    category TEXT NOT NULL CHECK (category IN ('seeds', 'fertilizer', 'tools', 'machinery', 'other')),
+    -- Lowercased market or region name, matched against seller locations
+    region TEXT NOT NULL DEFAULT '',
+    base_unit TEXT NOT NULL CHECK (base_unit IN ('kg', 'l', 'piece', 'seedling')),
+    currency CHAR(3) NOT NULL,
+    unit_price_cents NUMERIC(16,4) NOT NULL CHECK (unit_price_cents > 0),
+    observed_on DATE NOT NULL,
+    imported_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (source, commodity, region, base_unit, observed_on)
+);
+
+CREATE INDEX IF NOT EXISTS idx_commodity_prices_observed ON commodity_prices(observed_on DESC);
+
+-- Rebuilt by the pricing service; region '' is the index across all regions
+CREATE TABLE IF NOT EXISTS market_price_indices (
+    category TEXT NOT NULL,
+    region TEXT NOT NULL,
+    base_unit TEXT NOT NULL,
+    currency CHAR(3) NOT NULL,
+    median_unit_price_cents NUMERIC(16,4) NOT NULL,
+    p25_unit_price_cents NUMERIC(16,4) NOT NULL,
+    p75_unit_price_cents NUMERIC(16,4) NOT NULL,
+    listing_count INTEGER NOT NULL DEFAULT 0,
+    order_count INTEGER NOT NULL DEFAULT 0,
+    feed_count INTEGER NOT NULL DEFAULT 0,
+    computed_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (category, region, base_unit, currency)
+);
@@ -0,0 +1,59 @@
+-- Migration: Inventory ledger and reorder thresholds
+-- Created: 2026-10-18
+-- Description: Records every stock movement with its reason and actor, holds stock reserved by placed orders apart from the stock available to sell, and adds per-product reorder thresholds for low-stock alerts
+
+-- Stock stays the quantity available to sell; reserved is held for orders
+-- that have not been delivered or cancelled yet
+ALTER TABLE product_variants ADD COLUMN IF NOT EXISTS reserved INT NOT NULL DEFAULT 0;
+
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'product_variants_reserved_non_negative') THEN
+        ALTER TABLE product_variants
+            ADD CONSTRAINT product_variants_reserved_non_negative CHECK (reserved >= 0);
+    END IF;
+END $$;
+
+-- A low-stock alert is sent when stock falls to the threshold;
+-- low_stock_alerted_at is cleared once stock rises above it again
+ALTER TABLE marketplace_products ADD COLUMN IF NOT EXISTS reorder_threshold INT;
+ALTER TABLE marketplace_products ADD COLUMN IF NOT EXISTS low_stock_alerted_at TIMESTAMPTZ;
+
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'marketplace_products_reorder_threshold_non_negative') THEN
+        ALTER TABLE marketplace_products
+            ADD CONSTRAINT marketplace_products_reorder_threshold_non_negative CHECK (reorder_threshold >= 0);
+    END IF;
+END $$;
+
+CREATE TABLE IF NOT EXISTS inventory_movements (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    product_id UUID NOT NULL REFERENCES marketplace_products(id) ON DELETE CASCADE,
+    -- Kept after a variant is deleted so past sales still count
+    variant_id UUID REFERENCES product_variants(id) ON DELETE SET NULL,
+    seller_id UUID NOT NULL,
+    reason TEXT NOT NULL CHECK (reason IN ('adjustment', 'import', 'reservation', 'release', 'sale', 'return')),
+    -- Changes to the available and reserved stock, and the levels after
+    quantity INT NOT NULL,
+    reserved_change INT NOT NULL DEFAULT 0,
+    stock_after INT NOT NULL,
+    reserved_after INT NOT NULL DEFAULT 0,
+    price_cents BIGINT NOT NULL,
+    order_id UUID REFERENCES orders(id) ON DELETE SET NULL,
+    actor_id UUID,
+    note TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_inventory_movements_seller ON inventory_movements(seller_id, created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_inventory_movements_variant ON inventory_movements(variant_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_inventory_movements_order ON inventory_movements(order_id) WHERE order_id IS NOT NULL;
+
+-- Open every existing variant's ledger at its current stock
+INSERT INTO inventory_movements (product_id, variant_id, seller_id, reason, quantity, stock_after, price_cents, note, created_at)
+SELECT v.product_id, v.id, p.seller_id, 'adjustment', v.stock, v.stock, v.price_cents, 'Opening balance', v.updated_at
+FROM product_variants v
+JOIN marketplace_products p ON p.id = v.product_id
+WHERE v.stock <> 0
+  AND NOT EXISTS (SELECT 1 FROM inventory_movements m WHERE m.variant_id = v.id);
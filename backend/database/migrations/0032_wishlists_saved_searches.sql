@@ -0,0 +1,59 @@
+-- Migration: Wishlists, saved searches and watch alerts
+-- Created: 2026-10-18
+-- Description: Lets buyers wishlist listings and save marketplace searches, queues alerts for new matching listings, wishlist price drops and restocks, and stores how often each user wants them delivered
+
+CREATE TABLE IF NOT EXISTS wishlist_items (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    product_id UUID NOT NULL REFERENCES marketplace_products(id) ON DELETE CASCADE,
+    -- The listing's price and availability when last checked, so drops and
+    -- restocks are alerted once
+    seen_price_cents BIGINT NOT NULL,
+    seen_in_stock BOOLEAN NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (user_id, product_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_wishlist_items_user ON wishlist_items(user_id, created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_wishlist_items_product ON wishlist_items(product_id);
+
+-- filter holds the marketplace list filter in its query parameter names
+CREATE TABLE IF NOT EXISTS saved_searches (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    filter JSONB NOT NULL DEFAULT '{}',
+    notify BOOLEAN NOT NULL DEFAULT TRUE,
+    -- Listings created after checked_at have not been matched yet
+    checked_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_saved_searches_user ON saved_searches(user_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_saved_searches_notify ON saved_searches(checked_at) WHERE notify;
+
+-- Users without a row get every alert as it happens
+CREATE TABLE IF NOT EXISTS watch_preferences (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    frequency TEXT NOT NULL DEFAULT 'instant' CHECK (frequency IN ('instant', 'daily', 'weekly', 'off')),
+    last_digest_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- Alerts wait here until they are delivered, alone or in a digest
+CREATE TABLE IF NOT EXISTS watch_alerts (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    kind TEXT NOT NULL CHECK (kind IN ('new_listing', 'price_drop', 'back_in_stock')),
+    product_id UUID NOT NULL REFERENCES marketplace_products(id) ON DELETE CASCADE,
+    saved_search_id UUID REFERENCES saved_searches(id) ON DELETE CASCADE,
+    price_cents BIGINT NOT NULL,
+    previous_price_cents BIGINT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    delivered_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_watch_alerts_pending ON watch_alerts(user_id, created_at) WHERE delivered_at IS NULL;
+-- A listing matches a saved search once
+CREATE UNIQUE INDEX IF NOT EXISTS idx_watch_alerts_search_listing ON watch_alerts(saved_search_id, product_id) WHERE kind = 'new_listing';
@@ -0,0 +1,53 @@
+-- Migration: Notification channels, preferences and delivery log
+-- Created: 2026-10-18
+-- Description: Delivers notifications over in-app, websocket, email, SMS and push according to per-user, per-type channel preferences and quiet hours, and records every delivery attempt per channel
+
+-- SMS needs a number; push needs the user's device tokens
+ALTER TABLE users ADD COLUMN IF NOT EXISTS phone TEXT;
+
+CREATE TABLE IF NOT EXISTS push_devices (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token TEXT NOT NULL UNIQUE,
+    platform TEXT NOT NULL DEFAULT 'web' CHECK (platform IN ('android', 'ios', 'web')),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_seen_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_push_devices_user ON push_devices(user_id);
+
+-- Overrides of the default channels; type '*' applies to every type and a
+-- specific type overrides it
+CREATE TABLE IF NOT EXISTS notification_channel_preferences (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    type TEXT NOT NULL,
+    channel TEXT NOT NULL CHECK (channel IN ('in_app', 'websocket', 'email', 'sms', 'push')),
+    enabled BOOLEAN NOT NULL,
+    PRIMARY KEY (user_id, type, channel)
+);
+
+-- Email, SMS and push wait until quiet hours end in the user's timezone
+CREATE TABLE IF NOT EXISTS notification_settings (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    quiet_start TEXT,
+    quiet_end TEXT,
+    timezone TEXT NOT NULL DEFAULT 'UTC',
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS notification_deliveries (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    notification_id UUID NOT NULL REFERENCES notifications(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL,
+    channel TEXT NOT NULL CHECK (channel IN ('websocket', 'email', 'sms', 'push')),
+    status TEXT NOT NULL CHECK (status IN ('sent', 'failed', 'skipped', 'deferred')),
+    attempts INT NOT NULL DEFAULT 0,
+    error TEXT NOT NULL DEFAULT '',
+    -- Set while a deferred or failed delivery is still to be tried
+    next_attempt_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_notification_deliveries_notification ON notification_deliveries(notification_id);
+CREATE INDEX IF NOT EXISTS idx_notification_deliveries_due ON notification_deliveries(next_attempt_at) WHERE next_attempt_at IS NOT NULL;
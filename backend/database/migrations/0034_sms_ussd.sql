@@ -0,0 +1,24 @@
+-- Migration: SMS gateway, phone verification and USSD
+-- Created: 2026-10-18
+-- Description: Verifies users' phone numbers with one-time codes sent by SMS, so SMS notifications and USSD sessions only reach the number's owner
+
+-- SMS notifications and USSD sessions only use verified numbers
+ALTER TABLE users ADD COLUMN IF NOT EXISTS phone_verified_at TIMESTAMPTZ;
+
+-- A verified number belongs to one user; verifying it elsewhere moves it
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_verified_phone ON users(phone) WHERE phone_verified_at IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS sms_otps (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    phone TEXT NOT NULL,
+    purpose TEXT NOT NULL,
+    code_hash TEXT NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    expires_at TIMESTAMPTZ NOT NULL,
+    consumed_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_sms_otps_lookup ON sms_otps(user_id, purpose, phone, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_sms_otps_phone_created ON sms_otps(phone, created_at);
@@ -0,0 +1,6 @@
+-- Migration: Preferred language for notifications
+-- Created: 2026-10-18
+-- Description: Stores each user's preferred language, which notification templates are rendered in
+
+-- Languages are primary language codes with notification templates, e.g. en, sw, fr
+ALTER TABLE users ADD COLUMN IF NOT EXISTS preferred_language VARCHAR(10) NOT NULL DEFAULT 'en';
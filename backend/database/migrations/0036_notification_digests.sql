@@ -0,0 +1,37 @@
+-- Migration: Notification digests
+-- Created: 2026-10-18
+-- Description: Batches normal-priority notifications into hourly or daily digests per user, sent over one channel at the user's local time, while high-priority ones still go out immediately
+
+-- The digest shares the user's timezone with quiet hours
+ALTER TABLE notification_settings
+    ADD COLUMN IF NOT EXISTS digest_frequency TEXT CHECK (digest_frequency IN ('hourly', 'daily')),
+    ADD COLUMN IF NOT EXISTS digest_channel TEXT CHECK (digest_channel IN ('email', 'sms', 'push')),
+    -- Local HH:MM daily digests go out at
+    ADD COLUMN IF NOT EXISTS digest_at TEXT,
+    ADD COLUMN IF NOT EXISTS next_digest_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_notification_settings_next_digest ON notification_settings(next_digest_at) WHERE next_digest_at IS NOT NULL;
+
+-- Notifications held for the user's next digest; digest_id is set while a
+-- digest is being sent
+CREATE TABLE IF NOT EXISTS notification_digest_items (
+    notification_id UUID PRIMARY KEY REFERENCES notifications(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    digest_id UUID,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_notification_digest_items_pending ON notification_digest_items(user_id) WHERE digest_id IS NULL;
+CREATE INDEX IF NOT EXISTS idx_notification_digest_items_digest ON notification_digest_items(digest_id) WHERE digest_id IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS notification_digests (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    channel TEXT NOT NULL CHECK (channel IN ('email', 'sms', 'push')),
+    status TEXT NOT NULL CHECK (status IN ('sent', 'failed', 'skipped')),
+    item_count INT NOT NULL,
+    error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_notification_digests_user ON notification_digests(user_id, created_at DESC);
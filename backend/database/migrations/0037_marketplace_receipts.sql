@@ -0,0 +1,13 @@
+-- Migration: Marketplace delivery receipts
+-- Created: 2026-10-18
+-- Description: Tracks how far each thread participant's messages have been delivered, alongside last_read_at
+
+-- Messages created up to last_delivered_at have reached one of the participant's devices
+ALTER TABLE marketplace_thread_participants ADD COLUMN IF NOT EXISTS last_delivered_at TIMESTAMP;
+
+-- Anything already read was delivered
+UPDATE marketplace_thread_participants
+SET last_delivered_at = COALESCE(last_read_at, joined_at)
+WHERE last_delivered_at IS NULL;
+
+ALTER TABLE marketplace_thread_participants ALTER COLUMN last_delivered_at SET DEFAULT now();
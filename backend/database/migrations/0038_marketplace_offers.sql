@@ -0,0 +1,39 @@
+-- Migration: Marketplace offers
+-- Created: 2026-10-18
+-- Description: Price offers and counter-offers negotiated inside marketplace threads; an accepted offer becomes an order at the agreed price
+
+CREATE TABLE IF NOT EXISTS marketplace_offers (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    thread_id INT NOT NULL REFERENCES marketplace_threads(id) ON DELETE CASCADE,
+    -- The offer this one counters
+    parent_offer_id UUID REFERENCES marketplace_offers(id) ON DELETE SET NULL,
+    proposed_by UUID NOT NULL REFERENCES users(id),
+    product_id UUID NOT NULL REFERENCES marketplace_products(id),
+    variant_id UUID REFERENCES product_variants(id),
+    quantity INT NOT NULL CHECK (quantity > 0),
+    unit_price NUMERIC(12, 2) NOT NULL CHECK (unit_price > 0),
+    currency VARCHAR(3) NOT NULL,
+    -- Where the buyer wants delivery, on offers the buyer makes
+    shipping_address JSONB,
+    expires_at TIMESTAMP NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending'
+        CHECK (status IN ('pending', 'countered', 'accepted', 'declined', 'expired')),
+    responded_by UUID REFERENCES users(id),
+    responded_at TIMESTAMP,
+    order_id UUID REFERENCES orders(id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    updated_at TIMESTAMP NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_marketplace_offers_thread ON marketplace_offers(thread_id, created_at DESC);
+
+-- A thread negotiates one offer at a time
+CREATE UNIQUE INDEX IF NOT EXISTS idx_marketplace_offers_thread_pending
+    ON marketplace_offers(thread_id) WHERE status = 'pending';
+
+-- Offer messages point at the offer they make or answer
+ALTER TABLE marketplace_messages ADD COLUMN IF NOT EXISTS offer_id UUID REFERENCES marketplace_offers(id) ON DELETE SET NULL;
+
+ALTER TABLE marketplace_messages DROP CONSTRAINT IF EXISTS marketplace_messages_message_type_check;
+ALTER TABLE marketplace_messages ADD CONSTRAINT marketplace_messages_message_type_check
+    CHECK (message_type IN ('text', 'image', 'file', 'system', 'offer', 'counter_offer', 'offer_accepted', 'offer_declined'));
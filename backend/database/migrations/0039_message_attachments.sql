@@ -0,0 +1,50 @@
+-- Migration: Message attachments
+-- Created: 2026-10-18
+-- Description: Images, PDFs and voice notes uploaded to a marketplace thread or a conversation and referenced by ID from its messages
+
+CREATE TABLE IF NOT EXISTS message_attachments (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    owner_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    -- The thread or conversation the file was uploaded to; only its members can read it
+    thread_id INT REFERENCES marketplace_threads(id) ON DELETE CASCADE,
+    conversation_id INT,
+    -- The message that references the file; unreferenced uploads are purged after a day
+    marketplace_message_id INT REFERENCES marketplace_messages(id) ON DELETE CASCADE,
+    message_id INT,
+    kind VARCHAR(20) NOT NULL CHECK (kind IN ('image', 'document', 'voice')),
+    content_type VARCHAR(100) NOT NULL,
+    file_name VARCHAR(255) NOT NULL DEFAULT '',
+    size_bytes BIGINT NOT NULL CHECK (size_bytes > 0),
+    width INTEGER NOT NULL DEFAULT 0,
+    height INTEGER NOT NULL DEFAULT 0,
+    storage_key TEXT NOT NULL,
+    thumbnail_key TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    CHECK ((thread_id IS NULL) <> (conversation_id IS NULL)),
+    CHECK (marketplace_message_id IS NULL OR thread_id IS NOT NULL),
+    CHECK (message_id IS NULL OR conversation_id IS NOT NULL)
+);
+
+-- Conversations are created by the messaging schema, which may be applied separately
+DO $$
+BEGIN
+    IF to_regclass('conversations') IS NOT NULL AND NOT EXISTS (
+        SELECT 1 FROM pg_constraint WHERE conname = 'message_attachments_conversation_id_fkey'
+    ) THEN
+        ALTER TABLE message_attachments ADD CONSTRAINT message_attachments_conversation_id_fkey
+            FOREIGN KEY (conversation_id) REFERENCES conversations(id) ON DELETE CASCADE;
+    END IF;
+    IF to_regclass('messages') IS NOT NULL AND NOT EXISTS (
+        SELECT 1 FROM pg_constraint WHERE conname = 'message_attachments_message_id_fkey'
+    ) THEN
+        ALTER TABLE message_attachments ADD CONSTRAINT message_attachments_message_id_fkey
+            FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE CASCADE;
+    END IF;
+END $$;
+
+CREATE INDEX IF NOT EXISTS idx_message_attachments_marketplace_message
+    ON message_attachments(marketplace_message_id) WHERE marketplace_message_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_message_attachments_message
+    ON message_attachments(message_id) WHERE message_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_message_attachments_unlinked
+    ON message_attachments(created_at) WHERE marketplace_message_id IS NULL AND message_id IS NULL;
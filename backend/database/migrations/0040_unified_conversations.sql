@@ -0,0 +1,263 @@
+-- Migration: Unified conversations
+-- Created: 2026-10-18
+-- Description: Direct, group, product and order conversations all live in marketplace_threads; legacy conversations, members, messages and their attachments are moved across and keep their integer IDs for the /api/messages adapter
+
+-- What a conversation is about. Product and order threads are between a buyer
+-- and a seller; direct and group conversations are just their participants.
+ALTER TABLE marketplace_threads ADD COLUMN IF NOT EXISTS kind VARCHAR(20);
+UPDATE marketplace_threads SET kind = CASE WHEN order_id IS NOT NULL THEN 'order' ELSE 'product' END
+WHERE kind IS NULL;
+ALTER TABLE marketplace_threads ALTER COLUMN kind SET NOT NULL;
+
+ALTER TABLE marketplace_threads DROP CONSTRAINT IF EXISTS marketplace_threads_kind_check;
+ALTER TABLE marketplace_threads ADD CONSTRAINT marketplace_threads_kind_check
+    CHECK (kind IN ('direct', 'group', 'product', 'order'));
+
+-- Group conversations are named by whoever starts them
+ALTER TABLE marketplace_threads ADD COLUMN IF NOT EXISTS title VARCHAR(120);
+ALTER TABLE marketplace_threads ADD COLUMN IF NOT EXISTS created_by UUID REFERENCES users(id) ON DELETE SET NULL;
+
+-- Only marketplace threads have a buyer and a seller
+ALTER TABLE marketplace_threads ALTER COLUMN buyer_id DROP NOT NULL;
+ALTER TABLE marketplace_threads ALTER COLUMN seller_id DROP NOT NULL;
+ALTER TABLE marketplace_threads DROP CONSTRAINT IF EXISTS marketplace_threads_parties_check;
+ALTER TABLE marketplace_threads ADD CONSTRAINT marketplace_threads_parties_check
+    CHECK (kind IN ('direct', 'group') OR (buyer_id IS NOT NULL AND seller_id IS NOT NULL));
+
+-- The pair of users in a direct conversation, lowest ID first, so each pair has one
+ALTER TABLE marketplace_threads ADD COLUMN IF NOT EXISTS direct_key TEXT UNIQUE;
+
+-- Every conversation has the integer ID the /api/messages adapter addresses it by.
+-- Moved conversations keep theirs; new ones are numbered after the last of them.
+CREATE SEQUENCE IF NOT EXISTS marketplace_threads_legacy_conversation_id_seq;
+ALTER TABLE marketplace_threads ADD COLUMN IF NOT EXISTS legacy_conversation_id INT UNIQUE;
+ALTER TABLE marketplace_threads ALTER COLUMN legacy_conversation_id
+    SET DEFAULT nextval('marketplace_threads_legacy_conversation_id_seq');
+ALTER SEQUENCE marketplace_threads_legacy_conversation_id_seq OWNED BY marketplace_threads.legacy_conversation_id;
+
+-- Direct and group participants who are neither NGO nor admin are members
+ALTER TABLE marketplace_thread_participants DROP CONSTRAINT IF EXISTS marketplace_thread_participants_role_check;
+ALTER TABLE marketplace_thread_participants ADD CONSTRAINT marketplace_thread_participants_role_check
+    CHECK (role IN ('buyer', 'seller', 'ngo', 'admin', 'member'));
+
+-- The legacy message a moved message was copied from
+ALTER TABLE marketplace_messages ADD COLUMN IF NOT EXISTS legacy_message_id INT UNIQUE;
+
+-- Move the legacy conversations, which the messaging schema may not have created
+DO $$
+BEGIN
+    IF to_regclass('conversations') IS NOT NULL THEN
+        -- Numbers already handed out must not be reused
+        PERFORM setval('marketplace_threads_legacy_conversation_id_seq', GREATEST(
+            (SELECT COALESCE(MAX(id), 0) FROM conversations),
+            (SELECT COALESCE(MAX(legacy_conversation_id), 0) FROM marketplace_threads),
+            1));
+
+        INSERT INTO marketplace_threads (thread_ref, kind, status, legacy_conversation_id, created_at, updated_at)
+        SELECT generate_thread_ref(), c.type, 'open', c.id, c.created_at,
+            COALESCE((SELECT MAX(m.created_at) FROM messages m WHERE m.conversation_id = c.id), c.created_at)
+        FROM conversations c
+        WHERE NOT EXISTS (SELECT 1 FROM marketplace_threads mt WHERE mt.legacy_conversation_id = c.id);
+
+        -- Legacy messages were marked read for everyone at once, so a member has
+        -- read up to the last message they sent or saw marked read
+        INSERT INTO marketplace_thread_participants (thread_id, user_id, role, joined_at, last_read_at, last_delivered_at)
+        SELECT mt.id, cm.user_id,
+            CASE WHEN cm.role IN ('ngo', 'admin') THEN cm.role ELSE 'member' END,
+            cm.joined_at,
+            GREATEST(cm.joined_at, (
+                SELECT MAX(m.created_at) FROM messages m
+                WHERE m.conversation_id = cm.conversation_id
+                    AND (m.sender_id = cm.user_id OR m.status = 'read')
+            )),
+            GREATEST(cm.joined_at, (
+                SELECT MAX(m.created_at) FROM messages m WHERE m.conversation_id = cm.conversation_id
+            ))
+        FROM conversation_members cm
+        JOIN marketplace_threads mt ON mt.legacy_conversation_id = cm.conversation_id
+        ON CONFLICT (thread_id, user_id) DO NOTHING;
+
+        UPDATE marketplace_threads mt
+        SET created_by = (
+            SELECT cm.user_id FROM conversation_members cm
+            WHERE cm.conversation_id = mt.legacy_conversation_id
+            ORDER BY cm.joined_at, cm.id
+            LIMIT 1)
+        WHERE mt.created_by IS NULL AND mt.kind IN ('direct', 'group')
+            AND mt.legacy_conversation_id IN (SELECT id FROM conversations);
+
+        INSERT INTO marketplace_messages (thread_id, sender_id, body, message_type, legacy_message_id, created_at, updated_at)
+        SELECT mt.id, m.sender_id, m.body, 'text', m.id, m.created_at, m.created_at
+        FROM messages m
+        JOIN marketplace_threads mt ON mt.legacy_conversation_id = m.conversation_id
+        WHERE NOT EXISTS (SELECT 1 FROM marketplace_messages mm WHERE mm.legacy_message_id = m.id);
+
+        -- The oldest direct conversation between a pair becomes theirs; any
+        -- duplicates stay readable but are no longer found for the pair
+        UPDATE marketplace_threads mt
+        SET direct_key = pairs.direct_key
+        FROM (
+            SELECT DISTINCT ON (p.direct_key) p.thread_id, p.direct_key
+            FROM (
+                SELECT mtp.thread_id,
+                    MIN(mtp.user_id::text) || ':' || MAX(mtp.user_id::text) AS direct_key
+                FROM marketplace_thread_participants mtp
+                JOIN marketplace_threads t ON t.id = mtp.thread_id
+                WHERE t.kind = 'direct'
+                GROUP BY mtp.thread_id
+                HAVING COUNT(*) = 2
+            ) p
+            JOIN marketplace_threads t ON t.id = p.thread_id
+            ORDER BY p.direct_key, t.created_at, t.id
+        ) pairs
+        WHERE mt.id = pairs.thread_id AND mt.direct_key IS NULL
+            AND NOT EXISTS (SELECT 1 FROM marketplace_threads d WHERE d.direct_key = pairs.direct_key);
+    END IF;
+
+    -- Files uploaded to conversations follow them to their threads
+    IF EXISTS (
+        SELECT 1 FROM information_schema.columns
+        WHERE table_name = 'message_attachments' AND column_name = 'conversation_id'
+    ) THEN
+        UPDATE message_attachments a
+        SET thread_id = mt.id,
+            conversation_id = NULL,
+            marketplace_message_id = (
+                SELECT mm.id FROM marketplace_messages mm WHERE mm.legacy_message_id = a.message_id),
+            message_id = NULL
+        FROM marketplace_threads mt
+        WHERE a.conversation_id IS NOT NULL AND mt.legacy_conversation_id = a.conversation_id;
+
+        -- Unsent uploads to a conversation that no longer exists go with it
+        DELETE FROM message_attachments WHERE conversation_id IS NOT NULL;
+
+        ALTER TABLE message_attachments DROP COLUMN conversation_id;
+        ALTER TABLE message_attachments DROP COLUMN message_id;
+    END IF;
+END $$;
+
+-- Threads that were never legacy conversations are numbered after them
+UPDATE marketplace_threads
+SET legacy_conversation_id = nextval('marketplace_threads_legacy_conversation_id_seq')
+WHERE legacy_conversation_id IS NULL;
+ALTER TABLE marketplace_threads ALTER COLUMN legacy_conversation_id SET NOT NULL;
+
+-- Legacy conversations, conversation_members and messages are left in place,
+-- unused, so the move can be checked against them before they are dropped
+
+ALTER TABLE message_attachments ALTER COLUMN thread_id SET NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_message_attachments_unlinked
+    ON message_attachments(created_at) WHERE marketplace_message_id IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_marketplace_threads_kind ON marketplace_threads(kind);
+
+-- Product and order threads are created with their kind. The buyer and
+-- seller come first, as parameters with defaults must follow those without.
+DROP FUNCTION IF EXISTS create_or_get_marketplace_thread(UUID, UUID, UUID, UUID);
+CREATE OR REPLACE FUNCTION create_or_get_marketplace_thread(
+    p_buyer_id UUID,
+    p_seller_id UUID,
+    p_product_id UUID DEFAULT NULL,
+    p_order_id UUID DEFAULT NULL
+)
+RETURNS TEXT AS $$
+DECLARE
+    thread_ref TEXT;
+    thread_id INT;
+BEGIN
+    -- Check if thread already exists
+    IF p_product_id IS NOT NULL THEN
+        SELECT mt.thread_ref INTO thread_ref
+        FROM marketplace_threads mt
+        WHERE mt.product_id = p_product_id
+        AND mt.buyer_id = p_buyer_id
+        AND mt.seller_id = p_seller_id;
+    ELSIF p_order_id IS NOT NULL THEN
+        SELECT mt.thread_ref INTO thread_ref
+        FROM marketplace_threads mt
+        WHERE mt.order_id = p_order_id
+        AND mt.buyer_id = p_buyer_id
+        AND mt.seller_id = p_seller_id;
+    END IF;
+
+    -- If thread exists, return it
+    IF thread_ref IS NOT NULL THEN
+        RETURN thread_ref;
+    END IF;
+
+    -- Create new thread
+    thread_ref := generate_thread_ref();
+
+    INSERT INTO marketplace_threads (thread_ref, kind, product_id, order_id, buyer_id, seller_id, created_by)
+    VALUES (thread_ref, CASE WHEN p_order_id IS NOT NULL THEN 'order' ELSE 'product' END,
+        p_product_id, p_order_id, p_buyer_id, p_seller_id, p_buyer_id)
+    RETURNING id INTO thread_id;
+
+    -- Add buyer and seller as participants
+    INSERT INTO marketplace_thread_participants (thread_id, user_id, role)
+    VALUES
+        (thread_id, p_buyer_id, 'buyer'),
+        (thread_id, p_seller_id, 'seller');
+
+    RETURN thread_ref;
+END;
+$$ LANGUAGE plpgsql;
+
+-- The summary has a row per participant, with that participant's unread count
+DROP VIEW IF EXISTS marketplace_thread_summary;
+CREATE VIEW marketplace_thread_summary AS
+SELECT
+    mt.id,
+    mt.thread_ref,
+    mt.kind,
+    mt.title,
+    mt.product_id,
+    mt.order_id,
+    mt.buyer_id,
+    mt.seller_id,
+    mt.status,
+    mt.created_at,
+    mt.updated_at,
+    mtp.user_id as participant_id,
+
+    -- Product info
+    mp.title as product_name,
+    (mp.price_cents / 100.0)::numeric(12,2) as product_price,
+
+    -- Order info
+    o.quantity as order_quantity,
+    o.total_price as order_total,
+    o.status as order_status,
+
+    -- User info
+    buyer.name as buyer_name,
+    seller.name as seller_name,
+
+    -- Latest message
+    latest_msg.body as latest_message_body,
+    latest_msg.created_at as latest_message_at,
+    latest_msg.sender_id as latest_message_sender,
+    sender.name as latest_message_sender_name,
+
+    -- Participant counts
+    (SELECT COUNT(*) FROM marketplace_thread_participants p WHERE p.thread_id = mt.id) as participant_count,
+
+    -- Unread count per participant
+    (SELECT COUNT(*) FROM marketplace_messages mm
+     WHERE mm.thread_id = mt.id
+     AND mm.created_at > COALESCE(mtp.last_read_at, mt.created_at)) as unread_count
+
+FROM marketplace_threads mt
+LEFT JOIN marketplace_products mp ON mt.product_id = mp.id
+LEFT JOIN orders o ON mt.order_id = o.id
+LEFT JOIN users buyer ON mt.buyer_id = buyer.id
+LEFT JOIN users seller ON mt.seller_id = seller.id
+LEFT JOIN LATERAL (
+    SELECT mm.body, mm.created_at, mm.sender_id
+    FROM marketplace_messages mm
+    WHERE mm.thread_id = mt.id
+    ORDER BY mm.created_at DESC
+    LIMIT 1
+) latest_msg ON true
+LEFT JOIN users sender ON latest_msg.sender_id = sender.id
+LEFT JOIN marketplace_thread_participants mtp ON mtp.thread_id = mt.id;
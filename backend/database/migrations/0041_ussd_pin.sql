@@ -0,0 +1,7 @@
+-- Migration: USSD PIN
+-- Created: 2026-10-18
+-- Description: Adds a PIN that USSD callers enter before confirming a delivery, which releases escrow to the seller. A phone number alone does not prove who is dialling.
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS ussd_pin_hash TEXT;
+-- Wrong PINs in a row; the PIN locks at 5 until it is set again
+ALTER TABLE users ADD COLUMN IF NOT EXISTS ussd_pin_attempts INT NOT NULL DEFAULT 0;
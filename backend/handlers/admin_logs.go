@@ -2,11 +2,13 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 	"time"
 
 	"github.com/Andrew-mugwe/agroai/models"
+	"github.com/Andrew-mugwe/agroai/pagination"
 	"github.com/Andrew-mugwe/agroai/services/logger"
 )
 
@@ -29,16 +31,7 @@ type AdminLogsRequest struct {
 	StartDate string `json:"start_date,omitempty"`
 	EndDate   string `json:"end_date,omitempty"`
 	Limit     int    `json:"limit,omitempty"`
-	Offset    int    `json:"offset,omitempty"`
-}
-
-// AdminLogsResponse represents the response from admin logs endpoint
-type AdminLogsResponse struct {
-	Logs       []logger.ActivityLog `json:"logs"`
-	Total      int                  `json:"total"`
-	Page       int                  `json:"page"`
-	PageSize   int                  `json:"page_size"`
-	TotalPages int                  `json:"total_pages"`
+	Cursor    string `json:"cursor,omitempty"`
 }
 
 // GetAdminLogs retrieves activity logs for admin viewing
@@ -60,23 +53,12 @@ func (h *AdminLogsHandler) GetAdminLogs(w http.ResponseWriter, r *http.Request)
 	action := r.URL.Query().Get("action")
 	startDateStr := r.URL.Query().Get("start_date")
 	endDateStr := r.URL.Query().Get("end_date")
-	limitStr := r.URL.Query().Get("limit")
-	offsetStr := r.URL.Query().Get("offset")
 
 	// Set defaults
-	limit := 50
-	offset := 0
-
-	if limitStr != "" {
-		if parsedLimit, err := strconv.Atoi(limitStr); err == nil && parsedLimit > 0 && parsedLimit <= 1000 {
-			limit = parsedLimit
-		}
-	}
-
-	if offsetStr != "" {
-		if parsedOffset, err := strconv.Atoi(offsetStr); err == nil && parsedOffset >= 0 {
-			offset = parsedOffset
-		}
+	page, err := pagination.Parse(r.URL.Query(), 50)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
 	// Parse dates
@@ -100,42 +82,21 @@ func (h *AdminLogsHandler) GetAdminLogs(w http.ResponseWriter, r *http.Request)
 		Action:    action,
 		StartDate: startDate,
 		EndDate:   endDate,
-		Limit:     limit,
-		Offset:    offset,
 	}
 
 	// Get logs
-	logs, err := h.activityLogger.GetLogs(query)
-	if err != nil {
-		http.Error(w, "Failed to retrieve logs", http.StatusInternalServerError)
+	logs, err := h.activityLogger.ListLogs(query, page)
+	if errors.Is(err, pagination.ErrInvalidCursor) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-
-	// Get total count for pagination
-	totalQuery := query
-	totalQuery.Limit = 0
-	totalQuery.Offset = 0
-	totalLogs, err := h.activityLogger.GetLogs(totalQuery)
 	if err != nil {
-		http.Error(w, "Failed to get total count", http.StatusInternalServerError)
+		http.Error(w, "Failed to retrieve logs", http.StatusInternalServerError)
 		return
 	}
 
-	total := len(totalLogs)
-	totalPages := (total + limit - 1) / limit
-	page := (offset / limit) + 1
-
 	// Return response
-	response := AdminLogsResponse{
-		Logs:       logs,
-		Total:      total,
-		Page:       page,
-		PageSize:   limit,
-		TotalPages: totalPages,
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	pagination.Respond(w, logs)
 }
 
 // GetAdminLogStats retrieves log statistics for admin dashboard
@@ -9,6 +9,7 @@ import (
 
 	"github.com/Andrew-mugwe/agroai/services/alerts"
 	"github.com/Andrew-mugwe/agroai/services/analytics"
+	"github.com/Andrew-mugwe/agroai/services/reputation"
 	"github.com/Andrew-mugwe/agroai/utils"
 	"github.com/google/uuid"
 )
@@ -18,6 +19,7 @@ type AdminMonitoringHandler struct {
 	db           *sql.DB
 	analytics    *analytics.MarketplaceAnalytics
 	alertService *alerts.AlertService
+	reputation   *reputation.Engine
 }
 
 // NewAdminMonitoringHandler creates a new admin monitoring handler
@@ -26,6 +28,7 @@ func NewAdminMonitoringHandler(db *sql.DB) *AdminMonitoringHandler {
 		db:           db,
 		analytics:    analytics.NewMarketplaceAnalytics(),
 		alertService: alerts.NewAlertService(db),
+		reputation:   reputation.NewEngine(db),
 	}
 }
 
@@ -44,16 +47,17 @@ type MonitoringOverview struct {
 
 // SellerListItem represents a seller in the admin list
 type SellerListItem struct {
-	ID           string    `json:"id"`
-	UserID       string    `json:"user_id"`
-	Name         string    `json:"name"`
-	Verified     bool      `json:"verified"`
-	AvgRating    float64   `json:"avg_rating"`
-	TotalReviews int       `json:"total_reviews"`
-	TotalOrders  int       `json:"total_orders"`
-	Reputation   float64   `json:"reputation"`
-	Country      string    `json:"country"`
-	CreatedAt    time.Time `json:"created_at"`
+	ID             string    `json:"id"`
+	UserID         string    `json:"user_id"`
+	Name           string    `json:"name"`
+	Verified       bool      `json:"verified"`
+	AvgRating      float64   `json:"avg_rating"`
+	BayesianRating float64   `json:"bayesian_rating"`
+	TotalReviews   int       `json:"total_reviews"`
+	TotalOrders    int       `json:"total_orders"`
+	Reputation     float64   `json:"reputation"`
+	Country        string    `json:"country"`
+	CreatedAt      time.Time `json:"created_at"`
 }
 
 // GetMonitoringOverview handles GET /api/admin/monitoring/overview
@@ -186,27 +190,38 @@ func (h *AdminMonitoringHandler) GetSellers(w http.ResponseWriter, r *http.Reque
 		}
 	}
 
+	// Rankings use the Bayesian-smoothed rating with the active model's prior
+	model, err := h.reputation.ActiveModel(ctx)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to load reputation model")
+		return
+	}
+	prior := model.Weights.Prior()
+
 	// Build query based on filter
 	baseQuery := `
-		SELECT s.id, s.user_id, s.name, s.verified, s.created_at,
+		SELECT s.id, s.user_id, s.name, s.verified,
 		       COALESCE(ss.avg_rating, 0) as avg_rating,
+		       COALESCE(($1 * $2 + COALESCE(ss.avg_rating, 0) * COALESCE(ss.total_reviews, 0))
+		           / NULLIF($2 + COALESCE(ss.total_reviews, 0), 0), 0) as bayesian_rating,
 		       COALESCE(ss.total_reviews, 0) as total_reviews,
 		       COALESCE(ss.total_orders, 0) as total_orders,
 		       COALESCE(rh.score, 50) as reputation,
-		       COALESCE(s.location->>'country', '') as country
+		       COALESCE(s.location->>'country', '') as country,
+		       s.created_at
 		FROM sellers s
 		LEFT JOIN seller_stats ss ON s.id = ss.seller_id
 		LEFT JOIN LATERAL (
 			SELECT score FROM reputation_history 
-			WHERE seller_id = s.user_id 
+			WHERE user_id = s.user_id 
 			ORDER BY created_at DESC 
 			LIMIT 1
 		) rh ON true
 	`
 
 	var whereClause string
-	var args []interface{}
-	argIndex := 1
+	args := []interface{}{prior.Mean, prior.Weight}
+	argIndex := 3
 
 	switch filter {
 	case "low_reputation":
@@ -220,6 +235,12 @@ func (h *AdminMonitoringHandler) GetSellers(w http.ResponseWriter, r *http.Reque
 	}
 
 	orderClause := "ORDER BY s.created_at DESC"
+	switch r.URL.Query().Get("sort") {
+	case "rating":
+		orderClause = "ORDER BY bayesian_rating DESC, total_reviews DESC"
+	case "reputation":
+		orderClause = "ORDER BY reputation DESC"
+	}
 	limitClause := "LIMIT $" + strconv.Itoa(argIndex) + " OFFSET $" + strconv.Itoa(argIndex+1)
 	args = append(args, limit, offset)
 
@@ -237,7 +258,7 @@ func (h *AdminMonitoringHandler) GetSellers(w http.ResponseWriter, r *http.Reque
 		var seller SellerListItem
 		err := rows.Scan(
 			&seller.ID, &seller.UserID, &seller.Name, &seller.Verified,
-			&seller.AvgRating, &seller.TotalReviews, &seller.TotalOrders,
+			&seller.AvgRating, &seller.BayesianRating, &seller.TotalReviews, &seller.TotalOrders,
 			&seller.Reputation, &seller.Country, &seller.CreatedAt,
 		)
 		if err != nil {
@@ -248,7 +269,7 @@ func (h *AdminMonitoringHandler) GetSellers(w http.ResponseWriter, r *http.Reque
 	}
 
 	// Get total count for pagination
-	countQuery := "SELECT COUNT(*) FROM sellers s" + whereClause
+	countQuery := "SELECT COUNT(*) FROM (" + baseQuery + whereClause + ") filtered"
 	var totalCount int
 	err = h.db.QueryRowContext(ctx, countQuery, args[:len(args)-2]...).Scan(&totalCount)
 	if err != nil {
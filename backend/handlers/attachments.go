@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"github.com/Andrew-mugwe/agroai/middleware"
+	"github.com/Andrew-mugwe/agroai/services/media"
+	"github.com/Andrew-mugwe/agroai/utils"
+)
+
+// AttachmentHandler handles message attachment uploads and downloads
+type AttachmentHandler struct {
+	attachments *media.AttachmentService
+}
+
+// NewAttachmentHandler creates a new attachment handler
+func NewAttachmentHandler(attachments *media.AttachmentService) *AttachmentHandler {
+	return &AttachmentHandler{attachments: attachments}
+}
+
+// UploadThreadAttachment handles POST /api/marketplace/thread/{threadRef}/attachments
+//
+// The multipart "file" is an image, PDF or voice note, validated by its
+// content. Send the returned id in a message's attachment_ids.
+func (h *AttachmentHandler) UploadThreadAttachment(w http.ResponseWriter, r *http.Request) {
+	h.upload(w, r, media.AttachmentScope{ThreadRef: mux.Vars(r)["threadRef"]})
+}
+
+// UploadConversationAttachment handles POST /api/messages/{conversationId}/attachments,
+// uploading to the thread the legacy conversation ID addresses
+func (h *AttachmentHandler) UploadConversationAttachment(w http.ResponseWriter, r *http.Request) {
+	conversationID, err := strconv.Atoi(mux.Vars(r)["conversationId"])
+	if err != nil || conversationID <= 0 {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid conversation ID")
+		return
+	}
+	h.upload(w, r, media.AttachmentScope{ConversationID: conversationID})
+}
+
+func (h *AttachmentHandler) upload(w http.ResponseWriter, r *http.Request, scope media.AttachmentScope) {
+	userID, ok := attachmentUser(w, r)
+	if !ok {
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, media.MaxAttachmentSize+1<<20)
+	if err := r.ParseMultipartForm(media.MaxAttachmentSize); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Upload a file of at most 20 MB")
+		return
+	}
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "No file provided")
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Failed to read file")
+		return
+	}
+
+	attachment, err := h.attachments.Upload(r.Context(), userID, scope, header.Filename, data)
+	if err != nil {
+		respondWithAttachmentError(w, err, "Failed to upload attachment")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusCreated, attachment)
+}
+
+// GetAttachment handles GET /api/attachments/{id}, returning freshly
+// signed URLs to participants of the attachment's thread
+func (h *AttachmentHandler) GetAttachment(w http.ResponseWriter, r *http.Request) {
+	userID, ok := attachmentUser(w, r)
+	if !ok {
+		return
+	}
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid attachment ID")
+		return
+	}
+
+	attachment, err := h.attachments.Get(r.Context(), userID, id)
+	if err != nil {
+		respondWithAttachmentError(w, err, "Failed to get attachment")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, attachment)
+}
+
+// attachmentUser reads the authenticated user, responding on failure
+func attachmentUser(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	claims, ok := r.Context().Value("user").(*middleware.Claims)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return uuid.Nil, false
+	}
+	userID, err := uuid.Parse(claims.UserID)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return uuid.Nil, false
+	}
+	return userID, true
+}
+
+// respondWithAttachmentError maps attachment errors to HTTP status codes
+func respondWithAttachmentError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, media.ErrAttachmentNotFound):
+		utils.RespondWithError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, media.ErrNotMember):
+		utils.RespondWithError(w, http.StatusForbidden, err.Error())
+	case errors.Is(err, media.ErrAttachmentTooLarge):
+		utils.RespondWithError(w, http.StatusRequestEntityTooLarge, err.Error())
+	case errors.Is(err, media.ErrUnsupportedAttachment), errors.Is(err, media.ErrAttachmentRejected):
+		utils.RespondWithValidationError(w, err.Error())
+	default:
+		utils.RespondWithError(w, http.StatusInternalServerError, fallback)
+	}
+}
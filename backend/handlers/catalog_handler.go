@@ -0,0 +1,224 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Andrew-mugwe/agroai/services"
+	"github.com/Andrew-mugwe/agroai/services/catalog"
+	"github.com/Andrew-mugwe/agroai/utils"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// maxImportSize bounds catalogue uploads
+const maxImportSize = 20 << 20 // 20 MB
+
+// CatalogHandler handles bulk product import and export for traders
+type CatalogHandler struct {
+	catalogService *catalog.Service
+	cacheService   *services.CacheService
+}
+
+// NewCatalogHandler creates a new catalogue handler. Imports drop the
+// trader's cached product listings when they finish.
+func NewCatalogHandler(catalogService *catalog.Service, cacheService *services.CacheService) *CatalogHandler {
+	h := &CatalogHandler{
+		catalogService: catalogService,
+		cacheService:   cacheService,
+	}
+	catalogService.OnImported(h.invalidateTraderProducts)
+	return h
+}
+
+// ImportProducts handles POST /api/trader/products/import
+//
+// The multipart form carries the CSV or XLSX "file", an optional JSON
+// "mapping" from catalogue fields to column headers, and "dry_run" to
+// preview without saving. Files of up to catalog.SyncRowLimit rows are
+// imported before responding; larger ones return 202 with a job to poll.
+func (h *CatalogHandler) ImportProducts(w http.ResponseWriter, r *http.Request) {
+	traderID, err := utils.GetUserIDFromContext(r)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+	if err := r.ParseMultipartForm(maxImportSize); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Upload a CSV or XLSX file of at most 20 MB")
+		return
+	}
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "No file provided")
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Failed to read file")
+		return
+	}
+
+	rows, format, err := catalog.ReadSheet(data)
+	if err != nil {
+		utils.RespondWithValidationError(w, err.Error())
+		return
+	}
+
+	upload := catalog.Upload{Filename: header.Filename, Format: format, Rows: rows}
+	if mapping := r.FormValue("mapping"); mapping != "" {
+		if err := json.Unmarshal([]byte(mapping), &upload.Mapping); err != nil {
+			utils.RespondWithValidationError(w, "mapping must be a JSON object of field to column header")
+			return
+		}
+	}
+
+	if dryRun, _ := strconv.ParseBool(r.FormValue("dry_run")); dryRun {
+		report, err := h.catalogService.Preview(r.Context(), traderID, upload)
+		if err != nil {
+			respondWithCatalogError(w, err, "Failed to preview import")
+			return
+		}
+		utils.RespondWithJSON(w, http.StatusOK, report)
+		return
+	}
+
+	job, err := h.catalogService.Import(r.Context(), traderID, upload)
+	if err != nil {
+		respondWithCatalogError(w, err, "Failed to import products")
+		return
+	}
+
+	if job.Status == catalog.JobQueued {
+		w.Header().Set("Location", "/api/trader/products/import/"+job.ID.String())
+		utils.RespondWithJSON(w, http.StatusAccepted, job)
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, job)
+}
+
+// GetImportJob handles GET /api/trader/products/import/{jobId}
+func (h *CatalogHandler) GetImportJob(w http.ResponseWriter, r *http.Request) {
+	traderID, jobID, ok := importJobParams(w, r)
+	if !ok {
+		return
+	}
+
+	job, err := h.catalogService.GetJob(r.Context(), traderID, jobID)
+	if err != nil {
+		respondWithCatalogError(w, err, "Failed to get import job")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, job)
+}
+
+// GetImportErrors handles GET /api/trader/products/import/{jobId}/errors,
+// downloading the job's row errors as CSV or, with ?format=xlsx, XLSX
+func (h *CatalogHandler) GetImportErrors(w http.ResponseWriter, r *http.Request) {
+	traderID, jobID, ok := importJobParams(w, r)
+	if !ok {
+		return
+	}
+	format, ok := sheetFormat(w, r)
+	if !ok {
+		return
+	}
+
+	errs, err := h.catalogService.JobErrors(r.Context(), traderID, jobID)
+	if err != nil {
+		respondWithCatalogError(w, err, "Failed to get import errors")
+		return
+	}
+
+	writeSheet(w, format, "import-errors-"+jobID.String()[:8], catalog.ErrorReport(errs))
+}
+
+// ExportProducts handles GET /api/trader/products/export, downloading the
+// trader's catalogue as CSV or, with ?format=xlsx, XLSX
+func (h *CatalogHandler) ExportProducts(w http.ResponseWriter, r *http.Request) {
+	traderID, err := utils.GetUserIDFromContext(r)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	format, ok := sheetFormat(w, r)
+	if !ok {
+		return
+	}
+
+	rows, err := h.catalogService.Export(r.Context(), traderID)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to export products")
+		return
+	}
+
+	writeSheet(w, format, "products-"+time.Now().Format("2006-01-02"), rows)
+}
+
+// importJobParams reads the trader and job ID, responding on failure
+func importJobParams(w http.ResponseWriter, r *http.Request) (uuid.UUID, uuid.UUID, bool) {
+	traderID, err := utils.GetUserIDFromContext(r)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return uuid.Nil, uuid.Nil, false
+	}
+	jobID, err := uuid.Parse(mux.Vars(r)["jobId"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid job ID")
+		return uuid.Nil, uuid.Nil, false
+	}
+	return traderID, jobID, true
+}
+
+// sheetFormat reads ?format, defaulting to CSV
+func sheetFormat(w http.ResponseWriter, r *http.Request) (string, bool) {
+	switch format := r.URL.Query().Get("format"); format {
+	case "", catalog.FormatCSV:
+		return catalog.FormatCSV, true
+	case catalog.FormatXLSX:
+		return format, true
+	}
+	utils.RespondWithValidationError(w, "format must be csv or xlsx")
+	return "", false
+}
+
+// writeSheet sends rows as a spreadsheet download
+func writeSheet(w http.ResponseWriter, format, name string, rows [][]string) {
+	w.Header().Set("Content-Type", catalog.ContentType(format))
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, name, format))
+	if err := catalog.WriteSheet(w, format, rows); err != nil {
+		// Headers are already sent, so the download is cut short
+		log.Printf("Warning: failed to write %s download: %v", format, err)
+	}
+}
+
+// invalidateTraderProducts drops the cached listings served by TraderHandler.GetProducts
+func (h *CatalogHandler) invalidateTraderProducts(traderID uuid.UUID) {
+	if h.cacheService == nil {
+		return
+	}
+	h.cacheService.DeletePattern(h.cacheService.GetProductsKey(traderID.String()) + "*")
+}
+
+// respondWithCatalogError maps import errors to HTTP status codes
+func respondWithCatalogError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, catalog.ErrJobNotFound):
+		utils.RespondWithError(w, http.StatusNotFound, err.Error())
+	case catalog.IsInputError(err):
+		utils.RespondWithValidationError(w, err.Error())
+	default:
+		utils.RespondWithError(w, http.StatusInternalServerError, fallback)
+	}
+}
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/Andrew-mugwe/agroai/services/messaging"
+)
+
+// CreateConversation handles POST /api/conversations, starting a direct
+// or group conversation. Its messages, attachments and receipts then go
+// through the /api/marketplace/thread/:threadRef endpoints like any thread.
+func (mmh *MarketplaceMessageHandler) CreateConversation(w http.ResponseWriter, r *http.Request) {
+	userID, ok := marketplaceUser(r)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var req messaging.CreateConversationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	threadRef, err := mmh.marketplaceService.CreateConversation(r.Context(), &req, userID)
+	if errors.Is(err, messaging.ErrInvalidConversation) || errors.Is(err, messaging.ErrUnknownMember) {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to create conversation: "+err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, CreateThreadResponse{
+		Success:   true,
+		Message:   "Conversation created or retrieved successfully",
+		ThreadRef: threadRef,
+	})
+}
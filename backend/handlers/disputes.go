@@ -2,10 +2,12 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"time"
 
 	"github.com/Andrew-mugwe/agroai/models"
+	"github.com/Andrew-mugwe/agroai/pagination"
 	"github.com/Andrew-mugwe/agroai/services/disputes"
 	"github.com/google/uuid"
 )
@@ -220,14 +222,23 @@ func (h *DisputeHandler) GetDisputesByUser(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	disputes, err := h.disputeService.GetDisputesByUser(userID, userType)
+	page, err := pagination.FromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	disputes, err := h.disputeService.GetDisputesByUser(userID, userType, page)
+	if errors.Is(err, pagination.ErrInvalidCursor) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(disputes)
+	pagination.Respond(w, disputes)
 }
 
 // GetDisputeSummary retrieves dispute statistics
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"time"
 
@@ -194,7 +195,8 @@ func (h *EscrowHandler) GetPayoutCapabilities(w http.ResponseWriter, r *http.Req
 	json.NewEncoder(w).Encode(capabilities)
 }
 
-// ProcessPayout processes a payout request
+// ProcessPayout handles POST /api/payouts/process, an admin paying a seller
+// outside an escrow. The seller's payout limits and verified account apply.
 func (h *EscrowHandler) ProcessPayout(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -207,7 +209,11 @@ func (h *EscrowHandler) ProcessPayout(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	resp, err := h.payoutService.ProcessPayout(&req)
+	resp, err := h.escrowService.ProcessPayout(r.Context(), &req)
+	if errors.Is(err, escrow.ErrPayoutNotAuthorized) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Andrew-mugwe/agroai/models"
+	"github.com/Andrew-mugwe/agroai/pagination"
+	"github.com/Andrew-mugwe/agroai/repository"
+	"github.com/Andrew-mugwe/agroai/services"
+	"github.com/Andrew-mugwe/agroai/services/inventory"
+	"github.com/Andrew-mugwe/agroai/utils"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// InventoryHandler serves a trader's inventory ledger, manual stock
+// movements, reorder thresholds and the stock valuation report
+type InventoryHandler struct {
+	inventoryService *inventory.Service
+	cacheService     *services.CacheService
+}
+
+// NewInventoryHandler creates a new inventory handler
+func NewInventoryHandler(inventoryService *inventory.Service, cacheService *services.CacheService) *InventoryHandler {
+	return &InventoryHandler{
+		inventoryService: inventoryService,
+		cacheService:     cacheService,
+	}
+}
+
+// ListMovements handles GET /api/trader/inventory/movements
+//
+// Query: product_id, variant_id, order_id, reason, since (RFC 3339), limit, cursor
+func (h *InventoryHandler) ListMovements(w http.ResponseWriter, r *http.Request) {
+	traderID, err := utils.GetUserIDFromContext(r)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	page, err := pagination.FromRequest(r)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	q := r.URL.Query()
+	filter := repository.MovementFilter{SellerID: traderID, Reason: models.StockReason(q.Get("reason"))}
+	if filter.Reason != "" && !filter.Reason.IsValid() {
+		utils.RespondWithValidationError(w, "Invalid reason")
+		return
+	}
+	for param, dst := range map[string]**uuid.UUID{
+		"product_id": &filter.ProductID,
+		"variant_id": &filter.VariantID,
+		"order_id":   &filter.OrderID,
+	} {
+		raw := q.Get(param)
+		if raw == "" {
+			continue
+		}
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid "+param)
+			return
+		}
+		*dst = &id
+	}
+	if raw := q.Get("since"); raw != "" {
+		since, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "since must be an RFC 3339 time")
+			return
+		}
+		filter.Since = &since
+	}
+
+	movements, err := h.inventoryService.Movements(r.Context(), filter, page)
+	if errors.Is(err, pagination.ErrInvalidCursor) {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to get stock movements")
+		return
+	}
+
+	pagination.Respond(w, movements)
+}
+
+// AdjustStock handles POST /api/trader/products/{id}/variants/{variantId}/stock
+//
+// Records a restock, correction or return against the ledger
+func (h *InventoryHandler) AdjustStock(w http.ResponseWriter, r *http.Request) {
+	traderID, err := utils.GetUserIDFromContext(r)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	vars := mux.Vars(r)
+	productID, err := uuid.Parse(vars["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid product ID")
+		return
+	}
+	variantID, err := uuid.Parse(vars["variantId"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid variant ID")
+		return
+	}
+
+	var req models.StockAdjustmentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	movement, err := h.inventoryService.Adjust(r.Context(), traderID, productID, variantID, &req)
+	if err != nil {
+		respondWithInventoryError(w, err, "Failed to adjust stock")
+		return
+	}
+	h.invalidateTraderProducts(traderID)
+
+	utils.RespondWithJSON(w, http.StatusCreated, movement)
+}
+
+// SetReorderThreshold handles PUT /api/trader/products/{id}/reorder-threshold
+//
+// A null threshold turns low-stock alerts off for the product
+func (h *InventoryHandler) SetReorderThreshold(w http.ResponseWriter, r *http.Request) {
+	traderID, err := utils.GetUserIDFromContext(r)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	productID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid product ID")
+		return
+	}
+
+	var req models.ReorderThresholdRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	product, err := h.inventoryService.SetReorderThreshold(r.Context(), traderID, productID, req.Threshold)
+	if err != nil {
+		respondWithInventoryError(w, err, "Failed to set reorder threshold")
+		return
+	}
+	h.invalidateTraderProducts(traderID)
+
+	utils.RespondWithJSON(w, http.StatusOK, product)
+}
+
+// GetReport handles GET /api/trader/inventory/report
+//
+// Query: from and to (RFC 3339 or YYYY-MM-DD), defaulting to the last 30 days
+func (h *InventoryHandler) GetReport(w http.ResponseWriter, r *http.Request) {
+	traderID, err := utils.GetUserIDFromContext(r)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	q := r.URL.Query()
+	to := time.Now()
+	if raw := q.Get("to"); raw != "" {
+		if to, err = parseReportTime(raw); err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid to date")
+			return
+		}
+	}
+	from := to.AddDate(0, 0, -30)
+	if raw := q.Get("from"); raw != "" {
+		if from, err = parseReportTime(raw); err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid from date")
+			return
+		}
+	}
+	if !from.Before(to) {
+		utils.RespondWithValidationError(w, "from must be before to")
+		return
+	}
+
+	report, err := h.inventoryService.Report(r.Context(), traderID, from, to)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to build inventory report")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, report)
+}
+
+// parseReportTime accepts a full timestamp or a date
+func parseReportTime(raw string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", raw)
+}
+
+// invalidateTraderProducts drops the cached listings served by TraderHandler.GetProducts
+func (h *InventoryHandler) invalidateTraderProducts(traderID uuid.UUID) {
+	if h.cacheService == nil {
+		return
+	}
+	h.cacheService.DeletePattern(h.cacheService.GetProductsKey(traderID.String()) + "*")
+}
+
+// respondWithInventoryError maps stock errors to HTTP status codes and
+// falls back to the catalogue errors
+func respondWithInventoryError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, repository.ErrInsufficientStock):
+		utils.RespondWithError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, inventory.ErrInvalidMovement):
+		utils.RespondWithValidationError(w, err.Error())
+	default:
+		respondWithProductError(w, err, fallback)
+	}
+}
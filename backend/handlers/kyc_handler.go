@@ -0,0 +1,254 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/Andrew-mugwe/agroai/models"
+	"github.com/Andrew-mugwe/agroai/pagination"
+	"github.com/Andrew-mugwe/agroai/services/kyc"
+	"github.com/Andrew-mugwe/agroai/utils"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// KYCHandler handles seller verification HTTP requests
+type KYCHandler struct {
+	kycService *kyc.Service
+}
+
+// NewKYCHandler creates a new KYC handler
+func NewKYCHandler(kycService *kyc.Service) *KYCHandler {
+	return &KYCHandler{
+		kycService: kycService,
+	}
+}
+
+// SubmitVerification handles POST /api/kyc
+func (h *KYCHandler) SubmitVerification(w http.ResponseWriter, r *http.Request) {
+	userID, err := utils.GetUserIDFromContext(r)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req kyc.SubmitRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	submission, err := h.kycService.Submit(r.Context(), userID, &req)
+	if err != nil {
+		respondWithKYCError(w, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"success": true,
+		"message": "Verification submitted for review",
+		"data":    submission,
+	}
+
+	utils.RespondWithJSON(w, http.StatusCreated, response)
+}
+
+// GetVerificationStatus handles GET /api/kyc
+func (h *KYCHandler) GetVerificationStatus(w http.ResponseWriter, r *http.Request) {
+	userID, err := utils.GetUserIDFromContext(r)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	status, err := h.kycService.GetStatus(r.Context(), userID)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to get verification status")
+		return
+	}
+
+	response := map[string]interface{}{
+		"success": true,
+		"data":    status,
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, response)
+}
+
+// ListSubmissions handles GET /api/admin/kyc/submissions (Admin only)
+func (h *KYCHandler) ListSubmissions(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = kyc.StatusPending
+	}
+	page, err := pagination.FromRequest(r)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	submissions, err := h.kycService.List(r.Context(), status, page)
+	if errors.Is(err, pagination.ErrInvalidCursor) {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to get submissions")
+		return
+	}
+
+	pagination.Respond(w, submissions)
+}
+
+// GetSubmission handles GET /api/admin/kyc/submissions/:id (Admin only)
+func (h *KYCHandler) GetSubmission(w http.ResponseWriter, r *http.Request) {
+	submissionID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid submission ID")
+		return
+	}
+
+	submission, err := h.kycService.Get(r.Context(), submissionID)
+	if err != nil {
+		respondWithKYCError(w, err)
+		return
+	}
+
+	// Include the checklist for the requested level so the reviewer knows what to confirm
+	response := map[string]interface{}{
+		"success":   true,
+		"data":      submission,
+		"checklist": kyc.Checklist(submission.RequestedLevel),
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, response)
+}
+
+// ApproveSubmission handles POST /api/admin/kyc/submissions/:id/approve (Admin only)
+func (h *KYCHandler) ApproveSubmission(w http.ResponseWriter, r *http.Request) {
+	adminID, err := utils.GetUserIDFromContext(r)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	submissionID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid submission ID")
+		return
+	}
+
+	var req kyc.ApproveRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	submission, err := h.kycService.Approve(r.Context(), submissionID, adminID, &req)
+	if err != nil {
+		respondWithKYCError(w, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"success": true,
+		"message": "Seller verified successfully",
+		"data":    submission,
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, response)
+}
+
+// RejectSubmission handles POST /api/admin/kyc/submissions/:id/reject (Admin only)
+func (h *KYCHandler) RejectSubmission(w http.ResponseWriter, r *http.Request) {
+	adminID, err := utils.GetUserIDFromContext(r)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	submissionID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid submission ID")
+		return
+	}
+
+	var req kyc.RejectRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := h.kycService.Reject(r.Context(), submissionID, adminID, &req); err != nil {
+		respondWithKYCError(w, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"success": true,
+		"message": "Verification rejected",
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, response)
+}
+
+// RevokeVerification handles POST /api/admin/sellers/:id/revoke-verification (Admin only)
+func (h *KYCHandler) RevokeVerification(w http.ResponseWriter, r *http.Request) {
+	adminID, err := utils.GetUserIDFromContext(r)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	sellerID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid seller ID")
+		return
+	}
+
+	var req struct {
+		Note string `json:"note"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := h.kycService.Revoke(r.Context(), sellerID, adminID, req.Note); err != nil {
+		respondWithKYCError(w, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"success": true,
+		"message": "Seller verification revoked",
+		"level":   models.VerificationLevelNone,
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, response)
+}
+
+// respondWithKYCError maps KYC service errors to HTTP status codes
+func respondWithKYCError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, kyc.ErrSubmissionNotFound):
+		utils.RespondWithError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, kyc.ErrSubmissionPending), errors.Is(err, kyc.ErrNotPending):
+		utils.RespondWithError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, kyc.ErrInvalidLevel),
+		errors.Is(err, kyc.ErrMissingIDDocument),
+		errors.Is(err, kyc.ErrMissingBusinessDoc),
+		errors.Is(err, kyc.ErrInvalidDocument),
+		errors.Is(err, kyc.ErrMissingPayoutAccount),
+		errors.Is(err, kyc.ErrChecklistIncomplete),
+		errors.Is(err, kyc.ErrLevelAboveRequested),
+		errors.Is(err, kyc.ErrInvalidRejection),
+		errors.Is(err, kyc.ErrNoteRequired),
+		errors.Is(err, kyc.ErrNotVerified),
+		errors.Is(err, kyc.ErrNoSellerProfile):
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+	default:
+		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+	}
+}
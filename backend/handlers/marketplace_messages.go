@@ -2,21 +2,42 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
-	"strconv"
 	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 
+	"github.com/Andrew-mugwe/agroai/middleware"
+	"github.com/Andrew-mugwe/agroai/pagination"
+	"github.com/Andrew-mugwe/agroai/services/media"
 	"github.com/Andrew-mugwe/agroai/services/messaging"
 )
 
+// marketplaceUser returns the user AuthMiddleware authenticated
+func marketplaceUser(r *http.Request) (uuid.UUID, bool) {
+	claims, ok := r.Context().Value("user").(*middleware.Claims)
+	if !ok {
+		return uuid.Nil, false
+	}
+	userID, err := uuid.Parse(claims.UserID)
+	return userID, err == nil
+}
+
+// MarketplaceBroadcaster pushes thread events to websocket subscribers
+type MarketplaceBroadcaster interface {
+	BroadcastNewMessage(threadRef string, message *messaging.MarketplaceMessage)
+	BroadcastThreadUpdate(threadRef string, updateType string, data map[string]interface{})
+	BroadcastRead(threadRef string, userID uuid.UUID, readAt time.Time)
+}
+
 // MarketplaceMessageHandler handles marketplace messaging HTTP requests
 type MarketplaceMessageHandler struct {
 	marketplaceService *messaging.MarketplaceMessagingService
+	broadcaster        MarketplaceBroadcaster
 }
 
 // NewMarketplaceMessageHandler creates a new marketplace message handler
@@ -26,6 +47,11 @@ func NewMarketplaceMessageHandler(marketplaceService *messaging.MarketplaceMessa
 	}
 }
 
+// SetBroadcaster pushes sent messages and thread updates to subscribers
+func (mmh *MarketplaceMessageHandler) SetBroadcaster(broadcaster MarketplaceBroadcaster) {
+	mmh.broadcaster = broadcaster
+}
+
 // CreateThreadResponse represents the response for thread creation
 type CreateThreadResponse struct {
 	Success   bool   `json:"success"`
@@ -42,22 +68,6 @@ type MarketplaceSendMessageResponse struct {
 	Error   string                        `json:"error,omitempty"`
 }
 
-// GetMessagesResponse represents the response for getting messages
-type GetMessagesResponse struct {
-	Success bool                            `json:"success"`
-	Message string                          `json:"message"`
-	Data    []*messaging.MarketplaceMessage `json:"data,omitempty"`
-	Error   string                          `json:"error,omitempty"`
-}
-
-// GetThreadsResponse represents the response for getting user threads
-type GetThreadsResponse struct {
-	Success bool                           `json:"success"`
-	Message string                         `json:"message"`
-	Data    []*messaging.MarketplaceThread `json:"data,omitempty"`
-	Error   string                         `json:"error,omitempty"`
-}
-
 // GetThreadInfoResponse represents the response for getting thread info
 type GetThreadInfoResponse struct {
 	Success bool                         `json:"success"`
@@ -90,7 +100,7 @@ func (mmh *MarketplaceMessageHandler) CreateThread(w http.ResponseWriter, r *htt
 	}
 
 	// Get user ID from context (set by auth middleware)
-	userID, ok := r.Context().Value("user_id").(uuid.UUID)
+	userID, ok := marketplaceUser(r)
 	if !ok {
 		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
 		return
@@ -131,14 +141,14 @@ func (mmh *MarketplaceMessageHandler) SendMessage(w http.ResponseWriter, r *http
 		return
 	}
 
-	// Validate message body
-	if strings.TrimSpace(req.Body) == "" {
+	// Validate message body; a message may be just attachments
+	if strings.TrimSpace(req.Body) == "" && len(req.AttachmentIDs) == 0 {
 		respondWithError(w, http.StatusBadRequest, "Message body cannot be empty")
 		return
 	}
 
 	// Get user ID from context
-	userID, ok := r.Context().Value("user_id").(uuid.UUID)
+	userID, ok := marketplaceUser(r)
 	if !ok {
 		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
 		return
@@ -146,11 +156,23 @@ func (mmh *MarketplaceMessageHandler) SendMessage(w http.ResponseWriter, r *http
 
 	// Send message
 	message, err := mmh.marketplaceService.SendMessage(r.Context(), threadRef, userID, &req)
+	if errors.Is(err, messaging.ErrNotParticipant) {
+		respondWithError(w, http.StatusForbidden, "Access denied")
+		return
+	}
+	if errors.Is(err, messaging.ErrInvalidMessageType) || errors.Is(err, media.ErrAttachmentUnavailable) {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Failed to send message: "+err.Error())
 		return
 	}
 
+	if mmh.broadcaster != nil {
+		mmh.broadcaster.BroadcastNewMessage(threadRef, message)
+	}
+
 	// Return success response
 	response := MarketplaceSendMessageResponse{
 		Success: true,
@@ -172,27 +194,14 @@ func (mmh *MarketplaceMessageHandler) GetThreadMessages(w http.ResponseWriter, r
 	}
 
 	// Get query parameters
-	limitStr := r.URL.Query().Get("limit")
-	afterStr := r.URL.Query().Get("after")
-
-	// Set default limit
-	limit := 50
-	if limitStr != "" {
-		if parsedLimit, err := strconv.Atoi(limitStr); err == nil && parsedLimit > 0 && parsedLimit <= 100 {
-			limit = parsedLimit
-		}
-	}
-
-	// Parse after cursor
-	var afterCursor *time.Time
-	if afterStr != "" {
-		if parsedTime, err := time.Parse(time.RFC3339, afterStr); err == nil {
-			afterCursor = &parsedTime
-		}
+	page, err := pagination.Parse(r.URL.Query(), 50)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid cursor")
+		return
 	}
 
 	// Get user ID from context for access validation
-	userID, ok := r.Context().Value("user_id").(uuid.UUID)
+	userID, ok := marketplaceUser(r)
 	if !ok {
 		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
 		return
@@ -206,7 +215,7 @@ func (mmh *MarketplaceMessageHandler) GetThreadMessages(w http.ResponseWriter, r
 	}
 
 	// Check if user is a participant
-	if userID != threadInfo.BuyerID && userID != threadInfo.SellerID {
+	if !threadInfo.IsParty(userID) {
 		// Check if user is a participant via the participants table
 		participants, err := mmh.marketplaceService.GetThreadParticipants(r.Context(), threadRef)
 		if err != nil {
@@ -229,52 +238,62 @@ func (mmh *MarketplaceMessageHandler) GetThreadMessages(w http.ResponseWriter, r
 	}
 
 	// Get messages
-	messages, err := mmh.marketplaceService.GetThreadMessages(r.Context(), threadRef, limit, afterCursor)
+	messages, err := mmh.marketplaceService.GetThreadMessages(r.Context(), threadRef, page)
+	if errors.Is(err, pagination.ErrInvalidCursor) {
+		respondWithError(w, http.StatusBadRequest, "Invalid cursor")
+		return
+	}
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Failed to get messages: "+err.Error())
 		return
 	}
 
 	// Mark thread as read for this user
-	if err := mmh.marketplaceService.MarkThreadAsRead(r.Context(), threadRef, userID); err != nil {
+	if readAt, err := mmh.marketplaceService.MarkThreadAsRead(r.Context(), threadRef, userID); err != nil {
 		// Log error but don't fail the request
 		fmt.Printf("Warning: failed to mark thread as read: %v\n", err)
+	} else if mmh.broadcaster != nil {
+		mmh.broadcaster.BroadcastRead(threadRef, userID, readAt)
 	}
 
-	// Return success response
-	response := GetMessagesResponse{
-		Success: true,
-		Message: "Messages retrieved successfully",
-		Data:    messages,
-	}
-
-	respondWithJSON(w, http.StatusOK, response)
+	pagination.Respond(w, messages)
 }
 
-// GetUserThreads handles GET /api/marketplace/threads
+// GetUserThreads handles GET /api/marketplace/threads and GET
+// /api/conversations, listing every kind of conversation the user takes
+// part in; ?kind= narrows it to direct, group, product or order
 func (mmh *MarketplaceMessageHandler) GetUserThreads(w http.ResponseWriter, r *http.Request) {
 	// Get user ID from context
-	userID, ok := r.Context().Value("user_id").(uuid.UUID)
+	userID, ok := marketplaceUser(r)
 	if !ok {
 		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
 		return
 	}
 
-	// Get user threads
-	threads, err := mmh.marketplaceService.GetUserThreads(r.Context(), userID)
+	page, err := pagination.Parse(r.URL.Query(), pagination.DefaultLimit)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Failed to get threads: "+err.Error())
+		respondWithError(w, http.StatusBadRequest, "Invalid cursor")
 		return
 	}
 
-	// Return success response
-	response := GetThreadsResponse{
-		Success: true,
-		Message: "Threads retrieved successfully",
-		Data:    threads,
+	kind := messaging.ThreadKind(r.URL.Query().Get("kind"))
+	if kind != "" && !kind.Valid() {
+		respondWithError(w, http.StatusBadRequest, "kind must be direct, group, product or order")
+		return
 	}
 
-	respondWithJSON(w, http.StatusOK, response)
+	// Get user threads
+	threads, err := mmh.marketplaceService.GetUserThreads(r.Context(), userID, kind, page)
+	if errors.Is(err, pagination.ErrInvalidCursor) {
+		respondWithError(w, http.StatusBadRequest, "Invalid cursor")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to get threads: "+err.Error())
+		return
+	}
+
+	pagination.Respond(w, threads)
 }
 
 // GetThreadInfo handles GET /api/marketplace/thread/:threadRef
@@ -288,7 +307,7 @@ func (mmh *MarketplaceMessageHandler) GetThreadInfo(w http.ResponseWriter, r *ht
 	}
 
 	// Get user ID from context for access validation
-	userID, ok := r.Context().Value("user_id").(uuid.UUID)
+	userID, ok := marketplaceUser(r)
 	if !ok {
 		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
 		return
@@ -302,7 +321,7 @@ func (mmh *MarketplaceMessageHandler) GetThreadInfo(w http.ResponseWriter, r *ht
 	}
 
 	// Check if user is a participant
-	if userID != threadInfo.BuyerID && userID != threadInfo.SellerID {
+	if !threadInfo.IsParty(userID) {
 		// Check if user is a participant via the participants table
 		participants, err := mmh.marketplaceService.GetThreadParticipants(r.Context(), threadRef)
 		if err != nil {
@@ -359,7 +378,7 @@ func (mmh *MarketplaceMessageHandler) EscalateThread(w http.ResponseWriter, r *h
 	}
 
 	// Get user ID from context
-	userID, ok := r.Context().Value("user_id").(uuid.UUID)
+	userID, ok := marketplaceUser(r)
 	if !ok {
 		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
 		return
@@ -373,8 +392,8 @@ func (mmh *MarketplaceMessageHandler) EscalateThread(w http.ResponseWriter, r *h
 	}
 
 	// Only buyer or seller can escalate
-	if userID != threadInfo.BuyerID && userID != threadInfo.SellerID {
-		respondWithError(w, http.StatusForbidden, "Only thread participants can escalate")
+	if !threadInfo.IsParty(userID) {
+		respondWithError(w, http.StatusForbidden, "Only the thread's buyer or seller can escalate")
 		return
 	}
 
@@ -385,6 +404,13 @@ func (mmh *MarketplaceMessageHandler) EscalateThread(w http.ResponseWriter, r *h
 		return
 	}
 
+	if mmh.broadcaster != nil {
+		mmh.broadcaster.BroadcastThreadUpdate(threadRef, "thread_escalated", map[string]interface{}{
+			"escalated_by": userID,
+			"reason":       req.Reason,
+		})
+	}
+
 	// Return success response
 	response := EscalateThreadResponse{
 		Success: true,
@@ -429,7 +455,7 @@ func (mmh *MarketplaceMessageHandler) AddParticipant(w http.ResponseWriter, r *h
 	}
 
 	// Validate role
-	validRoles := []string{"buyer", "seller", "ngo", "admin"}
+	validRoles := []string{"buyer", "seller", "ngo", "admin", "member"}
 	validRole := false
 	for _, role := range validRoles {
 		if req.Role == role {
@@ -438,12 +464,12 @@ func (mmh *MarketplaceMessageHandler) AddParticipant(w http.ResponseWriter, r *h
 		}
 	}
 	if !validRole {
-		respondWithError(w, http.StatusBadRequest, "Invalid role. Must be one of: buyer, seller, ngo, admin")
+		respondWithError(w, http.StatusBadRequest, "Invalid role. Must be one of: buyer, seller, ngo, admin, member")
 		return
 	}
 
 	// Get current user ID from context for permission check
-	_, ok := r.Context().Value("user_id").(uuid.UUID)
+	_, ok := marketplaceUser(r)
 	if !ok {
 		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
 		return
@@ -460,6 +486,13 @@ func (mmh *MarketplaceMessageHandler) AddParticipant(w http.ResponseWriter, r *h
 		return
 	}
 
+	if mmh.broadcaster != nil {
+		mmh.broadcaster.BroadcastThreadUpdate(threadRef, "participant_added", map[string]interface{}{
+			"user_id": userID,
+			"role":    req.Role,
+		})
+	}
+
 	// Return success response
 	response := map[string]interface{}{
 		"success": true,
@@ -471,6 +504,40 @@ func (mmh *MarketplaceMessageHandler) AddParticipant(w http.ResponseWriter, r *h
 	respondWithJSON(w, http.StatusOK, response)
 }
 
+// MarkThreadRead handles POST /api/marketplace/thread/:threadRef/read
+func (mmh *MarketplaceMessageHandler) MarkThreadRead(w http.ResponseWriter, r *http.Request) {
+	threadRef := mux.Vars(r)["threadRef"]
+	if threadRef == "" {
+		respondWithError(w, http.StatusBadRequest, "Thread reference is required")
+		return
+	}
+
+	userID, ok := marketplaceUser(r)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	readAt, err := mmh.marketplaceService.MarkThreadAsRead(r.Context(), threadRef, userID)
+	if errors.Is(err, messaging.ErrNotParticipant) {
+		respondWithError(w, http.StatusForbidden, "Access denied")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to mark thread as read: "+err.Error())
+		return
+	}
+
+	if mmh.broadcaster != nil {
+		mmh.broadcaster.BroadcastRead(threadRef, userID, readAt)
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"read_at": readAt,
+	})
+}
+
 // HealthCheck handles GET /api/marketplace/health
 func (mmh *MarketplaceMessageHandler) HealthCheck(w http.ResponseWriter, r *http.Request) {
 	response := map[string]interface{}{
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	_ "github.com/lib/pq"
+
+	"github.com/Andrew-mugwe/agroai/middleware"
+	"github.com/Andrew-mugwe/agroai/models"
+	"github.com/Andrew-mugwe/agroai/services/messaging"
+)
+
+const testJWTSecret = "handlers-test-secret"
+
+func bearer(t *testing.T, userID uuid.UUID) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, &middleware.Claims{
+		UserID: userID.String(),
+		Role:   models.RoleFarmer,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	})
+	signed, err := token.SignedString([]byte(testJWTSecret))
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+	return "Bearer " + signed
+}
+
+// unreachableDB fails every query, so a handler that gets past
+// authentication answers with a service error rather than 401
+func unreachableDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("postgres", "postgres://agroai@127.0.0.1:1/agroai?sslmode=disable&connect_timeout=1")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestMarketplaceHandlersReadAuthenticatedUser(t *testing.T) {
+	t.Setenv("JWT_SECRET", testJWTSecret)
+	handler := NewMarketplaceMessageHandler(messaging.NewMarketplaceMessagingService(unreachableDB(t)))
+
+	router := mux.NewRouter()
+	router.HandleFunc("/api/marketplace/thread/{threadRef}/read", middleware.AuthMiddleware(handler.MarkThreadRead)).Methods("POST")
+	router.HandleFunc("/api/marketplace/thread/{threadRef}/messages", middleware.AuthMiddleware(handler.GetThreadMessages)).Methods("GET")
+	router.HandleFunc("/api/marketplace/thread/{threadRef}/offers", middleware.AuthMiddleware(handler.GetThreadOffers)).Methods("GET")
+	router.HandleFunc("/api/marketplace/thread/{threadRef}/offers/{offerId}/decline", middleware.AuthMiddleware(handler.DeclineOffer)).Methods("POST")
+	router.HandleFunc("/api/conversations", middleware.AuthMiddleware(handler.CreateConversation)).Methods("POST")
+
+	for _, target := range []struct{ method, path string }{
+		{"POST", "/api/marketplace/thread/THR-1/read"},
+		{"GET", "/api/marketplace/thread/THR-1/messages"},
+		{"GET", "/api/marketplace/thread/THR-1/offers"},
+		{"POST", "/api/marketplace/thread/THR-1/offers/" + uuid.NewString() + "/decline"},
+		{"POST", "/api/conversations"},
+	} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(target.method, target.path, nil))
+		if rec.Code != http.StatusUnauthorized {
+			t.Fatalf("%s %s without a token: expected 401, got %d", target.method, target.path, rec.Code)
+		}
+
+		req := httptest.NewRequest(target.method, target.path, nil)
+		req.Header.Set("Authorization", bearer(t, uuid.New()))
+		rec = httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code == http.StatusUnauthorized {
+			t.Fatalf("%s %s with a token: expected the request to reach the service, got 401: %s",
+				target.method, target.path, rec.Body.String())
+		}
+	}
+}
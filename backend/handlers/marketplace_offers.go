@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"github.com/Andrew-mugwe/agroai/pagination"
+	"github.com/Andrew-mugwe/agroai/services/messaging"
+)
+
+// MakeOffer handles POST /api/marketplace/thread/:threadRef/offers
+func (mmh *MarketplaceMessageHandler) MakeOffer(w http.ResponseWriter, r *http.Request) {
+	threadRef := mux.Vars(r)["threadRef"]
+	userID, ok := marketplaceUser(r)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var req messaging.OfferRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	message, err := mmh.marketplaceService.MakeOffer(r.Context(), threadRef, userID, &req)
+	if err != nil {
+		respondWithOfferError(w, "Failed to make offer", err)
+		return
+	}
+	mmh.offerMessageSent(w, threadRef, message)
+}
+
+// CounterOffer handles POST /api/marketplace/thread/:threadRef/offers/:offerId/counter
+func (mmh *MarketplaceMessageHandler) CounterOffer(w http.ResponseWriter, r *http.Request) {
+	threadRef, offerID, userID, ok := offerParams(w, r)
+	if !ok {
+		return
+	}
+
+	var req messaging.OfferRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	message, err := mmh.marketplaceService.CounterOffer(r.Context(), threadRef, offerID, userID, &req)
+	if err != nil {
+		respondWithOfferError(w, "Failed to counter offer", err)
+		return
+	}
+	mmh.offerMessageSent(w, threadRef, message)
+}
+
+// AcceptOffer handles POST /api/marketplace/thread/:threadRef/offers/:offerId/accept
+func (mmh *MarketplaceMessageHandler) AcceptOffer(w http.ResponseWriter, r *http.Request) {
+	threadRef, offerID, userID, ok := offerParams(w, r)
+	if !ok {
+		return
+	}
+
+	// The seller accepts without a body; the buyer sends a shipping address
+	var req messaging.AcceptOfferRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+	}
+
+	message, err := mmh.marketplaceService.AcceptOffer(r.Context(), threadRef, offerID, userID, &req)
+	if err != nil {
+		respondWithOfferError(w, "Failed to accept offer", err)
+		return
+	}
+	mmh.offerMessageSent(w, threadRef, message)
+}
+
+// DeclineOffer handles POST /api/marketplace/thread/:threadRef/offers/:offerId/decline
+func (mmh *MarketplaceMessageHandler) DeclineOffer(w http.ResponseWriter, r *http.Request) {
+	threadRef, offerID, userID, ok := offerParams(w, r)
+	if !ok {
+		return
+	}
+
+	var req messaging.DeclineOfferRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+	}
+
+	message, err := mmh.marketplaceService.DeclineOffer(r.Context(), threadRef, offerID, userID, &req)
+	if err != nil {
+		respondWithOfferError(w, "Failed to decline offer", err)
+		return
+	}
+	mmh.offerMessageSent(w, threadRef, message)
+}
+
+// GetThreadOffers handles GET /api/marketplace/thread/:threadRef/offers
+func (mmh *MarketplaceMessageHandler) GetThreadOffers(w http.ResponseWriter, r *http.Request) {
+	threadRef := mux.Vars(r)["threadRef"]
+	userID, ok := marketplaceUser(r)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	page, err := pagination.Parse(r.URL.Query(), pagination.DefaultLimit)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid cursor")
+		return
+	}
+
+	offers, err := mmh.marketplaceService.GetThreadOffers(r.Context(), threadRef, userID, page)
+	if errors.Is(err, messaging.ErrNotParticipant) {
+		respondWithError(w, http.StatusForbidden, "Access denied")
+		return
+	}
+	if errors.Is(err, pagination.ErrInvalidCursor) {
+		respondWithError(w, http.StatusBadRequest, "Invalid cursor")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to get offers: "+err.Error())
+		return
+	}
+
+	pagination.Respond(w, offers)
+}
+
+// offerParams reads the thread, offer and user of an offer response
+func offerParams(w http.ResponseWriter, r *http.Request) (string, uuid.UUID, uuid.UUID, bool) {
+	vars := mux.Vars(r)
+	offerID, err := uuid.Parse(vars["offerId"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid offer ID")
+		return "", uuid.Nil, uuid.Nil, false
+	}
+	userID, ok := marketplaceUser(r)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return "", uuid.Nil, uuid.Nil, false
+	}
+	return vars["threadRef"], offerID, userID, true
+}
+
+// offerMessageSent broadcasts and returns the message for an offer change
+func (mmh *MarketplaceMessageHandler) offerMessageSent(w http.ResponseWriter, threadRef string, message *messaging.MarketplaceMessage) {
+	if mmh.broadcaster != nil {
+		mmh.broadcaster.BroadcastNewMessage(threadRef, message)
+	}
+
+	respondWithJSON(w, http.StatusCreated, MarketplaceSendMessageResponse{
+		Success: true,
+		Message: "Offer updated successfully",
+		Data:    message,
+	})
+}
+
+func respondWithOfferError(w http.ResponseWriter, message string, err error) {
+	switch {
+	case errors.Is(err, messaging.ErrNotNegotiating):
+		respondWithError(w, http.StatusForbidden, err.Error())
+	case errors.Is(err, messaging.ErrOfferNotFound):
+		respondWithError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, messaging.ErrOfferClosed),
+		errors.Is(err, messaging.ErrOfferPending),
+		errors.Is(err, messaging.ErrOwnOffer):
+		respondWithError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, messaging.ErrInvalidOffer):
+		respondWithError(w, http.StatusBadRequest, err.Error())
+	default:
+		respondWithError(w, http.StatusInternalServerError, message+": "+err.Error())
+	}
+}
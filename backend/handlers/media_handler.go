@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Andrew-mugwe/agroai/models"
+	"github.com/Andrew-mugwe/agroai/services/media"
+	"github.com/Andrew-mugwe/agroai/utils"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// MediaHandler handles image uploads and serves locally stored media
+type MediaHandler struct {
+	mediaService *media.Service
+	// local is set when media is stored on disk and served by ServeMedia
+	local *media.LocalStorage
+}
+
+// NewMediaHandler creates a new media handler. local may be nil when
+// media is served straight from object storage.
+func NewMediaHandler(mediaService *media.Service, local *media.LocalStorage) *MediaHandler {
+	return &MediaHandler{mediaService: mediaService, local: local}
+}
+
+// mediaResponse adds the reference to store in product images
+type mediaResponse struct {
+	*models.MediaAsset
+	Ref string `json:"ref"`
+}
+
+// UploadProductImage handles POST /api/trader/media
+//
+// The multipart image is validated by its content, not its name.
+// Add the returned ref to a product's images to show it on the listing.
+func (h *MediaHandler) UploadProductImage(w http.ResponseWriter, r *http.Request) {
+	traderID, err := utils.GetUserIDFromContext(r)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	data, ok := readImageUpload(w, r)
+	if !ok {
+		return
+	}
+
+	asset, err := h.mediaService.Upload(r.Context(), traderID, models.MediaKindProduct, data)
+	if err != nil {
+		respondWithMediaError(w, err, "Failed to upload image")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusCreated, mediaResponse{asset, asset.Ref()})
+}
+
+// GetMedia handles GET /api/media/{id}, returning freshly signed URLs.
+// Pest report images are only visible to their owner.
+func (h *MediaHandler) GetMedia(w http.ResponseWriter, r *http.Request) {
+	userID, err := utils.GetUserIDFromContext(r)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid media ID")
+		return
+	}
+
+	asset, err := h.mediaService.Get(r.Context(), id)
+	if err == nil && asset.Kind != models.MediaKindProduct && asset.OwnerID != userID {
+		err = media.ErrAssetNotFound
+	}
+	if err != nil {
+		respondWithMediaError(w, err, "Failed to get media")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, mediaResponse{asset, asset.Ref()})
+}
+
+// DeleteMedia handles DELETE /api/media/{id}
+func (h *MediaHandler) DeleteMedia(w http.ResponseWriter, r *http.Request) {
+	userID, err := utils.GetUserIDFromContext(r)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid media ID")
+		return
+	}
+
+	if err := h.mediaService.Delete(r.Context(), userID, id); err != nil {
+		respondWithMediaError(w, err, "Failed to delete media")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, map[string]string{"message": "Media deleted successfully"})
+}
+
+// ServeMedia handles GET /media/{key}, serving a locally stored rendition
+// to anyone holding an unexpired signed URL
+func (h *MediaHandler) ServeMedia(w http.ResponseWriter, r *http.Request) {
+	if h.local == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	key := mux.Vars(r)["key"]
+	q := r.URL.Query()
+	if err := h.local.Verify(key, q.Get("expires"), q.Get("sig")); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	obj, err := h.local.Open(r.Context(), key)
+	if errors.Is(err, media.ErrObjectNotFound) || errors.Is(err, media.ErrInvalidKey) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to read media", http.StatusInternalServerError)
+		return
+	}
+	defer obj.Close()
+
+	// Renditions never change, so they can be cached until the URL expires
+	maxAge := int64(0)
+	if expires, err := strconv.ParseInt(q.Get("expires"), 10, 64); err == nil {
+		maxAge = max(0, expires-time.Now().Unix())
+	}
+	contentType := media.ContentType(path.Ext(key))
+	w.Header().Set("Content-Type", contentType)
+	if !strings.HasPrefix(contentType, "image/") && !strings.HasPrefix(contentType, "audio/") {
+		// Documents are downloaded rather than rendered on our origin
+		w.Header().Set("Content-Disposition", "attachment")
+	}
+	w.Header().Set("Cache-Control", "private, max-age="+strconv.FormatInt(maxAge, 10))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	io.Copy(w, obj)
+}
+
+// attachProductMedia fills in the uploaded images of listings. Listings
+// still render from their image URLs if this fails, so it only logs.
+func attachProductMedia(ctx context.Context, mediaService *media.Service, products []*models.Product) {
+	if mediaService == nil || len(products) == 0 {
+		return
+	}
+	if err := mediaService.AttachToProducts(ctx, products); err != nil {
+		log.Printf("media: failed to attach product images: %v", err)
+	}
+}
+
+// readImageUpload reads the multipart "image" field, or "file" as sent by
+// the web client's upload helper, responding on failure
+func readImageUpload(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	r.Body = http.MaxBytesReader(w, r.Body, media.MaxUploadSize+1<<20)
+	if err := r.ParseMultipartForm(media.MaxUploadSize); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Upload an image of at most 10 MB")
+		return nil, false
+	}
+
+	file, _, err := r.FormFile("image")
+	if errors.Is(err, http.ErrMissingFile) {
+		file, _, err = r.FormFile("file")
+	}
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "No image file provided")
+		return nil, false
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Failed to read image")
+		return nil, false
+	}
+	return data, true
+}
+
+// respondWithMediaError maps media errors to HTTP status codes
+func respondWithMediaError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, media.ErrAssetNotFound):
+		utils.RespondWithError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, media.ErrImageTooLarge):
+		utils.RespondWithError(w, http.StatusRequestEntityTooLarge, err.Error())
+	case errors.Is(err, media.ErrUnsupportedImage):
+		utils.RespondWithValidationError(w, err.Error())
+	default:
+		utils.RespondWithError(w, http.StatusInternalServerError, fallback)
+	}
+}
@@ -2,16 +2,19 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
 	"strconv"
 	"strings"
-	"time"
 
+	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 
 	"github.com/Andrew-mugwe/agroai/middleware"
+	"github.com/Andrew-mugwe/agroai/pagination"
+	"github.com/Andrew-mugwe/agroai/services/media"
 	"github.com/Andrew-mugwe/agroai/services/messaging"
 )
 
@@ -77,6 +80,9 @@ type SendMessageRequest struct {
 	ReceiverID     *string `json:"receiver_id,omitempty"`
 	Body           string  `json:"body"`
 	RoleScope      *string `json:"role_scope,omitempty"`
+	// AttachmentIDs are files uploaded to the conversation; the body may
+	// then be empty
+	AttachmentIDs []uuid.UUID `json:"attachment_ids,omitempty"`
 }
 
 // SendMessageResponse represents the response after sending a message
@@ -87,14 +93,6 @@ type SendMessageResponse struct {
 	ConversationID int    `json:"conversation_id,omitempty"`
 }
 
-// MessagesResponse represents the response for getting messages
-type MessagesResponse struct {
-	Success   bool                `json:"success"`
-	Messages  []messaging.Message `json:"messages"`
-	HasMore   bool                `json:"has_more"`
-	NextAfter *time.Time          `json:"next_after,omitempty"`
-}
-
 // ConversationsResponse represents the response for getting conversations
 type ConversationsResponse struct {
 	Success       bool                            `json:"success"`
@@ -116,8 +114,8 @@ func (mh *MessageHandler) SendMessage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Validate message content
-	if err := validateMessage(req.Body); err != nil {
+	// Validate message content; a voice note or photo needs no text
+	if err := validateMessage(req.Body); err != nil && (len(req.AttachmentIDs) == 0 || strings.TrimSpace(req.Body) != "") {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(map[string]interface{}{
@@ -145,6 +143,10 @@ func (mh *MessageHandler) SendMessage(w http.ResponseWriter, r *http.Request) {
 	} else if req.ReceiverID != nil {
 		// Create or find direct conversation
 		conversationID, err = mh.messagingService.FindOrCreateDirectConversation(ctx, claims.UserID, *req.ReceiverID)
+		if errors.Is(err, messaging.ErrInvalidConversation) || errors.Is(err, messaging.ErrUnknownMember) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		if err != nil {
 			http.Error(w, "Failed to create conversation", http.StatusInternalServerError)
 			return
@@ -161,7 +163,11 @@ func (mh *MessageHandler) SendMessage(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Send the message
-	messageID, err := mh.messagingService.SendMessage(ctx, conversationID, claims.UserID, req.Body)
+	messageID, err := mh.messagingService.SendMessage(ctx, conversationID, claims.UserID, req.Body, req.AttachmentIDs)
+	if errors.Is(err, media.ErrAttachmentUnavailable) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		http.Error(w, "Failed to send message", http.StatusInternalServerError)
 		return
@@ -189,7 +195,7 @@ func (mh *MessageHandler) GetConversationMessages(w http.ResponseWriter, r *http
 
 	// Get conversation ID from URL
 	vars := mux.Vars(r)
-	conversationIDStr, ok := vars["conversation_id"]
+	conversationIDStr, ok := vars["conversationId"]
 	if !ok {
 		http.Error(w, "Conversation ID is required", http.StatusBadRequest)
 		return
@@ -209,44 +215,24 @@ func (mh *MessageHandler) GetConversationMessages(w http.ResponseWriter, r *http
 	}
 
 	// Parse query parameters
-	limitStr := r.URL.Query().Get("limit")
-	limit := 50 // default limit
-	if limitStr != "" {
-		if parsedLimit, err := strconv.Atoi(limitStr); err == nil && parsedLimit > 0 && parsedLimit <= 100 {
-			limit = parsedLimit
-		}
-	}
-
-	var afterTimestamp *time.Time
-	if afterStr := r.URL.Query().Get("after"); afterStr != "" {
-		if parsedTime, err := time.Parse(time.RFC3339, afterStr); err == nil {
-			afterTimestamp = &parsedTime
-		}
+	page, err := pagination.Parse(r.URL.Query(), 50)
+	if err != nil {
+		http.Error(w, "Invalid cursor", http.StatusBadRequest)
+		return
 	}
 
 	// Get messages
-	messages, err := mh.messagingService.GetConversationMessages(ctx, conversationID, limit, afterTimestamp)
+	messages, err := mh.messagingService.GetConversationMessages(ctx, conversationID, page)
+	if errors.Is(err, pagination.ErrInvalidCursor) {
+		http.Error(w, "Invalid cursor", http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		http.Error(w, "Failed to get messages", http.StatusInternalServerError)
 		return
 	}
 
-	// Determine if there are more messages
-	hasMore := len(messages) == limit
-	var nextAfter *time.Time
-	if hasMore && len(messages) > 0 {
-		nextAfter = &messages[len(messages)-1].CreatedAt
-	}
-
-	response := MessagesResponse{
-		Success:   true,
-		Messages:  messages,
-		HasMore:   hasMore,
-		NextAfter: nextAfter,
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	pagination.Respond(w, messages)
 }
 
 // GetUserConversations retrieves conversations for the authenticated user
@@ -319,7 +305,11 @@ func (mh *MessageHandler) CreateConversation(w http.ResponseWriter, r *http.Requ
 
 	// Create conversation
 	ctx := r.Context()
-	conversationID, err := mh.messagingService.CreateConversation(ctx, req.Type, memberIDs)
+	conversationID, err := mh.messagingService.CreateConversation(ctx, claims.UserID, req.Type, memberIDs)
+	if errors.Is(err, messaging.ErrInvalidConversation) || errors.Is(err, messaging.ErrUnknownMember) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		http.Error(w, "Failed to create conversation", http.StatusInternalServerError)
 		return
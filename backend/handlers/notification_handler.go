@@ -1,22 +1,38 @@
 package handlers
 
 import (
+	"encoding/json"
+	"errors"
 	"net/http"
+	"strings"
 
+	"github.com/Andrew-mugwe/agroai/middleware"
+	"github.com/Andrew-mugwe/agroai/pagination"
 	"github.com/Andrew-mugwe/agroai/services/notifications"
+	"github.com/Andrew-mugwe/agroai/services/sms"
 	"github.com/Andrew-mugwe/agroai/utils"
+	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 )
 
 // NotificationHandler handles notification-related HTTP requests
 type NotificationHandler struct {
 	notificationService *notifications.NotificationService
+	store               *notifications.DatabaseNotificationService
+	dispatcher          *notifications.Dispatcher
+	otp                 *sms.OTPService
 }
 
-// NewNotificationHandler creates a new notification handler
-func NewNotificationHandler(notificationService *notifications.NotificationService) *NotificationHandler {
+// NewNotificationHandler creates a new notification handler. store holds the
+// notification inbox; notificationService pushes them in real time and
+// dispatcher delivers them over each user's channels. otp verifies phone
+// numbers before SMS goes to them.
+func NewNotificationHandler(notificationService *notifications.NotificationService, store *notifications.DatabaseNotificationService, dispatcher *notifications.Dispatcher, otp *sms.OTPService) *NotificationHandler {
 	return &NotificationHandler{
 		notificationService: notificationService,
+		store:               store,
+		dispatcher:          dispatcher,
+		otp:                 otp,
 	}
 }
 
@@ -28,11 +44,16 @@ var WebSocketUpgrader = websocket.Upgrader{
 	},
 }
 
-// HandleWebSocket handles WebSocket connections for real-time notifications
+// HandleWebSocket streams real-time notifications to the user named by the
+// bearer token. Browsers cannot set headers on a websocket request, so the
+// token may also come in the token query parameter.
 func (h *NotificationHandler) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
-	// Get user ID from context (you'll need to implement this)
-	userID := r.Header.Get("X-User-ID")
-	if userID == "" {
+	claims, err := middleware.ParseToken(websocketToken(r))
+	if err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	if _, err := uuid.Parse(claims.UserID); err != nil {
 		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
@@ -40,30 +61,83 @@ func (h *NotificationHandler) HandleWebSocket(w http.ResponseWriter, r *http.Req
 	// Upgrade connection to WebSocket
 	conn, err := WebSocketUpgrader.Upgrade(w, r, nil)
 	if err != nil {
-		utils.RespondWithError(w, http.StatusBadRequest, "WebSocket upgrade failed")
+		// The upgrader has already written the error response
 		return
 	}
 
 	// Handle WebSocket connection
-	h.notificationService.HandleWebSocket(conn, userID)
+	h.notificationService.HandleWebSocket(conn, claims.UserID)
 }
 
-// GetNotifications retrieves notifications for the authenticated user
+// websocketToken reads the bearer token from the Authorization header, or
+// the token query parameter when there is no header
+func websocketToken(r *http.Request) string {
+	if header := r.Header.Get("Authorization"); header != "" {
+		token, ok := strings.CutPrefix(header, "Bearer ")
+		if !ok {
+			return ""
+		}
+		return token
+	}
+	return r.URL.Query().Get("token")
+}
+
+// GetNotifications retrieves a page of notifications for the authenticated
+// user, optionally filtered by type and status
 func (h *NotificationHandler) GetNotifications(w http.ResponseWriter, r *http.Request) {
-	// For now, return empty notifications
-	utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
-		"success": true,
-		"data":    []interface{}{},
-		"message": "Notifications retrieved successfully",
+	userID, err := utils.GetUserIDFromContext(r)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	page, err := pagination.FromRequest(r)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	list, err := h.store.GetNotifications(notifications.NotificationQuery{
+		UserID: &userID,
+		Type:   r.URL.Query().Get("type"),
+		Status: r.URL.Query().Get("status"),
+		Page:   page,
 	})
+	if errors.Is(err, pagination.ErrInvalidCursor) {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to get notifications")
+		return
+	}
+
+	pagination.RespondWith(w, list.Pagination, list)
 }
 
-// SendNotification sends a notification to a user
+// SendNotification sends a notification to a user over the channels they
+// have enabled for its type
 func (h *NotificationHandler) SendNotification(w http.ResponseWriter, r *http.Request) {
-	// For now, return success
-	utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
-		"success": true,
-		"message": "Notification sent successfully",
+	var req notifications.NotificationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	notification, err := h.dispatcher.SendNotification(req)
+	if errors.Is(err, notifications.ErrInvalidNotification) {
+		utils.RespondWithValidationError(w, err.Error())
+		return
+	}
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to send notification")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusCreated, notifications.NotificationResponse{
+		Success: true,
+		Message: "Notification sent successfully",
+		Data:    notification,
 	})
 }
 
@@ -98,6 +172,7 @@ func (h *NotificationHandler) DeleteNotification(w http.ResponseWriter, r *http.
 func (h *NotificationHandler) GetNotificationStats(w http.ResponseWriter, r *http.Request) {
 	stats := map[string]interface{}{
 		"connected_clients": h.notificationService.GetConnectedClients(),
+		"connected_users":   h.notificationService.GetConnectedUsers(),
 		"status":            "active",
 	}
 
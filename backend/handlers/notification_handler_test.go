@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Andrew-mugwe/agroai/services/notifications"
+)
+
+func TestNotificationWebSocketAuth(t *testing.T) {
+	t.Setenv("JWT_SECRET", testJWTSecret)
+	hub := notifications.NewNotificationService()
+	h := NewNotificationHandler(hub, nil, nil, nil)
+	server := httptest.NewServer(http.HandlerFunc(h.HandleWebSocket))
+	t.Cleanup(server.Close)
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	// A caller-supplied user ID is not trusted
+	header := http.Header{"X-User-ID": {uuid.NewString()}}
+	_, resp, err := websocket.DefaultDialer.Dial(url, header)
+	require.Error(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	_, resp, err = websocket.DefaultDialer.Dial(url+"?token=not-a-token", nil)
+	require.Error(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	userID := uuid.New()
+	conn, _, err := websocket.DefaultDialer.Dial(url, http.Header{"Authorization": {bearer(t, userID)}})
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	// Browsers send the token in the query string
+	token := strings.TrimPrefix(bearer(t, userID), "Bearer ")
+	conn, _, err = websocket.DefaultDialer.Dial(url+"?token="+token, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	require.Eventually(t, func() bool { return hub.GetConnectedClients() == 2 }, 2*time.Second, 5*time.Millisecond)
+}
@@ -0,0 +1,289 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/Andrew-mugwe/agroai/pagination"
+	"github.com/Andrew-mugwe/agroai/services/notifications"
+	"github.com/Andrew-mugwe/agroai/services/sms"
+	"github.com/Andrew-mugwe/agroai/utils"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// GetPreferences handles GET /api/notifications/preferences
+//
+// Channels the user has not set are listed with their defaults under the
+// "*" type.
+func (h *NotificationHandler) GetPreferences(w http.ResponseWriter, r *http.Request) {
+	userID, err := utils.GetUserIDFromContext(r)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	prefs, err := h.dispatcher.Preferences(r.Context(), userID)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to get notification preferences")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, prefs.WithDefaults())
+}
+
+// SetPreferences handles PUT /api/notifications/preferences
+//
+// The body replaces every preference, e.g.
+// {"channels": [{"type": "*", "channel": "sms", "enabled": true},
+// {"type": "market", "channel": "email", "enabled": false}],
+// "quiet_hours": {"start": "22:00", "end": "07:00", "timezone": "Africa/Nairobi"},
+// "digest": {"frequency": "daily", "channel": "email", "at": "18:00", "timezone": "Africa/Nairobi"}}
+func (h *NotificationHandler) SetPreferences(w http.ResponseWriter, r *http.Request) {
+	userID, err := utils.GetUserIDFromContext(r)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req notifications.Preferences
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	prefs, err := h.dispatcher.SetPreferences(r.Context(), userID, &req)
+	if err != nil {
+		respondWithNotificationError(w, err, "Failed to set notification preferences")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, prefs.WithDefaults())
+}
+
+// RegisterDevice handles POST /api/notifications/devices
+func (h *NotificationHandler) RegisterDevice(w http.ResponseWriter, r *http.Request) {
+	userID, err := utils.GetUserIDFromContext(r)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req struct {
+		Token    string `json:"token"`
+		Platform string `json:"platform"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if err := h.dispatcher.RegisterDevice(r.Context(), userID, req.Token, req.Platform); err != nil {
+		respondWithNotificationError(w, err, "Failed to register device")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RemoveDevice handles DELETE /api/notifications/devices/{token}
+func (h *NotificationHandler) RemoveDevice(w http.ResponseWriter, r *http.Request) {
+	userID, err := utils.GetUserIDFromContext(r)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	if err := h.dispatcher.RemoveDevice(r.Context(), userID, mux.Vars(r)["token"]); err != nil {
+		respondWithNotificationError(w, err, "Failed to remove device")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// SetContact handles PUT /api/notifications/contact
+//
+// Texts a verification code to the phone, in international format; the
+// number is used once confirmed with VerifyContact. An empty phone removes
+// the number.
+func (h *NotificationHandler) SetContact(w http.ResponseWriter, r *http.Request) {
+	userID, err := utils.GetUserIDFromContext(r)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req struct {
+		Phone string `json:"phone"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if req.Phone == "" {
+		if err := h.dispatcher.SetPhone(r.Context(), userID, ""); err != nil {
+			respondWithNotificationError(w, err, "Failed to remove phone")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if err := h.otp.Request(r.Context(), userID, req.Phone, sms.PurposeVerifyPhone); err != nil {
+		respondWithNotificationError(w, err, "Failed to send verification code")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusAccepted, map[string]interface{}{
+		"success": true,
+		"message": "Verification code sent",
+	})
+}
+
+// VerifyContact handles POST /api/notifications/contact/verify
+func (h *NotificationHandler) VerifyContact(w http.ResponseWriter, r *http.Request) {
+	userID, err := utils.GetUserIDFromContext(r)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req struct {
+		Phone string `json:"phone"`
+		Code  string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if err := h.otp.Verify(r.Context(), userID, req.Phone, sms.PurposeVerifyPhone, req.Code); err != nil {
+		respondWithNotificationError(w, err, "Failed to verify phone")
+		return
+	}
+	if err := h.dispatcher.SetPhone(r.Context(), userID, req.Phone); err != nil {
+		respondWithNotificationError(w, err, "Failed to set phone")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetLanguage handles GET /api/notifications/language
+//
+// Returns the user's language and the languages notifications are
+// available in.
+func (h *NotificationHandler) GetLanguage(w http.ResponseWriter, r *http.Request) {
+	userID, err := utils.GetUserIDFromContext(r)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	language, err := h.dispatcher.Language(r.Context(), userID)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to get language")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"language":  language,
+		"available": h.dispatcher.Templates().Languages(),
+	})
+}
+
+// SetLanguage handles PUT /api/notifications/language
+func (h *NotificationHandler) SetLanguage(w http.ResponseWriter, r *http.Request) {
+	userID, err := utils.GetUserIDFromContext(r)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req struct {
+		Language string `json:"language"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if err := h.dispatcher.SetLanguage(r.Context(), userID, req.Language); err != nil {
+		respondWithNotificationError(w, err, "Failed to set language")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetDigests handles GET /api/notifications/digests
+//
+// Lists a page of the user's digests, newest first, with how many
+// notifications each summarised.
+func (h *NotificationHandler) GetDigests(w http.ResponseWriter, r *http.Request) {
+	userID, err := utils.GetUserIDFromContext(r)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	page, err := pagination.FromRequest(r)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	digests, err := h.dispatcher.Digests(r.Context(), userID, page)
+	if errors.Is(err, pagination.ErrInvalidCursor) {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to get digests")
+		return
+	}
+	pagination.Respond(w, digests)
+}
+
+// GetDeliveries handles GET /api/notifications/{id}/deliveries
+func (h *NotificationHandler) GetDeliveries(w http.ResponseWriter, r *http.Request) {
+	userID, err := utils.GetUserIDFromContext(r)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid notification ID")
+		return
+	}
+
+	page, err := pagination.FromRequest(r)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	deliveries, err := h.dispatcher.Deliveries(r.Context(), userID, id, page)
+	if errors.Is(err, pagination.ErrInvalidCursor) {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		respondWithNotificationError(w, err, "Failed to get deliveries")
+		return
+	}
+	pagination.Respond(w, deliveries)
+}
+
+// respondWithNotificationError maps notification errors to HTTP status codes
+func respondWithNotificationError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, notifications.ErrNotificationNotFound), errors.Is(err, notifications.ErrDeviceNotFound):
+		utils.RespondWithError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, notifications.ErrInvalidPreferences), errors.Is(err, notifications.ErrInvalidDevice),
+		errors.Is(err, notifications.ErrUnsupportedLanguage),
+		errors.Is(err, sms.ErrInvalidNumber), errors.Is(err, sms.ErrOTPInvalid), errors.Is(err, sms.ErrOTPTooMany):
+		utils.RespondWithValidationError(w, err.Error())
+	case errors.Is(err, sms.ErrOTPRateLimited):
+		utils.RespondWithError(w, http.StatusTooManyRequests, err.Error())
+	default:
+		utils.RespondWithError(w, http.StatusInternalServerError, fallback)
+	}
+}
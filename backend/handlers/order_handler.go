@@ -1,11 +1,13 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
-	"strconv"
 
 	"github.com/Andrew-mugwe/agroai/models"
+	"github.com/Andrew-mugwe/agroai/pagination"
 	"github.com/Andrew-mugwe/agroai/services/orders"
 	"github.com/Andrew-mugwe/agroai/utils"
 	"github.com/google/uuid"
@@ -106,46 +108,18 @@ func (h *OrderHandler) GetOrder(w http.ResponseWriter, r *http.Request) {
 
 // GetUserOrders handles getting user's orders
 func (h *OrderHandler) GetUserOrders(w http.ResponseWriter, r *http.Request) {
-	// Get user ID from context
-	userID, err := utils.GetUserIDFromContext(r)
-	if err != nil {
-		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
-		return
-	}
-
-	// Get pagination parameters
-	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
-	if page < 1 {
-		page = 1
-	}
-
-	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
-	if limit < 1 || limit > 100 {
-		limit = 20
-	}
-
-	// Get orders
-	orders, err := h.orderService.GetUserOrders(r.Context(), userID, page, limit)
-	if err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to get orders")
-		return
-	}
-
-	// Return response
-	response := models.OrdersListResponse{
-		Success: true,
-		Message: "Orders retrieved successfully",
-		Data:    orders,
-		Total:   len(orders),
-		Page:    page,
-		Limit:   limit,
-	}
-
-	utils.RespondWithJSON(w, http.StatusOK, response)
+	h.listOrders(w, r, h.orderService.GetUserOrders)
 }
 
 // GetSellerOrders handles getting seller's orders
 func (h *OrderHandler) GetSellerOrders(w http.ResponseWriter, r *http.Request) {
+	// Orders are listed for the user as seller
+	h.listOrders(w, r, h.orderService.GetSellerOrders)
+}
+
+// listOrders responds with the page of the current user's orders read by list
+func (h *OrderHandler) listOrders(w http.ResponseWriter, r *http.Request,
+	list func(context.Context, uuid.UUID, pagination.Params) (pagination.Page[models.Order], error)) {
 	// Get user ID from context
 	userID, err := utils.GetUserIDFromContext(r)
 	if err != nil {
@@ -154,34 +128,23 @@ func (h *OrderHandler) GetSellerOrders(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get pagination parameters
-	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
-	if page < 1 {
-		page = 1
+	page, err := pagination.FromRequest(r)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
 	}
 
-	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
-	if limit < 1 || limit > 100 {
-		limit = 20
+	orders, err := list(r.Context(), userID, page)
+	if errors.Is(err, pagination.ErrInvalidCursor) {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
 	}
-
-	// Get orders (assuming userID is sellerID for simplicity)
-	orders, err := h.orderService.GetSellerOrders(r.Context(), userID, page, limit)
 	if err != nil {
 		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to get orders")
 		return
 	}
 
-	// Return response
-	response := models.OrdersListResponse{
-		Success: true,
-		Message: "Orders retrieved successfully",
-		Data:    orders,
-		Total:   len(orders),
-		Page:    page,
-		Limit:   limit,
-	}
-
-	utils.RespondWithJSON(w, http.StatusOK, response)
+	pagination.Respond(w, orders)
 }
 
 // UpdateOrderStatus handles updating order status
@@ -1,28 +1,29 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
-	"fmt"
-	"io"
+	"log"
 	"net/http"
-	"os"
-	"path/filepath"
 	"strconv"
 	"strings"
-	"time"
 
 	"github.com/Andrew-mugwe/agroai/middleware"
+	"github.com/Andrew-mugwe/agroai/models"
+	"github.com/Andrew-mugwe/agroai/services/media"
 	"github.com/Andrew-mugwe/agroai/services/pest"
+	"github.com/google/uuid"
 )
 
 // PestHandler handles pest detection HTTP requests
 type PestHandler struct {
-	pestService *pest.PestService
+	pestService  *pest.PestService
+	mediaService *media.Service
 }
 
 // NewPestHandler creates a new pest handler
-func NewPestHandler(pestService *pest.PestService) *PestHandler {
-	return &PestHandler{pestService: pestService}
+func NewPestHandler(pestService *pest.PestService, mediaService *media.Service) *PestHandler {
+	return &PestHandler{pestService: pestService, mediaService: mediaService}
 }
 
 // CreatePestReportRequest represents the request to create a pest report
@@ -59,24 +60,21 @@ func (ph *PestHandler) CreatePestReport(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// Parse multipart form
-	err := r.ParseMultipartForm(10 << 20) // 10 MB max
+	ownerID, err := uuid.Parse(claims.UserID)
 	if err != nil {
-		http.Error(w, "Failed to parse multipart form", http.StatusBadRequest)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
 
-	// Get uploaded file
-	file, handler, err := r.FormFile("image")
-	if err != nil {
-		http.Error(w, "No image file provided", http.StatusBadRequest)
+	// The media service checks the image by content and strips its
+	// metadata, including the GPS position of the farm
+	data, ok := readImageUpload(w, r)
+	if !ok {
 		return
 	}
-	defer file.Close()
-
-	// Validate file type
-	if !isValidImageType(handler.Filename) {
-		http.Error(w, "Invalid file type. Only JPG, PNG, and GIF are allowed", http.StatusBadRequest)
+	asset, err := ph.mediaService.Upload(r.Context(), ownerID, models.MediaKindPest, data)
+	if err != nil {
+		respondWithMediaError(w, err, "Failed to save image")
 		return
 	}
 
@@ -86,41 +84,16 @@ func (ph *PestHandler) CreatePestReport(w http.ResponseWriter, r *http.Request)
 		notes = "No additional notes provided"
 	}
 
-	// Create uploads directory if it doesn't exist
-	uploadsDir := "uploads"
-	if err := os.MkdirAll(uploadsDir, 0755); err != nil {
-		http.Error(w, "Failed to create uploads directory", http.StatusInternalServerError)
-		return
-	}
-
-	// Generate unique filename
-	timestamp := time.Now().Unix()
-	ext := filepath.Ext(handler.Filename)
-	filename := fmt.Sprintf("pest_%s_%d%s", claims.UserID[:8], timestamp, ext)
-	filepath := filepath.Join(uploadsDir, filename)
-
-	// Save file
-	dst, err := os.Create(filepath)
-	if err != nil {
-		http.Error(w, "Failed to save file", http.StatusInternalServerError)
-		return
-	}
-	defer dst.Close()
-
-	_, err = io.Copy(dst, file)
-	if err != nil {
-		http.Error(w, "Failed to save file", http.StatusInternalServerError)
-		return
-	}
-
 	// Create pest report
-	report, err := ph.pestService.CreatePestReport(claims.UserID, filepath, notes)
+	report, err := ph.pestService.CreatePestReport(claims.UserID, asset.Ref(), notes)
 	if err != nil {
-		// Clean up uploaded file if database operation fails
-		os.Remove(filepath)
+		// Clean up the uploaded image if the database operation fails
+		ph.mediaService.Delete(r.Context(), ownerID, asset.ID)
 		http.Error(w, "Failed to create pest report", http.StatusInternalServerError)
 		return
 	}
+	report.Image = asset
+	report.ImageURL = media.URL(asset, models.MediaVariantLarge)
 
 	// Return success response
 	w.Header().Set("Content-Type", "application/json")
@@ -165,6 +138,7 @@ func (ph *PestHandler) GetUserPestReports(w http.ResponseWriter, r *http.Request
 		http.Error(w, "Failed to get pest reports", http.StatusInternalServerError)
 		return
 	}
+	ph.attachImages(r.Context(), reports)
 
 	// Return success response
 	w.Header().Set("Content-Type", "application/json")
@@ -240,6 +214,7 @@ func (ph *PestHandler) GetAllPestReports(w http.ResponseWriter, r *http.Request)
 		http.Error(w, "Failed to get pest reports", http.StatusInternalServerError)
 		return
 	}
+	ph.attachImages(r.Context(), reports)
 
 	// Return success response
 	w.Header().Set("Content-Type", "application/json")
@@ -274,11 +249,18 @@ func (ph *PestHandler) DeletePestReport(w http.ResponseWriter, r *http.Request)
 	}
 
 	// Delete pest report
-	err = ph.pestService.DeletePestReport(id, claims.UserID)
+	imageURL, err := ph.pestService.DeletePestReport(id, claims.UserID)
 	if err != nil {
 		http.Error(w, "Failed to delete pest report", http.StatusInternalServerError)
 		return
 	}
+	if mediaID, ok := models.ParseMediaRef(imageURL); ok {
+		if ownerID, err := uuid.Parse(claims.UserID); err == nil {
+			if err := ph.mediaService.Delete(r.Context(), ownerID, mediaID); err != nil {
+				log.Printf("pest: failed to delete image of report %d: %v", id, err)
+			}
+		}
+	}
 
 	// Return success response
 	w.Header().Set("Content-Type", "application/json")
@@ -288,15 +270,22 @@ func (ph *PestHandler) DeletePestReport(w http.ResponseWriter, r *http.Request)
 	})
 }
 
-// isValidImageType checks if the file is a valid image type
-func isValidImageType(filename string) bool {
-	ext := strings.ToLower(filepath.Ext(filename))
-	validExts := []string{".jpg", ".jpeg", ".png", ".gif"}
-	
-	for _, validExt := range validExts {
-		if ext == validExt {
-			return true
+// attachImages replaces media references with signed URLs of the large
+// rendition. Reports from before the media service keep their file path.
+func (ph *PestHandler) attachImages(ctx context.Context, reports []pest.PestReport) {
+	refs := make([]string, len(reports))
+	for i, report := range reports {
+		refs[i] = report.ImageURL
+	}
+	assets, err := ph.mediaService.Resolve(ctx, refs)
+	if err != nil {
+		log.Printf("pest: failed to load report images: %v", err)
+		return
+	}
+	for i := range reports {
+		if asset, ok := assets[reports[i].ImageURL]; ok {
+			reports[i].Image = asset
+			reports[i].ImageURL = media.URL(asset, models.MediaVariantLarge)
 		}
 	}
-	return false
 }
@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Andrew-mugwe/agroai/models"
+	"github.com/Andrew-mugwe/agroai/pagination"
+	"github.com/Andrew-mugwe/agroai/services/pricing"
+	"github.com/Andrew-mugwe/agroai/utils"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/shopspring/decimal"
+)
+
+// PricingHandler serves price history, market price indices and price
+// suggestions
+type PricingHandler struct {
+	pricingService *pricing.Service
+}
+
+// NewPricingHandler creates a new pricing handler
+func NewPricingHandler(pricingService *pricing.Service) *PricingHandler {
+	return &PricingHandler{pricingService: pricingService}
+}
+
+// GetPriceHistory handles GET /api/marketplace/products/{id}/price-history
+//
+// Query: days (default 90, at most 365), limit, cursor
+func (h *PricingHandler) GetPriceHistory(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid product ID")
+		return
+	}
+
+	page, err := pagination.FromRequest(r)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	days := 90
+	if d := parseInt64Ptr(r.URL.Query().Get("days")); d != nil && *d > 0 {
+		days = int(min(*d, 365))
+	}
+
+	points, err := h.pricingService.History(r.Context(), id, time.Now().AddDate(0, 0, -days), page)
+	if errors.Is(err, pagination.ErrInvalidCursor) {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to get price history")
+		return
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	pagination.Respond(w, points)
+}
+
+// ListMarketPrices handles GET /api/marketplace/prices
+//
+// Query: category, region, limit, cursor. Region "" on an index means all
+// regions.
+func (h *PricingHandler) ListMarketPrices(w http.ResponseWriter, r *http.Request) {
+	page, err := pagination.FromRequest(r)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	q := r.URL.Query()
+	indices, err := h.pricingService.ListIndices(r.Context(), q.Get("category"), q.Get("region"), page)
+	if errors.Is(err, pagination.ErrInvalidCursor) {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to get market prices")
+		return
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	pagination.Respond(w, indices)
+}
+
+// SuggestPrice handles GET /api/trader/pricing/suggest
+//
+// Query: product_id to price an existing listing's variants, or category,
+// unit, pack_size and currency to price a new pack
+func (h *PricingHandler) SuggestPrice(w http.ResponseWriter, r *http.Request) {
+	traderID, err := utils.GetUserIDFromContext(r)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	q := r.URL.Query()
+	var req pricing.SuggestRequest
+	if raw := q.Get("product_id"); raw != "" {
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid product ID")
+			return
+		}
+		req.ProductID = &id
+	} else {
+		req.Category = models.ProductCategory(q.Get("category"))
+		req.Unit = models.UnitOfMeasure(q.Get("unit"))
+		req.Currency = q.Get("currency")
+		if !req.Category.IsValid() || !req.Unit.IsValid() {
+			utils.RespondWithValidationError(w, "A valid category and unit, or a product_id, are required")
+			return
+		}
+		req.PackSize = decimal.NewFromInt(1)
+		if raw := q.Get("pack_size"); raw != "" {
+			req.PackSize, err = decimal.NewFromString(raw)
+			if err != nil || req.PackSize.Sign() <= 0 {
+				utils.RespondWithValidationError(w, "pack_size must be a positive number")
+				return
+			}
+		}
+	}
+
+	suggestion, err := h.pricingService.Suggest(r.Context(), traderID, req)
+	switch {
+	case errors.Is(err, pricing.ErrProductNotFound):
+		utils.RespondWithError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, pricing.ErrNoMarketData):
+		utils.RespondWithError(w, http.StatusNotFound, err.Error())
+	case err != nil:
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to suggest a price")
+	default:
+		utils.RespondWithJSON(w, http.StatusOK, suggestion)
+	}
+}
+
+// RecomputeIndices handles POST /api/admin/pricing/recompute and responds
+// with the first page of the new indices
+//
+// Query: limit
+func (h *PricingHandler) RecomputeIndices(w http.ResponseWriter, r *http.Request) {
+	page, err := pagination.FromRequest(r)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := h.pricingService.Recompute(r.Context()); err != nil {
+		log.Printf("pricing: recompute failed: %v", err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to recompute market prices")
+		return
+	}
+
+	// Indices were rebuilt, so a cursor into the old ones is meaningless
+	page.Cursor = nil
+	indices, err := h.pricingService.ListIndices(r.Context(), "", "", page)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to get market prices")
+		return
+	}
+	pagination.Respond(w, indices)
+}
+
+// ImportFeed handles POST /api/admin/pricing/feed/import. The indices are
+// recomputed afterwards so the new prices show up straight away.
+func (h *PricingHandler) ImportFeed(w http.ResponseWriter, r *http.Request) {
+	report, err := h.pricingService.ImportFeed(r.Context())
+	if errors.Is(err, pricing.ErrFeedNotConfigured) {
+		utils.RespondWithError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("pricing: feed import failed: %v", err)
+		utils.RespondWithError(w, http.StatusBadGateway, "Failed to import market data feed")
+		return
+	}
+
+	if err := h.pricingService.Recompute(r.Context()); err != nil {
+		log.Printf("pricing: recompute after feed import failed: %v", err)
+	}
+	utils.RespondWithJSON(w, http.StatusOK, report)
+}
+
+// attachMarketPrices adds market price hints to listings
+func attachMarketPrices(pricingService *pricing.Service, products []*models.Product) {
+	if pricingService == nil || len(products) == 0 {
+		return
+	}
+	pricingService.AttachHints(products)
+}
@@ -2,10 +2,12 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
-	"strconv"
 
 	"github.com/Andrew-mugwe/agroai/models"
+	"github.com/Andrew-mugwe/agroai/pagination"
+	"github.com/Andrew-mugwe/agroai/repository"
 	"github.com/Andrew-mugwe/agroai/services"
 	"github.com/Andrew-mugwe/agroai/utils"
 
@@ -15,11 +17,13 @@ import (
 
 type ProductHandler struct {
 	productService services.ProductService
+	cacheService   *services.CacheService
 }
 
-func NewProductHandler(productService services.ProductService) *ProductHandler {
+func NewProductHandler(productService services.ProductService, cacheService *services.CacheService) *ProductHandler {
 	return &ProductHandler{
 		productService: productService,
+		cacheService:   cacheService,
 	}
 }
 
@@ -51,22 +55,18 @@ func (h *ProductHandler) CreateProduct(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Validate request
-	if req.Name == "" || req.Description == "" {
-		utils.RespondWithValidationError(w, "Name and description are required")
+	if req.Title == "" || req.Description == "" {
+		utils.RespondWithValidationError(w, "Title and description are required")
 		return
 	}
 
 	// Create product
 	product, err := h.productService.CreateProduct(r.Context(), traderID, &req)
 	if err != nil {
-		switch err {
-		case services.ErrUnauthorized:
-			utils.RespondWithError(w, http.StatusUnauthorized, err.Error())
-		default:
-			utils.RespondWithError(w, http.StatusInternalServerError, "Failed to create product")
-		}
+		respondWithProductError(w, err, "Failed to create product")
 		return
 	}
+	h.invalidateTraderProducts(traderID)
 
 	utils.RespondWithJSON(w, http.StatusCreated, product)
 }
@@ -109,8 +109,8 @@ func (h *ProductHandler) UpdateProduct(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Validate request
-	if req.Name != nil && *req.Name == "" {
-		utils.RespondWithValidationError(w, "Name cannot be empty")
+	if req.Title != nil && *req.Title == "" {
+		utils.RespondWithValidationError(w, "Title cannot be empty")
 		return
 	}
 	if req.Description != nil && *req.Description == "" {
@@ -121,16 +121,10 @@ func (h *ProductHandler) UpdateProduct(w http.ResponseWriter, r *http.Request) {
 	// Update product
 	product, err := h.productService.UpdateProduct(r.Context(), productID, traderID, &req)
 	if err != nil {
-		switch err {
-		case services.ErrUnauthorized:
-			utils.RespondWithError(w, http.StatusUnauthorized, err.Error())
-		case services.ErrNotFound:
-			utils.RespondWithError(w, http.StatusNotFound, "Product not found")
-		default:
-			utils.RespondWithError(w, http.StatusInternalServerError, "Failed to update product")
-		}
+		respondWithProductError(w, err, "Failed to update product")
 		return
 	}
+	h.invalidateTraderProducts(traderID)
 
 	utils.RespondWithJSON(w, http.StatusOK, product)
 }
@@ -165,29 +159,24 @@ func (h *ProductHandler) DeleteProduct(w http.ResponseWriter, r *http.Request) {
 	// Delete product
 	err = h.productService.DeleteProduct(r.Context(), productID, traderID)
 	if err != nil {
-		switch err {
-		case services.ErrUnauthorized:
-			utils.RespondWithError(w, http.StatusUnauthorized, err.Error())
-		case services.ErrNotFound:
-			utils.RespondWithError(w, http.StatusNotFound, "Product not found")
-		default:
-			utils.RespondWithError(w, http.StatusInternalServerError, "Failed to delete product")
-		}
+		respondWithProductError(w, err, "Failed to delete product")
 		return
 	}
+	h.invalidateTraderProducts(traderID)
 
 	w.WriteHeader(http.StatusNoContent)
 }
 
 // GetTraderProducts godoc
 // @Summary Get trader's products
-// @Description Get paginated list of products for the authenticated trader
+// @Description Get a cursor-paginated list of products for the authenticated trader
 // @Tags products
 // @Produce json
-// @Param page query int false "Page number (default: 1)"
-// @Param size query int false "Page size (default: 10)"
+// @Param limit query int false "Page size (default: 20, max: 100)"
+// @Param cursor query string false "Cursor from the previous page's next_cursor"
 // @Security BearerAuth
-// @Success 200 {object} utils.PaginatedResponse{data=[]models.Product}
+// @Success 200 {object} pagination.Envelope{data=[]models.Product}
+// @Failure 400 {object} utils.ErrorResponse
 // @Failure 401 {object} utils.ErrorResponse
 // @Router /api/trader/products [get]
 func (h *ProductHandler) GetTraderProducts(w http.ResponseWriter, r *http.Request) {
@@ -199,28 +188,147 @@ func (h *ProductHandler) GetTraderProducts(w http.ResponseWriter, r *http.Reques
 	}
 
 	// Get pagination params
-	page := 1
-	pageSize := 10
-
-	if pageStr := r.URL.Query().Get("page"); pageStr != "" {
-		if p, err := strconv.Atoi(pageStr); err == nil && p > 0 {
-			page = p
-		}
-	}
-
-	if sizeStr := r.URL.Query().Get("size"); sizeStr != "" {
-		if s, err := strconv.Atoi(sizeStr); err == nil && s > 0 {
-			pageSize = s
-		}
+	page, err := pagination.FromRequest(r)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
 	}
 
 	// Get products
-	products, total, err := h.productService.GetTraderProducts(r.Context(), traderID, page, pageSize)
+	filter := repository.ProductFilter{
+		Category: r.URL.Query().Get("category"),
+	}
+	products, err := h.productService.ListSellerProducts(r.Context(), traderID, filter, page)
+	if errors.Is(err, pagination.ErrInvalidCursor) {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 	if err != nil {
 		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to get products")
 		return
 	}
 
 	// Respond with paginated results
-	utils.RespondWithPagination(w, http.StatusOK, products, page, pageSize, total)
+	pagination.Respond(w, products)
+}
+
+// AddVariant handles POST /api/trader/products/{id}/variants
+func (h *ProductHandler) AddVariant(w http.ResponseWriter, r *http.Request) {
+	traderID, err := utils.GetUserIDFromContext(r)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	productID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid product ID")
+		return
+	}
+
+	var req models.ProductVariantRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	variant, err := h.productService.AddVariant(r.Context(), productID, traderID, &req)
+	if err != nil {
+		respondWithProductError(w, err, "Failed to add variant")
+		return
+	}
+	h.invalidateTraderProducts(traderID)
+
+	utils.RespondWithJSON(w, http.StatusCreated, variant)
+}
+
+// UpdateVariant handles PUT /api/trader/products/{id}/variants/{variantId}
+func (h *ProductHandler) UpdateVariant(w http.ResponseWriter, r *http.Request) {
+	traderID, err := utils.GetUserIDFromContext(r)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	vars := mux.Vars(r)
+	productID, err := uuid.Parse(vars["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid product ID")
+		return
+	}
+	variantID, err := uuid.Parse(vars["variantId"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid variant ID")
+		return
+	}
+
+	var req models.UpdateProductVariantRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	variant, err := h.productService.UpdateVariant(r.Context(), productID, variantID, traderID, &req)
+	if err != nil {
+		respondWithProductError(w, err, "Failed to update variant")
+		return
+	}
+	h.invalidateTraderProducts(traderID)
+
+	utils.RespondWithJSON(w, http.StatusOK, variant)
+}
+
+// DeleteVariant handles DELETE /api/trader/products/{id}/variants/{variantId}
+func (h *ProductHandler) DeleteVariant(w http.ResponseWriter, r *http.Request) {
+	traderID, err := utils.GetUserIDFromContext(r)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	vars := mux.Vars(r)
+	productID, err := uuid.Parse(vars["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid product ID")
+		return
+	}
+	variantID, err := uuid.Parse(vars["variantId"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid variant ID")
+		return
+	}
+
+	if err := h.productService.DeleteVariant(r.Context(), productID, variantID, traderID); err != nil {
+		respondWithProductError(w, err, "Failed to delete variant")
+		return
+	}
+	h.invalidateTraderProducts(traderID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// invalidateTraderProducts drops the cached listings served by TraderHandler.GetProducts
+func (h *ProductHandler) invalidateTraderProducts(traderID uuid.UUID) {
+	if h.cacheService == nil {
+		return
+	}
+	h.cacheService.DeletePattern(h.cacheService.GetProductsKey(traderID.String()) + "*")
+}
+
+// respondWithProductError maps catalogue errors to HTTP status codes
+func respondWithProductError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, services.ErrProductUnauthorized):
+		utils.RespondWithError(w, http.StatusForbidden, err.Error())
+	case errors.Is(err, services.ErrNotFound):
+		utils.RespondWithError(w, http.StatusNotFound, "Product not found")
+	case errors.Is(err, services.ErrVariantNotFound):
+		utils.RespondWithError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, services.ErrDuplicateSKU), errors.Is(err, services.ErrLastVariant):
+		utils.RespondWithError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, services.ErrInvalidProduct):
+		utils.RespondWithValidationError(w, err.Error())
+	default:
+		utils.RespondWithError(w, http.StatusInternalServerError, fallback)
+	}
 }
@@ -4,82 +4,174 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+	"net/url"
 	"strconv"
 	"time"
 
+	"github.com/Andrew-mugwe/agroai/models"
+	"github.com/Andrew-mugwe/agroai/pagination"
 	"github.com/Andrew-mugwe/agroai/services/marketplace"
+	"github.com/Andrew-mugwe/agroai/services/media"
+	"github.com/Andrew-mugwe/agroai/services/pricing"
+	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 )
 
 type PublicProductHandler struct {
-	svc *marketplace.Service
+	svc     *marketplace.Service
+	media   *media.Service
+	pricing *pricing.Service
 }
 
-func NewPublicProductHandler(svc *marketplace.Service) *PublicProductHandler {
-	return &PublicProductHandler{svc: svc}
+func NewPublicProductHandler(svc *marketplace.Service, mediaService *media.Service, pricingService *pricing.Service) *PublicProductHandler {
+	return &PublicProductHandler{svc: svc, media: mediaService, pricing: pricingService}
 }
 
 func (h *PublicProductHandler) ListProducts(w http.ResponseWriter, r *http.Request) {
-	q := r.URL.Query()
-	page, _ := strconv.Atoi(q.Get("page"))
-	limit, _ := strconv.Atoi(q.Get("limit"))
-	minPrice, maxPrice := parseInt64Ptr(q.Get("min_price")), parseInt64Ptr(q.Get("max_price"))
-	filter := marketplace.ListFilter{
-		Page:     page,
-		Limit:    limit,
-		Category: q.Get("category"),
-		MinPrice: minPrice,
-		MaxPrice: maxPrice,
-		Query:    q.Get("q"),
-		SellerID: q.Get("seller_id"),
-		Sort:     q.Get("sort"),
-	}
-
-	items, meta, err := h.svc.ListPublicProducts(r.Context(), filter)
+	filter, err := listFilterFromQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	page, err := h.svc.ListPublicProducts(r.Context(), filter)
+	if errors.Is(err, pagination.ErrInvalidCursor) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	attachProductMedia(r.Context(), h.media, page.Items)
+	attachMarketPrices(h.pricing, page.Items)
+
 	// basic caching headers
 	w.Header().Set("Cache-Control", "public, max-age=30")
 	w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{"items": items, "meta": meta})
+	pagination.Respond(w, page)
 }
 
 func (h *PublicProductHandler) GetProduct(w http.ResponseWriter, r *http.Request) {
-	id := mux.Vars(r)["id"]
-	p, err := h.svc.GetPublicProduct(r.Context(), id)
+	id, err := uuid.Parse(mux.Vars(r)["id"])
 	if err != nil {
 		http.Error(w, "Not found", http.StatusNotFound)
 		return
 	}
+	p, err := h.svc.GetPublicProduct(r.Context(), id)
+	if err == marketplace.ErrProductNotFound {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	attachProductMedia(r.Context(), h.media, []*models.Product{p})
+	attachMarketPrices(h.pricing, []*models.Product{p})
+
 	w.Header().Set("Cache-Control", "public, max-age=60")
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(p)
 }
 
-func (h *PublicProductHandler) ListCategories(w http.ResponseWriter, r *http.Request) {
-	// Simple category list from products
-	rows, err := h.svc.DB().QueryContext(r.Context(), "SELECT DISTINCT category FROM public_products WHERE category IS NOT NULL ORDER BY category ASC")
+// Search handles GET /api/marketplace/search: ranked listings with facet counts
+func (h *PublicProductHandler) Search(w http.ResponseWriter, r *http.Request) {
+	filter, err := listFilterFromQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.svc.Search(r.Context(), filter)
+	if err == marketplace.ErrSearchUnavailable {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	if errors.Is(err, pagination.ErrInvalidCursor) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	defer rows.Close()
-	var cats []string
-	for rows.Next() {
-		var c string
-		if err := rows.Scan(&c); err == nil {
-			cats = append(cats, c)
-		}
+
+	attachProductMedia(r.Context(), h.media, result.Page.Items)
+	attachMarketPrices(h.pricing, result.Page.Items)
+
+	w.Header().Set("Cache-Control", "public, max-age=30")
+	pagination.RespondWith(w, result.Page.Meta(), struct {
+		pagination.Envelope
+		Facets interface{} `json:"facets"`
+		Query  interface{} `json:"query"`
+	}{pagination.NewEnvelope(result.Page), result.Facets, result.Plan})
+}
+
+func (h *PublicProductHandler) ListCategories(w http.ResponseWriter, r *http.Request) {
+	// Categories that have at least one active listing
+	cats, err := h.svc.ListCategories(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{"items": cats})
 }
 
+// listFilterFromQuery reads paging, listing and facet filters from the
+// query string; only a malformed cursor is an error
+func listFilterFromQuery(q url.Values) (marketplace.ListFilter, error) {
+	page, err := pagination.Parse(q, 0)
+	if err != nil {
+		return marketplace.ListFilter{}, err
+	}
+	radiusKm, _ := strconv.ParseFloat(q.Get("radius_km"), 64)
+	return marketplace.ListFilter{
+		Page:       page,
+		Category:   q.Get("category"),
+		MinPrice:   parseInt64Ptr(q.Get("min_price")),
+		MaxPrice:   parseInt64Ptr(q.Get("max_price")),
+		Query:      q.Get("q"),
+		SellerID:   q.Get("seller_id"),
+		Unit:       q.Get("unit"),
+		Sort:       q.Get("sort"),
+		PriceBand:  q.Get("price_band"),
+		Verified:   parseBoolPtr(q.Get("verified")),
+		Location:   q.Get("location"),
+		InStock:    parseBoolPtr(q.Get("in_stock")),
+		Lat:        parseFloat64Ptr(q.Get("lat")),
+		Lng:        parseFloat64Ptr(q.Get("lng")),
+		RadiusKm:   radiusKm,
+		DeliversTo: q.Get("delivers_to_me") == "true",
+	}, nil
+}
+
+func parseFloat64Ptr(s string) *float64 {
+	if s == "" {
+		return nil
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return nil
+	}
+	return &v
+}
+
+func parseBoolPtr(s string) *bool {
+	if s == "" {
+		return nil
+	}
+	v, err := strconv.ParseBool(s)
+	if err != nil {
+		return nil
+	}
+	return &v
+}
+
 func parseInt64Ptr(s string) *int64 {
 	if s == "" {
 		return nil
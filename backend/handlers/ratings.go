@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"time"
 
@@ -9,33 +10,65 @@ import (
 	"github.com/gorilla/mux"
 
 	"github.com/Andrew-mugwe/agroai/services/reputation"
+	"github.com/Andrew-mugwe/agroai/services/reviews"
 )
 
 // RatingHandler handles rating-related HTTP requests
 type RatingHandler struct {
 	reputationService *reputation.ReputationService
+	reviewService     *reviews.Service
+	scheduler         *reputation.Scheduler
 }
 
 // NewRatingHandler creates a new rating handler
-func NewRatingHandler(reputationService *reputation.ReputationService) *RatingHandler {
+func NewRatingHandler(reputationService *reputation.ReputationService, reviewService *reviews.Service) *RatingHandler {
 	return &RatingHandler{
 		reputationService: reputationService,
+		reviewService:     reviewService,
 	}
 }
 
+// SetScheduler routes recalculations through the event scheduler
+func (rh *RatingHandler) SetScheduler(scheduler *reputation.Scheduler) {
+	rh.scheduler = scheduler
+}
+
 // CreateRatingRequest represents the request body for creating a rating
 type CreateRatingRequest struct {
-	OrderID int    `json:"order_id" validate:"required"`
-	Rating  int    `json:"rating" validate:"required,min=1,max=5"`
-	Review  string `json:"review"`
+	OrderID RatingOrderID `json:"order_id" validate:"required"`
+	Rating  int           `json:"rating" validate:"required,min=1,max=5"`
+	Review  string        `json:"review"`
+}
+
+// RatingOrderID is the order a rating is for. Orders are identified by UUID;
+// the integer IDs older clients sent never matched an order, so they are
+// decoded but refused with an explanation.
+type RatingOrderID struct {
+	ID     uuid.UUID
+	Legacy bool
+}
+
+// UnmarshalJSON accepts a UUID string or a legacy integer ID
+func (o *RatingOrderID) UnmarshalJSON(data []byte) error {
+	var legacy int64
+	if err := json.Unmarshal(data, &legacy); err == nil {
+		*o = RatingOrderID{Legacy: true}
+		return nil
+	}
+	var id uuid.UUID
+	if err := json.Unmarshal(data, &id); err != nil {
+		return err
+	}
+	*o = RatingOrderID{ID: id}
+	return nil
 }
 
 // RatingResponse represents the response for rating operations
 type RatingResponse struct {
-	Success bool               `json:"success"`
-	Message string             `json:"message"`
-	Data    *reputation.Rating `json:"data,omitempty"`
-	Error   string             `json:"error,omitempty"`
+	Success bool            `json:"success"`
+	Message string          `json:"message"`
+	Data    *reviews.Review `json:"data,omitempty"`
+	Error   string          `json:"error,omitempty"`
 }
 
 // ReputationResponse represents the response for reputation queries
@@ -54,7 +87,8 @@ type ReputationHistoryResponse struct {
 	Error   string                         `json:"error,omitempty"`
 }
 
-// CreateRating handles POST /api/ratings
+// CreateRating handles POST /api/ratings. Ratings are stored as reviews; this
+// endpoint is kept for older clients.
 func (rh *RatingHandler) CreateRating(w http.ResponseWriter, r *http.Request) {
 	var req CreateRatingRequest
 
@@ -64,61 +98,50 @@ func (rh *RatingHandler) CreateRating(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Validate rating
-	if req.Rating < 1 || req.Rating > 5 {
-		respondWithError(w, http.StatusBadRequest, "Rating must be between 1 and 5")
+	if req.OrderID.Legacy {
+		respondWithError(w, http.StatusBadRequest, "order_id must be the order's UUID; integer order IDs are no longer supported")
 		return
 	}
-
-	// Get user ID from context (set by auth middleware)
-	userID, ok := r.Context().Value("user_id").(uuid.UUID)
-	if !ok {
-		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+	if req.OrderID.ID == uuid.Nil {
+		respondWithError(w, http.StatusBadRequest, "order_id is required")
 		return
 	}
 
-	// Validate order ownership and status
-	sellerID, orderStatus, err := rh.validateOrderForRating(req.OrderID, userID)
-	if err != nil {
-		respondWithError(w, http.StatusBadRequest, err.Error())
-		return
-	}
-
-	if orderStatus != "completed" {
-		respondWithError(w, http.StatusBadRequest, "Can only rate completed orders")
-		return
-	}
-
-	// Check if rating already exists
-	exists, err := rh.ratingExists(req.OrderID, userID)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Failed to check existing rating")
+	// Validate rating
+	if req.Rating < 1 || req.Rating > 5 {
+		respondWithError(w, http.StatusBadRequest, "Rating must be between 1 and 5")
 		return
 	}
 
-	if exists {
-		respondWithError(w, http.StatusConflict, "Rating already exists for this order")
+	userID, ok := marketplaceUser(r)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
 		return
 	}
 
-	// Create rating
-	rating, err := rh.createRating(req.OrderID, userID, sellerID, req.Rating, req.Review)
+	// The review service checks order ownership and status and queues the reputation update
+	review, err := rh.reviewService.Create(r.Context(), userID, &reviews.CreateReviewRequest{
+		OrderID: req.OrderID.ID,
+		Rating:  req.Rating,
+		Comment: req.Review,
+	})
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Failed to create rating")
+		switch {
+		case errors.Is(err, reviews.ErrAlreadyReviewed):
+			respondWithError(w, http.StatusConflict, "Rating already exists for this order")
+		case errors.Is(err, reviews.ErrNotEligible):
+			respondWithError(w, http.StatusBadRequest, err.Error())
+		default:
+			respondWithError(w, http.StatusInternalServerError, "Failed to create rating")
+		}
 		return
 	}
 
-	// Recalculate seller reputation (this happens automatically via trigger, but we can also do it manually)
-	if err := rh.reputationService.RecalculateReputation(sellerID); err != nil {
-		// Log error but don't fail the rating creation
-		// In production, you might want to queue this for background processing
-	}
-
 	// Return success response
 	response := RatingResponse{
 		Success: true,
 		Message: "Rating created successfully",
-		Data:    rating,
+		Data:    review,
 	}
 
 	respondWithJSON(w, http.StatusCreated, response)
@@ -161,8 +184,7 @@ func (rh *RatingHandler) GetReputationHistory(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	// Get current user ID from context
-	currentUserID, ok := r.Context().Value("user_id").(uuid.UUID)
+	currentUserID, ok := marketplaceUser(r)
 	if !ok {
 		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
 		return
@@ -254,6 +276,22 @@ func (rh *RatingHandler) RecalculateReputation(w http.ResponseWriter, r *http.Re
 	respondWithJSON(w, http.StatusOK, response)
 }
 
+// GetSchedulerStats handles GET /api/admin/reputation/scheduler
+func (rh *RatingHandler) GetSchedulerStats(w http.ResponseWriter, r *http.Request) {
+	if rh.scheduler == nil {
+		respondWithError(w, http.StatusServiceUnavailable, "Reputation scheduler is not running")
+		return
+	}
+
+	response := map[string]interface{}{
+		"success": true,
+		"message": "Reputation scheduler stats retrieved successfully",
+		"data":    rh.scheduler.GetSchedulerStats(),
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
 // HealthCheck handles GET /api/reputation/health
 func (rh *RatingHandler) HealthCheck(w http.ResponseWriter, r *http.Request) {
 	err := rh.reputationService.HealthCheck()
@@ -272,35 +310,117 @@ func (rh *RatingHandler) HealthCheck(w http.ResponseWriter, r *http.Request) {
 	respondWithJSON(w, http.StatusOK, response)
 }
 
-// Helper methods
+// ListReputationModels handles GET /api/admin/reputation/models
+func (rh *RatingHandler) ListReputationModels(w http.ResponseWriter, r *http.Request) {
+	engine := rh.reputationService.Engine()
 
-// validateOrderForRating validates that the user can rate the order
-func (rh *RatingHandler) validateOrderForRating(orderID int, userID uuid.UUID) (uuid.UUID, string, error) {
-	// This would typically query your orders table
-	// For demo purposes, return mock data
-	return uuid.MustParse("890e1234-e89b-12d3-a456-426614174003"), "completed", nil
+	models, err := engine.ListModels(r.Context())
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to list reputation models")
+		return
+	}
+
+	active, err := engine.ActiveModel(r.Context())
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to load active reputation model")
+		return
+	}
+
+	response := map[string]interface{}{
+		"success": true,
+		"message": "Reputation models retrieved successfully",
+		"data":    models,
+		"active":  active,
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
 }
 
-// ratingExists checks if a rating already exists for the order and user
-func (rh *RatingHandler) ratingExists(orderID int, userID uuid.UUID) (bool, error) {
-	// This would query your ratings table
-	// For demo purposes, return false
-	return false, nil
+// CreateReputationModel handles POST /api/admin/reputation/models
+func (rh *RatingHandler) CreateReputationModel(w http.ResponseWriter, r *http.Request) {
+	var model reputation.Model
+	if err := json.NewDecoder(r.Body).Decode(&model); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := model.Validate(); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	saved, err := rh.reputationService.Engine().SaveModel(r.Context(), model)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to save reputation model")
+		return
+	}
+
+	response := map[string]interface{}{
+		"success": true,
+		"message": "Reputation model saved successfully",
+		"data":    saved,
+	}
+
+	respondWithJSON(w, http.StatusCreated, response)
 }
 
-// createRating creates a new rating in the database
-func (rh *RatingHandler) createRating(orderID int, reviewerID, sellerID uuid.UUID, rating int, review string) (*reputation.Rating, error) {
-	// This would insert into your ratings table
-	// For demo purposes, return mock data
-	return &reputation.Rating{
-		ID:         1,
-		OrderID:    orderID,
-		ReviewerID: reviewerID,
-		SellerID:   sellerID,
-		Rating:     rating,
-		Review:     review,
-		CreatedAt:  time.Now(),
-	}, nil
+// DryRunReputationModel handles POST /api/admin/reputation/models/dry-run
+// The body is either a full candidate model or {"version": "..."} naming a stored one.
+func (rh *RatingHandler) DryRunReputationModel(w http.ResponseWriter, r *http.Request) {
+	var candidate reputation.Model
+	if err := json.NewDecoder(r.Body).Decode(&candidate); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	engine := rh.reputationService.Engine()
+
+	// Weights omitted entirely means "use the stored model with this version"
+	if candidate.Weights == (reputation.Weights{}) {
+		stored, err := engine.GetModel(r.Context(), candidate.Version)
+		if err != nil {
+			respondWithError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		candidate = stored
+	}
+
+	if err := candidate.Validate(); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	report, err := engine.DryRun(r.Context(), candidate)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to run reputation dry-run")
+		return
+	}
+
+	response := map[string]interface{}{
+		"success": true,
+		"message": "Reputation dry-run completed successfully",
+		"data":    report,
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+// ActivateReputationModel handles POST /api/admin/reputation/models/{version}/activate
+func (rh *RatingHandler) ActivateReputationModel(w http.ResponseWriter, r *http.Request) {
+	version := mux.Vars(r)["version"]
+
+	if err := rh.reputationService.Engine().ActivateModel(r.Context(), version); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	response := map[string]interface{}{
+		"success": true,
+		"message": "Reputation model activated successfully",
+		"version": version,
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
 }
 
 // Helper functions
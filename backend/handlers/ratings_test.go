@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestRatingOrderIDUnmarshal(t *testing.T) {
+	var req CreateRatingRequest
+	if err := json.Unmarshal([]byte(`{"order_id":"0b6f6c52-4d8e-4a0b-9c55-2f1f0c8d3e7a","rating":5}`), &req); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if req.OrderID.Legacy || req.OrderID.ID.String() != "0b6f6c52-4d8e-4a0b-9c55-2f1f0c8d3e7a" {
+		t.Fatalf("expected UUID order ID, got %+v", req.OrderID)
+	}
+
+	// Older clients sent integer IDs
+	req = CreateRatingRequest{}
+	if err := json.Unmarshal([]byte(`{"order_id":42,"rating":5}`), &req); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !req.OrderID.Legacy {
+		t.Fatalf("expected legacy order ID, got %+v", req.OrderID)
+	}
+
+	if err := json.Unmarshal([]byte(`{"order_id":"not-an-order"}`), &req); err == nil {
+		t.Fatalf("expected error for invalid order ID")
+	}
+}
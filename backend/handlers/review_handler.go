@@ -0,0 +1,256 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/Andrew-mugwe/agroai/pagination"
+	"github.com/Andrew-mugwe/agroai/services/reviews"
+	"github.com/Andrew-mugwe/agroai/utils"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// ReviewHandler handles review, reply, report and moderation HTTP requests
+type ReviewHandler struct {
+	reviewService *reviews.Service
+}
+
+// NewReviewHandler creates a new review handler
+func NewReviewHandler(reviewService *reviews.Service) *ReviewHandler {
+	return &ReviewHandler{
+		reviewService: reviewService,
+	}
+}
+
+// CreateReview handles POST /api/reviews and POST /api/sellers/:id/review
+func (h *ReviewHandler) CreateReview(w http.ResponseWriter, r *http.Request) {
+	userID, err := utils.GetUserIDFromContext(r)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req reviews.CreateReviewRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	// The seller-scoped route must name the order's seller
+	if id, ok := mux.Vars(r)["id"]; ok {
+		sellerID, err := uuid.Parse(id)
+		if err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid seller ID")
+			return
+		}
+		req.SellerID = &sellerID
+	}
+
+	if req.Rating < 1 || req.Rating > 5 {
+		utils.RespondWithValidationError(w, "Rating must be between 1 and 5")
+		return
+	}
+	if req.OrderID == uuid.Nil {
+		utils.RespondWithValidationError(w, "Order ID is required")
+		return
+	}
+
+	review, err := h.reviewService.Create(r.Context(), userID, &req)
+	if err != nil {
+		respondWithReviewError(w, err)
+		return
+	}
+
+	message := "Review created successfully"
+	if review.Status == reviews.StatusHeld {
+		message = "Review submitted and pending moderation"
+	}
+
+	response := map[string]interface{}{
+		"success": true,
+		"message": message,
+		"data":    review,
+	}
+
+	utils.RespondWithJSON(w, http.StatusCreated, response)
+}
+
+// GetSellerReviews handles GET /api/sellers/:id/reviews
+func (h *ReviewHandler) GetSellerReviews(w http.ResponseWriter, r *http.Request) {
+	sellerID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid seller ID")
+		return
+	}
+
+	page, err := pagination.FromRequest(r)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	list, err := h.reviewService.ListForSeller(r.Context(), sellerID, page)
+	if errors.Is(err, pagination.ErrInvalidCursor) {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to get reviews")
+		return
+	}
+
+	pagination.Respond(w, list)
+}
+
+// ReplyToReview handles POST /api/reviews/:id/reply (reviewed seller only)
+func (h *ReviewHandler) ReplyToReview(w http.ResponseWriter, r *http.Request) {
+	userID, err := utils.GetUserIDFromContext(r)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	reviewID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid review ID")
+		return
+	}
+
+	var req struct {
+		Body string `json:"body"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	reply, err := h.reviewService.Reply(r.Context(), userID, reviewID, req.Body)
+	if err != nil {
+		respondWithReviewError(w, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"success": true,
+		"message": "Reply posted successfully",
+		"data":    reply,
+	}
+
+	utils.RespondWithJSON(w, http.StatusCreated, response)
+}
+
+// ReportReview handles POST /api/reviews/:id/report
+func (h *ReviewHandler) ReportReview(w http.ResponseWriter, r *http.Request) {
+	userID, err := utils.GetUserIDFromContext(r)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	reviewID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid review ID")
+		return
+	}
+
+	var req reviews.ReportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := h.reviewService.Report(r.Context(), userID, reviewID, &req); err != nil {
+		respondWithReviewError(w, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"success": true,
+		"message": "Review reported successfully",
+	}
+
+	utils.RespondWithJSON(w, http.StatusCreated, response)
+}
+
+// GetModerationQueue handles GET /api/admin/reviews/moderation (Admin only)
+func (h *ReviewHandler) GetModerationQueue(w http.ResponseWriter, r *http.Request) {
+	page, err := pagination.FromRequest(r)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	items, err := h.reviewService.ModerationQueue(r.Context(), page)
+	if errors.Is(err, pagination.ErrInvalidCursor) {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to get moderation queue")
+		return
+	}
+
+	pagination.Respond(w, items)
+}
+
+// ModerateReview handles POST /api/admin/reviews/:id/moderate (Admin only)
+func (h *ReviewHandler) ModerateReview(w http.ResponseWriter, r *http.Request) {
+	moderatorID, err := utils.GetUserIDFromContext(r)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	reviewID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid review ID")
+		return
+	}
+
+	var req struct {
+		Action string `json:"action"`
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := h.reviewService.Moderate(r.Context(), reviewID, moderatorID, req.Action, req.Reason); err != nil {
+		respondWithReviewError(w, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"success": true,
+		"message": "Review moderated successfully",
+		"action":  req.Action,
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, response)
+}
+
+// respondWithReviewError maps review service errors to HTTP status codes
+func respondWithReviewError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, reviews.ErrReviewNotFound):
+		utils.RespondWithError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, reviews.ErrNotReviewSeller):
+		utils.RespondWithError(w, http.StatusForbidden, err.Error())
+	case errors.Is(err, reviews.ErrAlreadyReviewed),
+		errors.Is(err, reviews.ErrReplyExists),
+		errors.Is(err, reviews.ErrAlreadyReported):
+		utils.RespondWithError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, reviews.ErrNotEligible),
+		errors.Is(err, reviews.ErrInvalidReason),
+		errors.Is(err, reviews.ErrReasonRequired),
+		errors.Is(err, reviews.ErrInvalidAction),
+		errors.Is(err, reviews.ErrEmptyReply),
+		errors.Is(err, reviews.ErrReviewNotVisible):
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+	default:
+		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+	}
+}
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/Andrew-mugwe/agroai/services/search"
+	"github.com/Andrew-mugwe/agroai/utils"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// SearchHandler manages the search synonym and translation dictionary
+type SearchHandler struct {
+	search *search.Service
+}
+
+func NewSearchHandler(svc *search.Service) *SearchHandler {
+	return &SearchHandler{search: svc}
+}
+
+// ListTerms handles GET /api/admin/search/terms?locale=sw
+func (h *SearchHandler) ListTerms(w http.ResponseWriter, r *http.Request) {
+	terms, err := h.search.Store().List(r.Context(), r.URL.Query().Get("locale"))
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to list search terms")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, terms)
+}
+
+// CreateTerm handles POST /api/admin/search/terms
+func (h *SearchHandler) CreateTerm(w http.ResponseWriter, r *http.Request) {
+	var term search.Term
+	if err := json.NewDecoder(r.Body).Decode(&term); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if err := h.search.Store().Create(r.Context(), &term); err != nil {
+		respondWithSearchTermError(w, err, "Failed to create search term")
+		return
+	}
+	h.reload(r)
+
+	utils.RespondWithJSON(w, http.StatusCreated, term)
+}
+
+// DeleteTerm handles DELETE /api/admin/search/terms/{id}
+func (h *SearchHandler) DeleteTerm(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid term ID")
+		return
+	}
+
+	if err := h.search.Store().Delete(r.Context(), id); err != nil {
+		respondWithSearchTermError(w, err, "Failed to delete search term")
+		return
+	}
+	h.reload(r)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AnalyzeQuery handles GET /api/admin/search/analyze?q=... and shows how a
+// query is expanded, to check dictionary changes
+func (h *SearchHandler) AnalyzeQuery(w http.ResponseWriter, r *http.Request) {
+	utils.RespondWithJSON(w, http.StatusOK, h.search.Dictionary().Analyze(r.URL.Query().Get("q")))
+}
+
+// reload refreshes the live dictionary. The stored change has already
+// succeeded, so a failed reload is logged rather than reported.
+func (h *SearchHandler) reload(r *http.Request) {
+	if err := h.search.ReloadDictionary(r.Context()); err != nil {
+		log.Printf("search: failed to reload dictionary: %v", err)
+	}
+}
+
+func respondWithSearchTermError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, search.ErrInvalidTerm):
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, search.ErrDuplicateTerm):
+		utils.RespondWithError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, search.ErrTermNotFound):
+		utils.RespondWithError(w, http.StatusNotFound, err.Error())
+	default:
+		utils.RespondWithError(w, http.StatusInternalServerError, fallback)
+	}
+}
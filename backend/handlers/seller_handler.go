@@ -2,9 +2,10 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
-	"strconv"
 
+	"github.com/Andrew-mugwe/agroai/models"
 	"github.com/Andrew-mugwe/agroai/services/sellers"
 	"github.com/Andrew-mugwe/agroai/utils"
 	"github.com/google/uuid"
@@ -48,8 +49,8 @@ func (h *SellerHandler) GetSellerProfile(w http.ResponseWriter, r *http.Request)
 	utils.RespondWithJSON(w, http.StatusOK, response)
 }
 
-// CreateReview handles POST /api/sellers/:id/review
-func (h *SellerHandler) CreateReview(w http.ResponseWriter, r *http.Request) {
+// UpdateSellerProfile handles PATCH /api/sellers/:id
+func (h *SellerHandler) UpdateSellerProfile(w http.ResponseWriter, r *http.Request) {
 	// Get user ID from context
 	userID, err := utils.GetUserIDFromContext(r)
 	if err != nil {
@@ -64,41 +65,42 @@ func (h *SellerHandler) CreateReview(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Verify user owns this seller profile
+	seller, err := h.sellerService.GetSellerByUserID(r.Context(), userID)
+	if err != nil || seller.ID != sellerID {
+		utils.RespondWithError(w, http.StatusForbidden, "Access denied")
+		return
+	}
+
 	// Parse request
-	var req sellers.CreateReviewRequest
+	var req sellers.UpdateSellerRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 
-	// Validate request
-	if req.Rating < 1 || req.Rating > 5 {
-		utils.RespondWithValidationError(w, "Rating must be between 1 and 5")
-		return
-	}
-	if req.OrderID == uuid.Nil {
-		utils.RespondWithValidationError(w, "Order ID is required")
+	// Update seller profile
+	err = h.sellerService.CreateOrUpdateSellerProfile(r.Context(), userID, &req)
+	if errors.Is(err, models.ErrInvalidLocation) {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
 		return
 	}
-
-	// Create review
-	err = h.sellerService.CreateReview(r.Context(), userID, sellerID, &req)
 	if err != nil {
-		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to update seller profile")
 		return
 	}
 
 	// Return response
 	response := map[string]interface{}{
 		"success": true,
-		"message": "Review created successfully",
+		"message": "Seller profile updated successfully",
 	}
 
-	utils.RespondWithJSON(w, http.StatusCreated, response)
+	utils.RespondWithJSON(w, http.StatusOK, response)
 }
 
-// GetSellerReviews handles GET /api/sellers/:id/reviews
-func (h *SellerHandler) GetSellerReviews(w http.ResponseWriter, r *http.Request) {
+// RecalculateReputation handles POST /api/admin/sellers/:id/recalculate-reputation (Admin only)
+func (h *SellerHandler) RecalculateReputation(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	sellerID, err := uuid.Parse(vars["id"])
 	if err != nil {
@@ -106,146 +108,91 @@ func (h *SellerHandler) GetSellerReviews(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// Parse pagination parameters
-	limit := 20
-	offset := 0
-	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
-		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 && l <= 100 {
-			limit = l
-		}
-	}
-	if offsetStr := r.URL.Query().Get("page"); offsetStr != "" {
-		if page, err := strconv.Atoi(offsetStr); err == nil && page > 0 {
-			offset = (page - 1) * limit
-		}
-	}
-
-	// Get reviews
-	reviews, err := h.sellerService.GetSellerReviews(r.Context(), sellerID, limit, offset)
+	// Recalculate reputation
+	err = h.sellerService.RecalculateReputation(r.Context(), sellerID)
 	if err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to get reviews")
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to recalculate reputation")
 		return
 	}
 
 	// Return response
 	response := map[string]interface{}{
 		"success": true,
-		"data":    reviews,
-		"pagination": map[string]interface{}{
-			"limit":  limit,
-			"offset": offset,
-		},
+		"message": "Reputation recalculated successfully",
 	}
 
 	utils.RespondWithJSON(w, http.StatusOK, response)
 }
 
-// UpdateSellerProfile handles PATCH /api/sellers/:id
-func (h *SellerHandler) UpdateSellerProfile(w http.ResponseWriter, r *http.Request) {
-	// Get user ID from context
+// ListServiceAreas handles GET /api/seller/service-areas
+func (h *SellerHandler) ListServiceAreas(w http.ResponseWriter, r *http.Request) {
 	userID, err := utils.GetUserIDFromContext(r)
 	if err != nil {
 		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
-	vars := mux.Vars(r)
-	sellerID, err := uuid.Parse(vars["id"])
+	areas, err := h.sellerService.ListServiceAreas(r.Context(), userID)
 	if err != nil {
-		utils.RespondWithError(w, http.StatusBadRequest, "Invalid seller ID")
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to list service areas")
 		return
 	}
 
-	// Verify user owns this seller profile
-	seller, err := h.sellerService.GetSellerByUserID(r.Context(), userID)
-	if err != nil || seller.ID != sellerID {
-		utils.RespondWithError(w, http.StatusForbidden, "Access denied")
-		return
-	}
-
-	// Parse request
-	var req sellers.UpdateSellerRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request body")
-		return
-	}
-
-	// Update seller profile
-	err = h.sellerService.CreateOrUpdateSellerProfile(r.Context(), userID, &req)
-	if err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to update seller profile")
-		return
-	}
-
-	// Return response
-	response := map[string]interface{}{
-		"success": true,
-		"message": "Seller profile updated successfully",
-	}
-
-	utils.RespondWithJSON(w, http.StatusOK, response)
+	utils.RespondWithJSON(w, http.StatusOK, areas)
 }
 
-// VerifySeller handles PATCH /api/admin/sellers/:id/verify (Admin only)
-func (h *SellerHandler) VerifySeller(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	sellerID, err := uuid.Parse(vars["id"])
+// AddServiceArea handles POST /api/seller/service-areas with either
+// {"kind": "radius", "center": {...}, "radius_km": 25} or
+// {"kind": "polygon", "polygon": [{...}, ...]}
+func (h *SellerHandler) AddServiceArea(w http.ResponseWriter, r *http.Request) {
+	userID, err := utils.GetUserIDFromContext(r)
 	if err != nil {
-		utils.RespondWithError(w, http.StatusBadRequest, "Invalid seller ID")
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
-	// Parse request
-	var req struct {
-		Verified bool `json:"verified"`
-	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	var area models.ServiceArea
+	if err := json.NewDecoder(r.Body).Decode(&area); err != nil {
 		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 
-	// Update verification status
-	err = h.sellerService.VerifySeller(r.Context(), sellerID, req.Verified)
-	if err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to update seller verification")
+	err = h.sellerService.AddServiceArea(r.Context(), userID, &area)
+	switch {
+	case errors.Is(err, models.ErrInvalidLocation), errors.Is(err, sellers.ErrTooManyServiceAreas):
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	case err != nil:
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to add service area")
 		return
 	}
 
-	// Return response
-	message := "Seller verification removed"
-	if req.Verified {
-		message = "Seller verified successfully"
-	}
-
-	response := map[string]interface{}{
-		"success": true,
-		"message": message,
-	}
-
-	utils.RespondWithJSON(w, http.StatusOK, response)
+	utils.RespondWithJSON(w, http.StatusCreated, area)
 }
 
-// RecalculateReputation handles POST /api/admin/sellers/:id/recalculate-reputation (Admin only)
-func (h *SellerHandler) RecalculateReputation(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	sellerID, err := uuid.Parse(vars["id"])
+// DeleteServiceArea handles DELETE /api/seller/service-areas/{id}
+func (h *SellerHandler) DeleteServiceArea(w http.ResponseWriter, r *http.Request) {
+	userID, err := utils.GetUserIDFromContext(r)
 	if err != nil {
-		utils.RespondWithError(w, http.StatusBadRequest, "Invalid seller ID")
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
-	// Recalculate reputation
-	err = h.sellerService.RecalculateReputation(r.Context(), sellerID)
+	areaID, err := uuid.Parse(mux.Vars(r)["id"])
 	if err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to recalculate reputation")
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid service area ID")
 		return
 	}
 
-	// Return response
-	response := map[string]interface{}{
-		"success": true,
-		"message": "Reputation recalculated successfully",
+	err = h.sellerService.DeleteServiceArea(r.Context(), userID, areaID)
+	switch {
+	case errors.Is(err, sellers.ErrServiceAreaNotFound):
+		utils.RespondWithError(w, http.StatusNotFound, err.Error())
+		return
+	case err != nil:
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to delete service area")
+		return
 	}
 
-	utils.RespondWithJSON(w, http.StatusOK, response)
+	w.WriteHeader(http.StatusNoContent)
 }
@@ -2,22 +2,28 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/Andrew-mugwe/agroai/middleware"
+	"github.com/Andrew-mugwe/agroai/pagination"
 	"github.com/Andrew-mugwe/agroai/services"
+	"github.com/Andrew-mugwe/agroai/services/media"
 )
 
 type TraderHandler struct {
 	traderService *services.TraderService
 	cacheService  *services.CacheService
+	mediaService  *media.Service
 }
 
-func NewTraderHandler(traderService *services.TraderService, cacheService *services.CacheService) *TraderHandler {
+func NewTraderHandler(traderService *services.TraderService, cacheService *services.CacheService, mediaService *media.Service) *TraderHandler {
 	return &TraderHandler{
 		traderService: traderService,
 		cacheService:  cacheService,
+		mediaService:  mediaService,
 	}
 }
 
@@ -33,6 +39,11 @@ func (h *TraderHandler) GetProducts(w http.ResponseWriter, r *http.Request) {
 	// Get query parameters
 	category := r.URL.Query().Get("category")
 	status := r.URL.Query().Get("status")
+	page, err := pagination.FromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	// Create cache key with query parameters
 	cacheKey := h.cacheService.GetProductsKey(claims.UserID)
@@ -42,34 +53,43 @@ func (h *TraderHandler) GetProducts(w http.ResponseWriter, r *http.Request) {
 	if status != "" {
 		cacheKey += ":status:" + status
 	}
+	cacheKey += ":limit:" + strconv.Itoa(page.Limit)
+	if page.Cursor != nil {
+		cacheKey += ":cursor:" + page.Cursor.Encode()
+	}
 
 	// Try to get from cache first
-	var products interface{}
-	err := h.cacheService.GetCache(cacheKey, &products)
+	var cached pagination.Envelope
+	err = h.cacheService.GetCache(cacheKey, &cached)
 	if err == nil {
 		// Cache hit - return cached data
-		w.Header().Set("Content-Type", "application/json")
 		w.Header().Set("X-Cache", "HIT")
-		json.NewEncoder(w).Encode(products)
+		pagination.RespondWith(w, cached.Pagination, cached)
 		return
 	}
 
 	// Cache miss - get fresh data from service
-	products, err = h.traderService.GetProducts(claims.UserID, category, status)
+	products, err := h.traderService.GetProducts(r.Context(), claims.UserID, category, status, page)
+	if errors.Is(err, pagination.ErrInvalidCursor) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	// Store in cache for 10 minutes
+	attachProductMedia(r.Context(), h.mediaService, products.Items)
+
+	// Store in cache for 10 minutes, well within the lifetime of the
+	// signed image URLs
 	cacheTTL := 10 * time.Minute
-	if err := h.cacheService.SetCache(cacheKey, products, cacheTTL); err != nil {
+	if err := h.cacheService.SetCache(cacheKey, pagination.NewEnvelope(products), cacheTTL); err != nil {
 		// Log cache error but don't fail the request
 	}
 
-	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("X-Cache", "MISS")
-	json.NewEncoder(w).Encode(products)
+	pagination.Respond(w, products)
 }
 
 // GetOrders returns a trader's orders
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+
+	"github.com/Andrew-mugwe/agroai/middleware"
+	"github.com/Andrew-mugwe/agroai/services/ussd"
+	"github.com/Andrew-mugwe/agroai/utils"
+)
+
+// USSDHandler answers the USSD gateway's session callbacks
+type USSDHandler struct {
+	ussdService *ussd.Service
+	token       string
+}
+
+// NewUSSDHandler creates a new USSD handler. The gateway must send token as
+// the token query parameter; with no token every callback is refused.
+func NewUSSDHandler(ussdService *ussd.Service, token string) *USSDHandler {
+	return &USSDHandler{ussdService: ussdService, token: token}
+}
+
+// Callback handles POST /api/ussd/callback
+//
+// The gateway posts sessionId, phoneNumber and text as a form and shows the
+// plain text reply, which starts with CON to continue or END to close.
+func (h *USSDHandler) Callback(w http.ResponseWriter, r *http.Request) {
+	if h.token == "" || subtle.ConstantTimeCompare([]byte(r.URL.Query().Get("token")), []byte(h.token)) != 1 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	req := ussd.Request{
+		SessionID: r.PostForm.Get("sessionId"),
+		Phone:     r.PostForm.Get("phoneNumber"),
+		Text:      r.PostForm.Get("text"),
+	}
+	if req.SessionID == "" || req.Phone == "" {
+		http.Error(w, "sessionId and phoneNumber are required", http.StatusBadRequest)
+		return
+	}
+
+	resp := h.ussdService.Handle(r.Context(), req)
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(resp.String()))
+}
+
+// SetPIN handles PUT /api/ussd/pin
+//
+// Sets the 4-digit PIN the user enters over USSD to confirm deliveries.
+// Setting it again unlocks a PIN locked by wrong attempts.
+func (h *USSDHandler) SetPIN(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value("user").(*middleware.Claims)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	userID, err := uuid.Parse(claims.UserID)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req struct {
+		PIN string `json:"pin"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if err := h.ussdService.SetPIN(r.Context(), userID, req.PIN); err != nil {
+		if errors.Is(err, ussd.ErrInvalidPIN) {
+			utils.RespondWithValidationError(w, err.Error())
+			return
+		}
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to set PIN")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,258 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/Andrew-mugwe/agroai/models"
+	"github.com/Andrew-mugwe/agroai/pagination"
+	"github.com/Andrew-mugwe/agroai/services/marketplace"
+	"github.com/Andrew-mugwe/agroai/services/media"
+	"github.com/Andrew-mugwe/agroai/services/wishlist"
+	"github.com/Andrew-mugwe/agroai/utils"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// WishlistHandler serves buyers' wishlists, saved searches and alert
+// preferences
+type WishlistHandler struct {
+	wishlistService *wishlist.Service
+	media           *media.Service
+}
+
+// NewWishlistHandler creates a new wishlist handler
+func NewWishlistHandler(wishlistService *wishlist.Service, mediaService *media.Service) *WishlistHandler {
+	return &WishlistHandler{wishlistService: wishlistService, media: mediaService}
+}
+
+// GetWishlist handles GET /api/marketplace/wishlist
+func (h *WishlistHandler) GetWishlist(w http.ResponseWriter, r *http.Request) {
+	userID, err := utils.GetUserIDFromContext(r)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	page, err := pagination.FromRequest(r)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	items, err := h.wishlistService.Wishlist(r.Context(), userID, page)
+	if errors.Is(err, pagination.ErrInvalidCursor) {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to get wishlist")
+		return
+	}
+
+	var products []*models.Product
+	for _, item := range items.Items {
+		if item.Product != nil {
+			products = append(products, item.Product)
+		}
+	}
+	attachProductMedia(r.Context(), h.media, products)
+
+	pagination.Respond(w, items)
+}
+
+// AddToWishlist handles POST /api/marketplace/wishlist
+func (h *WishlistHandler) AddToWishlist(w http.ResponseWriter, r *http.Request) {
+	userID, err := utils.GetUserIDFromContext(r)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req struct {
+		ProductID uuid.UUID `json:"product_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ProductID == uuid.Nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "A product_id is required")
+		return
+	}
+
+	item, err := h.wishlistService.AddToWishlist(r.Context(), userID, req.ProductID)
+	if errors.Is(err, marketplace.ErrProductNotFound) {
+		utils.RespondWithError(w, http.StatusNotFound, "Product not found")
+		return
+	}
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to add to wishlist")
+		return
+	}
+	attachProductMedia(r.Context(), h.media, []*models.Product{item.Product})
+
+	utils.RespondWithJSON(w, http.StatusCreated, item)
+}
+
+// RemoveFromWishlist handles DELETE /api/marketplace/wishlist/{productId}
+func (h *WishlistHandler) RemoveFromWishlist(w http.ResponseWriter, r *http.Request) {
+	userID, err := utils.GetUserIDFromContext(r)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	productID, err := uuid.Parse(mux.Vars(r)["productId"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid product ID")
+		return
+	}
+
+	if err := h.wishlistService.RemoveFromWishlist(r.Context(), userID, productID); err != nil {
+		respondWithWishlistError(w, err, "Failed to remove from wishlist")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListSavedSearches handles GET /api/marketplace/saved-searches
+func (h *WishlistHandler) ListSavedSearches(w http.ResponseWriter, r *http.Request) {
+	userID, err := utils.GetUserIDFromContext(r)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	searches, err := h.wishlistService.SavedSearches(r.Context(), userID)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to get saved searches")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{"items": searches})
+}
+
+// CreateSavedSearch handles POST /api/marketplace/saved-searches
+//
+// The filter uses the marketplace list query parameter names, e.g.
+// {"name": "Maize seed", "filter": {"q": "maize", "category": "seeds"}}
+func (h *WishlistHandler) CreateSavedSearch(w http.ResponseWriter, r *http.Request) {
+	userID, err := utils.GetUserIDFromContext(r)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req wishlist.SavedSearchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	search, err := h.wishlistService.CreateSavedSearch(r.Context(), userID, &req)
+	if err != nil {
+		respondWithWishlistError(w, err, "Failed to save search")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusCreated, search)
+}
+
+// UpdateSavedSearch handles PUT /api/marketplace/saved-searches/{id}
+func (h *WishlistHandler) UpdateSavedSearch(w http.ResponseWriter, r *http.Request) {
+	userID, err := utils.GetUserIDFromContext(r)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid saved search ID")
+		return
+	}
+
+	var req wishlist.SavedSearchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	search, err := h.wishlistService.UpdateSavedSearch(r.Context(), userID, id, &req)
+	if err != nil {
+		respondWithWishlistError(w, err, "Failed to update saved search")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, search)
+}
+
+// DeleteSavedSearch handles DELETE /api/marketplace/saved-searches/{id}
+func (h *WishlistHandler) DeleteSavedSearch(w http.ResponseWriter, r *http.Request) {
+	userID, err := utils.GetUserIDFromContext(r)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid saved search ID")
+		return
+	}
+
+	if err := h.wishlistService.DeleteSavedSearch(r.Context(), userID, id); err != nil {
+		respondWithWishlistError(w, err, "Failed to delete saved search")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetAlertPreferences handles GET /api/marketplace/alerts/preferences
+func (h *WishlistHandler) GetAlertPreferences(w http.ResponseWriter, r *http.Request) {
+	userID, err := utils.GetUserIDFromContext(r)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	prefs, err := h.wishlistService.Preferences(r.Context(), userID)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to get alert preferences")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, prefs)
+}
+
+// SetAlertPreferences handles PUT /api/marketplace/alerts/preferences
+//
+// Frequency is instant, daily or weekly for digests, or off
+func (h *WishlistHandler) SetAlertPreferences(w http.ResponseWriter, r *http.Request) {
+	userID, err := utils.GetUserIDFromContext(r)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req models.WatchPreferencesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	prefs, err := h.wishlistService.SetPreferences(r.Context(), userID, req.Frequency)
+	if err != nil {
+		respondWithWishlistError(w, err, "Failed to set alert preferences")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, prefs)
+}
+
+// respondWithWishlistError maps wishlist errors to HTTP status codes
+func respondWithWishlistError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, wishlist.ErrItemNotFound), errors.Is(err, wishlist.ErrSearchNotFound):
+		utils.RespondWithError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, wishlist.ErrTooManySearches):
+		utils.RespondWithError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, wishlist.ErrInvalidSearch), errors.Is(err, wishlist.ErrInvalidPreferences):
+		utils.RespondWithValidationError(w, err.Error())
+	default:
+		utils.RespondWithError(w, http.StatusInternalServerError, fallback)
+	}
+}
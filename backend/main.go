@@ -5,7 +5,6 @@ import (
 	"log"
 	"net/http"
 	"os"
-	"strings"
 
 	"github.com/gorilla/mux"
 	"github.com/joho/godotenv"
@@ -37,23 +36,13 @@ func main() {
 	routes.InitRoutes(router, sqlDB)
 
 	// Configure CORS
-	allowedOrigins := []string{
-		"http://localhost:3000",  // Vite dev server
-		"http://localhost:3001",  // Alternative dev port
-		"http://127.0.0.1:3000",  // Alternative localhost
-		"http://127.0.0.1:3001",  // Alternative localhost
-	}
-
-	// Add production origins from environment
-	if prodOrigins := os.Getenv("CORS_ORIGINS"); prodOrigins != "" {
-		allowedOrigins = append(allowedOrigins, strings.Split(prodOrigins, ",")...)
-	}
+	allowedOrigins := config.LoadConfig().AllowedOrigins
 
 	c := cors.New(cors.Options{
 		AllowedOrigins:     allowedOrigins,
 		AllowedMethods:     []string{"GET", "POST", "PUT", "DELETE", "PATCH", "OPTIONS"},
 		AllowedHeaders:     []string{"Authorization", "Content-Type", "X-Requested-With", "Accept", "Origin"},
-		ExposedHeaders:     []string{"X-Total-Count", "X-Page-Count"},
+		ExposedHeaders:     []string{"X-Total-Count", "X-Page-Count", "X-Next-Cursor"},
 		AllowCredentials:   true,
 		AllowPrivateNetwork: true,
 		MaxAge:            86400, // 24 hours
@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// AttachmentKind says what a message attachment holds
+type AttachmentKind string
+
+const (
+	AttachmentImage    AttachmentKind = "image"
+	AttachmentDocument AttachmentKind = "document"
+	AttachmentVoice    AttachmentKind = "voice"
+)
+
+// Attachment is a file uploaded to a conversation thread and referenced by
+// ID from one of its messages. Only the thread's participants can read it;
+// URLs are signed when it is read and expire.
+type Attachment struct {
+	ID          uuid.UUID      `json:"id" db:"id"`
+	OwnerID     uuid.UUID      `json:"owner_id" db:"owner_id"`
+	ThreadID    int            `json:"thread_id" db:"thread_id"`
+	Kind        AttachmentKind `json:"kind" db:"kind"`
+	ContentType string         `json:"content_type" db:"content_type"`
+	FileName    string         `json:"file_name" db:"file_name"`
+	SizeBytes   int64          `json:"size_bytes" db:"size_bytes"`
+	// Width and Height are set for images
+	Width  int `json:"width,omitempty" db:"width"`
+	Height int `json:"height,omitempty" db:"height"`
+	// Key and ThumbnailKey locate the file and, for images, its thumbnail
+	Key          string    `json:"-" db:"storage_key"`
+	ThumbnailKey string    `json:"-" db:"thumbnail_key"`
+	URL          string    `json:"url,omitempty"`
+	ThumbnailURL string    `json:"thumbnail_url,omitempty"`
+	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+}
@@ -86,6 +86,17 @@ type EscrowSummary struct {
 	Currency      string          `json:"currency"`
 }
 
+// EscrowBalance is what a user has in escrow in one currency
+type EscrowBalance struct {
+	Currency string `json:"currency"`
+	// PendingPayout is held for the user's sales until buyers confirm delivery
+	PendingPayout decimal.Decimal `json:"pending_payout"`
+	// PaidOut30Days was released to the user in the last 30 days
+	PaidOut30Days decimal.Decimal `json:"paid_out_30_days"`
+	// HeldForPurchases is the user's money held until their orders arrive
+	HeldForPurchases decimal.Decimal `json:"held_for_purchases"`
+}
+
 // IsValidStatus checks if the escrow status is valid
 func (s EscrowStatus) IsValid() bool {
 	switch s {
@@ -0,0 +1,149 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// earthRadiusKm is the mean Earth radius used by the earthdistance extension
+const earthRadiusKm = 6371.0
+
+// MaxSearchRadiusKm bounds "within N km" filters
+const MaxSearchRadiusKm = 500
+
+// ErrInvalidLocation is returned for coordinates outside the valid range
+var ErrInvalidLocation = errors.New("invalid location")
+
+// GeoPoint is a WGS84 coordinate
+type GeoPoint struct {
+	Lat float64 `json:"lat"`
+	Lng float64 `json:"lng"`
+}
+
+// Validate checks the point is on the globe
+func (p GeoPoint) Validate() error {
+	if math.IsNaN(p.Lat) || math.IsNaN(p.Lng) || p.Lat < -90 || p.Lat > 90 || p.Lng < -180 || p.Lng > 180 {
+		return fmt.Errorf("%w: lat must be within ±90 and lng within ±180", ErrInvalidLocation)
+	}
+	return nil
+}
+
+// DistanceKm returns the great-circle distance to q
+func (p GeoPoint) DistanceKm(q GeoPoint) float64 {
+	lat1, lat2 := p.Lat*math.Pi/180, q.Lat*math.Pi/180
+	dLat := lat2 - lat1
+	dLng := (q.Lng - p.Lng) * math.Pi / 180
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadiusKm * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// ServiceAreaKind is how a seller's delivery area is described
+type ServiceAreaKind string
+
+const (
+	// ServiceAreaRadius covers everything within RadiusKm of Center
+	ServiceAreaRadius ServiceAreaKind = "radius"
+	// ServiceAreaPolygon covers the inside of Polygon
+	ServiceAreaPolygon ServiceAreaKind = "polygon"
+)
+
+// maxPolygonVertices keeps service area polygons small enough to index
+const maxPolygonVertices = 200
+
+// ServiceArea is a region a seller delivers to
+type ServiceArea struct {
+	ID        uuid.UUID       `json:"id" db:"id"`
+	SellerID  uuid.UUID       `json:"seller_id" db:"seller_id"`
+	Name      string          `json:"name" db:"name"`
+	Kind      ServiceAreaKind `json:"kind" db:"kind"`
+	Center    *GeoPoint       `json:"center,omitempty" db:"-"`
+	RadiusKm  *float64        `json:"radius_km,omitempty" db:"radius_km"`
+	Polygon   []GeoPoint      `json:"polygon,omitempty" db:"-"`
+	CreatedAt time.Time       `json:"created_at" db:"created_at"`
+}
+
+// Validate checks the area is a usable radius or polygon
+func (a *ServiceArea) Validate() error {
+	a.Name = strings.TrimSpace(a.Name)
+	switch a.Kind {
+	case ServiceAreaRadius:
+		if a.Center == nil || a.RadiusKm == nil {
+			return fmt.Errorf("%w: a radius area needs a center and radius_km", ErrInvalidLocation)
+		}
+		if err := a.Center.Validate(); err != nil {
+			return err
+		}
+		if *a.RadiusKm <= 0 || *a.RadiusKm > MaxSearchRadiusKm {
+			return fmt.Errorf("%w: radius_km must be between 0 and %d", ErrInvalidLocation, MaxSearchRadiusKm)
+		}
+		a.Polygon = nil
+	case ServiceAreaPolygon:
+		if len(a.Polygon) < 3 || len(a.Polygon) > maxPolygonVertices {
+			return fmt.Errorf("%w: a polygon needs between 3 and %d points", ErrInvalidLocation, maxPolygonVertices)
+		}
+		for _, p := range a.Polygon {
+			if err := p.Validate(); err != nil {
+				return err
+			}
+		}
+		a.Center, a.RadiusKm = nil, nil
+	default:
+		return fmt.Errorf("%w: unknown service area kind %q", ErrInvalidLocation, a.Kind)
+	}
+	return nil
+}
+
+// Contains reports whether p is inside the area. Polygons are treated as
+// planar in lat/lng, which matches Postgres' polygon @> point.
+func (a *ServiceArea) Contains(p GeoPoint) bool {
+	switch a.Kind {
+	case ServiceAreaRadius:
+		return a.Center != nil && a.RadiusKm != nil && a.Center.DistanceKm(p) <= *a.RadiusKm
+	case ServiceAreaPolygon:
+		inside := false
+		for i, j := 0, len(a.Polygon)-1; i < len(a.Polygon); j, i = i, i+1 {
+			vi, vj := a.Polygon[i], a.Polygon[j]
+			if (vi.Lat > p.Lat) != (vj.Lat > p.Lat) &&
+				p.Lng < (vj.Lng-vi.Lng)*(p.Lat-vi.Lat)/(vj.Lat-vi.Lat)+vi.Lng {
+				inside = !inside
+			}
+		}
+		return inside
+	}
+	return false
+}
+
+// PolygonLiteral renders the polygon as a Postgres polygon with x = lng and y = lat
+func (a *ServiceArea) PolygonLiteral() *string {
+	if a.Kind != ServiceAreaPolygon || len(a.Polygon) == 0 {
+		return nil
+	}
+	points := make([]string, len(a.Polygon))
+	for i, p := range a.Polygon {
+		points[i] = fmt.Sprintf("(%g,%g)", p.Lng, p.Lat)
+	}
+	literal := "(" + strings.Join(points, ",") + ")"
+	return &literal
+}
+
+// ParsePolygonLiteral reads a Postgres polygon written by PolygonLiteral
+func ParsePolygonLiteral(literal string) ([]GeoPoint, error) {
+	trimmed := strings.Trim(strings.TrimSpace(literal), "()")
+	if trimmed == "" {
+		return nil, nil
+	}
+	var points []GeoPoint
+	for _, pair := range strings.Split(trimmed, "),(") {
+		var p GeoPoint
+		if _, err := fmt.Sscanf(pair, "%g,%g", &p.Lng, &p.Lat); err != nil {
+			return nil, fmt.Errorf("failed to parse polygon point %q: %w", pair, err)
+		}
+		points = append(points, p)
+	}
+	return points, nil
+}
@@ -0,0 +1,60 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	nairobi = GeoPoint{Lat: -1.2921, Lng: 36.8219}
+	nakuru  = GeoPoint{Lat: -0.3031, Lng: 36.0800}
+)
+
+func TestDistanceKm(t *testing.T) {
+	assert.InDelta(t, 137, nairobi.DistanceKm(nakuru), 2)
+	assert.InDelta(t, 0, nairobi.DistanceKm(nairobi), 1e-9)
+}
+
+func TestGeoPointValidate(t *testing.T) {
+	assert.NoError(t, nairobi.Validate())
+	assert.ErrorIs(t, GeoPoint{Lat: 91}.Validate(), ErrInvalidLocation)
+	assert.ErrorIs(t, GeoPoint{Lng: -181}.Validate(), ErrInvalidLocation)
+}
+
+func TestServiceAreaContains(t *testing.T) {
+	radius := 50.0
+	around := ServiceArea{Kind: ServiceAreaRadius, Center: &nairobi, RadiusKm: &radius}
+	assert.NoError(t, around.Validate())
+	assert.True(t, around.Contains(GeoPoint{Lat: -1.05, Lng: 37.08})) // Thika, ~40km
+	assert.False(t, around.Contains(nakuru))
+
+	// A box around the Rift Valley towns
+	rift := ServiceArea{Kind: ServiceAreaPolygon, Polygon: []GeoPoint{
+		{Lat: -1.0, Lng: 35.5}, {Lat: -1.0, Lng: 36.5}, {Lat: 0.6, Lng: 36.5}, {Lat: 0.6, Lng: 35.5},
+	}}
+	assert.NoError(t, rift.Validate())
+	assert.True(t, rift.Contains(nakuru))
+	assert.False(t, rift.Contains(nairobi))
+}
+
+func TestServiceAreaValidate(t *testing.T) {
+	tooFar := 900.0
+	assert.ErrorIs(t, (&ServiceArea{Kind: ServiceAreaRadius, Center: &nairobi, RadiusKm: &tooFar}).Validate(), ErrInvalidLocation)
+	assert.ErrorIs(t, (&ServiceArea{Kind: ServiceAreaRadius, Center: &nairobi}).Validate(), ErrInvalidLocation)
+	assert.ErrorIs(t, (&ServiceArea{Kind: ServiceAreaPolygon, Polygon: []GeoPoint{nairobi, nakuru}}).Validate(), ErrInvalidLocation)
+	assert.ErrorIs(t, (&ServiceArea{Kind: "county"}).Validate(), ErrInvalidLocation)
+}
+
+func TestPolygonLiteralRoundTrip(t *testing.T) {
+	area := ServiceArea{Kind: ServiceAreaPolygon, Polygon: []GeoPoint{
+		{Lat: -1.0, Lng: 35.5}, {Lat: -1.0, Lng: 36.5}, {Lat: 0.6, Lng: 36.5},
+	}}
+
+	literal := area.PolygonLiteral()
+	assert.Equal(t, "((35.5,-1),(36.5,-1),(36.5,0.6))", *literal)
+
+	points, err := ParsePolygonLiteral(*literal)
+	assert.NoError(t, err)
+	assert.Equal(t, area.Polygon, points)
+}
@@ -0,0 +1,142 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// StockReason says why a variant's stock moved
+type StockReason string
+
+const (
+	// StockAdjustment is a trader correcting or restocking a variant
+	StockAdjustment StockReason = "adjustment"
+	// StockImport is a stock level set by a bulk catalogue import
+	StockImport StockReason = "import"
+	// StockReservation holds stock for a placed order
+	StockReservation StockReason = "reservation"
+	// StockRelease returns a cancelled order's reservation to sale
+	StockRelease StockReason = "release"
+	// StockSale is a delivered order taking its reserved stock
+	StockSale StockReason = "sale"
+	// StockReturn is goods coming back from a buyer
+	StockReturn StockReason = "return"
+)
+
+// IsValid reports whether r is a known reason
+func (r StockReason) IsValid() bool {
+	switch r {
+	case StockAdjustment, StockImport, StockReservation, StockRelease, StockSale, StockReturn:
+		return true
+	}
+	return false
+}
+
+// IsManual reports whether traders may record r themselves; the other
+// reasons come from orders and imports
+func (r StockReason) IsManual() bool {
+	return r == StockAdjustment || r == StockReturn
+}
+
+// StockChange describes why a variant's Stock is being set, for the
+// inventory ledger. Without one a change is recorded as an adjustment.
+type StockChange struct {
+	Reason  StockReason
+	ActorID *uuid.UUID
+	Note    string
+}
+
+// StockMovement is one entry in the inventory ledger. Stock is what is
+// available to sell; reserved stock is held for placed orders, so the
+// stock on hand is Stock plus Reserved.
+type StockMovement struct {
+	ID        uuid.UUID   `json:"id" db:"id"`
+	ProductID uuid.UUID   `json:"product_id" db:"product_id"`
+	VariantID *uuid.UUID  `json:"variant_id,omitempty" db:"variant_id"`
+	SellerID  uuid.UUID   `json:"seller_id" db:"seller_id"`
+	Reason    StockReason `json:"reason" db:"reason"`
+	// Quantity is the change in available stock and ReservedChange the
+	// change in reserved stock
+	Quantity       int `json:"quantity" db:"quantity"`
+	ReservedChange int `json:"reserved_change" db:"reserved_change"`
+	StockAfter     int `json:"stock_after" db:"stock_after"`
+	ReservedAfter  int `json:"reserved_after" db:"reserved_after"`
+	// PriceCents is the variant's price when the stock moved
+	PriceCents int64      `json:"price_cents" db:"price_cents"`
+	OrderID    *uuid.UUID `json:"order_id,omitempty" db:"order_id"`
+	ActorID    *uuid.UUID `json:"actor_id,omitempty" db:"actor_id"`
+	Note       string     `json:"note,omitempty" db:"note"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+}
+
+// StockAdjustmentRequest records a manual stock movement. Quantity is
+// signed: positive for stock coming in.
+type StockAdjustmentRequest struct {
+	Quantity int         `json:"quantity" validate:"required,ne=0"`
+	Reason   StockReason `json:"reason,omitempty"`
+	Note     string      `json:"note,omitempty" validate:"max=500"`
+	OrderID  *uuid.UUID  `json:"order_id,omitempty"`
+}
+
+// ReorderThresholdRequest sets or, with a null threshold, clears a
+// product's reorder threshold
+type ReorderThresholdRequest struct {
+	Threshold *int `json:"threshold" validate:"omitempty,gte=0"`
+}
+
+// LowStockAlert is raised when a product's available stock falls to its
+// reorder threshold
+type LowStockAlert struct {
+	ProductID        uuid.UUID `json:"product_id"`
+	SellerID         uuid.UUID `json:"seller_id"`
+	Title            string    `json:"title"`
+	Stock            int       `json:"stock"`
+	ReorderThreshold int       `json:"reorder_threshold"`
+}
+
+// InventoryReportItem values one variant's stock and how fast it sells
+type InventoryReportItem struct {
+	ProductID uuid.UUID       `json:"product_id"`
+	VariantID uuid.UUID       `json:"variant_id"`
+	Title     string          `json:"title"`
+	SKU       string          `json:"sku"`
+	PackSize  decimal.Decimal `json:"pack_size"`
+	Unit      UnitOfMeasure   `json:"unit"`
+	Currency  string          `json:"currency"`
+	// Stock is available to sell; OnHand adds the reserved stock
+	Stock      int   `json:"stock"`
+	Reserved   int   `json:"reserved"`
+	OnHand     int   `json:"on_hand"`
+	PriceCents int64 `json:"price_cents"`
+	// ValueCents values the stock on hand at the current price
+	ValueCents int64 `json:"value_cents"`
+	// Opening and closing stock on hand and the sales in the period
+	OpeningOnHand  int   `json:"opening_on_hand"`
+	ClosingOnHand  int   `json:"closing_on_hand"`
+	SoldUnits      int   `json:"sold_units"`
+	SoldValueCents int64 `json:"sold_value_cents"`
+	// Turnover is units sold over the average stock on hand; DaysOfCover
+	// is how long the stock on hand lasts at the period's sales rate
+	Turnover    *float64 `json:"turnover,omitempty"`
+	DaysOfCover *float64 `json:"days_of_cover,omitempty"`
+}
+
+// InventoryTotal sums a report's items in one currency
+type InventoryTotal struct {
+	Currency       string   `json:"currency"`
+	OnHand         int      `json:"on_hand"`
+	ValueCents     int64    `json:"value_cents"`
+	SoldUnits      int      `json:"sold_units"`
+	SoldValueCents int64    `json:"sold_value_cents"`
+	Turnover       *float64 `json:"turnover,omitempty"`
+}
+
+// InventoryReport is a trader's stock valuation and turnover for a period
+type InventoryReport struct {
+	From   time.Time             `json:"from"`
+	To     time.Time             `json:"to"`
+	Items  []InventoryReportItem `json:"items"`
+	Totals []InventoryTotal      `json:"totals"`
+}
@@ -0,0 +1,65 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// MarketPosition places a listing's price against the market
+type MarketPosition string
+
+const (
+	MarketBelow MarketPosition = "below"
+	MarketAt    MarketPosition = "at"
+	MarketAbove MarketPosition = "above"
+)
+
+// MarketPriceIndex summarises what a category sells for per base unit in
+// a region. Region "" is the index across all regions.
+type MarketPriceIndex struct {
+	Category    ProductCategory `json:"category" db:"category"`
+	Region      string          `json:"region" db:"region"`
+	BaseUnit    UnitOfMeasure   `json:"base_unit" db:"base_unit"`
+	Currency    string          `json:"currency" db:"currency"`
+	MedianCents decimal.Decimal `json:"median_unit_price_cents" db:"median_unit_price_cents"`
+	LowCents    decimal.Decimal `json:"p25_unit_price_cents" db:"p25_unit_price_cents"`
+	HighCents   decimal.Decimal `json:"p75_unit_price_cents" db:"p75_unit_price_cents"`
+	// Samples by source: active listings, delivered orders and external
+	// commodity price observations
+	ListingCount int       `json:"listing_count" db:"listing_count"`
+	OrderCount   int       `json:"order_count" db:"order_count"`
+	FeedCount    int       `json:"feed_count" db:"feed_count"`
+	ComputedAt   time.Time `json:"computed_at" db:"computed_at"`
+}
+
+// SampleSize is the number of prices behind the index
+func (i *MarketPriceIndex) SampleSize() int {
+	return i.ListingCount + i.OrderCount + i.FeedCount
+}
+
+// MarketPriceHint tells buyers whether a listing is cheap for its market
+type MarketPriceHint struct {
+	Position MarketPosition `json:"position"`
+	// DifferencePercent is how far the listing's unit price is from the
+	// median, negative when cheaper
+	DifferencePercent float64         `json:"difference_percent"`
+	UnitPriceCents    decimal.Decimal `json:"unit_price_cents"`
+	MedianCents       decimal.Decimal `json:"median_unit_price_cents"`
+	BaseUnit          UnitOfMeasure   `json:"base_unit"`
+	Region            string          `json:"region"`
+	SampleSize        int             `json:"sample_size"`
+}
+
+// PricePoint is one recorded price of a variant
+type PricePoint struct {
+	ID                 uuid.UUID       `json:"id" db:"id"`
+	ProductID          uuid.UUID       `json:"product_id" db:"product_id"`
+	VariantID          uuid.UUID       `json:"variant_id" db:"variant_id"`
+	PriceCents         int64           `json:"price_cents" db:"price_cents"`
+	PreviousPriceCents *int64          `json:"previous_price_cents,omitempty" db:"previous_price_cents"`
+	UnitPriceCents     decimal.Decimal `json:"unit_price_cents" db:"unit_price_cents"`
+	BaseUnit           UnitOfMeasure   `json:"base_unit" db:"base_unit"`
+	RecordedAt         time.Time       `json:"recorded_at" db:"recorded_at"`
+}
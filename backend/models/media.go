@@ -0,0 +1,80 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MediaKind says what an uploaded image belongs to
+type MediaKind string
+
+const (
+	MediaKindProduct MediaKind = "product"
+	MediaKindPest    MediaKind = "pest"
+)
+
+// IsValid reports whether k is a known media kind
+func (k MediaKind) IsValid() bool {
+	return k == MediaKindProduct || k == MediaKindPest
+}
+
+// Media variant names, from largest to smallest
+const (
+	MediaVariantLarge  = "large"
+	MediaVariantMedium = "medium"
+	MediaVariantThumb  = "thumb"
+)
+
+// mediaRefPrefix marks a stored image reference as a media asset rather
+// than a bare URL
+const mediaRefPrefix = "media:"
+
+// MediaAsset is an uploaded image and the resized renditions generated
+// from it. Originals are never stored as uploaded, so camera metadata such
+// as GPS coordinates does not survive.
+type MediaAsset struct {
+	ID          uuid.UUID      `json:"id" db:"id"`
+	OwnerID     uuid.UUID      `json:"owner_id" db:"owner_id"`
+	Kind        MediaKind      `json:"kind" db:"kind"`
+	ContentType string         `json:"content_type" db:"content_type"`
+	Width       int            `json:"width" db:"width"`
+	Height      int            `json:"height" db:"height"`
+	SizeBytes   int64          `json:"size_bytes" db:"size_bytes"`
+	Variants    []MediaVariant `json:"variants" db:"variants"`
+	CreatedAt   time.Time      `json:"created_at" db:"created_at"`
+}
+
+// MediaVariant is one stored rendition of an asset. URL is signed when the
+// asset is read and expires; the storage key is never exposed.
+type MediaVariant struct {
+	Name        string `json:"name"`
+	Format      string `json:"format"`
+	ContentType string `json:"content_type"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	SizeBytes   int64  `json:"size_bytes"`
+	Key         string `json:"-"`
+	URL         string `json:"url,omitempty"`
+}
+
+// Ref is the reference stored in product images and pest reports
+func (a *MediaAsset) Ref() string {
+	return MediaRef(a.ID)
+}
+
+// MediaRef builds the stored reference of an asset
+func MediaRef(id uuid.UUID) string {
+	return mediaRefPrefix + id.String()
+}
+
+// ParseMediaRef returns the asset ID of a reference made by MediaRef.
+// Bare image URLs are not references.
+func ParseMediaRef(ref string) (uuid.UUID, bool) {
+	if !strings.HasPrefix(ref, mediaRefPrefix) {
+		return uuid.Nil, false
+	}
+	id, err := uuid.Parse(strings.TrimPrefix(ref, mediaRefPrefix))
+	return id, err == nil
+}
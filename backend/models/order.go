@@ -101,6 +101,7 @@ type OrderItem struct {
 	ID          uuid.UUID       `json:"id" db:"id"`
 	OrderID     uuid.UUID       `json:"order_id" db:"order_id"`
 	ProductID   string          `json:"product_id" db:"product_id"`
+	VariantID   *uuid.UUID      `json:"variant_id,omitempty" db:"variant_id"`
 	ProductName string          `json:"product_name" db:"product_name"`
 	ProductSKU  string          `json:"product_sku" db:"product_sku"`
 	Quantity    int             `json:"quantity" db:"quantity"`
@@ -146,6 +147,8 @@ type CreateOrderRequest struct {
 // CreateOrderItemRequest represents an item in the create order request
 type CreateOrderItemRequest struct {
 	ProductID string `json:"product_id" validate:"required"`
+	// VariantID may be omitted when the product has a single variant
+	VariantID string `json:"variant_id,omitempty"`
 	Quantity  int    `json:"quantity" validate:"required,min=1"`
 }
 
@@ -163,13 +166,3 @@ type OrderResponse struct {
 	Error   string `json:"error,omitempty"`
 }
 
-// OrdersListResponse represents the response for listing orders
-type OrdersListResponse struct {
-	Success bool    `json:"success"`
-	Message string  `json:"message"`
-	Data    []Order `json:"data"`
-	Total   int     `json:"total"`
-	Page    int     `json:"page"`
-	Limit   int     `json:"limit"`
-	Error   string  `json:"error,omitempty"`
-}
@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
 )
 
 type ProductCategory string
@@ -16,35 +17,109 @@ const (
 	CategoryOther      ProductCategory = "other"
 )
 
+// DefaultProductCurrency is used when a listing does not name a currency
+const DefaultProductCurrency = "KES"
+
+// IsValid reports whether c is a known category
+func (c ProductCategory) IsValid() bool {
+	switch c {
+	case CategorySeeds, CategoryFertilizer, CategoryTools, CategoryMachinery, CategoryOther:
+		return true
+	}
+	return false
+}
+
+// Product is the single catalogue record behind trader management, the
+// public marketplace, search and order pricing. PriceCents and Stock
+// summarise the active variants: the lowest price and the total stock.
 type Product struct {
 	ID          uuid.UUID       `json:"id" db:"id"`
-	TraderID    uuid.UUID       `json:"trader_id" db:"trader_id"`
-	Name        string          `json:"name" db:"name" validate:"required,min=3,max=255"`
+	SellerID    uuid.UUID       `json:"seller_id" db:"seller_id"`
+	Title       string          `json:"title" db:"title" validate:"required,min=3,max=255"`
 	Description string          `json:"description" db:"description" validate:"required,min=10"`
-	Price       float64         `json:"price" db:"price" validate:"required,gt=0"`
-	Stock       int             `json:"stock" db:"stock" validate:"required,gte=0"`
 	Category    ProductCategory `json:"category" db:"category" validate:"required,oneof=seeds fertilizer tools machinery other"`
-	ImageURL    string          `json:"image_url,omitempty" db:"image_url"`
+	PriceCents  int64           `json:"price_cents" db:"price_cents" validate:"required,gt=0"`
+	Currency    string          `json:"currency" db:"currency" validate:"required,len=3"`
+	Stock       int             `json:"stock" db:"stock" validate:"gte=0"`
+	Images      []string        `json:"images" db:"images"`
 	IsActive    bool            `json:"is_active" db:"is_active"`
 	CreatedAt   time.Time       `json:"created_at" db:"created_at"`
 	UpdatedAt   time.Time       `json:"updated_at" db:"updated_at"`
+
+	// ReorderThreshold raises a low-stock alert when Stock falls to it
+	ReorderThreshold *int `json:"reorder_threshold,omitempty" db:"reorder_threshold"`
+
+	Variants []ProductVariant `json:"variants" db:"-"`
+
+	// Media holds the uploaded images referenced from Images, with signed
+	// URLs for each rendition
+	Media []MediaAsset `json:"media,omitempty" db:"-"`
+
+	// Seller summary, filled in on catalogue reads
+	SellerName         *string  `json:"seller_name,omitempty" db:"-"`
+	SellerVerified     *bool    `json:"seller_verified,omitempty" db:"-"`
+	SellerRating       *float64 `json:"seller_rating,omitempty" db:"-"`
+	SellerReviewsCount *int     `json:"seller_reviews_count,omitempty" db:"-"`
+	SellerLocation     *string  `json:"seller_location,omitempty" db:"-"`
+
+	// DistanceKm is the distance from the buyer to the seller, set when
+	// browsing near a location
+	DistanceKm *float64 `json:"distance_km,omitempty" db:"-"`
+
+	// MarketPrice compares the listing with the market price index, set
+	// on public catalogue reads when an index covers the product
+	MarketPrice *MarketPriceHint `json:"market_price,omitempty" db:"-"`
+}
+
+// Price returns the lowest variant price in major currency units
+func (p *Product) Price() decimal.Decimal {
+	return decimal.New(p.PriceCents, -2)
+}
+
+// Variant returns the variant with the given ID
+func (p *Product) Variant(id uuid.UUID) (*ProductVariant, bool) {
+	for i := range p.Variants {
+		if p.Variants[i].ID == id {
+			return &p.Variants[i], true
+		}
+	}
+	return nil, false
+}
+
+// SummariseVariants sets PriceCents and Stock from the active variants
+func (p *Product) SummariseVariants() {
+	p.PriceCents, p.Stock = 0, 0
+	for _, v := range p.Variants {
+		if !v.IsActive {
+			continue
+		}
+		if p.PriceCents == 0 || v.PriceCents < p.PriceCents {
+			p.PriceCents = v.PriceCents
+		}
+		p.Stock += v.Stock
+	}
 }
 
+// CreateProductRequest creates a product with its variants. A request
+// without variants is sold as a single piece at PriceCents with Stock.
 type CreateProductRequest struct {
-	Name        string          `json:"name" validate:"required,min=3,max=255"`
-	Description string          `json:"description" validate:"required,min=10"`
-	Price       float64         `json:"price" validate:"required,gt=0"`
-	Stock       int             `json:"stock" validate:"required,gte=0"`
-	Category    ProductCategory `json:"category" validate:"required,oneof=seeds fertilizer tools machinery other"`
-	ImageURL    string          `json:"image_url,omitempty"`
+	Title       string                  `json:"title" validate:"required,min=3,max=255"`
+	Description string                  `json:"description" validate:"required,min=10"`
+	PriceCents  int64                   `json:"price_cents,omitempty" validate:"omitempty,gt=0"`
+	Currency    string                  `json:"currency,omitempty" validate:"omitempty,len=3"`
+	Stock       int                     `json:"stock,omitempty" validate:"gte=0"`
+	Category    ProductCategory         `json:"category" validate:"required,oneof=seeds fertilizer tools machinery other"`
+	Images      []string                `json:"images,omitempty"`
+	Variants    []ProductVariantRequest `json:"variants,omitempty" validate:"omitempty,dive"`
+
+	ReorderThreshold *int `json:"reorder_threshold,omitempty" validate:"omitempty,gte=0"`
 }
 
 type UpdateProductRequest struct {
-	Name        *string          `json:"name,omitempty" validate:"omitempty,min=3,max=255"`
+	Title       *string          `json:"title,omitempty" validate:"omitempty,min=3,max=255"`
 	Description *string          `json:"description,omitempty" validate:"omitempty,min=10"`
-	Price       *float64         `json:"price,omitempty" validate:"omitempty,gt=0"`
-	Stock       *int             `json:"stock,omitempty" validate:"omitempty,gte=0"`
+	Currency    *string          `json:"currency,omitempty" validate:"omitempty,len=3"`
 	Category    *ProductCategory `json:"category,omitempty" validate:"omitempty,oneof=seeds fertilizer tools machinery other"`
-	ImageURL    *string          `json:"image_url,omitempty"`
+	Images      *[]string        `json:"images,omitempty"`
 	IsActive    *bool            `json:"is_active,omitempty"`
 }
@@ -0,0 +1,179 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// UnitOfMeasure is the unit a variant's pack size is expressed in
+type UnitOfMeasure string
+
+const (
+	UnitGram       UnitOfMeasure = "g"
+	UnitKilogram   UnitOfMeasure = "kg"
+	UnitTonne      UnitOfMeasure = "t"
+	UnitMillilitre UnitOfMeasure = "ml"
+	UnitLitre      UnitOfMeasure = "l"
+	UnitPiece      UnitOfMeasure = "piece"
+	UnitSeedling   UnitOfMeasure = "seedling"
+)
+
+// unitConversions maps each unit to the base unit prices are compared in
+// and the number of base units in one unit
+var unitConversions = map[UnitOfMeasure]struct {
+	base   UnitOfMeasure
+	factor decimal.Decimal
+}{
+	UnitGram:       {UnitKilogram, decimal.New(1, -3)},
+	UnitKilogram:   {UnitKilogram, decimal.NewFromInt(1)},
+	UnitTonne:      {UnitKilogram, decimal.NewFromInt(1000)},
+	UnitMillilitre: {UnitLitre, decimal.New(1, -3)},
+	UnitLitre:      {UnitLitre, decimal.NewFromInt(1)},
+	UnitPiece:      {UnitPiece, decimal.NewFromInt(1)},
+	UnitSeedling:   {UnitSeedling, decimal.NewFromInt(1)},
+}
+
+// IsValid reports whether u is a known unit
+func (u UnitOfMeasure) IsValid() bool {
+	_, ok := unitConversions[u]
+	return ok
+}
+
+// Base returns the unit u is compared in: kg for weights, l for volumes,
+// and the unit itself for countable goods
+func (u UnitOfMeasure) Base() UnitOfMeasure {
+	if c, ok := unitConversions[u]; ok {
+		return c.base
+	}
+	return u
+}
+
+// ToBase converts qty of u into base units
+func (u UnitOfMeasure) ToBase(qty decimal.Decimal) decimal.Decimal {
+	if c, ok := unitConversions[u]; ok {
+		return qty.Mul(c.factor)
+	}
+	return qty
+}
+
+// ProductVariant is a sellable pack of a product, e.g. a 5kg bag of seed.
+// Orders reference variants; the product carries the shared description.
+type ProductVariant struct {
+	ID         uuid.UUID       `json:"id" db:"id"`
+	ProductID  uuid.UUID       `json:"product_id" db:"product_id"`
+	SKU        string          `json:"sku" db:"sku"`
+	PackSize   decimal.Decimal `json:"pack_size" db:"pack_size"`
+	Unit       UnitOfMeasure   `json:"unit" db:"unit"`
+	PriceCents int64           `json:"price_cents" db:"price_cents"`
+	Stock      int             `json:"stock" db:"stock"`
+	Barcode    *string         `json:"barcode,omitempty" db:"barcode"`
+	IsActive   bool            `json:"is_active" db:"is_active"`
+	CreatedAt  time.Time       `json:"created_at" db:"created_at"`
+	UpdatedAt  time.Time       `json:"updated_at" db:"updated_at"`
+
+	// Comparison price per base unit, e.g. cents per kg
+	BaseUnit       UnitOfMeasure   `json:"base_unit" db:"base_unit"`
+	UnitPriceCents decimal.Decimal `json:"unit_price_cents" db:"unit_price_cents"`
+
+	// Reserved is held for placed orders and not included in Stock
+	Reserved int `json:"reserved" db:"reserved"`
+
+	// StockChange is recorded in the inventory ledger when saving changes Stock
+	StockChange *StockChange `json:"-" db:"-"`
+}
+
+// Price returns the variant price in major currency units
+func (v *ProductVariant) Price() decimal.Decimal {
+	return decimal.New(v.PriceCents, -2)
+}
+
+// BaseQuantity returns the pack size in base units
+func (v *ProductVariant) BaseQuantity() decimal.Decimal {
+	return v.Unit.ToBase(v.PackSize)
+}
+
+// ComputeUnitPrice fills BaseUnit and UnitPriceCents from the pack size and price
+func (v *ProductVariant) ComputeUnitPrice() {
+	v.BaseUnit = v.Unit.Base()
+	qty := v.BaseQuantity()
+	if qty.Sign() <= 0 {
+		v.UnitPriceCents = decimal.Zero
+		return
+	}
+	v.UnitPriceCents = decimal.NewFromInt(v.PriceCents).DivRound(qty, 4)
+}
+
+// Label describes the pack, e.g. "5kg" or "98 seedling"
+func (v *ProductVariant) Label() string {
+	switch v.Unit {
+	case UnitPiece, UnitSeedling:
+		return v.PackSize.String() + " " + string(v.Unit)
+	}
+	return v.PackSize.String() + string(v.Unit)
+}
+
+// DefaultSKU builds a SKU from the product ID and pack, e.g. "1A2B3C4D-5KG"
+func (v *ProductVariant) DefaultSKU() string {
+	label := strings.ReplaceAll(v.Label(), " ", "")
+	return strings.ToUpper(v.ProductID.String()[:8] + "-" + label)
+}
+
+// ValidBarcode reports whether code is a GTIN-8, -12, -13 or -14 with a
+// correct check digit
+func ValidBarcode(code string) bool {
+	switch len(code) {
+	case 8, 12, 13, 14:
+	default:
+		return false
+	}
+
+	sum := 0
+	for i := 0; i < len(code)-1; i++ {
+		c := code[i]
+		if c < '0' || c > '9' {
+			return false
+		}
+		digit := int(c - '0')
+		// Weights alternate 3,1 counting from the digit next to the check digit
+		if (len(code)-1-i)%2 == 1 {
+			digit *= 3
+		}
+		sum += digit
+	}
+
+	check := code[len(code)-1]
+	if check < '0' || check > '9' {
+		return false
+	}
+	return (10-sum%10)%10 == int(check-'0')
+}
+
+// ProductVariantRequest creates or replaces a variant
+type ProductVariantRequest struct {
+	SKU        string          `json:"sku,omitempty" validate:"omitempty,max=64"`
+	PackSize   decimal.Decimal `json:"pack_size" validate:"required"`
+	Unit       UnitOfMeasure   `json:"unit" validate:"required"`
+	PriceCents int64           `json:"price_cents" validate:"required,gt=0"`
+	Stock      int             `json:"stock" validate:"gte=0"`
+	Barcode    *string         `json:"barcode,omitempty"`
+
+	// StockReason is recorded in the inventory ledger; imports set it
+	StockReason StockReason `json:"-"`
+}
+
+// UpdateProductVariantRequest changes selected variant fields
+type UpdateProductVariantRequest struct {
+	SKU        *string          `json:"sku,omitempty" validate:"omitempty,max=64"`
+	PackSize   *decimal.Decimal `json:"pack_size,omitempty"`
+	Unit       *UnitOfMeasure   `json:"unit,omitempty"`
+	PriceCents *int64           `json:"price_cents,omitempty" validate:"omitempty,gt=0"`
+	Stock      *int             `json:"stock,omitempty" validate:"omitempty,gte=0"`
+	Barcode    *string          `json:"barcode,omitempty"`
+	IsActive   *bool            `json:"is_active,omitempty"`
+
+	// StockReason is recorded in the inventory ledger; imports set it
+	StockReason StockReason `json:"-"`
+}
@@ -0,0 +1,68 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestComputeUnitPriceComparesInBaseUnit(t *testing.T) {
+	// 500g for 150.00 and 2kg for 500.00 compare per kg
+	small := ProductVariant{PackSize: decimal.NewFromInt(500), Unit: UnitGram, PriceCents: 15000}
+	large := ProductVariant{PackSize: decimal.NewFromInt(2), Unit: UnitKilogram, PriceCents: 50000}
+	small.ComputeUnitPrice()
+	large.ComputeUnitPrice()
+
+	assert.Equal(t, UnitKilogram, small.BaseUnit)
+	assert.Equal(t, UnitKilogram, large.BaseUnit)
+	assert.True(t, small.UnitPriceCents.Equal(decimal.NewFromInt(30000)))
+	assert.True(t, large.UnitPriceCents.Equal(decimal.NewFromInt(25000)))
+
+	oil := ProductVariant{PackSize: decimal.NewFromInt(250), Unit: UnitMillilitre, PriceCents: 9900}
+	oil.ComputeUnitPrice()
+	assert.Equal(t, UnitLitre, oil.BaseUnit)
+	assert.True(t, oil.UnitPriceCents.Equal(decimal.NewFromInt(39600)))
+
+	tray := ProductVariant{PackSize: decimal.NewFromInt(98), Unit: UnitSeedling, PriceCents: 49000}
+	tray.ComputeUnitPrice()
+	assert.Equal(t, UnitSeedling, tray.BaseUnit)
+	assert.True(t, tray.UnitPriceCents.Equal(decimal.NewFromInt(500)))
+}
+
+func TestVariantLabelAndDefaultSKU(t *testing.T) {
+	productID := uuid.MustParse("1a2b3c4d-0000-0000-0000-000000000000")
+
+	bag := ProductVariant{ProductID: productID, PackSize: decimal.NewFromInt(5), Unit: UnitKilogram}
+	assert.Equal(t, "5kg", bag.Label())
+	assert.Equal(t, "1A2B3C4D-5KG", bag.DefaultSKU())
+
+	tray := ProductVariant{ProductID: productID, PackSize: decimal.NewFromInt(98), Unit: UnitSeedling}
+	assert.Equal(t, "98 seedling", tray.Label())
+	assert.Equal(t, "1A2B3C4D-98SEEDLING", tray.DefaultSKU())
+}
+
+func TestValidBarcode(t *testing.T) {
+	assert.True(t, ValidBarcode("4006381333931"))  // GTIN-13
+	assert.True(t, ValidBarcode("96385074"))       // GTIN-8
+	assert.True(t, ValidBarcode("036000291452"))   // GTIN-12
+	assert.True(t, ValidBarcode("10012345678902")) // GTIN-14
+
+	assert.False(t, ValidBarcode("4006381333932"))
+	assert.False(t, ValidBarcode("400638133393"))
+	assert.False(t, ValidBarcode("40063813339A1"))
+	assert.False(t, ValidBarcode(""))
+}
+
+func TestSummariseVariantsIgnoresInactive(t *testing.T) {
+	p := Product{Variants: []ProductVariant{
+		{PriceCents: 50000, Stock: 4, IsActive: true},
+		{PriceCents: 12000, Stock: 10, IsActive: true},
+		{PriceCents: 9000, Stock: 7, IsActive: false},
+	}}
+	p.SummariseVariants()
+
+	assert.Equal(t, int64(12000), p.PriceCents)
+	assert.Equal(t, 14, p.Stock)
+}
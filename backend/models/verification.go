@@ -0,0 +1,37 @@
+package models
+
+// VerificationLevel is the KYC level a seller has been verified at
+type VerificationLevel string
+
+const (
+	VerificationLevelNone     VerificationLevel = "none"
+	VerificationLevelIdentity VerificationLevel = "identity"
+	VerificationLevelBusiness VerificationLevel = "business"
+)
+
+// IsValid checks if the verification level is valid
+func (l VerificationLevel) IsValid() bool {
+	switch l {
+	case VerificationLevelNone, VerificationLevelIdentity, VerificationLevelBusiness:
+		return true
+	default:
+		return false
+	}
+}
+
+// Rank orders levels from unverified (0) to business verified (2)
+func (l VerificationLevel) Rank() int {
+	switch l {
+	case VerificationLevelIdentity:
+		return 1
+	case VerificationLevelBusiness:
+		return 2
+	default:
+		return 0
+	}
+}
+
+// AtLeast reports whether the level meets the given minimum
+func (l VerificationLevel) AtLeast(min VerificationLevel) bool {
+	return l.Rank() >= min.Rank()
+}
@@ -0,0 +1,92 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// WishlistItem is a listing a buyer is watching for price drops and restocks
+type WishlistItem struct {
+	ID        uuid.UUID `json:"id" db:"id"`
+	UserID    uuid.UUID `json:"user_id" db:"user_id"`
+	ProductID uuid.UUID `json:"product_id" db:"product_id"`
+	// SeenPriceCents is the price price drops are measured against: the
+	// price when the listing was saved or last changed
+	SeenPriceCents int64     `json:"seen_price_cents" db:"seen_price_cents"`
+	CreatedAt      time.Time `json:"created_at" db:"created_at"`
+	// Product is the listing as it is now
+	Product *Product `json:"product,omitempty" db:"-"`
+}
+
+// AlertFrequency is how often a user's watch alerts are delivered
+type AlertFrequency string
+
+const (
+	// AlertInstant delivers each alert as soon as it is found
+	AlertInstant AlertFrequency = "instant"
+	// AlertDaily and AlertWeekly bundle alerts into a digest
+	AlertDaily  AlertFrequency = "daily"
+	AlertWeekly AlertFrequency = "weekly"
+	// AlertOff drops alerts; wishlists and saved searches still work
+	AlertOff AlertFrequency = "off"
+)
+
+// IsValid reports whether f is a known frequency
+func (f AlertFrequency) IsValid() bool {
+	switch f {
+	case AlertInstant, AlertDaily, AlertWeekly, AlertOff:
+		return true
+	}
+	return false
+}
+
+// Period is the time between digests, zero when alerts are not bundled
+func (f AlertFrequency) Period() time.Duration {
+	switch f {
+	case AlertDaily:
+		return 24 * time.Hour
+	case AlertWeekly:
+		return 7 * 24 * time.Hour
+	}
+	return 0
+}
+
+// WatchPreferences are a user's alert settings
+type WatchPreferences struct {
+	Frequency    AlertFrequency `json:"frequency"`
+	LastDigestAt *time.Time     `json:"last_digest_at,omitempty"`
+}
+
+// WatchPreferencesRequest changes how often alerts are delivered
+type WatchPreferencesRequest struct {
+	Frequency AlertFrequency `json:"frequency" validate:"required,oneof=instant daily weekly off"`
+}
+
+// WatchAlertKind says what a watch alert is about
+type WatchAlertKind string
+
+const (
+	// WatchNewListing is a new listing matching a saved search
+	WatchNewListing WatchAlertKind = "new_listing"
+	// WatchPriceDrop is a wishlisted listing getting cheaper
+	WatchPriceDrop WatchAlertKind = "price_drop"
+	// WatchBackInStock is a wishlisted listing coming back into stock
+	WatchBackInStock WatchAlertKind = "back_in_stock"
+)
+
+// WatchAlert is a pending alert for a wishlist item or saved search
+type WatchAlert struct {
+	ID            uuid.UUID      `json:"id"`
+	UserID        uuid.UUID      `json:"user_id"`
+	Kind          WatchAlertKind `json:"kind"`
+	ProductID     uuid.UUID      `json:"product_id"`
+	ProductTitle  string         `json:"product_title"`
+	Currency      string         `json:"currency"`
+	SavedSearchID *uuid.UUID     `json:"saved_search_id,omitempty"`
+	// SearchName is the saved search's name for new listings
+	SearchName         string    `json:"search_name,omitempty"`
+	PriceCents         int64     `json:"price_cents"`
+	PreviousPriceCents *int64    `json:"previous_price_cents,omitempty"`
+	CreatedAt          time.Time `json:"created_at"`
+}
@@ -0,0 +1,241 @@
+// Package pagination is the keyset pagination shared by list endpoints.
+//
+// A page is ordered by a sort key and a unique ID. Its cursor is the key
+// and ID of the last row, encoded opaquely, and the next page starts
+// strictly after that pair. Unlike offsets, cursors keep their place when
+// rows are inserted ahead of the reader.
+package pagination
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/Andrew-mugwe/agroai/utils"
+)
+
+const (
+	// DefaultLimit is the page size when the request does not set one
+	DefaultLimit = 20
+	// MaxLimit bounds the page size
+	MaxLimit = 100
+)
+
+// ErrInvalidCursor is returned for cursors that cannot be decoded or were
+// issued for a different sort order
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor is the position after the last row of a page
+type Cursor struct {
+	// Key is the row's sort key as rendered by Postgres' ::text cast, so it
+	// compares exactly when bound back against the same expression
+	Key string `json:"k"`
+	ID  string `json:"i"`
+	// Sort is the order the cursor was issued for
+	Sort string `json:"s,omitempty"`
+}
+
+// Encode renders the cursor as an opaque URL-safe token
+func (c Cursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// Decode reads a token written by Encode
+func Decode(token string) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c Cursor
+	if err := json.Unmarshal(data, &c); err != nil || c.ID == "" {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+// Params is the requested page: its size and the cursor it starts after
+type Params struct {
+	Limit  int
+	Cursor *Cursor
+}
+
+// FromRequest reads the limit and cursor query parameters
+func FromRequest(r *http.Request) (Params, error) {
+	return Parse(r.URL.Query(), DefaultLimit)
+}
+
+// Parse reads limit and cursor from q. A missing or malformed limit falls
+// back to defaultLimit and a larger one is capped at MaxLimit.
+func Parse(q url.Values, defaultLimit int) (Params, error) {
+	p := Params{Limit: defaultLimit}
+	if l, err := strconv.Atoi(q.Get("limit")); err == nil && l > 0 {
+		p.Limit = l
+	}
+	p.Limit = min(p.Limit, MaxLimit)
+
+	if token := q.Get("cursor"); token != "" {
+		c, err := Decode(token)
+		if err != nil {
+			return p, err
+		}
+		p.Cursor = c
+	}
+	return p, nil
+}
+
+// Normalize fills in the default limit and caps it at MaxLimit
+func (p Params) Normalize() Params {
+	if p.Limit <= 0 {
+		p.Limit = DefaultLimit
+	}
+	p.Limit = min(p.Limit, MaxLimit)
+	return p
+}
+
+// After returns the cursor to resume from, nil on the first page. A cursor
+// issued for another sort order is rejected.
+func (p Params) After(sort string) (*Cursor, error) {
+	if p.Cursor == nil {
+		return nil, nil
+	}
+	if p.Cursor.Sort != sort {
+		return nil, fmt.Errorf("%w: issued for a different sort order", ErrInvalidCursor)
+	}
+	return p.Cursor, nil
+}
+
+// FetchLimit is the number of rows to read: one more than the page, to
+// tell whether another page follows
+func (p Params) FetchLimit() int {
+	return p.Limit + 1
+}
+
+// Direction is a keyset sort direction
+type Direction string
+
+const (
+	Asc  Direction = "ASC"
+	Desc Direction = "DESC"
+)
+
+// Keyset orders rows by Key, breaking ties by the unique ID column. Both
+// are SQL expressions and sort the same way, and Key must not be NULL.
+type Keyset struct {
+	Key string
+	ID  string
+	Dir Direction
+}
+
+// OrderBy is the ORDER BY list for the keyset
+func (k Keyset) OrderBy() string {
+	return fmt.Sprintf("%s %s, %s %s", k.Key, k.Dir, k.ID, k.Dir)
+}
+
+// After is the condition for rows past the cursor whose key and ID are bound
+// to keyArg and idArg. Postgres types the placeholders from the key and ID
+// expressions, so the cursor's text values can be bound as they are.
+func (k Keyset) After(keyArg, idArg string) string {
+	op := ">"
+	if k.Dir == Desc {
+		op = "<"
+	}
+	return fmt.Sprintf("(%s, %s) %s (%s, %s)", k.Key, k.ID, op, keyArg, idArg)
+}
+
+// KeyText selects the sort key in the form stored in cursors
+func (k Keyset) KeyText() string {
+	return "(" + k.Key + ")::text"
+}
+
+// Page is one page of rows
+type Page[T any] struct {
+	Items []T
+	Limit int
+	// Next resumes after the last item; nil on the last page
+	Next *Cursor
+	// Total counts every matching row, nil when the list is not counted
+	Total *int
+}
+
+// NewPage cuts rows read with Params.FetchLimit down to the limit. When more
+// rows follow, cursorAt builds the cursor of the row at index i.
+func NewPage[T any](rows []T, limit int, cursorAt func(i int) Cursor) Page[T] {
+	page := Page[T]{Items: rows, Limit: limit}
+	if page.Items == nil {
+		page.Items = []T{}
+	}
+	if len(rows) > limit {
+		page.Items = rows[:limit]
+		next := cursorAt(limit - 1)
+		page.Next = &next
+	}
+	return page
+}
+
+// WithTotal sets the total row count
+func (p Page[T]) WithTotal(total int) Page[T] {
+	p.Total = &total
+	return p
+}
+
+// Meta describes a page in the list envelope
+type Meta struct {
+	Limit      int    `json:"limit"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	HasMore    bool   `json:"has_more"`
+	Total      *int   `json:"total,omitempty"`
+}
+
+// Meta returns the page's envelope metadata
+func (p Page[T]) Meta() Meta {
+	m := Meta{Limit: p.Limit, Total: p.Total, HasMore: p.Next != nil}
+	if p.Next != nil {
+		m.NextCursor = p.Next.Encode()
+	}
+	return m
+}
+
+// Envelope is the response body of every list endpoint. Endpoints with
+// extra fields embed it.
+type Envelope struct {
+	Data       interface{} `json:"data"`
+	Pagination Meta        `json:"pagination"`
+}
+
+// NewEnvelope wraps a page for the response body
+func NewEnvelope[T any](p Page[T]) Envelope {
+	return Envelope{Data: p.Items, Pagination: p.Meta()}
+}
+
+// SetHeaders mirrors the metadata into X-Total-Count, X-Page-Count and
+// X-Next-Cursor
+func SetHeaders(w http.ResponseWriter, m Meta) {
+	if m.Total != nil {
+		w.Header().Set("X-Total-Count", strconv.Itoa(*m.Total))
+		pages := 0
+		if m.Limit > 0 {
+			pages = (*m.Total + m.Limit - 1) / m.Limit
+		}
+		w.Header().Set("X-Page-Count", strconv.Itoa(pages))
+	}
+	if m.NextCursor != "" {
+		w.Header().Set("X-Next-Cursor", m.NextCursor)
+	}
+}
+
+// Respond writes the page in the list envelope
+func Respond[T any](w http.ResponseWriter, p Page[T]) {
+	RespondWith(w, p.Meta(), NewEnvelope(p))
+}
+
+// RespondWith writes body, an Envelope or a struct embedding one, with the
+// headers for m
+func RespondWith(w http.ResponseWriter, m Meta, body interface{}) {
+	SetHeaders(w, m)
+	utils.RespondWithJSON(w, http.StatusOK, body)
+}
@@ -0,0 +1,132 @@
+package pagination
+
+import (
+	"errors"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	c := Cursor{Key: "2026-10-18 09:30:00+00", ID: "4f1c", Sort: "newest"}
+	got, err := Decode(c.Encode())
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if *got != c {
+		t.Fatalf("expected %+v, got %+v", c, *got)
+	}
+}
+
+func TestDecodeRejectsGarbage(t *testing.T) {
+	for _, token := range []string{"not base64!", "bm90IGpzb24", Cursor{Key: "1"}.Encode()} {
+		if _, err := Decode(token); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("%q: expected ErrInvalidCursor, got %v", token, err)
+		}
+	}
+}
+
+func TestParseLimit(t *testing.T) {
+	cases := []struct {
+		query string
+		want  int
+	}{
+		{"", 50},
+		{"limit=10", 10},
+		{"limit=0", 50},
+		{"limit=abc", 50},
+		{"limit=1000", MaxLimit},
+	}
+	for _, tc := range cases {
+		q, _ := url.ParseQuery(tc.query)
+		p, err := Parse(q, 50)
+		if err != nil {
+			t.Fatalf("%q: %v", tc.query, err)
+		}
+		if p.Limit != tc.want {
+			t.Errorf("%q: expected limit %d, got %d", tc.query, tc.want, p.Limit)
+		}
+	}
+
+	if _, err := Parse(url.Values{"cursor": {"%%"}}, 50); !errors.Is(err, ErrInvalidCursor) {
+		t.Fatalf("expected ErrInvalidCursor for a malformed cursor, got %v", err)
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	if got := (Params{}).Normalize().Limit; got != DefaultLimit {
+		t.Fatalf("expected default limit %d, got %d", DefaultLimit, got)
+	}
+	if got := (Params{Limit: 500}).Normalize().Limit; got != MaxLimit {
+		t.Fatalf("expected limit capped at %d, got %d", MaxLimit, got)
+	}
+}
+
+func TestAfterRejectsOtherSort(t *testing.T) {
+	p := Params{Cursor: &Cursor{Key: "100", ID: "1", Sort: "price_asc"}}
+	if _, err := p.After("newest"); !errors.Is(err, ErrInvalidCursor) {
+		t.Fatalf("expected ErrInvalidCursor, got %v", err)
+	}
+	c, err := p.After("price_asc")
+	if err != nil || c != p.Cursor {
+		t.Fatalf("expected the cursor back, got %v, %v", c, err)
+	}
+	if c, err := (Params{}).After("newest"); c != nil || err != nil {
+		t.Fatalf("expected no cursor on the first page, got %v, %v", c, err)
+	}
+}
+
+func TestKeysetSQL(t *testing.T) {
+	desc := Keyset{Key: "created_at", ID: "id", Dir: Desc}
+	if got := desc.OrderBy(); got != "created_at DESC, id DESC" {
+		t.Errorf("unexpected ORDER BY %q", got)
+	}
+	if got := desc.After("$2", "$3"); got != "(created_at, id) < ($2, $3)" {
+		t.Errorf("unexpected condition %q", got)
+	}
+	asc := Keyset{Key: "p.price_cents", ID: "p.id", Dir: Asc}
+	if got := asc.After("$4", "$5"); got != "(p.price_cents, p.id) > ($4, $5)" {
+		t.Errorf("unexpected condition %q", got)
+	}
+	if got := asc.KeyText(); got != "(p.price_cents)::text" {
+		t.Errorf("unexpected key text %q", got)
+	}
+}
+
+func TestNewPage(t *testing.T) {
+	cursorAt := func(i int) Cursor { return Cursor{Key: "k", ID: string(rune('a' + i))} }
+
+	page := NewPage([]int{1, 2, 3}, 2, cursorAt)
+	if len(page.Items) != 2 || page.Next == nil || page.Next.ID != "b" {
+		t.Fatalf("expected two items and a cursor at the second, got %+v", page)
+	}
+	if m := page.Meta(); !m.HasMore || m.NextCursor == "" {
+		t.Fatalf("expected more pages, got %+v", m)
+	}
+
+	last := NewPage([]int{1, 2}, 2, cursorAt)
+	if len(last.Items) != 2 || last.Next != nil {
+		t.Fatalf("expected a last page, got %+v", last)
+	}
+
+	empty := NewPage[int](nil, 2, cursorAt)
+	if empty.Items == nil {
+		t.Fatalf("empty pages must encode as [] not null")
+	}
+}
+
+func TestSetHeaders(t *testing.T) {
+	page := NewPage([]int{1, 2, 3}, 2, func(i int) Cursor { return Cursor{Key: "k", ID: "x"} }).WithTotal(5)
+	w := httptest.NewRecorder()
+	SetHeaders(w, page.Meta())
+
+	if got := w.Header().Get("X-Total-Count"); got != "5" {
+		t.Errorf("expected X-Total-Count 5, got %q", got)
+	}
+	if got := w.Header().Get("X-Page-Count"); got != "3" {
+		t.Errorf("expected X-Page-Count 3, got %q", got)
+	}
+	if got := w.Header().Get("X-Next-Cursor"); got != page.Next.Encode() {
+		t.Errorf("expected X-Next-Cursor %q, got %q", page.Next.Encode(), got)
+	}
+}
@@ -0,0 +1,35 @@
+package repository
+
+import "fmt"
+
+// Geo conditions use the earthdistance extension. Seller coordinates live
+// in sellers.lat/lng, indexed with ll_to_earth, and service areas in
+// seller_service_areas. Callers alias sellers as s and products as p, and
+// pass SQL expressions (placeholders or literals) for the coordinates.
+
+// SellerDistanceKmSQL is the distance in km from (lat, lng) to the seller,
+// NULL when the seller has no coordinates
+func SellerDistanceKmSQL(lat, lng string) string {
+	return fmt.Sprintf("(earth_distance(ll_to_earth(%s, %s), ll_to_earth(s.lat, s.lng)) / 1000.0)", lat, lng)
+}
+
+// SellerWithinSQL keeps sellers within radiusMeters of (lat, lng). The
+// earth_box test uses the index; the distance test trims the box corners.
+func SellerWithinSQL(lat, lng, radiusMeters string) string {
+	return fmt.Sprintf(`(s.lat IS NOT NULL
+            AND earth_box(ll_to_earth(%[1]s, %[2]s), %[3]s) @> ll_to_earth(s.lat, s.lng)
+            AND earth_distance(ll_to_earth(%[1]s, %[2]s), ll_to_earth(s.lat, s.lng)) <= %[3]s)`,
+		lat, lng, radiusMeters)
+}
+
+// SellerDeliversToSQL keeps sellers with a service area covering (lat, lng).
+// Polygons store x = lng and y = lat.
+func SellerDeliversToSQL(lat, lng string) string {
+	return fmt.Sprintf(`EXISTS (
+            SELECT 1 FROM seller_service_areas a
+            WHERE a.seller_id = p.seller_id
+              AND CASE a.kind
+                  WHEN 'polygon' THEN a.boundary @> point(%[2]s, %[1]s)
+                  ELSE earth_distance(ll_to_earth(a.center_lat, a.center_lng), ll_to_earth(%[1]s, %[2]s)) <= a.radius_km * 1000
+              END)`, lat, lng)
+}
@@ -0,0 +1,443 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Andrew-mugwe/agroai/models"
+	"github.com/Andrew-mugwe/agroai/pagination"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// ErrInsufficientStock is returned when a movement would take a variant's
+// available stock below zero
+var ErrInsufficientStock = errors.New("insufficient stock")
+
+// MovementSortNewest is the only ledger sort; cursors carry it
+const MovementSortNewest = "newest"
+
+// movementKeyset lists ledger entries newest first
+var movementKeyset = pagination.Keyset{Key: "m.created_at", ID: "m.id", Dir: pagination.Desc}
+
+// MovementFilter narrows a seller's ledger. Zero values mean "no filter".
+type MovementFilter struct {
+	SellerID  uuid.UUID
+	ProductID *uuid.UUID
+	VariantID *uuid.UUID
+	OrderID   *uuid.UUID
+	Reason    models.StockReason
+	Since     *time.Time
+}
+
+// InventoryRepository moves variant stock and keeps the inventory ledger.
+// Variant saves through ProductRepository record their stock changes in
+// the same ledger.
+type InventoryRepository struct {
+	db *sql.DB
+}
+
+// NewInventoryRepository creates a new inventory repository
+func NewInventoryRepository(db *sql.DB) *InventoryRepository {
+	return &InventoryRepository{db: db}
+}
+
+// Adjust adds quantity, which may be negative, to a variant's available stock
+func (r *InventoryRepository) Adjust(ctx context.Context, productID, variantID uuid.UUID, quantity int, change models.StockChange, orderID *uuid.UUID) (*models.StockMovement, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	m := &models.StockMovement{
+		ProductID: productID,
+		VariantID: &variantID,
+		Reason:    change.Reason,
+		Quantity:  quantity,
+		OrderID:   orderID,
+		ActorID:   change.ActorID,
+		Note:      change.Note,
+	}
+	err = tx.QueryRowContext(ctx, `
+        UPDATE product_variants
+        SET stock = stock + $3, updated_at = now()
+        WHERE id = $1 AND product_id = $2 AND stock + $3 >= 0
+        RETURNING stock, reserved, price_cents`, variantID, productID, quantity,
+	).Scan(&m.StockAfter, &m.ReservedAfter, &m.PriceCents)
+	if err == sql.ErrNoRows {
+		return nil, variantStockError(ctx, tx, variantID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to adjust stock: %w", err)
+	}
+
+	if err := recordStockMovement(ctx, tx, m); err != nil {
+		return nil, err
+	}
+	if err := refreshVariantSummary(ctx, tx, productID); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Reserve holds stock for an order's items. Either every item is reserved
+// or, with ErrInsufficientStock, none is.
+func (r *InventoryRepository) Reserve(ctx context.Context, orderID uuid.UUID, actorID *uuid.UUID, items []models.OrderItem) ([]models.StockMovement, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var movements []models.StockMovement
+	products := map[uuid.UUID]bool{}
+	for _, item := range items {
+		if item.VariantID == nil || item.Quantity <= 0 {
+			continue
+		}
+
+		variantID := *item.VariantID
+		m := models.StockMovement{
+			VariantID:      &variantID,
+			Reason:         models.StockReservation,
+			Quantity:       -item.Quantity,
+			ReservedChange: item.Quantity,
+			OrderID:        &orderID,
+			ActorID:        actorID,
+		}
+		err := tx.QueryRowContext(ctx, `
+            UPDATE product_variants
+            SET stock = stock - $2, reserved = reserved + $2, updated_at = now()
+            WHERE id = $1 AND stock >= $2
+            RETURNING product_id, stock, reserved, price_cents`, variantID, item.Quantity,
+		).Scan(&m.ProductID, &m.StockAfter, &m.ReservedAfter, &m.PriceCents)
+		if err == sql.ErrNoRows {
+			err = variantStockError(ctx, tx, variantID)
+			return nil, fmt.Errorf("%s: %w", item.ProductName, err)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to reserve stock: %w", err)
+		}
+
+		if err := recordStockMovement(ctx, tx, &m); err != nil {
+			return nil, err
+		}
+		movements = append(movements, m)
+		products[m.ProductID] = true
+	}
+
+	for productID := range products {
+		if err := refreshVariantSummary(ctx, tx, productID); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return movements, nil
+}
+
+// Settle ends whatever an order still has reserved: a sale takes the
+// reserved stock, a release returns it to sale. Orders placed before
+// stock was reserved have nothing to settle.
+func (r *InventoryRepository) Settle(ctx context.Context, orderID uuid.UUID, reason models.StockReason, actorID *uuid.UUID) ([]models.StockMovement, error) {
+	if reason != models.StockSale && reason != models.StockRelease {
+		return nil, fmt.Errorf("cannot settle a reservation as %s", reason)
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Locking the order keeps two settlements from both seeing the reservation
+	if _, err := tx.ExecContext(ctx, `SELECT 1 FROM orders WHERE id = $1 FOR UPDATE`, orderID); err != nil {
+		return nil, fmt.Errorf("failed to lock order: %w", err)
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+        SELECT variant_id, SUM(reserved_change)::int
+        FROM inventory_movements
+        WHERE order_id = $1 AND variant_id IS NOT NULL
+        GROUP BY variant_id
+        HAVING SUM(reserved_change) > 0`, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get order reservations: %w", err)
+	}
+	held := map[uuid.UUID]int{}
+	for rows.Next() {
+		var variantID uuid.UUID
+		var quantity int
+		if err := rows.Scan(&variantID, &quantity); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		held[variantID] = quantity
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var movements []models.StockMovement
+	products := map[uuid.UUID]bool{}
+	for variantID, quantity := range held {
+		m := models.StockMovement{
+			VariantID:      &variantID,
+			Reason:         reason,
+			ReservedChange: -quantity,
+			OrderID:        &orderID,
+			ActorID:        actorID,
+		}
+		if reason == models.StockRelease {
+			m.Quantity = quantity
+		}
+		err := tx.QueryRowContext(ctx, `
+            UPDATE product_variants
+            SET stock = stock + $2, reserved = GREATEST(reserved - $3, 0), updated_at = now()
+            WHERE id = $1
+            RETURNING product_id, stock, reserved, price_cents`, variantID, m.Quantity, quantity,
+		).Scan(&m.ProductID, &m.StockAfter, &m.ReservedAfter, &m.PriceCents)
+		if err == sql.ErrNoRows {
+			// The variant was deleted; its stock already left the ledger
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to settle reservation: %w", err)
+		}
+
+		if err := recordStockMovement(ctx, tx, &m); err != nil {
+			return nil, err
+		}
+		movements = append(movements, m)
+		products[m.ProductID] = true
+	}
+
+	for productID := range products {
+		if err := refreshVariantSummary(ctx, tx, productID); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return movements, nil
+}
+
+// Movements pages through a seller's ledger, newest first
+func (r *InventoryRepository) Movements(ctx context.Context, filter MovementFilter, page pagination.Params) (pagination.Page[models.StockMovement], error) {
+	var none pagination.Page[models.StockMovement]
+	after, err := page.After(MovementSortNewest)
+	if err != nil {
+		return none, err
+	}
+
+	where := "m.seller_id = $1"
+	args := []interface{}{filter.SellerID}
+	add := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		where += fmt.Sprintf(" AND "+condition, len(args))
+	}
+	if filter.ProductID != nil {
+		add("m.product_id = $%d", *filter.ProductID)
+	}
+	if filter.VariantID != nil {
+		add("m.variant_id = $%d", *filter.VariantID)
+	}
+	if filter.OrderID != nil {
+		add("m.order_id = $%d", *filter.OrderID)
+	}
+	if filter.Reason != "" {
+		add("m.reason = $%d", filter.Reason)
+	}
+	if filter.Since != nil {
+		add("m.created_at >= $%d", *filter.Since)
+	}
+
+	var total int
+	if err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM inventory_movements m WHERE "+where, args...).Scan(&total); err != nil {
+		return none, fmt.Errorf("failed to count stock movements: %w", err)
+	}
+
+	if after != nil {
+		args = append(args, after.Key, after.ID)
+		where += " AND " + movementKeyset.After(fmt.Sprintf("$%d", len(args)-1), fmt.Sprintf("$%d", len(args)))
+	}
+	args = append(args, page.FetchLimit())
+	query := fmt.Sprintf(`
+        SELECT m.id, m.product_id, m.variant_id, m.seller_id, m.reason, m.quantity,
+               m.reserved_change, m.stock_after, m.reserved_after, m.price_cents,
+               m.order_id, m.actor_id, m.note, m.created_at, %s
+        FROM inventory_movements m
+        WHERE %s
+        ORDER BY %s
+        LIMIT $%d`, movementKeyset.KeyText(), where, movementKeyset.OrderBy(), len(args))
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return none, fmt.Errorf("failed to get stock movements: %w", err)
+	}
+	defer rows.Close()
+
+	var movements []models.StockMovement
+	var keys []string
+	for rows.Next() {
+		var m models.StockMovement
+		var key string
+		if err := rows.Scan(&m.ID, &m.ProductID, &m.VariantID, &m.SellerID, &m.Reason, &m.Quantity,
+			&m.ReservedChange, &m.StockAfter, &m.ReservedAfter, &m.PriceCents,
+			&m.OrderID, &m.ActorID, &m.Note, &m.CreatedAt, &key); err != nil {
+			return none, fmt.Errorf("failed to scan stock movement: %w", err)
+		}
+		movements = append(movements, m)
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return none, fmt.Errorf("failed to get stock movements: %w", err)
+	}
+
+	return pagination.NewPage(movements, page.Limit, func(i int) pagination.Cursor {
+		return pagination.Cursor{Key: keys[i], ID: movements[i].ID.String(), Sort: MovementSortNewest}
+	}).WithTotal(total), nil
+}
+
+// SetReorderThreshold sets a seller's product threshold; nil clears it
+func (r *InventoryRepository) SetReorderThreshold(ctx context.Context, productID, sellerID uuid.UUID, threshold *int) error {
+	result, err := r.db.ExecContext(ctx, `
+        UPDATE marketplace_products
+        SET reorder_threshold = $3
+        WHERE id = $1 AND seller_id = $2`, productID, sellerID, threshold)
+	if err != nil {
+		return fmt.Errorf("failed to set reorder threshold: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// ClaimLowStockAlerts returns the products, of productIDs or of all when
+// empty, whose stock has fallen to their reorder threshold since they were
+// last alerted, and marks them alerted. Products whose stock has risen
+// above their threshold are re-armed.
+func (r *InventoryRepository) ClaimLowStockAlerts(ctx context.Context, productIDs []uuid.UUID) ([]models.LowStockAlert, error) {
+	ids := make([]string, len(productIDs))
+	for i, id := range productIDs {
+		ids[i] = id.String()
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+        WITH prev AS (
+            SELECT id, low_stock_alerted_at
+            FROM marketplace_products
+            WHERE (cardinality($1::uuid[]) = 0 OR id = ANY($1::uuid[]))
+              AND (reorder_threshold IS NOT NULL OR low_stock_alerted_at IS NOT NULL)
+            FOR UPDATE
+        )
+        UPDATE marketplace_products p
+        SET low_stock_alerted_at = CASE
+                WHEN p.is_active AND p.stock <= p.reorder_threshold THEN COALESCE(p.low_stock_alerted_at, now())
+            END
+        FROM prev
+        WHERE p.id = prev.id
+        RETURNING p.id, p.seller_id, p.title, p.stock, COALESCE(p.reorder_threshold, 0),
+                  prev.low_stock_alerted_at IS NULL AND p.low_stock_alerted_at IS NOT NULL`, pq.Array(ids))
+	if err != nil {
+		return nil, fmt.Errorf("failed to check reorder thresholds: %w", err)
+	}
+	defer rows.Close()
+
+	var alerts []models.LowStockAlert
+	for rows.Next() {
+		var a models.LowStockAlert
+		var crossed bool
+		if err := rows.Scan(&a.ProductID, &a.SellerID, &a.Title, &a.Stock, &a.ReorderThreshold, &crossed); err != nil {
+			return nil, fmt.Errorf("failed to scan low-stock alert: %w", err)
+		}
+		if crossed {
+			alerts = append(alerts, a)
+		}
+	}
+	return alerts, rows.Err()
+}
+
+// ReportItems values a seller's variants and counts their sales between
+// from and to. Stock on hand at from and to is worked back from the ledger.
+func (r *InventoryRepository) ReportItems(ctx context.Context, sellerID uuid.UUID, from, to time.Time) ([]models.InventoryReportItem, error) {
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT v.product_id, v.id, p.title, v.sku, v.pack_size, v.unit, p.currency,
+               v.stock, v.reserved, v.price_cents,
+               COALESCE(SUM(m.quantity + m.reserved_change) FILTER (WHERE m.created_at >= $2), 0)::int,
+               COALESCE(SUM(m.quantity + m.reserved_change) FILTER (WHERE m.created_at >= $3), 0)::int,
+               COALESCE(SUM(-m.reserved_change) FILTER (WHERE m.reason = 'sale' AND m.created_at >= $2 AND m.created_at < $3), 0)::int,
+               COALESCE(SUM(-m.reserved_change * m.price_cents) FILTER (WHERE m.reason = 'sale' AND m.created_at >= $2 AND m.created_at < $3), 0)::bigint
+        FROM product_variants v
+        JOIN marketplace_products p ON p.id = v.product_id
+        LEFT JOIN inventory_movements m ON m.variant_id = v.id
+        WHERE p.seller_id = $1
+        GROUP BY v.id, p.id
+        ORDER BY p.title, v.sku`, sellerID, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get inventory report: %w", err)
+	}
+	defer rows.Close()
+
+	items := []models.InventoryReportItem{}
+	for rows.Next() {
+		var it models.InventoryReportItem
+		var sinceFrom, sinceTo int
+		if err := rows.Scan(&it.ProductID, &it.VariantID, &it.Title, &it.SKU, &it.PackSize, &it.Unit, &it.Currency,
+			&it.Stock, &it.Reserved, &it.PriceCents, &sinceFrom, &sinceTo, &it.SoldUnits, &it.SoldValueCents); err != nil {
+			return nil, fmt.Errorf("failed to scan inventory report: %w", err)
+		}
+		it.OnHand = it.Stock + it.Reserved
+		it.OpeningOnHand = it.OnHand - sinceFrom
+		it.ClosingOnHand = it.OnHand - sinceTo
+		items = append(items, it)
+	}
+	return items, rows.Err()
+}
+
+// recordStockMovement appends m to the ledger, filling in its ID, seller
+// and time
+func recordStockMovement(ctx context.Context, tx *sql.Tx, m *models.StockMovement) error {
+	err := tx.QueryRowContext(ctx, `
+        INSERT INTO inventory_movements (
+            product_id, variant_id, seller_id, reason, quantity, reserved_change,
+            stock_after, reserved_after, price_cents, order_id, actor_id, note
+        )
+        SELECT p.id, $2, p.seller_id, $3, $4, $5, $6, $7, $8, $9, $10, $11
+        FROM marketplace_products p
+        WHERE p.id = $1
+        RETURNING id, seller_id, created_at`,
+		m.ProductID, m.VariantID, m.Reason, m.Quantity, m.ReservedChange,
+		m.StockAfter, m.ReservedAfter, m.PriceCents, m.OrderID, m.ActorID, m.Note,
+	).Scan(&m.ID, &m.SellerID, &m.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to record stock movement: %w", err)
+	}
+	return nil
+}
+
+// variantStockError tells a missing variant from one without enough stock
+func variantStockError(ctx context.Context, tx *sql.Tx, variantID uuid.UUID) error {
+	var stock int
+	err := tx.QueryRowContext(ctx, `SELECT stock FROM product_variants WHERE id = $1`, variantID).Scan(&stock)
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("%w: %d available", ErrInsufficientStock, stock)
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 
 	"github.com/Andrew-mugwe/agroai/models"
+	"github.com/Andrew-mugwe/agroai/pagination"
 	"github.com/google/uuid"
 )
 
@@ -84,78 +85,84 @@ func (r *OrderRepository) GetOrderByID(ctx context.Context, orderID uuid.UUID) (
 	return order, nil
 }
 
-// GetOrdersByUserID retrieves orders for a specific user
-func (r *OrderRepository) GetOrdersByUserID(ctx context.Context, userID uuid.UUID, limit, offset int) ([]models.Order, error) {
-	query := `
-		SELECT id, order_number, user_id, seller_id, status, subtotal, tax_amount, 
-		       shipping_amount, total_amount, currency, payment_status, payment_method,
-		       payment_transaction_id, shipping_address, billing_address, notes,
-		       created_at, updated_at, shipped_at, delivered_at
-		FROM orders 
-		WHERE user_id = $1
-		ORDER BY created_at DESC
-		LIMIT $2 OFFSET $3`
+// OrderSortNewest is the only order list sort; cursors carry it
+const OrderSortNewest = "newest"
+
+// orderKeyset lists orders newest first
+var orderKeyset = pagination.Keyset{Key: "created_at", ID: "id", Dir: pagination.Desc}
+
+// GetOrdersByUserID retrieves a page of orders placed by a user
+func (r *OrderRepository) GetOrdersByUserID(ctx context.Context, userID uuid.UUID, page pagination.Params) (pagination.Page[models.Order], error) {
+	return r.listOrders(ctx, "user_id", userID, page)
+}
 
-	rows, err := r.db.QueryContext(ctx, query, userID, limit, offset)
+// GetOrdersBySellerID retrieves a page of orders for a specific seller
+func (r *OrderRepository) GetOrdersBySellerID(ctx context.Context, sellerID uuid.UUID, page pagination.Params) (pagination.Page[models.Order], error) {
+	return r.listOrders(ctx, "seller_id", sellerID, page)
+}
+
+// listOrders pages through the orders whose column matches ownerID
+func (r *OrderRepository) listOrders(ctx context.Context, column string, ownerID uuid.UUID, page pagination.Params) (pagination.Page[models.Order], error) {
+	var none pagination.Page[models.Order]
+	after, err := page.After(OrderSortNewest)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get orders: %w", err)
+		return none, err
 	}
-	defer rows.Close()
 
-	var orders []models.Order
-	for rows.Next() {
-		order := models.Order{}
-		err := rows.Scan(
-			&order.ID, &order.OrderNumber, &order.UserID, &order.SellerID, &order.Status,
-			&order.Subtotal, &order.TaxAmount, &order.ShippingAmount, &order.TotalAmount,
-			&order.Currency, &order.PaymentStatus, &order.PaymentMethod, &order.PaymentTransactionID,
-			&order.ShippingAddress, &order.BillingAddress, &order.Notes,
-			&order.CreatedAt, &order.UpdatedAt, &order.ShippedAt, &order.DeliveredAt,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan order: %w", err)
-		}
-		orders = append(orders, order)
-	}
+	where := column + " = $1"
+	args := []interface{}{ownerID}
 
-	return orders, nil
-}
+	var total int
+	if err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM orders WHERE "+where, args...).Scan(&total); err != nil {
+		return none, fmt.Errorf("failed to count orders: %w", err)
+	}
 
-// GetOrdersBySellerID retrieves orders for a specific seller
-func (r *OrderRepository) GetOrdersBySellerID(ctx context.Context, sellerID uuid.UUID, limit, offset int) ([]models.Order, error) {
-	query := `
-		SELECT id, order_number, user_id, seller_id, status, subtotal, tax_amount, 
+	if after != nil {
+		args = append(args, after.Key, after.ID)
+		where += " AND " + orderKeyset.After("$2", "$3")
+	}
+	args = append(args, page.FetchLimit())
+	query := fmt.Sprintf(`
+		SELECT id, order_number, user_id, seller_id, status, subtotal, tax_amount,
 		       shipping_amount, total_amount, currency, payment_status, payment_method,
 		       payment_transaction_id, shipping_address, billing_address, notes,
-		       created_at, updated_at, shipped_at, delivered_at
-		FROM orders 
-		WHERE seller_id = $1
-		ORDER BY created_at DESC
-		LIMIT $2 OFFSET $3`
+		       created_at, updated_at, shipped_at, delivered_at, %s
+		FROM orders
+		WHERE %s
+		ORDER BY %s
+		LIMIT $%d`, orderKeyset.KeyText(), where, orderKeyset.OrderBy(), len(args))
 
-	rows, err := r.db.QueryContext(ctx, query, sellerID, limit, offset)
+	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get orders: %w", err)
+		return none, fmt.Errorf("failed to get orders: %w", err)
 	}
 	defer rows.Close()
 
 	var orders []models.Order
+	var keys []string
 	for rows.Next() {
 		order := models.Order{}
+		var key string
 		err := rows.Scan(
 			&order.ID, &order.OrderNumber, &order.UserID, &order.SellerID, &order.Status,
 			&order.Subtotal, &order.TaxAmount, &order.ShippingAmount, &order.TotalAmount,
 			&order.Currency, &order.PaymentStatus, &order.PaymentMethod, &order.PaymentTransactionID,
 			&order.ShippingAddress, &order.BillingAddress, &order.Notes,
-			&order.CreatedAt, &order.UpdatedAt, &order.ShippedAt, &order.DeliveredAt,
+			&order.CreatedAt, &order.UpdatedAt, &order.ShippedAt, &order.DeliveredAt, &key,
 		)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan order: %w", err)
+			return none, fmt.Errorf("failed to scan order: %w", err)
 		}
 		orders = append(orders, order)
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return none, fmt.Errorf("failed to get orders: %w", err)
 	}
 
-	return orders, nil
+	return pagination.NewPage(orders, page.Limit, func(i int) pagination.Cursor {
+		return pagination.Cursor{Key: keys[i], ID: orders[i].ID.String(), Sort: OrderSortNewest}
+	}).WithTotal(total), nil
 }
 
 // UpdateOrderStatus updates the status of an order
@@ -221,12 +228,12 @@ func (r *OrderRepository) UpdatePaymentStatus(ctx context.Context, orderID uuid.
 // AddOrderItem adds an item to an order
 func (r *OrderRepository) AddOrderItem(ctx context.Context, item *models.OrderItem) error {
 	query := `
-		INSERT INTO order_items (order_id, product_id, product_name, product_sku, quantity, unit_price, total_price)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		INSERT INTO order_items (order_id, product_id, variant_id, product_name, product_sku, quantity, unit_price, total_price)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
 		RETURNING id, created_at`
 
 	err := r.db.QueryRowContext(ctx, query,
-		item.OrderID, item.ProductID, item.ProductName, item.ProductSKU,
+		item.OrderID, item.ProductID, item.VariantID, item.ProductName, item.ProductSKU,
 		item.Quantity, item.UnitPrice, item.TotalPrice,
 	).Scan(&item.ID, &item.CreatedAt)
 
@@ -260,7 +267,7 @@ func (r *OrderRepository) AddPaymentTransaction(ctx context.Context, transaction
 // loadOrderItems loads order items for an order
 func (r *OrderRepository) loadOrderItems(ctx context.Context, order *models.Order) error {
 	query := `
-		SELECT id, order_id, product_id, product_name, product_sku, quantity, unit_price, total_price, created_at
+		SELECT id, order_id, product_id, variant_id, product_name, product_sku, quantity, unit_price, total_price, created_at
 		FROM order_items 
 		WHERE order_id = $1
 		ORDER BY created_at`
@@ -275,7 +282,7 @@ func (r *OrderRepository) loadOrderItems(ctx context.Context, order *models.Orde
 	for rows.Next() {
 		item := models.OrderItem{}
 		err := rows.Scan(
-			&item.ID, &item.OrderID, &item.ProductID, &item.ProductName,
+			&item.ID, &item.OrderID, &item.ProductID, &item.VariantID, &item.ProductName,
 			&item.ProductSKU, &item.Quantity, &item.UnitPrice, &item.TotalPrice, &item.CreatedAt,
 		)
 		if err != nil {
@@ -3,18 +3,64 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+
 	"github.com/Andrew-mugwe/agroai/models"
+	"github.com/Andrew-mugwe/agroai/pagination"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// Product sort orders
+const (
+	ProductSortNewest    = "newest"
+	ProductSortPriceAsc  = "price_asc"
+	ProductSortPriceDesc = "price_desc"
+	ProductSortRelevance = "relevance"
+	// ProductSortUnitPriceAsc orders by the cheapest price per base unit;
+	// it needs ProductFilter.BaseUnit
+	ProductSortUnitPriceAsc = "unit_price_asc"
+	// ProductSortDistance orders nearest sellers first; it needs ProductFilter.Near
+	ProductSortDistance = "distance"
 )
 
+// ProductFilter narrows catalogue reads. Zero values mean "no filter".
+type ProductFilter struct {
+	SellerID      *uuid.UUID
+	Category      string
+	MinPriceCents *int64
+	MaxPriceCents *int64
+	Query         string
+	Active        *bool
+	// BaseUnit keeps products with an active variant sold by weight (kg),
+	// volume (l) or count
+	BaseUnit models.UnitOfMeasure
+	// Near is the buyer's location. With RadiusKm it keeps sellers within
+	// that distance; with DeliversTo it keeps sellers whose service areas
+	// cover it. Results carry their distance from Near.
+	Near       *models.GeoPoint
+	RadiusKm   float64
+	DeliversTo bool
+	Sort       string
+}
+
 type ProductRepository interface {
 	Create(ctx context.Context, product *models.Product) error
 	Update(ctx context.Context, product *models.Product) error
-	Delete(ctx context.Context, id uuid.UUID, traderID uuid.UUID) error
+	Delete(ctx context.Context, id uuid.UUID, sellerID uuid.UUID) error
 	GetByID(ctx context.Context, id uuid.UUID) (*models.Product, error)
-	GetByTrader(ctx context.Context, traderID uuid.UUID, limit, offset int) ([]*models.Product, error)
-	CountByTrader(ctx context.Context, traderID uuid.UUID) (int, error)
+	List(ctx context.Context, filter ProductFilter) ([]*models.Product, error)
+	ListPage(ctx context.Context, filter ProductFilter, page pagination.Params) (pagination.Page[*models.Product], error)
+	ListByIDs(ctx context.Context, ids []uuid.UUID) ([]*models.Product, error)
+	Count(ctx context.Context, filter ProductFilter) (int, error)
+	ListCategories(ctx context.Context) ([]string, error)
+
+	CreateVariant(ctx context.Context, variant *models.ProductVariant) error
+	UpdateVariant(ctx context.Context, variant *models.ProductVariant) error
+	DeleteVariant(ctx context.Context, productID, variantID uuid.UUID) error
 }
 
 type productRepository struct {
@@ -25,70 +71,130 @@ func NewProductRepository(db *sql.DB) ProductRepository {
 	return &productRepository{db: db}
 }
 
+// SellerLocationExpr is the seller's city, falling back to the country. It
+// is the region listings are browsed and priced by; sellers are joined as s.
+const SellerLocationExpr = `NULLIF(COALESCE(NULLIF(s.location->>'city', ''), s.location->>'country'), '')`
+
+// productSelect reads catalogue rows together with the seller summary shown
+// on listings
+var productSelect = productSelectWith("NULL::float8")
+
+// productSelectWith is productSelect with distanceKm as the distance column,
+// followed by any extra columns
+func productSelectWith(distanceKm string, extra ...string) string {
+	columns := append([]string{distanceKm}, extra...)
+	return `
+        SELECT p.id, p.seller_id, p.title, p.description, p.category,
+               p.price_cents, p.currency, p.stock, p.images, p.is_active,
+               p.created_at, p.updated_at, p.reorder_threshold,
+               s.name, s.verified, rs.avg_rating, rs.reviews_count,
+               ` + SellerLocationExpr + `,
+               ` + strings.Join(columns, ", ") + `
+        FROM marketplace_products p` + productJoins
+}
+
+// productJoins attaches the seller and their published review summary
+const productJoins = `
+        LEFT JOIN sellers s ON s.user_id = p.seller_id
+        LEFT JOIN LATERAL (
+            SELECT AVG(r.rating)::float8 AS avg_rating, COUNT(*)::int AS reviews_count
+            FROM reviews r
+            WHERE r.seller_id = p.seller_id AND r.status = 'published'
+        ) rs ON true`
+
+// Create inserts the product and its variants in one transaction
 func (r *productRepository) Create(ctx context.Context, product *models.Product) error {
+	images, err := encodeImages(product.Images)
+	if err != nil {
+		return err
+	}
+	product.SummariseVariants()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
 	query := `
         INSERT INTO marketplace_products (
-            trader_id, name, description, price, stock, category, image_url, is_active
-        ) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+            seller_id, title, description, category, price_cents, currency, stock, images, is_active,
+            reorder_threshold
+        ) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
         RETURNING id, created_at, updated_at`
 
-	return r.db.QueryRowContext(
+	err = tx.QueryRowContext(
 		ctx,
 		query,
-		product.TraderID,
-		product.Name,
+		product.SellerID,
+		product.Title,
 		product.Description,
-		product.Price,
-		product.Stock,
 		product.Category,
-		product.ImageURL,
+		product.PriceCents,
+		product.Currency,
+		product.Stock,
+		images,
 		product.IsActive,
+		product.ReorderThreshold,
 	).Scan(&product.ID, &product.CreatedAt, &product.UpdatedAt)
+	if err != nil {
+		return err
+	}
+
+	for i := range product.Variants {
+		variant := &product.Variants[i]
+		variant.ProductID = product.ID
+		if variant.SKU == "" {
+			variant.SKU = variant.DefaultSKU()
+		}
+		if err := insertVariant(ctx, tx, variant); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
 }
 
 func (r *productRepository) Update(ctx context.Context, product *models.Product) error {
+	images, err := encodeImages(product.Images)
+	if err != nil {
+		return err
+	}
+
 	query := `
         UPDATE marketplace_products
-        SET name = $1, description = $2, price = $3, stock = $4, 
-            category = $5, image_url = $6, is_active = $7
-        WHERE id = $8 AND trader_id = $9
+        SET title = $1, description = $2, category = $3, price_cents = $4,
+            currency = $5, stock = $6, images = $7, is_active = $8
+        WHERE id = $9 AND seller_id = $10
         RETURNING updated_at`
 
-	result, err := r.db.ExecContext(
+	err = r.db.QueryRowContext(
 		ctx,
 		query,
-		product.Name,
+		product.Title,
 		product.Description,
-		product.Price,
-		product.Stock,
 		product.Category,
-		product.ImageURL,
+		product.PriceCents,
+		product.Currency,
+		product.Stock,
+		images,
 		product.IsActive,
 		product.ID,
-		product.TraderID,
-	)
-	if err != nil {
-		return err
-	}
-
-	rows, err := result.RowsAffected()
+		product.SellerID,
+	).Scan(&product.UpdatedAt)
 	if err != nil {
 		return err
 	}
 
-	if rows == 0 {
-		return sql.ErrNoRows
-	}
-
 	return nil
 }
 
-func (r *productRepository) Delete(ctx context.Context, id uuid.UUID, traderID uuid.UUID) error {
+func (r *productRepository) Delete(ctx context.Context, id uuid.UUID, sellerID uuid.UUID) error {
 	query := `
         DELETE FROM marketplace_products
-        WHERE id = $1 AND trader_id = $2`
+        WHERE id = $1 AND seller_id = $2`
 
-	result, err := r.db.ExecContext(ctx, query, id, traderID)
+	result, err := r.db.ExecContext(ctx, query, id, sellerID)
 	if err != nil {
 		return err
 	}
@@ -106,84 +212,328 @@ func (r *productRepository) Delete(ctx context.Context, id uuid.UUID, traderID u
 }
 
 func (r *productRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Product, error) {
-	query := `
-        SELECT id, trader_id, name, description, price, stock,
-               category, image_url, is_active, created_at, updated_at
-        FROM marketplace_products
-        WHERE id = $1`
-
-	product := &models.Product{}
-	err := r.db.QueryRowContext(ctx, query, id).Scan(
-		&product.ID,
-		&product.TraderID,
-		&product.Name,
-		&product.Description,
-		&product.Price,
-		&product.Stock,
-		&product.Category,
-		&product.ImageURL,
-		&product.IsActive,
-		&product.CreatedAt,
-		&product.UpdatedAt,
-	)
+	product, err := scanProduct(r.db.QueryRowContext(ctx, productSelect+`
+        WHERE p.id = $1`, id))
 	if err != nil {
 		return nil, err
 	}
 
+	if err := r.loadVariants(ctx, []*models.Product{product}); err != nil {
+		return nil, err
+	}
+
 	return product, nil
 }
 
-func (r *productRepository) GetByTrader(ctx context.Context, traderID uuid.UUID, limit, offset int) ([]*models.Product, error) {
-	query := `
-        SELECT id, trader_id, name, description, price, stock,
-               category, image_url, is_active, created_at, updated_at
-        FROM marketplace_products
-        WHERE trader_id = $1
-        ORDER BY created_at DESC
-        LIMIT $2 OFFSET $3`
+// List returns every product matching the filter, in its sort order
+func (r *productRepository) List(ctx context.Context, filter ProductFilter) ([]*models.Product, error) {
+	q := filter.build()
 
-	rows, err := r.db.QueryContext(ctx, query, traderID, limit, offset)
+	rows, err := r.db.QueryContext(ctx, productSelectWith(q.distanceKm)+q.where+" ORDER BY "+q.keyset.OrderBy(), q.args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var products []*models.Product
+	products := []*models.Product{}
 	for rows.Next() {
-		product := &models.Product{}
-		err := rows.Scan(
-			&product.ID,
-			&product.TraderID,
-			&product.Name,
-			&product.Description,
-			&product.Price,
-			&product.Stock,
-			&product.Category,
-			&product.ImageURL,
-			&product.IsActive,
-			&product.CreatedAt,
-			&product.UpdatedAt,
-		)
+		product, err := scanProduct(rows)
 		if err != nil {
 			return nil, err
 		}
 		products = append(products, product)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := r.loadVariants(ctx, products); err != nil {
+		return nil, err
+	}
 
 	return products, nil
 }
 
-func (r *productRepository) CountByTrader(ctx context.Context, traderID uuid.UUID) (int, error) {
-	var count int
-	query := `
-        SELECT COUNT(*)
-        FROM marketplace_products
-        WHERE trader_id = $1`
+// ListPage returns the page of matching products after page.Cursor. The
+// total is left to Count.
+func (r *productRepository) ListPage(ctx context.Context, filter ProductFilter, page pagination.Params) (pagination.Page[*models.Product], error) {
+	q := filter.build()
+	after, err := page.After(q.sort)
+	if err != nil {
+		return pagination.Page[*models.Product]{}, err
+	}
+
+	where, args := q.where, q.args
+	if after != nil {
+		args = append(args, after.Key, after.ID)
+		cond := q.keyset.After(fmt.Sprintf("$%d", len(args)-1), fmt.Sprintf("$%d", len(args)))
+		if where == "" {
+			where = " WHERE " + cond
+		} else {
+			where += " AND " + cond
+		}
+	}
+	args = append(args, page.FetchLimit())
+	query := productSelectWith(q.distanceKm, q.keyset.KeyText()) + where +
+		" ORDER BY " + q.keyset.OrderBy() + fmt.Sprintf(" LIMIT $%d", len(args))
 
-	err := r.db.QueryRowContext(ctx, query, traderID).Scan(&count)
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return pagination.Page[*models.Product]{}, err
+	}
+	defer rows.Close()
+
+	products := []*models.Product{}
+	var keys []string
+	for rows.Next() {
+		var key string
+		product, err := scanProduct(rows, &key)
+		if err != nil {
+			return pagination.Page[*models.Product]{}, err
+		}
+		products = append(products, product)
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return pagination.Page[*models.Product]{}, err
+	}
+
+	result := pagination.NewPage(products, page.Limit, func(i int) pagination.Cursor {
+		return pagination.Cursor{Key: keys[i], ID: products[i].ID.String(), Sort: q.sort}
+	})
+	if err := r.loadVariants(ctx, result.Items); err != nil {
+		return pagination.Page[*models.Product]{}, err
+	}
+
+	return result, nil
+}
+
+// ListByIDs loads products in the order of ids; unknown IDs are skipped
+func (r *productRepository) ListByIDs(ctx context.Context, ids []uuid.UUID) ([]*models.Product, error) {
+	if len(ids) == 0 {
+		return []*models.Product{}, nil
+	}
+
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = id.String()
+	}
+
+	rows, err := r.db.QueryContext(ctx, productSelect+`
+        WHERE p.id = ANY($1::uuid[])`, pq.Array(keys))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byID := make(map[uuid.UUID]*models.Product, len(ids))
+	for rows.Next() {
+		product, err := scanProduct(rows)
+		if err != nil {
+			return nil, err
+		}
+		byID[product.ID] = product
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	products := make([]*models.Product, 0, len(byID))
+	for _, id := range ids {
+		if p, ok := byID[id]; ok {
+			products = append(products, p)
+		}
+	}
+
+	if err := r.loadVariants(ctx, products); err != nil {
+		return nil, err
+	}
+
+	return products, nil
+}
+
+func (r *productRepository) Count(ctx context.Context, filter ProductFilter) (int, error) {
+	q := filter.build()
+
+	var count int
+	query := "SELECT COUNT(*) FROM marketplace_products p LEFT JOIN sellers s ON s.user_id = p.seller_id" + q.where
+	err := r.db.QueryRowContext(ctx, query, q.args...).Scan(&count)
 	if err != nil {
 		return 0, err
 	}
 
 	return count, nil
 }
+
+func (r *productRepository) ListCategories(ctx context.Context) ([]string, error) {
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT DISTINCT category::text
+        FROM marketplace_products
+        WHERE is_active = true
+        ORDER BY 1`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	categories := []string{}
+	for rows.Next() {
+		var category string
+		if err := rows.Scan(&category); err != nil {
+			return nil, err
+		}
+		categories = append(categories, category)
+	}
+
+	return categories, rows.Err()
+}
+
+// productQuery is the WHERE clause, arguments, sort order and distance
+// column for a filter
+type productQuery struct {
+	where      string
+	args       []interface{}
+	sort       string
+	keyset     pagination.Keyset
+	distanceKm string
+}
+
+func (f ProductFilter) build() productQuery {
+	var q productQuery
+	var conditions []string
+	add := func(condition string, arg interface{}) int {
+		q.args = append(q.args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(q.args)))
+		return len(q.args)
+	}
+
+	if f.SellerID != nil {
+		add("p.seller_id = $%d", *f.SellerID)
+	}
+	if f.Category != "" {
+		add("p.category::text = $%d", f.Category)
+	}
+	if f.MinPriceCents != nil {
+		add("p.price_cents >= $%d", *f.MinPriceCents)
+	}
+	if f.MaxPriceCents != nil {
+		add("p.price_cents <= $%d", *f.MaxPriceCents)
+	}
+	if f.Active != nil {
+		add("p.is_active = $%d", *f.Active)
+	}
+	q.distanceKm = "NULL::float8"
+	if f.Near != nil {
+		// Each coordinate is bound once and referenced by number
+		arg := func(v interface{}) string {
+			q.args = append(q.args, v)
+			return fmt.Sprintf("$%d", len(q.args))
+		}
+		lat, lng := arg(f.Near.Lat), arg(f.Near.Lng)
+		q.distanceKm = SellerDistanceKmSQL(lat, lng)
+		if f.RadiusKm > 0 {
+			conditions = append(conditions, SellerWithinSQL(lat, lng, arg(f.RadiusKm*1000)))
+		}
+		if f.DeliversTo {
+			conditions = append(conditions, SellerDeliversToSQL(lat, lng))
+		}
+	}
+	var baseUnitArg, queryArg int
+	if f.BaseUnit != "" {
+		baseUnitArg = add(`EXISTS (
+            SELECT 1 FROM product_variants v
+            WHERE v.product_id = p.id AND v.is_active AND v.base_unit = $%d)`, f.BaseUnit)
+	}
+	if strings.TrimSpace(f.Query) != "" {
+		queryArg = add("p.search_tsv @@ plainto_tsquery('simple', $%d)", f.Query)
+	}
+
+	if len(conditions) > 0 {
+		q.where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	// Every order ends with p.id so keyset cursors are unambiguous
+	q.sort = ProductSortNewest
+	q.keyset = pagination.Keyset{Key: "p.created_at", ID: "p.id", Dir: pagination.Desc}
+	switch {
+	case f.Sort == ProductSortPriceAsc:
+		q.sort = f.Sort
+		q.keyset = pagination.Keyset{Key: "p.price_cents", ID: "p.id", Dir: pagination.Asc}
+	case f.Sort == ProductSortPriceDesc:
+		q.sort = f.Sort
+		q.keyset = pagination.Keyset{Key: "p.price_cents", ID: "p.id", Dir: pagination.Desc}
+	case f.Sort == ProductSortRelevance && queryArg > 0:
+		q.sort = f.Sort
+		q.keyset = pagination.Keyset{
+			Key: fmt.Sprintf("ts_rank(p.search_tsv, plainto_tsquery('simple', $%d))", queryArg),
+			ID:  "p.id",
+			Dir: pagination.Desc,
+		}
+	case f.Sort == ProductSortDistance && f.Near != nil:
+		// Sellers without coordinates sort last
+		q.sort = f.Sort
+		q.keyset = pagination.Keyset{Key: "COALESCE(" + q.distanceKm + ", 'Infinity'::float8)", ID: "p.id", Dir: pagination.Asc}
+	case f.Sort == ProductSortUnitPriceAsc && baseUnitArg > 0:
+		// The BaseUnit filter guarantees a matching variant, so the key is never NULL
+		q.sort = f.Sort
+		q.keyset = pagination.Keyset{Key: fmt.Sprintf(`(
+            SELECT MIN(v.unit_price_cents) FROM product_variants v
+            WHERE v.product_id = p.id AND v.is_active AND v.base_unit = $%d)`, baseUnitArg), ID: "p.id", Dir: pagination.Asc}
+	}
+
+	return q
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanProduct reads a row of productSelect; extra receives any extra columns
+func scanProduct(row rowScanner, extra ...interface{}) (*models.Product, error) {
+	product := &models.Product{}
+	var images []byte
+	dest := []interface{}{
+		&product.ID,
+		&product.SellerID,
+		&product.Title,
+		&product.Description,
+		&product.Category,
+		&product.PriceCents,
+		&product.Currency,
+		&product.Stock,
+		&images,
+		&product.IsActive,
+		&product.CreatedAt,
+		&product.UpdatedAt,
+		&product.ReorderThreshold,
+		&product.SellerName,
+		&product.SellerVerified,
+		&product.SellerRating,
+		&product.SellerReviewsCount,
+		&product.SellerLocation,
+		&product.DistanceKm,
+	}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+
+	product.Images = []string{}
+	if len(images) > 0 {
+		if err := json.Unmarshal(images, &product.Images); err != nil {
+			return nil, fmt.Errorf("failed to decode product images: %w", err)
+		}
+	}
+
+	return product, nil
+}
+
+func encodeImages(images []string) ([]byte, error) {
+	if images == nil {
+		images = []string{}
+	}
+	data, err := json.Marshal(images)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode product images: %w", err)
+	}
+	return data, nil
+}
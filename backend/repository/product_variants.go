@@ -0,0 +1,242 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/Andrew-mugwe/agroai/models"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const variantColumns = `
+        id, product_id, sku, pack_size, unit, price_cents, stock, barcode,
+        is_active, base_unit, unit_price_cents, reserved, created_at, updated_at`
+
+// CreateVariant adds a variant and refreshes the product's price and stock summary
+func (r *productRepository) CreateVariant(ctx context.Context, variant *models.ProductVariant) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := insertVariant(ctx, tx, variant); err != nil {
+		return err
+	}
+	if err := refreshVariantSummary(ctx, tx, variant.ProductID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UpdateVariant saves a variant and refreshes the product's price and stock summary
+func (r *productRepository) UpdateVariant(ctx context.Context, variant *models.ProductVariant) error {
+	variant.ComputeUnitPrice()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// The old row is locked and read in the same statement so concurrent
+	// updates each record the price and stock they replaced
+	query := `
+        WITH old AS (
+            SELECT price_cents, stock FROM product_variants
+            WHERE id = $10 AND product_id = $11
+            FOR UPDATE
+        )
+        UPDATE product_variants
+        SET sku = $1, pack_size = $2, unit = $3, price_cents = $4, stock = $5,
+            barcode = $6, is_active = $7, base_unit = $8, unit_price_cents = $9,
+            updated_at = now()
+        WHERE id = $10 AND product_id = $11
+        RETURNING updated_at, reserved, (SELECT price_cents FROM old), (SELECT stock FROM old)`
+
+	var previous int64
+	var previousStock int
+	err = tx.QueryRowContext(ctx, query,
+		variant.SKU, variant.PackSize, variant.Unit, variant.PriceCents, variant.Stock,
+		variant.Barcode, variant.IsActive, variant.BaseUnit, variant.UnitPriceCents,
+		variant.ID, variant.ProductID,
+	).Scan(&variant.UpdatedAt, &variant.Reserved, &previous, &previousStock)
+	if err != nil {
+		return err
+	}
+	if previous != variant.PriceCents {
+		if err := recordPrice(ctx, tx, variant, &previous); err != nil {
+			return err
+		}
+	}
+	if previousStock != variant.Stock {
+		if err := recordVariantStock(ctx, tx, variant, variant.Stock-previousStock, ""); err != nil {
+			return err
+		}
+	}
+	if err := refreshVariantSummary(ctx, tx, variant.ProductID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeleteVariant removes a variant and refreshes the product's price and stock summary
+func (r *productRepository) DeleteVariant(ctx context.Context, productID, variantID uuid.UUID) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// The variant's remaining stock leaves the ledger with it
+	var variant models.ProductVariant
+	err = tx.QueryRowContext(ctx, `
+        DELETE FROM product_variants
+        WHERE id = $1 AND product_id = $2
+        RETURNING id, product_id, price_cents, stock, reserved`, variantID, productID,
+	).Scan(&variant.ID, &variant.ProductID, &variant.PriceCents, &variant.Stock, &variant.Reserved)
+	if err != nil {
+		return err
+	}
+	if variant.Stock != 0 {
+		if err := recordStockMovement(ctx, tx, &models.StockMovement{
+			ProductID:     productID,
+			Reason:        models.StockAdjustment,
+			Quantity:      -variant.Stock,
+			ReservedAfter: variant.Reserved,
+			PriceCents:    variant.PriceCents,
+			Note:          "Variant deleted",
+		}); err != nil {
+			return err
+		}
+	}
+
+	if err := refreshVariantSummary(ctx, tx, productID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func insertVariant(ctx context.Context, tx *sql.Tx, variant *models.ProductVariant) error {
+	variant.ComputeUnitPrice()
+
+	query := `
+        INSERT INTO product_variants (
+            product_id, sku, pack_size, unit, price_cents, stock, barcode,
+            is_active, base_unit, unit_price_cents
+        ) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+        RETURNING id, created_at, updated_at`
+
+	err := tx.QueryRowContext(ctx, query,
+		variant.ProductID, variant.SKU, variant.PackSize, variant.Unit, variant.PriceCents,
+		variant.Stock, variant.Barcode, variant.IsActive, variant.BaseUnit, variant.UnitPriceCents,
+	).Scan(&variant.ID, &variant.CreatedAt, &variant.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	if err := recordPrice(ctx, tx, variant, nil); err != nil {
+		return err
+	}
+	if variant.Stock == 0 {
+		return nil
+	}
+	return recordVariantStock(ctx, tx, variant, variant.Stock, "Opening stock")
+}
+
+// recordVariantStock records a change of quantity to a saved variant's
+// available stock, for the reason in its StockChange
+func recordVariantStock(ctx context.Context, tx *sql.Tx, variant *models.ProductVariant, quantity int, note string) error {
+	change := models.StockChange{Reason: models.StockAdjustment}
+	if variant.StockChange != nil {
+		change = *variant.StockChange
+	}
+	if change.Note != "" {
+		note = change.Note
+	}
+
+	variantID := variant.ID
+	err := recordStockMovement(ctx, tx, &models.StockMovement{
+		ProductID:     variant.ProductID,
+		VariantID:     &variantID,
+		Reason:        change.Reason,
+		Quantity:      quantity,
+		StockAfter:    variant.Stock,
+		ReservedAfter: variant.Reserved,
+		PriceCents:    variant.PriceCents,
+		ActorID:       change.ActorID,
+		Note:          note,
+	})
+	return err
+}
+
+// recordPrice appends the variant's current price to its price history.
+// previous is nil for a new variant.
+func recordPrice(ctx context.Context, tx *sql.Tx, variant *models.ProductVariant, previous *int64) error {
+	_, err := tx.ExecContext(ctx, `
+        INSERT INTO product_price_history (
+            product_id, variant_id, price_cents, previous_price_cents, unit_price_cents, base_unit
+        ) VALUES ($1, $2, $3, $4, $5, $6)`,
+		variant.ProductID, variant.ID, variant.PriceCents, previous, variant.UnitPriceCents, variant.BaseUnit)
+	return err
+}
+
+// refreshVariantSummary keeps the product's listing price (cheapest active
+// variant) and stock (sum of active variants) in step with its variants
+func refreshVariantSummary(ctx context.Context, tx *sql.Tx, productID uuid.UUID) error {
+	_, err := tx.ExecContext(ctx, `
+        UPDATE marketplace_products p
+        SET price_cents = COALESCE(v.min_price, p.price_cents),
+            stock = COALESCE(v.total_stock, 0)
+        FROM (
+            SELECT MIN(price_cents) AS min_price, SUM(stock)::int AS total_stock
+            FROM product_variants
+            WHERE product_id = $1 AND is_active
+        ) v
+        WHERE p.id = $1`, productID)
+	return err
+}
+
+// loadVariants attaches variants to products with one query
+func (r *productRepository) loadVariants(ctx context.Context, products []*models.Product) error {
+	if len(products) == 0 {
+		return nil
+	}
+
+	ids := make([]string, len(products))
+	byID := make(map[uuid.UUID]*models.Product, len(products))
+	for i, p := range products {
+		ids[i] = p.ID.String()
+		byID[p.ID] = p
+		p.Variants = []models.ProductVariant{}
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT`+variantColumns+`
+        FROM product_variants
+        WHERE product_id = ANY($1::uuid[])
+        ORDER BY product_id, unit_price_cents, price_cents`, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var v models.ProductVariant
+		if err := rows.Scan(
+			&v.ID, &v.ProductID, &v.SKU, &v.PackSize, &v.Unit, &v.PriceCents, &v.Stock, &v.Barcode,
+			&v.IsActive, &v.BaseUnit, &v.UnitPriceCents, &v.Reserved, &v.CreatedAt, &v.UpdatedAt,
+		); err != nil {
+			return err
+		}
+		if p, ok := byID[v.ProductID]; ok {
+			p.Variants = append(p.Variants, v)
+		}
+	}
+
+	return rows.Err()
+}
@@ -3,21 +3,29 @@ package routes
 // Flow14.1.1
 
 import (
-	"database/sql"
-
 	"github.com/Andrew-mugwe/agroai/handlers"
+	"github.com/Andrew-mugwe/agroai/repository"
 	"github.com/Andrew-mugwe/agroai/services/marketplace"
+	"github.com/Andrew-mugwe/agroai/services/media"
+	"github.com/Andrew-mugwe/agroai/services/pricing"
+	"github.com/Andrew-mugwe/agroai/services/search"
 	"github.com/gorilla/mux"
 )
 
-func RegisterMarketplaceRoutes(router *mux.Router, db *sql.DB) {
-	svc := marketplace.NewService(db)
-	public := handlers.NewPublicProductHandler(svc)
+func RegisterMarketplaceRoutes(router *mux.Router, productRepo repository.ProductRepository, searchService *search.Service, mediaService *media.Service, pricingService *pricing.Service) {
+	svc := marketplace.NewService(productRepo, searchService)
+	public := handlers.NewPublicProductHandler(svc, mediaService, pricingService)
+	pricingHandler := handlers.NewPricingHandler(pricingService)
 
 	// Public product listing
 	router.HandleFunc("/api/marketplace/products", public.ListProducts).Methods("GET")
 	router.HandleFunc("/api/marketplace/products/{id}", public.GetProduct).Methods("GET")
 	router.HandleFunc("/api/marketplace/categories", public.ListCategories).Methods("GET")
+	router.HandleFunc("/api/marketplace/search", public.Search).Methods("GET")
+
+	// Market price intelligence
+	router.HandleFunc("/api/marketplace/products/{id}/price-history", pricingHandler.GetPriceHistory).Methods("GET")
+	router.HandleFunc("/api/marketplace/prices", pricingHandler.ListMarketPrices).Methods("GET")
 
 	// Orders: reuse existing order handler but mount marketplace paths for clarity
 	// Note: these require auth and role checks already in underlying handler
@@ -10,20 +10,15 @@ import (
 	"github.com/Andrew-mugwe/agroai/services/messaging"
 )
 
-// InitMessagingRoutes initializes messaging routes
-func InitMessagingRoutes(router *mux.Router, db *sql.DB) {
+// InitMessagingRoutes initializes the legacy messaging routes, which adapt
+// the unified conversation threads to integer conversation IDs
+func InitMessagingRoutes(router *mux.Router, db *sql.DB, threads *messaging.MarketplaceMessagingService, attachmentHandler *handlers.AttachmentHandler) {
 	// Create messaging service and handler
-	messagingService := messaging.NewMessagingService(db)
+	messagingService := messaging.NewMessagingService(db, threads)
 	messageHandler := handlers.NewMessageHandler(messagingService)
 
-	// Messaging routes with JWT authentication
-	// POST /api/messages/:conversationId - send new message
-	router.HandleFunc("/api/messages/{conversationId}",
-		middleware.AuthMiddleware(messageHandler.SendMessage)).Methods("POST")
-
-	// GET /api/messages/:conversationId - fetch thread
-	router.HandleFunc("/api/messages/{conversationId}",
-		middleware.AuthMiddleware(messageHandler.GetConversationMessages)).Methods("GET")
+	// The fixed paths are registered before /api/messages/{conversationId},
+	// which would otherwise match them
 
 	// GET /api/messages/conversations - list user conversations
 	router.HandleFunc("/api/messages/conversations",
@@ -36,4 +31,17 @@ func InitMessagingRoutes(router *mux.Router, db *sql.DB) {
 	// POST /api/messages/conversations/create - create new conversation
 	router.HandleFunc("/api/messages/conversations/create",
 		middleware.AuthMiddleware(messageHandler.CreateConversation)).Methods("POST")
+
+	// POST /api/messages/:conversationId/attachments - upload a file to send
+	router.HandleFunc("/api/messages/{conversationId}/attachments",
+		middleware.AuthMiddleware(attachmentHandler.UploadConversationAttachment)).Methods("POST")
+
+	// Messaging routes with JWT authentication
+	// POST /api/messages/:conversationId - send new message
+	router.HandleFunc("/api/messages/{conversationId}",
+		middleware.AuthMiddleware(messageHandler.SendMessage)).Methods("POST")
+
+	// GET /api/messages/:conversationId - fetch thread
+	router.HandleFunc("/api/messages/{conversationId}",
+		middleware.AuthMiddleware(messageHandler.GetConversationMessages)).Methods("GET")
 }
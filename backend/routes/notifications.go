@@ -1,24 +1,15 @@
 package routes
 
 import (
-	"database/sql"
-
 	"github.com/gorilla/mux"
 
 	"github.com/Andrew-mugwe/agroai/handlers"
 	"github.com/Andrew-mugwe/agroai/middleware"
 	"github.com/Andrew-mugwe/agroai/models"
-	"github.com/Andrew-mugwe/agroai/services/notifications"
 )
 
 // InitNotificationRoutes initializes notification routes
-func InitNotificationRoutes(router *mux.Router, db *sql.DB) {
-	// Create notification service
-	realtimeNotificationService := notifications.NewNotificationService()
-
-	// Create notification handler
-	notificationHandler := handlers.NewNotificationHandler(realtimeNotificationService)
-
+func InitNotificationRoutes(router *mux.Router, notificationHandler *handlers.NotificationHandler) {
 	// Notification routes
 	router.HandleFunc("/api/notifications",
 		middleware.AuthMiddleware(notificationHandler.GetNotifications)).Methods("GET")
@@ -34,9 +25,43 @@ func InitNotificationRoutes(router *mux.Router, db *sql.DB) {
 	router.HandleFunc("/api/notifications/mark-all-read",
 		middleware.AuthMiddleware(notificationHandler.MarkAllNotificationsRead)).Methods("PATCH")
 
+	// Delivery preferences, push devices, the SMS number, language and digests
+	router.HandleFunc("/api/notifications/preferences",
+		middleware.AuthMiddleware(notificationHandler.GetPreferences)).Methods("GET")
+
+	router.HandleFunc("/api/notifications/preferences",
+		middleware.AuthMiddleware(notificationHandler.SetPreferences)).Methods("PUT")
+
+	router.HandleFunc("/api/notifications/devices",
+		middleware.AuthMiddleware(notificationHandler.RegisterDevice)).Methods("POST")
+
+	router.HandleFunc("/api/notifications/devices/{token}",
+		middleware.AuthMiddleware(notificationHandler.RemoveDevice)).Methods("DELETE")
+
+	router.HandleFunc("/api/notifications/contact",
+		middleware.AuthMiddleware(notificationHandler.SetContact)).Methods("PUT")
+
+	router.HandleFunc("/api/notifications/contact/verify",
+		middleware.AuthMiddleware(notificationHandler.VerifyContact)).Methods("POST")
+
+	router.HandleFunc("/api/notifications/language",
+		middleware.AuthMiddleware(notificationHandler.GetLanguage)).Methods("GET")
+
+	router.HandleFunc("/api/notifications/language",
+		middleware.AuthMiddleware(notificationHandler.SetLanguage)).Methods("PUT")
+
+	router.HandleFunc("/api/notifications/digests",
+		middleware.AuthMiddleware(notificationHandler.GetDigests)).Methods("GET")
+
+	router.HandleFunc("/api/notifications/{id}/deliveries",
+		middleware.AuthMiddleware(notificationHandler.GetDeliveries)).Methods("GET")
+
 	router.HandleFunc("/api/notifications/{id}",
 		middleware.AuthMiddleware(notificationHandler.DeleteNotification)).Methods("DELETE")
 
 	router.HandleFunc("/api/notifications/stats",
 		middleware.AuthMiddleware(notificationHandler.GetNotificationStats)).Methods("GET")
+
+	// The websocket authenticates from its own bearer token or ?token=
+	router.HandleFunc("/ws/notifications", notificationHandler.HandleWebSocket).Methods("GET")
 }
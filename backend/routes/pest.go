@@ -7,14 +7,15 @@ import (
 
 	"github.com/Andrew-mugwe/agroai/handlers"
 	"github.com/Andrew-mugwe/agroai/middleware"
+	"github.com/Andrew-mugwe/agroai/services/media"
 	"github.com/Andrew-mugwe/agroai/services/pest"
 )
 
 // InitPestRoutes initializes pest detection routes
-func InitPestRoutes(router *mux.Router, db *sql.DB) {
+func InitPestRoutes(router *mux.Router, db *sql.DB, mediaService *media.Service) {
 	// Create pest service and handler
 	pestService := pest.NewPestService(db)
-	pestHandler := handlers.NewPestHandler(pestService)
+	pestHandler := handlers.NewPestHandler(pestService, mediaService)
 
 	// Pest detection routes with JWT authentication
 	// POST /api/pests/report - upload image and create pest report
@@ -1,28 +1,43 @@
 package routes
 
 import (
+	"context"
 	"database/sql"
 	"log"
 	"net/http"
+	"time"
 
+	"github.com/go-redis/redis/v8"
 	"github.com/gorilla/mux"
 
+	"github.com/Andrew-mugwe/agroai/config"
 	"github.com/Andrew-mugwe/agroai/handlers"
 	"github.com/Andrew-mugwe/agroai/middleware"
 	"github.com/Andrew-mugwe/agroai/models"
 	"github.com/Andrew-mugwe/agroai/repository"
 	"github.com/Andrew-mugwe/agroai/services"
+	"github.com/Andrew-mugwe/agroai/services/catalog"
 	"github.com/Andrew-mugwe/agroai/services/disputes"
 	"github.com/Andrew-mugwe/agroai/services/escrow"
+	"github.com/Andrew-mugwe/agroai/services/inventory"
+	"github.com/Andrew-mugwe/agroai/services/kyc"
 	"github.com/Andrew-mugwe/agroai/services/logger"
+	"github.com/Andrew-mugwe/agroai/services/marketplace"
+	"github.com/Andrew-mugwe/agroai/services/media"
 	"github.com/Andrew-mugwe/agroai/services/messaging"
 	notifications "github.com/Andrew-mugwe/agroai/services/notifications"
 	"github.com/Andrew-mugwe/agroai/services/orders"
 	"github.com/Andrew-mugwe/agroai/services/payments"
 	"github.com/Andrew-mugwe/agroai/services/payouts"
+	"github.com/Andrew-mugwe/agroai/services/pricing"
 	"github.com/Andrew-mugwe/agroai/services/reputation"
+	"github.com/Andrew-mugwe/agroai/services/reviews"
+	"github.com/Andrew-mugwe/agroai/services/search"
 	"github.com/Andrew-mugwe/agroai/services/sellers"
+	"github.com/Andrew-mugwe/agroai/services/sms"
+	"github.com/Andrew-mugwe/agroai/services/ussd"
 	"github.com/Andrew-mugwe/agroai/services/websocket"
+	"github.com/Andrew-mugwe/agroai/services/wishlist"
 )
 
 func InitRoutes(router *mux.Router, db *sql.DB) {
@@ -30,7 +45,6 @@ func InitRoutes(router *mux.Router, db *sql.DB) {
 	authService := services.NewAuthService(db)
 	userService := services.NewUserService(db)
 	dashboardService := services.NewDashboardService(db)
-	traderService := services.NewTraderService(db)
 
 	// Create cache service
 	cacheService, err := services.NewCacheService()
@@ -47,6 +61,36 @@ func InitRoutes(router *mux.Router, db *sql.DB) {
 	productRepo := repository.NewProductRepository(db)
 	orderRepo := repository.NewOrderRepository(db)
 
+	// The product catalogue backs trader management, the public marketplace and orders
+	productService := services.NewProductService(productRepo)
+	traderService := services.NewTraderService(db, productService)
+
+	// Notifications are stored in the inbox and delivered over the channels
+	// each user has enabled; every service notifies through the dispatcher
+	cfg := config.LoadConfig()
+	realtimeNotificationService := notifications.NewNotificationService()
+	notificationStore := notifications.NewDatabaseNotificationService(db)
+	smsGateway := sms.NewGateway(cfg.SMS)
+	notificationDispatcher := newNotificationDispatcher(db, notificationStore, realtimeNotificationService, smsGateway, cfg)
+	realtimeNotificationService.SetLanguages(notificationDispatcher.Language)
+	notificationHandler := handlers.NewNotificationHandler(realtimeNotificationService, notificationStore, notificationDispatcher, sms.NewOTPService(db, smsGateway))
+
+	// Every stock movement goes through the inventory ledger; products that
+	// fall to their reorder threshold alert their trader
+	inventoryRepo := repository.NewInventoryRepository(db)
+	inventoryService := inventory.NewService(inventoryRepo, productRepo)
+	inventoryService.SetNotifier(notificationDispatcher)
+	inventoryService.StartThresholdChecks(15 * time.Minute)
+	productService.SetStockWatcher(inventoryService)
+
+	// Product and pest images go through the media service
+	mediaService, mediaStorage, localMedia := newMediaService(db)
+	mediaHandler := handlers.NewMediaHandler(mediaService, localMedia)
+
+	// Message attachments share the media store and its signed /media URLs
+	attachmentService := newAttachmentService(db, mediaStorage)
+	attachmentHandler := handlers.NewAttachmentHandler(attachmentService)
+
 	// Create seller service and handler
 	sellerService := sellers.NewSellerService(db)
 	sellerHandler := handlers.NewSellerHandler(sellerService)
@@ -58,7 +102,14 @@ func InitRoutes(router *mux.Router, db *sql.DB) {
 	authHandler := handlers.NewAuthHandler(authService, activityLoggerMiddleware)
 	userHandler := handlers.NewUserHandler(userService, authService, activityLoggerMiddleware)
 	dashboardHandler := handlers.NewDashboardHandler(dashboardService, cacheService)
-	traderHandler := handlers.NewTraderHandler(traderService, cacheService)
+	traderHandler := handlers.NewTraderHandler(traderService, cacheService, mediaService)
+	productHandler := handlers.NewProductHandler(productService, cacheService)
+	inventoryHandler := handlers.NewInventoryHandler(inventoryService, cacheService)
+	catalogService := catalog.NewService(db, productService, productRepo)
+	if err := catalogService.FailInterrupted(context.Background()); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+	catalogHandler := handlers.NewCatalogHandler(catalogService, cacheService)
 	logsHandler := handlers.NewLogsHandler(activityLogger)
 	adminLogsHandler := handlers.NewAdminLogsHandler(activityLogger)
 
@@ -70,6 +121,7 @@ func InitRoutes(router *mux.Router, db *sql.DB) {
 
 	// Create order service and handler
 	orderService := orders.NewOrderService(orderRepo, productRepo)
+	orderService.SetInventory(inventoryService)
 	orderHandler := handlers.NewOrderHandler(orderService)
 
 	// Auth routes
@@ -106,6 +158,87 @@ func InitRoutes(router *mux.Router, db *sql.DB) {
 			middleware.RequireRole(models.RoleTrader)(traderHandler.GetProducts),
 		)).Methods("GET")
 
+	router.HandleFunc("/api/trader/products",
+		middleware.AuthMiddleware(
+			middleware.RequireRole(models.RoleTrader)(productHandler.CreateProduct),
+		)).Methods("POST")
+
+	router.HandleFunc("/api/trader/products/{id}",
+		middleware.AuthMiddleware(
+			middleware.RequireRole(models.RoleTrader)(productHandler.UpdateProduct),
+		)).Methods("PUT")
+
+	router.HandleFunc("/api/trader/products/{id}",
+		middleware.AuthMiddleware(
+			middleware.RequireRole(models.RoleTrader)(productHandler.DeleteProduct),
+		)).Methods("DELETE")
+
+	router.HandleFunc("/api/trader/products/{id}/variants",
+		middleware.AuthMiddleware(
+			middleware.RequireRole(models.RoleTrader)(productHandler.AddVariant),
+		)).Methods("POST")
+
+	router.HandleFunc("/api/trader/products/{id}/variants/{variantId}",
+		middleware.AuthMiddleware(
+			middleware.RequireRole(models.RoleTrader)(productHandler.UpdateVariant),
+		)).Methods("PUT")
+
+	router.HandleFunc("/api/trader/products/{id}/variants/{variantId}",
+		middleware.AuthMiddleware(
+			middleware.RequireRole(models.RoleTrader)(productHandler.DeleteVariant),
+		)).Methods("DELETE")
+
+	// Inventory ledger, reorder thresholds and stock valuation
+	router.HandleFunc("/api/trader/products/{id}/variants/{variantId}/stock",
+		middleware.AuthMiddleware(
+			middleware.RequireRole(models.RoleTrader)(inventoryHandler.AdjustStock),
+		)).Methods("POST")
+
+	router.HandleFunc("/api/trader/products/{id}/reorder-threshold",
+		middleware.AuthMiddleware(
+			middleware.RequireRole(models.RoleTrader)(inventoryHandler.SetReorderThreshold),
+		)).Methods("PUT")
+
+	router.HandleFunc("/api/trader/inventory/movements",
+		middleware.AuthMiddleware(
+			middleware.RequireRole(models.RoleTrader)(inventoryHandler.ListMovements),
+		)).Methods("GET")
+
+	router.HandleFunc("/api/trader/inventory/report",
+		middleware.AuthMiddleware(
+			middleware.RequireRole(models.RoleTrader)(inventoryHandler.GetReport),
+		)).Methods("GET")
+
+	// Bulk catalogue import and export
+	router.HandleFunc("/api/trader/products/import",
+		middleware.AuthMiddleware(
+			middleware.RequireRole(models.RoleTrader)(catalogHandler.ImportProducts),
+		)).Methods("POST")
+
+	router.HandleFunc("/api/trader/products/import/{jobId}",
+		middleware.AuthMiddleware(
+			middleware.RequireRole(models.RoleTrader)(catalogHandler.GetImportJob),
+		)).Methods("GET")
+
+	router.HandleFunc("/api/trader/products/import/{jobId}/errors",
+		middleware.AuthMiddleware(
+			middleware.RequireRole(models.RoleTrader)(catalogHandler.GetImportErrors),
+		)).Methods("GET")
+
+	router.HandleFunc("/api/trader/products/export",
+		middleware.AuthMiddleware(
+			middleware.RequireRole(models.RoleTrader)(catalogHandler.ExportProducts),
+		)).Methods("GET")
+
+	// Image uploads; locally stored media is served from signed /media URLs
+	router.HandleFunc("/api/trader/media",
+		middleware.AuthMiddleware(
+			middleware.RequireRole(models.RoleTrader)(mediaHandler.UploadProductImage),
+		)).Methods("POST")
+	router.HandleFunc("/api/media/{id}", middleware.AuthMiddleware(mediaHandler.GetMedia)).Methods("GET")
+	router.HandleFunc("/api/media/{id}", middleware.AuthMiddleware(mediaHandler.DeleteMedia)).Methods("DELETE")
+	router.HandleFunc("/media/{key:.+}", mediaHandler.ServeMedia).Methods("GET")
+
 	router.HandleFunc("/api/trader/orders",
 		middleware.AuthMiddleware(
 			middleware.RequireRole(models.RoleTrader)(traderHandler.GetOrders),
@@ -136,11 +269,7 @@ func InitRoutes(router *mux.Router, db *sql.DB) {
 		)).Methods("POST")
 
 	// Initialize notification routes
-	InitNotificationRoutes(router, db)
-
-	// Add notification handlers
-	realtimeNotificationService := notifications.NewNotificationService()
-	notificationHandler := handlers.NewNotificationHandler(realtimeNotificationService)
+	InitNotificationRoutes(router, notificationHandler)
 
 	// Notification routes with JWT authentication
 	router.HandleFunc("/api/notifications",
@@ -157,29 +286,62 @@ func InitRoutes(router *mux.Router, db *sql.DB) {
 	router.HandleFunc("/api/notifications/stats",
 		middleware.AuthMiddleware(notificationHandler.GetNotificationStats)).Methods("GET")
 
-	// Initialize messaging routes
-	InitMessagingRoutes(router, db)
-
 	// Initialize pest detection routes
-	InitPestRoutes(router, db)
+	InitPestRoutes(router, db, mediaService)
 
 	// Initialize escrow and payout services
 	payoutSvc := payouts.NewPayoutService()
 	escrowService := escrow.NewEscrowService(db, paymentSvc, payoutSvc)
+	kycService := kyc.NewService(db)
+	escrowService.SetPayoutPolicy(kycService)
 	escrowHandler := handlers.NewEscrowHandler(escrowService, payoutSvc)
 
+	// Farmers on feature phones check orders, confirm deliveries, read pest
+	// alerts and see balances over USSD
+	ussdService := ussd.NewService(newUSSDSessionStore(cfg), ussd.NewDirectory(db), orderService, escrowService)
+	ussdHandler := handlers.NewUSSDHandler(ussdService, cfg.USSD.CallbackToken)
+	// Callers are only known by the phone number the gateway reports, so
+	// the callback is not mounted until the gateway authenticates
+	if cfg.USSD.CallbackToken != "" {
+		router.HandleFunc("/api/ussd/callback", ussdHandler.Callback).Methods("POST")
+	} else {
+		log.Printf("Warning: USSD disabled: set USSD_CALLBACK_TOKEN to mount /api/ussd/callback")
+	}
+	router.HandleFunc("/api/ussd/pin", middleware.AuthMiddleware(ussdHandler.SetPIN)).Methods("PUT")
+
 	// Initialize dispute services
 	disputeService := disputes.NewDisputeService(db, escrowService)
 	disputeHandler := handlers.NewDisputeHandler(disputeService)
 
 	// Initialize reputation services
 	reputationService := reputation.NewReputationService(db)
-	ratingHandler := handlers.NewRatingHandler(reputationService)
+	reviewService := reviews.NewService(db)
+	ratingHandler := handlers.NewRatingHandler(reputationService, reviewService)
+	reviewHandler := handlers.NewReviewHandler(reviewService)
+
+	// Reputation is recalculated from events; the periodic run is only a safety sweep
+	reputationScheduler := reputation.NewScheduler(db, reputationService, 6*time.Hour)
+	reputationScheduler.Start()
+	ratingHandler.SetScheduler(reputationScheduler)
+	orderService.SetReputationNotifier(reputationScheduler)
+	disputeService.SetReputationNotifier(reputationScheduler)
+	disputeService.SetNotifier(notificationDispatcher)
+	kycService.SetReputationNotifier(reputationScheduler)
+	kycService.StartExpiryChecks(24 * time.Hour)
+	kycHandler := handlers.NewKYCHandler(kycService)
+	reviewService.SetReputationNotifier(reputationScheduler)
 
 	// Initialize marketplace messaging services
 	marketplaceMessagingService := messaging.NewMarketplaceMessagingService(db)
+	marketplaceMessagingService.SetOrders(orderService)
+	marketplaceMessagingService.SetAttachments(attachmentService)
 	marketplaceMessageHandler := handlers.NewMarketplaceMessageHandler(marketplaceMessagingService)
-	wsService := websocket.NewMarketplaceWebSocketService()
+	marketplaceBroker, marketplacePresence := newMarketplaceRealtime(cfg)
+	wsService := websocket.NewMarketplaceWebSocketService(marketplaceMessagingService, marketplaceBroker, marketplacePresence, cfg.AllowedOrigins)
+	marketplaceMessageHandler.SetBroadcaster(wsService)
+
+	// Legacy /api/messages routes adapt the same conversations
+	InitMessagingRoutes(router, db, marketplaceMessagingService, attachmentHandler)
 
 	// Seller services already initialized above
 
@@ -201,7 +363,7 @@ func InitRoutes(router *mux.Router, db *sql.DB) {
 	router.HandleFunc("/api/escrow/health", escrowHandler.HealthCheck).Methods("GET")
 
 	// Payout routes
-	router.HandleFunc("/api/payouts/process", escrowHandler.ProcessPayout).Methods("POST")
+	router.HandleFunc("/api/payouts/process", middleware.AuthMiddleware(middleware.RequireRole(models.RoleAdmin)(escrowHandler.ProcessPayout))).Methods("POST")
 	router.HandleFunc("/api/payouts/capabilities", escrowHandler.GetPayoutCapabilities).Methods("GET")
 
 	// Dispute routes
@@ -215,12 +377,21 @@ func InitRoutes(router *mux.Router, db *sql.DB) {
 	router.HandleFunc("/api/disputes/health", disputeHandler.HealthCheck).Methods("GET")
 
 	// Reputation & Ratings routes
-	router.HandleFunc("/api/ratings", ratingHandler.CreateRating).Methods("POST")
+	router.HandleFunc("/api/ratings", middleware.AuthMiddleware(ratingHandler.CreateRating)).Methods("POST")
 	router.HandleFunc("/api/sellers/{sellerId}/reputation", ratingHandler.GetSellerReputation).Methods("GET")
-	router.HandleFunc("/api/reputation/history/{userId}", ratingHandler.GetReputationHistory).Methods("GET")
+	router.HandleFunc("/api/reputation/history/{userId}", middleware.AuthMiddleware(ratingHandler.GetReputationHistory)).Methods("GET")
 	router.HandleFunc("/api/admin/reputation/recalculate/{userId}", ratingHandler.RecalculateReputation).Methods("POST")
 	router.HandleFunc("/api/admin/reputation/report", ratingHandler.GetReputationReport).Methods("GET")
 	router.HandleFunc("/api/reputation/health", ratingHandler.HealthCheck).Methods("GET")
+	router.HandleFunc("/api/admin/reputation/scheduler", middleware.AuthMiddleware(middleware.RequireRole(models.RoleAdmin)(ratingHandler.GetSchedulerStats))).Methods("GET")
+	router.HandleFunc("/api/admin/reputation/models", middleware.AuthMiddleware(middleware.RequireRole(models.RoleAdmin)(ratingHandler.ListReputationModels))).Methods("GET")
+	router.HandleFunc("/api/admin/reputation/models", middleware.AuthMiddleware(middleware.RequireRole(models.RoleAdmin)(ratingHandler.CreateReputationModel))).Methods("POST")
+	router.HandleFunc("/api/admin/reputation/models/dry-run", middleware.AuthMiddleware(middleware.RequireRole(models.RoleAdmin)(ratingHandler.DryRunReputationModel))).Methods("POST")
+	router.HandleFunc("/api/admin/reputation/models/{version}/activate", middleware.AuthMiddleware(middleware.RequireRole(models.RoleAdmin)(ratingHandler.ActivateReputationModel))).Methods("POST")
+
+	// Conversations of every kind; direct and group ones are started here
+	router.HandleFunc("/api/conversations", middleware.AuthMiddleware(marketplaceMessageHandler.CreateConversation)).Methods("POST")
+	router.HandleFunc("/api/conversations", middleware.AuthMiddleware(marketplaceMessageHandler.GetUserThreads)).Methods("GET")
 
 	// Marketplace Messaging routes
 	router.HandleFunc("/api/marketplace/thread", middleware.AuthMiddleware(marketplaceMessageHandler.CreateThread)).Methods("POST")
@@ -230,6 +401,14 @@ func InitRoutes(router *mux.Router, db *sql.DB) {
 	router.HandleFunc("/api/marketplace/thread/{threadRef}", middleware.AuthMiddleware(marketplaceMessageHandler.GetThreadInfo)).Methods("GET")
 	router.HandleFunc("/api/marketplace/thread/{threadRef}/escalate", middleware.AuthMiddleware(marketplaceMessageHandler.EscalateThread)).Methods("POST")
 	router.HandleFunc("/api/marketplace/thread/{threadRef}/participants", middleware.AuthMiddleware(marketplaceMessageHandler.AddParticipant)).Methods("POST")
+	router.HandleFunc("/api/marketplace/thread/{threadRef}/read", middleware.AuthMiddleware(marketplaceMessageHandler.MarkThreadRead)).Methods("POST")
+	router.HandleFunc("/api/marketplace/thread/{threadRef}/attachments", middleware.AuthMiddleware(attachmentHandler.UploadThreadAttachment)).Methods("POST")
+	router.HandleFunc("/api/attachments/{id}", middleware.AuthMiddleware(attachmentHandler.GetAttachment)).Methods("GET")
+	router.HandleFunc("/api/marketplace/thread/{threadRef}/offers", middleware.AuthMiddleware(marketplaceMessageHandler.MakeOffer)).Methods("POST")
+	router.HandleFunc("/api/marketplace/thread/{threadRef}/offers", middleware.AuthMiddleware(marketplaceMessageHandler.GetThreadOffers)).Methods("GET")
+	router.HandleFunc("/api/marketplace/thread/{threadRef}/offers/{offerId}/counter", middleware.AuthMiddleware(marketplaceMessageHandler.CounterOffer)).Methods("POST")
+	router.HandleFunc("/api/marketplace/thread/{threadRef}/offers/{offerId}/accept", middleware.AuthMiddleware(marketplaceMessageHandler.AcceptOffer)).Methods("POST")
+	router.HandleFunc("/api/marketplace/thread/{threadRef}/offers/{offerId}/decline", middleware.AuthMiddleware(marketplaceMessageHandler.DeclineOffer)).Methods("POST")
 	router.HandleFunc("/api/marketplace/health", marketplaceMessageHandler.HealthCheck).Methods("GET")
 
 	// WebSocket endpoint for real-time messaging
@@ -237,15 +416,33 @@ func InitRoutes(router *mux.Router, db *sql.DB) {
 
 	// Enhanced Seller routes
 	router.HandleFunc("/api/sellers/{id}", sellerHandler.GetSellerProfile).Methods("GET")
-	router.HandleFunc("/api/sellers/{id}/reviews", sellerHandler.GetSellerReviews).Methods("GET")
-	router.HandleFunc("/api/sellers/{id}/review", middleware.AuthMiddleware(sellerHandler.CreateReview)).Methods("POST")
+	router.HandleFunc("/api/sellers/{id}/reviews", reviewHandler.GetSellerReviews).Methods("GET")
+	router.HandleFunc("/api/sellers/{id}/review", middleware.AuthMiddleware(reviewHandler.CreateReview)).Methods("POST")
 	router.HandleFunc("/api/sellers/{id}", middleware.AuthMiddleware(sellerHandler.UpdateSellerProfile)).Methods("PATCH")
+	router.HandleFunc("/api/seller/service-areas", middleware.AuthMiddleware(middleware.RequireRole(models.RoleTrader)(sellerHandler.ListServiceAreas))).Methods("GET")
+	router.HandleFunc("/api/seller/service-areas", middleware.AuthMiddleware(middleware.RequireRole(models.RoleTrader)(sellerHandler.AddServiceArea))).Methods("POST")
+	router.HandleFunc("/api/seller/service-areas/{id}", middleware.AuthMiddleware(middleware.RequireRole(models.RoleTrader)(sellerHandler.DeleteServiceArea))).Methods("DELETE")
 
 	// Admin Seller routes
 	router.HandleFunc("/api/admin/sellers", middleware.AuthMiddleware(middleware.RequireRole(models.RoleAdmin)(adminMonitoringHandler.GetSellers))).Methods("GET")
-	router.HandleFunc("/api/admin/sellers/{id}/verify", middleware.AuthMiddleware(middleware.RequireRole(models.RoleAdmin)(sellerHandler.VerifySeller))).Methods("PATCH")
+	router.HandleFunc("/api/admin/sellers/{id}/revoke-verification", middleware.AuthMiddleware(middleware.RequireRole(models.RoleAdmin)(kycHandler.RevokeVerification))).Methods("POST")
 	router.HandleFunc("/api/admin/sellers/{id}/recalculate-reputation", middleware.AuthMiddleware(middleware.RequireRole(models.RoleAdmin)(sellerHandler.RecalculateReputation))).Methods("POST")
 
+	// Seller KYC routes
+	router.HandleFunc("/api/kyc", middleware.AuthMiddleware(kycHandler.SubmitVerification)).Methods("POST")
+	router.HandleFunc("/api/kyc", middleware.AuthMiddleware(kycHandler.GetVerificationStatus)).Methods("GET")
+	router.HandleFunc("/api/admin/kyc/submissions", middleware.AuthMiddleware(middleware.RequireRole(models.RoleAdmin)(kycHandler.ListSubmissions))).Methods("GET")
+	router.HandleFunc("/api/admin/kyc/submissions/{id}", middleware.AuthMiddleware(middleware.RequireRole(models.RoleAdmin)(kycHandler.GetSubmission))).Methods("GET")
+	router.HandleFunc("/api/admin/kyc/submissions/{id}/approve", middleware.AuthMiddleware(middleware.RequireRole(models.RoleAdmin)(kycHandler.ApproveSubmission))).Methods("POST")
+	router.HandleFunc("/api/admin/kyc/submissions/{id}/reject", middleware.AuthMiddleware(middleware.RequireRole(models.RoleAdmin)(kycHandler.RejectSubmission))).Methods("POST")
+
+	// Review routes
+	router.HandleFunc("/api/reviews", middleware.AuthMiddleware(reviewHandler.CreateReview)).Methods("POST")
+	router.HandleFunc("/api/reviews/{id}/reply", middleware.AuthMiddleware(reviewHandler.ReplyToReview)).Methods("POST")
+	router.HandleFunc("/api/reviews/{id}/report", middleware.AuthMiddleware(reviewHandler.ReportReview)).Methods("POST")
+	router.HandleFunc("/api/admin/reviews/moderation", middleware.AuthMiddleware(middleware.RequireRole(models.RoleAdmin)(reviewHandler.GetModerationQueue))).Methods("GET")
+	router.HandleFunc("/api/admin/reviews/{id}/moderate", middleware.AuthMiddleware(middleware.RequireRole(models.RoleAdmin)(reviewHandler.ModerateReview))).Methods("POST")
+
 	// Admin Monitoring routes
 	router.HandleFunc("/api/admin/monitoring/overview", middleware.AuthMiddleware(middleware.RequireRole(models.RoleAdmin)(adminMonitoringHandler.GetMonitoringOverview))).Methods("GET")
 	router.HandleFunc("/api/admin/monitoring/reputation-distribution", middleware.AuthMiddleware(middleware.RequireRole(models.RoleAdmin)(adminMonitoringHandler.GetReputationDistribution))).Methods("GET")
@@ -264,7 +461,45 @@ func InitRoutes(router *mux.Router, db *sql.DB) {
 	router.HandleFunc("/api/orders/{id}/status", orderHandler.GetOrderStatus).Methods("GET")
 
 	// Flow14.1.1: Marketplace public routes and order aliases
-	RegisterMarketplaceRoutes(router, db)
+	searchService := search.NewService(db, productRepo)
+	if err := searchService.ReloadDictionary(context.Background()); err != nil {
+		log.Printf("search: dictionary not loaded: %v", err)
+	}
+
+	// Market prices: indices are rebuilt hourly and the commodity feed, when
+	// configured, is imported daily
+	pricingService := pricing.NewService(db, productRepo)
+	pricingService.UseFeed(pricing.NewFeed(cfg.MarketDataURL, cfg.MarketDataAPIKey))
+	pricingService.Start(time.Hour, 24*time.Hour)
+	RegisterMarketplaceRoutes(router, productRepo, searchService, mediaService, pricingService)
+
+	pricingHandler := handlers.NewPricingHandler(pricingService)
+	router.HandleFunc("/api/trader/pricing/suggest", middleware.AuthMiddleware(middleware.RequireRole(models.RoleTrader)(pricingHandler.SuggestPrice))).Methods("GET")
+	router.HandleFunc("/api/admin/pricing/recompute", middleware.AuthMiddleware(middleware.RequireRole(models.RoleAdmin)(pricingHandler.RecomputeIndices))).Methods("POST")
+	router.HandleFunc("/api/admin/pricing/feed/import", middleware.AuthMiddleware(middleware.RequireRole(models.RoleAdmin)(pricingHandler.ImportFeed))).Methods("POST")
+
+	// Wishlists and saved searches; the matcher alerts buyers to new
+	// matching listings, price drops and restocks
+	wishlistService := wishlist.NewService(db, marketplace.NewService(productRepo, searchService), productRepo)
+	wishlistService.SetNotifier(notificationDispatcher)
+	wishlistService.Start(10 * time.Minute)
+
+	wishlistHandler := handlers.NewWishlistHandler(wishlistService, mediaService)
+	router.HandleFunc("/api/marketplace/wishlist", middleware.AuthMiddleware(wishlistHandler.GetWishlist)).Methods("GET")
+	router.HandleFunc("/api/marketplace/wishlist", middleware.AuthMiddleware(wishlistHandler.AddToWishlist)).Methods("POST")
+	router.HandleFunc("/api/marketplace/wishlist/{productId}", middleware.AuthMiddleware(wishlistHandler.RemoveFromWishlist)).Methods("DELETE")
+	router.HandleFunc("/api/marketplace/saved-searches", middleware.AuthMiddleware(wishlistHandler.ListSavedSearches)).Methods("GET")
+	router.HandleFunc("/api/marketplace/saved-searches", middleware.AuthMiddleware(wishlistHandler.CreateSavedSearch)).Methods("POST")
+	router.HandleFunc("/api/marketplace/saved-searches/{id}", middleware.AuthMiddleware(wishlistHandler.UpdateSavedSearch)).Methods("PUT")
+	router.HandleFunc("/api/marketplace/saved-searches/{id}", middleware.AuthMiddleware(wishlistHandler.DeleteSavedSearch)).Methods("DELETE")
+	router.HandleFunc("/api/marketplace/alerts/preferences", middleware.AuthMiddleware(wishlistHandler.GetAlertPreferences)).Methods("GET")
+	router.HandleFunc("/api/marketplace/alerts/preferences", middleware.AuthMiddleware(wishlistHandler.SetAlertPreferences)).Methods("PUT")
+
+	searchHandler := handlers.NewSearchHandler(searchService)
+	router.HandleFunc("/api/admin/search/terms", middleware.AuthMiddleware(middleware.RequireRole(models.RoleAdmin)(searchHandler.ListTerms))).Methods("GET")
+	router.HandleFunc("/api/admin/search/terms", middleware.AuthMiddleware(middleware.RequireRole(models.RoleAdmin)(searchHandler.CreateTerm))).Methods("POST")
+	router.HandleFunc("/api/admin/search/terms/{id}", middleware.AuthMiddleware(middleware.RequireRole(models.RoleAdmin)(searchHandler.DeleteTerm))).Methods("DELETE")
+	router.HandleFunc("/api/admin/search/analyze", middleware.AuthMiddleware(middleware.RequireRole(models.RoleAdmin)(searchHandler.AnalyzeQuery))).Methods("GET")
 	// Order aliases under marketplace namespace (reuse same handlers)
 	router.HandleFunc("/api/marketplace/orders", middleware.AuthMiddleware(orderHandler.CreateOrder)).Methods("POST")
 	router.HandleFunc("/api/marketplace/orders/{id}", middleware.AuthMiddleware(orderHandler.GetOrder)).Methods("GET")
@@ -278,3 +513,107 @@ func InitRoutes(router *mux.Router, db *sql.DB) {
 		w.Write([]byte("OK"))
 	}).Methods("GET")
 }
+
+// newNotificationDispatcher builds the notification dispatcher with every
+// configured channel and starts retrying failed and deferred deliveries
+func newNotificationDispatcher(db *sql.DB, store *notifications.DatabaseNotificationService, hub *notifications.NotificationService, gateway sms.Gateway, cfg *config.Config) *notifications.Dispatcher {
+	dispatcher := notifications.NewDispatcher(db, store)
+	dispatcher.Use(notifications.NewWebSocketSender(hub))
+	dispatcher.Use(notifications.NewSMSSender(gateway))
+
+	if email := notifications.NewEmailSender(cfg.SMTP); email != nil {
+		dispatcher.Use(email)
+	} else {
+		log.Printf("notifications: SMTP is not configured, email delivery is disabled")
+	}
+	if push := notifications.NewPushSender(cfg.Push); push != nil {
+		dispatcher.Use(push)
+	} else {
+		log.Printf("notifications: PUSH_FCM_SERVER_KEY is not set, push delivery is disabled")
+	}
+
+	dispatcher.Start(time.Minute)
+	return dispatcher
+}
+
+// newUSSDSessionStore keeps USSD sessions in Redis, falling back to memory
+// when Redis is unreachable, which only works with a single instance
+func newUSSDSessionStore(cfg *config.Config) ussd.SessionStore {
+	client, err := newRedisClient(cfg)
+	if err == nil {
+		return ussd.NewRedisStore(client, cfg.USSD.SessionTTL)
+	}
+
+	log.Printf("Warning: USSD sessions: Redis unavailable (%v); keeping sessions in memory", err)
+	return ussd.NewMemoryStore(cfg.USSD.SessionTTL)
+}
+
+// newMarketplaceRealtime shares marketplace websocket events and presence
+// between instances over Redis, falling back to this instance alone
+// without it
+func newMarketplaceRealtime(cfg *config.Config) (websocket.Broker, websocket.Presence) {
+	client, err := newRedisClient(cfg)
+	if err == nil {
+		return websocket.NewRedisBroker(client), websocket.NewRedisPresence(client)
+	}
+
+	log.Printf("Warning: marketplace websocket: Redis unavailable (%v); events and presence reach this instance only", err)
+	return websocket.NewMemoryBroker(), websocket.NewMemoryPresence()
+}
+
+// newRedisClient connects to the configured Redis
+func newRedisClient(cfg *config.Config) (*redis.Client, error) {
+	opt, err := redis.ParseURL(cfg.Redis.URL)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Redis.Password != "" {
+		opt.Password = cfg.Redis.Password
+	}
+	client := redis.NewClient(opt)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, err
+	}
+	return client, nil
+}
+
+// newMediaService builds the media service from the environment, falling
+// back to local storage when the configured backend is unusable. The local
+// store is also returned for the /media route, nil when using S3.
+func newMediaService(db *sql.DB) (*media.Service, media.Storage, *media.LocalStorage) {
+	cfg := config.LoadConfig()
+
+	storage, err := media.NewStorage(cfg.Media, cfg.AWS, "/media")
+	if err != nil {
+		log.Printf("Warning: media storage: %v; storing media on local disk", err)
+		storage = media.NewLocalStorage(cfg.Media.LocalDir, "/media", cfg.Media.SigningSecret)
+	}
+
+	svc := media.NewService(db, storage, cfg.Media.URLTTL)
+	if enc := media.NewCWebP(75); enc != nil {
+		svc.UseWebP(enc)
+	} else {
+		log.Printf("media: cwebp not found, WebP renditions are disabled")
+	}
+
+	local, _ := storage.(*media.LocalStorage)
+	return svc, storage, local
+}
+
+// newAttachmentService stores message attachments alongside media,
+// scanning them with clamd when CLAMD_ADDR is set
+func newAttachmentService(db *sql.DB, storage media.Storage) *media.AttachmentService {
+	cfg := config.LoadConfig()
+
+	svc := media.NewAttachmentService(db, storage, cfg.Media.URLTTL)
+	if cfg.Media.ClamdAddr != "" {
+		svc.SetScanner(media.NewClamdScanner(cfg.Media.ClamdAddr, 30*time.Second))
+	} else {
+		log.Printf("media: CLAMD_ADDR not set, attachments are not virus scanned")
+	}
+	svc.Start(time.Hour)
+	return svc
+}
@@ -0,0 +1,406 @@
+// Package catalog imports and exports a seller's product catalogue as CSV
+// or XLSX spreadsheets, one row per variant.
+package catalog
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Andrew-mugwe/agroai/models"
+	"github.com/Andrew-mugwe/agroai/repository"
+	"github.com/Andrew-mugwe/agroai/services"
+	"github.com/google/uuid"
+)
+
+// SyncRowLimit is the largest import run within the request; larger files
+// are imported by a background job
+const SyncRowLimit = 200
+
+// Import job statuses
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobCompleted = "completed"
+	JobFailed    = "failed"
+)
+
+// progressEvery is how many rows a job imports between progress updates
+const progressEvery = 50
+
+// maxConcurrentJobs bounds the imports running in the background at once
+const maxConcurrentJobs = 2
+
+// ErrJobNotFound is returned for unknown jobs and jobs of other sellers
+var ErrJobNotFound = errors.New("import job not found")
+
+// Job is a persisted import. Small imports finish before the request
+// returns; larger ones run in the background and report progress here.
+type Job struct {
+	ID            uuid.UUID  `json:"id"`
+	SellerID      uuid.UUID  `json:"seller_id"`
+	Status        string     `json:"status"`
+	Filename      string     `json:"filename"`
+	Format        string     `json:"format"`
+	TotalRows     int        `json:"total_rows"`
+	ProcessedRows int        `json:"processed_rows"`
+	Created       int        `json:"created"`
+	Updated       int        `json:"updated"`
+	Unchanged     int        `json:"unchanged"`
+	Failed        int        `json:"failed"`
+	Error         *string    `json:"error,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	StartedAt     *time.Time `json:"started_at,omitempty"`
+	FinishedAt    *time.Time `json:"finished_at,omitempty"`
+
+	// Errors is filled in when an import finishes within the request; the
+	// error report endpoint serves it for every job
+	Errors []RowError `json:"errors,omitempty"`
+}
+
+// Progress is the share of rows processed, from 0 to 100
+func (j *Job) Progress() int {
+	if j.TotalRows == 0 {
+		if j.Status == JobCompleted {
+			return 100
+		}
+		return 0
+	}
+	return j.ProcessedRows * 100 / j.TotalRows
+}
+
+// MarshalJSON adds the progress percentage
+func (j Job) MarshalJSON() ([]byte, error) {
+	type job Job
+	return json.Marshal(struct {
+		job
+		Progress int `json:"progress"`
+	}{job(j), j.Progress()})
+}
+
+// Upload is a parsed spreadsheet ready to import
+type Upload struct {
+	Filename string
+	Format   string
+	Rows     [][]string
+	Mapping  ColumnMap
+}
+
+// dataRows counts the rows after the header
+func (u Upload) dataRows() int {
+	if len(u.Rows) == 0 {
+		return 0
+	}
+	return len(u.Rows) - 1
+}
+
+// Service runs imports, tracks import jobs and exports catalogues
+type Service struct {
+	db       *sql.DB
+	importer *Importer
+	repo     repository.ProductRepository
+
+	// onImported is called after an import changes a seller's catalogue
+	onImported func(sellerID uuid.UUID)
+
+	slots  chan struct{}
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewService creates a catalogue import/export service
+func NewService(db *sql.DB, products services.ProductService, repo repository.ProductRepository) *Service {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Service{
+		db:       db,
+		importer: NewImporter(products, repo),
+		repo:     repo,
+		slots:    make(chan struct{}, maxConcurrentJobs),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+}
+
+// OnImported registers a callback run after an import writes to a
+// seller's catalogue, e.g. to drop cached listings
+func (s *Service) OnImported(fn func(sellerID uuid.UUID)) {
+	s.onImported = fn
+}
+
+// Preview validates an upload and reports what importing it would do
+func (s *Service) Preview(ctx context.Context, sellerID uuid.UUID, upload Upload) (*Report, error) {
+	return s.importer.Import(ctx, sellerID, upload.Rows, upload.Mapping, Options{DryRun: true})
+}
+
+// Import imports an upload of up to SyncRowLimit rows before returning;
+// larger uploads are queued as a background job. The returned job reports
+// which happened.
+func (s *Service) Import(ctx context.Context, sellerID uuid.UUID, upload Upload) (*Job, error) {
+	if len(upload.Rows) == 0 {
+		return nil, ErrEmptyFile
+	}
+	if _, err := resolveHeader(upload.Rows[0], upload.Mapping); err != nil {
+		return nil, err
+	}
+	if upload.dataRows() > MaxRows {
+		return nil, ErrTooManyRows
+	}
+
+	job, err := s.createJob(ctx, sellerID, upload)
+	if err != nil {
+		return nil, err
+	}
+
+	if upload.dataRows() <= SyncRowLimit {
+		report := s.run(ctx, job, upload)
+		if report != nil {
+			job.Errors = report.Errors
+		}
+		return job, nil
+	}
+
+	// The background run updates job, so the caller gets a snapshot
+	queued := *job
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		select {
+		case s.slots <- struct{}{}:
+		case <-s.ctx.Done():
+			return
+		}
+		defer func() { <-s.slots }()
+		s.run(s.ctx, job, upload)
+	}()
+	return &queued, nil
+}
+
+// run imports the upload for job, recording progress and the outcome
+func (s *Service) run(ctx context.Context, job *Job, upload Upload) *Report {
+	now := time.Now()
+	job.Status, job.StartedAt = JobRunning, &now
+	if err := s.saveJob(ctx, job, nil); err != nil {
+		log.Printf("Failed to start import job %s: %v", job.ID, err)
+	}
+
+	report, err := s.importer.Import(ctx, job.SellerID, upload.Rows, upload.Mapping, Options{
+		Progress: func(report *Report, processed int) {
+			if processed%progressEvery != 0 {
+				return
+			}
+			job.apply(report, processed)
+			if err := s.saveJob(ctx, job, nil); err != nil {
+				log.Printf("Failed to record progress of import job %s: %v", job.ID, err)
+			}
+		},
+	})
+
+	finished := time.Now()
+	job.FinishedAt = &finished
+	var errs []RowError
+	if report != nil {
+		processed := upload.dataRows()
+		if err != nil {
+			processed = job.ProcessedRows
+		}
+		job.apply(report, processed)
+		errs = report.Errors
+	}
+	if err != nil {
+		message := err.Error()
+		job.Status, job.Error = JobFailed, &message
+	} else {
+		job.Status = JobCompleted
+	}
+
+	// Record the outcome even if the request that started the job is gone
+	if err := s.saveJob(context.Background(), job, errs); err != nil {
+		log.Printf("Failed to finish import job %s: %v", job.ID, err)
+	}
+	if report != nil && report.Created+report.Updated > 0 && s.onImported != nil {
+		s.onImported(job.SellerID)
+	}
+	return report
+}
+
+// apply copies a report's counts into the job
+func (j *Job) apply(r *Report, processed int) {
+	j.ProcessedRows = processed
+	j.Created, j.Updated, j.Unchanged, j.Failed = r.Created, r.Updated, r.Unchanged, r.Failed
+}
+
+func (s *Service) createJob(ctx context.Context, sellerID uuid.UUID, upload Upload) (*Job, error) {
+	job := &Job{
+		SellerID:  sellerID,
+		Status:    JobQueued,
+		Filename:  upload.Filename,
+		Format:    upload.Format,
+		TotalRows: upload.dataRows(),
+	}
+	err := s.db.QueryRowContext(ctx, `
+		INSERT INTO product_import_jobs (seller_id, status, filename, format, total_rows)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at
+	`, job.SellerID, job.Status, job.Filename, job.Format, job.TotalRows).Scan(&job.ID, &job.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create import job: %w", err)
+	}
+	return job, nil
+}
+
+// saveJob writes the job's status and counts, and its row errors when given
+func (s *Service) saveJob(ctx context.Context, job *Job, errs []RowError) error {
+	var errorsJSON interface{}
+	if errs != nil {
+		data, err := json.Marshal(errs)
+		if err != nil {
+			return fmt.Errorf("failed to encode import errors: %w", err)
+		}
+		errorsJSON = string(data)
+	}
+
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE product_import_jobs
+		SET status = $2, processed_rows = $3, created_count = $4, updated_count = $5,
+		    unchanged_count = $6, failed_count = $7, error = $8, started_at = $9,
+		    finished_at = $10, row_errors = COALESCE($11::jsonb, row_errors), updated_at = NOW()
+		WHERE id = $1
+	`, job.ID, job.Status, job.ProcessedRows, job.Created, job.Updated, job.Unchanged,
+		job.Failed, job.Error, job.StartedAt, job.FinishedAt, errorsJSON)
+	if err != nil {
+		return fmt.Errorf("failed to update import job: %w", err)
+	}
+	return nil
+}
+
+// GetJob returns one of the seller's import jobs
+func (s *Service) GetJob(ctx context.Context, sellerID, jobID uuid.UUID) (*Job, error) {
+	job := &Job{}
+	err := s.db.QueryRowContext(ctx, `
+		SELECT id, seller_id, status, filename, format, total_rows, processed_rows,
+		       created_count, updated_count, unchanged_count, failed_count, error,
+		       created_at, started_at, finished_at
+		FROM product_import_jobs
+		WHERE id = $1 AND seller_id = $2
+	`, jobID, sellerID).Scan(
+		&job.ID, &job.SellerID, &job.Status, &job.Filename, &job.Format, &job.TotalRows,
+		&job.ProcessedRows, &job.Created, &job.Updated, &job.Unchanged, &job.Failed,
+		&job.Error, &job.CreatedAt, &job.StartedAt, &job.FinishedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrJobNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get import job: %w", err)
+	}
+	return job, nil
+}
+
+// JobErrors returns the row errors of one of the seller's finished jobs
+func (s *Service) JobErrors(ctx context.Context, sellerID, jobID uuid.UUID) ([]RowError, error) {
+	var data []byte
+	err := s.db.QueryRowContext(ctx, `
+		SELECT row_errors FROM product_import_jobs WHERE id = $1 AND seller_id = $2
+	`, jobID, sellerID).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, ErrJobNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get import errors: %w", err)
+	}
+
+	errs := []RowError{}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &errs); err != nil {
+			return nil, fmt.Errorf("failed to decode import errors: %w", err)
+		}
+	}
+	return errs, nil
+}
+
+// FailInterrupted marks jobs left queued or running by a previous process
+// as failed, since their uploads were only held in memory
+func (s *Service) FailInterrupted(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE product_import_jobs
+		SET status = $1, error = 'interrupted by a server restart; upload the file again',
+		    finished_at = NOW(), updated_at = NOW()
+		WHERE status IN ($2, $3)
+	`, JobFailed, JobQueued, JobRunning)
+	if err != nil {
+		return fmt.Errorf("failed to fail interrupted import jobs: %w", err)
+	}
+	return nil
+}
+
+// Stop cancels background imports and waits for them to record their state
+func (s *Service) Stop() {
+	s.cancel()
+	s.wg.Wait()
+}
+
+// ErrorReport renders row errors as spreadsheet rows
+func ErrorReport(errs []RowError) [][]string {
+	rows := [][]string{{"row", "sku", "column", "message"}}
+	for _, e := range errs {
+		rows = append(rows, []string{fmt.Sprint(e.Row), e.SKU, e.Column, e.Message})
+	}
+	return rows
+}
+
+// Export renders the seller's whole catalogue, one row per variant, in the
+// columns Import reads
+func (s *Service) Export(ctx context.Context, sellerID uuid.UUID) ([][]string, error) {
+	products, err := s.repo.List(ctx, repository.ProductFilter{SellerID: &sellerID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load catalogue: %w", err)
+	}
+	return exportRows(products), nil
+}
+
+func exportRows(products []*models.Product) [][]string {
+	sort.SliceStable(products, func(i, j int) bool {
+		return titleKey(products[i].Title) < titleKey(products[j].Title)
+	})
+
+	rows := [][]string{Fields}
+	for _, p := range products {
+		for _, v := range p.Variants {
+			barcode := ""
+			if v.Barcode != nil {
+				barcode = *v.Barcode
+			}
+			rows = append(rows, []string{
+				v.SKU,
+				p.Title,
+				p.Description,
+				string(p.Category),
+				p.Currency,
+				v.PackSize.String(),
+				string(v.Unit),
+				v.Price().StringFixed(2),
+				fmt.Sprint(v.Stock),
+				barcode,
+				strings.Join(p.Images, "|"),
+				yesNo(p.IsActive),
+				yesNo(v.IsActive),
+			})
+		}
+	}
+	return rows
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
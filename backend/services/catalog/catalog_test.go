@@ -0,0 +1,346 @@
+package catalog
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/Andrew-mugwe/agroai/models"
+	"github.com/Andrew-mugwe/agroai/pagination"
+	"github.com/Andrew-mugwe/agroai/repository"
+	"github.com/Andrew-mugwe/agroai/services"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryRepo is an in-memory catalogue behind the real product service
+type memoryRepo struct {
+	repository.ProductRepository
+	products map[uuid.UUID]*models.Product
+	writes   int
+}
+
+func newMemoryRepo(products ...*models.Product) *memoryRepo {
+	r := &memoryRepo{products: map[uuid.UUID]*models.Product{}}
+	for _, p := range products {
+		r.products[p.ID] = p
+	}
+	return r
+}
+
+func (r *memoryRepo) clone(p *models.Product) *models.Product {
+	c := *p
+	c.Variants = append([]models.ProductVariant(nil), p.Variants...)
+	return &c
+}
+
+func (r *memoryRepo) Create(ctx context.Context, p *models.Product) error {
+	r.writes++
+	p.ID = uuid.New()
+	for i := range p.Variants {
+		p.Variants[i].ID = uuid.New()
+		p.Variants[i].ProductID = p.ID
+	}
+	r.products[p.ID] = r.clone(p)
+	return nil
+}
+
+func (r *memoryRepo) Update(ctx context.Context, p *models.Product) error {
+	r.writes++
+	stored := r.products[p.ID]
+	variants := stored.Variants
+	*stored = *r.clone(p)
+	stored.Variants = variants
+	return nil
+}
+
+func (r *memoryRepo) GetByID(ctx context.Context, id uuid.UUID) (*models.Product, error) {
+	p, ok := r.products[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return r.clone(p), nil
+}
+
+func (r *memoryRepo) List(ctx context.Context, filter repository.ProductFilter) ([]*models.Product, error) {
+	var out []*models.Product
+	for _, p := range r.products {
+		if filter.SellerID == nil || p.SellerID == *filter.SellerID {
+			out = append(out, r.clone(p))
+		}
+	}
+	return out, nil
+}
+
+func (r *memoryRepo) ListPage(ctx context.Context, filter repository.ProductFilter, page pagination.Params) (pagination.Page[*models.Product], error) {
+	return pagination.Page[*models.Product]{}, nil
+}
+
+func (r *memoryRepo) CreateVariant(ctx context.Context, v *models.ProductVariant) error {
+	r.writes++
+	v.ID = uuid.New()
+	p := r.products[v.ProductID]
+	p.Variants = append(p.Variants, *v)
+	return nil
+}
+
+func (r *memoryRepo) UpdateVariant(ctx context.Context, v *models.ProductVariant) error {
+	r.writes++
+	p := r.products[v.ProductID]
+	for i := range p.Variants {
+		if p.Variants[i].ID == v.ID {
+			p.Variants[i] = *v
+		}
+	}
+	return nil
+}
+
+func (r *memoryRepo) variantBySKU(sku string) (*models.Product, *models.ProductVariant) {
+	for _, p := range r.products {
+		for i := range p.Variants {
+			if p.Variants[i].SKU == sku {
+				return p, &p.Variants[i]
+			}
+		}
+	}
+	return nil, nil
+}
+
+func existingMaize(sellerID uuid.UUID) *models.Product {
+	productID := uuid.New()
+	p := &models.Product{
+		ID:          productID,
+		SellerID:    sellerID,
+		Title:       "Hybrid Maize Seed",
+		Description: "Drought tolerant H614 maize seed",
+		Category:    models.CategorySeeds,
+		Currency:    "KES",
+		IsActive:    true,
+		Variants: []models.ProductVariant{{
+			ID: uuid.New(), ProductID: productID, SKU: "MAIZE-2KG",
+			PackSize: decimal.NewFromInt(2), Unit: models.UnitKilogram,
+			PriceCents: 45000, Stock: 10, IsActive: true,
+		}},
+	}
+	p.SummariseVariants()
+	return p
+}
+
+func newTestImporter(repo *memoryRepo) *Importer {
+	return NewImporter(services.NewProductService(repo), repo)
+}
+
+func TestSheetRoundTrip(t *testing.T) {
+	rows := [][]string{
+		{"sku", "title", "barcode"},
+		{"007", "Seeds & <Fertiliser>", "0123456789012"},
+		{"", "Blank first cell", ""},
+	}
+
+	for _, format := range []string{FormatCSV, FormatXLSX} {
+		var buf bytes.Buffer
+		require.NoError(t, WriteSheet(&buf, format, rows))
+
+		got, detected, err := ReadSheet(buf.Bytes())
+		require.NoError(t, err)
+		assert.Equal(t, format, detected)
+		assert.Equal(t, "007", got[1][0], format)
+		assert.Equal(t, "Seeds & <Fertiliser>", got[1][1], format)
+		assert.Equal(t, "0123456789012", got[1][2], format)
+		assert.Equal(t, "Blank first cell", got[2][1], format)
+	}
+}
+
+func TestReadSheetRejectsBinary(t *testing.T) {
+	_, _, err := ReadSheet([]byte("\x89PNG\r\n\x1a\n\x00\x00"))
+	assert.ErrorIs(t, err, ErrUnsupportedFormat)
+}
+
+// zipBomb packs a workbook that inflates past maxXLSXPart, one open
+// element followed by blanks, while its header declares declaredSize
+func zipBomb(t *testing.T, declaredSize uint64) []byte {
+	var compressed bytes.Buffer
+	fw, err := flate.NewWriter(&compressed, flate.BestSpeed)
+	require.NoError(t, err)
+	_, err = fw.Write([]byte("<workbook>"))
+	require.NoError(t, err)
+	blanks := bytes.Repeat([]byte(" "), 1<<20)
+	for written := 0; written <= maxXLSXPart; written += len(blanks) {
+		_, err := fw.Write(blanks)
+		require.NoError(t, err)
+	}
+	require.NoError(t, fw.Close())
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.CreateRaw(&zip.FileHeader{
+		Name:               "xl/workbook.xml",
+		Method:             zip.Deflate,
+		CompressedSize64:   uint64(compressed.Len()),
+		UncompressedSize64: declaredSize,
+	})
+	require.NoError(t, err)
+	_, err = w.Write(compressed.Bytes())
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+func TestReadSheetRejectsZipBomb(t *testing.T) {
+	// Declared honestly, the part is refused before it is opened
+	_, _, err := ReadSheet(zipBomb(t, maxXLSXPart+1))
+	assert.ErrorIs(t, err, ErrSheetTooLarge)
+
+	// Declared small, inflating stops just past the declared size
+	_, _, err = ReadSheet(zipBomb(t, 1024))
+	assert.ErrorIs(t, err, ErrUnsupportedFormat)
+	assert.True(t, IsInputError(err))
+}
+
+func TestColumnName(t *testing.T) {
+	for col, name := range map[int]string{0: "A", 25: "Z", 26: "AA", 27: "AB", 701: "ZZ", 702: "AAA"} {
+		assert.Equal(t, name, columnName(col))
+		assert.Equal(t, col, columnIndex(name+"12"))
+	}
+}
+
+func TestResolveHeader(t *testing.T) {
+	h, err := resolveHeader([]string{"Item Code", "Product Name", "Qty", "Selling Price"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, header{FieldSKU: 0, FieldTitle: 1, FieldStock: 2, FieldPrice: 3}, h)
+
+	h, err = resolveHeader([]string{"Code", "Jina", "Bei"}, ColumnMap{FieldTitle: "jina", FieldPrice: "Bei"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, h[FieldTitle])
+	assert.Equal(t, 2, h[FieldPrice])
+
+	_, err = resolveHeader([]string{"title", "price"}, nil)
+	assert.ErrorIs(t, err, ErrInvalidHeader)
+
+	_, err = resolveHeader([]string{"sku"}, ColumnMap{"colour": "sku"})
+	assert.ErrorIs(t, err, ErrInvalidHeader)
+
+	_, err = resolveHeader([]string{"sku"}, ColumnMap{FieldTitle: "Name"})
+	assert.ErrorIs(t, err, ErrInvalidHeader)
+}
+
+func TestParsePrice(t *testing.T) {
+	cents, err := parsePrice("1,250.5")
+	require.NoError(t, err)
+	assert.Equal(t, int64(125050), cents)
+
+	_, err = parsePrice("12.345")
+	assert.Error(t, err)
+	_, err = parsePrice("free")
+	assert.Error(t, err)
+}
+
+func TestImportUpsertsBySKU(t *testing.T) {
+	sellerID := uuid.New()
+	maize := existingMaize(sellerID)
+	repo := newMemoryRepo(maize)
+
+	rows := [][]string{
+		{"sku", "title", "description", "category", "pack_size", "unit", "price", "stock"},
+		// Existing SKU: price and stock change
+		{"maize-2kg", "", "", "", "", "", "480", "25"},
+		// New SKU for an existing title: added as a variant
+		{"MAIZE-10KG", "hybrid maize seed", "", "", "10", "kg", "2100", "4"},
+		// New product over two rows
+		{"DAP-50KG", "DAP Fertiliser", "Di-ammonium phosphate planting fertiliser", "fertilizer", "50", "kg", "3500", "8"},
+		{"DAP-25KG", "DAP Fertiliser", "", "", "25", "kg", "1800", "12"},
+		// Row errors
+		{"HOE-1", "Jembe", "Forged steel hand hoe", "tools", "1", "bunch", "600", "3"},
+		{"DAP-50KG", "DAP Fertiliser", "", "", "50", "kg", "3400", "8"},
+		{"NEW-1", "Knapsack", "", "", "", "", "", ""},
+		{"", "", "", "", "", "", "", ""},
+	}
+
+	report, err := newTestImporter(repo).Import(context.Background(), sellerID, rows, nil, Options{})
+	require.NoError(t, err)
+
+	assert.Equal(t, 7, report.Total)
+	assert.Equal(t, 3, report.Created)
+	assert.Equal(t, 1, report.Updated)
+	assert.Equal(t, 3, report.Failed)
+	assert.Equal(t, []string{ActionUpdate, ActionAddVariant, ActionCreate, ActionAddVariant, ActionError, ActionError, ActionError},
+		actions(report))
+
+	_, variant := repo.variantBySKU("MAIZE-2KG")
+	require.NotNil(t, variant)
+	assert.Equal(t, int64(48000), variant.PriceCents)
+	assert.Equal(t, 25, variant.Stock)
+
+	product, variant := repo.variantBySKU("MAIZE-10KG")
+	require.NotNil(t, variant)
+	assert.Equal(t, maize.ID, product.ID)
+
+	dap50, _ := repo.variantBySKU("DAP-50KG")
+	dap25, _ := repo.variantBySKU("DAP-25KG")
+	require.NotNil(t, dap50)
+	require.NotNil(t, dap25)
+	assert.Equal(t, dap50.ID, dap25.ID)
+	assert.Len(t, repo.products, 2)
+
+	require.Len(t, report.Errors, 3)
+	assert.Equal(t, RowError{Row: 6, SKU: "HOE-1", Column: FieldUnit, Message: `unknown unit "bunch"`}, report.Errors[0])
+	assert.Equal(t, 7, report.Errors[1].Row)
+	assert.Contains(t, report.Errors[1].Message, "row 4")
+	assert.Equal(t, FieldPrice, report.Errors[2].Column)
+}
+
+func TestImportDryRunWritesNothing(t *testing.T) {
+	sellerID := uuid.New()
+	repo := newMemoryRepo(existingMaize(sellerID))
+
+	rows := [][]string{
+		{"sku", "title", "description", "price"},
+		{"MAIZE-2KG", "", "", "500"},
+		{"CAN-1", "CAN Fertiliser", "Calcium ammonium nitrate top dressing", "2900"},
+		{"CAN-2", "CAN Fertiliser", "", "3100"},
+		{"SHORT-1", "Oil", "Too short", "100"},
+	}
+
+	report, err := newTestImporter(repo).Import(context.Background(), sellerID, rows, nil, Options{DryRun: true})
+	require.NoError(t, err)
+
+	assert.True(t, report.DryRun)
+	assert.Equal(t, []string{ActionUpdate, ActionCreate, ActionAddVariant, ActionError}, actions(report))
+	require.Len(t, report.Errors, 1)
+	assert.Contains(t, report.Errors[0].Message, "description")
+	assert.Zero(t, repo.writes)
+}
+
+func TestExportImportsUnchanged(t *testing.T) {
+	sellerID := uuid.New()
+	maize := existingMaize(sellerID)
+	barcode := "5012345678900"
+	maize.Images = []string{"https://cdn.example.com/a.jpg", "https://cdn.example.com/b.jpg"}
+	maize.Variants[0].Barcode = &barcode
+	repo := newMemoryRepo(maize)
+
+	rows := exportRows([]*models.Product{maize})
+	assert.Equal(t, Fields, rows[0])
+	assert.Equal(t, []string{
+		"MAIZE-2KG", "Hybrid Maize Seed", "Drought tolerant H614 maize seed", "seeds", "KES",
+		"2", "kg", "450.00", "10", barcode, "https://cdn.example.com/a.jpg|https://cdn.example.com/b.jpg", "yes", "yes",
+	}, rows[1])
+
+	report, err := newTestImporter(repo).Import(context.Background(), sellerID, rows, nil, Options{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{ActionUnchanged}, actions(report))
+	assert.Zero(t, repo.writes)
+}
+
+func actions(r *Report) []string {
+	out := make([]string, len(r.Rows))
+	for i, row := range r.Rows {
+		out[i] = row.Action
+	}
+	return out
+}
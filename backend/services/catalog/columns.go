@@ -0,0 +1,132 @@
+package catalog
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Catalogue fields a spreadsheet column can map to. Each row is one
+// variant; rows that share a title belong to the same product.
+const (
+	FieldSKU           = "sku"
+	FieldTitle         = "title"
+	FieldDescription   = "description"
+	FieldCategory      = "category"
+	FieldCurrency      = "currency"
+	FieldPackSize      = "pack_size"
+	FieldUnit          = "unit"
+	FieldPrice         = "price"
+	FieldStock         = "stock"
+	FieldBarcode       = "barcode"
+	FieldImages        = "images"
+	FieldActive        = "is_active"
+	FieldVariantActive = "variant_active"
+)
+
+// Fields lists the catalogue fields in export column order
+var Fields = []string{
+	FieldSKU, FieldTitle, FieldDescription, FieldCategory, FieldCurrency,
+	FieldPackSize, FieldUnit, FieldPrice, FieldStock, FieldBarcode,
+	FieldImages, FieldActive, FieldVariantActive,
+}
+
+// headerAliases are the other headers recognised for each field when no
+// mapping is given, in normalised form
+var headerAliases = map[string][]string{
+	FieldSKU:           {"item_code", "product_code", "code"},
+	FieldTitle:         {"name", "product_name", "product"},
+	FieldDescription:   {"details", "product_description"},
+	FieldCategory:      {"product_category"},
+	FieldPackSize:      {"pack", "size", "quantity_per_pack"},
+	FieldUnit:          {"uom", "unit_of_measure"},
+	FieldPrice:         {"selling_price", "price_kes"},
+	FieldStock:         {"quantity", "qty", "stock_quantity"},
+	FieldBarcode:       {"gtin", "ean", "upc"},
+	FieldImages:        {"image", "image_urls", "image_url"},
+	FieldActive:        {"active", "product_active"},
+	FieldVariantActive: {"pack_active"},
+}
+
+// Header errors
+var (
+	ErrEmptyFile     = errors.New("the file has no header row")
+	ErrInvalidHeader = errors.New("invalid column mapping")
+)
+
+// ColumnMap maps catalogue fields to the spreadsheet headers that hold them,
+// e.g. {"title": "Product Name"}. Fields it leaves out are matched by name.
+type ColumnMap map[string]string
+
+// header is the resolved position of each mapped field in the file
+type header map[string]int
+
+// resolveHeader matches the header row against the fields. Explicit
+// mappings win; otherwise a column matches a field by name or alias.
+func resolveHeader(row []string, mapping ColumnMap) (header, error) {
+	positions := make(map[string]int, len(row))
+	for i, name := range row {
+		key := normaliseHeader(name)
+		if _, seen := positions[key]; key != "" && !seen {
+			positions[key] = i
+		}
+	}
+
+	h := header{}
+	for field, column := range mapping {
+		if !knownField(field) {
+			return nil, fmt.Errorf("%w: unknown field %q", ErrInvalidHeader, field)
+		}
+		i, ok := positions[normaliseHeader(column)]
+		if !ok {
+			return nil, fmt.Errorf("%w: column %q for %s is not in the file", ErrInvalidHeader, column, field)
+		}
+		h[field] = i
+	}
+
+	for _, field := range Fields {
+		if _, mapped := h[field]; mapped {
+			continue
+		}
+		for _, name := range append([]string{field}, headerAliases[field]...) {
+			if i, ok := positions[name]; ok {
+				h[field] = i
+				break
+			}
+		}
+	}
+
+	if _, ok := h[FieldSKU]; !ok {
+		return nil, fmt.Errorf("%w: a sku column is required to match rows to the catalogue", ErrInvalidHeader)
+	}
+	return h, nil
+}
+
+func knownField(field string) bool {
+	for _, f := range Fields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// normaliseHeader lowercases a header and joins its words with underscores,
+// so "Pack Size" and "pack-size" both match pack_size
+func normaliseHeader(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	name = strings.TrimPrefix(name, "\ufeff")
+	return strings.Join(strings.FieldsFunc(name, func(r rune) bool {
+		return r == ' ' || r == '-' || r == '_' || r == '.'
+	}), "_")
+}
+
+// cell returns the trimmed value of field in row and whether it is set
+func (h header) cell(row []string, field string) (string, bool) {
+	i, ok := h[field]
+	if !ok || i >= len(row) {
+		return "", false
+	}
+	value := strings.TrimSpace(row[i])
+	return value, value != ""
+}
@@ -0,0 +1,720 @@
+package catalog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/Andrew-mugwe/agroai/models"
+	"github.com/Andrew-mugwe/agroai/repository"
+	"github.com/Andrew-mugwe/agroai/services"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// MaxRows bounds the data rows of one import
+const MaxRows = 20000
+
+// ErrTooManyRows is returned for files with more than MaxRows data rows
+var ErrTooManyRows = fmt.Errorf("a file can hold at most %d products", MaxRows)
+
+// What an import did, or in a dry run would do, with a row
+const (
+	ActionCreate     = "create"
+	ActionAddVariant = "add_variant"
+	ActionUpdate     = "update"
+	ActionUnchanged  = "unchanged"
+	ActionError      = "error"
+)
+
+// RowError is a problem with one row. Row counts lines from 1, so the
+// header is row 1 and the first product row 2.
+type RowError struct {
+	Row     int    `json:"row"`
+	SKU     string `json:"sku,omitempty"`
+	Column  string `json:"column,omitempty"`
+	Message string `json:"message"`
+}
+
+// RowResult is the outcome for one row
+type RowResult struct {
+	Row       int        `json:"row"`
+	SKU       string     `json:"sku"`
+	Action    string     `json:"action"`
+	ProductID *uuid.UUID `json:"product_id,omitempty"`
+}
+
+// Report summarises an import or a dry-run preview
+type Report struct {
+	DryRun    bool        `json:"dry_run"`
+	Total     int         `json:"total_rows"`
+	Created   int         `json:"created"`
+	Updated   int         `json:"updated"`
+	Unchanged int         `json:"unchanged"`
+	Failed    int         `json:"failed"`
+	Rows      []RowResult `json:"rows,omitempty"`
+	Errors    []RowError  `json:"errors"`
+}
+
+func (r *Report) record(result RowResult, errs []RowError) {
+	if len(errs) > 0 {
+		result.Action = ActionError
+		r.Errors = append(r.Errors, errs...)
+	}
+	switch result.Action {
+	case ActionCreate, ActionAddVariant:
+		r.Created++
+	case ActionUpdate:
+		r.Updated++
+	case ActionUnchanged:
+		r.Unchanged++
+	case ActionError:
+		r.Failed++
+	}
+	r.Rows = append(r.Rows, result)
+}
+
+// Options controls an import
+type Options struct {
+	// DryRun validates and previews every row without saving anything
+	DryRun bool
+	// Progress, when set, is called after each row
+	Progress func(report *Report, processed int)
+}
+
+// Importer upserts spreadsheet rows into a seller's catalogue by SKU.
+// Rows whose SKU the seller already sells update that variant and its
+// product; other rows add a variant to the seller's product with the same
+// title, or create the product.
+type Importer struct {
+	products services.ProductService
+	repo     repository.ProductRepository
+}
+
+// NewImporter creates an importer writing through the product service
+func NewImporter(products services.ProductService, repo repository.ProductRepository) *Importer {
+	return &Importer{products: products, repo: repo}
+}
+
+// Import applies rows, a header row followed by one row per variant
+func (im *Importer) Import(ctx context.Context, sellerID uuid.UUID, rows [][]string, mapping ColumnMap, opts Options) (*Report, error) {
+	if len(rows) == 0 {
+		return nil, ErrEmptyFile
+	}
+	h, err := resolveHeader(rows[0], mapping)
+	if err != nil {
+		return nil, err
+	}
+	data := rows[1:]
+	if len(data) > MaxRows {
+		return nil, ErrTooManyRows
+	}
+
+	existing, err := im.repo.List(ctx, repository.ProductFilter{SellerID: &sellerID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load catalogue: %w", err)
+	}
+	cat := newCatalogue(existing)
+
+	report := &Report{DryRun: opts.DryRun, Errors: []RowError{}}
+	firstSeen := map[string]int{}
+	for i, row := range data {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		line := i + 2
+		if blank(row) {
+			continue
+		}
+		report.Total++
+
+		values, errs := parseRow(h, row, line)
+		if first, dup := firstSeen[strings.ToUpper(values.sku)]; dup && values.sku != "" {
+			errs = append(errs, RowError{Row: line, SKU: values.sku, Column: FieldSKU,
+				Message: fmt.Sprintf("SKU already appears on row %d", first)})
+		} else if values.sku != "" {
+			firstSeen[strings.ToUpper(values.sku)] = line
+		}
+
+		result := RowResult{Row: line, SKU: values.sku}
+		if len(errs) == 0 {
+			result, errs = im.apply(ctx, sellerID, cat, values, opts.DryRun)
+		}
+		report.record(result, errs)
+
+		if opts.Progress != nil {
+			opts.Progress(report, i+1)
+		}
+	}
+
+	return report, nil
+}
+
+// catalogue indexes the seller's products by SKU and title as the import
+// changes them
+type catalogue struct {
+	bySKU   map[string]skuRef
+	byTitle map[string]*models.Product
+}
+
+type skuRef struct {
+	product   *models.Product
+	variantID uuid.UUID
+}
+
+func newCatalogue(products []*models.Product) *catalogue {
+	c := &catalogue{bySKU: map[string]skuRef{}, byTitle: map[string]*models.Product{}}
+	for _, p := range products {
+		c.put(p)
+	}
+	return c
+}
+
+func (c *catalogue) put(p *models.Product) {
+	key := titleKey(p.Title)
+	if _, ok := c.byTitle[key]; !ok {
+		c.byTitle[key] = p
+	}
+	for _, v := range p.Variants {
+		c.bySKU[strings.ToUpper(v.SKU)] = skuRef{product: p, variantID: v.ID}
+	}
+}
+
+func titleKey(title string) string {
+	return strings.ToLower(strings.Join(strings.Fields(title), " "))
+}
+
+// rowValues are the parsed cells of a row; nil fields were left blank
+type rowValues struct {
+	line          int
+	sku           string
+	title         *string
+	description   *string
+	category      *models.ProductCategory
+	currency      *string
+	packSize      *decimal.Decimal
+	unit          *models.UnitOfMeasure
+	priceCents    *int64
+	stock         *int
+	barcode       *string
+	images        *[]string
+	active        *bool
+	variantActive *bool
+}
+
+func blank(row []string) bool {
+	for _, cell := range row {
+		if strings.TrimSpace(cell) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// parseRow reads and checks the format of each cell. Rules that depend on
+// the catalogue are left to apply.
+func parseRow(h header, row []string, line int) (rowValues, []RowError) {
+	v := rowValues{line: line}
+	var errs []RowError
+	fail := func(field, format string, args ...interface{}) {
+		errs = append(errs, RowError{Row: line, SKU: v.sku, Column: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if sku, ok := h.cell(row, FieldSKU); ok {
+		v.sku = sku
+	} else {
+		fail(FieldSKU, "SKU is required")
+	}
+	if s, ok := h.cell(row, FieldTitle); ok {
+		v.title = &s
+	}
+	if s, ok := h.cell(row, FieldDescription); ok {
+		v.description = &s
+	}
+	if s, ok := h.cell(row, FieldCategory); ok {
+		category := models.ProductCategory(strings.ToLower(s))
+		if category.IsValid() {
+			v.category = &category
+		} else {
+			fail(FieldCategory, "unknown category %q", s)
+		}
+	}
+	if s, ok := h.cell(row, FieldCurrency); ok {
+		currency := strings.ToUpper(s)
+		v.currency = &currency
+	}
+	if s, ok := h.cell(row, FieldPackSize); ok {
+		if size, err := decimal.NewFromString(s); err == nil {
+			v.packSize = &size
+		} else {
+			fail(FieldPackSize, "pack size %q is not a number", s)
+		}
+	}
+	if s, ok := h.cell(row, FieldUnit); ok {
+		unit := models.UnitOfMeasure(strings.ToLower(s))
+		if unit.IsValid() {
+			v.unit = &unit
+		} else {
+			fail(FieldUnit, "unknown unit %q", s)
+		}
+	}
+	if s, ok := h.cell(row, FieldPrice); ok {
+		if cents, err := parsePrice(s); err == nil {
+			v.priceCents = &cents
+		} else {
+			fail(FieldPrice, "%v", err)
+		}
+	}
+	if s, ok := h.cell(row, FieldStock); ok {
+		if stock, err := parseWhole(s); err == nil {
+			v.stock = &stock
+		} else {
+			fail(FieldStock, "stock %q is not a whole number", s)
+		}
+	}
+	if s, ok := h.cell(row, FieldBarcode); ok {
+		v.barcode = &s
+	}
+	if s, ok := h.cell(row, FieldImages); ok {
+		images := splitImages(s)
+		v.images = &images
+	}
+	for field, dst := range map[string]**bool{FieldActive: &v.active, FieldVariantActive: &v.variantActive} {
+		if s, ok := h.cell(row, field); ok {
+			if b, ok := parseBool(s); ok {
+				*dst = &b
+			} else {
+				fail(field, "%q is not yes or no", s)
+			}
+		}
+	}
+
+	return v, errs
+}
+
+// parsePrice reads a price in major units, e.g. "1,250.50", as cents
+func parsePrice(s string) (int64, error) {
+	d, err := decimal.NewFromString(strings.ReplaceAll(s, ",", ""))
+	if err != nil {
+		return 0, fmt.Errorf("price %q is not a number", s)
+	}
+	cents := d.Shift(2)
+	if !cents.Equal(cents.Truncate(0)) {
+		return 0, fmt.Errorf("price %q has more than two decimal places", s)
+	}
+	return cents.IntPart(), nil
+}
+
+// parseWhole reads an integer, accepting spreadsheet renderings such as "12.0"
+func parseWhole(s string) (int, error) {
+	if n, err := strconv.Atoi(s); err == nil {
+		return n, nil
+	}
+	d, err := decimal.NewFromString(strings.ReplaceAll(s, ",", ""))
+	if err != nil || !d.Equal(d.Truncate(0)) {
+		return 0, fmt.Errorf("not a whole number")
+	}
+	return int(d.IntPart()), nil
+}
+
+func parseBool(s string) (bool, bool) {
+	switch strings.ToLower(s) {
+	case "true", "yes", "y", "1", "active":
+		return true, true
+	case "false", "no", "n", "0", "inactive":
+		return false, true
+	}
+	return false, false
+}
+
+// splitImages reads image URLs separated by "|" or line breaks
+func splitImages(s string) []string {
+	images := []string{}
+	for _, part := range strings.FieldsFunc(s, func(r rune) bool { return r == '|' || r == '\n' }) {
+		if url := strings.TrimSpace(part); url != "" {
+			images = append(images, url)
+		}
+	}
+	return images
+}
+
+// apply upserts one parsed row
+func (im *Importer) apply(ctx context.Context, sellerID uuid.UUID, cat *catalogue, v rowValues, dryRun bool) (RowResult, []RowError) {
+	result := RowResult{Row: v.line, SKU: v.sku}
+	rowErr := func(err error) []RowError {
+		return []RowError{{Row: v.line, SKU: v.sku, Message: err.Error()}}
+	}
+
+	if ref, ok := cat.bySKU[strings.ToUpper(v.sku)]; ok {
+		result.ProductID = &ref.product.ID
+		changed, err := im.update(ctx, sellerID, ref, v, dryRun)
+		if err != nil {
+			return result, rowErr(err)
+		}
+		result.Action = ActionUnchanged
+		if changed {
+			result.Action = ActionUpdate
+		}
+		return result, nil
+	}
+
+	if v.title == nil {
+		return result, []RowError{{Row: v.line, SKU: v.sku, Column: FieldTitle, Message: "title is required for a new SKU"}}
+	}
+	if v.priceCents == nil {
+		return result, []RowError{{Row: v.line, SKU: v.sku, Column: FieldPrice, Message: "price is required for a new SKU"}}
+	}
+
+	if product, ok := cat.byTitle[titleKey(*v.title)]; ok {
+		result.ProductID = &product.ID
+		if err := im.addVariant(ctx, sellerID, cat, product, v, dryRun); err != nil {
+			return result, rowErr(err)
+		}
+		result.Action = ActionAddVariant
+		return result, nil
+	}
+
+	product, err := im.create(ctx, sellerID, v, dryRun)
+	if err != nil {
+		return result, rowErr(err)
+	}
+	cat.put(product)
+	result.ProductID = &product.ID
+	result.Action = ActionCreate
+	return result, nil
+}
+
+// variantRequest is the new variant a row describes; a row without a pack
+// is sold per piece
+func (v rowValues) variantRequest() models.ProductVariantRequest {
+	req := models.ProductVariantRequest{
+		SKU:        v.sku,
+		PackSize:   decimal.NewFromInt(1),
+		Unit:       models.UnitPiece,
+		PriceCents: *v.priceCents,
+		Barcode:    v.barcode,
+
+		StockReason: models.StockImport,
+	}
+	if v.packSize != nil {
+		req.PackSize = *v.packSize
+	}
+	if v.unit != nil {
+		req.Unit = *v.unit
+	}
+	if v.stock != nil {
+		req.Stock = *v.stock
+	}
+	return req
+}
+
+// productChanges is the update the row's product columns make to p, nil
+// when they match
+func (v rowValues) productChanges(p *models.Product) *models.UpdateProductRequest {
+	req := &models.UpdateProductRequest{}
+	changed := false
+	// Titles group rows into products case-insensitively, so only a real
+	// rename changes the title
+	if v.title != nil && titleKey(*v.title) != titleKey(p.Title) {
+		req.Title, changed = v.title, true
+	}
+	if v.description != nil && *v.description != p.Description {
+		req.Description, changed = v.description, true
+	}
+	if v.category != nil && *v.category != p.Category {
+		req.Category, changed = v.category, true
+	}
+	if v.currency != nil && *v.currency != p.Currency {
+		req.Currency, changed = v.currency, true
+	}
+	if v.images != nil && !sameStrings(*v.images, p.Images) {
+		req.Images, changed = v.images, true
+	}
+	if v.active != nil && *v.active != p.IsActive {
+		req.IsActive, changed = v.active, true
+	}
+	if !changed {
+		return nil
+	}
+	return req
+}
+
+// variantChanges is the update the row's variant columns make to variant,
+// nil when they match. SKUs match case-insensitively and keep their stored
+// form.
+func (v rowValues) variantChanges(variant *models.ProductVariant) *models.UpdateProductVariantRequest {
+	req := &models.UpdateProductVariantRequest{StockReason: models.StockImport}
+	changed := false
+	if v.packSize != nil && !v.packSize.Equal(variant.PackSize) {
+		req.PackSize, changed = v.packSize, true
+	}
+	if v.unit != nil && *v.unit != variant.Unit {
+		req.Unit, changed = v.unit, true
+	}
+	if v.priceCents != nil && *v.priceCents != variant.PriceCents {
+		req.PriceCents, changed = v.priceCents, true
+	}
+	if v.stock != nil && *v.stock != variant.Stock {
+		req.Stock, changed = v.stock, true
+	}
+	if v.barcode != nil && (variant.Barcode == nil || *v.barcode != *variant.Barcode) {
+		req.Barcode, changed = v.barcode, true
+	}
+	if v.variantActive != nil && *v.variantActive != variant.IsActive {
+		req.IsActive, changed = v.variantActive, true
+	}
+	if !changed {
+		return nil
+	}
+	return req
+}
+
+func sameStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// update applies the row to an existing variant and its product
+func (im *Importer) update(ctx context.Context, sellerID uuid.UUID, ref skuRef, v rowValues, dryRun bool) (bool, error) {
+	product := ref.product
+	variant, ok := product.Variant(ref.variantID)
+	if !ok {
+		return false, services.ErrVariantNotFound
+	}
+	productReq := v.productChanges(product)
+	variantReq := v.variantChanges(variant)
+	if productReq == nil && variantReq == nil {
+		return false, nil
+	}
+
+	if err := im.updateProduct(ctx, sellerID, product, productReq, dryRun); err != nil {
+		return false, err
+	}
+	if err := im.updateVariant(ctx, sellerID, product, variant.ID, variantReq, dryRun); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// addVariant adds the row's variant to a product that has no variant
+// with its SKU
+func (im *Importer) addVariant(ctx context.Context, sellerID uuid.UUID, cat *catalogue, product *models.Product, v rowValues, dryRun bool) error {
+	if err := im.updateProduct(ctx, sellerID, product, v.productChanges(product), dryRun); err != nil {
+		return err
+	}
+
+	req := v.variantRequest()
+	var variant *models.ProductVariant
+	if dryRun {
+		preview := newPreviewVariant(product.ID, req)
+		if err := services.ValidateVariant(&preview, product.Variants); err != nil {
+			return err
+		}
+		variant = &preview
+	} else {
+		added, err := im.products.AddVariant(ctx, product.ID, sellerID, &req)
+		if err != nil {
+			return err
+		}
+		variant = added
+	}
+	product.Variants = append(product.Variants, *variant)
+	product.SummariseVariants()
+	cat.put(product)
+
+	if v.variantActive != nil && !*v.variantActive {
+		return im.updateVariant(ctx, sellerID, product, variant.ID, &models.UpdateProductVariantRequest{IsActive: v.variantActive}, dryRun)
+	}
+	return nil
+}
+
+// create adds a product with the row's variant
+func (im *Importer) create(ctx context.Context, sellerID uuid.UUID, v rowValues, dryRun bool) (*models.Product, error) {
+	req := &models.CreateProductRequest{
+		Title:    *v.title,
+		Variants: []models.ProductVariantRequest{v.variantRequest()},
+	}
+	if v.description != nil {
+		req.Description = *v.description
+	}
+	if v.category != nil {
+		req.Category = *v.category
+	}
+	if v.currency != nil {
+		req.Currency = *v.currency
+	}
+	if v.images != nil {
+		req.Images = *v.images
+	}
+
+	var product *models.Product
+	var err error
+	if dryRun {
+		product, err = services.NewProduct(sellerID, req)
+		if err == nil {
+			product.ID = uuid.New()
+			for i := range product.Variants {
+				product.Variants[i].ID = uuid.New()
+				product.Variants[i].ProductID = product.ID
+			}
+		}
+	} else {
+		product, err = im.products.CreateProduct(ctx, sellerID, req)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if v.active != nil && !*v.active {
+		if err := im.updateProduct(ctx, sellerID, product, &models.UpdateProductRequest{IsActive: v.active}, dryRun); err != nil {
+			return nil, err
+		}
+	}
+	if v.variantActive != nil && !*v.variantActive {
+		update := &models.UpdateProductVariantRequest{IsActive: v.variantActive}
+		if err := im.updateVariant(ctx, sellerID, product, product.Variants[0].ID, update, dryRun); err != nil {
+			return nil, err
+		}
+	}
+	return product, nil
+}
+
+// updateProduct applies req to product, or in a dry run only validates it
+func (im *Importer) updateProduct(ctx context.Context, sellerID uuid.UUID, product *models.Product, req *models.UpdateProductRequest, dryRun bool) error {
+	if req == nil {
+		return nil
+	}
+
+	updated := *product
+	if dryRun {
+		applyProductChanges(&updated, req)
+		if err := services.ValidateProduct(&updated); err != nil {
+			return err
+		}
+	} else {
+		saved, err := im.products.UpdateProduct(ctx, product.ID, sellerID, req)
+		if err != nil {
+			return err
+		}
+		updated = *saved
+	}
+
+	// Keep the variants the import has already changed in memory
+	updated.Variants = product.Variants
+	*product = updated
+	return nil
+}
+
+// updateVariant applies req to one of product's variants, or in a dry run
+// only validates it
+func (im *Importer) updateVariant(ctx context.Context, sellerID uuid.UUID, product *models.Product, variantID uuid.UUID, req *models.UpdateProductVariantRequest, dryRun bool) error {
+	if req == nil {
+		return nil
+	}
+	current, ok := product.Variant(variantID)
+	if !ok {
+		return services.ErrVariantNotFound
+	}
+
+	var updated models.ProductVariant
+	if dryRun {
+		updated = *current
+		applyVariantChanges(&updated, req)
+		others := make([]models.ProductVariant, 0, len(product.Variants))
+		for _, other := range product.Variants {
+			if other.ID != variantID {
+				others = append(others, other)
+			}
+		}
+		if err := services.ValidateVariant(&updated, others); err != nil {
+			return err
+		}
+	} else {
+		saved, err := im.products.UpdateVariant(ctx, product.ID, variantID, sellerID, req)
+		if err != nil {
+			return err
+		}
+		updated = *saved
+	}
+
+	*current = updated
+	product.SummariseVariants()
+	return nil
+}
+
+func applyProductChanges(p *models.Product, req *models.UpdateProductRequest) {
+	if req.Title != nil {
+		p.Title = strings.TrimSpace(*req.Title)
+	}
+	if req.Description != nil {
+		p.Description = strings.TrimSpace(*req.Description)
+	}
+	if req.Category != nil {
+		p.Category = *req.Category
+	}
+	if req.Currency != nil {
+		p.Currency = strings.ToUpper(*req.Currency)
+	}
+	if req.Images != nil {
+		p.Images = *req.Images
+	}
+	if req.IsActive != nil {
+		p.IsActive = *req.IsActive
+	}
+}
+
+func applyVariantChanges(v *models.ProductVariant, req *models.UpdateProductVariantRequest) {
+	if req.SKU != nil {
+		v.SKU = strings.TrimSpace(*req.SKU)
+	}
+	if req.PackSize != nil {
+		v.PackSize = *req.PackSize
+	}
+	if req.Unit != nil {
+		v.Unit = *req.Unit
+	}
+	if req.PriceCents != nil {
+		v.PriceCents = *req.PriceCents
+	}
+	if req.Stock != nil {
+		v.Stock = *req.Stock
+	}
+	if req.Barcode != nil {
+		v.Barcode = req.Barcode
+	}
+	if req.IsActive != nil {
+		v.IsActive = *req.IsActive
+	}
+}
+
+// newPreviewVariant is the variant AddVariant would create, for dry runs
+func newPreviewVariant(productID uuid.UUID, req models.ProductVariantRequest) models.ProductVariant {
+	return models.ProductVariant{
+		ID:         uuid.New(),
+		ProductID:  productID,
+		SKU:        strings.TrimSpace(req.SKU),
+		PackSize:   req.PackSize,
+		Unit:       req.Unit,
+		PriceCents: req.PriceCents,
+		Stock:      req.Stock,
+		Barcode:    req.Barcode,
+		IsActive:   true,
+	}
+}
+
+// IsInputError reports whether err is a problem with the uploaded file or
+// mapping rather than a server failure
+func IsInputError(err error) bool {
+	return errors.Is(err, ErrEmptyFile) || errors.Is(err, ErrInvalidHeader) ||
+		errors.Is(err, ErrTooManyRows) || errors.Is(err, ErrUnsupportedFormat) ||
+		errors.Is(err, ErrSheetTooLarge)
+}
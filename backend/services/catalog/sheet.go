@@ -0,0 +1,364 @@
+package catalog
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Spreadsheet formats accepted for import and offered for export
+const (
+	FormatCSV  = "csv"
+	FormatXLSX = "xlsx"
+)
+
+// ErrUnsupportedFormat is returned for files that are neither CSV nor XLSX
+var ErrUnsupportedFormat = errors.New("unsupported file format: upload a CSV or XLSX file")
+
+// maxXLSXPart bounds how large one part of an XLSX package may unpack to,
+// so a small upload cannot decompress without limit
+const maxXLSXPart = 100 << 20 // 100 MB
+
+// ErrSheetTooLarge is returned for XLSX files that unpack past maxXLSXPart
+var ErrSheetTooLarge = errors.New("the spreadsheet is too large once unpacked")
+
+// zipMagic starts every XLSX file, which is a zip package
+var zipMagic = []byte("PK\x03\x04")
+
+// DetectFormat tells CSV from XLSX by the file's leading bytes
+func DetectFormat(data []byte) string {
+	if bytes.HasPrefix(data, zipMagic) {
+		return FormatXLSX
+	}
+	return FormatCSV
+}
+
+// ReadSheet reads the rows of a CSV file or of the first worksheet of an
+// XLSX workbook
+func ReadSheet(data []byte) ([][]string, string, error) {
+	format := DetectFormat(data)
+	var rows [][]string
+	var err error
+	if format == FormatXLSX {
+		rows, err = readXLSX(data)
+	} else {
+		rows, err = readCSV(data)
+	}
+	if err != nil {
+		return nil, format, err
+	}
+	return rows, format, nil
+}
+
+func readCSV(data []byte) ([][]string, error) {
+	// Spreadsheet apps often prefix CSV exports with a byte order mark
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	if !isText(data) {
+		return nil, ErrUnsupportedFormat
+	}
+
+	r := csv.NewReader(bytes.NewReader(data))
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+	rows, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV: %w", err)
+	}
+	return rows, nil
+}
+
+// isText rejects binary uploads such as images or legacy .xls files
+func isText(data []byte) bool {
+	sample := data[:min(len(data), 512)]
+	return !bytes.ContainsRune(sample, 0)
+}
+
+// xlsxWorkbook, xlsxRels, xlsxSharedStrings and xlsxWorksheet are the parts
+// of an XLSX package the importer reads
+type xlsxWorkbook struct {
+	Sheets []struct {
+		RID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type xlsxRels struct {
+	Relationships []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+type xlsxText struct {
+	T    string `xml:"t"`
+	Runs []struct {
+		T string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (t xlsxText) String() string {
+	if len(t.Runs) == 0 {
+		return t.T
+	}
+	var b strings.Builder
+	for _, r := range t.Runs {
+		b.WriteString(r.T)
+	}
+	return b.String()
+}
+
+type xlsxSharedStrings struct {
+	Items []xlsxText `xml:"si"`
+}
+
+type xlsxWorksheet struct {
+	Rows []struct {
+		Cells []struct {
+			Ref    string   `xml:"r,attr"`
+			Type   string   `xml:"t,attr"`
+			Value  string   `xml:"v"`
+			Inline xlsxText `xml:"is"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+func readXLSX(data []byte) ([][]string, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, ErrUnsupportedFormat
+	}
+	files := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	sheetPath, err := firstSheetPath(files)
+	if err != nil {
+		return nil, err
+	}
+
+	var shared xlsxSharedStrings
+	if f, ok := files["xl/sharedStrings.xml"]; ok {
+		if err := decodeZipXML(f, &shared); err != nil {
+			return nil, err
+		}
+	}
+
+	f, ok := files[sheetPath]
+	if !ok {
+		return nil, fmt.Errorf("%w: workbook has no worksheet", ErrUnsupportedFormat)
+	}
+	var sheet xlsxWorksheet
+	if err := decodeZipXML(f, &sheet); err != nil {
+		return nil, err
+	}
+
+	rows := make([][]string, 0, len(sheet.Rows))
+	for _, row := range sheet.Rows {
+		var cells []string
+		for i, c := range row.Cells {
+			col := i
+			if c.Ref != "" {
+				col = columnIndex(c.Ref)
+			}
+			var value string
+			switch c.Type {
+			case "s":
+				idx, err := strconv.Atoi(c.Value)
+				if err != nil || idx < 0 || idx >= len(shared.Items) {
+					return nil, fmt.Errorf("failed to read XLSX: bad shared string in cell %s", c.Ref)
+				}
+				value = shared.Items[idx].String()
+			case "inlineStr":
+				value = c.Inline.String()
+			default:
+				value = c.Value
+			}
+			for len(cells) <= col {
+				cells = append(cells, "")
+			}
+			cells[col] = strings.TrimSpace(value)
+		}
+		rows = append(rows, cells)
+	}
+	return rows, nil
+}
+
+// firstSheetPath resolves the first worksheet through the workbook's
+// relationships, falling back to the conventional sheet1.xml
+func firstSheetPath(files map[string]*zip.File) (string, error) {
+	const fallback = "xl/worksheets/sheet1.xml"
+
+	wbFile, ok := files["xl/workbook.xml"]
+	if !ok {
+		return "", ErrUnsupportedFormat
+	}
+	var wb xlsxWorkbook
+	if err := decodeZipXML(wbFile, &wb); err != nil {
+		return "", err
+	}
+	relsFile, ok := files["xl/_rels/workbook.xml.rels"]
+	if len(wb.Sheets) == 0 || !ok {
+		return fallback, nil
+	}
+	var rels xlsxRels
+	if err := decodeZipXML(relsFile, &rels); err != nil {
+		return "", err
+	}
+	for _, rel := range rels.Relationships {
+		if rel.ID != wb.Sheets[0].RID {
+			continue
+		}
+		if strings.HasPrefix(rel.Target, "/") {
+			return strings.TrimPrefix(rel.Target, "/"), nil
+		}
+		return path.Join("xl", rel.Target), nil
+	}
+	return fallback, nil
+}
+
+// decodeZipXML decodes one part of an XLSX package. The declared size is
+// checked up front and the bytes actually inflated are capped too.
+func decodeZipXML(f *zip.File, v interface{}) error {
+	if f.UncompressedSize64 > maxXLSXPart {
+		return ErrSheetTooLarge
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return fmt.Errorf("failed to read XLSX: %w", err)
+	}
+	defer rc.Close()
+
+	lr := &io.LimitedReader{R: rc, N: maxXLSXPart + 1}
+	err = xml.NewDecoder(lr).Decode(v)
+	if lr.N <= 0 {
+		return ErrSheetTooLarge
+	}
+	// archive/zip stops a part that inflates past its declared size
+	if errors.Is(err, zip.ErrFormat) || errors.Is(err, zip.ErrChecksum) {
+		return fmt.Errorf("%w: %s is corrupt", ErrUnsupportedFormat, f.Name)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read XLSX %s: %w", f.Name, err)
+	}
+	return nil
+}
+
+// columnIndex converts a cell reference such as "C7" to its zero-based column
+func columnIndex(ref string) int {
+	col := 0
+	for _, r := range ref {
+		if r < 'A' || r > 'Z' {
+			break
+		}
+		col = col*26 + int(r-'A'+1)
+	}
+	return col - 1
+}
+
+// columnName converts a zero-based column to its letters, e.g. 27 to "AB"
+func columnName(col int) string {
+	name := ""
+	for col++; col > 0; col = (col - 1) / 26 {
+		name = string(rune('A'+(col-1)%26)) + name
+	}
+	return name
+}
+
+// WriteSheet writes rows as CSV or as a single-sheet XLSX workbook
+func WriteSheet(w io.Writer, format string, rows [][]string) error {
+	switch format {
+	case FormatCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.WriteAll(rows); err != nil {
+			return fmt.Errorf("failed to write CSV: %w", err)
+		}
+		return nil
+	case FormatXLSX:
+		return writeXLSX(w, rows)
+	}
+	return ErrUnsupportedFormat
+}
+
+// ContentType is the MIME type of a format
+func ContentType(format string) string {
+	if format == FormatXLSX {
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+// xlsxParts are the fixed parts of a one-sheet workbook
+var xlsxParts = map[string]string{
+	"[Content_Types].xml": `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>
+<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>
+</Types>`,
+	"_rels/.rels": `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>
+</Relationships>`,
+	"xl/workbook.xml": `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets><sheet name="Products" sheetId="1" r:id="rId1"/></sheets>
+</workbook>`,
+	"xl/_rels/workbook.xml.rels": `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>
+</Relationships>`,
+}
+
+// xlsxPartOrder puts the content types first, as some readers expect
+var xlsxPartOrder = []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels"}
+
+// writeXLSX writes every cell as an inline string so values such as SKUs
+// and barcodes keep their leading zeros
+func writeXLSX(w io.Writer, rows [][]string) error {
+	zw := zip.NewWriter(w)
+	for _, name := range xlsxPartOrder {
+		part, err := zw.Create(name)
+		if err != nil {
+			return fmt.Errorf("failed to write XLSX: %w", err)
+		}
+		if _, err := io.WriteString(part, xlsxParts[name]); err != nil {
+			return fmt.Errorf("failed to write XLSX: %w", err)
+		}
+	}
+
+	sheet, err := zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return fmt.Errorf("failed to write XLSX: %w", err)
+	}
+	var b bytes.Buffer
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n")
+	b.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	for i, row := range rows {
+		fmt.Fprintf(&b, `<row r="%d">`, i+1)
+		for j, value := range row {
+			fmt.Fprintf(&b, `<c r="%s%d" t="inlineStr"><is><t xml:space="preserve">`, columnName(j), i+1)
+			if err := xml.EscapeText(&b, []byte(value)); err != nil {
+				return fmt.Errorf("failed to write XLSX: %w", err)
+			}
+			b.WriteString(`</t></is></c>`)
+		}
+		b.WriteString(`</row>`)
+	}
+	b.WriteString(`</sheetData></worksheet>`)
+	if _, err := sheet.Write(b.Bytes()); err != nil {
+		return fmt.Errorf("failed to write XLSX: %w", err)
+	}
+
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("failed to write XLSX: %w", err)
+	}
+	return nil
+}
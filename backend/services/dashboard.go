@@ -140,7 +140,7 @@ func (s *DashboardService) getTraderDashboard(user *models.User, data *Dashboard
 	}
 	err := s.db.QueryRow(`
 		SELECT data FROM marketplace_products 
-		WHERE trader_id = $1 AND status = 'active'
+		WHERE seller_id = $1 AND is_active = true
 	`, user.ID).Scan(&listings)
 	if err != nil && err != sql.ErrNoRows {
 		return nil, err
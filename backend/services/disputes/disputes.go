@@ -3,17 +3,28 @@ package disputes
 import (
 	"database/sql"
 	"fmt"
+	"log"
 	"time"
 
 	"github.com/Andrew-mugwe/agroai/models"
+	"github.com/Andrew-mugwe/agroai/pagination"
 	"github.com/Andrew-mugwe/agroai/services/escrow"
+	"github.com/Andrew-mugwe/agroai/services/notifications"
+	"github.com/Andrew-mugwe/agroai/services/reputation"
 	"github.com/google/uuid"
 )
 
+// Notifier tells sellers about disputes on their orders
+type Notifier interface {
+	SendNotification(req notifications.NotificationRequest) (*notifications.Notification, error)
+}
+
 // DisputeService handles dispute operations
 type DisputeService struct {
-	db        *sql.DB
-	escrowSvc *escrow.EscrowService
+	db         *sql.DB
+	escrowSvc  *escrow.EscrowService
+	reputation reputation.Notifier
+	notifier   Notifier
 }
 
 // NewDisputeService creates a new dispute service
@@ -24,6 +35,16 @@ func NewDisputeService(db *sql.DB, escrowSvc *escrow.EscrowService) *DisputeServ
 	}
 }
 
+// SetReputationNotifier registers the receiver for dispute reputation events
+func (s *DisputeService) SetReputationNotifier(notifier reputation.Notifier) {
+	s.reputation = notifier
+}
+
+// SetNotifier registers where sellers are told about new disputes
+func (s *DisputeService) SetNotifier(notifier Notifier) {
+	s.notifier = notifier
+}
+
 // OpenDispute opens a new dispute
 func (s *DisputeService) OpenDispute(req *models.DisputeRequest) (*models.Dispute, error) {
 	// Validate request
@@ -91,9 +112,43 @@ func (s *DisputeService) OpenDispute(req *models.DisputeRequest) (*models.Disput
 	fmt.Printf("🚨 Dispute opened: %s for order %s (Reason: %s)\n",
 		dispute.ID, req.OrderID, req.Reason)
 
+	s.notifySeller(dispute)
+
 	return dispute, nil
 }
 
+// notifySeller tells the seller a dispute holds their payment; it skips
+// the user's digest
+func (s *DisputeService) notifySeller(dispute *models.Dispute) {
+	if s.notifier == nil {
+		return
+	}
+
+	orderNumber := dispute.OrderID.String()
+	var number sql.NullString
+	if err := s.db.QueryRow(`SELECT order_number FROM orders WHERE id = $1`, dispute.OrderID).Scan(&number); err == nil && number.Valid {
+		orderNumber = number.String
+	}
+
+	_, err := s.notifier.SendNotification(notifications.NotificationRequest{
+		UserID:   dispute.SellerID,
+		Role:     string(models.RoleTrader),
+		Type:     "market",
+		Template: "dispute_opened",
+		Priority: notifications.PriorityHigh,
+		Metadata: map[string]interface{}{
+			"event":        "dispute_opened",
+			"dispute_id":   dispute.ID.String(),
+			"order_id":     dispute.OrderID.String(),
+			"order_number": orderNumber,
+			"reason":       string(dispute.Reason),
+		},
+	})
+	if err != nil {
+		log.Printf("disputes: failed to notify seller %s: %v", dispute.SellerID, err)
+	}
+}
+
 // AddSellerResponse adds a seller's response to a dispute
 func (s *DisputeService) AddSellerResponse(disputeID uuid.UUID, sellerID uuid.UUID, note string, evidence []string) error {
 	// Get dispute
@@ -209,6 +264,11 @@ func (s *DisputeService) ResolveDispute(req *models.DisputeResolutionRequest) er
 		return fmt.Errorf("failed to resolve dispute: %w", err)
 	}
 
+	// Resolved disputes may change the seller's dispute penalty
+	if s.reputation != nil {
+		s.reputation.Enqueue(dispute.SellerID, reputation.EventDisputeResolved)
+	}
+
 	// Trigger escrow action based on resolution
 	if newStatus == models.DisputeStatusResolvedBuyer {
 		// Refund buyer
@@ -313,40 +373,63 @@ func (s *DisputeService) GetDisputeByOrder(orderID uuid.UUID) (*models.Dispute,
 	return &dispute, nil
 }
 
-// GetDisputesByUser retrieves disputes for a specific user
-func (s *DisputeService) GetDisputesByUser(userID uuid.UUID, userType string) ([]*models.Dispute, error) {
-	var query string
+// disputeSort is the only dispute list order; cursors carry it
+const disputeSort = "newest"
+
+// disputeKeyset lists disputes newest first
+var disputeKeyset = pagination.Keyset{Key: "created_at", ID: "id", Dir: pagination.Desc}
+
+// GetDisputesByUser retrieves a page of disputes for a specific user
+func (s *DisputeService) GetDisputesByUser(userID uuid.UUID, userType string, page pagination.Params) (pagination.Page[*models.Dispute], error) {
+	var none pagination.Page[*models.Dispute]
+
+	var where string
 	if userType == "buyer" {
-		query = `
-			SELECT id, escrow_id, order_id, buyer_id, seller_id, status, reason, 
-			       description, evidence, resolution_note, resolution, resolved_by,
-			       created_at, updated_at, resolved_at, escalated_at, metadata
-			FROM disputes 
-			WHERE buyer_id = $1
-			ORDER BY created_at DESC
-		`
+		where = "buyer_id = $1"
 	} else if userType == "seller" {
-		query = `
-			SELECT id, escrow_id, order_id, buyer_id, seller_id, status, reason, 
-			       description, evidence, resolution_note, resolution, resolved_by,
-			       created_at, updated_at, resolved_at, escalated_at, metadata
-			FROM disputes 
-			WHERE seller_id = $1
-			ORDER BY created_at DESC
-		`
+		where = "seller_id = $1"
 	} else {
-		return nil, fmt.Errorf("invalid user type: %s", userType)
+		return none, fmt.Errorf("invalid user type: %s", userType)
 	}
 
-	rows, err := s.db.Query(query, userID)
+	page = page.Normalize()
+	after, err := page.After(disputeSort)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query disputes: %w", err)
+		return none, err
+	}
+
+	args := []interface{}{userID}
+	var total int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM disputes WHERE "+where, args...).Scan(&total); err != nil {
+		return none, fmt.Errorf("failed to count disputes: %w", err)
+	}
+
+	if after != nil {
+		args = append(args, after.Key, after.ID)
+		where += " AND " + disputeKeyset.After("$2", "$3")
+	}
+	args = append(args, page.FetchLimit())
+	query := fmt.Sprintf(`
+			SELECT id, escrow_id, order_id, buyer_id, seller_id, status, reason,
+			       description, evidence, resolution_note, resolution, resolved_by,
+			       created_at, updated_at, resolved_at, escalated_at, metadata, %s
+			FROM disputes
+			WHERE %s
+			ORDER BY %s
+			LIMIT $%d
+		`, disputeKeyset.KeyText(), where, disputeKeyset.OrderBy(), len(args))
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return none, fmt.Errorf("failed to query disputes: %w", err)
 	}
 	defer rows.Close()
 
 	var disputes []*models.Dispute
+	var keys []string
 	for rows.Next() {
 		var dispute models.Dispute
+		var key string
 		err := rows.Scan(
 			&dispute.ID,
 			&dispute.EscrowID,
@@ -365,14 +448,21 @@ func (s *DisputeService) GetDisputesByUser(userID uuid.UUID, userType string) ([
 			&dispute.ResolvedAt,
 			&dispute.EscalatedAt,
 			&dispute.Metadata,
+			&key,
 		)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan dispute: %w", err)
+			return none, fmt.Errorf("failed to scan dispute: %w", err)
 		}
 		disputes = append(disputes, &dispute)
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return none, fmt.Errorf("failed to query disputes: %w", err)
 	}
 
-	return disputes, nil
+	return pagination.NewPage(disputes, page.Limit, func(i int) pagination.Cursor {
+		return pagination.Cursor{Key: keys[i], ID: disputes[i].ID.String(), Sort: disputeSort}
+	}).WithTotal(total), nil
 }
 
 // GetDisputeSummary retrieves dispute statistics
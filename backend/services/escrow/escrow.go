@@ -1,7 +1,9 @@
 package escrow
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"time"
 
@@ -12,11 +14,25 @@ import (
 	"github.com/shopspring/decimal"
 )
 
+// ErrNoPayoutAccount is returned when a seller has no payout account on
+// file to release escrow to
+var ErrNoPayoutAccount = errors.New("seller has no payout account on file")
+
+// ErrPayoutNotAuthorized wraps the payout policy's reason for refusing a
+// payout
+var ErrPayoutNotAuthorized = errors.New("payout not authorized")
+
+// PayoutPolicy decides whether a seller may receive a payout
+type PayoutPolicy interface {
+	AuthorizePayout(ctx context.Context, sellerID uuid.UUID, amount decimal.Decimal, currency, provider, accountID string) error
+}
+
 // EscrowService handles escrow operations
 type EscrowService struct {
-	db         *sql.DB
-	paymentSvc *payments.PaymentService
-	payoutSvc  *payouts.PayoutService
+	db           *sql.DB
+	paymentSvc   *payments.PaymentService
+	payoutSvc    *payouts.PayoutService
+	payoutPolicy PayoutPolicy
 }
 
 // NewEscrowService creates a new escrow service
@@ -28,6 +44,11 @@ func NewEscrowService(db *sql.DB, paymentSvc *payments.PaymentService, payoutSvc
 	}
 }
 
+// SetPayoutPolicy registers the check run before escrow funds are paid out
+func (s *EscrowService) SetPayoutPolicy(policy PayoutPolicy) {
+	s.payoutPolicy = policy
+}
+
 // CreateEscrow creates a new escrow transaction
 func (s *EscrowService) CreateEscrow(req *models.EscrowRequest) (*models.EscrowResponse, error) {
 	// Validate request
@@ -102,6 +123,11 @@ func (s *EscrowService) ReleaseEscrow(escrowID uuid.UUID, sellerAccountID string
 		return fmt.Errorf("escrow %s cannot be released (status: %s)", escrowID, escrow.Status)
 	}
 
+	// Check the seller's payout limits and verified account
+	if err := s.authorizePayout(context.Background(), escrow.SellerID, escrow.Amount, escrow.Currency, provider, sellerAccountID); err != nil {
+		return err
+	}
+
 	// Create payout request
 	payoutReq := &models.PayoutRequest{
 		SellerID:    escrow.SellerID,
@@ -141,6 +167,26 @@ func (s *EscrowService) ReleaseEscrow(escrowID uuid.UUID, sellerAccountID string
 	return nil
 }
 
+// authorizePayout runs the payout policy, if one is set
+func (s *EscrowService) authorizePayout(ctx context.Context, sellerID uuid.UUID, amount decimal.Decimal, currency, provider, accountID string) error {
+	if s.payoutPolicy == nil {
+		return nil
+	}
+	if err := s.payoutPolicy.AuthorizePayout(ctx, sellerID, amount, currency, provider, accountID); err != nil {
+		return fmt.Errorf("%w: %w", ErrPayoutNotAuthorized, err)
+	}
+	return nil
+}
+
+// ProcessPayout pays a seller directly, outside an escrow, subject to the
+// same payout policy as escrow releases
+func (s *EscrowService) ProcessPayout(ctx context.Context, req *models.PayoutRequest) (*models.PayoutResponse, error) {
+	if err := s.authorizePayout(ctx, req.SellerID, req.Amount, req.Currency, req.Provider, req.AccountID); err != nil {
+		return nil, err
+	}
+	return s.payoutSvc.ProcessPayout(req)
+}
+
 // RefundEscrow refunds the buyer
 func (s *EscrowService) RefundEscrow(escrowID uuid.UUID, reason string) error {
 	// Get escrow details
@@ -291,6 +337,85 @@ func (s *EscrowService) GetEscrowSummary(currency string) (*models.EscrowSummary
 	return &summary, nil
 }
 
+// ConfirmDelivery releases the held escrows of an order its buyer has
+// received, paying each seller to the payout account on file. It returns
+// the amount released; escrows of sellers without a payout account stay
+// held and are reported with ErrNoPayoutAccount.
+func (s *EscrowService) ConfirmDelivery(orderID, buyerID uuid.UUID) (decimal.Decimal, error) {
+	rows, err := s.db.Query(`
+		SELECT e.id, e.amount, a.provider, a.account_id
+		FROM escrows e
+		LEFT JOIN seller_payout_accounts a ON a.seller_id = e.seller_id
+		WHERE e.order_id = $1 AND e.buyer_id = $2 AND e.status = $3
+	`, orderID, buyerID, models.EscrowStatusHeld)
+	if err != nil {
+		return decimal.Zero, fmt.Errorf("failed to query escrows: %w", err)
+	}
+
+	type held struct {
+		id                uuid.UUID
+		amount            decimal.Decimal
+		provider, account sql.NullString
+	}
+	var escrows []held
+	for rows.Next() {
+		var e held
+		if err := rows.Scan(&e.id, &e.amount, &e.provider, &e.account); err != nil {
+			rows.Close()
+			return decimal.Zero, fmt.Errorf("failed to scan escrow: %w", err)
+		}
+		escrows = append(escrows, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return decimal.Zero, fmt.Errorf("failed to read escrows: %w", err)
+	}
+
+	released := decimal.Zero
+	var failed error
+	for _, e := range escrows {
+		if !e.provider.Valid {
+			failed = ErrNoPayoutAccount
+			continue
+		}
+		if err := s.ReleaseEscrow(e.id, e.account.String, e.provider.String); err != nil {
+			failed = err
+			continue
+		}
+		released = released.Add(e.amount)
+	}
+	return released, failed
+}
+
+// GetUserBalances returns a user's escrow balances per currency, as a
+// seller and as a buyer
+func (s *EscrowService) GetUserBalances(userID uuid.UUID) ([]models.EscrowBalance, error) {
+	rows, err := s.db.Query(`
+		SELECT currency,
+			COALESCE(SUM(CASE WHEN seller_id = $1 AND status = 'HELD' THEN amount END), 0),
+			COALESCE(SUM(CASE WHEN seller_id = $1 AND status = 'RELEASED' AND released_at >= $2 THEN amount END), 0),
+			COALESCE(SUM(CASE WHEN buyer_id = $1 AND status = 'HELD' THEN amount END), 0)
+		FROM escrows
+		WHERE seller_id = $1 OR buyer_id = $1
+		GROUP BY currency
+		ORDER BY currency
+	`, userID, time.Now().AddDate(0, 0, -30))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get balances: %w", err)
+	}
+	defer rows.Close()
+
+	var balances []models.EscrowBalance
+	for rows.Next() {
+		var b models.EscrowBalance
+		if err := rows.Scan(&b.Currency, &b.PendingPayout, &b.PaidOut30Days, &b.HeldForPurchases); err != nil {
+			return nil, fmt.Errorf("failed to scan balance: %w", err)
+		}
+		balances = append(balances, b)
+	}
+	return balances, rows.Err()
+}
+
 // validateEscrowRequest validates the escrow request
 func (s *EscrowService) validateEscrowRequest(req *models.EscrowRequest) error {
 	if req.OrderID == uuid.Nil {
@@ -0,0 +1,44 @@
+package escrow
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Andrew-mugwe/agroai/models"
+	"github.com/Andrew-mugwe/agroai/services/payouts"
+)
+
+var errOverLimit = errors.New("over limit")
+
+type refusingPolicy struct {
+	sellerID uuid.UUID
+}
+
+func (p *refusingPolicy) AuthorizePayout(ctx context.Context, sellerID uuid.UUID, amount decimal.Decimal, currency, provider, accountID string) error {
+	p.sellerID = sellerID
+	return errOverLimit
+}
+
+func TestProcessPayoutRunsPolicy(t *testing.T) {
+	s := NewEscrowService(nil, nil, payouts.NewPayoutService())
+	policy := &refusingPolicy{}
+	s.SetPayoutPolicy(policy)
+
+	req := &models.PayoutRequest{
+		SellerID:  uuid.New(),
+		Amount:    decimal.NewFromInt(50000),
+		Currency:  "KES",
+		Provider:  "mpesa",
+		AccountID: "254700000000",
+	}
+	resp, err := s.ProcessPayout(context.Background(), req)
+	assert.Nil(t, resp)
+	assert.ErrorIs(t, err, ErrPayoutNotAuthorized)
+	assert.ErrorIs(t, err, errOverLimit)
+	assert.Equal(t, req.SellerID, policy.sellerID)
+}
@@ -0,0 +1,300 @@
+package inventory
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Andrew-mugwe/agroai/models"
+	"github.com/Andrew-mugwe/agroai/pagination"
+	"github.com/Andrew-mugwe/agroai/repository"
+	"github.com/Andrew-mugwe/agroai/services"
+	"github.com/Andrew-mugwe/agroai/services/notifications"
+	"github.com/google/uuid"
+)
+
+// ErrInvalidMovement is returned for manual movements traders may not record
+var ErrInvalidMovement = errors.New("stock movements must be adjustments or returns")
+
+// Notifier delivers low-stock alerts to traders
+type Notifier interface {
+	SendNotification(req notifications.NotificationRequest) (*notifications.Notification, error)
+}
+
+// Service keeps the inventory ledger, settles order reservations and
+// alerts traders when a product falls to its reorder threshold
+type Service struct {
+	repo     *repository.InventoryRepository
+	products repository.ProductRepository
+	notifier Notifier
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	once   sync.Once
+}
+
+// NewService creates a new inventory service
+func NewService(repo *repository.InventoryRepository, products repository.ProductRepository) *Service {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Service{
+		repo:     repo,
+		products: products,
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+}
+
+// SetNotifier registers where low-stock alerts are sent
+func (s *Service) SetNotifier(notifier Notifier) {
+	s.notifier = notifier
+}
+
+// Adjust records a trader's manual stock movement on their variant
+func (s *Service) Adjust(ctx context.Context, sellerID, productID, variantID uuid.UUID, req *models.StockAdjustmentRequest) (*models.StockMovement, error) {
+	if req.Reason == "" {
+		req.Reason = models.StockAdjustment
+	}
+	if !req.Reason.IsManual() {
+		return nil, ErrInvalidMovement
+	}
+	if req.Quantity == 0 {
+		return nil, fmt.Errorf("%w: quantity cannot be zero", services.ErrInvalidProduct)
+	}
+
+	product, err := s.ownedProduct(ctx, productID, sellerID)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := product.Variant(variantID); !ok {
+		return nil, services.ErrVariantNotFound
+	}
+
+	change := models.StockChange{Reason: req.Reason, ActorID: &sellerID, Note: req.Note}
+	movement, err := s.repo.Adjust(ctx, productID, variantID, req.Quantity, change, req.OrderID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.StockChanged(ctx, productID)
+	return movement, nil
+}
+
+// SetReorderThreshold sets or, with nil, clears a product's reorder
+// threshold. A product already at or below a new threshold is alerted.
+func (s *Service) SetReorderThreshold(ctx context.Context, sellerID, productID uuid.UUID, threshold *int) (*models.Product, error) {
+	if threshold != nil && *threshold < 0 {
+		return nil, fmt.Errorf("%w: reorder threshold cannot be negative", services.ErrInvalidProduct)
+	}
+	product, err := s.ownedProduct(ctx, productID, sellerID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.SetReorderThreshold(ctx, productID, sellerID, threshold); err != nil {
+		return nil, err
+	}
+	product.ReorderThreshold = threshold
+
+	s.StockChanged(ctx, productID)
+	return product, nil
+}
+
+// ReserveOrder holds stock for a new order's items
+func (s *Service) ReserveOrder(ctx context.Context, order *models.Order) error {
+	movements, err := s.repo.Reserve(ctx, order.ID, &order.UserID, order.Items)
+	if err != nil {
+		return err
+	}
+	s.StockChanged(ctx, movedProducts(movements)...)
+	return nil
+}
+
+// SettleOrder turns an order's reservation into a sale when it is
+// delivered, or returns it to sale when the order is cancelled
+func (s *Service) SettleOrder(ctx context.Context, orderID uuid.UUID, reason models.StockReason, actorID *uuid.UUID) error {
+	movements, err := s.repo.Settle(ctx, orderID, reason, actorID)
+	if err != nil {
+		return err
+	}
+	s.StockChanged(ctx, movedProducts(movements)...)
+	return nil
+}
+
+// Movements pages through a seller's inventory ledger
+func (s *Service) Movements(ctx context.Context, filter repository.MovementFilter, page pagination.Params) (pagination.Page[models.StockMovement], error) {
+	return s.repo.Movements(ctx, filter, page.Normalize())
+}
+
+// Report values a seller's stock and measures its turnover between from and to
+func (s *Service) Report(ctx context.Context, sellerID uuid.UUID, from, to time.Time) (*models.InventoryReport, error) {
+	items, err := s.repo.ReportItems(ctx, sellerID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return buildReport(items, from, to), nil
+}
+
+// buildReport works out values, turnover and days of cover, and totals
+// the items per currency
+func buildReport(items []models.InventoryReportItem, from, to time.Time) *models.InventoryReport {
+	days := to.Sub(from).Hours() / 24
+
+	totals := map[string]*models.InventoryTotal{}
+	averages := map[string]float64{}
+	for i := range items {
+		it := &items[i]
+		it.ValueCents = int64(it.OnHand) * it.PriceCents
+
+		average := float64(it.OpeningOnHand+it.ClosingOnHand) / 2
+		it.Turnover = turnover(it.SoldUnits, average)
+		if it.SoldUnits > 0 && days > 0 {
+			cover := float64(it.OnHand) / (float64(it.SoldUnits) / days)
+			cover = math.Round(cover*10) / 10
+			it.DaysOfCover = &cover
+		}
+
+		t, ok := totals[it.Currency]
+		if !ok {
+			t = &models.InventoryTotal{Currency: it.Currency}
+			totals[it.Currency] = t
+		}
+		t.OnHand += it.OnHand
+		t.ValueCents += it.ValueCents
+		t.SoldUnits += it.SoldUnits
+		t.SoldValueCents += it.SoldValueCents
+		averages[it.Currency] += average
+	}
+
+	report := &models.InventoryReport{From: from, To: to, Items: items, Totals: []models.InventoryTotal{}}
+	for currency, t := range totals {
+		t.Turnover = turnover(t.SoldUnits, averages[currency])
+		report.Totals = append(report.Totals, *t)
+	}
+	sort.Slice(report.Totals, func(i, j int) bool {
+		return report.Totals[i].Currency < report.Totals[j].Currency
+	})
+	return report
+}
+
+// turnover is sold over the average stock on hand, nil without stock
+func turnover(sold int, average float64) *float64 {
+	if average <= 0 {
+		return nil
+	}
+	t := math.Round(float64(sold)/average*100) / 100
+	return &t
+}
+
+// StockChanged checks the reorder thresholds of products whose stock may
+// have moved. Alerts are best effort, so failures are only logged.
+func (s *Service) StockChanged(ctx context.Context, productIDs ...uuid.UUID) {
+	if len(productIDs) == 0 {
+		return
+	}
+	if err := s.CheckThresholds(ctx, productIDs...); err != nil {
+		log.Printf("inventory: failed to check reorder thresholds: %v", err)
+	}
+}
+
+// CheckThresholds alerts the traders of products, or of every product
+// when none are given, that have fallen to their reorder threshold since
+// their last alert
+func (s *Service) CheckThresholds(ctx context.Context, productIDs ...uuid.UUID) error {
+	alerts, err := s.repo.ClaimLowStockAlerts(ctx, productIDs)
+	if err != nil {
+		return err
+	}
+	for _, alert := range alerts {
+		s.notify(alert)
+	}
+	return nil
+}
+
+func (s *Service) notify(alert models.LowStockAlert) {
+	log.Printf("inventory: %s (%s) is at %d, reorder threshold %d", alert.Title, alert.ProductID, alert.Stock, alert.ReorderThreshold)
+	if s.notifier == nil {
+		return
+	}
+
+	message := fmt.Sprintf("%s is running low: %d left in stock (reorder at %d)", alert.Title, alert.Stock, alert.ReorderThreshold)
+	if alert.Stock == 0 {
+		message = fmt.Sprintf("%s is out of stock (reorder at %d)", alert.Title, alert.ReorderThreshold)
+	}
+	_, err := s.notifier.SendNotification(notifications.NotificationRequest{
+		UserID:  alert.SellerID,
+		Role:    string(models.RoleTrader),
+		Type:    "stock",
+		Message: message,
+		Metadata: map[string]interface{}{
+			"product_id":        alert.ProductID.String(),
+			"stock":             alert.Stock,
+			"reorder_threshold": alert.ReorderThreshold,
+		},
+	})
+	if err != nil {
+		log.Printf("inventory: failed to send low-stock alert for %s: %v", alert.ProductID, err)
+	}
+}
+
+// StartThresholdChecks sweeps every product's reorder threshold on an
+// interval, catching stock changes made outside the service
+func (s *Service) StartThresholdChecks(interval time.Duration) {
+	s.once.Do(func() {
+		log.Printf("Starting low-stock checks (interval: %v)", interval)
+
+		go func() {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-s.ctx.Done():
+					return
+				case <-ticker.C:
+					if err := s.CheckThresholds(s.ctx); err != nil {
+						log.Printf("Low-stock check failed: %v", err)
+					}
+				}
+			}
+		}()
+	})
+}
+
+// Stop stops the background threshold checks
+func (s *Service) Stop() {
+	s.cancel()
+}
+
+// ownedProduct loads a product and checks it belongs to sellerID
+func (s *Service) ownedProduct(ctx context.Context, productID, sellerID uuid.UUID) (*models.Product, error) {
+	product, err := s.products.GetByID(ctx, productID)
+	if err == sql.ErrNoRows {
+		return nil, services.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if product.SellerID != sellerID {
+		return nil, services.ErrProductUnauthorized
+	}
+	return product, nil
+}
+
+// movedProducts lists the products movements touched, once each
+func movedProducts(movements []models.StockMovement) []uuid.UUID {
+	seen := map[uuid.UUID]bool{}
+	var ids []uuid.UUID
+	for _, m := range movements {
+		if !seen[m.ProductID] {
+			seen[m.ProductID] = true
+			ids = append(ids, m.ProductID)
+		}
+	}
+	return ids
+}
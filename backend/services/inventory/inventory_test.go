@@ -0,0 +1,80 @@
+package inventory
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Andrew-mugwe/agroai/models"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildReport(t *testing.T) {
+	to := time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)
+	from := to.AddDate(0, 0, -30)
+
+	report := buildReport([]models.InventoryReportItem{
+		{
+			Currency: "KES", Stock: 40, Reserved: 10, OnHand: 50, PriceCents: 350000,
+			OpeningOnHand: 110, ClosingOnHand: 50, SoldUnits: 60, SoldValueCents: 21000000,
+		},
+		{
+			Currency: "KES", Stock: 5, OnHand: 5, PriceCents: 80000,
+			OpeningOnHand: 5, ClosingOnHand: 5,
+		},
+		{
+			Currency: "USD", OnHand: 0, PriceCents: 1200,
+			OpeningOnHand: 0, ClosingOnHand: 0,
+		},
+	}, from, to)
+
+	require.Len(t, report.Items, 3)
+	dap := report.Items[0]
+	assert.Equal(t, int64(17500000), dap.ValueCents)
+	require.NotNil(t, dap.Turnover)
+	assert.Equal(t, 0.75, *dap.Turnover)
+	require.NotNil(t, dap.DaysOfCover)
+	assert.Equal(t, 25.0, *dap.DaysOfCover)
+
+	// Unsold stock turns over zero times and never runs out
+	slow := report.Items[1]
+	require.NotNil(t, slow.Turnover)
+	assert.Equal(t, 0.0, *slow.Turnover)
+	assert.Nil(t, slow.DaysOfCover)
+
+	// Without stock there is no turnover to measure
+	assert.Nil(t, report.Items[2].Turnover)
+
+	require.Len(t, report.Totals, 2)
+	kes := report.Totals[0]
+	assert.Equal(t, "KES", kes.Currency)
+	assert.Equal(t, 55, kes.OnHand)
+	assert.Equal(t, int64(17900000), kes.ValueCents)
+	assert.Equal(t, 60, kes.SoldUnits)
+	require.NotNil(t, kes.Turnover)
+	assert.Equal(t, 0.71, *kes.Turnover)
+	assert.Equal(t, "USD", report.Totals[1].Currency)
+}
+
+func TestBuildReportEmpty(t *testing.T) {
+	now := time.Now()
+	report := buildReport(nil, now.AddDate(0, 0, -7), now)
+	assert.Empty(t, report.Items)
+	assert.NotNil(t, report.Totals)
+}
+
+func TestMovedProducts(t *testing.T) {
+	a, b := uuid.New(), uuid.New()
+	ids := movedProducts([]models.StockMovement{{ProductID: a}, {ProductID: b}, {ProductID: a}})
+	assert.Equal(t, []uuid.UUID{a, b}, ids)
+	assert.Empty(t, movedProducts(nil))
+}
+
+func TestStockReasons(t *testing.T) {
+	assert.True(t, models.StockReturn.IsManual())
+	assert.True(t, models.StockAdjustment.IsManual())
+	assert.False(t, models.StockSale.IsManual())
+	assert.True(t, models.StockReservation.IsValid())
+	assert.False(t, models.StockReason("theft").IsValid())
+}
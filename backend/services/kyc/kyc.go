@@ -0,0 +1,802 @@
+package kyc
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Andrew-mugwe/agroai/models"
+	"github.com/Andrew-mugwe/agroai/pagination"
+	"github.com/Andrew-mugwe/agroai/services/reputation"
+	"github.com/google/uuid"
+)
+
+// Submission statuses
+const (
+	StatusPending  = "pending"
+	StatusApproved = "approved"
+	StatusRejected = "rejected"
+	StatusExpired  = "expired"
+	StatusRevoked  = "revoked"
+)
+
+// Document types a seller can submit
+const (
+	DocNationalID           = "national_id"
+	DocPassport             = "passport"
+	DocBusinessRegistration = "business_registration"
+	DocCoopMembership       = "coop_membership"
+)
+
+// Checklist items an admin confirms before approving
+const (
+	CheckIDLegible          = "id_document_legible"
+	CheckIDMatchesProfile   = "id_matches_profile_name"
+	CheckPayoutAccountOwner = "payout_account_name_matches"
+	CheckBusinessDocValid   = "business_document_valid"
+	CheckBusinessNameMatch  = "business_name_matches"
+)
+
+// DefaultValidity is how long an approved verification lasts before it must be renewed
+const DefaultValidity = 365 * 24 * time.Hour
+
+// KYC errors
+var (
+	ErrSubmissionNotFound   = errors.New("verification submission not found")
+	ErrSubmissionPending    = errors.New("a verification submission is already pending review")
+	ErrNotPending           = errors.New("submission has already been reviewed")
+	ErrInvalidLevel         = errors.New("invalid verification level")
+	ErrMissingIDDocument    = errors.New("a national ID or passport is required")
+	ErrMissingBusinessDoc   = errors.New("a business registration or co-op membership document is required")
+	ErrInvalidDocument      = errors.New("invalid document")
+	ErrMissingPayoutAccount = errors.New("a payout account is required")
+	ErrChecklistIncomplete  = errors.New("all checklist items must be confirmed before approval")
+	ErrLevelAboveRequested  = errors.New("cannot approve above the requested level")
+	ErrInvalidRejection     = errors.New("at least one valid rejection reason is required")
+	ErrNoteRequired         = errors.New("a note is required")
+	ErrNotVerified          = errors.New("seller is not verified")
+	ErrNoSellerProfile      = errors.New("a seller profile is required")
+)
+
+// RejectionReasons are the accepted reasons for rejecting a submission
+var RejectionReasons = []string{
+	"document_unreadable", "document_expired", "name_mismatch", "invalid_business_document",
+	"payout_account_mismatch", "suspected_fraud", "other",
+}
+
+// PayoutProviders are the providers a payout account can be registered with
+var PayoutProviders = []string{"mpesa", "stripe", "paypal"}
+
+// Document is an identity or business document attached to a submission
+type Document struct {
+	Type    string `json:"type"`
+	FileURL string `json:"file_url"`
+	// Number is only accepted on submission; just the last four characters are stored
+	Number      string `json:"number,omitempty"`
+	NumberLast4 string `json:"number_last4,omitempty"`
+}
+
+// PayoutAccount is the account a seller will be paid out to
+type PayoutAccount struct {
+	Provider    string `json:"provider"`
+	AccountID   string `json:"account_id"`
+	AccountName string `json:"account_name"`
+}
+
+// Submission is a seller's request to be verified at a level
+type Submission struct {
+	ID               uuid.UUID                `json:"id"`
+	SellerID         uuid.UUID                `json:"seller_id"`
+	RequestedLevel   models.VerificationLevel `json:"requested_level"`
+	ApprovedLevel    models.VerificationLevel `json:"approved_level,omitempty"`
+	Status           string                   `json:"status"`
+	Documents        []Document               `json:"documents"`
+	PayoutAccount    PayoutAccount            `json:"payout_account"`
+	Checklist        map[string]bool          `json:"checklist,omitempty"`
+	RejectionReasons []string                 `json:"rejection_reasons,omitempty"`
+	ReviewNote       string                   `json:"review_note,omitempty"`
+	ReviewedBy       *uuid.UUID               `json:"reviewed_by,omitempty"`
+	ReviewedAt       *time.Time               `json:"reviewed_at,omitempty"`
+	ExpiresAt        *time.Time               `json:"expires_at,omitempty"`
+	CreatedAt        time.Time                `json:"created_at"`
+}
+
+// Status is a seller's current verification state
+type Status struct {
+	SellerID     uuid.UUID                `json:"seller_id"`
+	Level        models.VerificationLevel `json:"level"`
+	ExpiresAt    *time.Time               `json:"expires_at,omitempty"`
+	LatestSubmit *Submission              `json:"latest_submission,omitempty"`
+}
+
+// SubmitRequest represents a seller's verification submission
+type SubmitRequest struct {
+	Level         models.VerificationLevel `json:"level"`
+	Documents     []Document               `json:"documents"`
+	PayoutAccount PayoutAccount            `json:"payout_account"`
+}
+
+// ApproveRequest represents an admin approval; Level defaults to the requested level
+type ApproveRequest struct {
+	Level     models.VerificationLevel `json:"level,omitempty"`
+	Checklist map[string]bool          `json:"checklist"`
+	Note      string                   `json:"note,omitempty"`
+}
+
+// RejectRequest represents an admin rejection
+type RejectRequest struct {
+	Reasons []string `json:"reasons"`
+	Note    string   `json:"note,omitempty"`
+}
+
+// Service runs the seller KYC workflow
+type Service struct {
+	db       *sql.DB
+	notifier reputation.Notifier
+	validity time.Duration
+	now      func() time.Time
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	once   sync.Once
+}
+
+// NewService creates a new KYC service
+func NewService(db *sql.DB) *Service {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Service{
+		db:       db,
+		validity: DefaultValidity,
+		now:      time.Now,
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+}
+
+// SetReputationNotifier registers the receiver for verification change events
+func (s *Service) SetReputationNotifier(notifier reputation.Notifier) {
+	s.notifier = notifier
+}
+
+// Checklist returns the items an admin must confirm to approve a level
+func Checklist(level models.VerificationLevel) []string {
+	items := []string{CheckIDLegible, CheckIDMatchesProfile, CheckPayoutAccountOwner}
+	if level == models.VerificationLevelBusiness {
+		items = append(items, CheckBusinessDocValid, CheckBusinessNameMatch)
+	}
+	return items
+}
+
+// ValidateSubmission checks that a submission carries the documents its level requires
+func ValidateSubmission(req *SubmitRequest) error {
+	if req.Level != models.VerificationLevelIdentity && req.Level != models.VerificationLevelBusiness {
+		return ErrInvalidLevel
+	}
+
+	var hasID, hasBusiness bool
+	for _, doc := range req.Documents {
+		if strings.TrimSpace(doc.FileURL) == "" {
+			return fmt.Errorf("%w: file_url is required for %s", ErrInvalidDocument, doc.Type)
+		}
+		switch doc.Type {
+		case DocNationalID, DocPassport:
+			hasID = true
+		case DocBusinessRegistration, DocCoopMembership:
+			hasBusiness = true
+		default:
+			return fmt.Errorf("%w: unknown type %q", ErrInvalidDocument, doc.Type)
+		}
+	}
+	if !hasID {
+		return ErrMissingIDDocument
+	}
+	if req.Level == models.VerificationLevelBusiness && !hasBusiness {
+		return ErrMissingBusinessDoc
+	}
+
+	account := req.PayoutAccount
+	if !contains(PayoutProviders, account.Provider) ||
+		strings.TrimSpace(account.AccountID) == "" || strings.TrimSpace(account.AccountName) == "" {
+		return ErrMissingPayoutAccount
+	}
+
+	return nil
+}
+
+// missingChecklistItems returns the required items the admin has not confirmed
+func missingChecklistItems(level models.VerificationLevel, checklist map[string]bool) []string {
+	var missing []string
+	for _, item := range Checklist(level) {
+		if !checklist[item] {
+			missing = append(missing, item)
+		}
+	}
+	return missing
+}
+
+// Submit records a seller's documents and payout account for admin review
+func (s *Service) Submit(ctx context.Context, sellerID uuid.UUID, req *SubmitRequest) (*Submission, error) {
+	if err := ValidateSubmission(req); err != nil {
+		return nil, err
+	}
+
+	// Approval sets the level on the seller profile
+	var hasProfile bool
+	err := s.db.QueryRowContext(ctx, `
+		SELECT EXISTS (SELECT 1 FROM sellers WHERE user_id = $1)`, sellerID).Scan(&hasProfile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check seller profile: %w", err)
+	}
+	if !hasProfile {
+		return nil, ErrNoSellerProfile
+	}
+
+	var pending bool
+	err = s.db.QueryRowContext(ctx, `
+		SELECT EXISTS (SELECT 1 FROM kyc_submissions WHERE seller_id = $1 AND status = $2)`,
+		sellerID, StatusPending).Scan(&pending)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check pending submissions: %w", err)
+	}
+	if pending {
+		return nil, ErrSubmissionPending
+	}
+
+	sub := &Submission{
+		SellerID:       sellerID,
+		RequestedLevel: req.Level,
+		Status:         StatusPending,
+		PayoutAccount:  req.PayoutAccount,
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO kyc_submissions (seller_id, requested_level, status, payout_provider, payout_account_id, payout_account_name)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at`,
+		sellerID, req.Level, StatusPending, req.PayoutAccount.Provider,
+		strings.TrimSpace(req.PayoutAccount.AccountID), strings.TrimSpace(req.PayoutAccount.AccountName),
+	).Scan(&sub.ID, &sub.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create submission: %w", err)
+	}
+
+	for _, doc := range req.Documents {
+		stored := Document{Type: doc.Type, FileURL: doc.FileURL, NumberLast4: last4(doc.Number)}
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO kyc_documents (submission_id, doc_type, file_url, number_last4)
+			VALUES ($1, $2, $3, $4)`, sub.ID, stored.Type, stored.FileURL, stored.NumberLast4)
+		if err != nil {
+			return nil, fmt.Errorf("failed to store document: %w", err)
+		}
+		sub.Documents = append(sub.Documents, stored)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit submission: %w", err)
+	}
+
+	return sub, nil
+}
+
+// Get returns a submission with its documents
+func (s *Service) Get(ctx context.Context, submissionID uuid.UUID) (*Submission, error) {
+	sub, err := scanSubmission(s.db.QueryRowContext(ctx, selectSubmissions+` WHERE id = $1`, submissionID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrSubmissionNotFound
+		}
+		return nil, fmt.Errorf("failed to get submission: %w", err)
+	}
+
+	if err := s.loadDocuments(ctx, sub); err != nil {
+		return nil, err
+	}
+
+	return sub, nil
+}
+
+// submissionSort is the only submission list order; cursors carry it
+const submissionSort = "oldest"
+
+// submissionKeyset lists submissions oldest first
+var submissionKeyset = pagination.Keyset{Key: "created_at", ID: "id", Dir: pagination.Asc}
+
+// List returns a page of submissions with the given status, oldest first
+func (s *Service) List(ctx context.Context, status string, page pagination.Params) (pagination.Page[Submission], error) {
+	var none pagination.Page[Submission]
+	page = page.Normalize()
+	after, err := page.After(submissionSort)
+	if err != nil {
+		return none, err
+	}
+
+	where := "status = $1"
+	args := []interface{}{status}
+
+	var total int
+	if err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM kyc_submissions WHERE "+where, args...).Scan(&total); err != nil {
+		return none, fmt.Errorf("failed to count submissions: %w", err)
+	}
+
+	if after != nil {
+		args = append(args, after.Key, after.ID)
+		where += " AND " + submissionKeyset.After("$2", "$3")
+	}
+	args = append(args, page.FetchLimit())
+	rows, err := s.db.QueryContext(ctx, selectSubmissionsWith(submissionKeyset.KeyText())+fmt.Sprintf(`
+		WHERE %s
+		ORDER BY %s
+		LIMIT $%d`, where, submissionKeyset.OrderBy(), len(args)), args...)
+	if err != nil {
+		return none, fmt.Errorf("failed to query submissions: %w", err)
+	}
+	defer rows.Close()
+
+	var subs []Submission
+	var keys []string
+	for rows.Next() {
+		var key string
+		sub, err := scanSubmission(rows, &key)
+		if err != nil {
+			return none, fmt.Errorf("failed to scan submission: %w", err)
+		}
+		subs = append(subs, *sub)
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return none, fmt.Errorf("failed to read submissions: %w", err)
+	}
+
+	result := pagination.NewPage(subs, page.Limit, func(i int) pagination.Cursor {
+		return pagination.Cursor{Key: keys[i], ID: subs[i].ID.String(), Sort: submissionSort}
+	}).WithTotal(total)
+	for i := range result.Items {
+		if err := s.loadDocuments(ctx, &result.Items[i]); err != nil {
+			return none, err
+		}
+	}
+
+	return result, nil
+}
+
+// GetStatus returns a seller's current level and latest submission
+func (s *Service) GetStatus(ctx context.Context, sellerID uuid.UUID) (*Status, error) {
+	status := &Status{SellerID: sellerID, Level: models.VerificationLevelNone}
+
+	var expiresAt sql.NullTime
+	err := s.db.QueryRowContext(ctx, `
+		SELECT verification_level, verification_expires_at FROM sellers WHERE user_id = $1`,
+		sellerID).Scan(&status.Level, &expiresAt)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to load verification status: %w", err)
+	}
+	if expiresAt.Valid {
+		status.ExpiresAt = &expiresAt.Time
+	}
+
+	sub, err := scanSubmission(s.db.QueryRowContext(ctx, selectSubmissions+`
+		WHERE seller_id = $1 ORDER BY created_at DESC LIMIT 1`, sellerID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return status, nil
+		}
+		return nil, fmt.Errorf("failed to load latest submission: %w", err)
+	}
+	if err := s.loadDocuments(ctx, sub); err != nil {
+		return nil, err
+	}
+	status.LatestSubmit = sub
+
+	return status, nil
+}
+
+// Approve verifies a seller once every checklist item for the level is confirmed.
+// The payout account on the submission becomes the seller's verified account.
+func (s *Service) Approve(ctx context.Context, submissionID, adminID uuid.UUID, req *ApproveRequest) (*Submission, error) {
+	sub, err := s.Get(ctx, submissionID)
+	if err != nil {
+		return nil, err
+	}
+	if sub.Status != StatusPending {
+		return nil, ErrNotPending
+	}
+
+	level := req.Level
+	if level == "" {
+		level = sub.RequestedLevel
+	}
+	if level != models.VerificationLevelIdentity && level != models.VerificationLevelBusiness {
+		return nil, ErrInvalidLevel
+	}
+	if !sub.RequestedLevel.AtLeast(level) {
+		return nil, ErrLevelAboveRequested
+	}
+	if missing := missingChecklistItems(level, req.Checklist); len(missing) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrChecklistIncomplete, strings.Join(missing, ", "))
+	}
+
+	checklistJSON, err := json.Marshal(req.Checklist)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal checklist: %w", err)
+	}
+
+	now := s.now()
+	expiresAt := now.Add(s.validity)
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE kyc_submissions
+		SET status = $1, approved_level = $2, checklist = $3, review_note = $4,
+		    reviewed_by = $5, reviewed_at = $6, expires_at = $7
+		WHERE id = $8 AND status = $9`,
+		StatusApproved, level, checklistJSON, req.Note, adminID, now, expiresAt, submissionID, StatusPending)
+	if err != nil {
+		return nil, fmt.Errorf("failed to approve submission: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return nil, ErrNotPending
+	}
+
+	// A new approval supersedes any earlier one
+	_, err = tx.ExecContext(ctx, `
+		UPDATE kyc_submissions SET status = $1
+		WHERE seller_id = $2 AND status = $3 AND id <> $4`,
+		StatusExpired, sub.SellerID, StatusApproved, submissionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to supersede previous verification: %w", err)
+	}
+
+	if err := setSellerLevel(ctx, tx, sub.SellerID, level, &expiresAt); err != nil {
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO seller_payout_accounts (seller_id, provider, account_id, account_name, submission_id, verified_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (seller_id) DO UPDATE
+		SET provider = EXCLUDED.provider, account_id = EXCLUDED.account_id,
+		    account_name = EXCLUDED.account_name, submission_id = EXCLUDED.submission_id,
+		    verified_at = EXCLUDED.verified_at`,
+		sub.SellerID, sub.PayoutAccount.Provider, sub.PayoutAccount.AccountID,
+		sub.PayoutAccount.AccountName, submissionID, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store payout account: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit approval: %w", err)
+	}
+
+	s.notify(sub.SellerID)
+
+	sub.Status = StatusApproved
+	sub.ApprovedLevel = level
+	sub.Checklist = req.Checklist
+	sub.ReviewNote = req.Note
+	sub.ReviewedBy = &adminID
+	sub.ReviewedAt = &now
+	sub.ExpiresAt = &expiresAt
+	return sub, nil
+}
+
+// Reject closes a pending submission with the reasons the seller needs to fix
+func (s *Service) Reject(ctx context.Context, submissionID, adminID uuid.UUID, req *RejectRequest) error {
+	if len(req.Reasons) == 0 {
+		return ErrInvalidRejection
+	}
+	for _, reason := range req.Reasons {
+		if !contains(RejectionReasons, reason) {
+			return fmt.Errorf("%w: %q", ErrInvalidRejection, reason)
+		}
+	}
+	if contains(req.Reasons, "other") && strings.TrimSpace(req.Note) == "" {
+		return ErrNoteRequired
+	}
+
+	reasonsJSON, err := json.Marshal(req.Reasons)
+	if err != nil {
+		return fmt.Errorf("failed to marshal rejection reasons: %w", err)
+	}
+
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE kyc_submissions
+		SET status = $1, rejection_reasons = $2, review_note = $3, reviewed_by = $4, reviewed_at = $5
+		WHERE id = $6 AND status = $7`,
+		StatusRejected, reasonsJSON, req.Note, adminID, s.now(), submissionID, StatusPending)
+	if err != nil {
+		return fmt.Errorf("failed to reject submission: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		if _, err := s.Get(ctx, submissionID); err != nil {
+			return err
+		}
+		return ErrNotPending
+	}
+
+	return nil
+}
+
+// Revoke removes a seller's verification immediately
+func (s *Service) Revoke(ctx context.Context, sellerID, adminID uuid.UUID, note string) error {
+	if strings.TrimSpace(note) == "" {
+		return ErrNoteRequired
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE kyc_submissions
+		SET status = $1, review_note = $2, reviewed_by = $3, reviewed_at = $4
+		WHERE seller_id = $5 AND status = $6`,
+		StatusRevoked, note, adminID, s.now(), sellerID, StatusApproved)
+	if err != nil {
+		return fmt.Errorf("failed to revoke verification: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		// Sellers verified through the legacy toggle have a level but no submission
+		var legacy bool
+		err := tx.QueryRowContext(ctx, `
+			SELECT verification_level <> $1 OR COALESCE(verified, false)
+			FROM sellers WHERE user_id = $2
+			FOR UPDATE`, models.VerificationLevelNone, sellerID).Scan(&legacy)
+		if err != nil && err != sql.ErrNoRows {
+			return fmt.Errorf("failed to load seller verification: %w", err)
+		}
+		if !legacy {
+			return ErrNotVerified
+		}
+	}
+
+	if err := setSellerLevel(ctx, tx, sellerID, models.VerificationLevelNone, nil); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit revocation: %w", err)
+	}
+
+	s.notify(sellerID)
+	return nil
+}
+
+// ExpireDue downgrades sellers whose verification has passed its expiry date
+func (s *Service) ExpireDue(ctx context.Context) (int, error) {
+	now := s.now()
+
+	// Sellers verified through the legacy toggle expire from the sellers row
+	// alone; this runs first so sellers with a due submission are left to it
+	legacyIDs, err := s.expiredSellerIDs(ctx, `
+		UPDATE sellers s
+		SET verification_level = $1, verification_expires_at = NULL, verified = false, updated_at = now()
+		WHERE s.verification_level <> $1 AND s.verification_expires_at <= $2
+		  AND NOT EXISTS (
+		      SELECT 1 FROM kyc_submissions k WHERE k.seller_id = s.user_id AND k.status = $3)
+		RETURNING s.user_id`, models.VerificationLevelNone, now, StatusApproved)
+	if err != nil {
+		return 0, err
+	}
+
+	sellerIDs, err := s.expiredSellerIDs(ctx, `
+		UPDATE kyc_submissions
+		SET status = $1
+		WHERE status = $2 AND expires_at <= $3
+		RETURNING seller_id`, StatusExpired, StatusApproved, now)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, sellerID := range sellerIDs {
+		// A deleted seller profile has no level left to expire
+		err := setSellerLevel(ctx, s.db, sellerID, models.VerificationLevelNone, nil)
+		if err != nil && !errors.Is(err, ErrNoSellerProfile) {
+			return 0, err
+		}
+	}
+
+	sellerIDs = append(sellerIDs, legacyIDs...)
+	for _, sellerID := range sellerIDs {
+		s.notify(sellerID)
+	}
+
+	return len(sellerIDs), nil
+}
+
+// expiredSellerIDs runs an expiry statement and returns the seller IDs it reports
+func (s *Service) expiredSellerIDs(ctx context.Context, query string, args ...interface{}) ([]uuid.UUID, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to expire verifications: %w", err)
+	}
+	defer rows.Close()
+
+	var sellerIDs []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan expired seller: %w", err)
+		}
+		sellerIDs = append(sellerIDs, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read expired sellers: %w", err)
+	}
+	return sellerIDs, nil
+}
+
+// StartExpiryChecks runs ExpireDue on the given interval until Stop is called
+func (s *Service) StartExpiryChecks(interval time.Duration) {
+	s.once.Do(func() {
+		log.Printf("Starting KYC expiry checks (interval: %v)", interval)
+
+		go func() {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-s.ctx.Done():
+					return
+				case <-ticker.C:
+					expired, err := s.ExpireDue(s.ctx)
+					if err != nil {
+						log.Printf("KYC expiry check failed: %v", err)
+					} else if expired > 0 {
+						log.Printf("Expired %d seller verifications", expired)
+					}
+				}
+			}
+		}()
+	})
+}
+
+// Stop stops the background expiry checks
+func (s *Service) Stop() {
+	s.cancel()
+}
+
+func (s *Service) notify(sellerID uuid.UUID) {
+	if s.notifier != nil {
+		s.notifier.Enqueue(sellerID, reputation.EventVerificationChanged)
+	}
+}
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// setSellerLevel updates the seller's level and keeps the legacy verified flag in sync
+func setSellerLevel(ctx context.Context, db execer, sellerID uuid.UUID, level models.VerificationLevel, expiresAt *time.Time) error {
+	result, err := db.ExecContext(ctx, `
+		UPDATE sellers
+		SET verification_level = $1, verification_expires_at = $2, verified = $3, updated_at = now()
+		WHERE user_id = $4`, level, expiresAt, level != models.VerificationLevelNone, sellerID)
+	if err != nil {
+		return fmt.Errorf("failed to update seller verification: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to update seller verification: %w", err)
+	}
+	if n == 0 {
+		return ErrNoSellerProfile
+	}
+	return nil
+}
+
+func (s *Service) loadDocuments(ctx context.Context, sub *Submission) error {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT doc_type, file_url, COALESCE(number_last4, '')
+		FROM kyc_documents
+		WHERE submission_id = $1
+		ORDER BY created_at`, sub.ID)
+	if err != nil {
+		return fmt.Errorf("failed to query documents: %w", err)
+	}
+	defer rows.Close()
+
+	sub.Documents = []Document{}
+	for rows.Next() {
+		var doc Document
+		if err := rows.Scan(&doc.Type, &doc.FileURL, &doc.NumberLast4); err != nil {
+			return fmt.Errorf("failed to scan document: %w", err)
+		}
+		sub.Documents = append(sub.Documents, doc)
+	}
+
+	return rows.Err()
+}
+
+var selectSubmissions = selectSubmissionsWith()
+
+// selectSubmissionsWith is selectSubmissions followed by any extra columns
+func selectSubmissionsWith(extra ...string) string {
+	columns := append([]string{"created_at"}, extra...)
+	return `
+	SELECT id, seller_id, requested_level, COALESCE(approved_level, ''), status,
+	       payout_provider, payout_account_id, payout_account_name,
+	       checklist, rejection_reasons, COALESCE(review_note, ''),
+	       reviewed_by, reviewed_at, expires_at, ` + strings.Join(columns, ", ") + `
+	FROM kyc_submissions`
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanSubmission reads a row of selectSubmissions; extra receives any extra columns
+func scanSubmission(row rowScanner, extra ...interface{}) (*Submission, error) {
+	var sub Submission
+	var checklistJSON, reasonsJSON []byte
+	var reviewedBy uuid.NullUUID
+	var reviewedAt, expiresAt sql.NullTime
+
+	dest := []interface{}{
+		&sub.ID, &sub.SellerID, &sub.RequestedLevel, &sub.ApprovedLevel, &sub.Status,
+		&sub.PayoutAccount.Provider, &sub.PayoutAccount.AccountID, &sub.PayoutAccount.AccountName,
+		&checklistJSON, &reasonsJSON, &sub.ReviewNote,
+		&reviewedBy, &reviewedAt, &expiresAt, &sub.CreatedAt,
+	}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+
+	if len(checklistJSON) > 0 {
+		if err := json.Unmarshal(checklistJSON, &sub.Checklist); err != nil {
+			return nil, fmt.Errorf("failed to parse checklist: %w", err)
+		}
+	}
+	if len(reasonsJSON) > 0 {
+		if err := json.Unmarshal(reasonsJSON, &sub.RejectionReasons); err != nil {
+			return nil, fmt.Errorf("failed to parse rejection reasons: %w", err)
+		}
+	}
+	if reviewedBy.Valid {
+		sub.ReviewedBy = &reviewedBy.UUID
+	}
+	if reviewedAt.Valid {
+		sub.ReviewedAt = &reviewedAt.Time
+	}
+	if expiresAt.Valid {
+		sub.ExpiresAt = &expiresAt.Time
+	}
+
+	return &sub, nil
+}
+
+func last4(number string) string {
+	number = strings.TrimSpace(number)
+	if len(number) <= 4 {
+		return number
+	}
+	return number[len(number)-4:]
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,97 @@
+package kyc
+
+import (
+	"testing"
+
+	"github.com/Andrew-mugwe/agroai/models"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func validSubmission(level models.VerificationLevel) *SubmitRequest {
+	req := &SubmitRequest{
+		Level: level,
+		Documents: []Document{
+			{Type: DocNationalID, FileURL: "https://files.example.com/id.jpg", Number: "12345678"},
+		},
+		PayoutAccount: PayoutAccount{Provider: "mpesa", AccountID: "254712345678", AccountName: "Jane Wanjiku"},
+	}
+	if level == models.VerificationLevelBusiness {
+		req.Documents = append(req.Documents, Document{Type: DocCoopMembership, FileURL: "https://files.example.com/coop.pdf"})
+	}
+	return req
+}
+
+func TestValidateSubmission(t *testing.T) {
+	assert.NoError(t, ValidateSubmission(validSubmission(models.VerificationLevelIdentity)))
+	assert.NoError(t, ValidateSubmission(validSubmission(models.VerificationLevelBusiness)))
+
+	tests := []struct {
+		name     string
+		mutate   func(req *SubmitRequest)
+		expected error
+	}{
+		{"invalid level", func(req *SubmitRequest) { req.Level = models.VerificationLevelNone }, ErrInvalidLevel},
+		{"no id document", func(req *SubmitRequest) { req.Documents = nil }, ErrMissingIDDocument},
+		{"unknown document", func(req *SubmitRequest) {
+			req.Documents = append(req.Documents, Document{Type: "utility_bill", FileURL: "https://x"})
+		}, ErrInvalidDocument},
+		{"missing file", func(req *SubmitRequest) { req.Documents[0].FileURL = "" }, ErrInvalidDocument},
+		{"business without business document", func(req *SubmitRequest) {
+			req.Level = models.VerificationLevelBusiness
+		}, ErrMissingBusinessDoc},
+		{"unknown payout provider", func(req *SubmitRequest) { req.PayoutAccount.Provider = "bank" }, ErrMissingPayoutAccount},
+		{"missing account name", func(req *SubmitRequest) { req.PayoutAccount.AccountName = " " }, ErrMissingPayoutAccount},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := validSubmission(models.VerificationLevelIdentity)
+			test.mutate(req)
+			assert.ErrorIs(t, ValidateSubmission(req), test.expected)
+		})
+	}
+}
+
+func TestChecklist(t *testing.T) {
+	identity := Checklist(models.VerificationLevelIdentity)
+	business := Checklist(models.VerificationLevelBusiness)
+
+	assert.Len(t, identity, 3)
+	assert.Subset(t, business, identity)
+	assert.Contains(t, business, CheckBusinessDocValid)
+
+	checklist := map[string]bool{CheckIDLegible: true, CheckIDMatchesProfile: true, CheckPayoutAccountOwner: true}
+	assert.Empty(t, missingChecklistItems(models.VerificationLevelIdentity, checklist))
+	assert.ElementsMatch(t,
+		[]string{CheckBusinessDocValid, CheckBusinessNameMatch},
+		missingChecklistItems(models.VerificationLevelBusiness, checklist))
+
+	checklist[CheckIDLegible] = false
+	assert.Equal(t, []string{CheckIDLegible}, missingChecklistItems(models.VerificationLevelIdentity, checklist))
+}
+
+func TestPayoutLimitCheck(t *testing.T) {
+	limit := PayoutLimit{
+		Level:     models.VerificationLevelIdentity,
+		Currency:  "KES",
+		PerPayout: decimal.NewFromInt(150000),
+		Rolling30: decimal.NewFromInt(1000000),
+	}
+
+	assert.NoError(t, limit.Check(decimal.NewFromInt(150000), decimal.NewFromInt(850000)))
+	assert.ErrorIs(t, limit.Check(decimal.NewFromInt(150001), decimal.Zero), ErrPayoutAboveLimit)
+	assert.ErrorIs(t, limit.Check(decimal.NewFromInt(100000), decimal.NewFromInt(950000)), ErrPayoutWindowExceeded)
+}
+
+func TestLast4(t *testing.T) {
+	assert.Equal(t, "5678", last4(" 12345678 "))
+	assert.Equal(t, "123", last4("123"))
+	assert.Equal(t, "", last4(""))
+}
+
+func TestPayoutLevel(t *testing.T) {
+	assert.Equal(t, models.VerificationLevelBusiness, payoutLevel(models.VerificationLevelBusiness, true))
+	// Verified through the legacy toggle, never through KYC
+	assert.Equal(t, models.VerificationLevelNone, payoutLevel(models.VerificationLevelIdentity, false))
+}
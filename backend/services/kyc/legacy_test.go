@@ -0,0 +1,123 @@
+package kyc
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	_ "github.com/lib/pq"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Andrew-mugwe/agroai/models"
+)
+
+// Sellers verified through the old toggle were moved to identity level by
+// migration 0022 without a submission or payout account. These tests, and
+// the seller profile ones at the end, need a migrated database.
+
+func setupLegacyDB(t *testing.T) *sql.DB {
+	databaseURL := os.Getenv("DATABASE_URL")
+	if databaseURL == "" {
+		t.Skip("DATABASE_URL not set, skipping integration test")
+	}
+
+	db, err := sql.Open("postgres", databaseURL)
+	require.NoError(t, err)
+	require.NoError(t, db.Ping())
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// createLegacySeller adds a seller as migration 0022 left toggle-verified ones
+func createLegacySeller(t *testing.T, db *sql.DB, expiresAt time.Time) uuid.UUID {
+	var sellerID uuid.UUID
+	err := db.QueryRow(`
+		INSERT INTO users (name, email, password_hash, role)
+		VALUES ('Legacy Seller', $1, 'x', 'farmer')
+		RETURNING id`, "legacy-"+uuid.NewString()+"@example.com").Scan(&sellerID)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Exec(`DELETE FROM users WHERE id = $1`, sellerID) })
+
+	_, err = db.Exec(`
+		INSERT INTO sellers (user_id, name, verified, verification_level, verification_expires_at)
+		VALUES ($1, 'Legacy Seller', true, 'identity', $2)`, sellerID, expiresAt)
+	require.NoError(t, err)
+	return sellerID
+}
+
+func sellerVerification(t *testing.T, db *sql.DB, sellerID uuid.UUID) (models.VerificationLevel, bool) {
+	var level models.VerificationLevel
+	var verified bool
+	err := db.QueryRow(`SELECT verification_level, verified FROM sellers WHERE user_id = $1`, sellerID).
+		Scan(&level, &verified)
+	require.NoError(t, err)
+	return level, verified
+}
+
+func TestAuthorizePayoutLegacySeller(t *testing.T) {
+	db := setupLegacyDB(t)
+	sellerID := createLegacySeller(t, db, time.Now().AddDate(1, 0, 0))
+	s := NewService(db)
+	ctx := context.Background()
+
+	// Paid under the unverified limits, to any account
+	assert.NoError(t, s.AuthorizePayout(ctx, sellerID, decimal.NewFromInt(10000), "KES", "mpesa", "254700000000"))
+	assert.ErrorIs(t, s.AuthorizePayout(ctx, sellerID, decimal.NewFromInt(10001), "KES", "mpesa", "254700000000"),
+		ErrPayoutAboveLimit)
+}
+
+func TestRevokeLegacySeller(t *testing.T) {
+	db := setupLegacyDB(t)
+	sellerID := createLegacySeller(t, db, time.Now().AddDate(1, 0, 0))
+	s := NewService(db)
+	ctx := context.Background()
+
+	require.NoError(t, s.Revoke(ctx, sellerID, sellerID, "documents never checked"))
+	level, verified := sellerVerification(t, db, sellerID)
+	assert.Equal(t, models.VerificationLevelNone, level)
+	assert.False(t, verified)
+
+	assert.ErrorIs(t, s.Revoke(ctx, sellerID, sellerID, "again"), ErrNotVerified)
+}
+
+func TestExpireDueLegacySeller(t *testing.T) {
+	db := setupLegacyDB(t)
+	dueID := createLegacySeller(t, db, time.Now().Add(-time.Hour))
+	currentID := createLegacySeller(t, db, time.Now().AddDate(1, 0, 0))
+	s := NewService(db)
+
+	expired, err := s.ExpireDue(context.Background())
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, expired, 1)
+
+	level, verified := sellerVerification(t, db, dueID)
+	assert.Equal(t, models.VerificationLevelNone, level)
+	assert.False(t, verified)
+
+	level, verified = sellerVerification(t, db, currentID)
+	assert.Equal(t, models.VerificationLevelIdentity, level)
+	assert.True(t, verified)
+}
+
+func TestSubmitWithoutSellerProfile(t *testing.T) {
+	db := setupLegacyDB(t)
+	var userID uuid.UUID
+	err := db.QueryRow(`
+		INSERT INTO users (name, email, password_hash, role)
+		VALUES ('No Profile', $1, 'x', 'farmer')
+		RETURNING id`, "no-profile-"+uuid.NewString()+"@example.com").Scan(&userID)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Exec(`DELETE FROM users WHERE id = $1`, userID) })
+	s := NewService(db)
+	ctx := context.Background()
+
+	_, err = s.Submit(ctx, userID, validSubmission(models.VerificationLevelIdentity))
+	assert.ErrorIs(t, err, ErrNoSellerProfile)
+
+	assert.ErrorIs(t, setSellerLevel(ctx, db, userID, models.VerificationLevelIdentity, nil), ErrNoSellerProfile)
+}
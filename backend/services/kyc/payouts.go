@@ -0,0 +1,118 @@
+package kyc
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Andrew-mugwe/agroai/models"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// Payout errors
+var (
+	ErrNoPayoutLimit         = errors.New("no payout limit configured for this verification level and currency")
+	ErrPayoutAboveLimit      = errors.New("payout exceeds the single payout limit for this verification level")
+	ErrPayoutWindowExceeded  = errors.New("payout exceeds the 30-day payout limit for this verification level")
+	ErrPayoutAccountMismatch = errors.New("payout account does not match the seller's verified account")
+)
+
+// PayoutLimit caps payouts for a verification level in one currency
+type PayoutLimit struct {
+	Level     models.VerificationLevel `json:"level"`
+	Currency  string                   `json:"currency"`
+	PerPayout decimal.Decimal          `json:"per_payout"`
+	Rolling30 decimal.Decimal          `json:"rolling_30_days"`
+}
+
+// Check returns an error if amount, on top of what was paid out in the last
+// 30 days, breaks the limit
+func (l PayoutLimit) Check(amount, paidLast30 decimal.Decimal) error {
+	if amount.GreaterThan(l.PerPayout) {
+		return ErrPayoutAboveLimit
+	}
+	if paidLast30.Add(amount).GreaterThan(l.Rolling30) {
+		return ErrPayoutWindowExceeded
+	}
+	return nil
+}
+
+// PayoutLimit returns the limit for a level and currency
+func (s *Service) PayoutLimit(ctx context.Context, level models.VerificationLevel, currency string) (PayoutLimit, error) {
+	limit := PayoutLimit{Level: level, Currency: strings.ToUpper(currency)}
+	err := s.db.QueryRowContext(ctx, `
+		SELECT per_payout, rolling_30_days
+		FROM kyc_payout_limits
+		WHERE level = $1 AND currency = $2`, level, limit.Currency).Scan(&limit.PerPayout, &limit.Rolling30)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return limit, ErrNoPayoutLimit
+		}
+		return limit, fmt.Errorf("failed to load payout limit: %w", err)
+	}
+	return limit, nil
+}
+
+// payoutLevel returns the level whose limits apply to a payout. Approval
+// always stores a payout account, so a verified seller without one got their
+// level from the legacy verified toggle; they are paid like unverified
+// sellers, to any account, until they complete KYC.
+func payoutLevel(level models.VerificationLevel, accountOnFile bool) models.VerificationLevel {
+	if !accountOnFile {
+		return models.VerificationLevelNone
+	}
+	return level
+}
+
+// AuthorizePayout checks a payout against the seller's verification level,
+// verified payout account and payout limits
+func (s *Service) AuthorizePayout(ctx context.Context, sellerID uuid.UUID, amount decimal.Decimal, currency, provider, accountID string) error {
+	var level models.VerificationLevel
+	err := s.db.QueryRowContext(ctx, `
+		SELECT CASE WHEN verification_expires_at IS NULL OR verification_expires_at > $2
+		            THEN verification_level ELSE 'none' END
+		FROM sellers WHERE user_id = $1`, sellerID, s.now()).Scan(&level)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			return fmt.Errorf("failed to load verification level: %w", err)
+		}
+		level = models.VerificationLevelNone
+	}
+
+	// Verified sellers can only be paid to the account checked during KYC
+	if level != models.VerificationLevelNone {
+		var onFileProvider, onFileAccount string
+		err := s.db.QueryRowContext(ctx, `
+			SELECT provider, account_id FROM seller_payout_accounts WHERE seller_id = $1`,
+			sellerID).Scan(&onFileProvider, &onFileAccount)
+		if err != nil && err != sql.ErrNoRows {
+			return fmt.Errorf("failed to load payout account: %w", err)
+		}
+		accountOnFile := err == nil
+		if accountOnFile && (onFileProvider != provider || onFileAccount != accountID) {
+			return ErrPayoutAccountMismatch
+		}
+		level = payoutLevel(level, accountOnFile)
+	}
+
+	limit, err := s.PayoutLimit(ctx, level, currency)
+	if err != nil {
+		return err
+	}
+
+	var paidLast30 decimal.Decimal
+	err = s.db.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(amount), 0)
+		FROM escrows
+		WHERE seller_id = $1 AND currency = $2 AND status = $3
+		  AND released_at >= $4`,
+		sellerID, limit.Currency, models.EscrowStatusReleased, s.now().AddDate(0, 0, -30)).Scan(&paidLast30)
+	if err != nil {
+		return fmt.Errorf("failed to sum recent payouts: %w", err)
+	}
+
+	return limit.Check(amount, paidLast30)
+}
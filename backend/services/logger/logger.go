@@ -7,6 +7,7 @@ import (
 	"log"
 	"time"
 
+	"github.com/Andrew-mugwe/agroai/pagination"
 	"github.com/google/uuid"
 )
 
@@ -102,61 +103,57 @@ func (al *ActivityLogger) LogAction(userID *uuid.UUID, role string, action strin
 	return nil
 }
 
-// GetLogs retrieves activity logs based on query parameters
-func (al *ActivityLogger) GetLogs(query LogQuery) ([]ActivityLog, error) {
-	baseQuery := `
-		SELECT id, user_id, role, action, metadata, ip_address, user_agent, created_at
-		FROM activity_logs
-		WHERE 1=1
-	`
-
+// where renders the query's filters as a WHERE clause and its arguments
+func (query LogQuery) where() (string, []interface{}) {
+	clause := " WHERE 1=1"
 	args := []interface{}{}
-	argIndex := 1
 
-	// Build WHERE clause dynamically
 	if query.UserID != nil {
-		baseQuery += fmt.Sprintf(" AND user_id = $%d", argIndex)
 		args = append(args, *query.UserID)
-		argIndex++
+		clause += fmt.Sprintf(" AND user_id = $%d", len(args))
 	}
 
 	if query.Role != "" {
-		baseQuery += fmt.Sprintf(" AND role = $%d", argIndex)
 		args = append(args, query.Role)
-		argIndex++
+		clause += fmt.Sprintf(" AND role = $%d", len(args))
 	}
 
 	if query.Action != "" {
-		baseQuery += fmt.Sprintf(" AND action = $%d", argIndex)
 		args = append(args, query.Action)
-		argIndex++
+		clause += fmt.Sprintf(" AND action = $%d", len(args))
 	}
 
 	if query.StartDate != nil {
-		baseQuery += fmt.Sprintf(" AND created_at >= $%d", argIndex)
 		args = append(args, *query.StartDate)
-		argIndex++
+		clause += fmt.Sprintf(" AND created_at >= $%d", len(args))
 	}
 
 	if query.EndDate != nil {
-		baseQuery += fmt.Sprintf(" AND created_at <= $%d", argIndex)
 		args = append(args, *query.EndDate)
-		argIndex++
+		clause += fmt.Sprintf(" AND created_at <= $%d", len(args))
 	}
 
+	return clause, args
+}
+
+// GetLogs retrieves activity logs based on query parameters
+func (al *ActivityLogger) GetLogs(query LogQuery) ([]ActivityLog, error) {
+	where, args := query.where()
+	baseQuery := `
+		SELECT id, user_id, role, action, metadata, ip_address, user_agent, created_at
+		FROM activity_logs` + where
+
 	// Add ordering and pagination
 	baseQuery += " ORDER BY created_at DESC"
 
 	if query.Limit > 0 {
-		baseQuery += fmt.Sprintf(" LIMIT $%d", argIndex)
 		args = append(args, query.Limit)
-		argIndex++
+		baseQuery += fmt.Sprintf(" LIMIT $%d", len(args))
 	}
 
 	if query.Offset > 0 {
-		baseQuery += fmt.Sprintf(" OFFSET $%d", argIndex)
 		args = append(args, query.Offset)
-		argIndex++
+		baseQuery += fmt.Sprintf(" OFFSET $%d", len(args))
 	}
 
 	// Execute query
@@ -168,38 +165,11 @@ func (al *ActivityLogger) GetLogs(query LogQuery) ([]ActivityLog, error) {
 
 	var logs []ActivityLog
 	for rows.Next() {
-		var log ActivityLog
-		var metadataJSON []byte
-		var userID *uuid.UUID
-
-		err := rows.Scan(
-			&log.ID,
-			&userID,
-			&log.Role,
-			&log.Action,
-			&metadataJSON,
-			&log.IPAddress,
-			&log.UserAgent,
-			&log.CreatedAt,
-		)
+		log, err := scanActivityLog(rows)
 		if err != nil {
 			fmt.Printf("Error scanning activity log row: %v", err)
 			continue
 		}
-
-		log.UserID = userID
-
-		// Parse metadata JSON
-		if len(metadataJSON) > 0 {
-			err = json.Unmarshal(metadataJSON, &log.Metadata)
-			if err != nil {
-				fmt.Printf("Warning: Failed to unmarshal metadata for log ID %d: %v", log.ID, err)
-				log.Metadata = make(map[string]interface{})
-			}
-		} else {
-			log.Metadata = make(map[string]interface{})
-		}
-
 		logs = append(logs, log)
 	}
 
@@ -210,6 +180,100 @@ func (al *ActivityLogger) GetLogs(query LogQuery) ([]ActivityLog, error) {
 	return logs, nil
 }
 
+// logSort is the only activity log order; cursors carry it
+const logSort = "newest"
+
+// logKeyset lists activity logs newest first
+var logKeyset = pagination.Keyset{Key: "created_at", ID: "id", Dir: pagination.Desc}
+
+// ListLogs returns the page of logs matching the query's filters after
+// page.Cursor, with the total number of matches. Limit and Offset are ignored.
+func (al *ActivityLogger) ListLogs(query LogQuery, page pagination.Params) (pagination.Page[ActivityLog], error) {
+	var none pagination.Page[ActivityLog]
+	page = page.Normalize()
+	after, err := page.After(logSort)
+	if err != nil {
+		return none, err
+	}
+
+	where, args := query.where()
+
+	var total int
+	if err := al.db.QueryRow("SELECT COUNT(*) FROM activity_logs"+where, args...).Scan(&total); err != nil {
+		return none, fmt.Errorf("failed to count activity logs: %v", err)
+	}
+
+	if after != nil {
+		args = append(args, after.Key, after.ID)
+		where += " AND " + logKeyset.After(fmt.Sprintf("$%d", len(args)-1), fmt.Sprintf("$%d", len(args)))
+	}
+	args = append(args, page.FetchLimit())
+	rows, err := al.db.Query(fmt.Sprintf(`
+		SELECT id, user_id, role, action, metadata, ip_address, user_agent, created_at, %s
+		FROM activity_logs%s
+		ORDER BY %s
+		LIMIT $%d`, logKeyset.KeyText(), where, logKeyset.OrderBy(), len(args)), args...)
+	if err != nil {
+		return none, fmt.Errorf("failed to query activity logs: %v", err)
+	}
+	defer rows.Close()
+
+	var logs []ActivityLog
+	var keys []string
+	for rows.Next() {
+		var key string
+		log, err := scanActivityLog(rows, &key)
+		if err != nil {
+			fmt.Printf("Error scanning activity log row: %v", err)
+			continue
+		}
+		logs = append(logs, log)
+		keys = append(keys, key)
+	}
+	if err = rows.Err(); err != nil {
+		return none, fmt.Errorf("error iterating activity log rows: %v", err)
+	}
+
+	return pagination.NewPage(logs, page.Limit, func(i int) pagination.Cursor {
+		return pagination.Cursor{Key: keys[i], ID: fmt.Sprint(logs[i].ID), Sort: logSort}
+	}).WithTotal(total), nil
+}
+
+// scanActivityLog reads a log row; extra receives any extra columns
+func scanActivityLog(rows *sql.Rows, extra ...interface{}) (ActivityLog, error) {
+	var log ActivityLog
+	var metadataJSON []byte
+	var userID *uuid.UUID
+
+	dest := []interface{}{
+		&log.ID,
+		&userID,
+		&log.Role,
+		&log.Action,
+		&metadataJSON,
+		&log.IPAddress,
+		&log.UserAgent,
+		&log.CreatedAt,
+	}
+	if err := rows.Scan(append(dest, extra...)...); err != nil {
+		return log, err
+	}
+
+	log.UserID = userID
+
+	// Parse metadata JSON
+	if len(metadataJSON) > 0 {
+		if err := json.Unmarshal(metadataJSON, &log.Metadata); err != nil {
+			fmt.Printf("Warning: Failed to unmarshal metadata for log ID %d: %v", log.ID, err)
+			log.Metadata = make(map[string]interface{})
+		}
+	} else {
+		log.Metadata = make(map[string]interface{})
+	}
+
+	return log, nil
+}
+
 // GetLogsByUser retrieves activity logs for a specific user
 func (al *ActivityLogger) GetLogsByUser(userID uuid.UUID, limit int) ([]ActivityLog, error) {
 	query := LogQuery{
@@ -5,185 +5,217 @@ package marketplace
 import (
 	"context"
 	"database/sql"
-	"fmt"
+	"errors"
+	"math"
 	"strings"
+
+	"github.com/Andrew-mugwe/agroai/models"
+	"github.com/Andrew-mugwe/agroai/pagination"
+	"github.com/Andrew-mugwe/agroai/repository"
+	"github.com/Andrew-mugwe/agroai/services/search"
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrProductNotFound is returned for missing and inactive listings
+	ErrProductNotFound = errors.New("product not found")
+	// ErrSearchUnavailable is returned when no search subsystem is configured
+	ErrSearchUnavailable = errors.New("search is unavailable")
 )
 
-type Product struct {
-	ID                 string   `json:"id"`
-	SellerID           string   `json:"seller_id"`
-	Title              string   `json:"title"`
-	Description        string   `json:"description"`
-	Category           string   `json:"category"`
-	PriceCents         int64    `json:"price_cents"`
-	Currency           string   `json:"currency"`
-	Stock              int      `json:"stock"`
-	Images             []string `json:"images"`
-	CreatedAt          string   `json:"created_at"`
-	UpdatedAt          string   `json:"updated_at"`
-	SellerName         *string  `json:"seller_name,omitempty"`
-	SellerVerified     *bool    `json:"seller_verified,omitempty"`
-	SellerRating       *float64 `json:"seller_rating,omitempty"`
-	SellerReviewsCount *int     `json:"seller_reviews_count,omitempty"`
+// defaultLimit is the public catalogue's page size
+const defaultLimit = 12
+
+// ListFilter is a public catalogue query. Its JSON names match the query
+// parameters, so saved searches store it as is.
+type ListFilter struct {
+	Page     pagination.Params `json:"-"`
+	Category string            `json:"category,omitempty"`
+	MinPrice *int64            `json:"min_price,omitempty"`
+	MaxPrice *int64            `json:"max_price,omitempty"`
+	Query    string            `json:"q,omitempty"`
+	SellerID string            `json:"seller_id,omitempty"`
+	// Unit compares listings per base unit, e.g. "kg" or "l"; a smaller
+	// unit such as "g" compares in its base unit
+	Unit string `json:"unit,omitempty"`
+	Sort string `json:"sort,omitempty"`
+
+	// Lat and Lng are the buyer's location. RadiusKm keeps sellers within
+	// that distance and DeliversTo keeps sellers whose service areas cover
+	// it; results then carry distance_km and can be sorted by "distance".
+	Lat        *float64 `json:"lat,omitempty"`
+	Lng        *float64 `json:"lng,omitempty"`
+	RadiusKm   float64  `json:"radius_km,omitempty"`
+	DeliversTo bool     `json:"delivers_to_me,omitempty"`
+
+	// Facet filters, served by the search subsystem
+	PriceBand string `json:"price_band,omitempty"`
+	Verified  *bool  `json:"verified,omitempty"`
+	Location  string `json:"location,omitempty"`
+	InStock   *bool  `json:"in_stock,omitempty"`
 }
 
-type Meta struct {
-	Page  int `json:"page"`
-	Limit int `json:"limit"`
-	Total int `json:"total"`
+// needsSearch reports whether the filter uses text or facet matching,
+// which only the search subsystem supports
+func (f ListFilter) needsSearch() bool {
+	return strings.TrimSpace(f.Query) != "" || f.PriceBand != "" || f.Verified != nil ||
+		strings.TrimSpace(f.Location) != "" || f.InStock != nil
 }
 
-type ListFilter struct {
-	Page     int
-	Limit    int
-	Category string
-	MinPrice *int64
-	MaxPrice *int64
-	Query    string
-	SellerID string
-	Sort     string
+// searchQuery maps the public filter onto a search query
+func (f ListFilter) searchQuery() search.Query {
+	filter, page := f.productFilter()
+	return search.Query{
+		Text:       filter.Query,
+		Category:   filter.Category,
+		PriceBand:  f.PriceBand,
+		MinPrice:   filter.MinPriceCents,
+		MaxPrice:   filter.MaxPriceCents,
+		Verified:   f.Verified,
+		Location:   f.Location,
+		InStock:    f.InStock,
+		SellerID:   filter.SellerID,
+		BaseUnit:   filter.BaseUnit,
+		Near:       filter.Near,
+		RadiusKm:   filter.RadiusKm,
+		DeliversTo: filter.DeliversTo,
+		Sort:       f.Sort,
+		Page:       page,
+	}
 }
 
+// Service serves the public, read-only view of the product catalogue.
+// Text and facet queries go through the search subsystem when one is set.
 type Service struct {
-	db *sql.DB
+	products repository.ProductRepository
+	search   *search.Service
 }
 
-func NewService(db *sql.DB) *Service {
-	return &Service{db: db}
+func NewService(products repository.ProductRepository, searcher *search.Service) *Service {
+	return &Service{products: products, search: searcher}
 }
 
-// DB exposes the underlying *sql.DB for simple read helpers where pragmatic.
-func (s *Service) DB() *sql.DB { return s.db }
-
-func (s *Service) ListPublicProducts(ctx context.Context, f ListFilter) ([]Product, Meta, error) {
-	if f.Page <= 0 {
-		f.Page = 1
+// productFilter normalises paging and maps the public filter onto the
+// catalogue filter; only active listings are public
+func (f ListFilter) productFilter() (repository.ProductFilter, pagination.Params) {
+	if f.Page.Limit <= 0 {
+		f.Page.Limit = defaultLimit
 	}
-	if f.Limit <= 0 || f.Limit > 100 {
-		f.Limit = 12
-	}
-	offset := (f.Page - 1) * f.Limit
+	f.Page = f.Page.Normalize()
 
-	where := []string{"1=1"}
-	args := []interface{}{}
-	ai := 1
-	if f.Category != "" {
-		where = append(where, fmt.Sprintf("category = $%d", ai))
-		args = append(args, f.Category)
-		ai++
+	active := true
+	filter := repository.ProductFilter{
+		Category:      f.Category,
+		MinPriceCents: f.MinPrice,
+		MaxPriceCents: f.MaxPrice,
+		Query:         strings.TrimSpace(f.Query),
+		Active:        &active,
+		Sort:          f.Sort,
 	}
-	if f.SellerID != "" {
-		where = append(where, fmt.Sprintf("seller_id = $%d", ai))
-		args = append(args, f.SellerID)
-		ai++
+	if sellerID, err := uuid.Parse(f.SellerID); err == nil {
+		filter.SellerID = &sellerID
 	}
-	if f.MinPrice != nil {
-		where = append(where, fmt.Sprintf("price_cents >= $%d", ai))
-		args = append(args, *f.MinPrice)
-		ai++
+	if unit := models.UnitOfMeasure(strings.ToLower(strings.TrimSpace(f.Unit))); unit.IsValid() {
+		filter.BaseUnit = unit.Base()
 	}
-	if f.MaxPrice != nil {
-		where = append(where, fmt.Sprintf("price_cents <= $%d", ai))
-		args = append(args, *f.MaxPrice)
-		ai++
+	if near := f.near(); near != nil {
+		filter.Near = near
+		filter.RadiusKm = math.Min(math.Max(f.RadiusKm, 0), models.MaxSearchRadiusKm)
+		filter.DeliversTo = f.DeliversTo
 	}
-	if strings.TrimSpace(f.Query) != "" {
-		where = append(where, fmt.Sprintf("search_tsv @@ plainto_tsquery('simple', $%d)", ai))
-		args = append(args, f.Query)
-		ai++
+	return filter, f.Page
+}
+
+// near returns the buyer's location when both coordinates are valid
+func (f ListFilter) near() *models.GeoPoint {
+	if f.Lat == nil || f.Lng == nil {
+		return nil
+	}
+	point := models.GeoPoint{Lat: *f.Lat, Lng: *f.Lng}
+	if point.Validate() != nil {
+		return nil
 	}
+	return &point
+}
+
+func (s *Service) ListPublicProducts(ctx context.Context, f ListFilter) (pagination.Page[*models.Product], error) {
+	filter, page := f.productFilter()
 
-	sort := "created_at DESC"
-	switch f.Sort {
-	case "price_asc":
-		sort = "price_cents ASC"
-	case "price_desc":
-		sort = "price_cents DESC"
+	// An unparseable seller ID matches nothing rather than everything
+	if f.SellerID != "" && filter.SellerID == nil {
+		return pagination.NewPage[*models.Product](nil, page.Limit, nil).WithTotal(0), nil
 	}
 
-	countSQL := "SELECT COUNT(*) FROM public_products WHERE " + strings.Join(where, " AND ")
-	var total int
-	if err := s.db.QueryRowContext(ctx, countSQL, args...).Scan(&total); err != nil {
-		return nil, Meta{}, err
+	if s.search != nil && f.needsSearch() {
+		result, err := s.search.Search(ctx, f.searchQuery())
+		if err != nil {
+			return pagination.Page[*models.Product]{}, err
+		}
+		return result.Page, nil
 	}
 
-	query := "SELECT id, seller_id, title, description, category, price_cents, currency, stock, images, created_at, updated_at, seller_name, seller_verified, seller_rating, seller_reviews_count FROM public_products WHERE " + strings.Join(where, " AND ") + " ORDER BY " + sort + " LIMIT $%d OFFSET $%d"
-	query = fmt.Sprintf(query, ai, ai+1)
-	args = append(args, f.Limit, offset)
+	total, err := s.products.Count(ctx, filter)
+	if err != nil {
+		return pagination.Page[*models.Product]{}, err
+	}
 
-	rows, err := s.db.QueryContext(ctx, query, args...)
+	products, err := s.products.ListPage(ctx, filter, page)
 	if err != nil {
-		return nil, Meta{}, err
+		return pagination.Page[*models.Product]{}, err
 	}
-	defer rows.Close()
+	return products.WithTotal(total), nil
+}
 
-	products := []Product{}
-	for rows.Next() {
-		var p Product
-		var imagesJSON []byte
-		if err := rows.Scan(&p.ID, &p.SellerID, &p.Title, &p.Description, &p.Category, &p.PriceCents, &p.Currency, &p.Stock, &imagesJSON, &p.CreatedAt, &p.UpdatedAt, &p.SellerName, &p.SellerVerified, &p.SellerRating, &p.SellerReviewsCount); err != nil {
-			return nil, Meta{}, err
+// GetPublicProduct returns an active listing; inactive listings are reported
+// as not found
+func (s *Service) GetPublicProduct(ctx context.Context, id uuid.UUID) (*models.Product, error) {
+	product, err := s.products.GetByID(ctx, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrProductNotFound
 		}
-		// naive JSON array of strings
-		p.Images = parseStringArrayJSON(imagesJSON)
-		products = append(products, p)
+		return nil, err
 	}
-	return products, Meta{Page: f.Page, Limit: f.Limit, Total: total}, nil
+	if !product.IsActive {
+		return nil, ErrProductNotFound
+	}
+	return product, nil
 }
 
-func (s *Service) GetPublicProduct(ctx context.Context, id string) (Product, error) {
-	var p Product
-	var imagesJSON []byte
-	err := s.db.QueryRowContext(ctx, `
-        SELECT id, seller_id, title, description, category, price_cents, currency, stock, images, created_at, updated_at, seller_name, seller_verified, seller_rating, seller_reviews_count
-        FROM public_products WHERE id = $1
-    `, id).Scan(&p.ID, &p.SellerID, &p.Title, &p.Description, &p.Category, &p.PriceCents, &p.Currency, &p.Stock, &imagesJSON, &p.CreatedAt, &p.UpdatedAt, &p.SellerName, &p.SellerVerified, &p.SellerRating, &p.SellerReviewsCount)
-	if err != nil {
-		return Product{}, err
+// Search runs a faceted search over active listings
+func (s *Service) Search(ctx context.Context, f ListFilter) (*search.Result, error) {
+	if s.search == nil {
+		return nil, ErrSearchUnavailable
 	}
-	p.Images = parseStringArrayJSON(imagesJSON)
-	return p, nil
+	if f.SellerID != "" {
+		if _, err := uuid.Parse(f.SellerID); err != nil {
+			_, page := f.productFilter()
+			return &search.Result{Page: pagination.NewPage[*models.Product](nil, page.Limit, nil).WithTotal(0)}, nil
+		}
+	}
+	return s.search.Search(ctx, f.searchQuery())
 }
 
-func (s *Service) SearchProducts(ctx context.Context, q string, limit int) ([]Product, error) {
+// SearchProducts returns the best matches for q, e.g. for autocomplete
+func (s *Service) SearchProducts(ctx context.Context, q string, limit int) ([]*models.Product, error) {
 	if limit <= 0 || limit > 50 {
 		limit = 10
 	}
-	rows, err := s.db.QueryContext(ctx, `
-        SELECT id, seller_id, title, description, category, price_cents, currency, stock, images, created_at, updated_at
-        FROM public_products WHERE search_tsv @@ plainto_tsquery('simple', $1) ORDER BY ts_rank(search_tsv, plainto_tsquery('simple', $1)) DESC LIMIT $2
-    `, q, limit)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-	out := []Product{}
-	for rows.Next() {
-		var p Product
-		var imagesJSON []byte
-		if err := rows.Scan(&p.ID, &p.SellerID, &p.Title, &p.Description, &p.Category, &p.PriceCents, &p.Currency, &p.Stock, &imagesJSON, &p.CreatedAt, &p.UpdatedAt); err != nil {
+	if s.search != nil {
+		result, err := s.search.Search(ctx, search.Query{Text: q, Page: pagination.Params{Limit: limit}, Sort: search.SortRelevance})
+		if err != nil {
 			return nil, err
 		}
-		p.Images = parseStringArrayJSON(imagesJSON)
-		out = append(out, p)
+		return result.Page.Items, nil
 	}
-	return out, nil
+	filter, page := ListFilter{Query: q, Page: pagination.Params{Limit: limit}, Sort: repository.ProductSortRelevance}.productFilter()
+	products, err := s.products.ListPage(ctx, filter, page)
+	if err != nil {
+		return nil, err
+	}
+	return products.Items, nil
 }
 
-func parseStringArrayJSON(b []byte) []string {
-	if len(b) == 0 {
-		return nil
-	}
-	s := strings.TrimSpace(string(b))
-	s = strings.TrimPrefix(s, "[")
-	s = strings.TrimSuffix(s, "]")
-	if s == "" {
-		return nil
-	}
-	parts := strings.Split(s, ",")
-	out := make([]string, 0, len(parts))
-	for _, p := range parts {
-		out = append(out, strings.Trim(strings.TrimSpace(p), `"`))
-	}
-	return out
+func (s *Service) ListCategories(ctx context.Context) ([]string, error) {
+	return s.products.ListCategories(ctx)
 }
@@ -2,29 +2,118 @@ package marketplace
 
 // Flow14.1.1
 
-import "testing"
-
-func TestParseStringArrayJSON(t *testing.T) {
-    cases := []struct{
-        in []byte
-        want []string
-    }{
-        {[]byte(`[]`), nil},
-        {[]byte(`["a","b","c"]`), []string{"a","b","c"}},
-        {[]byte(` [ "x" , "y" ] `), []string{"x","y"}},
-        {nil, nil},
-    }
-    for i, c := range cases {
-        got := parseStringArrayJSON(c.in)
-        if len(got) != len(c.want) {
-            t.Fatalf("case %d: len=%d want=%d", i, len(got), len(c.want))
-        }
-        for j := range got {
-            if got[j] != c.want[j] {
-                t.Fatalf("case %d item %d: got %q want %q", i, j, got[j], c.want[j])
-            }
-        }
-    }
+import (
+	"testing"
+
+	"github.com/Andrew-mugwe/agroai/models"
+	"github.com/Andrew-mugwe/agroai/pagination"
+	"github.com/Andrew-mugwe/agroai/repository"
+	"github.com/google/uuid"
+)
+
+func TestListFilterDefaults(t *testing.T) {
+	filter, page := ListFilter{}.productFilter()
+	if page.Limit != 12 || page.Cursor != nil {
+		t.Fatalf("expected a first page of 12, got %+v", page)
+	}
+	if filter.Active == nil || !*filter.Active {
+		t.Fatalf("public listings must be restricted to active products")
+	}
+	if filter.SellerID != nil {
+		t.Fatalf("expected no seller filter")
+	}
+
+	_, page = ListFilter{Page: pagination.Params{Limit: 500}}.productFilter()
+	if page.Limit != pagination.MaxLimit {
+		t.Fatalf("expected oversized limit to be capped at %d, got %d", pagination.MaxLimit, page.Limit)
+	}
+}
+
+func TestListFilterMapping(t *testing.T) {
+	sellerID := uuid.New()
+	minPrice, maxPrice := int64(100), int64(5000)
+	cursor := &pagination.Cursor{Key: "5000", ID: uuid.NewString(), Sort: repository.ProductSortPriceAsc}
+	filter, page := ListFilter{
+		Page:     pagination.Params{Limit: 20, Cursor: cursor},
+		Category: "seeds",
+		MinPrice: &minPrice,
+		MaxPrice: &maxPrice,
+		Query:    "  maize  ",
+		SellerID: sellerID.String(),
+		Sort:     repository.ProductSortPriceAsc,
+	}.productFilter()
+
+	if page.Limit != 20 || page.Cursor != cursor {
+		t.Fatalf("unexpected paging: %+v", page)
+	}
+	if filter.SellerID == nil || *filter.SellerID != sellerID {
+		t.Fatalf("expected seller filter %s", sellerID)
+	}
+	if filter.Query != "maize" {
+		t.Fatalf("expected trimmed query, got %q", filter.Query)
+	}
+	if *filter.MinPriceCents != 100 || *filter.MaxPriceCents != 5000 {
+		t.Fatalf("unexpected price range")
+	}
+	if filter.Category != "seeds" || filter.Sort != repository.ProductSortPriceAsc {
+		t.Fatalf("unexpected category or sort")
+	}
+
+	filter, _ = ListFilter{SellerID: "not-a-uuid"}.productFilter()
+	if filter.SellerID != nil {
+		t.Fatalf("expected invalid seller ID to be ignored by the mapping")
+	}
 }
 
+func TestListFilterUnitComparesInBaseUnit(t *testing.T) {
+	cases := map[string]models.UnitOfMeasure{
+		"kg":       models.UnitKilogram,
+		"G":        models.UnitKilogram,
+		"ml":       models.UnitLitre,
+		"seedling": models.UnitSeedling,
+		"bushel":   "",
+	}
+	for unit, want := range cases {
+		filter, _ := ListFilter{Unit: unit, Sort: repository.ProductSortUnitPriceAsc}.productFilter()
+		if filter.BaseUnit != want {
+			t.Fatalf("unit %q: expected base unit %q, got %q", unit, want, filter.BaseUnit)
+		}
+	}
+}
+
+func TestFacetFiltersUseSearch(t *testing.T) {
+	if (ListFilter{Category: "seeds", Sort: repository.ProductSortPriceAsc}).needsSearch() {
+		t.Fatalf("plain catalogue filters should not need search")
+	}
 
+	inStock := true
+	f := ListFilter{Query: " mbolea ", Location: "Nakuru", InStock: &inStock, Unit: "g", Page: pagination.Params{Limit: 10}}
+	if !f.needsSearch() {
+		t.Fatalf("text and facet filters should use search")
+	}
+
+	q := f.searchQuery()
+	if q.Text != "mbolea" || q.Location != "Nakuru" || q.InStock == nil || !*q.InStock {
+		t.Fatalf("unexpected search query: %+v", q)
+	}
+	if q.BaseUnit != models.UnitKilogram || q.Page.Limit != 10 {
+		t.Fatalf("unexpected unit or paging: %+v", q)
+	}
+}
+
+func TestListFilterNearMapping(t *testing.T) {
+	lat, lng := -1.2921, 36.8219
+	filter, _ := ListFilter{Lat: &lat, Lng: &lng, RadiusKm: 5000, DeliversTo: true, Sort: repository.ProductSortDistance}.productFilter()
+	if filter.Near == nil || filter.Near.Lat != lat || filter.Near.Lng != lng {
+		t.Fatalf("expected buyer location to be mapped, got %+v", filter.Near)
+	}
+	if filter.RadiusKm != models.MaxSearchRadiusKm || !filter.DeliversTo {
+		t.Fatalf("expected radius capped at %d and delivery filter set, got %v %v", models.MaxSearchRadiusKm, filter.RadiusKm, filter.DeliversTo)
+	}
+
+	badLat := 120.0
+	filter, _ = ListFilter{Lat: &badLat, Lng: &lng, RadiusKm: 10}.productFilter()
+	if filter.Near != nil || filter.RadiusKm != 0 {
+		t.Fatalf("expected an invalid location to be ignored")
+	}
+}
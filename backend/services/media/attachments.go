@@ -0,0 +1,555 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/Andrew-mugwe/agroai/models"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// Attachment limits by kind. Images are re-encoded, so their stored size
+// is usually far below the upload limit.
+const (
+	MaxAttachmentSize        = 20 << 20 // 20 MB, the largest of the limits below
+	maxDocumentSize          = 20 << 20
+	maxVoiceSize             = 10 << 20
+	MaxAttachmentsPerMessage = 10
+
+	// attachmentBound bounds the longer side of stored image attachments,
+	// and thumbnailBound that of their thumbnails
+	attachmentBound = 1600
+	thumbnailBound  = 200
+
+	// unlinkedTTL is how long an upload waits for a message to reference it
+	unlinkedTTL = 24 * time.Hour
+
+	maxFileNameLength = 120
+)
+
+// Attachment errors
+var (
+	ErrUnsupportedAttachment = errors.New("unsupported file: attach a JPEG, PNG or GIF image, a PDF or a voice note")
+	ErrAttachmentTooLarge    = errors.New("attachment is too large")
+	// ErrAttachmentRejected is returned for files the scanner flags or
+	// PDFs with scripts, launch actions or embedded files
+	ErrAttachmentRejected = errors.New("attachment was rejected by the content scanner")
+	// ErrAttachmentNotFound is returned for missing attachments and
+	// attachments outside the user's threads
+	ErrAttachmentNotFound = errors.New("attachment not found")
+	// ErrAttachmentUnavailable is returned when a message references an
+	// attachment that is not the sender's, belongs elsewhere or was sent
+	ErrAttachmentUnavailable = errors.New("attachment not found or already sent")
+	ErrNotMember             = errors.New("not a participant in this conversation")
+)
+
+// attachmentType describes a recognised file format
+type attachmentType struct {
+	kind        models.AttachmentKind
+	contentType string
+	ext         string
+}
+
+var (
+	pdfType  = attachmentType{models.AttachmentDocument, "application/pdf", "pdf"}
+	oggType  = attachmentType{models.AttachmentVoice, "audio/ogg", "ogg"}
+	webmType = attachmentType{models.AttachmentVoice, "audio/webm", "webm"}
+	m4aType  = attachmentType{models.AttachmentVoice, "audio/mp4", "m4a"}
+	gppType  = attachmentType{models.AttachmentVoice, "audio/3gpp", "3gp"}
+	mp3Type  = attachmentType{models.AttachmentVoice, "audio/mpeg", "mp3"}
+	amrType  = attachmentType{models.AttachmentVoice, "audio/amr", "amr"}
+	wavType  = attachmentType{models.AttachmentVoice, "audio/wav", "wav"}
+)
+
+// sniffAttachment identifies a non-image attachment by its magic bytes.
+// Voice notes come from browser recorders (Ogg, WebM, MP4) and phones
+// (AMR, MP3, WAV).
+func sniffAttachment(data []byte) (attachmentType, bool) {
+	switch {
+	case bytes.HasPrefix(data, []byte("%PDF-")):
+		return pdfType, true
+	case bytes.HasPrefix(data, []byte("OggS")):
+		return oggType, true
+	case bytes.HasPrefix(data, []byte{0x1A, 0x45, 0xDF, 0xA3}):
+		return webmType, true
+	case len(data) >= 12 && bytes.Equal(data[4:8], []byte("ftyp")):
+		// ISO media is also used for video and HEIC photos, so only audio
+		// and generic brands are accepted
+		switch string(data[8:12]) {
+		case "M4A ", "mp41", "mp42", "isom":
+			return m4aType, true
+		case "3gp4", "3gp5", "3gp6", "3gpp":
+			return gppType, true
+		}
+	case bytes.HasPrefix(data, []byte("ID3")),
+		len(data) >= 2 && data[0] == 0xFF && data[1]&0xE0 == 0xE0:
+		return mp3Type, true
+	case bytes.HasPrefix(data, []byte("#!AMR")):
+		return amrType, true
+	case len(data) >= 12 && bytes.Equal(data[:4], []byte("RIFF")) && bytes.Equal(data[8:12], []byte("WAVE")):
+		return wavType, true
+	}
+	return attachmentType{}, false
+}
+
+// activePDF matches PDF names that run code or carry other files
+var activePDF = regexp.MustCompile(`/(?:JavaScript|JS|Launch|EmbeddedFiles?|RichMedia)[\s/<(\[>]`)
+
+// Scanner checks uploads for malware before they are stored
+type Scanner interface {
+	// Scan returns an error wrapping ErrAttachmentRejected for infected
+	// files, and any other error when the file could not be scanned
+	Scan(ctx context.Context, data []byte) error
+}
+
+// AttachmentScope is the conversation an upload belongs to, by its thread
+// reference or by the integer ID the /api/messages adapter addresses it by
+type AttachmentScope struct {
+	ThreadRef      string
+	ConversationID int
+}
+
+// AttachmentService stores message attachments. Uploads are validated by
+// their content, scanned, and kept private to the thread they were
+// uploaded to; messages then reference them by ID.
+type AttachmentService struct {
+	db      *sql.DB
+	storage Storage
+	scanner Scanner
+	ttl     time.Duration
+	now     func() time.Time
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	once   sync.Once
+}
+
+// NewAttachmentService creates an attachment service. Signed URLs last
+// for ttl.
+func NewAttachmentService(db *sql.DB, storage Storage, ttl time.Duration) *AttachmentService {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &AttachmentService{
+		db:      db,
+		storage: storage,
+		ttl:     ttl,
+		now:     time.Now,
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+}
+
+// SetScanner scans every upload before it is stored
+func (s *AttachmentService) SetScanner(scanner Scanner) {
+	s.scanner = scanner
+}
+
+// Upload validates, scans and stores a file for a thread the owner
+// participates in. It can then be sent in one of its messages.
+func (s *AttachmentService) Upload(ctx context.Context, ownerID uuid.UUID, scope AttachmentScope, fileName string, data []byte) (*models.Attachment, error) {
+	attachment := &models.Attachment{ID: uuid.New(), OwnerID: ownerID}
+	if err := s.resolveScope(ctx, ownerID, scope, attachment); err != nil {
+		return nil, err
+	}
+
+	if err := s.prepare(ctx, attachment, fileName, data); err != nil {
+		return nil, err
+	}
+
+	err := s.db.QueryRowContext(ctx, `
+		INSERT INTO message_attachments (
+			id, owner_id, thread_id, kind, content_type, file_name,
+			size_bytes, width, height, storage_key, thumbnail_key
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		RETURNING created_at`,
+		attachment.ID, attachment.OwnerID, attachment.ThreadID, attachment.Kind, attachment.ContentType, attachment.FileName, attachment.SizeBytes,
+		attachment.Width, attachment.Height, attachment.Key, attachment.ThumbnailKey,
+	).Scan(&attachment.CreatedAt)
+	if err != nil {
+		s.removeAttachment(attachment)
+		return nil, fmt.Errorf("failed to save attachment: %w", err)
+	}
+
+	s.signAttachment(attachment)
+	return attachment, nil
+}
+
+// resolveScope sets the attachment's thread, checking the owner
+// participates in it
+func (s *AttachmentService) resolveScope(ctx context.Context, userID uuid.UUID, scope AttachmentScope, attachment *models.Attachment) error {
+	var where string
+	var ref interface{}
+	switch {
+	case scope.ThreadRef != "":
+		where, ref = "mt.thread_ref = $1", scope.ThreadRef
+	case scope.ConversationID != 0:
+		where, ref = "mt.legacy_conversation_id = $1", scope.ConversationID
+	default:
+		return errors.New("attachment needs a conversation")
+	}
+
+	var member bool
+	err := s.db.QueryRowContext(ctx, `
+		SELECT mt.id, EXISTS(
+			SELECT 1 FROM marketplace_thread_participants mtp
+			WHERE mtp.thread_id = mt.id AND mtp.user_id = $2
+		)
+		FROM marketplace_threads mt
+		WHERE `+where, ref, userID).Scan(&attachment.ThreadID, &member)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotMember
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check thread membership: %w", err)
+	}
+	if !member {
+		return ErrNotMember
+	}
+	return nil
+}
+
+// prepare validates the upload by its content and writes it to storage.
+// Images are re-encoded without their metadata and given a thumbnail;
+// PDFs and voice notes are stored as uploaded once scanned.
+func (s *AttachmentService) prepare(ctx context.Context, attachment *models.Attachment, fileName string, data []byte) error {
+	if len(data) == 0 {
+		return ErrUnsupportedAttachment
+	}
+	if len(data) > MaxAttachmentSize {
+		return fmt.Errorf("%w: the limit is %d MB", ErrAttachmentTooLarge, MaxAttachmentSize>>20)
+	}
+
+	if format := sniff(data); format != "" {
+		if len(data) > MaxUploadSize {
+			return fmt.Errorf("%w: images can be at most %d MB", ErrAttachmentTooLarge, MaxUploadSize>>20)
+		}
+		return s.prepareImage(ctx, attachment, fileName, data)
+	}
+
+	t, ok := sniffAttachment(data)
+	if !ok {
+		return ErrUnsupportedAttachment
+	}
+	if t.kind == models.AttachmentVoice && len(data) > maxVoiceSize {
+		return fmt.Errorf("%w: voice notes can be at most %d MB", ErrAttachmentTooLarge, maxVoiceSize>>20)
+	}
+	if t.kind == models.AttachmentDocument {
+		if len(data) > maxDocumentSize {
+			return fmt.Errorf("%w: documents can be at most %d MB", ErrAttachmentTooLarge, maxDocumentSize>>20)
+		}
+		if activePDF.Match(data) {
+			return fmt.Errorf("%w: PDFs with scripts, actions or embedded files are not accepted", ErrAttachmentRejected)
+		}
+	}
+	if err := s.scan(ctx, data); err != nil {
+		return err
+	}
+
+	attachment.Kind = t.kind
+	attachment.ContentType = t.contentType
+	attachment.FileName = cleanFileName(fileName, t.ext)
+	attachment.SizeBytes = int64(len(data))
+	attachment.Key = fmt.Sprintf("attachments/%s/file.%s", attachment.ID, t.ext)
+	if err := s.storage.Put(ctx, attachment.Key, data, t.contentType); err != nil {
+		return fmt.Errorf("failed to store attachment: %w", err)
+	}
+	return nil
+}
+
+func (s *AttachmentService) prepareImage(ctx context.Context, attachment *models.Attachment, fileName string, data []byte) error {
+	src, _, err := decode(data)
+	if errors.Is(err, ErrUnsupportedImage) {
+		return ErrUnsupportedAttachment
+	}
+	if errors.Is(err, ErrImageTooLarge) {
+		return fmt.Errorf("%w: %v", ErrAttachmentTooLarge, err)
+	}
+	if err != nil {
+		return err
+	}
+	if err := s.scan(ctx, data); err != nil {
+		return err
+	}
+
+	b := src.Bounds()
+	w, h := fit(b.Dx(), b.Dy(), attachmentBound)
+	encoded, format, err := encode(resize(src, w, h))
+	if err != nil {
+		return fmt.Errorf("failed to encode image: %w", err)
+	}
+	tw, th := fit(w, h, thumbnailBound)
+	thumbnail, thumbFormat, err := encode(resize(src, tw, th))
+	if err != nil {
+		return fmt.Errorf("failed to encode thumbnail: %w", err)
+	}
+
+	attachment.Kind = models.AttachmentImage
+	attachment.ContentType = contentTypes[format]
+	attachment.FileName = cleanFileName(fileName, extension(format))
+	attachment.SizeBytes = int64(len(encoded))
+	attachment.Width, attachment.Height = w, h
+	attachment.Key = fmt.Sprintf("attachments/%s/image.%s", attachment.ID, extension(format))
+	if err := s.storage.Put(ctx, attachment.Key, encoded, attachment.ContentType); err != nil {
+		return fmt.Errorf("failed to store image: %w", err)
+	}
+	attachment.ThumbnailKey = fmt.Sprintf("attachments/%s/thumb.%s", attachment.ID, extension(thumbFormat))
+	if err := s.storage.Put(ctx, attachment.ThumbnailKey, thumbnail, contentTypes[thumbFormat]); err != nil {
+		s.removeAttachment(attachment)
+		return fmt.Errorf("failed to store thumbnail: %w", err)
+	}
+	return nil
+}
+
+func (s *AttachmentService) scan(ctx context.Context, data []byte) error {
+	if s.scanner == nil {
+		return nil
+	}
+	if err := s.scanner.Scan(ctx, data); err != nil {
+		if errors.Is(err, ErrAttachmentRejected) {
+			return err
+		}
+		return fmt.Errorf("failed to scan attachment: %w", err)
+	}
+	return nil
+}
+
+func extension(format string) string {
+	if format == FormatJPEG {
+		return "jpg"
+	}
+	return format
+}
+
+// cleanFileName keeps the base name the client sent, for display and
+// downloads, with the extension of the detected format
+func cleanFileName(name, ext string) string {
+	name = path.Base(strings.ReplaceAll(name, "\\", "/"))
+	name = strings.TrimSuffix(name, path.Ext(name))
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || r == '"' || r == '/' || r == utf8.RuneError {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.TrimSpace(name)
+	if name == "" || name == "." {
+		name = "attachment"
+	}
+	if utf8.RuneCountInString(name) > maxFileNameLength {
+		name = string([]rune(name)[:maxFileNameLength])
+	}
+	return name + "." + ext
+}
+
+// Get returns an attachment with freshly signed URLs. Sent attachments
+// are visible to the participants of their thread, unsent ones only to
+// their owner.
+func (s *AttachmentService) Get(ctx context.Context, userID, id uuid.UUID) (*models.Attachment, error) {
+	var sent, member bool
+	row := s.db.QueryRowContext(ctx, attachmentSelect+`,
+			a.marketplace_message_id IS NOT NULL,
+			EXISTS(
+				SELECT 1 FROM marketplace_thread_participants mtp
+				WHERE mtp.thread_id = a.thread_id AND mtp.user_id = $2
+			)
+		FROM message_attachments a
+		WHERE a.id = $1`, id, userID)
+	attachment, err := scanAttachment(row, &sent, &member)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrAttachmentNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get attachment: %w", err)
+	}
+
+	if !member || (!sent && attachment.OwnerID != userID) {
+		return nil, ErrAttachmentNotFound
+	}
+	s.signAttachment(attachment)
+	return attachment, nil
+}
+
+// LinkToThreadMessage references the sender's unsent thread uploads from
+// a message, as part of the transaction inserting it
+func (s *AttachmentService) LinkToThreadMessage(ctx context.Context, tx *sql.Tx, ownerID uuid.UUID, threadID, messageID int, ids []uuid.UUID) error {
+	ids = uniqueIDs(ids)
+	if len(ids) == 0 {
+		return nil
+	}
+	if len(ids) > MaxAttachmentsPerMessage {
+		return fmt.Errorf("%w: a message can have at most %d attachments", ErrAttachmentUnavailable, MaxAttachmentsPerMessage)
+	}
+
+	res, err := tx.ExecContext(ctx, `
+		UPDATE message_attachments SET marketplace_message_id = $1
+		WHERE id = ANY($2::uuid[]) AND owner_id = $3 AND thread_id = $4
+			AND marketplace_message_id IS NULL`,
+		messageID, pq.Array(ids), ownerID, threadID)
+	if err != nil {
+		return fmt.Errorf("failed to attach files: %w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil || n != int64(len(ids)) {
+		return ErrAttachmentUnavailable
+	}
+	return nil
+}
+
+func uniqueIDs(ids []uuid.UUID) []uuid.UUID {
+	seen := make(map[uuid.UUID]bool, len(ids))
+	out := make([]uuid.UUID, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+// ThreadMessageAttachments loads the attachments of messages, keyed by
+// message ID, in upload order
+func (s *AttachmentService) ThreadMessageAttachments(ctx context.Context, messageIDs []int) (map[int][]*models.Attachment, error) {
+	out := make(map[int][]*models.Attachment)
+	if len(messageIDs) == 0 {
+		return out, nil
+	}
+
+	rows, err := s.db.QueryContext(ctx, attachmentSelect+`, a.marketplace_message_id
+		FROM message_attachments a
+		WHERE a.marketplace_message_id = ANY($1::int[])
+		ORDER BY a.created_at, a.id`, pq.Array(messageIDs))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load attachments: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var messageID int
+		attachment, err := scanAttachment(rows, &messageID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan attachment: %w", err)
+		}
+		s.signAttachment(attachment)
+		out[messageID] = append(out[messageID], attachment)
+	}
+	return out, rows.Err()
+}
+
+const attachmentSelect = `
+		SELECT a.id, a.owner_id, a.thread_id, a.kind, a.content_type,
+			a.file_name, a.size_bytes, a.width, a.height, a.storage_key, a.thumbnail_key, a.created_at`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanAttachment reads the attachmentSelect columns, then extra
+func scanAttachment(row rowScanner, extra ...interface{}) (*models.Attachment, error) {
+	var a models.Attachment
+	dest := []interface{}{
+		&a.ID, &a.OwnerID, &a.ThreadID, &a.Kind, &a.ContentType,
+		&a.FileName, &a.SizeBytes, &a.Width, &a.Height, &a.Key, &a.ThumbnailKey, &a.CreatedAt,
+	}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// signAttachment sets the attachment's URLs, leaving them empty if they
+// cannot be signed
+func (s *AttachmentService) signAttachment(attachment *models.Attachment) {
+	for _, obj := range []struct {
+		key string
+		url *string
+	}{
+		{attachment.Key, &attachment.URL},
+		{attachment.ThumbnailKey, &attachment.ThumbnailURL},
+	} {
+		if obj.key == "" {
+			continue
+		}
+		url, err := s.storage.SignedURL(obj.key, s.ttl)
+		if err != nil {
+			log.Printf("media: failed to sign %s: %v", obj.key, err)
+			continue
+		}
+		*obj.url = url
+	}
+}
+
+// removeAttachment deletes an attachment's stored objects, logging
+// failures
+func (s *AttachmentService) removeAttachment(attachment *models.Attachment) {
+	for _, key := range []string{attachment.Key, attachment.ThumbnailKey} {
+		if key == "" {
+			continue
+		}
+		if err := s.storage.Delete(context.Background(), key); err != nil {
+			log.Printf("media: failed to delete %s: %v", key, err)
+		}
+	}
+}
+
+// PurgeUnlinked deletes uploads no message referenced within a day
+func (s *AttachmentService) PurgeUnlinked(ctx context.Context) (int, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		DELETE FROM message_attachments
+		WHERE marketplace_message_id IS NULL AND created_at < $1
+		RETURNING storage_key, thumbnail_key`, s.now().Add(-unlinkedTTL))
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge attachments: %w", err)
+	}
+	defer rows.Close()
+
+	purged := 0
+	for rows.Next() {
+		var attachment models.Attachment
+		if err := rows.Scan(&attachment.Key, &attachment.ThumbnailKey); err != nil {
+			return purged, fmt.Errorf("failed to scan attachment: %w", err)
+		}
+		s.removeAttachment(&attachment)
+		purged++
+	}
+	return purged, rows.Err()
+}
+
+// Start purges unsent uploads every interval in the background
+func (s *AttachmentService) Start(interval time.Duration) {
+	s.once.Do(func() {
+		go func() {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-s.ctx.Done():
+					return
+				case <-ticker.C:
+					if n, err := s.PurgeUnlinked(s.ctx); err != nil {
+						log.Printf("media: attachment purge failed: %v", err)
+					} else if n > 0 {
+						log.Printf("media: purged %d unsent attachments", n)
+					}
+				}
+			}
+		}()
+	})
+}
+
+// Stop stops the background purge
+func (s *AttachmentService) Stop() {
+	s.cancel()
+}
@@ -0,0 +1,228 @@
+package media
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image/jpeg"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Andrew-mugwe/agroai/models"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestAttachments(t *testing.T) (*AttachmentService, string) {
+	t.Helper()
+	root := t.TempDir()
+	return NewAttachmentService(nil, NewLocalStorage(root, "/media", "test-secret"), time.Hour), root
+}
+
+func TestSniffAttachment(t *testing.T) {
+	for name, tc := range map[string]struct {
+		data []byte
+		want attachmentType
+	}{
+		"pdf":            {[]byte("%PDF-1.7\n"), pdfType},
+		"ogg opus":       {[]byte("OggS\x00\x02\x00\x00"), oggType},
+		"webm recording": {[]byte{0x1A, 0x45, 0xDF, 0xA3, 0x9F, 0x42, 0x86, 0x81}, webmType},
+		"m4a":            {[]byte("\x00\x00\x00\x1cftypM4A \x00\x00\x00\x00"), m4aType},
+		"3gp":            {[]byte("\x00\x00\x00\x18ftyp3gp4\x00\x00\x00\x00"), gppType},
+		"mp3":            {[]byte("ID3\x04\x00\x00"), mp3Type},
+		"amr":            {[]byte("#!AMR\n"), amrType},
+		"wav":            {[]byte("RIFF\x24\x00\x00\x00WAVEfmt "), wavType},
+	} {
+		got, ok := sniffAttachment(tc.data)
+		assert.True(t, ok, name)
+		assert.Equal(t, tc.want, got, name)
+	}
+
+	for name, data := range map[string][]byte{
+		"heic photo": []byte("\x00\x00\x00\x18ftypheic\x00\x00\x00\x00"),
+		"zip":        []byte("PK\x03\x04"),
+		"script":     []byte("#!/bin/sh\n"),
+		"html":       []byte("<html><script>"),
+	} {
+		_, ok := sniffAttachment(data)
+		assert.False(t, ok, name)
+	}
+}
+
+func TestPrepareImageAttachment(t *testing.T) {
+	svc, root := newTestAttachments(t)
+	attachment := &models.Attachment{ID: uuid.New()}
+
+	err := svc.prepare(context.Background(), attachment, `C:\Users\wanjiru\DCIM\maize leaf.jpeg`, withEXIF(testJPEG(t, 2000, 1000), 6))
+	require.NoError(t, err)
+
+	assert.Equal(t, models.AttachmentImage, attachment.Kind)
+	assert.Equal(t, "image/jpeg", attachment.ContentType)
+	assert.Equal(t, "maize leaf.jpg", attachment.FileName)
+	assert.Equal(t, 800, attachment.Width)
+	assert.Equal(t, 1600, attachment.Height)
+
+	for key, size := range map[string][2]int{
+		attachment.Key:          {800, 1600},
+		attachment.ThumbnailKey: {100, 200},
+	} {
+		stored, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(key)))
+		require.NoError(t, err)
+		assert.NotContains(t, string(stored), "GPS", key)
+
+		cfg, err := jpeg.DecodeConfig(bytes.NewReader(stored))
+		require.NoError(t, err)
+		assert.Equal(t, size, [2]int{cfg.Width, cfg.Height}, key)
+	}
+}
+
+func TestPrepareStoresDocumentsAndVoiceNotes(t *testing.T) {
+	svc, root := newTestAttachments(t)
+	ctx := context.Background()
+
+	voice := append([]byte("OggS\x00\x02"), make([]byte, 1024)...)
+	attachment := &models.Attachment{ID: uuid.New()}
+	require.NoError(t, svc.prepare(ctx, attachment, "recording", voice))
+	assert.Equal(t, models.AttachmentVoice, attachment.Kind)
+	assert.Equal(t, "recording.ogg", attachment.FileName)
+	assert.Empty(t, attachment.ThumbnailKey)
+	stored, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(attachment.Key)))
+	require.NoError(t, err)
+	assert.Equal(t, voice, stored)
+
+	// The extension follows the content, not the name
+	invoice := &models.Attachment{ID: uuid.New()}
+	require.NoError(t, svc.prepare(ctx, invoice, "invoice.exe", []byte("%PDF-1.4\n1 0 obj << /Type /Catalog >>\n%%EOF")))
+	assert.Equal(t, models.AttachmentDocument, invoice.Kind)
+	assert.Equal(t, "invoice.pdf", invoice.FileName)
+}
+
+func TestPrepareRejectsUnsafeUploads(t *testing.T) {
+	svc, root := newTestAttachments(t)
+	ctx := context.Background()
+
+	for name, tc := range map[string]struct {
+		data []byte
+		want error
+	}{
+		"empty":          {nil, ErrUnsupportedAttachment},
+		"executable":     {[]byte("MZ\x90\x00"), ErrUnsupportedAttachment},
+		"webp":           {[]byte("RIFF\x10\x00\x00\x00WEBPVP8 "), ErrUnsupportedAttachment},
+		"pdf javascript": {[]byte("%PDF-1.4\n<< /OpenAction << /S /JavaScript /JS (app.alert(1)) >> >>"), ErrAttachmentRejected},
+		"pdf launch":     {[]byte("%PDF-1.4\n<< /S /Launch /F (cmd.exe) >>"), ErrAttachmentRejected},
+		"too large":      {make([]byte, MaxAttachmentSize+1), ErrAttachmentTooLarge},
+		"long voice":     {append([]byte("OggS"), make([]byte, maxVoiceSize)...), ErrAttachmentTooLarge},
+	} {
+		err := svc.prepare(ctx, &models.Attachment{ID: uuid.New()}, "upload", tc.data)
+		assert.ErrorIs(t, err, tc.want, name)
+	}
+
+	entries, err := os.ReadDir(root)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+type fakeScanner struct{ err error }
+
+func (f fakeScanner) Scan(ctx context.Context, data []byte) error { return f.err }
+
+func TestPrepareScansUploads(t *testing.T) {
+	svc, root := newTestAttachments(t)
+	ctx := context.Background()
+	pdf := []byte("%PDF-1.4\n%%EOF")
+
+	svc.SetScanner(fakeScanner{fmt.Errorf("%w: Eicar-Test-Signature", ErrAttachmentRejected)})
+	err := svc.prepare(ctx, &models.Attachment{ID: uuid.New()}, "a.pdf", pdf)
+	assert.ErrorIs(t, err, ErrAttachmentRejected)
+
+	// A scanner that cannot be reached fails the upload rather than
+	// letting it through unscanned
+	svc.SetScanner(fakeScanner{errors.New("connection refused")})
+	err = svc.prepare(ctx, &models.Attachment{ID: uuid.New()}, "a.pdf", pdf)
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, ErrAttachmentRejected)
+
+	entries, err := os.ReadDir(root)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestCleanFileName(t *testing.T) {
+	assert.Equal(t, "receipt.pdf", cleanFileName("../../etc/receipt.PDF", "pdf"))
+	assert.Equal(t, "attachment.ogg", cleanFileName("", "ogg"))
+	assert.Equal(t, "voice note.ogg", cleanFileName("voice\x00 \"note\".webm", "ogg"))
+	assert.Len(t, []rune(cleanFileName(string(bytes.Repeat([]byte("ñ"), 300)), "pdf")), maxFileNameLength+4)
+}
+
+func TestContentTypeOfAttachments(t *testing.T) {
+	assert.Equal(t, "application/pdf", ContentType(".pdf"))
+	assert.Equal(t, "audio/ogg", ContentType(".ogg"))
+	assert.Equal(t, "image/jpeg", ContentType(".jpg"))
+	assert.Equal(t, "application/octet-stream", ContentType(".html"))
+}
+
+// fakeClamd answers one INSTREAM request with reply, recording the
+// streamed file
+func fakeClamd(t *testing.T, reply string) (string, <-chan []byte) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+
+	received := make(chan []byte, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		if cmd, err := r.ReadString(0); err != nil || cmd != "zINSTREAM\x00" {
+			return
+		}
+		var file []byte
+		for {
+			var size uint32
+			if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+				return
+			}
+			if size == 0 {
+				break
+			}
+			chunk := make([]byte, size)
+			if _, err := io.ReadFull(r, chunk); err != nil {
+				return
+			}
+			file = append(file, chunk...)
+		}
+		received <- file
+		conn.Write([]byte(reply + "\x00"))
+	}()
+	return ln.Addr().String(), received
+}
+
+func TestClamdScanner(t *testing.T) {
+	data := bytes.Repeat([]byte("x"), clamdChunkSize*2+10)
+
+	addr, received := fakeClamd(t, "stream: OK")
+	require.NoError(t, NewClamdScanner(addr, time.Second).Scan(context.Background(), data))
+	assert.Equal(t, data, <-received)
+
+	addr, _ = fakeClamd(t, "stream: Eicar-Test-Signature FOUND")
+	err := NewClamdScanner(addr, time.Second).Scan(context.Background(), []byte("X5O!P%@AP"))
+	assert.ErrorIs(t, err, ErrAttachmentRejected)
+	assert.Contains(t, err.Error(), "Eicar-Test-Signature")
+
+	addr, _ = fakeClamd(t, "INSTREAM size limit exceeded. ERROR")
+	err = NewClamdScanner(addr, time.Second).Scan(context.Background(), []byte("data"))
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, ErrAttachmentRejected)
+}
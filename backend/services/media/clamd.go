@@ -0,0 +1,80 @@
+package media
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// clamdChunkSize is the size of the chunks streamed to clamd, well below
+// its default StreamMaxLength
+const clamdChunkSize = 64 << 10
+
+// ClamdScanner scans uploads with a ClamAV daemon over TCP, using its
+// INSTREAM command
+type ClamdScanner struct {
+	addr    string
+	timeout time.Duration
+}
+
+// NewClamdScanner scans with the clamd listening on addr, e.g.
+// "localhost:3310"
+func NewClamdScanner(addr string, timeout time.Duration) *ClamdScanner {
+	return &ClamdScanner{addr: addr, timeout: timeout}
+}
+
+// Scan streams data to clamd and reads its verdict
+func (c *ClamdScanner) Scan(ctx context.Context, data []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", c.addr)
+	if err != nil {
+		return fmt.Errorf("failed to reach clamd: %w", err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	w := bufio.NewWriter(conn)
+	w.WriteString("zINSTREAM\x00")
+	var size [4]byte
+	for len(data) > 0 {
+		chunk := data[:min(len(data), clamdChunkSize)]
+		data = data[len(chunk):]
+		binary.BigEndian.PutUint32(size[:], uint32(len(chunk)))
+		w.Write(size[:])
+		w.Write(chunk)
+	}
+	binary.BigEndian.PutUint32(size[:], 0)
+	w.Write(size[:])
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("failed to send file to clamd: %w", err)
+	}
+
+	reply, err := bufio.NewReader(conn).ReadBytes(0)
+	if err != nil && len(reply) == 0 {
+		return fmt.Errorf("failed to read clamd reply: %w", err)
+	}
+	return clamdVerdict(string(bytes.TrimRight(reply, "\x00\n")))
+}
+
+// clamdVerdict interprets a reply such as "stream: OK" or
+// "stream: Eicar-Test-Signature FOUND"
+func clamdVerdict(reply string) error {
+	result := strings.TrimSpace(strings.TrimPrefix(reply, "stream:"))
+	switch {
+	case result == "OK":
+		return nil
+	case strings.HasSuffix(result, " FOUND"):
+		return fmt.Errorf("%w: %s", ErrAttachmentRejected, strings.TrimSuffix(result, " FOUND"))
+	}
+	return fmt.Errorf("clamd: %s", reply)
+}
@@ -0,0 +1,291 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+)
+
+// Upload limits. Dimensions are checked from the header before the pixels
+// are decoded, so a small file cannot expand into a huge bitmap.
+const (
+	MaxUploadSize = 10 << 20 // 10 MB
+	maxPixels     = 40_000_000
+)
+
+// Image formats recognised by their leading bytes
+const (
+	FormatJPEG = "jpeg"
+	FormatPNG  = "png"
+	FormatGIF  = "gif"
+	FormatWebP = "webp"
+)
+
+// Upload errors
+var (
+	ErrUnsupportedImage = errors.New("unsupported image: upload a JPEG, PNG or GIF")
+	ErrImageTooLarge    = errors.New("image is too large")
+)
+
+// contentTypes maps formats to the Content-Type they are served with
+var contentTypes = map[string]string{
+	FormatJPEG: "image/jpeg",
+	FormatPNG:  "image/png",
+	FormatGIF:  "image/gif",
+	FormatWebP: "image/webp",
+}
+
+// ContentType returns the Content-Type of a stored rendition or
+// attachment from its file extension
+func ContentType(ext string) string {
+	switch ext {
+	case ".jpg":
+		return contentTypes[FormatJPEG]
+	case ".png", ".gif", ".webp":
+		return contentTypes[ext[1:]]
+	}
+	for _, t := range []attachmentType{pdfType, oggType, webmType, m4aType, gppType, mp3Type, amrType, wavType} {
+		if ext == "."+t.ext {
+			return t.contentType
+		}
+	}
+	return "application/octet-stream"
+}
+
+// sniff identifies an image by its magic bytes, ignoring the file name
+// and the client's Content-Type
+func sniff(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xFF, 0xD8, 0xFF}):
+		return FormatJPEG
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		return FormatPNG
+	case bytes.HasPrefix(data, []byte("GIF87a")), bytes.HasPrefix(data, []byte("GIF89a")):
+		return FormatGIF
+	case len(data) >= 12 && bytes.Equal(data[:4], []byte("RIFF")) && bytes.Equal(data[8:12], []byte("WEBP")):
+		return FormatWebP
+	}
+	return ""
+}
+
+// decode validates and decodes an upload. WebP is recognised but the
+// standard library cannot decode it, so it is refused like any other
+// unsupported format. JPEGs are turned upright using their EXIF
+// orientation, since re-encoding drops the EXIF block.
+func decode(data []byte) (image.Image, string, error) {
+	format := sniff(data)
+	if format == "" || format == FormatWebP {
+		return nil, "", ErrUnsupportedImage
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %v", ErrUnsupportedImage, err)
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width*cfg.Height > maxPixels {
+		return nil, "", fmt.Errorf("%w: %dx%d pixels", ErrImageTooLarge, cfg.Width, cfg.Height)
+	}
+
+	var img image.Image
+	switch format {
+	case FormatJPEG:
+		img, err = jpeg.Decode(bytes.NewReader(data))
+	case FormatPNG:
+		img, err = png.Decode(bytes.NewReader(data))
+	case FormatGIF:
+		// Only the first frame of an animation is kept
+		img, err = gif.Decode(bytes.NewReader(data))
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %v", ErrUnsupportedImage, err)
+	}
+
+	if format == FormatJPEG {
+		img = orient(img, exifOrientation(data))
+	}
+	return img, format, nil
+}
+
+// exifOrientation reads the orientation tag (0x0112) from a JPEG's EXIF
+// block, returning 1 (upright) when there is none
+func exifOrientation(data []byte) int {
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return 1
+		}
+		marker := data[i+1]
+		if marker == 0xDA || marker == 0xD9 { // start of scan, end of image
+			return 1
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		end := i + 2 + length
+		if length < 2 || end > len(data) {
+			return 1
+		}
+		segment := data[i+4 : end]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return tiffOrientation(segment[6:])
+		}
+		i = end
+	}
+	return 1
+}
+
+// tiffOrientation finds the orientation in the first IFD of a TIFF header
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd+2 > len(tiff) {
+		return 1
+	}
+	entries := int(order.Uint16(tiff[ifd:]))
+	for n := 0; n < entries; n++ {
+		entry := ifd + 2 + n*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			if v := int(order.Uint16(tiff[entry+8:])); v >= 1 && v <= 8 {
+				return v
+			}
+			return 1
+		}
+	}
+	return 1
+}
+
+// orient applies an EXIF orientation so the image displays upright
+func orient(src image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return src
+	}
+
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	dw, dh := w, h
+	if orientation >= 5 { // the transposing orientations swap the axes
+		dw, dh = h, w
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2:
+				dx, dy = w-1-x, y
+			case 3:
+				dx, dy = w-1-x, h-1-y
+			case 4:
+				dx, dy = x, h-1-y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = h-1-y, x
+			case 7:
+				dx, dy = h-1-y, w-1-x
+			case 8:
+				dx, dy = y, w-1-x
+			}
+			dst.Set(dx, dy, src.At(b.Min.X+x, b.Min.Y+y))
+		}
+	}
+	return dst
+}
+
+// fit returns the size of w×h scaled down to fit within a square of side
+// bound, keeping the aspect ratio. Images are never enlarged.
+func fit(w, h, bound int) (int, int) {
+	if w <= bound && h <= bound {
+		return w, h
+	}
+	if w >= h {
+		return bound, max(1, h*bound/w)
+	}
+	return max(1, w*bound/h), bound
+}
+
+// resize scales src down to w×h by averaging the source pixels each
+// destination pixel covers. Averaging in premultiplied RGBA keeps
+// transparent edges from darkening.
+func resize(src image.Image, w, h int) *image.RGBA {
+	b := src.Bounds()
+	rgba, ok := src.(*image.RGBA)
+	if !ok || rgba.Bounds().Min != (image.Point{}) {
+		rgba = image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+		draw.Draw(rgba, rgba.Bounds(), src, b.Min, draw.Src)
+	}
+	sw, sh := rgba.Bounds().Dx(), rgba.Bounds().Dy()
+	if sw == w && sh == h {
+		return rgba
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		y0, y1 := y*sh/h, max((y+1)*sh/h, y*sh/h+1)
+		for x := 0; x < w; x++ {
+			x0, x1 := x*sw/w, max((x+1)*sw/w, x*sw/w+1)
+
+			var r, g, bl, a, n uint32
+			for sy := y0; sy < y1; sy++ {
+				row := rgba.Pix[sy*rgba.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					p := row[sx*4 : sx*4+4]
+					r += uint32(p[0])
+					g += uint32(p[1])
+					bl += uint32(p[2])
+					a += uint32(p[3])
+					n++
+				}
+			}
+			dst.SetRGBA(x, y, color.RGBA{uint8(r / n), uint8(g / n), uint8(bl / n), uint8(a / n)})
+		}
+	}
+	return dst
+}
+
+// opaque reports whether every pixel is fully opaque
+func opaque(img *image.RGBA) bool {
+	for i := 3; i < len(img.Pix); i += 4 {
+		if img.Pix[i] != 0xFF {
+			return false
+		}
+	}
+	return true
+}
+
+// encode writes a rendition as JPEG, or as PNG when it has transparency.
+// Neither encoder writes metadata, which is what strips EXIF (including
+// GPS) from uploads.
+func encode(img *image.RGBA) ([]byte, string, error) {
+	var buf bytes.Buffer
+	if opaque(img) {
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 82}); err != nil {
+			return nil, "", err
+		}
+		return buf.Bytes(), FormatJPEG, nil
+	}
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), FormatPNG, nil
+}
@@ -0,0 +1,332 @@
+package media
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"log"
+	"time"
+
+	"github.com/Andrew-mugwe/agroai/config"
+	"github.com/Andrew-mugwe/agroai/models"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// ErrAssetNotFound is returned for missing assets and assets owned by
+// someone else
+var ErrAssetNotFound = errors.New("media asset not found")
+
+// renditions are the sizes generated for every upload, bounding the longer
+// side. Thumbnails keep listing pages light on slow rural connections.
+var renditions = []struct {
+	name  string
+	bound int
+}{
+	{models.MediaVariantLarge, 1280},
+	{models.MediaVariantMedium, 640},
+	{models.MediaVariantThumb, 200},
+}
+
+// Service validates image uploads, generates their renditions and signs
+// the URLs they are served from
+type Service struct {
+	db      *sql.DB
+	storage Storage
+	webp    WebPEncoder
+	ttl     time.Duration
+}
+
+// NewService creates a media service. Signed URLs last for ttl.
+func NewService(db *sql.DB, storage Storage, ttl time.Duration) *Service {
+	return &Service{db: db, storage: storage, ttl: ttl}
+}
+
+// UseWebP adds a WebP rendition alongside each JPEG or PNG one
+func (s *Service) UseWebP(enc WebPEncoder) {
+	s.webp = enc
+}
+
+// NewStorage builds the storage backend named by MediaConfig.Storage.
+// Local URLs are signed for the serving route mounted at baseURL.
+func NewStorage(cfg config.MediaConfig, aws config.AWSConfig, baseURL string) (Storage, error) {
+	switch cfg.Storage {
+	case "", "local":
+		return NewLocalStorage(cfg.LocalDir, baseURL, cfg.SigningSecret), nil
+	case "s3":
+		return NewS3Storage(aws)
+	}
+	return nil, fmt.Errorf("unknown media storage %q", cfg.Storage)
+}
+
+// storedVariant is a variant as persisted, including its storage key
+type storedVariant struct {
+	models.MediaVariant
+	Key string `json:"key"`
+}
+
+// Upload validates an image by its content, strips its metadata and
+// stores the renditions
+func (s *Service) Upload(ctx context.Context, ownerID uuid.UUID, kind models.MediaKind, data []byte) (*models.MediaAsset, error) {
+	if !kind.IsValid() {
+		return nil, fmt.Errorf("unknown media kind %q", kind)
+	}
+
+	asset, err := s.process(ctx, uuid.New(), kind, data)
+	if err != nil {
+		return nil, err
+	}
+	asset.OwnerID = ownerID
+
+	variants, err := json.Marshal(stored(asset.Variants))
+	if err != nil {
+		s.removeObjects(asset)
+		return nil, err
+	}
+	err = s.db.QueryRowContext(ctx, `
+		INSERT INTO media_assets (id, owner_id, kind, content_type, width, height, size_bytes, variants)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING created_at`,
+		asset.ID, asset.OwnerID, asset.Kind, asset.ContentType, asset.Width, asset.Height, asset.SizeBytes, variants,
+	).Scan(&asset.CreatedAt)
+	if err != nil {
+		s.removeObjects(asset)
+		return nil, fmt.Errorf("failed to save media asset: %w", err)
+	}
+
+	s.sign(asset)
+	return asset, nil
+}
+
+// process decodes the upload and writes each rendition to storage. On
+// failure, whatever was already written is removed.
+func (s *Service) process(ctx context.Context, id uuid.UUID, kind models.MediaKind, data []byte) (*models.MediaAsset, error) {
+	if len(data) > MaxUploadSize {
+		return nil, fmt.Errorf("%w: the limit is %d MB", ErrImageTooLarge, MaxUploadSize>>20)
+	}
+	src, _, err := decode(data)
+	if err != nil {
+		return nil, err
+	}
+
+	b := src.Bounds()
+	asset := &models.MediaAsset{
+		ID:        id,
+		Kind:      kind,
+		Width:     b.Dx(),
+		Height:    b.Dy(),
+		SizeBytes: int64(len(data)),
+	}
+
+	for _, r := range renditions {
+		w, h := fit(asset.Width, asset.Height, r.bound)
+		img := resize(src, w, h)
+
+		encoded, format, err := encode(img)
+		if err != nil {
+			s.removeObjects(asset)
+			return nil, fmt.Errorf("failed to encode %s image: %w", r.name, err)
+		}
+		if err := s.put(ctx, asset, r.name, format, w, h, encoded); err != nil {
+			s.removeObjects(asset)
+			return nil, err
+		}
+
+		if s.webp != nil {
+			if err := s.putWebP(ctx, asset, r.name, img); err != nil {
+				// The JPEG/PNG rendition still serves every client
+				log.Printf("media: skipping %s WebP for %s: %v", r.name, asset.ID, err)
+			}
+		}
+	}
+
+	asset.ContentType = asset.Variants[0].ContentType
+	return asset, nil
+}
+
+func (s *Service) putWebP(ctx context.Context, asset *models.MediaAsset, name string, img image.Image) error {
+	encoded, err := s.webp.EncodeWebP(ctx, img)
+	if err != nil {
+		return err
+	}
+	b := img.Bounds()
+	return s.put(ctx, asset, name, FormatWebP, b.Dx(), b.Dy(), encoded)
+}
+
+func (s *Service) put(ctx context.Context, asset *models.MediaAsset, name, format string, w, h int, data []byte) error {
+	ext := format
+	if format == FormatJPEG {
+		ext = "jpg"
+	}
+	key := fmt.Sprintf("%s/%s/%s.%s", asset.Kind, asset.ID, name, ext)
+	if err := s.storage.Put(ctx, key, data, contentTypes[format]); err != nil {
+		return fmt.Errorf("failed to store %s image: %w", name, err)
+	}
+
+	asset.Variants = append(asset.Variants, models.MediaVariant{
+		Name:        name,
+		Format:      format,
+		ContentType: contentTypes[format],
+		Width:       w,
+		Height:      h,
+		SizeBytes:   int64(len(data)),
+		Key:         key,
+	})
+	return nil
+}
+
+// removeObjects deletes an asset's stored renditions, logging failures
+func (s *Service) removeObjects(asset *models.MediaAsset) {
+	for _, v := range asset.Variants {
+		if err := s.storage.Delete(context.Background(), v.Key); err != nil {
+			log.Printf("media: failed to delete %s: %v", v.Key, err)
+		}
+	}
+}
+
+// Get returns an asset with freshly signed URLs
+func (s *Service) Get(ctx context.Context, id uuid.UUID) (*models.MediaAsset, error) {
+	assets, err := s.load(ctx, []uuid.UUID{id})
+	if err != nil {
+		return nil, err
+	}
+	asset, ok := assets[id]
+	if !ok {
+		return nil, ErrAssetNotFound
+	}
+	return asset, nil
+}
+
+// Delete removes an owner's asset and its stored renditions
+func (s *Service) Delete(ctx context.Context, ownerID, id uuid.UUID) error {
+	asset, err := s.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if asset.OwnerID != ownerID {
+		return ErrAssetNotFound
+	}
+
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM media_assets WHERE id = $1`, id); err != nil {
+		return fmt.Errorf("failed to delete media asset: %w", err)
+	}
+	s.removeObjects(asset)
+	return nil
+}
+
+// Resolve loads the assets behind media references, keyed by reference.
+// Bare URLs and references to deleted assets are left out.
+func (s *Service) Resolve(ctx context.Context, refs []string) (map[string]*models.MediaAsset, error) {
+	var ids []uuid.UUID
+	for _, ref := range refs {
+		if id, ok := models.ParseMediaRef(ref); ok {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return map[string]*models.MediaAsset{}, nil
+	}
+
+	assets, err := s.load(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]*models.MediaAsset, len(assets))
+	for id, asset := range assets {
+		out[models.MediaRef(id)] = asset
+	}
+	return out, nil
+}
+
+// AttachToProducts fills in Product.Media from the media references in
+// each product's images, in image order. Only product images are
+// attached, so a listing cannot expose someone's pest report photos.
+func (s *Service) AttachToProducts(ctx context.Context, products []*models.Product) error {
+	var refs []string
+	for _, p := range products {
+		refs = append(refs, p.Images...)
+	}
+	assets, err := s.Resolve(ctx, refs)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range products {
+		p.Media = nil
+		for _, image := range p.Images {
+			if asset, ok := assets[image]; ok && asset.Kind == models.MediaKindProduct {
+				p.Media = append(p.Media, *asset)
+			}
+		}
+	}
+	return nil
+}
+
+// load reads assets by ID and signs their URLs
+func (s *Service) load(ctx context.Context, ids []uuid.UUID) (map[uuid.UUID]*models.MediaAsset, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, owner_id, kind, content_type, width, height, size_bytes, variants, created_at
+		FROM media_assets
+		WHERE id = ANY($1::uuid[])`, pq.Array(ids))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load media assets: %w", err)
+	}
+	defer rows.Close()
+
+	assets := make(map[uuid.UUID]*models.MediaAsset, len(ids))
+	for rows.Next() {
+		var a models.MediaAsset
+		var variants []byte
+		if err := rows.Scan(&a.ID, &a.OwnerID, &a.Kind, &a.ContentType, &a.Width, &a.Height,
+			&a.SizeBytes, &variants, &a.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan media asset: %w", err)
+		}
+
+		var persisted []storedVariant
+		if err := json.Unmarshal(variants, &persisted); err != nil {
+			return nil, fmt.Errorf("failed to decode media variants: %w", err)
+		}
+		for _, v := range persisted {
+			v.MediaVariant.Key = v.Key
+			a.Variants = append(a.Variants, v.MediaVariant)
+		}
+
+		s.sign(&a)
+		assets[a.ID] = &a
+	}
+	return assets, rows.Err()
+}
+
+// sign sets each variant's URL. A variant that cannot be signed is served
+// without a URL rather than failing the whole read.
+func (s *Service) sign(asset *models.MediaAsset) {
+	for i := range asset.Variants {
+		url, err := s.storage.SignedURL(asset.Variants[i].Key, s.ttl)
+		if err != nil {
+			log.Printf("media: failed to sign %s: %v", asset.Variants[i].Key, err)
+			continue
+		}
+		asset.Variants[i].URL = url
+	}
+}
+
+// URL returns the signed URL of an asset's named JPEG/PNG rendition
+func URL(asset *models.MediaAsset, name string) string {
+	for _, v := range asset.Variants {
+		if v.Name == name && v.Format != FormatWebP {
+			return v.URL
+		}
+	}
+	return ""
+}
+
+func stored(variants []models.MediaVariant) []storedVariant {
+	out := make([]storedVariant, len(variants))
+	for i, v := range variants {
+		out[i] = storedVariant{MediaVariant: v, Key: v.Key}
+	}
+	return out
+}
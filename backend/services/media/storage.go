@@ -0,0 +1,40 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
+// Storage errors
+var (
+	ErrObjectNotFound   = errors.New("stored object not found")
+	ErrInvalidKey       = errors.New("invalid storage key")
+	ErrInvalidSignature = errors.New("invalid or expired media URL")
+)
+
+// Storage keeps the encoded renditions. Objects are private: clients only
+// reach them through URLs signed by the backend that stored them.
+type Storage interface {
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+	// SignedURL returns a URL that serves key until ttl has passed
+	SignedURL(key string, ttl time.Duration) (string, error)
+}
+
+// validKey rejects keys that could escape the storage root. Keys are
+// generated by the service, so this only guards the serving route.
+func validKey(key string) bool {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return false
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return false
+		}
+	}
+	return true
+}
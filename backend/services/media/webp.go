@@ -0,0 +1,52 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/png"
+	"os/exec"
+	"strconv"
+)
+
+// WebPEncoder produces the WebP renditions served to low-bandwidth
+// clients. Go's standard library has no WebP encoder, so the service
+// runs without one and skips those renditions when none is configured.
+type WebPEncoder interface {
+	EncodeWebP(ctx context.Context, img image.Image) ([]byte, error)
+}
+
+// CWebP encodes with the cwebp command-line tool from libwebp
+type CWebP struct {
+	path    string
+	quality int
+}
+
+// NewCWebP finds cwebp on the PATH, returning nil when it is not installed
+func NewCWebP(quality int) *CWebP {
+	path, err := exec.LookPath("cwebp")
+	if err != nil {
+		return nil
+	}
+	return &CWebP{path: path, quality: quality}
+}
+
+// EncodeWebP pipes the image to cwebp as PNG and reads back the WebP
+func (c *CWebP) EncodeWebP(ctx context.Context, img image.Image) ([]byte, error) {
+	var in bytes.Buffer
+	if err := png.Encode(&in, img); err != nil {
+		return nil, err
+	}
+
+	var out, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, c.path, "-quiet", "-metadata", "none",
+		"-q", strconv.Itoa(c.quality), "-o", "-", "--", "-")
+	cmd.Stdin = &in
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("cwebp failed: %w: %s", err, stderr.String())
+	}
+	return out.Bytes(), nil
+}
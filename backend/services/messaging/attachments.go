@@ -0,0 +1,65 @@
+package messaging
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/google/uuid"
+
+	"github.com/Andrew-mugwe/agroai/models"
+)
+
+// Attachments stores the files messages reference. Files are uploaded to
+// a thread first, then linked to the message that sends them, inside the
+// transaction inserting it.
+type Attachments interface {
+	LinkToThreadMessage(ctx context.Context, tx *sql.Tx, ownerID uuid.UUID, threadID, messageID int, ids []uuid.UUID) error
+	ThreadMessageAttachments(ctx context.Context, messageIDs []int) (map[int][]*models.Attachment, error)
+}
+
+// SetAttachments lets messages carry uploaded files
+func (mms *MarketplaceMessagingService) SetAttachments(attachments Attachments) {
+	mms.attachments = attachments
+}
+
+// attachFiles loads the files the messages reference
+func (mms *MarketplaceMessagingService) attachFiles(ctx context.Context, messages []*MarketplaceMessage) error {
+	ids := make([]int, 0, len(messages))
+	for _, message := range messages {
+		message.Attachments = []*models.Attachment{}
+		ids = append(ids, message.ID)
+	}
+	if mms.attachments == nil || len(ids) == 0 {
+		return nil
+	}
+
+	attachments, err := mms.attachments.ThreadMessageAttachments(ctx, ids)
+	if err != nil {
+		return err
+	}
+	for _, message := range messages {
+		message.Attachments = append(message.Attachments, attachments[message.ID]...)
+	}
+	return nil
+}
+
+// attachFiles loads the files the messages reference, through the thread
+// service's attachments
+func (ms *MessagingService) attachFiles(ctx context.Context, messages []Message) error {
+	if ms.threads.attachments == nil || len(messages) == 0 {
+		return nil
+	}
+	ids := make([]int, len(messages))
+	for i := range messages {
+		ids[i] = messages[i].ID
+	}
+
+	attachments, err := ms.threads.attachments.ThreadMessageAttachments(ctx, ids)
+	if err != nil {
+		return err
+	}
+	for i := range messages {
+		messages[i].Attachments = attachments[messages[i].ID]
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+package messaging
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// ThreadKind says what a conversation is about. Product and order threads
+// are between a buyer and a seller; direct and group conversations are
+// just their participants, such as an NGO and the farmers it works with.
+type ThreadKind string
+
+// Thread kinds
+const (
+	ThreadDirect  ThreadKind = "direct"
+	ThreadGroup   ThreadKind = "group"
+	ThreadProduct ThreadKind = "product"
+	ThreadOrder   ThreadKind = "order"
+)
+
+// Valid reports whether k is a known thread kind
+func (k ThreadKind) Valid() bool {
+	switch k {
+	case ThreadDirect, ThreadGroup, ThreadProduct, ThreadOrder:
+		return true
+	}
+	return false
+}
+
+// maxTitleLength bounds group conversation names
+const maxTitleLength = 120
+
+// Conversation errors
+var (
+	ErrInvalidConversation = errors.New("invalid conversation")
+	// ErrUnknownMember is returned when a member to add is not a user
+	ErrUnknownMember = errors.New("conversation member not found")
+)
+
+// CreateConversationRequest starts a direct or group conversation. The
+// creator is always a member; product and order threads are started with
+// CreateThread instead.
+type CreateConversationRequest struct {
+	Kind      ThreadKind  `json:"kind"`
+	Title     string      `json:"title,omitempty"`
+	MemberIDs []uuid.UUID `json:"member_ids"`
+}
+
+// members validates the request and returns its members, creator first,
+// each once
+func (req *CreateConversationRequest) members(creatorID uuid.UUID) ([]uuid.UUID, error) {
+	members := []uuid.UUID{creatorID}
+	seen := map[uuid.UUID]bool{creatorID: true}
+	for _, id := range req.MemberIDs {
+		if id == uuid.Nil {
+			return nil, fmt.Errorf("%w: invalid member ID", ErrInvalidConversation)
+		}
+		if !seen[id] {
+			seen[id] = true
+			members = append(members, id)
+		}
+	}
+
+	switch req.Kind {
+	case ThreadDirect:
+		if len(members) != 2 {
+			return nil, fmt.Errorf("%w: a direct conversation is between two users", ErrInvalidConversation)
+		}
+	case ThreadGroup:
+		if len(members) < 2 {
+			return nil, fmt.Errorf("%w: a group needs at least one other member", ErrInvalidConversation)
+		}
+		if utf8.RuneCountInString(strings.TrimSpace(req.Title)) > maxTitleLength {
+			return nil, fmt.Errorf("%w: title is longer than %d characters", ErrInvalidConversation, maxTitleLength)
+		}
+	default:
+		return nil, fmt.Errorf("%w: kind must be direct or group", ErrInvalidConversation)
+	}
+	return members, nil
+}
+
+// directKey identifies the direct conversation between two users, lowest
+// ID first, matching the key the migration gave moved conversations
+func directKey(a, b uuid.UUID) string {
+	x, y := a.String(), b.String()
+	if y < x {
+		x, y = y, x
+	}
+	return x + ":" + y
+}
+
+// participantRole is the role a user joins a direct or group conversation
+// with: NGOs and admins keep theirs, everyone else is a member
+func participantRole(userRole string) string {
+	if userRole == "ngo" || userRole == "admin" {
+		return userRole
+	}
+	return "member"
+}
+
+// CreateConversation starts a direct or group conversation and returns its
+// thread reference. A direct conversation is only started once per pair of
+// users; asking again returns the existing one.
+func (mms *MarketplaceMessagingService) CreateConversation(ctx context.Context, req *CreateConversationRequest, creatorID uuid.UUID) (string, error) {
+	members, err := req.members(creatorID)
+	if err != nil {
+		return "", err
+	}
+	if req.Kind == ThreadDirect {
+		return mms.FindOrCreateDirect(ctx, members[0], members[1])
+	}
+
+	tx, err := mms.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var threadID int
+	var threadRef string
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO marketplace_threads (thread_ref, kind, title, created_by)
+		VALUES (generate_thread_ref(), $1, NULLIF($2, ''), $3)
+		RETURNING id, thread_ref
+	`, req.Kind, strings.TrimSpace(req.Title), creatorID).Scan(&threadID, &threadRef)
+	if err != nil {
+		return "", fmt.Errorf("failed to create conversation: %w", err)
+	}
+
+	if err := addMembers(ctx, tx, threadID, members); err != nil {
+		return "", err
+	}
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return threadRef, nil
+}
+
+// FindOrCreateDirect returns the direct conversation between two users,
+// starting it if they have none
+func (mms *MarketplaceMessagingService) FindOrCreateDirect(ctx context.Context, userID, otherID uuid.UUID) (string, error) {
+	if userID == otherID {
+		return "", fmt.Errorf("%w: a direct conversation is between two users", ErrInvalidConversation)
+	}
+	key := directKey(userID, otherID)
+
+	tx, err := mms.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// The unique key makes a concurrent start wait for, then find, this one
+	var threadID int
+	var threadRef string
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO marketplace_threads (thread_ref, kind, created_by, direct_key)
+		VALUES (generate_thread_ref(), 'direct', $1, $2)
+		ON CONFLICT (direct_key) DO NOTHING
+		RETURNING id, thread_ref
+	`, userID, key).Scan(&threadID, &threadRef)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = mms.db.QueryRowContext(ctx,
+			`SELECT thread_ref FROM marketplace_threads WHERE direct_key = $1`, key).Scan(&threadRef)
+		if err != nil {
+			return "", fmt.Errorf("failed to find direct conversation: %w", err)
+		}
+		return threadRef, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to create direct conversation: %w", err)
+	}
+
+	if err := addMembers(ctx, tx, threadID, []uuid.UUID{userID, otherID}); err != nil {
+		return "", err
+	}
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return threadRef, nil
+}
+
+// addMembers adds users to a new conversation with their participant role
+func addMembers(ctx context.Context, tx *sql.Tx, threadID int, userIDs []uuid.UUID) error {
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO marketplace_thread_participants (thread_id, user_id, role)
+		SELECT $1, u.id, CASE WHEN u.role::text IN ('ngo', 'admin') THEN u.role::text ELSE 'member' END
+		FROM users u
+		WHERE u.id = ANY($2::uuid[])
+		ON CONFLICT (thread_id, user_id) DO NOTHING
+	`, threadID, pq.Array(userIDs))
+	if err != nil {
+		return fmt.Errorf("failed to add members: %w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil || n != int64(len(userIDs)) {
+		return ErrUnknownMember
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package messaging
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateConversationMembers(t *testing.T) {
+	ngo, farmer, other := uuid.New(), uuid.New(), uuid.New()
+
+	members, err := (&CreateConversationRequest{Kind: ThreadDirect, MemberIDs: []uuid.UUID{farmer, ngo, farmer}}).members(ngo)
+	require.NoError(t, err)
+	assert.Equal(t, []uuid.UUID{ngo, farmer}, members)
+
+	members, err = (&CreateConversationRequest{Kind: ThreadGroup, Title: "Maize growers, Kitale", MemberIDs: []uuid.UUID{farmer, other}}).members(ngo)
+	require.NoError(t, err)
+	assert.Equal(t, []uuid.UUID{ngo, farmer, other}, members)
+
+	invalid := map[string]*CreateConversationRequest{
+		"direct with self":  {Kind: ThreadDirect, MemberIDs: []uuid.UUID{ngo}},
+		"direct with three": {Kind: ThreadDirect, MemberIDs: []uuid.UUID{farmer, other}},
+		"empty group":       {Kind: ThreadGroup},
+		"long title":        {Kind: ThreadGroup, Title: strings.Repeat("a", maxTitleLength+1), MemberIDs: []uuid.UUID{farmer}},
+		"nil member":        {Kind: ThreadGroup, MemberIDs: []uuid.UUID{uuid.Nil}},
+		"product thread":    {Kind: ThreadProduct, MemberIDs: []uuid.UUID{farmer}},
+		"missing kind":      {MemberIDs: []uuid.UUID{farmer}},
+		"unknown kind":      {Kind: "broadcast", MemberIDs: []uuid.UUID{farmer}},
+	}
+	for name, req := range invalid {
+		_, err := req.members(ngo)
+		assert.ErrorIs(t, err, ErrInvalidConversation, name)
+	}
+}
+
+func TestDirectKey(t *testing.T) {
+	a := uuid.MustParse("11111111-1111-1111-1111-111111111111")
+	b := uuid.MustParse("aaaaaaaa-aaaa-aaaa-aaaa-aaaaaaaaaaaa")
+
+	assert.Equal(t, a.String()+":"+b.String(), directKey(a, b))
+	assert.Equal(t, directKey(a, b), directKey(b, a))
+}
+
+func TestParticipantRole(t *testing.T) {
+	assert.Equal(t, "ngo", participantRole("ngo"))
+	assert.Equal(t, "admin", participantRole("admin"))
+	assert.Equal(t, "member", participantRole("farmer"))
+	assert.Equal(t, "member", participantRole("trader"))
+}
+
+func TestThreadIsParty(t *testing.T) {
+	buyer, seller := uuid.New(), uuid.New()
+
+	product := &MarketplaceThread{Kind: ThreadProduct, BuyerID: &buyer, SellerID: &seller}
+	assert.True(t, product.IsParty(buyer))
+	assert.True(t, product.IsParty(seller))
+	assert.False(t, product.IsParty(uuid.New()))
+
+	// Direct and group conversations have no buyer or seller
+	assert.False(t, (&MarketplaceThread{Kind: ThreadGroup}).IsParty(buyer))
+}
@@ -3,27 +3,41 @@ package messaging
 import (
 	"context"
 	"database/sql"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
 
+	"github.com/Andrew-mugwe/agroai/models"
+	"github.com/Andrew-mugwe/agroai/pagination"
 	"github.com/google/uuid"
 )
 
+// ErrNotParticipant is returned for users outside a thread
+var ErrNotParticipant = errors.New("user is not a participant in this thread")
+
 // MarketplaceMessagingService handles marketplace-specific messaging operations
 type MarketplaceMessagingService struct {
-	db *sql.DB
+	db          *sql.DB
+	orders      OrderCreator
+	attachments Attachments
 }
 
-// MarketplaceThread represents a marketplace chat thread
+// MarketplaceThread represents a conversation: a direct or group chat, or
+// a marketplace thread about a product or order
 type MarketplaceThread struct {
 	ID        int        `json:"id"`
 	ThreadRef string     `json:"thread_ref"`
-	ProductID *uuid.UUID `json:"product_id,omitempty"`
-	OrderID   *uuid.UUID `json:"order_id,omitempty"`
-	BuyerID   uuid.UUID  `json:"buyer_id"`
-	SellerID  uuid.UUID  `json:"seller_id"`
+	Kind      ThreadKind `json:"kind"`
+	// Title names group conversations
+	Title *string `json:"title,omitempty"`
+	// ConversationID addresses the thread on the legacy /api/messages endpoints
+	ConversationID int        `json:"conversation_id"`
+	ProductID      *uuid.UUID `json:"product_id,omitempty"`
+	OrderID        *uuid.UUID `json:"order_id,omitempty"`
+	// BuyerID and SellerID are set on product and order threads
+	BuyerID   *uuid.UUID `json:"buyer_id,omitempty"`
+	SellerID  *uuid.UUID `json:"seller_id,omitempty"`
 	Status    string     `json:"status"`
 	CreatedAt time.Time  `json:"created_at"`
 	UpdatedAt time.Time  `json:"updated_at"`
@@ -31,35 +45,45 @@ type MarketplaceThread struct {
 	// Extended fields from summary view
 	ProductName      *string             `json:"product_name,omitempty"`
 	ProductPrice     *float64            `json:"product_price,omitempty"`
-	BuyerName        string              `json:"buyer_name"`
-	SellerName       string              `json:"seller_name"`
+	BuyerName        *string             `json:"buyer_name,omitempty"`
+	SellerName       *string             `json:"seller_name,omitempty"`
 	LatestMessage    *MarketplaceMessage `json:"latest_message,omitempty"`
 	ParticipantCount int                 `json:"participant_count"`
 	UnreadCount      int                 `json:"unread_count"`
 }
 
+// IsParty reports whether the user is the thread's buyer or seller
+func (t *MarketplaceThread) IsParty(userID uuid.UUID) bool {
+	return (t.BuyerID != nil && *t.BuyerID == userID) || (t.SellerID != nil && *t.SellerID == userID)
+}
+
 // MarketplaceMessage represents a message in a marketplace thread
 type MarketplaceMessage struct {
-	ID          int             `json:"id"`
-	ThreadID    int             `json:"thread_id"`
-	ThreadRef   string          `json:"thread_ref,omitempty"`
-	SenderID    uuid.UUID       `json:"sender_id"`
-	SenderName  string          `json:"sender_name,omitempty"`
-	Body        string          `json:"body"`
-	Attachments json.RawMessage `json:"attachments"`
-	MessageType string          `json:"message_type"`
-	CreatedAt   time.Time       `json:"created_at"`
-	UpdatedAt   time.Time       `json:"updated_at"`
+	ID          int                  `json:"id"`
+	ThreadID    int                  `json:"thread_id"`
+	ThreadRef   string               `json:"thread_ref,omitempty"`
+	SenderID    uuid.UUID            `json:"sender_id"`
+	SenderName  string               `json:"sender_name,omitempty"`
+	Body        string               `json:"body"`
+	Attachments []*models.Attachment `json:"attachments"`
+	MessageType string               `json:"message_type"`
+	// Offer is the offer an offer message makes or answers
+	Offer     *MarketplaceOffer `json:"offer,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at"`
 }
 
-// MarketplaceParticipant represents a thread participant
+// MarketplaceParticipant represents a thread participant. Messages created
+// up to LastDeliveredAt have reached one of the participant's devices, and
+// those up to LastReadAt have been read.
 type MarketplaceParticipant struct {
-	ID         int       `json:"id"`
-	ThreadID   int       `json:"thread_id"`
-	UserID     uuid.UUID `json:"user_id"`
-	Role       string    `json:"role"`
-	JoinedAt   time.Time `json:"joined_at"`
-	LastReadAt time.Time `json:"last_read_at"`
+	ID              int       `json:"id"`
+	ThreadID        int       `json:"thread_id"`
+	UserID          uuid.UUID `json:"user_id"`
+	Role            string    `json:"role"`
+	JoinedAt        time.Time `json:"joined_at"`
+	LastDeliveredAt time.Time `json:"last_delivered_at"`
+	LastReadAt      time.Time `json:"last_read_at"`
 }
 
 // CreateThreadRequest represents the request to create a thread
@@ -71,9 +95,11 @@ type CreateThreadRequest struct {
 
 // SendMessageRequest represents the request to send a message
 type SendMessageRequest struct {
-	Body        string          `json:"body"`
-	Attachments json.RawMessage `json:"attachments,omitempty"`
-	MessageType string          `json:"message_type,omitempty"`
+	// Body may be empty when the message has attachments
+	Body string `json:"body"`
+	// AttachmentIDs are files uploaded to the thread by the sender
+	AttachmentIDs []uuid.UUID `json:"attachment_ids,omitempty"`
+	MessageType   string      `json:"message_type,omitempty"`
 }
 
 // EscalateThreadRequest represents the request to escalate a thread
@@ -101,7 +127,7 @@ func (mms *MarketplaceMessagingService) CreateThread(ctx context.Context, req *C
 	var threadRef string
 	query := `SELECT create_or_get_marketplace_thread($1, $2, $3, $4)`
 
-	err := mms.db.QueryRowContext(ctx, query, req.ProductID, req.OrderID, buyerID, req.SellerID).Scan(&threadRef)
+	err := mms.db.QueryRowContext(ctx, query, buyerID, req.SellerID, req.ProductID, req.OrderID).Scan(&threadRef)
 	if err != nil {
 		return "", fmt.Errorf("failed to create or get thread: %w", err)
 	}
@@ -152,34 +178,63 @@ func (mms *MarketplaceMessagingService) SendMessage(ctx context.Context, threadR
 	}
 
 	if !isParticipant {
-		return nil, fmt.Errorf("user is not a participant in this thread")
+		return nil, ErrNotParticipant
 	}
 
 	// Sanitize message body
 	body := strings.TrimSpace(req.Body)
-	if body == "" {
+	if body == "" && len(req.AttachmentIDs) == 0 {
 		return nil, fmt.Errorf("message body cannot be empty")
 	}
+	if len(req.AttachmentIDs) > 0 && mms.attachments == nil {
+		return nil, errors.New("attachments are not available")
+	}
 
-	// Set default message type
+	// Set default message type; offers go through MakeOffer and friends
 	messageType := req.MessageType
 	if messageType == "" {
 		messageType = "text"
 	}
+	if messageType != "text" && messageType != "image" && messageType != "file" {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidMessageType, messageType)
+	}
+
+	tx, err := mms.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
 
 	// Insert message
 	var messageID int
 	var createdAt time.Time
-	err = mms.db.QueryRowContext(ctx, `
-		INSERT INTO marketplace_messages (thread_id, sender_id, body, attachments, message_type, created_at)
-		VALUES ($1, $2, $3, $4, $5, NOW())
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO marketplace_messages (thread_id, sender_id, body, message_type, created_at)
+		VALUES ($1, $2, $3, $4, NOW())
 		RETURNING id, created_at
-	`, threadID, senderID, body, req.Attachments, messageType).Scan(&messageID, &createdAt)
+	`, threadID, senderID, body, messageType).Scan(&messageID, &createdAt)
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to send message: %w", err)
 	}
 
+	attachments := []*models.Attachment{}
+	if len(req.AttachmentIDs) > 0 {
+		if err := mms.attachments.LinkToThreadMessage(ctx, tx, senderID, threadID, messageID, req.AttachmentIDs); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	if len(req.AttachmentIDs) > 0 {
+		loaded, err := mms.attachments.ThreadMessageAttachments(ctx, []int{messageID})
+		if err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, loaded[messageID]...)
+	}
+
 	// Update thread updated_at
 	_, err = mms.db.ExecContext(ctx, `
 		UPDATE marketplace_threads SET updated_at = NOW() WHERE id = $1
@@ -197,7 +252,7 @@ func (mms *MarketplaceMessagingService) SendMessage(ctx context.Context, threadR
 		ThreadRef:   threadRef,
 		SenderID:    senderID,
 		Body:        body,
-		Attachments: req.Attachments,
+		Attachments: attachments,
 		MessageType: messageType,
 		CreatedAt:   createdAt,
 		UpdatedAt:   createdAt,
@@ -206,8 +261,30 @@ func (mms *MarketplaceMessagingService) SendMessage(ctx context.Context, threadR
 	return message, nil
 }
 
-// GetThreadMessages retrieves messages for a marketplace thread
-func (mms *MarketplaceMessagingService) GetThreadMessages(ctx context.Context, threadRef string, limit int, afterCursor *time.Time) ([]*MarketplaceMessage, error) {
+// List sort orders; cursors carry them
+const (
+	sortNewest         = "newest"
+	sortRecentlyActive = "recently_active"
+)
+
+var (
+	// threadMessagesKeyset pages back from the newest message
+	threadMessagesKeyset = pagination.Keyset{Key: "mm.created_at", ID: "mm.id", Dir: pagination.Desc}
+	// userThreadsKeyset lists the most recently active threads first
+	userThreadsKeyset = pagination.Keyset{Key: "mt.updated_at", ID: "mt.id", Dir: pagination.Desc}
+)
+
+// GetThreadMessages retrieves a page of messages for a marketplace thread.
+// The first page holds the newest messages and each next page older ones;
+// messages within a page are in chronological order.
+func (mms *MarketplaceMessagingService) GetThreadMessages(ctx context.Context, threadRef string, page pagination.Params) (pagination.Page[*MarketplaceMessage], error) {
+	var none pagination.Page[*MarketplaceMessage]
+	page = page.Normalize()
+	after, err := page.After(sortNewest)
+	if err != nil {
+		return none, err
+	}
+
 	// Get thread ID and validate user access
 	var threadID int
 	query := `
@@ -216,9 +293,15 @@ func (mms *MarketplaceMessagingService) GetThreadMessages(ctx context.Context, t
 		WHERE mt.thread_ref = $1
 	`
 
-	err := mms.db.QueryRowContext(ctx, query, threadRef).Scan(&threadID)
+	err = mms.db.QueryRowContext(ctx, query, threadRef).Scan(&threadID)
 	if err != nil {
-		return nil, fmt.Errorf("thread not found: %w", err)
+		return none, fmt.Errorf("thread not found: %w", err)
+	}
+
+	var total int
+	if err := mms.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM marketplace_messages WHERE thread_id = $1`, threadID).Scan(&total); err != nil {
+		return none, fmt.Errorf("failed to count messages: %w", err)
 	}
 
 	// Build query for messages
@@ -229,10 +312,11 @@ func (mms *MarketplaceMessagingService) GetThreadMessages(ctx context.Context, t
 			mm.sender_id,
 			u.name as sender_name,
 			mm.body,
-			mm.attachments,
 			mm.message_type,
+			mm.offer_id,
 			mm.created_at,
-			mm.updated_at
+			mm.updated_at,
+			` + threadMessagesKeyset.KeyText() + `
 		FROM marketplace_messages mm
 		LEFT JOIN users u ON mm.sender_id = u.id
 		WHERE mm.thread_id = $1
@@ -241,26 +325,30 @@ func (mms *MarketplaceMessagingService) GetThreadMessages(ctx context.Context, t
 	args := []interface{}{threadID}
 	argIndex := 2
 
-	if afterCursor != nil {
-		msgQuery += fmt.Sprintf(" AND mm.created_at < $%d", argIndex)
-		args = append(args, *afterCursor)
-		argIndex++
+	if after != nil {
+		msgQuery += " AND " + threadMessagesKeyset.After(fmt.Sprintf("$%d", argIndex), fmt.Sprintf("$%d", argIndex+1))
+		args = append(args, after.Key, after.ID)
+		argIndex += 2
 	}
 
-	msgQuery += fmt.Sprintf(" ORDER BY mm.created_at DESC LIMIT $%d", argIndex)
-	args = append(args, limit)
+	msgQuery += fmt.Sprintf(" ORDER BY %s LIMIT $%d", threadMessagesKeyset.OrderBy(), argIndex)
+	args = append(args, page.FetchLimit())
 
 	rows, err := mms.db.QueryContext(ctx, msgQuery, args...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query messages: %w", err)
+		return none, fmt.Errorf("failed to query messages: %w", err)
 	}
 	defer rows.Close()
 
 	var messages []*MarketplaceMessage
+	var keys []string
+	offerIDs := make(map[int]uuid.UUID)
 	for rows.Next() {
 		msg := &MarketplaceMessage{
 			ThreadRef: threadRef,
 		}
+		var key string
+		var offerID uuid.NullUUID
 
 		err := rows.Scan(
 			&msg.ID,
@@ -268,32 +356,85 @@ func (mms *MarketplaceMessagingService) GetThreadMessages(ctx context.Context, t
 			&msg.SenderID,
 			&msg.SenderName,
 			&msg.Body,
-			&msg.Attachments,
 			&msg.MessageType,
+			&offerID,
 			&msg.CreatedAt,
 			&msg.UpdatedAt,
+			&key,
 		)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan message: %w", err)
+			return none, fmt.Errorf("failed to scan message: %w", err)
+		}
+		if offerID.Valid {
+			offerIDs[msg.ID] = offerID.UUID
 		}
 
 		messages = append(messages, msg)
+		keys = append(keys, key)
 	}
+	if err := rows.Err(); err != nil {
+		return none, fmt.Errorf("failed to query messages: %w", err)
+	}
+	if err := mms.attachOffers(ctx, messages, offerIDs); err != nil {
+		return none, err
+	}
+	if err := mms.attachFiles(ctx, messages); err != nil {
+		return none, err
+	}
+
+	result := pagination.NewPage(messages, page.Limit, func(i int) pagination.Cursor {
+		return pagination.Cursor{Key: keys[i], ID: fmt.Sprint(messages[i].ID), Sort: sortNewest}
+	}).WithTotal(total)
 
 	// Reverse to get chronological order
-	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
-		messages[i], messages[j] = messages[j], messages[i]
+	items := result.Items
+	for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+		items[i], items[j] = items[j], items[i]
 	}
 
-	return messages, nil
+	return result, nil
 }
 
-// GetUserThreads retrieves threads for a user
-func (mms *MarketplaceMessagingService) GetUserThreads(ctx context.Context, userID uuid.UUID) ([]*MarketplaceThread, error) {
-	query := `
+// GetUserThreads retrieves a page of the conversations a user takes part
+// in, most recently active first, optionally of one kind
+func (mms *MarketplaceMessagingService) GetUserThreads(ctx context.Context, userID uuid.UUID, kind ThreadKind, page pagination.Params) (pagination.Page[*MarketplaceThread], error) {
+	var none pagination.Page[*MarketplaceThread]
+	page = page.Normalize()
+	after, err := page.After(sortRecentlyActive)
+	if err != nil {
+		return none, err
+	}
+
+	where := `EXISTS (
+			SELECT 1 FROM marketplace_thread_participants p
+			WHERE p.thread_id = mt.id AND p.user_id = $1
+		)`
+	args := []interface{}{userID}
+	if kind != "" {
+		args = append(args, kind)
+		where += fmt.Sprintf(" AND mt.kind = $%d", len(args))
+	}
+
+	var total int
+	if err := mms.db.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM marketplace_threads mt WHERE "+where, args...).Scan(&total); err != nil {
+		return none, fmt.Errorf("failed to count user threads: %w", err)
+	}
+
+	if after != nil {
+		args = append(args, after.Key, after.ID)
+		where += " AND " + userThreadsKeyset.After(fmt.Sprintf("$%d", len(args)-1), fmt.Sprintf("$%d", len(args)))
+	}
+	args = append(args, page.FetchLimit())
+
+	// The summary has a row per participant; the user's has their unread count
+	query := fmt.Sprintf(`
 		SELECT 
 			mt.id,
 			mt.thread_ref,
+			mt.kind,
+			mt.title,
+			mt.legacy_conversation_id,
 			mt.product_id,
 			mt.order_id,
 			mt.buyer_id,
@@ -306,26 +447,33 @@ func (mms *MarketplaceMessagingService) GetUserThreads(ctx context.Context, user
 			mts.buyer_name,
 			mts.seller_name,
 			mts.participant_count,
-			mts.unread_count
+			mts.unread_count,
+			%s
 		FROM marketplace_threads mt
-		LEFT JOIN marketplace_thread_summary mts ON mt.id = mts.id
-		WHERE mt.buyer_id = $1 OR mt.seller_id = $1
-		ORDER BY mt.updated_at DESC
-	`
+		LEFT JOIN marketplace_thread_summary mts ON mt.id = mts.id AND mts.participant_id = $1
+		WHERE %s
+		ORDER BY %s
+		LIMIT $%d
+	`, userThreadsKeyset.KeyText(), where, userThreadsKeyset.OrderBy(), len(args))
 
-	rows, err := mms.db.QueryContext(ctx, query, userID)
+	rows, err := mms.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query user threads: %w", err)
+		return none, fmt.Errorf("failed to query user threads: %w", err)
 	}
 	defer rows.Close()
 
 	var threads []*MarketplaceThread
+	var keys []string
 	for rows.Next() {
 		thread := &MarketplaceThread{}
+		var key string
 
 		err := rows.Scan(
 			&thread.ID,
 			&thread.ThreadRef,
+			&thread.Kind,
+			&thread.Title,
+			&thread.ConversationID,
 			&thread.ProductID,
 			&thread.OrderID,
 			&thread.BuyerID,
@@ -339,15 +487,22 @@ func (mms *MarketplaceMessagingService) GetUserThreads(ctx context.Context, user
 			&thread.SellerName,
 			&thread.ParticipantCount,
 			&thread.UnreadCount,
+			&key,
 		)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan thread: %w", err)
+			return none, fmt.Errorf("failed to scan thread: %w", err)
 		}
 
 		threads = append(threads, thread)
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return none, fmt.Errorf("failed to query user threads: %w", err)
 	}
 
-	return threads, nil
+	return pagination.NewPage(threads, page.Limit, func(i int) pagination.Cursor {
+		return pagination.Cursor{Key: keys[i], ID: fmt.Sprint(threads[i].ID), Sort: sortRecentlyActive}
+	}).WithTotal(total), nil
 }
 
 // EscalateThread escalates a thread to admin/NGO attention
@@ -406,20 +561,48 @@ func (mms *MarketplaceMessagingService) EscalateThread(ctx context.Context, thre
 	return nil
 }
 
-// MarkThreadAsRead marks messages in a thread as read for a user
-func (mms *MarketplaceMessagingService) MarkThreadAsRead(ctx context.Context, threadRef string, userID uuid.UUID) error {
-	_, err := mms.db.ExecContext(ctx, `
+// MarkThreadAsRead marks messages in a thread as read, and so delivered,
+// for a user and returns the time they were read up to
+func (mms *MarketplaceMessagingService) MarkThreadAsRead(ctx context.Context, threadRef string, userID uuid.UUID) (time.Time, error) {
+	var readAt time.Time
+	err := mms.db.QueryRowContext(ctx, `
 		UPDATE marketplace_thread_participants 
-		SET last_read_at = NOW() 
+		SET last_read_at = NOW(), last_delivered_at = NOW()
 		WHERE thread_id = (SELECT id FROM marketplace_threads WHERE thread_ref = $1)
 		AND user_id = $2
-	`, threadRef, userID)
+		RETURNING last_read_at
+	`, threadRef, userID).Scan(&readAt)
 
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, ErrNotParticipant
+	}
 	if err != nil {
-		return fmt.Errorf("failed to mark thread as read: %w", err)
+		return time.Time{}, fmt.Errorf("failed to mark thread as read: %w", err)
 	}
 
-	return nil
+	return readAt, nil
+}
+
+// MarkThreadAsDelivered records that messages in a thread have reached one
+// of the user's devices and returns the time they were delivered up to
+func (mms *MarketplaceMessagingService) MarkThreadAsDelivered(ctx context.Context, threadRef string, userID uuid.UUID) (time.Time, error) {
+	var deliveredAt time.Time
+	err := mms.db.QueryRowContext(ctx, `
+		UPDATE marketplace_thread_participants 
+		SET last_delivered_at = NOW()
+		WHERE thread_id = (SELECT id FROM marketplace_threads WHERE thread_ref = $1)
+		AND user_id = $2
+		RETURNING last_delivered_at
+	`, threadRef, userID).Scan(&deliveredAt)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, ErrNotParticipant
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to mark thread as delivered: %w", err)
+	}
+
+	return deliveredAt, nil
 }
 
 // GetThreadInfo retrieves detailed thread information
@@ -428,6 +611,9 @@ func (mms *MarketplaceMessagingService) GetThreadInfo(ctx context.Context, threa
 		SELECT 
 			mt.id,
 			mt.thread_ref,
+			mt.kind,
+			mt.title,
+			mt.legacy_conversation_id,
 			mt.product_id,
 			mt.order_id,
 			mt.buyer_id,
@@ -450,6 +636,9 @@ func (mms *MarketplaceMessagingService) GetThreadInfo(ctx context.Context, threa
 	err := mms.db.QueryRowContext(ctx, query, threadRef).Scan(
 		&thread.ID,
 		&thread.ThreadRef,
+		&thread.Kind,
+		&thread.Title,
+		&thread.ConversationID,
 		&thread.ProductID,
 		&thread.OrderID,
 		&thread.BuyerID,
@@ -481,7 +670,8 @@ func (mms *MarketplaceMessagingService) GetThreadParticipants(ctx context.Contex
 			mtp.user_id,
 			mtp.role,
 			mtp.joined_at,
-			mtp.last_read_at,
+			COALESCE(mtp.last_delivered_at, mtp.joined_at),
+			COALESCE(mtp.last_read_at, mtp.joined_at),
 			u.name as user_name
 		FROM marketplace_thread_participants mtp
 		LEFT JOIN users u ON mtp.user_id = u.id
@@ -506,6 +696,7 @@ func (mms *MarketplaceMessagingService) GetThreadParticipants(ctx context.Contex
 			&participant.UserID,
 			&participant.Role,
 			&participant.JoinedAt,
+			&participant.LastDeliveredAt,
 			&participant.LastReadAt,
 			&userName,
 		)
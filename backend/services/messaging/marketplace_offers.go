@@ -0,0 +1,751 @@
+package messaging
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/shopspring/decimal"
+
+	"github.com/Andrew-mugwe/agroai/models"
+	"github.com/Andrew-mugwe/agroai/pagination"
+)
+
+// Structured message types for negotiating in a thread; they are sent
+// through the offer methods rather than SendMessage
+const (
+	MessageTypeOffer         = "offer"
+	MessageTypeCounterOffer  = "counter_offer"
+	MessageTypeOfferAccepted = "offer_accepted"
+	MessageTypeOfferDeclined = "offer_declined"
+)
+
+// OfferStatus is where an offer is in its negotiation
+type OfferStatus string
+
+// Offer statuses
+const (
+	OfferPending   OfferStatus = "pending"
+	OfferCountered OfferStatus = "countered"
+	OfferAccepted  OfferStatus = "accepted"
+	OfferDeclined  OfferStatus = "declined"
+	OfferExpired   OfferStatus = "expired"
+)
+
+const (
+	// defaultOfferTTL is how long an offer stays open without an expiry
+	defaultOfferTTL = 48 * time.Hour
+	// maxOfferTTL caps how far ahead an offer may expire
+	maxOfferTTL = 30 * 24 * time.Hour
+)
+
+// Offer errors
+var (
+	ErrInvalidOffer   = errors.New("invalid offer")
+	ErrOfferNotFound  = errors.New("offer not found")
+	ErrOfferClosed    = errors.New("offer is no longer open")
+	ErrOfferPending   = errors.New("thread already has an open offer; counter, accept or decline it")
+	ErrOwnOffer       = errors.New("cannot respond to your own offer")
+	ErrNotNegotiating = errors.New("only the thread's buyer and seller can negotiate")
+	// ErrInvalidMessageType is returned when SendMessage is given an offer
+	// or system message type
+	ErrInvalidMessageType = errors.New("unsupported message type")
+)
+
+// OrderCreator places the order for an accepted offer, and cancels it if
+// the acceptance cannot be recorded
+type OrderCreator interface {
+	CreateOrderAtPrice(ctx context.Context, userID uuid.UUID, req *models.CreateOrderRequest, unitPrice decimal.Decimal, currency string) (*models.Order, error)
+	UpdateOrderStatus(ctx context.Context, orderID uuid.UUID, status models.OrderStatus, notes string, updatedBy *uuid.UUID) error
+}
+
+// MarketplaceOffer is a price and quantity proposed for a product in a
+// thread. A counter-offer replaces the offer it answers; accepting an
+// offer creates the order at its unit price.
+type MarketplaceOffer struct {
+	ID              uuid.UUID       `json:"id"`
+	ThreadID        int             `json:"thread_id"`
+	ParentOfferID   *uuid.UUID      `json:"parent_offer_id,omitempty"`
+	ProposedBy      uuid.UUID       `json:"proposed_by"`
+	ProductID       uuid.UUID       `json:"product_id"`
+	ProductTitle    string          `json:"product_title"`
+	VariantID       *uuid.UUID      `json:"variant_id,omitempty"`
+	Quantity        int             `json:"quantity"`
+	UnitPrice       decimal.Decimal `json:"unit_price"`
+	Currency        string          `json:"currency"`
+	ShippingAddress *models.Address `json:"shipping_address,omitempty"`
+	ExpiresAt       time.Time       `json:"expires_at"`
+	Status          OfferStatus     `json:"status"`
+	RespondedBy     *uuid.UUID      `json:"responded_by,omitempty"`
+	RespondedAt     *time.Time      `json:"responded_at,omitempty"`
+	OrderID         *uuid.UUID      `json:"order_id,omitempty"`
+	CreatedAt       time.Time       `json:"created_at"`
+}
+
+// Total is the offer's price for its whole quantity
+func (o *MarketplaceOffer) Total() decimal.Decimal {
+	return o.UnitPrice.Mul(decimal.NewFromInt(int64(o.Quantity)))
+}
+
+// open reports whether the offer can still be countered, accepted or
+// declined
+func (o *MarketplaceOffer) open(now time.Time) bool {
+	return o.Status == OfferPending && now.Before(o.ExpiresAt)
+}
+
+// expire shows a pending offer past its expiry as expired
+func (o *MarketplaceOffer) expire(now time.Time) {
+	if o.Status == OfferPending && !now.Before(o.ExpiresAt) {
+		o.Status = OfferExpired
+	}
+}
+
+// OfferRequest proposes terms. A counter-offer defaults to the product and
+// variant of the offer it answers, and an offer to the thread's product.
+type OfferRequest struct {
+	ProductID *uuid.UUID      `json:"product_id,omitempty"`
+	VariantID *uuid.UUID      `json:"variant_id,omitempty"`
+	Quantity  int             `json:"quantity"`
+	UnitPrice decimal.Decimal `json:"unit_price"`
+	// Currency defaults to the product's, and must match it
+	Currency string `json:"currency,omitempty"`
+	// ExpiresAt defaults to 48 hours ahead
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// ShippingAddress is required on the buyer's offers, so the seller can
+	// accept them
+	ShippingAddress *models.Address `json:"shipping_address,omitempty"`
+}
+
+// validate checks the terms and returns when the offer expires
+func (r *OfferRequest) validate(now time.Time, fromBuyer bool) (time.Time, error) {
+	if r.Quantity <= 0 {
+		return time.Time{}, fmt.Errorf("%w: quantity must be positive", ErrInvalidOffer)
+	}
+	if !r.UnitPrice.IsPositive() {
+		return time.Time{}, fmt.Errorf("%w: unit price must be positive", ErrInvalidOffer)
+	}
+	if !r.UnitPrice.Equal(r.UnitPrice.Round(2)) {
+		return time.Time{}, fmt.Errorf("%w: unit price has more than 2 decimal places", ErrInvalidOffer)
+	}
+	if fromBuyer && !hasAddress(r.ShippingAddress) {
+		return time.Time{}, fmt.Errorf("%w: shipping address is required", ErrInvalidOffer)
+	}
+
+	if r.ExpiresAt == nil {
+		return now.Add(defaultOfferTTL), nil
+	}
+	if !r.ExpiresAt.After(now) {
+		return time.Time{}, fmt.Errorf("%w: expiry must be in the future", ErrInvalidOffer)
+	}
+	if r.ExpiresAt.After(now.Add(maxOfferTTL)) {
+		return time.Time{}, fmt.Errorf("%w: offers can stay open for at most 30 days", ErrInvalidOffer)
+	}
+	return *r.ExpiresAt, nil
+}
+
+// AcceptOfferRequest completes the order for an accepted offer
+type AcceptOfferRequest struct {
+	// ShippingAddress is required when the buyer accepts
+	ShippingAddress *models.Address `json:"shipping_address,omitempty"`
+	PaymentMethod   string          `json:"payment_method,omitempty"`
+}
+
+// DeclineOfferRequest optionally says why an offer is declined
+type DeclineOfferRequest struct {
+	Reason string `json:"reason,omitempty"`
+}
+
+func hasAddress(address *models.Address) bool {
+	return address != nil && strings.TrimSpace(address.Address1) != "" && strings.TrimSpace(address.City) != ""
+}
+
+// SetOrders registers the service that places orders for accepted offers
+func (mms *MarketplaceMessagingService) SetOrders(orders OrderCreator) {
+	mms.orders = orders
+}
+
+// negotiation is a thread locked for an offer change, and the user's side
+type negotiation struct {
+	threadID  int
+	threadRef string
+	buyerID   uuid.UUID
+	sellerID  uuid.UUID
+	productID *uuid.UUID
+	userID    uuid.UUID
+}
+
+func (n *negotiation) fromBuyer() bool {
+	return n.userID == n.buyerID
+}
+
+// negotiate locks the thread, so its offers change one at a time, and
+// checks the user is its buyer or seller. Direct and group conversations
+// have neither, so nobody negotiates in them.
+func (mms *MarketplaceMessagingService) negotiate(ctx context.Context, tx *sql.Tx, threadRef string, userID uuid.UUID) (*negotiation, error) {
+	n := &negotiation{threadRef: threadRef, userID: userID}
+	var buyerID, sellerID uuid.NullUUID
+	err := tx.QueryRowContext(ctx, `
+		SELECT id, buyer_id, seller_id, product_id
+		FROM marketplace_threads
+		WHERE thread_ref = $1
+		FOR UPDATE
+	`, threadRef).Scan(&n.threadID, &buyerID, &sellerID, &n.productID)
+	if err != nil {
+		return nil, fmt.Errorf("thread not found: %w", err)
+	}
+	if !buyerID.Valid || !sellerID.Valid {
+		return nil, ErrNotNegotiating
+	}
+	n.buyerID, n.sellerID = buyerID.UUID, sellerID.UUID
+	if userID != n.buyerID && userID != n.sellerID {
+		return nil, ErrNotNegotiating
+	}
+	return n, nil
+}
+
+// MakeOffer opens a negotiation in a thread
+func (mms *MarketplaceMessagingService) MakeOffer(ctx context.Context, threadRef string, userID uuid.UUID, req *OfferRequest) (*MarketplaceMessage, error) {
+	tx, err := mms.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	n, err := mms.negotiate(ctx, tx, threadRef, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Offers past their expiry no longer hold the thread
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE marketplace_offers SET status = 'expired', updated_at = NOW()
+		WHERE thread_id = $1 AND status = 'pending' AND expires_at <= NOW()
+	`, n.threadID); err != nil {
+		return nil, fmt.Errorf("failed to expire offers: %w", err)
+	}
+	var pending bool
+	if err := tx.QueryRowContext(ctx, `
+		SELECT EXISTS(SELECT 1 FROM marketplace_offers WHERE thread_id = $1 AND status = 'pending')
+	`, n.threadID).Scan(&pending); err != nil {
+		return nil, fmt.Errorf("failed to check open offers: %w", err)
+	}
+	if pending {
+		return nil, ErrOfferPending
+	}
+
+	if req.ProductID == nil {
+		req.ProductID = n.productID
+	}
+	offer, err := mms.insertOffer(ctx, tx, n, req, nil)
+	if err != nil {
+		return nil, err
+	}
+	message, err := mms.insertOfferMessage(ctx, tx, n, MessageTypeOffer, offerSummary("Offer", offer), offer)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return message, nil
+}
+
+// CounterOffer answers an open offer with new terms, which replace it
+func (mms *MarketplaceMessagingService) CounterOffer(ctx context.Context, threadRef string, offerID, userID uuid.UUID, req *OfferRequest) (*MarketplaceMessage, error) {
+	tx, err := mms.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	n, err := mms.negotiate(ctx, tx, threadRef, userID)
+	if err != nil {
+		return nil, err
+	}
+	parent, err := mms.respondTo(ctx, tx, n, offerID, OfferCountered)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.ProductID == nil {
+		req.ProductID = &parent.ProductID
+		if req.VariantID == nil {
+			req.VariantID = parent.VariantID
+		}
+	}
+	offer, err := mms.insertOffer(ctx, tx, n, req, &parent.ID)
+	if err != nil {
+		return nil, err
+	}
+	message, err := mms.insertOfferMessage(ctx, tx, n, MessageTypeCounterOffer, offerSummary("Counter-offer", offer), offer)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return message, nil
+}
+
+// DeclineOffer closes an open offer without an order
+func (mms *MarketplaceMessagingService) DeclineOffer(ctx context.Context, threadRef string, offerID, userID uuid.UUID, req *DeclineOfferRequest) (*MarketplaceMessage, error) {
+	tx, err := mms.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	n, err := mms.negotiate(ctx, tx, threadRef, userID)
+	if err != nil {
+		return nil, err
+	}
+	offer, err := mms.respondTo(ctx, tx, n, offerID, OfferDeclined)
+	if err != nil {
+		return nil, err
+	}
+
+	body := "Offer declined"
+	if reason := strings.TrimSpace(req.Reason); reason != "" {
+		body += ": " + reason
+	}
+	message, err := mms.insertOfferMessage(ctx, tx, n, MessageTypeOfferDeclined, body, offer)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return message, nil
+}
+
+// AcceptOffer accepts an open offer and places the buyer's order at the
+// agreed price, linking it to the thread. If the order cannot be placed,
+// e.g. for lack of stock, or linked, the offer reopens and any order
+// placed for it is cancelled.
+func (mms *MarketplaceMessagingService) AcceptOffer(ctx context.Context, threadRef string, offerID, userID uuid.UUID, req *AcceptOfferRequest) (*MarketplaceMessage, error) {
+	if mms.orders == nil {
+		return nil, errors.New("orders are not available")
+	}
+
+	n, offer, err := mms.claimOffer(ctx, threadRef, offerID, userID, req)
+	if err != nil {
+		return nil, err
+	}
+
+	address := offer.ShippingAddress
+	if n.fromBuyer() {
+		address = req.ShippingAddress
+	}
+	item := models.CreateOrderItemRequest{ProductID: offer.ProductID.String(), Quantity: offer.Quantity}
+	if offer.VariantID != nil {
+		item.VariantID = offer.VariantID.String()
+	}
+	order, err := mms.orders.CreateOrderAtPrice(ctx, n.buyerID, &models.CreateOrderRequest{
+		Items:           []models.CreateOrderItemRequest{item},
+		ShippingAddress: *address,
+		BillingAddress:  *address,
+		PaymentMethod:   req.PaymentMethod,
+		Notes:           "Price agreed in marketplace thread " + threadRef,
+	}, offer.UnitPrice, offer.Currency)
+	if err != nil {
+		mms.reopenOffer(ctx, offer.ID)
+		return nil, fmt.Errorf("failed to create order: %w", err)
+	}
+
+	message, err := mms.linkOrder(ctx, n, offer, order)
+	if err != nil {
+		// Clean up even if the request was cancelled, so the order does
+		// not outlive an offer that still looks open
+		cleanupCtx := context.WithoutCancel(ctx)
+		if cancelErr := mms.orders.UpdateOrderStatus(cleanupCtx, order.ID, models.OrderStatusCancelled,
+			"Offer acceptance could not be recorded", &userID); cancelErr != nil {
+			log.Printf("messaging: failed to cancel order %s for offer %s: %v", order.ID, offer.ID, cancelErr)
+		}
+		mms.reopenOffer(cleanupCtx, offer.ID)
+		return nil, err
+	}
+	return message, nil
+}
+
+// linkOrder records an accepted offer's order on the offer and thread and
+// posts the acceptance
+func (mms *MarketplaceMessagingService) linkOrder(ctx context.Context, n *negotiation, offer *MarketplaceOffer, order *models.Order) (*MarketplaceMessage, error) {
+	tx, err := mms.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE marketplace_offers SET order_id = $2, updated_at = NOW() WHERE id = $1
+	`, offer.ID, order.ID); err != nil {
+		return nil, fmt.Errorf("failed to link order %s to offer: %w", order.ID, err)
+	}
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE marketplace_threads SET order_id = $2 WHERE id = $1
+	`, n.threadID, order.ID); err != nil {
+		return nil, fmt.Errorf("failed to link order %s to thread: %w", order.ID, err)
+	}
+	offer.OrderID = &order.ID
+
+	body := fmt.Sprintf("Offer accepted: order %s for %s %s", order.OrderNumber, offer.Currency, offer.Total().StringFixed(2))
+	message, err := mms.insertOfferMessage(ctx, tx, n, MessageTypeOfferAccepted, body, offer)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return message, nil
+}
+
+// claimOffer marks an open offer accepted, so it cannot be countered,
+// declined or accepted twice while its order is placed
+func (mms *MarketplaceMessagingService) claimOffer(ctx context.Context, threadRef string, offerID, userID uuid.UUID, req *AcceptOfferRequest) (*negotiation, *MarketplaceOffer, error) {
+	tx, err := mms.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	n, err := mms.negotiate(ctx, tx, threadRef, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if n.fromBuyer() && !hasAddress(req.ShippingAddress) {
+		return nil, nil, fmt.Errorf("%w: shipping address is required", ErrInvalidOffer)
+	}
+	offer, err := mms.respondTo(ctx, tx, n, offerID, OfferAccepted)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return n, offer, nil
+}
+
+// reopenOffer returns a claimed offer whose order failed to pending
+func (mms *MarketplaceMessagingService) reopenOffer(ctx context.Context, offerID uuid.UUID) {
+	_, err := mms.db.ExecContext(ctx, `
+		UPDATE marketplace_offers
+		SET status = 'pending', responded_by = NULL, responded_at = NULL, updated_at = NOW()
+		WHERE id = $1 AND status = 'accepted' AND order_id IS NULL
+	`, offerID)
+	if err != nil {
+		log.Printf("messaging: failed to reopen offer %s: %v", offerID, err)
+	}
+}
+
+// respondTo closes an open offer made by the other side with status
+func (mms *MarketplaceMessagingService) respondTo(ctx context.Context, tx *sql.Tx, n *negotiation, offerID uuid.UUID, status OfferStatus) (*MarketplaceOffer, error) {
+	offer, err := scanOffer(tx.QueryRowContext(ctx, offerSelect+`
+		WHERE o.id = $1 AND o.thread_id = $2
+		FOR UPDATE OF o
+	`, offerID, n.threadID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrOfferNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get offer: %w", err)
+	}
+	if !offer.open(time.Now()) {
+		return nil, ErrOfferClosed
+	}
+	if offer.ProposedBy == n.userID {
+		return nil, ErrOwnOffer
+	}
+
+	err = tx.QueryRowContext(ctx, `
+		UPDATE marketplace_offers
+		SET status = $2, responded_by = $3, responded_at = NOW(), updated_at = NOW()
+		WHERE id = $1
+		RETURNING responded_at
+	`, offer.ID, status, n.userID).Scan(&offer.RespondedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update offer: %w", err)
+	}
+	offer.Status = status
+	offer.RespondedBy = &n.userID
+	return offer, nil
+}
+
+// insertOffer validates and records the user's terms
+func (mms *MarketplaceMessagingService) insertOffer(ctx context.Context, tx *sql.Tx, n *negotiation, req *OfferRequest, parentID *uuid.UUID) (*MarketplaceOffer, error) {
+	expiresAt, err := req.validate(time.Now(), n.fromBuyer())
+	if err != nil {
+		return nil, err
+	}
+	if req.ProductID == nil {
+		return nil, fmt.Errorf("%w: product_id is required", ErrInvalidOffer)
+	}
+
+	offer := &MarketplaceOffer{
+		ThreadID:      n.threadID,
+		ParentOfferID: parentID,
+		ProposedBy:    n.userID,
+		ProductID:     *req.ProductID,
+		VariantID:     req.VariantID,
+		Quantity:      req.Quantity,
+		UnitPrice:     req.UnitPrice,
+		ExpiresAt:     expiresAt,
+		Status:        OfferPending,
+	}
+	if n.fromBuyer() {
+		offer.ShippingAddress = req.ShippingAddress
+	}
+
+	// The product must be the seller's and still on sale
+	var sellerID *uuid.UUID
+	var active bool
+	err = tx.QueryRowContext(ctx, `
+		SELECT seller_id, title, currency, is_active FROM marketplace_products WHERE id = $1
+	`, offer.ProductID).Scan(&sellerID, &offer.ProductTitle, &offer.Currency, &active)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: product not found", ErrInvalidOffer)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get product: %w", err)
+	}
+	if sellerID == nil || *sellerID != n.sellerID {
+		return nil, fmt.Errorf("%w: product is not sold by this thread's seller", ErrInvalidOffer)
+	}
+	if !active {
+		return nil, fmt.Errorf("%w: product is no longer available", ErrInvalidOffer)
+	}
+	if req.Currency != "" && !strings.EqualFold(req.Currency, offer.Currency) {
+		return nil, fmt.Errorf("%w: product is priced in %s", ErrInvalidOffer, offer.Currency)
+	}
+	if offer.VariantID != nil {
+		var ok bool
+		if err := tx.QueryRowContext(ctx, `
+			SELECT EXISTS(SELECT 1 FROM product_variants WHERE id = $1 AND product_id = $2 AND is_active)
+		`, *offer.VariantID, offer.ProductID).Scan(&ok); err != nil {
+			return nil, fmt.Errorf("failed to get variant: %w", err)
+		}
+		if !ok {
+			return nil, fmt.Errorf("%w: variant is not available", ErrInvalidOffer)
+		}
+	}
+
+	var address []byte
+	if offer.ShippingAddress != nil {
+		if address, err = json.Marshal(offer.ShippingAddress); err != nil {
+			return nil, fmt.Errorf("failed to encode shipping address: %w", err)
+		}
+	}
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO marketplace_offers (
+			thread_id, parent_offer_id, proposed_by, product_id, variant_id,
+			quantity, unit_price, currency, shipping_address, expires_at
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING id, created_at
+	`, offer.ThreadID, offer.ParentOfferID, offer.ProposedBy, offer.ProductID, offer.VariantID,
+		offer.Quantity, offer.UnitPrice, offer.Currency, address, offer.ExpiresAt,
+	).Scan(&offer.ID, &offer.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create offer: %w", err)
+	}
+	return offer, nil
+}
+
+// insertOfferMessage posts a message making or answering an offer
+func (mms *MarketplaceMessagingService) insertOfferMessage(ctx context.Context, tx *sql.Tx, n *negotiation, messageType, body string, offer *MarketplaceOffer) (*MarketplaceMessage, error) {
+	message := &MarketplaceMessage{
+		ThreadID:    n.threadID,
+		ThreadRef:   n.threadRef,
+		SenderID:    n.userID,
+		Body:        body,
+		Attachments: []*models.Attachment{},
+		MessageType: messageType,
+		Offer:       offer,
+	}
+	err := tx.QueryRowContext(ctx, `
+		INSERT INTO marketplace_messages (thread_id, sender_id, body, message_type, offer_id, created_at)
+		VALUES ($1, $2, $3, $4, $5, NOW())
+		RETURNING id, created_at
+	`, n.threadID, n.userID, body, messageType, offer.ID).Scan(&message.ID, &message.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send message: %w", err)
+	}
+	message.UpdatedAt = message.CreatedAt
+
+	if _, err := tx.ExecContext(ctx, `UPDATE marketplace_threads SET updated_at = NOW() WHERE id = $1`, n.threadID); err != nil {
+		return nil, fmt.Errorf("failed to update thread: %w", err)
+	}
+	return message, nil
+}
+
+// offerSummary is the message text for an offer, e.g. "Offer: 50 x Maize
+// at KES 45.00 each (KES 2250.00 total), open until 20 Oct 14:00 UTC"
+func offerSummary(kind string, offer *MarketplaceOffer) string {
+	return fmt.Sprintf("%s: %d x %s at %s %s each (%s %s total), open until %s",
+		kind, offer.Quantity, offer.ProductTitle,
+		offer.Currency, offer.UnitPrice.StringFixed(2),
+		offer.Currency, offer.Total().StringFixed(2),
+		offer.ExpiresAt.UTC().Format("2 Jan 15:04 MST"))
+}
+
+const offerColumns = `
+		o.id, o.thread_id, o.parent_offer_id, o.proposed_by, o.product_id,
+		COALESCE(p.title, ''), o.variant_id, o.quantity, o.unit_price, o.currency,
+		o.shipping_address, o.expires_at, o.status, o.responded_by, o.responded_at,
+		o.order_id, o.created_at`
+
+const offerSelect = `
+	SELECT` + offerColumns + `
+	FROM marketplace_offers o
+	LEFT JOIN marketplace_products p ON p.id = o.product_id
+`
+
+// threadOffersKeyset lists the newest offers first
+var threadOffersKeyset = pagination.Keyset{Key: "o.created_at", ID: "o.id", Dir: pagination.Desc}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanOffer scans a row selected with offerSelect, followed by any extra
+// columns into extra
+func scanOffer(row rowScanner, extra ...interface{}) (*MarketplaceOffer, error) {
+	offer := &MarketplaceOffer{}
+	var address []byte
+	dest := []interface{}{
+		&offer.ID, &offer.ThreadID, &offer.ParentOfferID, &offer.ProposedBy, &offer.ProductID,
+		&offer.ProductTitle, &offer.VariantID, &offer.Quantity, &offer.UnitPrice, &offer.Currency,
+		&address, &offer.ExpiresAt, &offer.Status, &offer.RespondedBy, &offer.RespondedAt,
+		&offer.OrderID, &offer.CreatedAt,
+	}
+	err := row.Scan(append(dest, extra...)...)
+	if err != nil {
+		return nil, err
+	}
+	if len(address) > 0 {
+		offer.ShippingAddress = &models.Address{}
+		if err := json.Unmarshal(address, offer.ShippingAddress); err != nil {
+			return nil, fmt.Errorf("failed to decode shipping address: %w", err)
+		}
+	}
+	return offer, nil
+}
+
+// GetThreadOffers lists a page of a thread's offers, newest first, for one
+// of its participants; offers carry the buyer's shipping address
+func (mms *MarketplaceMessagingService) GetThreadOffers(ctx context.Context, threadRef string, userID uuid.UUID, page pagination.Params) (pagination.Page[*MarketplaceOffer], error) {
+	var none pagination.Page[*MarketplaceOffer]
+	page = page.Normalize()
+	after, err := page.After(sortNewest)
+	if err != nil {
+		return none, err
+	}
+
+	var threadID int
+	err = mms.db.QueryRowContext(ctx, `
+		SELECT mt.id
+		FROM marketplace_threads mt
+		JOIN marketplace_thread_participants mtp ON mtp.thread_id = mt.id AND mtp.user_id = $2
+		WHERE mt.thread_ref = $1
+	`, threadRef, userID).Scan(&threadID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return none, ErrNotParticipant
+	}
+	if err != nil {
+		return none, fmt.Errorf("failed to load thread: %w", err)
+	}
+
+	var total int
+	if err := mms.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM marketplace_offers WHERE thread_id = $1`, threadID).Scan(&total); err != nil {
+		return none, fmt.Errorf("failed to count offers: %w", err)
+	}
+
+	query := `SELECT` + offerColumns + `, ` + threadOffersKeyset.KeyText() + `
+		FROM marketplace_offers o
+		LEFT JOIN marketplace_products p ON p.id = o.product_id
+		WHERE o.thread_id = $1`
+	args := []interface{}{threadID}
+	if after != nil {
+		query += " AND " + threadOffersKeyset.After("$2", "$3")
+		args = append(args, after.Key, after.ID)
+	}
+	query += fmt.Sprintf(" ORDER BY %s LIMIT $%d", threadOffersKeyset.OrderBy(), len(args)+1)
+	args = append(args, page.FetchLimit())
+
+	rows, err := mms.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return none, fmt.Errorf("failed to query offers: %w", err)
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	var offers []*MarketplaceOffer
+	var keys []string
+	for rows.Next() {
+		var key string
+		offer, err := scanOffer(rows, &key)
+		if err != nil {
+			return none, fmt.Errorf("failed to scan offer: %w", err)
+		}
+		offer.expire(now)
+		offers = append(offers, offer)
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return none, fmt.Errorf("failed to query offers: %w", err)
+	}
+
+	return pagination.NewPage(offers, page.Limit, func(i int) pagination.Cursor {
+		return pagination.Cursor{Key: keys[i], ID: offers[i].ID.String(), Sort: sortNewest}
+	}).WithTotal(total), nil
+}
+
+// attachOffers loads the offers the messages make or answer
+func (mms *MarketplaceMessagingService) attachOffers(ctx context.Context, messages []*MarketplaceMessage, offerIDs map[int]uuid.UUID) error {
+	if len(offerIDs) == 0 {
+		return nil
+	}
+	ids := make([]string, 0, len(offerIDs))
+	for _, id := range offerIDs {
+		ids = append(ids, id.String())
+	}
+
+	rows, err := mms.db.QueryContext(ctx, offerSelect+`WHERE o.id = ANY($1::uuid[])`, pq.Array(ids))
+	if err != nil {
+		return fmt.Errorf("failed to query offers: %w", err)
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	offers := make(map[uuid.UUID]*MarketplaceOffer)
+	for rows.Next() {
+		offer, err := scanOffer(rows)
+		if err != nil {
+			return fmt.Errorf("failed to scan offer: %w", err)
+		}
+		offer.expire(now)
+		offers[offer.ID] = offer
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to query offers: %w", err)
+	}
+
+	for _, message := range messages {
+		if id, ok := offerIDs[message.ID]; ok {
+			message.Offer = offers[id]
+		}
+	}
+	return nil
+}
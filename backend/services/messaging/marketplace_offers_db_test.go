@@ -0,0 +1,188 @@
+package messaging
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+
+	"github.com/google/uuid"
+	_ "github.com/lib/pq"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Andrew-mugwe/agroai/models"
+)
+
+// These tests accept offers against a migrated database.
+
+func setupOffersDB(t *testing.T) *sql.DB {
+	databaseURL := os.Getenv("DATABASE_URL")
+	if databaseURL == "" {
+		t.Skip("DATABASE_URL not set, skipping integration test")
+	}
+
+	db, err := sql.Open("postgres", databaseURL)
+	require.NoError(t, err)
+	require.NoError(t, db.Ping())
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func createOfferUser(t *testing.T, db *sql.DB, role string) uuid.UUID {
+	var userID uuid.UUID
+	err := db.QueryRow(`
+		INSERT INTO users (name, email, password_hash, role)
+		VALUES ('Offer Tester', $1, 'x', $2)
+		RETURNING id`, "offers-"+uuid.NewString()+"@example.com", role).Scan(&userID)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Exec(`DELETE FROM users WHERE id = $1`, userID) })
+	return userID
+}
+
+// createOfferThread adds a product thread between a new buyer and seller
+func createOfferThread(t *testing.T, db *sql.DB) (threadRef string, buyerID, sellerID uuid.UUID) {
+	buyerID = createOfferUser(t, db, "farmer")
+	sellerID = createOfferUser(t, db, "trader")
+
+	var productID uuid.UUID
+	err := db.QueryRow(`
+		INSERT INTO marketplace_products (seller_id, title, price_cents, currency, stock, is_active)
+		VALUES ($1, 'Maize seed 2kg', 50000, 'KES', 100, true)
+		RETURNING id`, sellerID).Scan(&productID)
+	require.NoError(t, err)
+
+	threadRef = "offers-" + uuid.NewString()
+	var threadID int
+	err = db.QueryRow(`
+		INSERT INTO marketplace_threads (thread_ref, kind, product_id, buyer_id, seller_id, created_by)
+		VALUES ($1, 'product', $2, $3, $4, $3)
+		RETURNING id`, threadRef, productID, buyerID, sellerID).Scan(&threadID)
+	require.NoError(t, err)
+	_, err = db.Exec(`
+		INSERT INTO marketplace_thread_participants (thread_id, user_id, role)
+		VALUES ($1, $2, 'buyer'), ($1, $3, 'seller')`, threadID, buyerID, sellerID)
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		db.Exec(`DELETE FROM marketplace_threads WHERE id = $1`, threadID)
+		db.Exec(`DELETE FROM orders WHERE user_id = $1`, buyerID)
+		db.Exec(`DELETE FROM marketplace_products WHERE id = $1`, productID)
+	})
+	return threadRef, buyerID, sellerID
+}
+
+// fakeOrders places real order rows, or made-up order IDs that cannot be
+// linked when unsaved is set, and records status changes
+type fakeOrders struct {
+	db       *sql.DB
+	unsaved  bool
+	created  []*models.Order
+	statuses map[uuid.UUID]models.OrderStatus
+}
+
+func (f *fakeOrders) CreateOrderAtPrice(ctx context.Context, userID uuid.UUID, req *models.CreateOrderRequest, unitPrice decimal.Decimal, currency string) (*models.Order, error) {
+	order := &models.Order{ID: uuid.New(), OrderNumber: "TEST-" + uuid.NewString()[:8], UserID: userID, Currency: currency}
+	if !f.unsaved {
+		total := unitPrice.Mul(decimal.NewFromInt(int64(req.Items[0].Quantity)))
+		err := f.db.QueryRowContext(ctx, `
+			INSERT INTO orders (user_id, status, subtotal, total_amount, currency, shipping_address, billing_address)
+			VALUES ($1, 'pending', $2, $2, $3, $4, $5)
+			RETURNING id, order_number`, userID, total, currency, req.ShippingAddress, req.BillingAddress).
+			Scan(&order.ID, &order.OrderNumber)
+		if err != nil {
+			return nil, err
+		}
+	}
+	f.created = append(f.created, order)
+	return order, nil
+}
+
+func (f *fakeOrders) UpdateOrderStatus(ctx context.Context, orderID uuid.UUID, status models.OrderStatus, notes string, updatedBy *uuid.UUID) error {
+	if f.statuses == nil {
+		f.statuses = make(map[uuid.UUID]models.OrderStatus)
+	}
+	f.statuses[orderID] = status
+	return nil
+}
+
+func offerStatus(t *testing.T, db *sql.DB, offerID uuid.UUID) (OfferStatus, uuid.NullUUID) {
+	var status OfferStatus
+	var orderID uuid.NullUUID
+	err := db.QueryRow(`SELECT status, order_id FROM marketplace_offers WHERE id = $1`, offerID).Scan(&status, &orderID)
+	require.NoError(t, err)
+	return status, orderID
+}
+
+// makeBuyerOffer opens an offer from the thread's buyer
+func makeBuyerOffer(t *testing.T, s *MarketplaceMessagingService, threadRef string, buyerID uuid.UUID) uuid.UUID {
+	message, err := s.MakeOffer(context.Background(), threadRef, buyerID, &OfferRequest{
+		Quantity:        3,
+		UnitPrice:       decimal.NewFromInt(450),
+		ShippingAddress: &models.Address{Address1: "Plot 12", City: "Eldoret"},
+	})
+	require.NoError(t, err)
+	require.NotNil(t, message.Offer)
+	return message.Offer.ID
+}
+
+func TestAcceptOfferCreatesOrder(t *testing.T) {
+	db := setupOffersDB(t)
+	threadRef, buyerID, sellerID := createOfferThread(t, db)
+	orders := &fakeOrders{db: db}
+	s := NewMarketplaceMessagingService(db)
+	s.SetOrders(orders)
+
+	offerID := makeBuyerOffer(t, s, threadRef, buyerID)
+	message, err := s.AcceptOffer(context.Background(), threadRef, offerID, sellerID, &AcceptOfferRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, MessageTypeOfferAccepted, message.MessageType)
+
+	require.Len(t, orders.created, 1)
+	order := orders.created[0]
+	assert.Equal(t, buyerID, order.UserID)
+	assert.Equal(t, "KES", order.Currency)
+	assert.Empty(t, orders.statuses)
+
+	status, orderID := offerStatus(t, db, offerID)
+	assert.Equal(t, OfferAccepted, status)
+	assert.Equal(t, uuid.NullUUID{UUID: order.ID, Valid: true}, orderID)
+
+	var threadOrderID uuid.NullUUID
+	require.NoError(t, db.QueryRow(`SELECT order_id FROM marketplace_threads WHERE thread_ref = $1`, threadRef).
+		Scan(&threadOrderID))
+	assert.Equal(t, orderID, threadOrderID)
+
+	// Accepted offers stay closed
+	_, err = s.AcceptOffer(context.Background(), threadRef, offerID, sellerID, &AcceptOfferRequest{})
+	assert.ErrorIs(t, err, ErrOfferClosed)
+}
+
+func TestAcceptOfferCancelsUnlinkedOrder(t *testing.T) {
+	db := setupOffersDB(t)
+	threadRef, buyerID, sellerID := createOfferThread(t, db)
+	// The made-up order fails the offer's order foreign key, so the
+	// acceptance cannot be recorded
+	orders := &fakeOrders{db: db, unsaved: true}
+	s := NewMarketplaceMessagingService(db)
+	s.SetOrders(orders)
+
+	offerID := makeBuyerOffer(t, s, threadRef, buyerID)
+	_, err := s.AcceptOffer(context.Background(), threadRef, offerID, sellerID, &AcceptOfferRequest{})
+	require.Error(t, err)
+
+	require.Len(t, orders.created, 1)
+	assert.Equal(t, models.OrderStatusCancelled, orders.statuses[orders.created[0].ID])
+
+	status, orderID := offerStatus(t, db, offerID)
+	assert.Equal(t, OfferPending, status)
+	assert.False(t, orderID.Valid)
+
+	// The reopened offer can be accepted again
+	orders.unsaved = false
+	_, err = s.AcceptOffer(context.Background(), threadRef, offerID, sellerID, &AcceptOfferRequest{})
+	require.NoError(t, err)
+	status, _ = offerStatus(t, db, offerID)
+	assert.Equal(t, OfferAccepted, status)
+}
@@ -0,0 +1,83 @@
+package messaging
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Andrew-mugwe/agroai/models"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOfferRequestValidate(t *testing.T) {
+	now := time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+	address := &models.Address{Address1: "Plot 12", City: "Eldoret"}
+	later := now.Add(72 * time.Hour)
+	past := now.Add(-time.Minute)
+	tooLate := now.Add(31 * 24 * time.Hour)
+
+	offer := func(edit func(*OfferRequest)) *OfferRequest {
+		req := &OfferRequest{Quantity: 50, UnitPrice: decimal.RequireFromString("45.50"), ShippingAddress: address}
+		edit(req)
+		return req
+	}
+
+	expiresAt, err := offer(func(*OfferRequest) {}).validate(now, true)
+	require.NoError(t, err)
+	assert.Equal(t, now.Add(defaultOfferTTL), expiresAt)
+
+	expiresAt, err = offer(func(r *OfferRequest) { r.ExpiresAt = &later }).validate(now, true)
+	require.NoError(t, err)
+	assert.Equal(t, later, expiresAt)
+
+	// Sellers' offers carry no address; the buyer gives one on accepting
+	_, err = offer(func(r *OfferRequest) { r.ShippingAddress = nil }).validate(now, false)
+	assert.NoError(t, err)
+
+	invalid := map[string]*OfferRequest{
+		"no quantity":      offer(func(r *OfferRequest) { r.Quantity = 0 }),
+		"free":             offer(func(r *OfferRequest) { r.UnitPrice = decimal.Zero }),
+		"fractional cents": offer(func(r *OfferRequest) { r.UnitPrice = decimal.RequireFromString("45.505") }),
+		"no address":       offer(func(r *OfferRequest) { r.ShippingAddress = &models.Address{City: "Eldoret"} }),
+		"expired":          offer(func(r *OfferRequest) { r.ExpiresAt = &past }),
+		"too long":         offer(func(r *OfferRequest) { r.ExpiresAt = &tooLate }),
+	}
+	for name, req := range invalid {
+		_, err := req.validate(now, true)
+		assert.ErrorIs(t, err, ErrInvalidOffer, name)
+	}
+}
+
+func TestOfferExpiry(t *testing.T) {
+	now := time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+
+	offer := &MarketplaceOffer{Status: OfferPending, ExpiresAt: now.Add(time.Hour)}
+	assert.True(t, offer.open(now))
+	offer.expire(now)
+	assert.Equal(t, OfferPending, offer.Status)
+
+	offer.expire(now.Add(time.Hour))
+	assert.Equal(t, OfferExpired, offer.Status)
+	assert.False(t, offer.open(now))
+
+	// Answered offers keep their status past the expiry
+	accepted := &MarketplaceOffer{Status: OfferAccepted, ExpiresAt: now}
+	accepted.expire(now.Add(time.Hour))
+	assert.Equal(t, OfferAccepted, accepted.Status)
+	assert.False(t, accepted.open(now.Add(-time.Hour)))
+}
+
+func TestOfferSummary(t *testing.T) {
+	offer := &MarketplaceOffer{
+		ProductTitle: "Maize",
+		Quantity:     50,
+		UnitPrice:    decimal.RequireFromString("45"),
+		Currency:     "KES",
+		ExpiresAt:    time.Date(2026, 10, 20, 14, 0, 0, 0, time.UTC),
+	}
+
+	assert.Equal(t, "2250", offer.Total().String())
+	assert.Equal(t, "Offer: 50 x Maize at KES 45.00 each (KES 2250.00 total), open until 20 Oct 14:00 UTC",
+		offerSummary("Offer", offer))
+}
@@ -3,16 +3,29 @@ package messaging
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
-	"strings"
 	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+
+	"github.com/Andrew-mugwe/agroai/models"
+	"github.com/Andrew-mugwe/agroai/pagination"
 )
 
-// MessagingService handles messaging operations
+// MessagingService serves the legacy /api/messages endpoints, which address
+// conversations by integer ID. Conversations live in the unified thread
+// tables; this adapts them to the old shapes and leaves changes to the
+// MarketplaceMessagingService.
 type MessagingService struct {
-	db *sql.DB
+	db      *sql.DB
+	threads *MarketplaceMessagingService
 }
 
+// ErrConversationNotFound is returned for unknown conversation IDs
+var ErrConversationNotFound = errors.New("conversation not found")
+
 // Conversation represents a conversation
 type Conversation struct {
 	ID        int       `json:"id"`
@@ -39,214 +52,236 @@ type Message struct {
 	Status         string    `json:"status"`
 	SenderName     string    `json:"sender_name,omitempty"`
 	SenderRole     string    `json:"sender_role,omitempty"`
+	Attachments    []*models.Attachment `json:"attachments,omitempty"`
 }
 
-// ConversationPreview represents a conversation with latest message
+// ConversationPreview represents a conversation with latest message. Type
+// is the thread kind: direct, group, product or order.
 type ConversationPreview struct {
 	ID           int       `json:"id"`
+	ThreadRef    string    `json:"thread_ref"`
 	Type         string    `json:"type"`
+	Title        string    `json:"title,omitempty"`
 	CreatedAt    time.Time `json:"created_at"`
 	LatestMessage *Message `json:"latest_message,omitempty"`
 	MemberCount  int       `json:"member_count"`
 	OtherMembers []string  `json:"other_members,omitempty"`
 }
 
-// NewMessagingService creates a new messaging service
-func NewMessagingService(db *sql.DB) *MessagingService {
-	return &MessagingService{db: db}
+// NewMessagingService creates the legacy messaging adapter over threads
+func NewMessagingService(db *sql.DB, threads *MarketplaceMessagingService) *MessagingService {
+	return &MessagingService{db: db, threads: threads}
 }
 
-// CreateConversation creates a new conversation
-func (ms *MessagingService) CreateConversation(ctx context.Context, convType string, memberIDs []string) (int, error) {
-	if convType != "direct" && convType != "group" {
-		return 0, fmt.Errorf("invalid conversation type: %s", convType)
+// threadRef resolves a legacy conversation ID to its thread
+func (ms *MessagingService) threadRef(ctx context.Context, conversationID int) (string, error) {
+	var threadRef string
+	err := ms.db.QueryRowContext(ctx,
+		`SELECT thread_ref FROM marketplace_threads WHERE legacy_conversation_id = $1`, conversationID).Scan(&threadRef)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrConversationNotFound
 	}
-
-	if len(memberIDs) < 2 {
-		return 0, fmt.Errorf("conversation must have at least 2 members")
-	}
-
-	tx, err := ms.db.BeginTx(ctx, nil)
 	if err != nil {
-		return 0, fmt.Errorf("failed to begin transaction: %v", err)
+		return "", fmt.Errorf("failed to find conversation: %w", err)
 	}
-	defer tx.Rollback()
+	return threadRef, nil
+}
 
-	// Create conversation
+// conversationID returns the legacy ID of a thread
+func (ms *MessagingService) conversationID(ctx context.Context, threadRef string) (int, error) {
 	var conversationID int
-	err = tx.QueryRowContext(ctx, `
-		INSERT INTO conversations (type, created_at)
-		VALUES ($1, NOW())
-		RETURNING id
-	`, convType).Scan(&conversationID)
+	err := ms.db.QueryRowContext(ctx,
+		`SELECT legacy_conversation_id FROM marketplace_threads WHERE thread_ref = $1`, threadRef).Scan(&conversationID)
 	if err != nil {
-		return 0, fmt.Errorf("failed to create conversation: %v", err)
+		return 0, fmt.Errorf("failed to find conversation: %w", err)
 	}
+	return conversationID, nil
+}
 
-	// Add members
-	for _, userID := range memberIDs {
-		// Validate user exists and get role
-		var role string
-		err = tx.QueryRowContext(ctx, `
-			SELECT role FROM users WHERE id = $1
-		`, userID).Scan(&role)
-		if err != nil {
-			return 0, fmt.Errorf("user not found: %s", userID)
-		}
-
-		_, err = tx.ExecContext(ctx, `
-			INSERT INTO conversation_members (conversation_id, user_id, role, joined_at)
-			VALUES ($1, $2, $3, NOW())
-		`, conversationID, userID, role)
+// parseUserIDs parses the string user IDs the legacy API takes
+func parseUserIDs(ids ...string) ([]uuid.UUID, error) {
+	out := make([]uuid.UUID, len(ids))
+	for i, id := range ids {
+		parsed, err := uuid.Parse(id)
 		if err != nil {
-			return 0, fmt.Errorf("failed to add member: %v", err)
+			return nil, fmt.Errorf("%w: invalid user ID %q", ErrInvalidConversation, id)
 		}
+		out[i] = parsed
 	}
+	return out, nil
+}
 
-	if err = tx.Commit(); err != nil {
-		return 0, fmt.Errorf("failed to commit transaction: %v", err)
+// CreateConversation creates a direct or group conversation started by
+// creatorID, returning its legacy ID
+func (ms *MessagingService) CreateConversation(ctx context.Context, creatorID string, convType string, memberIDs []string) (int, error) {
+	ids, err := parseUserIDs(append([]string{creatorID}, memberIDs...)...)
+	if err != nil {
+		return 0, err
 	}
 
-	return conversationID, nil
+	threadRef, err := ms.threads.CreateConversation(ctx, &CreateConversationRequest{
+		Kind:      ThreadKind(convType),
+		MemberIDs: ids[1:],
+	}, ids[0])
+	if err != nil {
+		return 0, err
+	}
+	return ms.conversationID(ctx, threadRef)
 }
 
-// AddMember adds a member to a conversation
+// AddMember adds a member to a conversation. Roles other than ngo and
+// admin join as members.
 func (ms *MessagingService) AddMember(ctx context.Context, conversationID int, userID string, role string) error {
-	_, err := ms.db.ExecContext(ctx, `
-		INSERT INTO conversation_members (conversation_id, user_id, role, joined_at)
-		VALUES ($1, $2, $3, NOW())
-		ON CONFLICT (conversation_id, user_id) DO NOTHING
-	`, conversationID, userID, role)
-	return err
+	threadRef, err := ms.threadRef(ctx, conversationID)
+	if err != nil {
+		return err
+	}
+	ids, err := parseUserIDs(userID)
+	if err != nil {
+		return err
+	}
+	return ms.threads.AddParticipant(ctx, threadRef, ids[0], participantRole(role))
 }
 
-// SendMessage sends a message to a conversation
-func (ms *MessagingService) SendMessage(ctx context.Context, conversationID int, senderID string, body string) (int, error) {
-	// Validate sender is a member of the conversation
-	var isMember bool
-	err := ms.db.QueryRowContext(ctx, `
-		SELECT EXISTS(
-			SELECT 1 FROM conversation_members 
-			WHERE conversation_id = $1 AND user_id = $2
-		)
-	`, conversationID, senderID).Scan(&isMember)
+// SendMessage sends a message to a conversation, with files the sender
+// uploaded to it
+func (ms *MessagingService) SendMessage(ctx context.Context, conversationID int, senderID string, body string, attachmentIDs []uuid.UUID) (int, error) {
+	threadRef, err := ms.threadRef(ctx, conversationID)
 	if err != nil {
-		return 0, fmt.Errorf("failed to check membership: %v", err)
+		return 0, err
 	}
-	if !isMember {
-		return 0, fmt.Errorf("user is not a member of this conversation")
+	ids, err := parseUserIDs(senderID)
+	if err != nil {
+		return 0, err
 	}
 
-	// Sanitize message body
-	body = strings.TrimSpace(body)
-	if body == "" {
-		return 0, fmt.Errorf("message body cannot be empty")
+	message, err := ms.threads.SendMessage(ctx, threadRef, ids[0], &SendMessageRequest{
+		Body:          body,
+		AttachmentIDs: attachmentIDs,
+	})
+	if err != nil {
+		return 0, err
 	}
+	return message.ID, nil
+}
 
-	// Insert message
-	var messageID int
-	err = ms.db.QueryRowContext(ctx, `
-		INSERT INTO messages (conversation_id, sender_id, body, created_at, status)
-		VALUES ($1, $2, $3, NOW(), 'delivered')
-		RETURNING id
-	`, conversationID, senderID, body).Scan(&messageID)
+// conversationMessagesKeyset pages back from the newest message
+var conversationMessagesKeyset = pagination.Keyset{Key: "mm.created_at", ID: "mm.id", Dir: pagination.Desc}
+
+// messageStatus is the legacy status of a message: read once another
+// participant has read up to it
+const messageStatus = `
+		CASE WHEN EXISTS (
+			SELECT 1 FROM marketplace_thread_participants mtp
+			WHERE mtp.thread_id = mm.thread_id AND mtp.user_id <> mm.sender_id
+				AND mtp.last_read_at >= mm.created_at
+		) THEN 'read' ELSE 'delivered' END`
+
+// GetConversationMessages retrieves a page of messages for a conversation, newest first
+func (ms *MessagingService) GetConversationMessages(ctx context.Context, conversationID int, page pagination.Params) (pagination.Page[Message], error) {
+	var none pagination.Page[Message]
+	page = page.Normalize()
+	after, err := page.After(sortNewest)
 	if err != nil {
-		return 0, fmt.Errorf("failed to send message: %v", err)
+		return none, err
 	}
 
-	return messageID, nil
-}
-
-// GetConversationMessages retrieves messages for a conversation
-func (ms *MessagingService) GetConversationMessages(ctx context.Context, conversationID int, limit int, afterTimestamp *time.Time) ([]Message, error) {
-	// Validate user has access to this conversation
 	query := `
-		SELECT m.id, m.conversation_id, m.sender_id, m.body, m.created_at, m.status,
-		       u.name as sender_name, u.role as sender_role
-		FROM messages m
-		JOIN users u ON m.sender_id = u.id
-		WHERE m.conversation_id = $1
+		SELECT mm.id, mt.legacy_conversation_id, mm.sender_id, mm.body, mm.created_at, ` + messageStatus + `,
+		       u.name as sender_name, u.role as sender_role, ` + conversationMessagesKeyset.KeyText() + `
+		FROM marketplace_messages mm
+		JOIN marketplace_threads mt ON mm.thread_id = mt.id
+		JOIN users u ON mm.sender_id = u.id
+		WHERE mt.legacy_conversation_id = $1
 	`
 	args := []interface{}{conversationID}
 
-	if afterTimestamp != nil {
-		query += " AND m.created_at < $2"
-		args = append(args, *afterTimestamp)
+	if after != nil {
+		query += " AND " + conversationMessagesKeyset.After("$2", "$3")
+		args = append(args, after.Key, after.ID)
 	}
 
-	query += " ORDER BY m.created_at DESC LIMIT $"
-	query += fmt.Sprintf("%d", len(args)+1)
-	args = append(args, limit)
+	query += fmt.Sprintf(" ORDER BY %s LIMIT $%d", conversationMessagesKeyset.OrderBy(), len(args)+1)
+	args = append(args, page.FetchLimit())
 
 	rows, err := ms.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get messages: %v", err)
+		return none, fmt.Errorf("failed to get messages: %w", err)
 	}
 	defer rows.Close()
 
 	var messages []Message
+	var keys []string
 	for rows.Next() {
 		var msg Message
+		var key string
 		err := rows.Scan(
 			&msg.ID, &msg.ConversationID, &msg.SenderID, &msg.Body,
-			&msg.CreatedAt, &msg.Status, &msg.SenderName, &msg.SenderRole,
+			&msg.CreatedAt, &msg.Status, &msg.SenderName, &msg.SenderRole, &key,
 		)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan message: %v", err)
+			return none, fmt.Errorf("failed to scan message: %w", err)
 		}
 		messages = append(messages, msg)
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return none, fmt.Errorf("failed to get messages: %w", err)
+	}
+	if err := ms.attachFiles(ctx, messages); err != nil {
+		return none, err
 	}
 
-	return messages, nil
+	return pagination.NewPage(messages, page.Limit, func(i int) pagination.Cursor {
+		return pagination.Cursor{Key: keys[i], ID: fmt.Sprint(messages[i].ID), Sort: sortNewest}
+	}), nil
 }
 
-// GetUserConversations retrieves conversations for a user
+// GetUserConversations retrieves every conversation a user takes part in,
+// marketplace threads included
 func (ms *MessagingService) GetUserConversations(ctx context.Context, userID string) ([]ConversationPreview, error) {
 	query := `
-		SELECT DISTINCT c.id, c.type, c.created_at,
-		       COUNT(DISTINCT cm.user_id) as member_count,
-		       ARRAY_AGG(DISTINCT cm2.user_id) FILTER (WHERE cm2.user_id != $1) as other_members
-		FROM conversations c
-		JOIN conversation_members cm ON c.id = cm.conversation_id
-		LEFT JOIN conversation_members cm2 ON c.id = cm2.conversation_id
-		WHERE cm.user_id = $1
-		GROUP BY c.id, c.type, c.created_at
-		ORDER BY c.created_at DESC
+		SELECT mt.legacy_conversation_id, mt.thread_ref, mt.kind, COALESCE(mt.title, ''), mt.created_at,
+		       COUNT(mtp.user_id) as member_count,
+		       COALESCE(ARRAY_AGG(mtp.user_id::text) FILTER (WHERE mtp.user_id <> $1), '{}') as other_members
+		FROM marketplace_threads mt
+		JOIN marketplace_thread_participants mtp ON mt.id = mtp.thread_id
+		WHERE EXISTS (
+			SELECT 1 FROM marketplace_thread_participants me
+			WHERE me.thread_id = mt.id AND me.user_id = $1
+		)
+		GROUP BY mt.id
+		ORDER BY mt.created_at DESC
 	`
 
 	rows, err := ms.db.QueryContext(ctx, query, userID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get conversations: %v", err)
+		return nil, fmt.Errorf("failed to get conversations: %w", err)
 	}
 	defer rows.Close()
 
 	var conversations []ConversationPreview
 	for rows.Next() {
 		var conv ConversationPreview
-		var otherMembersStr string
 		err := rows.Scan(
-			&conv.ID, &conv.Type, &conv.CreatedAt,
-			&conv.MemberCount, &otherMembersStr,
+			&conv.ID, &conv.ThreadRef, &conv.Type, &conv.Title, &conv.CreatedAt,
+			&conv.MemberCount, pq.Array(&conv.OtherMembers),
 		)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan conversation: %v", err)
-		}
-
-		// Parse other members array
-		if otherMembersStr != "" {
-			otherMembersStr = strings.Trim(otherMembersStr, "{}")
-			if otherMembersStr != "" {
-				conv.OtherMembers = strings.Split(otherMembersStr, ",")
-			}
+			return nil, fmt.Errorf("failed to scan conversation: %w", err)
 		}
+		conversations = append(conversations, conv)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get conversations: %w", err)
+	}
 
+	for i := range conversations {
 		// Get latest message
-		latestMsg, err := ms.getLatestMessage(ctx, conv.ID)
+		latestMsg, err := ms.getLatestMessage(ctx, conversations[i].ID)
 		if err == nil {
-			conv.LatestMessage = latestMsg
+			conversations[i].LatestMessage = latestMsg
 		}
-
-		conversations = append(conversations, conv)
 	}
 
 	return conversations, nil
@@ -256,12 +291,13 @@ func (ms *MessagingService) GetUserConversations(ctx context.Context, userID str
 func (ms *MessagingService) getLatestMessage(ctx context.Context, conversationID int) (*Message, error) {
 	var msg Message
 	err := ms.db.QueryRowContext(ctx, `
-		SELECT m.id, m.conversation_id, m.sender_id, m.body, m.created_at, m.status,
+		SELECT mm.id, mt.legacy_conversation_id, mm.sender_id, mm.body, mm.created_at, `+messageStatus+`,
 		       u.name as sender_name, u.role as sender_role
-		FROM messages m
-		JOIN users u ON m.sender_id = u.id
-		WHERE m.conversation_id = $1
-		ORDER BY m.created_at DESC
+		FROM marketplace_messages mm
+		JOIN marketplace_threads mt ON mm.thread_id = mt.id
+		JOIN users u ON mm.sender_id = u.id
+		WHERE mt.legacy_conversation_id = $1
+		ORDER BY mm.created_at DESC
 		LIMIT 1
 	`, conversationID).Scan(
 		&msg.ID, &msg.ConversationID, &msg.SenderID, &msg.Body,
@@ -275,32 +311,15 @@ func (ms *MessagingService) getLatestMessage(ctx context.Context, conversationID
 
 // FindOrCreateDirectConversation finds or creates a direct conversation between two users
 func (ms *MessagingService) FindOrCreateDirectConversation(ctx context.Context, userID1, userID2 string) (int, error) {
-	// Check if direct conversation already exists
-	var conversationID int
-	err := ms.db.QueryRowContext(ctx, `
-		SELECT c.id
-		FROM conversations c
-		WHERE c.type = 'direct'
-		AND EXISTS (
-			SELECT 1 FROM conversation_members cm1 
-			WHERE cm1.conversation_id = c.id AND cm1.user_id = $1
-		)
-		AND EXISTS (
-			SELECT 1 FROM conversation_members cm2 
-			WHERE cm2.conversation_id = c.id AND cm2.user_id = $2
-		)
-		AND (
-			SELECT COUNT(*) FROM conversation_members cm3 
-			WHERE cm3.conversation_id = c.id
-		) = 2
-	`, userID1, userID2).Scan(&conversationID)
-
-	if err == nil {
-		return conversationID, nil
+	ids, err := parseUserIDs(userID1, userID2)
+	if err != nil {
+		return 0, err
 	}
-
-	// Create new direct conversation
-	return ms.CreateConversation(ctx, "direct", []string{userID1, userID2})
+	threadRef, err := ms.threads.FindOrCreateDirect(ctx, ids[0], ids[1])
+	if err != nil {
+		return 0, err
+	}
+	return ms.conversationID(ctx, threadRef)
 }
 
 // ValidateUserAccess validates that a user has access to a conversation
@@ -308,12 +327,13 @@ func (ms *MessagingService) ValidateUserAccess(ctx context.Context, userID strin
 	var hasAccess bool
 	err := ms.db.QueryRowContext(ctx, `
 		SELECT EXISTS(
-			SELECT 1 FROM conversation_members 
-			WHERE conversation_id = $1 AND user_id = $2
+			SELECT 1 FROM marketplace_thread_participants mtp
+			JOIN marketplace_threads mt ON mtp.thread_id = mt.id
+			WHERE mt.legacy_conversation_id = $1 AND mtp.user_id = $2
 		)
 	`, conversationID, userID).Scan(&hasAccess)
 	if err != nil {
-		return fmt.Errorf("failed to check access: %v", err)
+		return fmt.Errorf("failed to check access: %w", err)
 	}
 	if !hasAccess {
 		return fmt.Errorf("access denied to conversation")
@@ -0,0 +1,245 @@
+package notifications
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Andrew-mugwe/agroai/config"
+	"github.com/Andrew-mugwe/agroai/services/sms"
+	"github.com/Andrew-mugwe/agroai/utils"
+	"github.com/google/uuid"
+)
+
+// ErrNoAddress is returned by a sender when the user has no address on its
+// channel, e.g. no phone number for SMS; the delivery is skipped
+var ErrNoAddress = errors.New("no address for channel")
+
+// Recipient is who a notification is delivered to and where
+type Recipient struct {
+	UserID     uuid.UUID
+	Name       string
+	Email      string
+	Phone      string
+	PushTokens []string
+	// Language is the user's preferred language for templates
+	Language string
+}
+
+// Sender delivers notifications over one channel
+type Sender interface {
+	Channel() Channel
+	Send(ctx context.Context, to *Recipient, n *Notification) error
+}
+
+// notificationTitle is the heading used by channels that show one; callers
+// can set it through the "title" metadata key
+func notificationTitle(n *Notification) string {
+	if title, ok := n.Metadata["title"].(string); ok && title != "" {
+		return title
+	}
+	if n.Type == "" {
+		return "AgroAI notification"
+	}
+	return "AgroAI " + n.Type + " alert"
+}
+
+// WebSocketSender pushes notifications to the user's open connections
+type WebSocketSender struct {
+	hub *NotificationService
+}
+
+// NewWebSocketSender creates a sender on the realtime hub
+func NewWebSocketSender(hub *NotificationService) *WebSocketSender {
+	return &WebSocketSender{hub: hub}
+}
+
+// Channel implements Sender
+func (s *WebSocketSender) Channel() Channel { return ChannelWebSocket }
+
+// Send implements Sender. The message type is the "event" metadata key
+// when callers set one, otherwise the notification type.
+func (s *WebSocketSender) Send(ctx context.Context, to *Recipient, n *Notification) error {
+	messageType := n.Type
+	if event, ok := n.Metadata["event"].(string); ok && event != "" {
+		messageType = event
+	}
+
+	data := make(map[string]interface{}, len(n.Metadata)+1)
+	for k, v := range n.Metadata {
+		data[k] = v
+	}
+	data["notification_id"] = n.ID.String()
+
+	s.hub.SendToUser(to.UserID.String(), NotificationMessage{
+		Type:      messageType,
+		Title:     notificationTitle(n),
+		Message:   n.Message,
+		Data:      data,
+		Timestamp: n.CreatedAt,
+	})
+	return nil
+}
+
+// EmailSender emails notifications over SMTP
+type EmailSender struct {
+	config *utils.EmailConfig
+}
+
+// NewEmailSender creates an SMTP sender, or returns nil when SMTP is not
+// configured
+func NewEmailSender(cfg config.SMTPConfig) *EmailSender {
+	if cfg.Host == "" || cfg.Username == "" {
+		return nil
+	}
+	return &EmailSender{config: &utils.EmailConfig{
+		SMTPHost:     cfg.Host,
+		SMTPPort:     strconv.Itoa(cfg.Port),
+		SMTPUsername: cfg.Username,
+		SMTPPassword: cfg.Password,
+		FromEmail:    cfg.Username,
+	}}
+}
+
+// Channel implements Sender
+func (s *EmailSender) Channel() Channel { return ChannelEmail }
+
+// Send implements Sender
+func (s *EmailSender) Send(ctx context.Context, to *Recipient, n *Notification) error {
+	if to.Email == "" {
+		return ErrNoAddress
+	}
+
+	var body strings.Builder
+	if to.Name != "" {
+		fmt.Fprintf(&body, "Hi %s,\n\n", to.Name)
+	}
+	body.WriteString(n.Message)
+	body.WriteString("\n\nYou can change which notifications you receive by email in your AgroAI notification settings.\n")
+
+	// Templated notifications carry an HTML variant
+	if html, ok := n.Metadata["html"].(string); ok && html != "" {
+		return utils.SendHTMLEmail(s.config, []string{to.Email}, notificationTitle(n), body.String(), html)
+	}
+	return utils.SendEmail(s.config, []string{to.Email}, notificationTitle(n), body.String())
+}
+
+// smsLimit keeps notifications to two SMS segments
+const smsLimit = 306
+
+// SMSSender texts notifications to the user's verified phone
+type SMSSender struct {
+	gateway sms.Gateway
+}
+
+// NewSMSSender creates a sender on an SMS gateway
+func NewSMSSender(gateway sms.Gateway) *SMSSender {
+	return &SMSSender{gateway: gateway}
+}
+
+// Channel implements Sender
+func (s *SMSSender) Channel() Channel { return ChannelSMS }
+
+// Send implements Sender
+func (s *SMSSender) Send(ctx context.Context, to *Recipient, n *Notification) error {
+	if to.Phone == "" {
+		return ErrNoAddress
+	}
+
+	text := notificationTitle(n) + ": " + n.Message
+	if runes := []rune(text); len(runes) > smsLimit {
+		text = string(runes[:smsLimit-3]) + "..."
+	}
+	_, err := s.gateway.Send(ctx, to.Phone, text)
+	return err
+}
+
+// PushSender sends notifications to the user's devices through Firebase
+// Cloud Messaging
+type PushSender struct {
+	endpoint  string
+	serverKey string
+	client    *http.Client
+}
+
+// NewPushSender creates an FCM sender, or returns nil without a server key
+func NewPushSender(cfg config.PushConfig) *PushSender {
+	if cfg.FCMServerKey == "" {
+		return nil
+	}
+	return &PushSender{
+		endpoint:  cfg.FCMEndpoint,
+		serverKey: cfg.FCMServerKey,
+		client:    &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Channel implements Sender
+func (s *PushSender) Channel() Channel { return ChannelPush }
+
+// fcmResponse is the part of the FCM reply needed to tell delivery failures
+type fcmResponse struct {
+	Success int `json:"success"`
+	Failure int `json:"failure"`
+	Results []struct {
+		Error string `json:"error"`
+	} `json:"results"`
+}
+
+// Send implements Sender. It fails only if no device accepted the message.
+func (s *PushSender) Send(ctx context.Context, to *Recipient, n *Notification) error {
+	if len(to.PushTokens) == 0 {
+		return ErrNoAddress
+	}
+
+	data := map[string]string{"notification_id": n.ID.String(), "type": n.Type}
+	payload, err := json.Marshal(map[string]interface{}{
+		"registration_ids": to.PushTokens,
+		"notification": map[string]string{
+			"title": notificationTitle(n),
+			"body":  n.Message,
+		},
+		"data": data,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal push payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failed to create push request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "key="+s.serverKey)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send push: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("push gateway returned %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var result fcmResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("failed to decode push response: %w", err)
+	}
+	if result.Success == 0 && result.Failure > 0 {
+		reason := "unknown error"
+		if len(result.Results) > 0 && result.Results[0].Error != "" {
+			reason = result.Results[0].Error
+		}
+		return fmt.Errorf("push rejected by all %d devices: %s", result.Failure, reason)
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+package notifications
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Andrew-mugwe/agroai/config"
+	"github.com/Andrew-mugwe/agroai/services/sms"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testNotification() *Notification {
+	return &Notification{
+		ID:       uuid.New(),
+		UserID:   uuid.New(),
+		Type:     "pest",
+		Message:  "Fall armyworm reported near your farm",
+		Metadata: map[string]interface{}{"title": "Pest alert", "region": "Nakuru"},
+	}
+}
+
+func TestSMSSender(t *testing.T) {
+	gateway := sms.NewFake(false)
+	sender := NewSMSSender(gateway)
+	assert.Equal(t, ChannelSMS, sender.Channel())
+
+	n := testNotification()
+	require.NoError(t, sender.Send(context.Background(), &Recipient{Phone: "+254712345678"}, n))
+	msg, ok := gateway.Last("+254712345678")
+	require.True(t, ok)
+	assert.Equal(t, "Pest alert: "+n.Message, msg.Body)
+
+	n.Message = strings.Repeat("a", 400)
+	require.NoError(t, sender.Send(context.Background(), &Recipient{Phone: "+254712345678"}, n))
+	msg, _ = gateway.Last("+254712345678")
+	assert.Len(t, []rune(msg.Body), smsLimit)
+	assert.True(t, strings.HasSuffix(msg.Body, "..."))
+
+	assert.ErrorIs(t, sender.Send(context.Background(), &Recipient{}, n), ErrNoAddress)
+}
+
+func TestPushSender(t *testing.T) {
+	var got struct {
+		RegistrationIDs []string          `json:"registration_ids"`
+		Notification    map[string]string `json:"notification"`
+		Data            map[string]string `json:"data"`
+	}
+	var auth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+		w.Write([]byte(`{"success": 1, "failure": 1, "results": [{"error": "NotRegistered"}, {}]}`))
+	}))
+	defer server.Close()
+
+	assert.Nil(t, NewPushSender(config.PushConfig{FCMEndpoint: server.URL}), "no sender without a key")
+	sender := NewPushSender(config.PushConfig{FCMServerKey: "secret", FCMEndpoint: server.URL})
+	require.NotNil(t, sender)
+
+	n := testNotification()
+	to := &Recipient{UserID: n.UserID, PushTokens: []string{"stale", "phone"}}
+	require.NoError(t, sender.Send(context.Background(), to, n))
+
+	assert.Equal(t, "key=secret", auth)
+	assert.Equal(t, []string{"stale", "phone"}, got.RegistrationIDs)
+	assert.Equal(t, "Pest alert", got.Notification["title"])
+	assert.Equal(t, n.Message, got.Notification["body"])
+	assert.Equal(t, n.ID.String(), got.Data["notification_id"])
+
+	assert.ErrorIs(t, sender.Send(context.Background(), &Recipient{}, n), ErrNoAddress)
+}
+
+func TestPushSenderRejected(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"success": 0, "failure": 1, "results": [{"error": "InvalidRegistration"}]}`))
+	}))
+	defer server.Close()
+
+	sender := NewPushSender(config.PushConfig{FCMServerKey: "secret", FCMEndpoint: server.URL})
+	err := sender.Send(context.Background(), &Recipient{PushTokens: []string{"bad"}}, testNotification())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "InvalidRegistration")
+}
+
+func TestWebSocketSender(t *testing.T) {
+	hub := NewNotificationService()
+	n := testNotification()
+	n.Metadata["event"] = "pest_outbreak"
+	client := hub.NewClient(nil, n.UserID.String())
+	hub.RegisterClient(client)
+
+	sender := NewWebSocketSender(hub)
+	require.NoError(t, sender.Send(context.Background(), &Recipient{UserID: n.UserID}, n))
+
+	select {
+	case msg := <-client.Send:
+		assert.Equal(t, "pest_outbreak", msg.Type)
+		assert.Equal(t, "Pest alert", msg.Title)
+		assert.Equal(t, n.ID.String(), msg.Data["notification_id"])
+		assert.Equal(t, "Nakuru", msg.Data["region"])
+	case <-time.After(2 * time.Second):
+		t.Fatal("message not delivered")
+	}
+}
+
+func TestEmailSenderNeedsSMTP(t *testing.T) {
+	assert.Nil(t, NewEmailSender(config.SMTPConfig{Host: "smtp.gmail.com", Port: 587}))
+	assert.NotNil(t, NewEmailSender(config.SMTPConfig{Host: "smtp.gmail.com", Port: 587, Username: "alerts@agroai.test"}))
+}
+
+// stubSender fails with err on every send
+type stubSender struct {
+	err error
+}
+
+func (s stubSender) Channel() Channel { return ChannelSMS }
+
+func (s stubSender) Send(ctx context.Context, to *Recipient, n *Notification) error { return s.err }
+
+func TestAttemptOutcomes(t *testing.T) {
+	d := NewDispatcher(nil, nil)
+	defer d.Stop()
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	d.now = func() time.Time { return now }
+	n := testNotification()
+
+	delivery := &Delivery{}
+	d.attempt(stubSender{}, &Recipient{}, n, delivery)
+	assert.Equal(t, DeliverySent, delivery.Status)
+	assert.Equal(t, 1, delivery.Attempts)
+
+	delivery = &Delivery{}
+	d.attempt(stubSender{err: ErrNoAddress}, &Recipient{}, n, delivery)
+	assert.Equal(t, DeliverySkipped, delivery.Status)
+	assert.Nil(t, delivery.NextAttemptAt)
+
+	// Failures are retried with growing backoff until the last attempt
+	delivery = &Delivery{}
+	failing := stubSender{err: errors.New("gateway down")}
+	d.attempt(failing, &Recipient{}, n, delivery)
+	assert.Equal(t, DeliveryFailed, delivery.Status)
+	require.NotNil(t, delivery.NextAttemptAt)
+	assert.Equal(t, now.Add(time.Minute), *delivery.NextAttemptAt)
+
+	d.attempt(failing, &Recipient{}, n, delivery)
+	require.NotNil(t, delivery.NextAttemptAt)
+	assert.Equal(t, now.Add(4*time.Minute), *delivery.NextAttemptAt)
+
+	d.attempt(failing, &Recipient{}, n, delivery)
+	assert.Equal(t, maxDeliveryAttempts, delivery.Attempts)
+	assert.Nil(t, delivery.NextAttemptAt)
+	assert.Equal(t, "gateway down", delivery.Error)
+}
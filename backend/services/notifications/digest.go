@@ -0,0 +1,340 @@
+package notifications
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Andrew-mugwe/agroai/pagination"
+	"github.com/google/uuid"
+)
+
+const (
+	// digestBatch caps the digests sent per run
+	digestBatch = 100
+	// digestListed is how many notifications a digest lists; the rest
+	// are counted
+	digestListed = 10
+	// digestTemplate renders digests
+	digestTemplate = "digest"
+	// digestRetry is when a claimed digest comes due again if it is not
+	// rescheduled, e.g. because the worker failed or stopped
+	digestRetry = 15 * time.Minute
+)
+
+// DigestRecord is a digest sent, or attempted, to a user
+type DigestRecord struct {
+	ID        uuid.UUID      `json:"id"`
+	Channel   Channel        `json:"channel"`
+	Status    DeliveryStatus `json:"status"`
+	ItemCount int            `json:"item_count"`
+	Error     string         `json:"error,omitempty"`
+	CreatedAt time.Time      `json:"created_at"`
+}
+
+// queueDigest holds a notification for the user's next digest
+func (d *Dispatcher) queueDigest(n *Notification) error {
+	_, err := d.db.ExecContext(d.ctx, `
+		INSERT INTO notification_digest_items (notification_id, user_id)
+		VALUES ($1, $2)
+		ON CONFLICT (notification_id) DO NOTHING
+	`, n.ID, n.UserID)
+	return err
+}
+
+// digestClaim is a due digest taken by this worker until retryAt
+type digestClaim struct {
+	userID  uuid.UUID
+	retryAt time.Time
+}
+
+// SendDigests sends the digests that are due. Claiming a digest moves it
+// digestRetry ahead, so concurrent workers do not send twice and a digest
+// that fails before it is rescheduled is retried rather than lost.
+func (d *Dispatcher) SendDigests(ctx context.Context) error {
+	due, err := d.claimDueDigests(ctx)
+	if err != nil {
+		return err
+	}
+	for _, claim := range due {
+		if err := d.sendDigest(ctx, claim); err != nil {
+			log.Printf("notifications: failed to send digest to %s: %v", claim.userID, err)
+		}
+	}
+	return nil
+}
+
+// claimDueDigests takes up to digestBatch due digests
+func (d *Dispatcher) claimDueDigests(ctx context.Context) ([]digestClaim, error) {
+	now := d.now()
+	rows, err := d.db.QueryContext(ctx, `
+		UPDATE notification_settings
+		SET next_digest_at = $3
+		WHERE user_id IN (
+			SELECT user_id FROM notification_settings
+			WHERE next_digest_at <= $2
+			ORDER BY next_digest_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING user_id, next_digest_at
+	`, digestBatch, now, now.Add(digestRetry))
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim due digests: %w", err)
+	}
+	defer rows.Close()
+
+	var due []digestClaim
+	for rows.Next() {
+		var claim digestClaim
+		if err := rows.Scan(&claim.userID, &claim.retryAt); err != nil {
+			return nil, fmt.Errorf("failed to scan digest user: %w", err)
+		}
+		due = append(due, claim)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read due digests: %w", err)
+	}
+	return due, nil
+}
+
+// sendDigest summarises the user's held notifications that are still
+// unread and schedules their next digest
+func (d *Dispatcher) sendDigest(ctx context.Context, claim digestClaim) error {
+	userID := claim.userID
+	prefs, err := d.Preferences(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	// Settings saved since the claim have scheduled their own digest
+	var next *time.Time
+	if prefs.Digest != nil {
+		t := prefs.Digest.next(d.now(), prefs.QuietHours)
+		next = &t
+	}
+	_, err = d.db.ExecContext(ctx, `
+		UPDATE notification_settings SET next_digest_at = $2
+		WHERE user_id = $1 AND next_digest_at = $3
+	`, userID, next, claim.retryAt)
+	if err != nil {
+		return fmt.Errorf("failed to schedule digest: %w", err)
+	}
+	digest := prefs.Digest
+	if digest == nil {
+		return nil
+	}
+
+	record := &DigestRecord{ID: uuid.New(), Channel: digest.Channel}
+	items, err := d.claimDigestItems(ctx, userID, record.ID)
+	if err != nil {
+		return err
+	}
+	if len(items) == 0 {
+		return nil
+	}
+	record.ItemCount = len(items)
+
+	to, err := d.recipient(ctx, userID)
+	if err != nil {
+		d.releaseDigestItems(ctx, record.ID)
+		return err
+	}
+
+	err = d.deliverDigest(ctx, digest, to, record.ID, items)
+	switch {
+	case err == nil:
+		record.Status = DeliverySent
+	case errors.Is(err, ErrNoAddress):
+		record.Status = DeliverySkipped
+		record.Error = err.Error()
+	default:
+		// The notifications go in the next digest instead
+		record.Status = DeliveryFailed
+		record.Error = err.Error()
+		d.releaseDigestItems(ctx, record.ID)
+	}
+
+	if record.Status != DeliveryFailed {
+		if _, err := d.db.ExecContext(ctx, `DELETE FROM notification_digest_items WHERE digest_id = $1`, record.ID); err != nil {
+			log.Printf("notifications: failed to clear digest %s: %v", record.ID, err)
+		}
+	}
+	_, err = d.db.ExecContext(ctx, `
+		INSERT INTO notification_digests (id, user_id, channel, status, item_count, error)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, record.ID, userID, record.Channel, record.Status, record.ItemCount, record.Error)
+	if err != nil {
+		return fmt.Errorf("failed to record digest: %w", err)
+	}
+	return nil
+}
+
+// claimDigestItems takes the user's held notifications for a digest,
+// returning those still unread oldest first; read ones are dropped with it
+func (d *Dispatcher) claimDigestItems(ctx context.Context, userID, digestID uuid.UUID) ([]Notification, error) {
+	rows, err := d.db.QueryContext(ctx, `
+		WITH claimed AS (
+			UPDATE notification_digest_items SET digest_id = $2
+			WHERE user_id = $1 AND digest_id IS NULL
+			RETURNING notification_id
+		)
+		SELECT n.id, n.type, n.message, n.metadata, n.created_at
+		FROM notifications n
+		JOIN claimed c ON c.notification_id = n.id
+		WHERE n.status = 'unread'
+		ORDER BY n.created_at
+	`, userID, digestID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim digest notifications: %w", err)
+	}
+	defer rows.Close()
+
+	var items []Notification
+	for rows.Next() {
+		n := Notification{UserID: userID}
+		var metadata []byte
+		if err := rows.Scan(&n.ID, &n.Type, &n.Message, &metadata, &n.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan digest notification: %w", err)
+		}
+		n.Metadata = make(map[string]interface{})
+		if len(metadata) > 0 {
+			if err := json.Unmarshal(metadata, &n.Metadata); err != nil {
+				log.Printf("Warning: failed to unmarshal metadata: %v", err)
+			}
+		}
+		items = append(items, n)
+	}
+	return items, rows.Err()
+}
+
+// releaseDigestItems returns a failed digest's notifications to the queue
+func (d *Dispatcher) releaseDigestItems(ctx context.Context, digestID uuid.UUID) {
+	_, err := d.db.ExecContext(ctx, `UPDATE notification_digest_items SET digest_id = NULL WHERE digest_id = $1`, digestID)
+	if err != nil {
+		log.Printf("notifications: failed to release digest %s: %v", digestID, err)
+	}
+}
+
+// deliverDigest renders the digest in the user's language and sends it on
+// the digest channel
+func (d *Dispatcher) deliverDigest(ctx context.Context, digest *Digest, to *Recipient, digestID uuid.UUID, items []Notification) error {
+	// A channel that is not configured is skipped like a missing address
+	sender, ok := d.senders[digest.Channel]
+	if !ok {
+		return fmt.Errorf("%w: %s is not available", ErrNoAddress, digest.Channel)
+	}
+
+	n, err := d.renderDigest(digest, to, digestID, items)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, sendTimeout)
+	defer cancel()
+	return sender.Send(ctx, to, n)
+}
+
+// renderDigest builds the digest message for its channel
+func (d *Dispatcher) renderDigest(digest *Digest, to *Recipient, digestID uuid.UUID, items []Notification) (*Notification, error) {
+	listed := items
+	if len(listed) > digestListed {
+		listed = listed[:digestListed]
+	}
+	entries := make([]map[string]interface{}, 0, len(listed))
+	for i := range listed {
+		entries = append(entries, map[string]interface{}{
+			"title":   notificationTitle(&listed[i]),
+			"message": listed[i].Message,
+		})
+	}
+
+	rendered, err := d.templates.Render(digestTemplate, to.Language, digest.Channel, map[string]interface{}{
+		"count":     len(items),
+		"frequency": string(digest.Frequency),
+		"items":     entries,
+		"more":      len(items) - len(listed),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	metadata := map[string]interface{}{
+		"title": rendered.Title,
+		"event": "notification_digest",
+		"count": len(items),
+	}
+	if rendered.HTML != "" {
+		metadata["html"] = rendered.HTML
+	}
+	return &Notification{
+		ID:        digestID,
+		UserID:    to.UserID,
+		Type:      "system",
+		Message:   rendered.Body,
+		Status:    "unread",
+		Metadata:  metadata,
+		CreatedAt: d.now(),
+		UpdatedAt: d.now(),
+	}, nil
+}
+
+// digestKeyset lists the newest digests first
+var digestKeyset = pagination.Keyset{Key: "created_at", ID: "id", Dir: pagination.Desc}
+
+// Digests lists a page of the user's digests, newest first
+func (d *Dispatcher) Digests(ctx context.Context, userID uuid.UUID, page pagination.Params) (pagination.Page[DigestRecord], error) {
+	var none pagination.Page[DigestRecord]
+	page = page.Normalize()
+	after, err := page.After(notificationSort)
+	if err != nil {
+		return none, err
+	}
+
+	var total int
+	if err := d.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM notification_digests WHERE user_id = $1`, userID).
+		Scan(&total); err != nil {
+		return none, fmt.Errorf("failed to count digests: %w", err)
+	}
+
+	query := `
+		SELECT id, channel, status, item_count, error, created_at, ` + digestKeyset.KeyText() + `
+		FROM notification_digests
+		WHERE user_id = $1`
+	args := []interface{}{userID}
+	if after != nil {
+		query += " AND " + digestKeyset.After("$2", "$3")
+		args = append(args, after.Key, after.ID)
+	}
+	query += fmt.Sprintf(" ORDER BY %s LIMIT $%d", digestKeyset.OrderBy(), len(args)+1)
+	args = append(args, page.FetchLimit())
+
+	rows, err := d.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return none, fmt.Errorf("failed to get digests: %w", err)
+	}
+	defer rows.Close()
+
+	var records []DigestRecord
+	var keys []string
+	for rows.Next() {
+		var record DigestRecord
+		var key string
+		if err := rows.Scan(&record.ID, &record.Channel, &record.Status, &record.ItemCount, &record.Error,
+			&record.CreatedAt, &key); err != nil {
+			return none, fmt.Errorf("failed to scan digest: %w", err)
+		}
+		records = append(records, record)
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return none, fmt.Errorf("failed to get digests: %w", err)
+	}
+
+	return pagination.NewPage(records, page.Limit, func(i int) pagination.Cursor {
+		return pagination.Cursor{Key: keys[i], ID: records[i].ID.String(), Sort: notificationSort}
+	}).WithTotal(total), nil
+}
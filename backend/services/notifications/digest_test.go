@@ -0,0 +1,142 @@
+package notifications
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Andrew-mugwe/agroai/pagination"
+	"github.com/google/uuid"
+	_ "github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// These tests send digests against a migrated database.
+
+func setupDigestDB(t *testing.T) *sql.DB {
+	databaseURL := os.Getenv("DATABASE_URL")
+	if databaseURL == "" {
+		t.Skip("DATABASE_URL not set, skipping integration test")
+	}
+
+	db, err := sql.Open("postgres", databaseURL)
+	require.NoError(t, err)
+	require.NoError(t, db.Ping())
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// recordingSender keeps what it is asked to send
+type recordingSender struct {
+	mu   sync.Mutex
+	sent []*Notification
+}
+
+func (s *recordingSender) Channel() Channel { return ChannelEmail }
+
+func (s *recordingSender) Send(ctx context.Context, to *Recipient, n *Notification) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sent = append(s.sent, n)
+	return nil
+}
+
+// createDigestUser adds a user with an hourly email digest that is due
+func createDigestUser(t *testing.T, db *sql.DB, d *Dispatcher) uuid.UUID {
+	var userID uuid.UUID
+	err := db.QueryRow(`
+		INSERT INTO users (name, email, password_hash, role)
+		VALUES ('Digest Tester', $1, 'x', 'farmer')
+		RETURNING id`, "digest-"+uuid.NewString()+"@example.com").Scan(&userID)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Exec(`DELETE FROM users WHERE id = $1`, userID) })
+
+	_, err = d.SetPreferences(context.Background(), userID, &Preferences{
+		Digest: &Digest{Frequency: DigestHourly, Channel: ChannelEmail},
+	})
+	require.NoError(t, err)
+	_, err = db.Exec(`UPDATE notification_settings SET next_digest_at = $2 WHERE user_id = $1`,
+		userID, time.Now().Add(-time.Minute))
+	require.NoError(t, err)
+	return userID
+}
+
+func nextDigestAt(t *testing.T, db *sql.DB, userID uuid.UUID) sql.NullTime {
+	var next sql.NullTime
+	require.NoError(t, db.QueryRow(`SELECT next_digest_at FROM notification_settings WHERE user_id = $1`, userID).
+		Scan(&next))
+	return next
+}
+
+func TestSendDigests(t *testing.T) {
+	db := setupDigestDB(t)
+	d := NewDispatcher(db, nil)
+	defer d.Stop()
+	sender := &recordingSender{}
+	d.Use(sender)
+	userID := createDigestUser(t, db, d)
+
+	n := &Notification{UserID: userID}
+	err := db.QueryRow(`
+		INSERT INTO notifications (user_id, role, type, message, metadata, status)
+		VALUES ($1, 'farmer', 'pest', 'Fall armyworm reported near your farm', '{}', 'unread')
+		RETURNING id`, userID).Scan(&n.ID)
+	require.NoError(t, err)
+	require.NoError(t, d.queueDigest(n))
+
+	require.NoError(t, d.SendDigests(context.Background()))
+
+	var mine []*Notification
+	for _, sent := range sender.sent {
+		if sent.UserID == userID {
+			mine = append(mine, sent)
+		}
+	}
+	require.Len(t, mine, 1)
+	assert.Equal(t, 1, mine[0].Metadata["count"])
+
+	next := nextDigestAt(t, db, userID)
+	require.True(t, next.Valid)
+	assert.True(t, next.Time.After(time.Now()))
+
+	digests, err := d.Digests(context.Background(), userID, pagination.Params{})
+	require.NoError(t, err)
+	require.Len(t, digests.Items, 1)
+	assert.Equal(t, DeliverySent, digests.Items[0].Status)
+	assert.Equal(t, 1, digests.Items[0].ItemCount)
+	assert.Equal(t, 1, *digests.Total)
+}
+
+func TestClaimedDigestIsRetried(t *testing.T) {
+	db := setupDigestDB(t)
+	d := NewDispatcher(db, nil)
+	defer d.Stop()
+	userID := createDigestUser(t, db, d)
+	now := time.Now()
+	d.now = func() time.Time { return now }
+
+	claimed := func() bool {
+		due, err := d.claimDueDigests(context.Background())
+		require.NoError(t, err)
+		for _, claim := range due {
+			if claim.userID == userID {
+				return true
+			}
+		}
+		return false
+	}
+
+	// A worker that claims the digest and then fails leaves it scheduled
+	require.True(t, claimed())
+	next := nextDigestAt(t, db, userID)
+	require.True(t, next.Valid)
+	assert.WithinDuration(t, now.Add(digestRetry), next.Time, time.Millisecond)
+	assert.False(t, claimed(), "a claimed digest is not claimed twice")
+
+	now = now.Add(digestRetry + time.Second)
+	assert.True(t, claimed(), "an unsent digest comes due again")
+}
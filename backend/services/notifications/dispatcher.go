@@ -0,0 +1,749 @@
+package notifications
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Andrew-mugwe/agroai/pagination"
+	"github.com/Andrew-mugwe/agroai/services/sms"
+	"github.com/google/uuid"
+)
+
+// Dispatcher errors
+var (
+	ErrInvalidDevice        = errors.New("invalid push device")
+	ErrDeviceNotFound       = errors.New("push device not found")
+	ErrNotificationNotFound = errors.New("notification not found")
+)
+
+// DeliveryStatus is the outcome of delivering a notification on a channel
+type DeliveryStatus string
+
+const (
+	DeliverySent DeliveryStatus = "sent"
+	// DeliveryFailed is retried while NextAttemptAt is set
+	DeliveryFailed DeliveryStatus = "failed"
+	// DeliverySkipped means the user has no address on the channel
+	DeliverySkipped DeliveryStatus = "skipped"
+	// DeliveryDeferred waits for the user's quiet hours to end
+	DeliveryDeferred DeliveryStatus = "deferred"
+)
+
+// Delivery records a notification's delivery on one channel
+type Delivery struct {
+	ID             uuid.UUID      `json:"id"`
+	NotificationID uuid.UUID      `json:"notification_id"`
+	Channel        Channel        `json:"channel"`
+	Status         DeliveryStatus `json:"status"`
+	Attempts       int            `json:"attempts"`
+	Error          string         `json:"error,omitempty"`
+	NextAttemptAt  *time.Time     `json:"next_attempt_at,omitempty"`
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+}
+
+const (
+	// maxDeliveryAttempts is how often a failing channel is tried
+	maxDeliveryAttempts = 3
+	// retryBatch caps the deliveries retried per run
+	retryBatch = 100
+	// sendTimeout bounds a single channel send
+	sendTimeout = 30 * time.Second
+)
+
+// Device platforms accepted for push tokens
+var devicePlatforms = []string{"android", "ios", "web"}
+
+// Dispatcher stores notifications in the inbox and delivers them over the
+// channels each user has enabled for the notification type. Every delivery
+// is recorded per channel; failures are retried and deliveries held by
+// quiet hours go out when they end. Users with a digest get normal-priority
+// notifications batched into it instead.
+type Dispatcher struct {
+	db        *sql.DB
+	store     *DatabaseNotificationService
+	senders   map[Channel]Sender
+	templates *Templates
+	now       func() time.Time
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	once   sync.Once
+}
+
+// NewDispatcher creates a dispatcher that stores notifications in store
+// and renders them with the built-in templates. Channels are added with Use.
+func NewDispatcher(db *sql.DB, store *DatabaseNotificationService) *Dispatcher {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Dispatcher{
+		db:        db,
+		store:     store,
+		senders:   make(map[Channel]Sender),
+		templates: DefaultTemplates(),
+		now:       time.Now,
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+}
+
+// Templates returns the registry notifications are rendered with
+func (d *Dispatcher) Templates() *Templates {
+	return d.templates
+}
+
+// Use registers the sender for its channel. Channels without a sender are
+// not delivered on and not recorded.
+func (d *Dispatcher) Use(sender Sender) {
+	d.senders[sender.Channel()] = sender
+}
+
+// SendNotification stores a notification and delivers it over the user's
+// channels in the background. With the inbox turned off for the type it is
+// stored already read, so it stays in the history without adding to the
+// unread count.
+//
+// A request naming a template is rendered in the user's language, with its
+// metadata as the template variables; each channel then gets its own
+// variant.
+func (d *Dispatcher) SendNotification(req NotificationRequest) (*Notification, error) {
+	if req.Template != "" {
+		if err := d.renderRequest(&req); err != nil {
+			return nil, err
+		}
+	}
+
+	prefs, err := d.Preferences(d.ctx, req.UserID)
+	if err != nil {
+		log.Printf("notifications: failed to load preferences for %s, using defaults: %v", req.UserID, err)
+		prefs = &Preferences{}
+	}
+
+	status := "unread"
+	if !prefs.Enabled(req.Type, ChannelInApp) {
+		status = "read"
+	}
+	notification, err := d.store.create(req, status)
+	if err != nil {
+		return nil, err
+	}
+
+	go d.fanOut(notification, prefs, req.priority())
+	return notification, nil
+}
+
+// renderRequest fills in the message and title of a templated request for
+// the inbox. The template name is kept in the metadata so channels and
+// retries can render their own variants.
+func (d *Dispatcher) renderRequest(req *NotificationRequest) error {
+	language, err := d.Language(d.ctx, req.UserID)
+	if err != nil {
+		log.Printf("notifications: failed to load language for %s: %v", req.UserID, err)
+		language = DefaultLanguage
+	}
+
+	// An unknown template or missing variable is the caller's mistake
+	rendered, err := d.templates.Render(req.Template, language, ChannelInApp, req.Metadata)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidNotification, err)
+	}
+
+	metadata := make(map[string]interface{}, len(req.Metadata)+2)
+	for k, v := range req.Metadata {
+		metadata[k] = v
+	}
+	metadata["template"] = req.Template
+	metadata["title"] = rendered.Title
+	req.Metadata = metadata
+	req.Message = rendered.Body
+	return nil
+}
+
+// localize renders a templated notification for a channel in the
+// recipient's language. Untemplated notifications, and ones whose template
+// fails to render, are sent as stored.
+func (d *Dispatcher) localize(n *Notification, to *Recipient, channel Channel) *Notification {
+	name, ok := n.Metadata["template"].(string)
+	if !ok || name == "" {
+		return n
+	}
+	rendered, err := d.templates.Render(name, to.Language, channel, n.Metadata)
+	if err != nil {
+		log.Printf("notifications: failed to render %s for %s: %v", name, channel, err)
+		return n
+	}
+
+	localized := *n
+	localized.Message = rendered.Body
+	localized.Metadata = make(map[string]interface{}, len(n.Metadata)+1)
+	for k, v := range n.Metadata {
+		localized.Metadata[k] = v
+	}
+	localized.Metadata["title"] = rendered.Title
+	if rendered.HTML != "" {
+		localized.Metadata["html"] = rendered.HTML
+	}
+	return &localized
+}
+
+// fanOut delivers a new notification on every planned channel, holding
+// those the user's digest batches
+func (d *Dispatcher) fanOut(n *Notification, prefs *Preferences, priority Priority) {
+	var to *Recipient
+	held := false
+	defer func() {
+		if held {
+			if err := d.queueDigest(n); err != nil {
+				log.Printf("notifications: failed to add %s to digest: %v", n.ID, err)
+			}
+		}
+	}()
+
+	for _, p := range prefs.plan(n.Type, d.now()) {
+		sender, ok := d.senders[p.channel]
+		if !ok {
+			continue
+		}
+		if prefs.holds(priority, p.channel) {
+			held = true
+			continue
+		}
+
+		delivery := &Delivery{NotificationID: n.ID, Channel: p.channel}
+		if !p.notBefore.IsZero() {
+			delivery.Status = DeliveryDeferred
+			delivery.NextAttemptAt = &p.notBefore
+		} else {
+			if to == nil {
+				var err error
+				if to, err = d.recipient(d.ctx, n.UserID); err != nil {
+					log.Printf("notifications: failed to load recipient %s: %v", n.UserID, err)
+					return
+				}
+			}
+			d.attempt(sender, to, n, delivery)
+		}
+
+		if err := d.insertDelivery(n.UserID, delivery); err != nil {
+			log.Printf("notifications: failed to record %s delivery of %s: %v", p.channel, n.ID, err)
+		}
+	}
+}
+
+// attempt sends on one channel and sets the delivery's outcome
+func (d *Dispatcher) attempt(sender Sender, to *Recipient, n *Notification, delivery *Delivery) {
+	ctx, cancel := context.WithTimeout(d.ctx, sendTimeout)
+	defer cancel()
+
+	err := sender.Send(ctx, to, d.localize(n, to, sender.Channel()))
+	delivery.Attempts++
+	delivery.Error = ""
+	delivery.NextAttemptAt = nil
+
+	switch {
+	case err == nil:
+		delivery.Status = DeliverySent
+	case errors.Is(err, ErrNoAddress):
+		delivery.Status = DeliverySkipped
+		delivery.Error = err.Error()
+	default:
+		delivery.Status = DeliveryFailed
+		delivery.Error = err.Error()
+		if delivery.Attempts < maxDeliveryAttempts {
+			next := d.now().Add(retryBackoff(delivery.Attempts))
+			delivery.NextAttemptAt = &next
+		}
+	}
+}
+
+// retryBackoff is the wait after a failed attempt: 1m, 4m, 9m, ...
+func retryBackoff(attempts int) time.Duration {
+	return time.Duration(attempts*attempts) * time.Minute
+}
+
+func (d *Dispatcher) insertDelivery(userID uuid.UUID, delivery *Delivery) error {
+	return d.db.QueryRowContext(d.ctx, `
+		INSERT INTO notification_deliveries (notification_id, user_id, channel, status, attempts, error, next_attempt_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at, updated_at
+	`, delivery.NotificationID, userID, delivery.Channel, delivery.Status, delivery.Attempts, delivery.Error, delivery.NextAttemptAt).
+		Scan(&delivery.ID, &delivery.CreatedAt, &delivery.UpdatedAt)
+}
+
+func (d *Dispatcher) updateDelivery(delivery *Delivery) error {
+	_, err := d.db.ExecContext(d.ctx, `
+		UPDATE notification_deliveries
+		SET status = $2, attempts = $3, error = $4, next_attempt_at = $5, updated_at = NOW()
+		WHERE id = $1
+	`, delivery.ID, delivery.Status, delivery.Attempts, delivery.Error, delivery.NextAttemptAt)
+	return err
+}
+
+// RetryDue delivers deferred and failed deliveries whose time has come. It
+// re-checks the user's preferences, so a channel turned off in the meantime
+// is skipped and one still in quiet hours is deferred again.
+func (d *Dispatcher) RetryDue(ctx context.Context) error {
+	// Claim due rows so concurrent workers do not send twice
+	rows, err := d.db.QueryContext(ctx, `
+		UPDATE notification_deliveries
+		SET next_attempt_at = NULL, updated_at = NOW()
+		WHERE id IN (
+			SELECT id FROM notification_deliveries
+			WHERE next_attempt_at <= NOW()
+			ORDER BY next_attempt_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, notification_id, user_id, channel, status, attempts
+	`, retryBatch)
+	if err != nil {
+		return fmt.Errorf("failed to claim due deliveries: %w", err)
+	}
+
+	type due struct {
+		delivery Delivery
+		userID   uuid.UUID
+	}
+	var claimed []due
+	for rows.Next() {
+		var item due
+		if err := rows.Scan(&item.delivery.ID, &item.delivery.NotificationID, &item.userID,
+			&item.delivery.Channel, &item.delivery.Status, &item.delivery.Attempts); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan delivery: %w", err)
+		}
+		claimed = append(claimed, item)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read due deliveries: %w", err)
+	}
+
+	for _, item := range claimed {
+		delivery := item.delivery
+		if err := d.retry(ctx, item.userID, &delivery); err != nil {
+			log.Printf("notifications: failed to retry delivery %s: %v", delivery.ID, err)
+			continue
+		}
+		if err := d.updateDelivery(&delivery); err != nil {
+			log.Printf("notifications: failed to record delivery %s: %v", delivery.ID, err)
+		}
+	}
+	return nil
+}
+
+// retry makes the next attempt at a claimed delivery
+func (d *Dispatcher) retry(ctx context.Context, userID uuid.UUID, delivery *Delivery) error {
+	n, err := d.notification(ctx, delivery.NotificationID)
+	if err != nil {
+		return err
+	}
+	prefs, err := d.Preferences(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	sender, ok := d.senders[delivery.Channel]
+	if !ok || !prefs.Enabled(n.Type, delivery.Channel) {
+		delivery.Status = DeliverySkipped
+		delivery.Error = "channel disabled"
+		return nil
+	}
+	if until, quiet := prefs.QuietHours.until(d.now()); quiet && delivery.Channel.Interrupts() {
+		delivery.Status = DeliveryDeferred
+		delivery.NextAttemptAt = &until
+		return nil
+	}
+
+	to, err := d.recipient(ctx, userID)
+	if err != nil {
+		return err
+	}
+	d.attempt(sender, to, n, delivery)
+	return nil
+}
+
+// notification loads a stored notification for redelivery
+func (d *Dispatcher) notification(ctx context.Context, id uuid.UUID) (*Notification, error) {
+	var n Notification
+	var metadata []byte
+	err := d.db.QueryRowContext(ctx, `
+		SELECT id, user_id, role, type, message, status, metadata, created_at, updated_at
+		FROM notifications
+		WHERE id = $1
+	`, id).Scan(&n.ID, &n.UserID, &n.Role, &n.Type, &n.Message, &n.Status, &metadata, &n.CreatedAt, &n.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotificationNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get notification: %w", err)
+	}
+
+	n.Metadata = make(map[string]interface{})
+	if len(metadata) > 0 {
+		if err := json.Unmarshal(metadata, &n.Metadata); err != nil {
+			log.Printf("Warning: failed to unmarshal metadata: %v", err)
+		}
+	}
+	return &n, nil
+}
+
+// recipient loads the user's addresses
+func (d *Dispatcher) recipient(ctx context.Context, userID uuid.UUID) (*Recipient, error) {
+	to := &Recipient{UserID: userID}
+	var phone sql.NullString
+	err := d.db.QueryRowContext(ctx, `
+		SELECT name, email, CASE WHEN phone_verified_at IS NOT NULL THEN phone END, preferred_language
+		FROM users WHERE id = $1
+	`, userID).Scan(&to.Name, &to.Email, &phone, &to.Language)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	to.Phone = phone.String
+
+	rows, err := d.db.QueryContext(ctx, `
+		SELECT token FROM push_devices WHERE user_id = $1 ORDER BY last_seen_at DESC
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get push devices: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var token string
+		if err := rows.Scan(&token); err != nil {
+			return nil, fmt.Errorf("failed to scan push device: %w", err)
+		}
+		to.PushTokens = append(to.PushTokens, token)
+	}
+	return to, rows.Err()
+}
+
+// deliverySort lists deliveries in the order they were attempted
+const deliverySort = "oldest"
+
+var deliveryKeyset = pagination.Keyset{Key: "created_at", ID: "id", Dir: pagination.Asc}
+
+// Deliveries lists a page of a notification's deliveries, oldest first; the
+// notification must belong to the user
+func (d *Dispatcher) Deliveries(ctx context.Context, userID, notificationID uuid.UUID, page pagination.Params) (pagination.Page[Delivery], error) {
+	var none pagination.Page[Delivery]
+	page = page.Normalize()
+	after, err := page.After(deliverySort)
+	if err != nil {
+		return none, err
+	}
+
+	var owned bool
+	err = d.db.QueryRowContext(ctx, `
+		SELECT EXISTS (SELECT 1 FROM notifications WHERE id = $1 AND user_id = $2)
+	`, notificationID, userID).Scan(&owned)
+	if err != nil {
+		return none, fmt.Errorf("failed to get notification: %w", err)
+	}
+	if !owned {
+		return none, ErrNotificationNotFound
+	}
+
+	var total int
+	if err := d.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM notification_deliveries WHERE notification_id = $1`,
+		notificationID).Scan(&total); err != nil {
+		return none, fmt.Errorf("failed to count deliveries: %w", err)
+	}
+
+	query := `
+		SELECT id, notification_id, channel, status, attempts, error, next_attempt_at, created_at, updated_at,
+			` + deliveryKeyset.KeyText() + `
+		FROM notification_deliveries
+		WHERE notification_id = $1`
+	args := []interface{}{notificationID}
+	if after != nil {
+		query += " AND " + deliveryKeyset.After("$2", "$3")
+		args = append(args, after.Key, after.ID)
+	}
+	query += fmt.Sprintf(" ORDER BY %s LIMIT $%d", deliveryKeyset.OrderBy(), len(args)+1)
+	args = append(args, page.FetchLimit())
+
+	rows, err := d.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return none, fmt.Errorf("failed to get deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	var deliveries []Delivery
+	var keys []string
+	for rows.Next() {
+		var delivery Delivery
+		var next sql.NullTime
+		var key string
+		if err := rows.Scan(&delivery.ID, &delivery.NotificationID, &delivery.Channel, &delivery.Status,
+			&delivery.Attempts, &delivery.Error, &next, &delivery.CreatedAt, &delivery.UpdatedAt, &key); err != nil {
+			return none, fmt.Errorf("failed to scan delivery: %w", err)
+		}
+		if next.Valid {
+			delivery.NextAttemptAt = &next.Time
+		}
+		deliveries = append(deliveries, delivery)
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return none, fmt.Errorf("failed to get deliveries: %w", err)
+	}
+
+	return pagination.NewPage(deliveries, page.Limit, func(i int) pagination.Cursor {
+		return pagination.Cursor{Key: keys[i], ID: deliveries[i].ID.String(), Sort: deliverySort}
+	}).WithTotal(total), nil
+}
+
+// Preferences returns the user's stored channel preferences and quiet hours
+func (d *Dispatcher) Preferences(ctx context.Context, userID uuid.UUID) (*Preferences, error) {
+	prefs := &Preferences{Channels: []ChannelPreference{}}
+
+	rows, err := d.db.QueryContext(ctx, `
+		SELECT type, channel, enabled
+		FROM notification_channel_preferences
+		WHERE user_id = $1
+		ORDER BY type, channel
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get channel preferences: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var pref ChannelPreference
+		if err := rows.Scan(&pref.Type, &pref.Channel, &pref.Enabled); err != nil {
+			return nil, fmt.Errorf("failed to scan channel preference: %w", err)
+		}
+		prefs.Channels = append(prefs.Channels, pref)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read channel preferences: %w", err)
+	}
+
+	var start, end, frequency, channel, at sql.NullString
+	var timezone string
+	err = d.db.QueryRowContext(ctx, `
+		SELECT quiet_start, quiet_end, timezone, digest_frequency, digest_channel, digest_at
+		FROM notification_settings WHERE user_id = $1
+	`, userID).Scan(&start, &end, &timezone, &frequency, &channel, &at)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to get notification settings: %w", err)
+	}
+	if start.Valid && end.Valid {
+		prefs.QuietHours = &QuietHours{Start: start.String, End: end.String, Timezone: timezone}
+	}
+	if frequency.Valid && channel.Valid {
+		prefs.Digest = &Digest{
+			Frequency: DigestFrequency(frequency.String),
+			Channel:   Channel(channel.String),
+			At:        at.String,
+			Timezone:  timezone,
+		}
+	}
+	return prefs, nil
+}
+
+// SetPreferences replaces the user's channel preferences, quiet hours and
+// digest; nil quiet hours or digest turns them off. Notifications waiting
+// for a digest that is turned off stay in the inbox only.
+func (d *Dispatcher) SetPreferences(ctx context.Context, userID uuid.UUID, prefs *Preferences) (*Preferences, error) {
+	if err := prefs.Validate(); err != nil {
+		return nil, err
+	}
+
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM notification_channel_preferences WHERE user_id = $1`, userID); err != nil {
+		return nil, fmt.Errorf("failed to clear channel preferences: %w", err)
+	}
+	for _, pref := range prefs.Channels {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO notification_channel_preferences (user_id, type, channel, enabled)
+			VALUES ($1, $2, $3, $4)
+		`, userID, pref.Type, pref.Channel, pref.Enabled)
+		if err != nil {
+			return nil, fmt.Errorf("failed to save channel preference: %w", err)
+		}
+	}
+
+	var start, end, frequency, channel, at interface{}
+	var nextDigest *time.Time
+	timezone := "UTC"
+	if q := prefs.QuietHours; q != nil {
+		start, end, timezone = q.Start, q.End, q.Timezone
+	}
+	if g := prefs.Digest; g != nil {
+		frequency, channel, at, timezone = g.Frequency, g.Channel, g.At, g.Timezone
+		next := g.next(d.now(), prefs.QuietHours)
+		nextDigest = &next
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO notification_settings (user_id, quiet_start, quiet_end, timezone,
+			digest_frequency, digest_channel, digest_at, next_digest_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (user_id) DO UPDATE
+		SET quiet_start = EXCLUDED.quiet_start, quiet_end = EXCLUDED.quiet_end,
+			timezone = EXCLUDED.timezone, digest_frequency = EXCLUDED.digest_frequency,
+			digest_channel = EXCLUDED.digest_channel, digest_at = EXCLUDED.digest_at,
+			next_digest_at = EXCLUDED.next_digest_at, updated_at = NOW()
+	`, userID, start, end, timezone, frequency, channel, at, nextDigest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save notification settings: %w", err)
+	}
+	if prefs.Digest == nil {
+		_, err := tx.ExecContext(ctx, `DELETE FROM notification_digest_items WHERE user_id = $1 AND digest_id IS NULL`, userID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to clear digest: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit preferences: %w", err)
+	}
+	return d.Preferences(ctx, userID)
+}
+
+// RegisterDevice records a push token for the user. A token moves to the
+// user who registers it last, e.g. after signing in on a shared phone.
+func (d *Dispatcher) RegisterDevice(ctx context.Context, userID uuid.UUID, token, platform string) error {
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return fmt.Errorf("%w: token is required", ErrInvalidDevice)
+	}
+	if platform == "" {
+		platform = "web"
+	}
+	if !contains(devicePlatforms, platform) {
+		return fmt.Errorf("%w: platform must be one of %s", ErrInvalidDevice, strings.Join(devicePlatforms, ", "))
+	}
+
+	_, err := d.db.ExecContext(ctx, `
+		INSERT INTO push_devices (user_id, token, platform)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (token) DO UPDATE
+		SET user_id = EXCLUDED.user_id, platform = EXCLUDED.platform, last_seen_at = NOW()
+	`, userID, token, platform)
+	if err != nil {
+		return fmt.Errorf("failed to register device: %w", err)
+	}
+	return nil
+}
+
+// RemoveDevice deletes one of the user's push tokens
+func (d *Dispatcher) RemoveDevice(ctx context.Context, userID uuid.UUID, token string) error {
+	result, err := d.db.ExecContext(ctx, `DELETE FROM push_devices WHERE user_id = $1 AND token = $2`, userID, token)
+	if err != nil {
+		return fmt.Errorf("failed to remove device: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrDeviceNotFound
+	}
+	return nil
+}
+
+// SetPhone sets the number SMS notifications go to; an empty phone clears
+// it. Callers verify the number first, e.g. with sms.OTPService; a number
+// verified by another user is taken from them.
+func (d *Dispatcher) SetPhone(ctx context.Context, userID uuid.UUID, phone string) error {
+	if phone == "" {
+		_, err := d.db.ExecContext(ctx, `UPDATE users SET phone = NULL, phone_verified_at = NULL WHERE id = $1`, userID)
+		if err != nil {
+			return fmt.Errorf("failed to clear phone: %w", err)
+		}
+		return nil
+	}
+
+	phone, err := sms.NormalizeNumber(phone)
+	if err != nil {
+		return err
+	}
+
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE users SET phone = NULL, phone_verified_at = NULL
+		WHERE phone = $2 AND id <> $1
+	`, userID, phone)
+	if err != nil {
+		return fmt.Errorf("failed to release phone: %w", err)
+	}
+	_, err = tx.ExecContext(ctx, `UPDATE users SET phone = $2, phone_verified_at = NOW() WHERE id = $1`, userID, phone)
+	if err != nil {
+		return fmt.Errorf("failed to set phone: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit phone: %w", err)
+	}
+	return nil
+}
+
+// Language returns the user's preferred language
+func (d *Dispatcher) Language(ctx context.Context, userID uuid.UUID) (string, error) {
+	var language string
+	err := d.db.QueryRowContext(ctx, `
+		SELECT preferred_language FROM users WHERE id = $1
+	`, userID).Scan(&language)
+	if err != nil {
+		return "", fmt.Errorf("failed to get language: %w", err)
+	}
+	return language, nil
+}
+
+// SetLanguage sets the language the user's notifications are rendered in;
+// it must have templates
+func (d *Dispatcher) SetLanguage(ctx context.Context, userID uuid.UUID, language string) error {
+	language = normalizeLanguage(language)
+	if !d.templates.Supports(language) {
+		return fmt.Errorf("%w: %q", ErrUnsupportedLanguage, language)
+	}
+	_, err := d.db.ExecContext(ctx, `UPDATE users SET preferred_language = $2 WHERE id = $1`, userID, language)
+	if err != nil {
+		return fmt.Errorf("failed to set language: %w", err)
+	}
+	return nil
+}
+
+// Start retries due deliveries and sends due digests in the background
+func (d *Dispatcher) Start(interval time.Duration) {
+	d.once.Do(func() {
+		log.Printf("Starting notification delivery retries and digests (interval: %v)", interval)
+
+		go func() {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-d.ctx.Done():
+					return
+				case <-ticker.C:
+					if err := d.RetryDue(d.ctx); err != nil {
+						log.Printf("Notification delivery retries failed: %v", err)
+					}
+					if err := d.SendDigests(d.ctx); err != nil {
+						log.Printf("Notification digests failed: %v", err)
+					}
+				}
+			}
+		}()
+	})
+}
+
+// Stop stops the retry and digest worker and pending fan-outs
+func (d *Dispatcher) Stop() {
+	d.cancel()
+}
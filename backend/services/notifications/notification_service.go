@@ -1,29 +1,47 @@
 package notifications
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"sync"
 	"time"
 
 	"github.com/Andrew-mugwe/agroai/models"
+	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 )
 
-// NotificationService handles real-time notifications
+// sendBuffer is how many messages a connection may fall behind by before
+// the hub drops it
+const sendBuffer = 64
+
+// NotificationService is the hub for real-time notifications. It indexes
+// connections by user so a message for one user only reaches that user's
+// connections, and never writes to a connection itself: each connection
+// has a buffered send queue drained by its own write pump, and one that
+// falls behind is dropped rather than stalling everyone else.
 type NotificationService struct {
-	clients    map[string]*websocket.Conn
+	clients    map[*Client]bool
+	users      map[string]map[*Client]bool
 	broadcast  chan NotificationMessage
 	register   chan *Client
 	unregister chan *Client
+	mutex      sync.RWMutex
+
+	// templates render order and payment notifications in the language
+	// languages returns for the user
+	templates *Templates
+	languages LanguageFunc
 }
 
-// Client represents a WebSocket client
+// Client represents a WebSocket client; a user has one per open tab
 type Client struct {
-	ID       string
-	UserID   string
-	Conn     *websocket.Conn
-	Send     chan NotificationMessage
-	Service  *NotificationService
+	ID      string
+	UserID  string
+	Conn    *websocket.Conn
+	Send    chan NotificationMessage
+	Service *NotificationService
 }
 
 // NotificationMessage represents a notification message
@@ -39,33 +57,93 @@ type NotificationMessage struct {
 // NewNotificationService creates a new notification service
 func NewNotificationService() *NotificationService {
 	service := &NotificationService{
-		clients:    make(map[string]*websocket.Conn),
-		broadcast:  make(chan NotificationMessage),
+		clients:    make(map[*Client]bool),
+		users:      make(map[string]map[*Client]bool),
+		broadcast:  make(chan NotificationMessage, sendBuffer),
 		register:   make(chan *Client),
 		unregister: make(chan *Client),
+		templates:  DefaultTemplates(),
 	}
-	
+
 	go service.run()
 	return service
 }
 
-// run handles client connections and message broadcasting
+// NewClient creates a client for a user's connection
+func (s *NotificationService) NewClient(conn *websocket.Conn, userID string) *Client {
+	return &Client{
+		ID:      fmt.Sprintf("client_%d", time.Now().UnixNano()),
+		UserID:  userID,
+		Conn:    conn,
+		Send:    make(chan NotificationMessage, sendBuffer),
+		Service: s,
+	}
+}
+
+// run handles client connections and message routing
 func (s *NotificationService) run() {
 	for {
 		select {
 		case client := <-s.register:
-			s.clients[client.ID] = client.Conn
-			log.Printf("Client connected: %s", client.ID)
-			
+			s.registerClient(client)
+
 		case client := <-s.unregister:
-			if conn, ok := s.clients[client.ID]; ok {
-				delete(s.clients, client.ID)
-				conn.Close()
-				log.Printf("Client disconnected: %s", client.ID)
-			}
-			
+			s.mutex.Lock()
+			s.removeClient(client)
+			s.mutex.Unlock()
+
 		case message := <-s.broadcast:
-			s.broadcastToClients(message)
+			s.route(message)
+		}
+	}
+}
+
+// registerClient adds a client to the user index
+func (s *NotificationService) registerClient(client *Client) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.clients[client] = true
+	if s.users[client.UserID] == nil {
+		s.users[client.UserID] = make(map[*Client]bool)
+	}
+	s.users[client.UserID][client] = true
+	log.Printf("Client connected: %s (user %s)", client.ID, client.UserID)
+}
+
+// removeClient drops a client and closes its send queue, which ends its
+// write pump and connection. The caller holds the lock.
+func (s *NotificationService) removeClient(client *Client) {
+	if !s.clients[client] {
+		return
+	}
+	delete(s.clients, client)
+	if conns := s.users[client.UserID]; conns != nil {
+		delete(conns, client)
+		if len(conns) == 0 {
+			delete(s.users, client.UserID)
+		}
+	}
+	close(client.Send)
+	log.Printf("Client disconnected: %s", client.ID)
+}
+
+// route queues a message on its user's connections, or on every
+// connection when it has no user
+func (s *NotificationService) route(message NotificationMessage) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	targets := s.clients
+	if message.UserID != "" {
+		targets = s.users[message.UserID]
+	}
+	for client := range targets {
+		select {
+		case client.Send <- message:
+		default:
+			log.Printf("Dropping slow client %s", client.ID)
+			s.removeClient(client)
 		}
 	}
 }
@@ -80,116 +158,88 @@ func (s *NotificationService) UnregisterClient(client *Client) {
 	s.unregister <- client
 }
 
-// BroadcastMessage broadcasts a message to all connected clients
+// BroadcastMessage sends a message to every connected client
 func (s *NotificationService) BroadcastMessage(message NotificationMessage) {
+	message.UserID = ""
 	s.broadcast <- message
 }
 
-// SendToUser sends a message to a specific user
+// SendToUser sends a message to every connection of one user
 func (s *NotificationService) SendToUser(userID string, message NotificationMessage) {
+	if userID == "" {
+		return
+	}
 	message.UserID = userID
 	s.broadcast <- message
 }
 
-// broadcastToClients broadcasts a message to all connected clients
-func (s *NotificationService) broadcastToClients(message NotificationMessage) {
-	for clientID, conn := range s.clients {
-		// If message has a specific user ID, only send to that user
-		if message.UserID != "" {
-			// In a real implementation, you'd need to track user-to-client mapping
-			// For now, we'll send to all clients
-		}
-		
-		err := conn.WriteJSON(message)
-		if err != nil {
-			log.Printf("Error sending message to client %s: %v", clientID, err)
-			conn.Close()
-			delete(s.clients, clientID)
-		}
+// SetLanguages sets how the hub finds a user's preferred language; without
+// it order and payment notifications are in DefaultLanguage
+func (s *NotificationService) SetLanguages(languages LanguageFunc) {
+	s.languages = languages
+}
+
+// language returns the user's preferred language, or DefaultLanguage when
+// it cannot be found
+func (s *NotificationService) language(userID string) string {
+	id, err := uuid.Parse(userID)
+	if s.languages == nil || err != nil {
+		return DefaultLanguage
 	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	language, err := s.languages(ctx, id)
+	if err != nil || language == "" {
+		return DefaultLanguage
+	}
+	return language
 }
 
-// SendOrderNotification sends an order-related notification
-func (s *NotificationService) SendOrderNotification(userID string, order *models.Order, notificationType string) {
-	var title, message string
-	
-	switch notificationType {
-	case "order_created":
-		title = "Order Created"
-		message = fmt.Sprintf("Your order %s has been created successfully", order.OrderNumber)
-	case "order_confirmed":
-		title = "Order Confirmed"
-		message = fmt.Sprintf("Your order %s has been confirmed by the seller", order.OrderNumber)
-	case "order_shipped":
-		title = "Order Shipped"
-		message = fmt.Sprintf("Your order %s has been shipped", order.OrderNumber)
-	case "order_delivered":
-		title = "Order Delivered"
-		message = fmt.Sprintf("Your order %s has been delivered", order.OrderNumber)
-	case "payment_received":
-		title = "Payment Received"
-		message = fmt.Sprintf("Payment received for order %s", order.OrderNumber)
-	case "payment_failed":
-		title = "Payment Failed"
-		message = fmt.Sprintf("Payment failed for order %s", order.OrderNumber)
-	default:
-		title = "Order Update"
-		message = fmt.Sprintf("Your order %s has been updated", order.OrderNumber)
+// sendTemplate renders a template in the user's language and sends it to
+// their connections, falling back to the fallback template for unknown
+// notification types
+func (s *NotificationService) sendTemplate(userID, notificationType, fallback string, data map[string]interface{}) {
+	name := notificationType
+	if !s.templates.Has(name) {
+		name = fallback
 	}
-	
-	notification := NotificationMessage{
+	rendered, err := s.templates.Render(name, s.language(userID), ChannelWebSocket, data)
+	if err != nil {
+		log.Printf("Failed to render %s notification: %v", notificationType, err)
+		return
+	}
+
+	s.SendToUser(userID, NotificationMessage{
 		Type:      notificationType,
-		Title:     title,
-		Message:   message,
+		Title:     rendered.Title,
+		Message:   rendered.Body,
 		Timestamp: time.Now(),
 		UserID:    userID,
-		Data: map[string]interface{}{
-			"order_id":     order.ID.String(),
-			"order_number": order.OrderNumber,
-			"status":       string(order.Status),
-			"total_amount": order.TotalAmount.String(),
-			"currency":     order.Currency,
-		},
-	}
-	
-	s.SendToUser(userID, notification)
+		Data:      data,
+	})
+}
+
+// SendOrderNotification sends an order-related notification
+func (s *NotificationService) SendOrderNotification(userID string, order *models.Order, notificationType string) {
+	s.sendTemplate(userID, notificationType, "order_updated", map[string]interface{}{
+		"order_id":     order.ID.String(),
+		"order_number": order.OrderNumber,
+		"status":       string(order.Status),
+		"total_amount": order.TotalAmount.String(),
+		"amount":       order.TotalAmount.String(),
+		"currency":     order.Currency,
+	})
 }
 
 // SendPaymentNotification sends a payment-related notification
 func (s *NotificationService) SendPaymentNotification(userID string, transaction *models.PaymentTransaction, notificationType string) {
-	var title, message string
-	
-	switch notificationType {
-	case "payment_success":
-		title = "Payment Successful"
-		message = fmt.Sprintf("Payment of %s %s was successful", transaction.Amount.String(), transaction.Currency)
-	case "payment_failed":
-		title = "Payment Failed"
-		message = fmt.Sprintf("Payment of %s %s failed", transaction.Amount.String(), transaction.Currency)
-	case "payment_refunded":
-		title = "Payment Refunded"
-		message = fmt.Sprintf("Payment of %s %s has been refunded", transaction.Amount.String(), transaction.Currency)
-	default:
-		title = "Payment Update"
-		message = fmt.Sprintf("Payment update for transaction %s", transaction.TransactionID)
-	}
-	
-	notification := NotificationMessage{
-		Type:      notificationType,
-		Title:     title,
-		Message:   message,
-		Timestamp: time.Now(),
-		UserID:    userID,
-		Data: map[string]interface{}{
-			"transaction_id": transaction.TransactionID,
-			"amount":         transaction.Amount.String(),
-			"currency":       transaction.Currency,
-			"provider":       transaction.Provider,
-			"status":         string(transaction.Status),
-		},
-	}
-	
-	s.SendToUser(userID, notification)
+	s.sendTemplate(userID, notificationType, "payment_updated", map[string]interface{}{
+		"transaction_id": transaction.TransactionID,
+		"amount":         transaction.Amount.String(),
+		"currency":       transaction.Currency,
+		"provider":       transaction.Provider,
+		"status":         string(transaction.Status),
+	})
 }
 
 // SendSystemNotification sends a system-wide notification
@@ -207,34 +257,37 @@ func (s *NotificationService) SendSystemNotification(title, message string, data
 
 // GetConnectedClients returns the number of connected clients
 func (s *NotificationService) GetConnectedClients() int {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
 	return len(s.clients)
 }
 
+// GetConnectedUsers returns the number of users with at least one connection
+func (s *NotificationService) GetConnectedUsers() int {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return len(s.users)
+}
+
 // HandleWebSocket handles WebSocket connections for notifications
 func (s *NotificationService) HandleWebSocket(conn *websocket.Conn, userID string) {
-	client := &Client{
-		ID:      fmt.Sprintf("client_%d", time.Now().UnixNano()),
-		UserID:  userID,
-		Conn:    conn,
-		Send:    make(chan NotificationMessage),
-		Service: s,
-	}
-	
+	client := s.NewClient(conn, userID)
 	s.RegisterClient(client)
-	
+
 	// Start goroutines for reading and writing
 	go client.writePump()
 	go client.readPump()
 }
 
-// writePump pumps messages from the hub to the websocket connection
+// writePump writes queued messages to the websocket connection. It is the
+// only writer, so a slow connection only holds up itself.
 func (c *Client) writePump() {
 	ticker := time.NewTicker(54 * time.Second)
 	defer func() {
 		ticker.Stop()
 		c.Conn.Close()
 	}()
-	
+
 	for {
 		select {
 		case message, ok := <-c.Send:
@@ -243,12 +296,12 @@ func (c *Client) writePump() {
 				c.Conn.WriteMessage(websocket.CloseMessage, []byte{})
 				return
 			}
-			
+
 			if err := c.Conn.WriteJSON(message); err != nil {
 				log.Printf("Error writing message: %v", err)
 				return
 			}
-			
+
 		case <-ticker.C:
 			c.Conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
 			if err := c.Conn.WriteMessage(websocket.PingMessage, nil); err != nil {
@@ -258,20 +311,21 @@ func (c *Client) writePump() {
 	}
 }
 
-// readPump pumps messages from the websocket connection to the hub
+// readPump reads from the websocket connection until it closes, then
+// unregisters the client
 func (c *Client) readPump() {
 	defer func() {
 		c.Service.UnregisterClient(c)
 		c.Conn.Close()
 	}()
-	
+
 	c.Conn.SetReadLimit(512)
 	c.Conn.SetReadDeadline(time.Now().Add(60 * time.Second))
 	c.Conn.SetPongHandler(func(string) error {
 		c.Conn.SetReadDeadline(time.Now().Add(60 * time.Second))
 		return nil
 	})
-	
+
 	for {
 		_, _, err := c.Conn.ReadMessage()
 		if err != nil {
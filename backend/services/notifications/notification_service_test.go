@@ -0,0 +1,123 @@
+package notifications
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testHub serves the hub over a real websocket; ?user= names the user
+func testHub(t *testing.T) (*NotificationService, func(user string) *websocket.Conn) {
+	t.Helper()
+	svc := NewNotificationService()
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		svc.HandleWebSocket(conn, r.URL.Query().Get("user"))
+	}))
+	t.Cleanup(server.Close)
+
+	dial := func(user string) *websocket.Conn {
+		conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"?user="+user, nil)
+		require.NoError(t, err)
+		t.Cleanup(func() { conn.Close() })
+		return conn
+	}
+	return svc, dial
+}
+
+func waitForClients(t *testing.T, svc *NotificationService, n int) {
+	t.Helper()
+	require.Eventually(t, func() bool { return svc.GetConnectedClients() == n }, 2*time.Second, 5*time.Millisecond)
+}
+
+func readMessage(t *testing.T, conn *websocket.Conn) NotificationMessage {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var msg NotificationMessage
+	require.NoError(t, conn.ReadJSON(&msg))
+	return msg
+}
+
+func TestSendToUserReachesOnlyThatUser(t *testing.T) {
+	svc, dial := testHub(t)
+	aliceTab1, aliceTab2, bob := dial("alice"), dial("alice"), dial("bob")
+	waitForClients(t, svc, 3)
+	assert.Equal(t, 2, svc.GetConnectedUsers())
+
+	svc.SendToUser("alice", NotificationMessage{Type: "order_created", Message: "for alice"})
+	svc.SendToUser("bob", NotificationMessage{Type: "order_created", Message: "for bob"})
+	svc.SendToUser("alice", NotificationMessage{Type: "payment_success", Message: "for alice again"})
+
+	// Every tab of a user gets their messages in order, and nothing else
+	for _, tab := range []*websocket.Conn{aliceTab1, aliceTab2} {
+		assert.Equal(t, "for alice", readMessage(t, tab).Message)
+		assert.Equal(t, "for alice again", readMessage(t, tab).Message)
+	}
+	msg := readMessage(t, bob)
+	assert.Equal(t, "for bob", msg.Message)
+	assert.Equal(t, "bob", msg.UserID)
+}
+
+func TestBroadcastReachesEveryone(t *testing.T) {
+	svc, dial := testHub(t)
+	alice, bob := dial("alice"), dial("bob")
+	waitForClients(t, svc, 2)
+
+	svc.SendSystemNotification("Maintenance", "Back at 10:00", nil)
+	assert.Equal(t, "Back at 10:00", readMessage(t, alice).Message)
+	assert.Equal(t, "Back at 10:00", readMessage(t, bob).Message)
+}
+
+func TestClosedTabIsUnregistered(t *testing.T) {
+	svc, dial := testHub(t)
+	tab1, tab2 := dial("alice"), dial("alice")
+	waitForClients(t, svc, 2)
+
+	tab1.Close()
+	waitForClients(t, svc, 1)
+
+	svc.SendToUser("alice", NotificationMessage{Message: "still here"})
+	assert.Equal(t, "still here", readMessage(t, tab2).Message)
+}
+
+func TestSlowClientIsDroppedWithoutStallingOthers(t *testing.T) {
+	svc := NewNotificationService()
+	slow, fast := svc.NewClient(nil, "slow"), svc.NewClient(nil, "fast")
+	svc.RegisterClient(slow)
+	svc.RegisterClient(fast)
+
+	// Nobody drains the slow client's queue
+	for i := 0; i <= sendBuffer; i++ {
+		svc.SendToUser("slow", NotificationMessage{Message: "backlog"})
+	}
+	svc.SendToUser("fast", NotificationMessage{Message: "on time"})
+
+	select {
+	case msg := <-fast.Send:
+		assert.Equal(t, "on time", msg.Message)
+	case <-time.After(2 * time.Second):
+		t.Fatal("fast client stalled behind slow client")
+	}
+
+	// The slow client kept its full buffer and was then disconnected
+	queued := 0
+	for range slow.Send {
+		queued++
+	}
+	assert.Equal(t, sendBuffer, queued)
+	assert.Equal(t, 1, svc.GetConnectedClients())
+
+	// Unregistering a dropped client is harmless
+	svc.UnregisterClient(slow)
+	assert.Equal(t, 1, svc.GetConnectedClients())
+}
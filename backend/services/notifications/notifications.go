@@ -3,10 +3,12 @@ package notifications
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"time"
 
+	"github.com/Andrew-mugwe/agroai/pagination"
 	"github.com/google/uuid"
 )
 
@@ -30,13 +32,46 @@ type Notification struct {
 
 // NotificationRequest represents a request to create a notification
 type NotificationRequest struct {
-	UserID   uuid.UUID              `json:"user_id"`
-	Role     string                 `json:"role"`
-	Type     string                 `json:"type"`
-	Message  string                 `json:"message"`
+	UserID  uuid.UUID `json:"user_id"`
+	Role    string    `json:"role"`
+	Type    string    `json:"type"`
+	Message string    `json:"message"`
+	// Template, when set, names the template the dispatcher renders the
+	// message from, with Metadata as its variables
+	Template string `json:"template,omitempty"`
+	// Priority high skips the user's digest; it defaults to normal, or to
+	// high for urgentEvents
+	Priority Priority               `json:"priority,omitempty"`
 	Metadata map[string]interface{} `json:"metadata,omitempty"`
 }
 
+// Priority decides whether a notification may wait for the user's digest
+type Priority string
+
+const (
+	PriorityNormal Priority = "normal"
+	PriorityHigh   Priority = "high"
+)
+
+// urgentEvents are templates and events that go out immediately unless
+// the caller sets a priority
+var urgentEvents = map[string]bool{
+	"payment_failed": true,
+	"dispute_opened": true,
+}
+
+// priority resolves the request's priority
+func (req *NotificationRequest) priority() Priority {
+	if req.Priority != "" {
+		return req.Priority
+	}
+	event, _ := req.Metadata["event"].(string)
+	if urgentEvents[req.Template] || urgentEvents[event] {
+		return PriorityHigh
+	}
+	return PriorityNormal
+}
+
 // NotificationResponse represents the response for notification operations
 type NotificationResponse struct {
 	Success bool          `json:"success"`
@@ -45,16 +80,11 @@ type NotificationResponse struct {
 	Count   int           `json:"count,omitempty"`
 }
 
-// NotificationListResponse represents the response for listing notifications
+// NotificationListResponse is a page of notifications in the list envelope
+// with the user's unread count
 type NotificationListResponse struct {
-	Success       bool           `json:"success"`
-	Message       string         `json:"message"`
-	Notifications []Notification `json:"notifications"`
-	Total         int            `json:"total"`
-	UnreadCount   int            `json:"unread_count"`
-	Page          int            `json:"page"`
-	PageSize      int            `json:"page_size"`
-	TotalPages    int            `json:"total_pages"`
+	pagination.Envelope
+	UnreadCount int `json:"unread_count"`
 }
 
 // NotificationQuery represents query parameters for filtering notifications
@@ -63,10 +93,15 @@ type NotificationQuery struct {
 	Role   string
 	Type   string
 	Status string
-	Limit  int
-	Offset int
+	Page   pagination.Params
 }
 
+// notificationSort is the only notification list order; cursors carry it
+const notificationSort = "newest"
+
+// notificationKeyset lists notifications newest first
+var notificationKeyset = pagination.Keyset{Key: "created_at", ID: "id", Dir: pagination.Desc}
+
 // NewDatabaseNotificationService creates a new database notification service instance
 func NewDatabaseNotificationService(db *sql.DB) *DatabaseNotificationService {
 	return &DatabaseNotificationService{
@@ -74,32 +109,55 @@ func NewDatabaseNotificationService(db *sql.DB) *DatabaseNotificationService {
 	}
 }
 
-// SendNotification creates a new notification for a user
+// Notification roles and types accepted by the inbox
+var (
+	validRoles = []string{"farmer", "ngo", "trader", "admin"}
+	validTypes = []string{"weather", "pest", "training", "stock", "price", "system", "market", "crop", "general"}
+)
+
+// ErrInvalidNotification is returned for notification requests that fail
+// validation
+var ErrInvalidNotification = errors.New("invalid notification")
+
+// IsValidType reports whether t is a notification type
+func IsValidType(t string) bool {
+	return contains(validTypes, t)
+}
+
+// SendNotification creates a new notification for a user. It only stores
+// it in the inbox; Dispatcher also delivers it over the user's channels.
 func (ns *DatabaseNotificationService) SendNotification(req NotificationRequest) (*Notification, error) {
+	return ns.create(req, "unread")
+}
+
+// create validates and stores a notification with the given read status
+func (ns *DatabaseNotificationService) create(req NotificationRequest, status string) (*Notification, error) {
 	// Validate required fields
 	if req.UserID == uuid.Nil {
-		return nil, fmt.Errorf("user_id is required")
+		return nil, fmt.Errorf("%w: user_id is required", ErrInvalidNotification)
 	}
 	if req.Role == "" {
-		return nil, fmt.Errorf("role is required")
+		return nil, fmt.Errorf("%w: role is required", ErrInvalidNotification)
 	}
 	if req.Type == "" {
-		return nil, fmt.Errorf("type is required")
+		return nil, fmt.Errorf("%w: type is required", ErrInvalidNotification)
 	}
 	if req.Message == "" {
-		return nil, fmt.Errorf("message is required")
+		return nil, fmt.Errorf("%w: message is required", ErrInvalidNotification)
 	}
 
 	// Validate role
-	validRoles := []string{"farmer", "ngo", "trader", "admin"}
 	if !contains(validRoles, req.Role) {
-		return nil, fmt.Errorf("invalid role: %s", req.Role)
+		return nil, fmt.Errorf("%w: invalid role: %s", ErrInvalidNotification, req.Role)
 	}
 
 	// Validate type
-	validTypes := []string{"weather", "pest", "training", "stock", "price", "system", "market", "crop", "general"}
 	if !contains(validTypes, req.Type) {
-		return nil, fmt.Errorf("invalid type: %s", req.Type)
+		return nil, fmt.Errorf("%w: invalid type: %s", ErrInvalidNotification, req.Type)
+	}
+
+	if req.Priority != "" && req.Priority != PriorityNormal && req.Priority != PriorityHigh {
+		return nil, fmt.Errorf("%w: invalid priority: %s", ErrInvalidNotification, req.Priority)
 	}
 
 	// Convert metadata to JSON
@@ -115,14 +173,14 @@ func (ns *DatabaseNotificationService) SendNotification(req NotificationRequest)
 	// Insert notification
 	query := `
 		INSERT INTO notifications (user_id, role, type, message, metadata, status)
-		VALUES ($1, $2, $3, $4, $5, 'unread')
+		VALUES ($1, $2, $3, $4, $5, $6)
 		RETURNING id, user_id, role, type, message, status, metadata, created_at, updated_at
 	`
 
 	var notification Notification
 	var metadataStr string
 
-	err := ns.db.QueryRow(query, req.UserID, req.Role, req.Type, req.Message, metadataJSON).Scan(
+	err := ns.db.QueryRow(query, req.UserID, req.Role, req.Type, req.Message, metadataJSON, status).Scan(
 		&notification.ID,
 		&notification.UserID,
 		&notification.Role,
@@ -149,9 +207,6 @@ func (ns *DatabaseNotificationService) SendNotification(req NotificationRequest)
 		notification.Metadata = make(map[string]interface{})
 	}
 
-	// Send email notification if user has verified email (future extension)
-	go ns.sendEmailNotification(notification)
-
 	return &notification, nil
 }
 
@@ -180,24 +235,16 @@ func (ns *DatabaseNotificationService) GetNotifications(query NotificationQuery)
 		argIndex++
 	}
 
-	// Set default pagination
-	limit := query.Limit
-	if limit <= 0 {
-		limit = 50
-	}
-	if limit > 100 {
-		limit = 100
-	}
-
-	offset := query.Offset
-	if offset < 0 {
-		offset = 0
+	page := query.Page.Normalize()
+	after, err := page.After(notificationSort)
+	if err != nil {
+		return nil, err
 	}
 
 	// Get total count
 	countQuery := fmt.Sprintf("SELECT COUNT(*) FROM notifications %s", whereClause)
 	var total int
-	err := ns.db.QueryRow(countQuery, args...).Scan(&total)
+	err = ns.db.QueryRow(countQuery, args...).Scan(&total)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get notification count: %v", err)
 	}
@@ -211,16 +258,23 @@ func (ns *DatabaseNotificationService) GetNotifications(query NotificationQuery)
 		unreadCount = 0
 	}
 
+	// Resume after the cursor
+	if after != nil {
+		whereClause += " AND " + notificationKeyset.After(fmt.Sprintf("$%d", argIndex), fmt.Sprintf("$%d", argIndex+1))
+		args = append(args, after.Key, after.ID)
+		argIndex += 2
+	}
+
 	// Get notifications
 	notificationsQuery := fmt.Sprintf(`
-		SELECT id, user_id, role, type, message, status, metadata, created_at, updated_at
+		SELECT id, user_id, role, type, message, status, metadata, created_at, updated_at, %s
 		FROM notifications
 		%s
-		ORDER BY created_at DESC
-		LIMIT $%d OFFSET $%d
-	`, whereClause, argIndex, argIndex+1)
+		ORDER BY %s
+		LIMIT $%d
+	`, notificationKeyset.KeyText(), whereClause, notificationKeyset.OrderBy(), argIndex)
 
-	args = append(args, limit, offset)
+	args = append(args, page.FetchLimit())
 
 	rows, err := ns.db.Query(notificationsQuery, args...)
 	if err != nil {
@@ -229,9 +283,11 @@ func (ns *DatabaseNotificationService) GetNotifications(query NotificationQuery)
 	defer rows.Close()
 
 	var notifications []Notification
+	var keys []string
 	for rows.Next() {
 		var notification Notification
 		var metadataStr string
+		var key string
 
 		err := rows.Scan(
 			&notification.ID,
@@ -243,6 +299,7 @@ func (ns *DatabaseNotificationService) GetNotifications(query NotificationQuery)
 			&metadataStr,
 			&notification.CreatedAt,
 			&notification.UpdatedAt,
+			&key,
 		)
 		if err != nil {
 			log.Printf("Error scanning notification: %v", err)
@@ -261,21 +318,16 @@ func (ns *DatabaseNotificationService) GetNotifications(query NotificationQuery)
 		}
 
 		notifications = append(notifications, notification)
+		keys = append(keys, key)
 	}
 
-	// Calculate pagination
-	totalPages := (total + limit - 1) / limit
-	page := (offset / limit) + 1
+	list := pagination.NewPage(notifications, page.Limit, func(i int) pagination.Cursor {
+		return pagination.Cursor{Key: keys[i], ID: notifications[i].ID.String(), Sort: notificationSort}
+	}).WithTotal(total)
 
 	return &NotificationListResponse{
-		Success:       true,
-		Message:       "Notifications retrieved successfully",
-		Notifications: notifications,
-		Total:         total,
-		UnreadCount:   unreadCount,
-		Page:          page,
-		PageSize:      limit,
-		TotalPages:    totalPages,
+		Envelope:    pagination.NewEnvelope(list),
+		UnreadCount: unreadCount,
 	}, nil
 }
 
@@ -411,13 +463,6 @@ func (ns *DatabaseNotificationService) GetNotificationStats(userID uuid.UUID) (m
 	return stats, nil
 }
 
-// sendEmailNotification sends an email notification (future extension)
-func (ns *DatabaseNotificationService) sendEmailNotification(notification Notification) {
-	// TODO: Implement SendGrid integration
-	// This is a stub for future email notification functionality
-	log.Printf("Email notification would be sent for notification %s to user %s", notification.ID, notification.UserID)
-}
-
 // Helper function to check if a slice contains a string
 func contains(slice []string, item string) bool {
 	for _, s := range slice {
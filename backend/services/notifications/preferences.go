@@ -0,0 +1,309 @@
+package notifications
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Channel is a way of delivering a notification to a user
+type Channel string
+
+const (
+	// ChannelInApp is the notification inbox
+	ChannelInApp Channel = "in_app"
+	// ChannelWebSocket pushes to the user's open connections
+	ChannelWebSocket Channel = "websocket"
+	ChannelEmail     Channel = "email"
+	ChannelSMS       Channel = "sms"
+	// ChannelPush sends to the user's registered devices
+	ChannelPush Channel = "push"
+)
+
+// Channels lists every channel in preference order
+var Channels = []Channel{ChannelInApp, ChannelWebSocket, ChannelEmail, ChannelSMS, ChannelPush}
+
+// AllTypes is the preference type that applies to every notification type
+const AllTypes = "*"
+
+// ErrInvalidPreferences is returned for malformed channel preferences
+var ErrInvalidPreferences = errors.New("invalid notification preferences")
+
+// IsValid reports whether c is a known channel
+func (c Channel) IsValid() bool {
+	for _, channel := range Channels {
+		if c == channel {
+			return true
+		}
+	}
+	return false
+}
+
+// Interrupts reports whether the channel reaches the user outside the app,
+// so it waits until quiet hours end
+func (c Channel) Interrupts() bool {
+	return c == ChannelEmail || c == ChannelSMS || c == ChannelPush
+}
+
+// defaultEnabled is used when the user has no preference for a channel;
+// SMS costs money per message so users opt in to it
+func (c Channel) defaultEnabled() bool {
+	return c != ChannelSMS
+}
+
+// ChannelPreference turns a channel on or off for a notification type, or
+// for every type when Type is AllTypes
+type ChannelPreference struct {
+	Type    string  `json:"type"`
+	Channel Channel `json:"channel"`
+	Enabled bool    `json:"enabled"`
+}
+
+// QuietHours is a daily window, in the user's timezone, during which
+// interrupting channels are held back. End before Start wraps past
+// midnight, e.g. 22:00-07:00.
+type QuietHours struct {
+	Start    string `json:"start"`
+	End      string `json:"end"`
+	Timezone string `json:"timezone"`
+}
+
+// DigestFrequency is how often a digest goes out
+type DigestFrequency string
+
+const (
+	DigestHourly DigestFrequency = "hourly"
+	DigestDaily  DigestFrequency = "daily"
+)
+
+// defaultDigestAt is when daily digests go out without a time
+const defaultDigestAt = "08:00"
+
+// Digest batches normal-priority notifications into a summary sent over
+// one channel instead of interrupting the user with each of them. Hourly
+// digests go out on the hour and daily ones at At, both in the user's
+// timezone; the inbox still gets every notification straight away.
+type Digest struct {
+	Frequency DigestFrequency `json:"frequency"`
+	Channel   Channel         `json:"channel"`
+	At        string          `json:"at,omitempty"`
+	Timezone  string          `json:"timezone"`
+}
+
+// Preferences are a user's delivery settings
+type Preferences struct {
+	Channels   []ChannelPreference `json:"channels"`
+	QuietHours *QuietHours         `json:"quiet_hours,omitempty"`
+	Digest     *Digest             `json:"digest,omitempty"`
+}
+
+// Validate checks channel names, types and the quiet hours window
+func (p *Preferences) Validate() error {
+	seen := make(map[ChannelPreference]bool)
+	for _, pref := range p.Channels {
+		if !pref.Channel.IsValid() {
+			return fmt.Errorf("%w: unknown channel %q", ErrInvalidPreferences, pref.Channel)
+		}
+		if pref.Type != AllTypes && !IsValidType(pref.Type) {
+			return fmt.Errorf("%w: unknown type %q", ErrInvalidPreferences, pref.Type)
+		}
+		key := ChannelPreference{Type: pref.Type, Channel: pref.Channel}
+		if seen[key] {
+			return fmt.Errorf("%w: %s is set twice for %s", ErrInvalidPreferences, pref.Channel, pref.Type)
+		}
+		seen[key] = true
+	}
+
+	if q := p.QuietHours; q != nil {
+		if _, err := parseClock(q.Start); err != nil {
+			return fmt.Errorf("%w: quiet hours start: %v", ErrInvalidPreferences, err)
+		}
+		if _, err := parseClock(q.End); err != nil {
+			return fmt.Errorf("%w: quiet hours end: %v", ErrInvalidPreferences, err)
+		}
+		if q.Timezone == "" {
+			q.Timezone = "UTC"
+		}
+		if _, err := time.LoadLocation(q.Timezone); err != nil {
+			return fmt.Errorf("%w: unknown timezone %q", ErrInvalidPreferences, q.Timezone)
+		}
+	}
+
+	if g := p.Digest; g != nil {
+		if g.Frequency != DigestHourly && g.Frequency != DigestDaily {
+			return fmt.Errorf("%w: digest frequency must be hourly or daily", ErrInvalidPreferences)
+		}
+		if !g.Channel.Interrupts() {
+			return fmt.Errorf("%w: digests go out by email, sms or push", ErrInvalidPreferences)
+		}
+		if g.Frequency == DigestDaily && g.At == "" {
+			g.At = defaultDigestAt
+		}
+		if g.At != "" {
+			if _, err := parseClock(g.At); err != nil {
+				return fmt.Errorf("%w: digest time: %v", ErrInvalidPreferences, err)
+			}
+		}
+		if g.Timezone == "" {
+			g.Timezone = "UTC"
+		}
+		if _, err := time.LoadLocation(g.Timezone); err != nil {
+			return fmt.Errorf("%w: unknown timezone %q", ErrInvalidPreferences, g.Timezone)
+		}
+		// The user has one timezone, shared by quiet hours and digests
+		if q := p.QuietHours; q != nil && q.Timezone != g.Timezone {
+			return fmt.Errorf("%w: quiet hours and digest must use the same timezone", ErrInvalidPreferences)
+		}
+	}
+	return nil
+}
+
+// Enabled reports whether notifications of a type go out on a channel. A
+// preference for the type wins over one for AllTypes, which wins over the
+// channel default.
+func (p *Preferences) Enabled(notificationType string, channel Channel) bool {
+	enabled := channel.defaultEnabled()
+	for _, pref := range p.Channels {
+		if pref.Channel != channel {
+			continue
+		}
+		switch pref.Type {
+		case notificationType:
+			return pref.Enabled
+		case AllTypes:
+			enabled = pref.Enabled
+		}
+	}
+	return enabled
+}
+
+// WithDefaults returns the preferences with an AllTypes entry for every
+// channel the user has not set, so clients can show the full picture
+func (p *Preferences) WithDefaults() *Preferences {
+	out := &Preferences{QuietHours: p.QuietHours, Digest: p.Digest}
+	for _, channel := range Channels {
+		set := false
+		for _, pref := range p.Channels {
+			if pref.Channel == channel && pref.Type == AllTypes {
+				set = true
+			}
+		}
+		if !set {
+			out.Channels = append(out.Channels, ChannelPreference{Type: AllTypes, Channel: channel, Enabled: channel.defaultEnabled()})
+		}
+	}
+	out.Channels = append(out.Channels, p.Channels...)
+	return out
+}
+
+// planned is a channel a notification goes out on; a non-zero notBefore
+// holds it until quiet hours end
+type planned struct {
+	channel   Channel
+	notBefore time.Time
+}
+
+// plan lists the delivery channels for a notification type at now. The
+// inbox is not a delivery channel; it is always written.
+func (p *Preferences) plan(notificationType string, now time.Time) []planned {
+	quietUntil, quiet := p.QuietHours.until(now)
+
+	var out []planned
+	for _, channel := range Channels {
+		if channel == ChannelInApp || !p.Enabled(notificationType, channel) {
+			continue
+		}
+		next := planned{channel: channel}
+		if quiet && channel.Interrupts() {
+			next.notBefore = quietUntil
+		}
+		out = append(out, next)
+	}
+	return out
+}
+
+// holds reports whether a notification waits for the digest instead of
+// going out on channel now. Only normal-priority notifications on
+// interrupting channels are batched.
+func (p *Preferences) holds(priority Priority, channel Channel) bool {
+	return p.Digest != nil && priority != PriorityHigh && channel.Interrupts()
+}
+
+// next is when the digest after now goes out. A digest falling in quiet
+// hours waits until they end.
+func (g *Digest) next(now time.Time, quiet *QuietHours) time.Time {
+	loc, err := time.LoadLocation(g.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	local := now.In(loc)
+
+	var next time.Time
+	if g.Frequency == DigestHourly {
+		next = time.Date(local.Year(), local.Month(), local.Day(), local.Hour()+1, 0, 0, 0, loc)
+	} else {
+		at := g.At
+		if at == "" {
+			at = defaultDigestAt
+		}
+		minute, err := parseClock(at)
+		if err != nil {
+			minute, _ = parseClock(defaultDigestAt)
+		}
+		next = time.Date(local.Year(), local.Month(), local.Day(), minute/60, minute%60, 0, 0, loc)
+		if !next.After(local) {
+			next = next.AddDate(0, 0, 1)
+		}
+	}
+
+	if until, ok := quiet.until(next); ok {
+		next = until
+	}
+	return next
+}
+
+// until reports whether now falls in quiet hours and, if so, when they end
+func (q *QuietHours) until(now time.Time) (time.Time, bool) {
+	if q == nil {
+		return time.Time{}, false
+	}
+	start, err := parseClock(q.Start)
+	if err != nil {
+		return time.Time{}, false
+	}
+	end, err := parseClock(q.End)
+	if err != nil || start == end {
+		return time.Time{}, false
+	}
+	loc, err := time.LoadLocation(q.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+
+	local := now.In(loc)
+	minute := local.Hour()*60 + local.Minute()
+	var inside bool
+	if start < end {
+		inside = minute >= start && minute < end
+	} else {
+		inside = minute >= start || minute < end
+	}
+	if !inside {
+		return time.Time{}, false
+	}
+
+	ends := time.Date(local.Year(), local.Month(), local.Day(), end/60, end%60, 0, 0, loc)
+	if !ends.After(local) {
+		ends = ends.AddDate(0, 0, 1)
+	}
+	return ends, true
+}
+
+// parseClock parses "HH:MM" into minutes after midnight
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not HH:MM", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
@@ -0,0 +1,176 @@
+package notifications
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPreferencesEnabled(t *testing.T) {
+	var none Preferences
+	assert.True(t, none.Enabled("market", ChannelEmail))
+	assert.False(t, none.Enabled("market", ChannelSMS), "SMS is opt-in")
+
+	prefs := Preferences{Channels: []ChannelPreference{
+		{Type: "pest", Channel: ChannelSMS, Enabled: true},
+		{Type: AllTypes, Channel: ChannelEmail, Enabled: false},
+		{Type: "price", Channel: ChannelEmail, Enabled: true},
+	}}
+	assert.True(t, prefs.Enabled("pest", ChannelSMS))
+	assert.False(t, prefs.Enabled("market", ChannelSMS))
+	assert.False(t, prefs.Enabled("market", ChannelEmail))
+	assert.True(t, prefs.Enabled("price", ChannelEmail), "a type preference wins over *")
+	assert.True(t, prefs.Enabled("market", ChannelPush))
+}
+
+func TestPreferencesValidate(t *testing.T) {
+	valid := Preferences{
+		Channels:   []ChannelPreference{{Type: AllTypes, Channel: ChannelSMS, Enabled: true}},
+		QuietHours: &QuietHours{Start: "22:00", End: "07:00"},
+	}
+	require.NoError(t, valid.Validate())
+	assert.Equal(t, "UTC", valid.QuietHours.Timezone)
+
+	invalid := []Preferences{
+		{Channels: []ChannelPreference{{Type: AllTypes, Channel: "fax"}}},
+		{Channels: []ChannelPreference{{Type: "gossip", Channel: ChannelEmail}}},
+		{Channels: []ChannelPreference{{Type: "pest", Channel: ChannelEmail}, {Type: "pest", Channel: ChannelEmail, Enabled: true}}},
+		{QuietHours: &QuietHours{Start: "25:00", End: "07:00"}},
+		{QuietHours: &QuietHours{Start: "22:00", End: "07:00", Timezone: "Mars/Olympus"}},
+	}
+	for _, prefs := range invalid {
+		assert.ErrorIs(t, prefs.Validate(), ErrInvalidPreferences)
+	}
+}
+
+func TestQuietHoursUntil(t *testing.T) {
+	nairobi, err := time.LoadLocation("Africa/Nairobi")
+	require.NoError(t, err)
+	overnight := &QuietHours{Start: "22:00", End: "07:00", Timezone: "Africa/Nairobi"}
+
+	// 23:30 in Nairobi is quiet until 07:00 the next morning
+	until, quiet := overnight.until(time.Date(2026, 10, 18, 23, 30, 0, 0, nairobi))
+	assert.True(t, quiet)
+	assert.Equal(t, time.Date(2026, 10, 19, 7, 0, 0, 0, nairobi), until)
+
+	// 05:00 is quiet until 07:00 the same day
+	until, quiet = overnight.until(time.Date(2026, 10, 19, 5, 0, 0, 0, nairobi))
+	assert.True(t, quiet)
+	assert.Equal(t, time.Date(2026, 10, 19, 7, 0, 0, 0, nairobi), until)
+
+	// 12:00 Nairobi is 09:00 UTC; the window is in the user's timezone
+	_, quiet = overnight.until(time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC))
+	assert.False(t, quiet)
+
+	daytime := &QuietHours{Start: "13:00", End: "14:00", Timezone: "UTC"}
+	_, quiet = daytime.until(time.Date(2026, 10, 19, 14, 0, 0, 0, time.UTC))
+	assert.False(t, quiet, "the end is exclusive")
+
+	var off *QuietHours
+	_, quiet = off.until(time.Now())
+	assert.False(t, quiet)
+}
+
+func TestPlan(t *testing.T) {
+	prefs := Preferences{
+		Channels:   []ChannelPreference{{Type: "market", Channel: ChannelEmail, Enabled: false}},
+		QuietHours: &QuietHours{Start: "22:00", End: "07:00", Timezone: "UTC"},
+	}
+
+	daytime := prefs.plan("market", time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC))
+	assert.Equal(t, []planned{{channel: ChannelWebSocket}, {channel: ChannelPush}}, daytime)
+
+	// Live connections are not interrupting, so they go out in quiet hours
+	night := prefs.plan("pest", time.Date(2026, 10, 18, 23, 0, 0, 0, time.UTC))
+	morning := time.Date(2026, 10, 19, 7, 0, 0, 0, time.UTC)
+	assert.Equal(t, []planned{
+		{channel: ChannelWebSocket},
+		{channel: ChannelEmail, notBefore: morning},
+		{channel: ChannelPush, notBefore: morning},
+	}, night)
+}
+
+func TestWithDefaults(t *testing.T) {
+	prefs := (&Preferences{Channels: []ChannelPreference{
+		{Type: AllTypes, Channel: ChannelEmail, Enabled: false},
+		{Type: "pest", Channel: ChannelSMS, Enabled: true},
+	}}).WithDefaults()
+
+	assert.Equal(t, []ChannelPreference{
+		{Type: AllTypes, Channel: ChannelInApp, Enabled: true},
+		{Type: AllTypes, Channel: ChannelWebSocket, Enabled: true},
+		{Type: AllTypes, Channel: ChannelSMS, Enabled: false},
+		{Type: AllTypes, Channel: ChannelPush, Enabled: true},
+		{Type: AllTypes, Channel: ChannelEmail, Enabled: false},
+		{Type: "pest", Channel: ChannelSMS, Enabled: true},
+	}, prefs.Channels)
+}
+
+func TestDigestValidate(t *testing.T) {
+	daily := Preferences{Digest: &Digest{Frequency: DigestDaily, Channel: ChannelEmail}}
+	require.NoError(t, daily.Validate())
+	assert.Equal(t, "08:00", daily.Digest.At)
+	assert.Equal(t, "UTC", daily.Digest.Timezone)
+
+	hourly := Preferences{
+		QuietHours: &QuietHours{Start: "22:00", End: "07:00", Timezone: "Africa/Nairobi"},
+		Digest:     &Digest{Frequency: DigestHourly, Channel: ChannelSMS, Timezone: "Africa/Nairobi"},
+	}
+	require.NoError(t, hourly.Validate())
+
+	invalid := []Preferences{
+		{Digest: &Digest{Frequency: "weekly", Channel: ChannelEmail}},
+		{Digest: &Digest{Frequency: DigestDaily, Channel: ChannelWebSocket}},
+		{Digest: &Digest{Frequency: DigestDaily, Channel: ChannelEmail, At: "8am"}},
+		{Digest: &Digest{Frequency: DigestDaily, Channel: ChannelEmail, Timezone: "Mars/Olympus"}},
+		{
+			QuietHours: &QuietHours{Start: "22:00", End: "07:00", Timezone: "Africa/Lagos"},
+			Digest:     &Digest{Frequency: DigestDaily, Channel: ChannelEmail, Timezone: "Africa/Nairobi"},
+		},
+	}
+	for _, prefs := range invalid {
+		assert.ErrorIs(t, prefs.Validate(), ErrInvalidPreferences)
+	}
+}
+
+func TestDigestHolds(t *testing.T) {
+	var none Preferences
+	assert.False(t, none.holds(PriorityNormal, ChannelEmail))
+
+	prefs := Preferences{Digest: &Digest{Frequency: DigestHourly, Channel: ChannelEmail}}
+	assert.True(t, prefs.holds(PriorityNormal, ChannelEmail))
+	assert.True(t, prefs.holds(PriorityNormal, ChannelPush))
+	assert.False(t, prefs.holds(PriorityNormal, ChannelWebSocket), "the open app still updates live")
+	assert.False(t, prefs.holds(PriorityHigh, ChannelEmail), "urgent notifications skip the digest")
+}
+
+func TestDigestNext(t *testing.T) {
+	nairobi, err := time.LoadLocation("Africa/Nairobi")
+	require.NoError(t, err)
+	kolkata, err := time.LoadLocation("Asia/Kolkata")
+	require.NoError(t, err)
+
+	hourly := &Digest{Frequency: DigestHourly, Channel: ChannelEmail, Timezone: "Africa/Nairobi"}
+	assert.Equal(t, time.Date(2026, 10, 18, 15, 0, 0, 0, nairobi),
+		hourly.next(time.Date(2026, 10, 18, 14, 20, 0, 0, nairobi), nil))
+	assert.Equal(t, time.Date(2026, 10, 19, 0, 0, 0, 0, nairobi),
+		hourly.next(time.Date(2026, 10, 18, 23, 0, 0, 0, nairobi), nil))
+
+	// On the hour locally, even with a half-hour offset
+	india := &Digest{Frequency: DigestHourly, Channel: ChannelEmail, Timezone: "Asia/Kolkata"}
+	assert.Equal(t, time.Date(2026, 10, 18, 15, 0, 0, 0, kolkata),
+		india.next(time.Date(2026, 10, 18, 14, 20, 0, 0, kolkata), nil))
+
+	daily := &Digest{Frequency: DigestDaily, Channel: ChannelEmail, At: "18:00", Timezone: "Africa/Nairobi"}
+	assert.Equal(t, time.Date(2026, 10, 18, 18, 0, 0, 0, nairobi),
+		daily.next(time.Date(2026, 10, 18, 9, 0, 0, 0, nairobi), nil))
+	assert.Equal(t, time.Date(2026, 10, 19, 18, 0, 0, 0, nairobi),
+		daily.next(time.Date(2026, 10, 18, 18, 0, 0, 0, nairobi), nil))
+
+	// A digest due in quiet hours waits for them to end
+	quiet := &QuietHours{Start: "22:00", End: "07:00", Timezone: "Africa/Nairobi"}
+	assert.Equal(t, time.Date(2026, 10, 19, 7, 0, 0, 0, nairobi),
+		hourly.next(time.Date(2026, 10, 18, 22, 10, 0, 0, nairobi), quiet))
+}
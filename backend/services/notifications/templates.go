@@ -0,0 +1,267 @@
+package notifications
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	texttemplate "text/template"
+
+	"github.com/google/uuid"
+)
+
+// DefaultLanguage is used for users without a preferred language and for
+// templates missing a translation
+const DefaultLanguage = "en"
+
+// Template errors
+var (
+	ErrTemplateNotFound    = errors.New("notification template not found")
+	ErrUnsupportedLanguage = errors.New("unsupported language")
+)
+
+// builtinTemplates holds one catalog per language, e.g. templates/sw.json,
+// mapping template names to their TemplateSource
+//
+//go:embed templates/*.json
+var builtinTemplates embed.FS
+
+// TemplateSource is a notification template in one language. Fields are
+// text/template strings over the notification's variables, e.g.
+// "Your order {{.order_number}} has been shipped".
+type TemplateSource struct {
+	Title string `json:"title"`
+	Body  string `json:"body"`
+	// SMS is a short variant for text messages; Body is used without one
+	SMS string `json:"sms,omitempty"`
+	// Email is an HTML variant for email; variables are escaped
+	Email string `json:"email,omitempty"`
+}
+
+// Rendered is a template rendered for one channel
+type Rendered struct {
+	Title string
+	Body  string
+	// HTML is the email variant, when rendering for email
+	HTML string
+}
+
+// LanguageFunc looks up a user's preferred language
+type LanguageFunc func(ctx context.Context, userID uuid.UUID) (string, error)
+
+type compiledTemplate struct {
+	title *texttemplate.Template
+	body  *texttemplate.Template
+	sms   *texttemplate.Template
+	email *htmltemplate.Template
+}
+
+// Templates is a registry of notification templates by name and language
+type Templates struct {
+	mu        sync.RWMutex
+	templates map[string]map[string]*compiledTemplate
+}
+
+// NewTemplates creates an empty registry
+func NewTemplates() *Templates {
+	return &Templates{templates: make(map[string]map[string]*compiledTemplate)}
+}
+
+// DefaultTemplates creates a registry with the built-in catalogs
+func DefaultTemplates() *Templates {
+	t := NewTemplates()
+	files, err := builtinTemplates.ReadDir("templates")
+	if err != nil {
+		panic(err)
+	}
+	for _, file := range files {
+		data, err := builtinTemplates.ReadFile(path.Join("templates", file.Name()))
+		if err != nil {
+			panic(err)
+		}
+		if err := t.Load(strings.TrimSuffix(file.Name(), ".json"), data); err != nil {
+			panic(fmt.Sprintf("notifications: built-in templates %s: %v", file.Name(), err))
+		}
+	}
+	return t
+}
+
+// Load registers a JSON catalog of templates for a language
+func (t *Templates) Load(language string, data []byte) error {
+	var catalog map[string]TemplateSource
+	if err := json.Unmarshal(data, &catalog); err != nil {
+		return fmt.Errorf("failed to decode templates: %w", err)
+	}
+	for name, src := range catalog {
+		if err := t.Register(name, language, src); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Register adds or replaces the template for a name and language
+func (t *Templates) Register(name, language string, src TemplateSource) error {
+	language = normalizeLanguage(language)
+	if name == "" || language == "" {
+		return errors.New("template name and language are required")
+	}
+	if src.Title == "" || src.Body == "" {
+		return fmt.Errorf("template %s/%s needs a title and body", name, language)
+	}
+
+	var compiled compiledTemplate
+	var err error
+	id := name + "/" + language
+	if compiled.title, err = parseText(id+"/title", src.Title); err != nil {
+		return err
+	}
+	if compiled.body, err = parseText(id+"/body", src.Body); err != nil {
+		return err
+	}
+	if src.SMS != "" {
+		if compiled.sms, err = parseText(id+"/sms", src.SMS); err != nil {
+			return err
+		}
+	}
+	if src.Email != "" {
+		if compiled.email, err = htmltemplate.New(id + "/email").Option("missingkey=error").Parse(src.Email); err != nil {
+			return fmt.Errorf("failed to parse template %s/email: %w", id, err)
+		}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.templates[name] == nil {
+		t.templates[name] = make(map[string]*compiledTemplate)
+	}
+	t.templates[name][language] = &compiled
+	return nil
+}
+
+func parseText(name, text string) (*texttemplate.Template, error) {
+	tmpl, err := texttemplate.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template %s: %w", name, err)
+	}
+	return tmpl, nil
+}
+
+// Has reports whether a template is registered under name
+func (t *Templates) Has(name string) bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	_, ok := t.templates[name]
+	return ok
+}
+
+// Languages lists every language with at least one template
+func (t *Templates) Languages() []string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	seen := make(map[string]bool)
+	for _, byLanguage := range t.templates {
+		for language := range byLanguage {
+			seen[language] = true
+		}
+	}
+	languages := make([]string, 0, len(seen))
+	for language := range seen {
+		languages = append(languages, language)
+	}
+	sort.Strings(languages)
+	return languages
+}
+
+// Supports reports whether language has templates
+func (t *Templates) Supports(language string) bool {
+	language = normalizeLanguage(language)
+	for _, l := range t.Languages() {
+		if l == language {
+			return true
+		}
+	}
+	return false
+}
+
+// Render renders a template for a channel in the user's language. Regional
+// languages such as "sw-KE" use "sw"; a template without a translation, or
+// whose translation fails to render, falls back to DefaultLanguage.
+func (t *Templates) Render(name, language string, channel Channel, data map[string]interface{}) (*Rendered, error) {
+	t.mu.RLock()
+	byLanguage, ok := t.templates[name]
+	t.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrTemplateNotFound, name)
+	}
+	if data == nil {
+		data = map[string]interface{}{}
+	}
+
+	var err error
+	for _, l := range []string{normalizeLanguage(language), DefaultLanguage} {
+		compiled, ok := byLanguage[l]
+		if !ok {
+			continue
+		}
+		var rendered *Rendered
+		if rendered, err = compiled.render(channel, data); err == nil {
+			return rendered, nil
+		}
+	}
+	if err == nil {
+		err = fmt.Errorf("%w: %s has no %s translation", ErrTemplateNotFound, name, DefaultLanguage)
+	}
+	return nil, err
+}
+
+func (c *compiledTemplate) render(channel Channel, data map[string]interface{}) (*Rendered, error) {
+	var rendered Rendered
+	var err error
+	if rendered.Title, err = execute(c.title, data); err != nil {
+		return nil, err
+	}
+
+	body := c.body
+	if channel == ChannelSMS && c.sms != nil {
+		body = c.sms
+	}
+	if rendered.Body, err = execute(body, data); err != nil {
+		return nil, err
+	}
+
+	if channel == ChannelEmail && c.email != nil {
+		var buf bytes.Buffer
+		if err := c.email.Execute(&buf, data); err != nil {
+			return nil, fmt.Errorf("failed to render template: %w", err)
+		}
+		rendered.HTML = buf.String()
+	}
+	return &rendered, nil
+}
+
+func execute(tmpl *texttemplate.Template, data map[string]interface{}) (string, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render template: %w", err)
+	}
+	return buf.String(), nil
+}
+
+// normalizeLanguage reduces a language tag to its lowercase primary
+// language, e.g. "sw-KE" and "sw_ke" to "sw"
+func normalizeLanguage(language string) string {
+	language = strings.ToLower(strings.TrimSpace(language))
+	if i := strings.IndexAny(language, "-_"); i >= 0 {
+		language = language[:i]
+	}
+	return language
+}
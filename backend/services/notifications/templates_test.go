@@ -0,0 +1,235 @@
+package notifications
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Andrew-mugwe/agroai/models"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func templateData() map[string]interface{} {
+	return map[string]interface{}{
+		"order_id":       uuid.New().String(),
+		"order_number":   "ORD-1001",
+		"status":         "shipped",
+		"total_amount":   "1200",
+		"amount":         "1200",
+		"currency":       "KES",
+		"transaction_id": "TX-1",
+		"provider":       "mpesa",
+		"reason":         "undelivered",
+		"count":          2,
+		"frequency":      "daily",
+		"more":           0,
+		"items": []map[string]interface{}{
+			{"title": "Order Shipped", "message": "Your order ORD-1001 has been shipped"},
+			{"title": "Price drop", "message": "Maize seed is now KES 900"},
+		},
+	}
+}
+
+func TestDefaultTemplatesAreComplete(t *testing.T) {
+	templates := DefaultTemplates()
+	assert.Equal(t, []string{"en", "fr", "sw"}, templates.Languages())
+
+	// Every language translates every template, and each renders on every
+	// channel with the variables its callers pass
+	names := make([]string, 0, len(templates.templates))
+	for name := range templates.templates {
+		names = append(names, name)
+	}
+	require.NotEmpty(t, names)
+	for _, name := range names {
+		for _, language := range templates.Languages() {
+			_, ok := templates.templates[name][language]
+			assert.True(t, ok, "%s has no %s translation", name, language)
+
+			for _, channel := range Channels {
+				rendered, err := templates.Render(name, language, channel, templateData())
+				require.NoError(t, err, "%s/%s/%s", name, language, channel)
+				assert.NotEmpty(t, rendered.Title)
+				assert.NotEmpty(t, rendered.Body)
+				assert.NotContains(t, rendered.Body, "<no value>")
+			}
+		}
+	}
+}
+
+func TestRenderChannelVariants(t *testing.T) {
+	templates := DefaultTemplates()
+
+	inApp, err := templates.Render("order_shipped", "en", ChannelInApp, templateData())
+	require.NoError(t, err)
+	assert.Equal(t, "Order Shipped", inApp.Title)
+	assert.Equal(t, "Your order ORD-1001 has been shipped", inApp.Body)
+	assert.Empty(t, inApp.HTML)
+
+	text, err := templates.Render("order_shipped", "en", ChannelSMS, templateData())
+	require.NoError(t, err)
+	assert.Contains(t, text.Body, "USSD")
+
+	email, err := templates.Render("order_shipped", "en", ChannelEmail, templateData())
+	require.NoError(t, err)
+	assert.Equal(t, inApp.Body, email.Body)
+	assert.Contains(t, email.HTML, "<strong>ORD-1001</strong>")
+}
+
+func TestRenderLanguageFallback(t *testing.T) {
+	templates := DefaultTemplates()
+	require.NoError(t, templates.Register("harvest_tip", "en", TemplateSource{Title: "Tip", Body: "Harvest {{.crop}} early"}))
+
+	for language, want := range map[string]string{
+		"sw":    "Oda Imetumwa",
+		"sw-KE": "Oda Imetumwa",
+		"FR_fr": "Commande expédiée",
+		"de":    "Order Shipped",
+		"":      "Order Shipped",
+	} {
+		rendered, err := templates.Render("order_shipped", language, ChannelInApp, templateData())
+		require.NoError(t, err)
+		assert.Equal(t, want, rendered.Title, language)
+	}
+
+	rendered, err := templates.Render("harvest_tip", "sw", ChannelInApp, map[string]interface{}{"crop": "maize"})
+	require.NoError(t, err)
+	assert.Equal(t, "Harvest maize early", rendered.Body, "untranslated templates use English")
+}
+
+func TestRenderErrors(t *testing.T) {
+	templates := DefaultTemplates()
+
+	_, err := templates.Render("no_such_template", "en", ChannelInApp, nil)
+	assert.ErrorIs(t, err, ErrTemplateNotFound)
+
+	_, err = templates.Render("order_shipped", "en", ChannelInApp, map[string]interface{}{})
+	assert.Error(t, err, "missing variables fail rather than render blanks")
+
+	// The optional order number may be left out
+	data := templateData()
+	delete(data, "order_number")
+	rendered, err := templates.Render("payment_failed", "en", ChannelInApp, data)
+	require.NoError(t, err)
+	assert.Equal(t, "Payment of 1200 KES failed", rendered.Body)
+}
+
+func TestRenderEscapesEmail(t *testing.T) {
+	templates := NewTemplates()
+	require.NoError(t, templates.Register("note", "en", TemplateSource{
+		Title: "Note",
+		Body:  "{{.text}}",
+		Email: "<p>{{.text}}</p>",
+	}))
+
+	rendered, err := templates.Render("note", "en", ChannelEmail, map[string]interface{}{"text": "<script>x</script>"})
+	require.NoError(t, err)
+	assert.Equal(t, "<script>x</script>", rendered.Body)
+	assert.Equal(t, "<p>&lt;script&gt;x&lt;/script&gt;</p>", rendered.HTML)
+}
+
+func TestRegisterValidates(t *testing.T) {
+	templates := NewTemplates()
+	assert.Error(t, templates.Register("", "en", TemplateSource{Title: "t", Body: "b"}))
+	assert.Error(t, templates.Register("note", "en", TemplateSource{Title: "t"}))
+	assert.Error(t, templates.Register("note", "en", TemplateSource{Title: "t", Body: "{{.unclosed"}))
+	assert.Error(t, templates.Load("en", []byte(`not json`)))
+
+	require.NoError(t, templates.Load("rw", []byte(`{"note": {"title": "Icyitonderwa", "body": "{{.text}}"}}`)))
+	assert.True(t, templates.Has("note"))
+	assert.True(t, templates.Supports("rw-RW"))
+	assert.False(t, templates.Supports("sw"))
+}
+
+func TestLocalizeForChannel(t *testing.T) {
+	d := &Dispatcher{templates: DefaultTemplates()}
+	n := testNotification()
+	n.Metadata = templateData()
+	n.Metadata["template"] = "order_shipped"
+	n.Message = "Your order ORD-1001 has been shipped"
+
+	email := d.localize(n, &Recipient{Language: "fr"}, ChannelEmail)
+	assert.Equal(t, "Votre commande ORD-1001 a été expédiée", email.Message)
+	assert.Equal(t, "Commande expédiée", email.Metadata["title"])
+	assert.Contains(t, email.Metadata["html"], "<strong>ORD-1001</strong>")
+	assert.NotContains(t, n.Metadata, "html", "the stored notification is left alone")
+
+	text := d.localize(n, &Recipient{Language: "sw"}, ChannelSMS)
+	assert.Contains(t, text.Message, "AgroAI: oda ORD-1001 imetumwa")
+
+	plain := testNotification()
+	assert.Same(t, plain, d.localize(plain, &Recipient{Language: "sw"}, ChannelSMS))
+}
+
+func TestOrderNotificationInUserLanguage(t *testing.T) {
+	svc, dial := testHub(t)
+	userID := uuid.New()
+	svc.SetLanguages(func(ctx context.Context, id uuid.UUID) (string, error) {
+		if id == userID {
+			return "sw", nil
+		}
+		return "", errors.New("unknown user")
+	})
+	conn := dial(userID.String())
+	waitForClients(t, svc, 1)
+
+	order := &models.Order{
+		ID:          uuid.New(),
+		OrderNumber: "ORD-1001",
+		Status:      models.OrderStatusDelivered,
+		TotalAmount: decimal.NewFromInt(1200),
+		Currency:    "KES",
+	}
+	svc.SendOrderNotification(userID.String(), order, "order_delivered")
+	msg := readMessage(t, conn)
+	assert.Equal(t, "order_delivered", msg.Type)
+	assert.Equal(t, "Oda Imefika", msg.Title)
+	assert.Equal(t, "Oda yako "+order.OrderNumber+" imefika", msg.Message)
+	assert.Equal(t, order.OrderNumber, msg.Data["order_number"])
+
+	// Unknown types fall back to the generic update
+	svc.SendOrderNotification(userID.String(), order, "order_packed")
+	msg = readMessage(t, conn)
+	assert.Equal(t, "order_packed", msg.Type)
+	assert.Equal(t, "Taarifa ya Oda", msg.Title)
+}
+
+func TestRenderDigest(t *testing.T) {
+	d := &Dispatcher{templates: DefaultTemplates(), now: time.Now}
+	items := make([]Notification, 12)
+	for i := range items {
+		items[i] = Notification{Type: "market", Message: fmt.Sprintf("Offer %d", i+1), Metadata: map[string]interface{}{"title": "New offer"}}
+	}
+	to := &Recipient{UserID: uuid.New(), Language: "en"}
+
+	email, err := d.renderDigest(&Digest{Frequency: DigestDaily, Channel: ChannelEmail}, to, uuid.New(), items)
+	require.NoError(t, err)
+	assert.Equal(t, "Your AgroAI digest", email.Metadata["title"])
+	assert.Contains(t, email.Message, "You have 12 new notifications:\n- New offer: Offer 1\n")
+	assert.Contains(t, email.Message, "- New offer: Offer 10\nAnd 2 more in the app.")
+	assert.NotContains(t, email.Message, "Offer 11")
+	assert.Contains(t, email.Metadata["html"], "<li><strong>New offer</strong>: Offer 1</li>")
+
+	to.Language = "sw"
+	text, err := d.renderDigest(&Digest{Frequency: DigestHourly, Channel: ChannelSMS}, to, uuid.New(), items[:3])
+	require.NoError(t, err)
+	assert.Equal(t, "AgroAI: una taarifa 3 mpya. Fungua programu kuzisoma.", text.Message)
+}
+
+func TestRequestPriority(t *testing.T) {
+	assert.Equal(t, PriorityNormal, (&NotificationRequest{}).priority())
+	assert.Equal(t, PriorityHigh, (&NotificationRequest{Template: "dispute_opened"}).priority())
+	assert.Equal(t, PriorityHigh, (&NotificationRequest{Metadata: map[string]interface{}{"event": "payment_failed"}}).priority())
+	assert.Equal(t, PriorityNormal, (&NotificationRequest{Template: "payment_failed", Priority: PriorityNormal}).priority(),
+		"an explicit priority wins")
+
+	_, err := NewDatabaseNotificationService(nil).SendNotification(NotificationRequest{
+		UserID: uuid.New(), Role: "farmer", Type: "market", Message: "hi", Priority: "urgent",
+	})
+	assert.ErrorIs(t, err, ErrInvalidNotification)
+}
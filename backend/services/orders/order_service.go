@@ -3,18 +3,30 @@ package orders
 import (
 	"context"
 	"fmt"
+	"log"
 	"time"
 
 	"github.com/Andrew-mugwe/agroai/models"
+	"github.com/Andrew-mugwe/agroai/pagination"
 	"github.com/Andrew-mugwe/agroai/repository"
+	"github.com/Andrew-mugwe/agroai/services/reputation"
 	"github.com/google/uuid"
 	"github.com/shopspring/decimal"
 )
 
+// Inventory holds stock for placed orders and settles it when they are
+// delivered or cancelled
+type Inventory interface {
+	ReserveOrder(ctx context.Context, order *models.Order) error
+	SettleOrder(ctx context.Context, orderID uuid.UUID, reason models.StockReason, actorID *uuid.UUID) error
+}
+
 // OrderService handles order business logic
 type OrderService struct {
 	orderRepo   *repository.OrderRepository
 	productRepo repository.ProductRepository
+	reputation  reputation.Notifier
+	inventory   Inventory
 }
 
 // NewOrderService creates a new order service
@@ -25,38 +37,48 @@ func NewOrderService(orderRepo *repository.OrderRepository, productRepo reposito
 	}
 }
 
+// SetReputationNotifier registers the receiver for order reputation events
+func (s *OrderService) SetReputationNotifier(notifier reputation.Notifier) {
+	s.reputation = notifier
+}
+
+// SetInventory registers the inventory that reserves order stock
+func (s *OrderService) SetInventory(inventory Inventory) {
+	s.inventory = inventory
+}
+
 // CreateOrder creates a new order from cart items
 func (s *OrderService) CreateOrder(ctx context.Context, userID uuid.UUID, req *models.CreateOrderRequest) (*models.Order, error) {
-	// Validate request
-	if len(req.Items) == 0 {
-		return nil, fmt.Errorf("order must contain at least one item")
-	}
+	return s.createOrder(ctx, userID, req, nil)
+}
 
-	// Get first product to determine seller (assuming all items are from same seller for simplicity)
-	productID, err := uuid.Parse(req.Items[0].ProductID)
-	if err != nil {
-		return nil, fmt.Errorf("invalid product ID: %w", err)
+// CreateOrderAtPrice creates an order for a single item at a unit price
+// agreed with the seller, such as an accepted offer, instead of the
+// catalogue price. The price must be in the product's currency.
+func (s *OrderService) CreateOrderAtPrice(ctx context.Context, userID uuid.UUID, req *models.CreateOrderRequest, unitPrice decimal.Decimal, currency string) (*models.Order, error) {
+	if len(req.Items) != 1 {
+		return nil, fmt.Errorf("an order at an agreed price must contain exactly one item")
 	}
-
-	firstProduct, err := s.productRepo.GetByID(ctx, productID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get product: %w", err)
+	if !unitPrice.IsPositive() {
+		return nil, fmt.Errorf("agreed unit price must be positive")
 	}
+	return s.createOrder(ctx, userID, req, &agreedPrice{unitPrice: unitPrice, currency: currency})
+}
+
+// agreedPrice overrides the catalogue price of an order's item
+type agreedPrice struct {
+	unitPrice decimal.Decimal
+	currency  string
+}
 
-	// Create order
-	order := &models.Order{
-		UserID:          userID,
-		SellerID:        firstProduct.TraderID, // Use TraderID as SellerID
-		Status:          models.OrderStatusPending,
-		Currency:        "KES",
-		PaymentStatus:   models.PaymentStatusPending,
-		PaymentMethod:   req.PaymentMethod,
-		ShippingAddress: req.ShippingAddress,
-		BillingAddress:  req.BillingAddress,
-		Notes:           req.Notes,
+func (s *OrderService) createOrder(ctx context.Context, userID uuid.UUID, req *models.CreateOrderRequest, agreed *agreedPrice) (*models.Order, error) {
+	// Validate request
+	if len(req.Items) == 0 {
+		return nil, fmt.Errorf("order must contain at least one item")
 	}
 
-	// Calculate totals
+	// Price every item from the catalogue; an order is placed with a single seller
+	var order *models.Order
 	var subtotal decimal.Decimal
 	var items []models.OrderItem
 
@@ -72,20 +94,59 @@ func (s *OrderService) CreateOrder(ctx context.Context, userID uuid.UUID, req *m
 			return nil, fmt.Errorf("failed to get product %s: %w", itemReq.ProductID, err)
 		}
 
+		if !product.IsActive {
+			return nil, fmt.Errorf("product %s is no longer available", product.Title)
+		}
+		if itemReq.Quantity <= 0 {
+			return nil, fmt.Errorf("quantity for product %s must be positive", product.Title)
+		}
+
+		if order == nil {
+			order = &models.Order{
+				UserID:          userID,
+				SellerID:        product.SellerID,
+				Status:          models.OrderStatusPending,
+				Currency:        product.Currency,
+				PaymentStatus:   models.PaymentStatusPending,
+				PaymentMethod:   req.PaymentMethod,
+				ShippingAddress: req.ShippingAddress,
+				BillingAddress:  req.BillingAddress,
+				Notes:           req.Notes,
+			}
+		}
+		if product.SellerID != order.SellerID {
+			return nil, fmt.Errorf("all items in an order must come from the same seller")
+		}
+		if product.Currency != order.Currency {
+			return nil, fmt.Errorf("all items in an order must be priced in the same currency")
+		}
+
+		variant, err := orderVariant(product, itemReq.VariantID)
+		if err != nil {
+			return nil, err
+		}
+
 		// Check stock availability
-		if product.Stock < itemReq.Quantity {
-			return nil, fmt.Errorf("insufficient stock for product %s", product.Name)
+		if variant.Stock < itemReq.Quantity {
+			return nil, fmt.Errorf("insufficient stock for %s %s", product.Title, variant.Label())
 		}
 
 		// Calculate item total
-		unitPrice := decimal.NewFromFloat(product.Price)
+		unitPrice := variant.Price()
+		if agreed != nil {
+			if agreed.currency != product.Currency {
+				return nil, fmt.Errorf("agreed price is in %s but %s is priced in %s", agreed.currency, product.Title, product.Currency)
+			}
+			unitPrice = agreed.unitPrice
+		}
 		itemTotal := unitPrice.Mul(decimal.NewFromInt(int64(itemReq.Quantity)))
 
 		// Create order item
 		orderItem := models.OrderItem{
 			ProductID:   product.ID.String(),
-			ProductName: product.Name,
-			ProductSKU:  fmt.Sprintf("SKU-%s", product.ID.String()[:8]), // Generate SKU from ID
+			VariantID:   &variant.ID,
+			ProductName: product.Title + " " + variant.Label(),
+			ProductSKU:  variant.SKU,
 			Quantity:    itemReq.Quantity,
 			UnitPrice:   unitPrice,
 			TotalPrice:  itemTotal,
@@ -126,6 +187,16 @@ func (s *OrderService) CreateOrder(ctx context.Context, userID uuid.UUID, req *m
 
 	order.Items = items
 
+	// Hold the stock; an order that cannot be filled is cancelled straight away
+	if s.inventory != nil {
+		if err := s.inventory.ReserveOrder(ctx, order); err != nil {
+			if cancelErr := s.orderRepo.UpdateOrderStatus(ctx, order.ID, models.OrderStatusCancelled, "Insufficient stock", &userID); cancelErr != nil {
+				log.Printf("orders: failed to cancel unfilled order %s: %v", order.ID, cancelErr)
+			}
+			return nil, fmt.Errorf("failed to reserve stock: %w", err)
+		}
+	}
+
 	// Add initial status history
 	if err := s.orderRepo.UpdateOrderStatus(ctx, order.ID, models.OrderStatusPending, "Order created", &userID); err != nil {
 		return nil, fmt.Errorf("failed to add status history: %w", err)
@@ -139,16 +210,14 @@ func (s *OrderService) GetOrder(ctx context.Context, orderID uuid.UUID) (*models
 	return s.orderRepo.GetOrderByID(ctx, orderID)
 }
 
-// GetUserOrders retrieves orders for a specific user
-func (s *OrderService) GetUserOrders(ctx context.Context, userID uuid.UUID, page, limit int) ([]models.Order, error) {
-	offset := (page - 1) * limit
-	return s.orderRepo.GetOrdersByUserID(ctx, userID, limit, offset)
+// GetUserOrders retrieves a page of orders for a specific user
+func (s *OrderService) GetUserOrders(ctx context.Context, userID uuid.UUID, page pagination.Params) (pagination.Page[models.Order], error) {
+	return s.orderRepo.GetOrdersByUserID(ctx, userID, page.Normalize())
 }
 
-// GetSellerOrders retrieves orders for a specific seller
-func (s *OrderService) GetSellerOrders(ctx context.Context, sellerID uuid.UUID, page, limit int) ([]models.Order, error) {
-	offset := (page - 1) * limit
-	return s.orderRepo.GetOrdersBySellerID(ctx, sellerID, limit, offset)
+// GetSellerOrders retrieves a page of orders for a specific seller
+func (s *OrderService) GetSellerOrders(ctx context.Context, sellerID uuid.UUID, page pagination.Params) (pagination.Page[models.Order], error) {
+	return s.orderRepo.GetOrdersBySellerID(ctx, sellerID, page.Normalize())
 }
 
 // UpdateOrderStatus updates the status of an order
@@ -158,7 +227,36 @@ func (s *OrderService) UpdateOrderStatus(ctx context.Context, orderID uuid.UUID,
 		return err
 	}
 
-	return s.orderRepo.UpdateOrderStatus(ctx, orderID, status, notes, updatedBy)
+	if err := s.orderRepo.UpdateOrderStatus(ctx, orderID, status, notes, updatedBy); err != nil {
+		return err
+	}
+
+	// Delivery turns reserved stock into a sale and cancellation releases
+	// it. Refunds leave stock alone; traders record returned goods.
+	if s.inventory != nil {
+		var reason models.StockReason
+		switch status {
+		case models.OrderStatusDelivered:
+			reason = models.StockSale
+		case models.OrderStatusCancelled:
+			reason = models.StockRelease
+		}
+		if reason != "" {
+			if err := s.inventory.SettleOrder(ctx, orderID, reason, updatedBy); err != nil {
+				log.Printf("orders: failed to settle stock for order %s: %v", orderID, err)
+			}
+		}
+	}
+
+	// Delivered orders count towards the seller's reputation
+	if status == models.OrderStatusDelivered && s.reputation != nil {
+		order, err := s.orderRepo.GetOrderByID(ctx, orderID)
+		if err == nil {
+			s.reputation.Enqueue(order.SellerID, reputation.EventOrderDelivered)
+		}
+	}
+
+	return nil
 }
 
 // UpdatePaymentStatus updates the payment status of an order
@@ -257,3 +355,34 @@ func (s *OrderService) validateStatusTransition(orderID uuid.UUID, newStatus mod
 
 	return fmt.Errorf("invalid status transition from %s to %s", order.Status, newStatus)
 }
+
+// orderVariant picks the variant an order item buys. The variant may be
+// left out only when the product has a single active variant.
+func orderVariant(product *models.Product, variantID string) (*models.ProductVariant, error) {
+	if variantID == "" {
+		var only *models.ProductVariant
+		for i := range product.Variants {
+			if !product.Variants[i].IsActive {
+				continue
+			}
+			if only != nil {
+				return nil, fmt.Errorf("product %s has several variants; choose one", product.Title)
+			}
+			only = &product.Variants[i]
+		}
+		if only == nil {
+			return nil, fmt.Errorf("product %s is no longer available", product.Title)
+		}
+		return only, nil
+	}
+
+	id, err := uuid.Parse(variantID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid variant ID %s: %w", variantID, err)
+	}
+	variant, ok := product.Variant(id)
+	if !ok || !variant.IsActive {
+		return nil, fmt.Errorf("variant %s of product %s is not available", variantID, product.Title)
+	}
+	return variant, nil
+}
@@ -6,6 +6,7 @@ import (
 	"math/rand"
 	"time"
 
+	"github.com/Andrew-mugwe/agroai/models"
 )
 
 // PestService handles pest detection operations
@@ -27,6 +28,9 @@ type PestReport struct {
 	Confidence float64   `json:"confidence"`
 	Notes      string    `json:"notes"`
 	CreatedAt  time.Time `json:"created_at"`
+
+	// Image is the uploaded photo's renditions, when stored by the media service
+	Image *models.MediaAsset `json:"image,omitempty"`
 }
 
 // CreatePestReport creates a new pest report
@@ -228,26 +232,23 @@ func (ps *PestService) GetPestReportByID(id int) (*PestReport, error) {
 	return &report, nil
 }
 
-// DeletePestReport deletes a pest report
-func (ps *PestService) DeletePestReport(id int, userID string) error {
+// DeletePestReport deletes a pest report, returning its image reference so
+// the caller can remove the image
+func (ps *PestService) DeletePestReport(id int, userID string) (string, error) {
 	query := `
 		DELETE FROM pest_reports
 		WHERE id = $1 AND user_id = $2
+		RETURNING image_url
 	`
 
-	result, err := ps.db.Exec(query, id, userID)
-	if err != nil {
-		return fmt.Errorf("failed to delete pest report: %w", err)
+	var imageURL string
+	err := ps.db.QueryRow(query, id, userID).Scan(&imageURL)
+	if err == sql.ErrNoRows {
+		return "", fmt.Errorf("pest report not found or access denied")
 	}
-
-	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		return fmt.Errorf("failed to get rows affected: %w", err)
-	}
-
-	if rowsAffected == 0 {
-		return fmt.Errorf("pest report not found or access denied")
+		return "", fmt.Errorf("failed to delete pest report: %w", err)
 	}
 
-	return nil
+	return imageURL, nil
 }
@@ -0,0 +1,245 @@
+package pricing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Andrew-mugwe/agroai/models"
+	"github.com/shopspring/decimal"
+)
+
+// ErrFeedNotConfigured is returned when importing without a feed URL
+var ErrFeedNotConfigured = errors.New("market data feed is not configured")
+
+// Feed is an external commodity price feed. It serves JSON of the form
+//
+//	{"prices": [{"commodity": "DAP fertilizer", "category": "fertilizer",
+//	  "market": "Nakuru", "unit": "kg", "pack_size": "50", "price": "3500.00",
+//	  "currency": "KES", "date": "2026-10-17"}]}
+//
+// where price is for pack_size units in major currency units. Category is
+// optional and inferred from the commodity name when missing.
+type Feed struct {
+	url    string
+	apiKey string
+	client *http.Client
+}
+
+// NewFeed creates a feed client. It returns nil when url is empty, so the
+// result can be passed straight to Service.UseFeed.
+func NewFeed(feedURL, apiKey string) *Feed {
+	if feedURL == "" {
+		return nil
+	}
+	return &Feed{
+		url:    feedURL,
+		apiKey: apiKey,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Source names the feed in stored observations
+func (f *Feed) Source() string {
+	if u, err := url.Parse(f.url); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return f.url
+}
+
+type feedRow struct {
+	Commodity string          `json:"commodity"`
+	Category  string          `json:"category"`
+	Market    string          `json:"market"`
+	Unit      string          `json:"unit"`
+	PackSize  decimal.Decimal `json:"pack_size"`
+	Price     decimal.Decimal `json:"price"`
+	Currency  string          `json:"currency"`
+	Date      string          `json:"date"`
+}
+
+// observation is a feed price converted to cents per base unit
+type observation struct {
+	Commodity      string
+	Category       models.ProductCategory
+	Region         string
+	BaseUnit       models.UnitOfMeasure
+	Currency       string
+	UnitPriceCents decimal.Decimal
+	ObservedOn     time.Time
+}
+
+// FeedReport summarises an import
+type FeedReport struct {
+	Source   string   `json:"source"`
+	Imported int      `json:"imported"`
+	Skipped  int      `json:"skipped"`
+	Errors   []string `json:"errors,omitempty"`
+}
+
+// fetch downloads the feed and converts its rows, collecting the rows it
+// cannot use in the report
+func (f *Feed) fetch(ctx context.Context) ([]observation, *FeedReport, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, f.url, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if f.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+f.apiKey)
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to fetch market data feed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("market data feed returned %s", resp.Status)
+	}
+
+	var body struct {
+		Prices []feedRow `json:"prices"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, nil, fmt.Errorf("failed to decode market data feed: %w", err)
+	}
+
+	report := &FeedReport{Source: f.Source()}
+	observations := make([]observation, 0, len(body.Prices))
+	for i, row := range body.Prices {
+		obs, err := row.observation()
+		if err != nil {
+			report.Skipped++
+			report.Errors = append(report.Errors, fmt.Sprintf("row %d (%s): %v", i+1, row.Commodity, err))
+			continue
+		}
+		observations = append(observations, obs)
+	}
+	return observations, report, nil
+}
+
+func (row feedRow) observation() (observation, error) {
+	commodity := strings.TrimSpace(row.Commodity)
+	if commodity == "" {
+		return observation{}, errors.New("missing commodity")
+	}
+
+	category := models.ProductCategory(strings.ToLower(strings.TrimSpace(row.Category)))
+	if category == "" {
+		category = inferCategory(commodity)
+	}
+	if !category.IsValid() {
+		return observation{}, errors.New("unknown category")
+	}
+
+	unit := models.UnitOfMeasure(strings.ToLower(strings.TrimSpace(row.Unit)))
+	if !unit.IsValid() {
+		return observation{}, fmt.Errorf("unknown unit %q", row.Unit)
+	}
+	packSize := row.PackSize
+	if packSize.IsZero() {
+		packSize = decimal.NewFromInt(1)
+	}
+	qty := unit.ToBase(packSize)
+	if qty.Sign() <= 0 || row.Price.Sign() <= 0 {
+		return observation{}, errors.New("price and pack size must be positive")
+	}
+
+	currency := strings.ToUpper(strings.TrimSpace(row.Currency))
+	if currency == "" {
+		currency = models.DefaultProductCurrency
+	}
+	if len(currency) != 3 {
+		return observation{}, fmt.Errorf("invalid currency %q", row.Currency)
+	}
+
+	observed, err := time.Parse("2006-01-02", row.Date)
+	if err != nil {
+		return observation{}, fmt.Errorf("invalid date %q", row.Date)
+	}
+
+	return observation{
+		Commodity:      commodity,
+		Category:       category,
+		Region:         NormaliseRegion(row.Market),
+		BaseUnit:       unit.Base(),
+		Currency:       currency,
+		UnitPriceCents: row.Price.Mul(decimal.NewFromInt(100)).DivRound(qty, 4),
+		ObservedOn:     observed,
+	}, nil
+}
+
+// categoryKeywords maps words in commodity names to catalogue categories
+var categoryKeywords = map[string]models.ProductCategory{
+	"fertilizer": models.CategoryFertilizer,
+	"fertiliser": models.CategoryFertilizer,
+	"dap":        models.CategoryFertilizer,
+	"urea":       models.CategoryFertilizer,
+	"can":        models.CategoryFertilizer,
+	"npk":        models.CategoryFertilizer,
+	"manure":     models.CategoryFertilizer,
+	"lime":       models.CategoryFertilizer,
+	"seed":       models.CategorySeeds,
+	"seeds":      models.CategorySeeds,
+	"seedling":   models.CategorySeeds,
+	"seedlings":  models.CategorySeeds,
+}
+
+// inferCategory guesses the category of a commodity from its name
+func inferCategory(commodity string) models.ProductCategory {
+	words := strings.FieldsFunc(strings.ToLower(commodity), func(r rune) bool {
+		return !('a' <= r && r <= 'z')
+	})
+	for _, w := range words {
+		if c, ok := categoryKeywords[w]; ok {
+			return c
+		}
+	}
+	return ""
+}
+
+// ImportFeed fetches the configured feed and stores its prices. A price
+// already imported for the same commodity, market, unit and day is replaced.
+func (s *Service) ImportFeed(ctx context.Context) (*FeedReport, error) {
+	if s.feed == nil {
+		return nil, ErrFeedNotConfigured
+	}
+
+	observations, report, err := s.feed.fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	for _, obs := range observations {
+		_, err := tx.ExecContext(ctx, `
+            INSERT INTO commodity_prices (source, commodity, category, region, base_unit, currency, unit_price_cents, observed_on)
+            VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+            ON CONFLICT (source, commodity, region, base_unit, observed_on) DO UPDATE SET
+                category = EXCLUDED.category,
+                currency = EXCLUDED.currency,
+                unit_price_cents = EXCLUDED.unit_price_cents,
+                imported_at = now()`,
+			report.Source, obs.Commodity, obs.Category, obs.Region, obs.BaseUnit, obs.Currency, obs.UnitPriceCents, obs.ObservedOn)
+		if err != nil {
+			return nil, fmt.Errorf("failed to store commodity price: %w", err)
+		}
+		report.Imported++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
@@ -0,0 +1,598 @@
+package pricing
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Andrew-mugwe/agroai/models"
+	"github.com/Andrew-mugwe/agroai/pagination"
+	"github.com/Andrew-mugwe/agroai/repository"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// Index window and thresholds
+const (
+	// orderWindowDays and feedWindowDays bound how far back delivered
+	// orders and feed observations count towards the index
+	orderWindowDays = 90
+	feedWindowDays  = 30
+	// minSamples is the fewest prices an index is published from
+	minSamples = 3
+	// minRegionalSamples is the fewest prices a regional index needs before
+	// listings are compared with it rather than the all-regions index
+	minRegionalSamples = 5
+	// atMarketPercent is how far from the median a price still counts as
+	// at market
+	atMarketPercent = 10.0
+)
+
+// Pricing errors
+var (
+	ErrNoMarketData    = errors.New("not enough market data for this category and unit")
+	ErrProductNotFound = errors.New("product not found")
+)
+
+// indexKey identifies an index
+type indexKey struct {
+	category models.ProductCategory
+	region   string
+	baseUnit models.UnitOfMeasure
+	currency string
+}
+
+// indexSet is an in-memory copy of the published indices
+type indexSet map[indexKey]*models.MarketPriceIndex
+
+// find returns the regional index when it has enough samples, otherwise
+// the index across all regions
+func (s indexSet) find(category models.ProductCategory, region string, baseUnit models.UnitOfMeasure, currency string) *models.MarketPriceIndex {
+	region = NormaliseRegion(region)
+	if region != "" {
+		if idx, ok := s[indexKey{category, region, baseUnit, currency}]; ok && idx.SampleSize() >= minRegionalSamples {
+			return idx
+		}
+	}
+	return s[indexKey{category, "", baseUnit, currency}]
+}
+
+// NormaliseRegion lowercases and trims a region or market name
+func NormaliseRegion(region string) string {
+	return strings.ToLower(strings.TrimSpace(region))
+}
+
+// Service records and aggregates market prices. The indices are rebuilt
+// in the database and served from memory, so listing hints cost nothing
+// per request.
+type Service struct {
+	db       *sql.DB
+	products repository.ProductRepository
+	feed     *Feed
+
+	mu      sync.RWMutex
+	indices indexSet
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	once   sync.Once
+}
+
+// NewService creates a new pricing service
+func NewService(db *sql.DB, products repository.ProductRepository) *Service {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Service{
+		db:       db,
+		products: products,
+		indices:  indexSet{},
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+}
+
+// UseFeed adds an external commodity price feed, imported on the schedule
+// started by Start
+func (s *Service) UseFeed(feed *Feed) {
+	s.feed = feed
+}
+
+// HasFeed reports whether an external feed is configured
+func (s *Service) HasFeed() bool {
+	return s.feed != nil
+}
+
+// Recompute rebuilds every index from active listings, recently delivered
+// orders and recent feed observations, then reloads them into memory.
+// Order prices are converted to per-unit prices through the variant's
+// current pack size.
+func (s *Service) Recompute(ctx context.Context) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	region := `NULLIF(lower(` + repository.SellerLocationExpr + `), '')`
+	_, err = tx.ExecContext(ctx, `
+        WITH samples AS (
+            SELECT p.category::text AS category, `+region+` AS region, v.base_unit::text AS base_unit,
+                   p.currency::text AS currency, v.unit_price_cents::float8 AS unit_price, 'listing' AS source
+            FROM product_variants v
+            JOIN marketplace_products p ON p.id = v.product_id
+            LEFT JOIN sellers s ON s.user_id = p.seller_id
+            WHERE p.is_active AND v.is_active AND v.unit_price_cents > 0
+            UNION ALL
+            SELECT p.category::text, `+region+`, v.base_unit::text, o.currency::text,
+                   (oi.unit_price * 100 * v.unit_price_cents / v.price_cents)::float8, 'order'
+            FROM order_items oi
+            JOIN orders o ON o.id = oi.order_id
+            JOIN product_variants v ON v.id = oi.variant_id
+            JOIN marketplace_products p ON p.id = v.product_id
+            LEFT JOIN sellers s ON s.user_id = p.seller_id
+            WHERE o.status = 'delivered'
+              AND COALESCE(o.delivered_at, o.updated_at) >= now() - make_interval(days => $1)
+              AND v.price_cents > 0 AND oi.unit_price > 0
+            UNION ALL
+            SELECT category, NULLIF(region, ''), base_unit, currency::text, unit_price_cents::float8, 'feed'
+            FROM commodity_prices
+            WHERE observed_on >= current_date - $2::int
+        )
+        INSERT INTO market_price_indices (
+            category, region, base_unit, currency,
+            median_unit_price_cents, p25_unit_price_cents, p75_unit_price_cents,
+            listing_count, order_count, feed_count, computed_at
+        )
+        SELECT category, COALESCE(region, ''), base_unit, currency,
+               percentile_cont(0.5) WITHIN GROUP (ORDER BY unit_price),
+               percentile_cont(0.25) WITHIN GROUP (ORDER BY unit_price),
+               percentile_cont(0.75) WITHIN GROUP (ORDER BY unit_price),
+               COUNT(*) FILTER (WHERE source = 'listing'),
+               COUNT(*) FILTER (WHERE source = 'order'),
+               COUNT(*) FILTER (WHERE source = 'feed'),
+               now()
+        FROM samples
+        GROUP BY GROUPING SETS ((category, region, base_unit, currency), (category, base_unit, currency))
+        -- Prices without a region only count towards the all-regions index
+        HAVING COUNT(*) >= $3 AND (GROUPING(region) = 1 OR region IS NOT NULL)
+        ON CONFLICT (category, region, base_unit, currency) DO UPDATE SET
+            median_unit_price_cents = EXCLUDED.median_unit_price_cents,
+            p25_unit_price_cents = EXCLUDED.p25_unit_price_cents,
+            p75_unit_price_cents = EXCLUDED.p75_unit_price_cents,
+            listing_count = EXCLUDED.listing_count,
+            order_count = EXCLUDED.order_count,
+            feed_count = EXCLUDED.feed_count,
+            computed_at = EXCLUDED.computed_at`,
+		orderWindowDays, feedWindowDays, minSamples)
+	if err != nil {
+		return fmt.Errorf("failed to compute market price indices: %w", err)
+	}
+
+	// Indices that no longer have enough samples were not touched above;
+	// now() is the transaction start, so this removes exactly those
+	if _, err := tx.ExecContext(ctx, `DELETE FROM market_price_indices WHERE computed_at < now()`); err != nil {
+		return fmt.Errorf("failed to prune market price indices: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	return s.Reload(ctx)
+}
+
+// Reload reads the published indices into memory
+func (s *Service) Reload(ctx context.Context) error {
+	indices, err := s.Indices(ctx, "", "")
+	if err != nil {
+		return err
+	}
+
+	set := make(indexSet, len(indices))
+	for i := range indices {
+		idx := &indices[i]
+		set[indexKey{idx.Category, idx.Region, idx.BaseUnit, idx.Currency}] = idx
+	}
+
+	s.mu.Lock()
+	s.indices = set
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *Service) snapshot() indexSet {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.indices
+}
+
+const indexColumns = `category, region, base_unit, currency,
+               median_unit_price_cents, p25_unit_price_cents, p75_unit_price_cents,
+               listing_count, order_count, feed_count, computed_at`
+
+func scanIndex(rows *sql.Rows, extra ...interface{}) (models.MarketPriceIndex, error) {
+	var idx models.MarketPriceIndex
+	err := rows.Scan(append([]interface{}{&idx.Category, &idx.Region, &idx.BaseUnit, &idx.Currency,
+		&idx.MedianCents, &idx.LowCents, &idx.HighCents,
+		&idx.ListingCount, &idx.OrderCount, &idx.FeedCount, &idx.ComputedAt}, extra...)...)
+	return idx, err
+}
+
+// Indices lists every published index, optionally for one category and
+// region. Region "" on an index means all regions.
+func (s *Service) Indices(ctx context.Context, category, region string) ([]models.MarketPriceIndex, error) {
+	query := `
+        SELECT ` + indexColumns + `
+        FROM market_price_indices
+        WHERE ($1 = '' OR category = $1) AND ($2 = '' OR region = $2)
+        ORDER BY category, region, base_unit, currency`
+
+	rows, err := s.db.QueryContext(ctx, query, category, NormaliseRegion(region))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list market price indices: %w", err)
+	}
+	defer rows.Close()
+
+	indices := []models.MarketPriceIndex{}
+	for rows.Next() {
+		idx, err := scanIndex(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan market price index: %w", err)
+		}
+		indices = append(indices, idx)
+	}
+	return indices, rows.Err()
+}
+
+// indexKeyset orders indices by category, region and unit, then currency.
+// Categories and units never contain the separator, so the key is unique
+// per currency.
+var indexKeyset = pagination.Keyset{
+	Key: "category || '/' || region || '/' || base_unit",
+	ID:  "currency",
+	Dir: pagination.Asc,
+}
+
+// indexSort names the index order in cursors
+const indexSort = "market"
+
+// ListIndices returns a page of the published indices, filtered like
+// Indices
+func (s *Service) ListIndices(ctx context.Context, category, region string, page pagination.Params) (pagination.Page[models.MarketPriceIndex], error) {
+	var none pagination.Page[models.MarketPriceIndex]
+	page = page.Normalize()
+	after, err := page.After(indexSort)
+	if err != nil {
+		return none, err
+	}
+
+	where := `
+        FROM market_price_indices
+        WHERE ($1 = '' OR category = $1) AND ($2 = '' OR region = $2)`
+	args := []interface{}{category, NormaliseRegion(region)}
+	var total int
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*)`+where, args...).Scan(&total); err != nil {
+		return none, fmt.Errorf("failed to count market price indices: %w", err)
+	}
+
+	query := `
+        SELECT ` + indexColumns + `, ` + indexKeyset.KeyText() + where
+	if after != nil {
+		query += " AND " + indexKeyset.After("$3", "$4")
+		args = append(args, after.Key, after.ID)
+	}
+	query += fmt.Sprintf(" ORDER BY %s LIMIT $%d", indexKeyset.OrderBy(), len(args)+1)
+	args = append(args, page.FetchLimit())
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return none, fmt.Errorf("failed to list market price indices: %w", err)
+	}
+	defer rows.Close()
+
+	var indices []models.MarketPriceIndex
+	var keys []string
+	for rows.Next() {
+		var key string
+		idx, err := scanIndex(rows, &key)
+		if err != nil {
+			return none, fmt.Errorf("failed to scan market price index: %w", err)
+		}
+		indices = append(indices, idx)
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return none, fmt.Errorf("failed to list market price indices: %w", err)
+	}
+
+	return pagination.NewPage(indices, page.Limit, func(i int) pagination.Cursor {
+		return pagination.Cursor{Key: keys[i], ID: indices[i].Currency, Sort: indexSort}
+	}).WithTotal(total), nil
+}
+
+// AttachHints sets MarketPrice on each product an index covers
+func (s *Service) AttachHints(products []*models.Product) {
+	set := s.snapshot()
+	for _, p := range products {
+		p.MarketPrice = hintFor(p, set)
+	}
+}
+
+// hintFor compares the product's cheapest active variant per base unit
+// with the index for its category, seller region and unit
+func hintFor(p *models.Product, set indexSet) *models.MarketPriceHint {
+	var cheapest *models.ProductVariant
+	for i := range p.Variants {
+		v := &p.Variants[i]
+		if !v.IsActive || v.UnitPriceCents.Sign() <= 0 {
+			continue
+		}
+		if cheapest == nil || v.UnitPriceCents.LessThan(cheapest.UnitPriceCents) {
+			cheapest = v
+		}
+	}
+	if cheapest == nil {
+		return nil
+	}
+
+	region := ""
+	if p.SellerLocation != nil {
+		region = *p.SellerLocation
+	}
+	idx := set.find(p.Category, region, cheapest.BaseUnit, p.Currency)
+	if idx == nil || idx.MedianCents.Sign() <= 0 {
+		return nil
+	}
+
+	diff := position(cheapest.UnitPriceCents, idx.MedianCents)
+	return &models.MarketPriceHint{
+		Position:          marketPosition(diff),
+		DifferencePercent: diff,
+		UnitPriceCents:    cheapest.UnitPriceCents,
+		MedianCents:       idx.MedianCents,
+		BaseUnit:          idx.BaseUnit,
+		Region:            idx.Region,
+		SampleSize:        idx.SampleSize(),
+	}
+}
+
+// position returns how far price is from median in percent, to one decimal
+func position(price, median decimal.Decimal) float64 {
+	diff, _ := price.Sub(median).Div(median).Mul(decimal.NewFromInt(100)).Float64()
+	return math.Round(diff*10) / 10
+}
+
+func marketPosition(diffPercent float64) models.MarketPosition {
+	switch {
+	case diffPercent < -atMarketPercent:
+		return models.MarketBelow
+	case diffPercent > atMarketPercent:
+		return models.MarketAbove
+	}
+	return models.MarketAt
+}
+
+// SuggestRequest describes the pack to price. With a ProductID the
+// product's own variants are priced instead.
+type SuggestRequest struct {
+	ProductID *uuid.UUID
+	Category  models.ProductCategory
+	Unit      models.UnitOfMeasure
+	PackSize  decimal.Decimal
+	Currency  string
+}
+
+// Suggestion prices each pack from the market index. Low and high are the
+// interquartile range.
+type Suggestion struct {
+	Index *models.MarketPriceIndex `json:"index"`
+	Packs []PackSuggestion         `json:"packs"`
+}
+
+// PackSuggestion is the suggested price of one pack
+type PackSuggestion struct {
+	VariantID           *uuid.UUID             `json:"variant_id,omitempty"`
+	SKU                 string                 `json:"sku,omitempty"`
+	PackSize            decimal.Decimal        `json:"pack_size"`
+	Unit                models.UnitOfMeasure   `json:"unit"`
+	CurrentPriceCents   *int64                 `json:"current_price_cents,omitempty"`
+	Position            *models.MarketPosition `json:"position,omitempty"`
+	SuggestedPriceCents int64                  `json:"suggested_price_cents"`
+	LowPriceCents       int64                  `json:"low_price_cents"`
+	HighPriceCents      int64                  `json:"high_price_cents"`
+}
+
+// Suggest prices a trader's pack, or every variant of their product, from
+// the index for the trader's region
+func (s *Service) Suggest(ctx context.Context, sellerID uuid.UUID, req SuggestRequest) (*Suggestion, error) {
+	region, err := s.sellerRegion(ctx, sellerID)
+	if err != nil {
+		return nil, err
+	}
+	set := s.snapshot()
+
+	if req.ProductID == nil {
+		if req.Currency == "" {
+			req.Currency = models.DefaultProductCurrency
+		}
+		variant := models.ProductVariant{PackSize: req.PackSize, Unit: req.Unit}
+		idx := set.find(req.Category, region, req.Unit.Base(), req.Currency)
+		if idx == nil {
+			return nil, ErrNoMarketData
+		}
+		return &Suggestion{Index: idx, Packs: []PackSuggestion{suggestPack(&variant, idx, false)}}, nil
+	}
+
+	product, err := s.products.GetByID(ctx, *req.ProductID)
+	if err == sql.ErrNoRows || (err == nil && product.SellerID != sellerID) {
+		return nil, ErrProductNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	suggestion := &Suggestion{Packs: []PackSuggestion{}}
+	for i := range product.Variants {
+		v := &product.Variants[i]
+		idx := set.find(product.Category, region, v.BaseUnit, product.Currency)
+		if idx == nil {
+			continue
+		}
+		if suggestion.Index == nil {
+			suggestion.Index = idx
+		}
+		suggestion.Packs = append(suggestion.Packs, suggestPack(v, idx, true))
+	}
+	if len(suggestion.Packs) == 0 {
+		return nil, ErrNoMarketData
+	}
+	return suggestion, nil
+}
+
+// suggestPack scales the index's per-unit prices to the pack
+func suggestPack(v *models.ProductVariant, idx *models.MarketPriceIndex, existing bool) PackSuggestion {
+	qty := v.BaseQuantity()
+	cents := func(perUnit decimal.Decimal) int64 {
+		return perUnit.Mul(qty).Round(0).IntPart()
+	}
+
+	pack := PackSuggestion{
+		PackSize:            v.PackSize,
+		Unit:                v.Unit,
+		SuggestedPriceCents: cents(idx.MedianCents),
+		LowPriceCents:       cents(idx.LowCents),
+		HighPriceCents:      cents(idx.HighCents),
+	}
+	if existing {
+		id, price := v.ID, v.PriceCents
+		pack.VariantID, pack.SKU, pack.CurrentPriceCents = &id, v.SKU, &price
+		if qty.Sign() > 0 && idx.MedianCents.Sign() > 0 {
+			unitPrice := decimal.NewFromInt(v.PriceCents).Div(qty)
+			pos := marketPosition(position(unitPrice, idx.MedianCents))
+			pack.Position = &pos
+		}
+	}
+	return pack
+}
+
+// sellerRegion returns the normalised region a seller is priced in
+func (s *Service) sellerRegion(ctx context.Context, sellerID uuid.UUID) (string, error) {
+	var region sql.NullString
+	err := s.db.QueryRowContext(ctx, `SELECT `+repository.SellerLocationExpr+` FROM sellers s WHERE s.user_id = $1`, sellerID).Scan(&region)
+	if err != nil && err != sql.ErrNoRows {
+		return "", fmt.Errorf("failed to get seller region: %w", err)
+	}
+	return NormaliseRegion(region.String), nil
+}
+
+// historyKeyset lists price points oldest first
+var historyKeyset = pagination.Keyset{Key: "h.recorded_at", ID: "h.id", Dir: pagination.Asc}
+
+// historySort names the price history order in cursors
+const historySort = "oldest"
+
+// History returns a page of the recorded prices of an active product's
+// variants since the given time, oldest first
+func (s *Service) History(ctx context.Context, productID uuid.UUID, since time.Time, page pagination.Params) (pagination.Page[models.PricePoint], error) {
+	var none pagination.Page[models.PricePoint]
+	page = page.Normalize()
+	after, err := page.After(historySort)
+	if err != nil {
+		return none, err
+	}
+
+	from := `
+        FROM product_price_history h
+        JOIN marketplace_products p ON p.id = h.product_id
+        WHERE h.product_id = $1 AND p.is_active AND h.recorded_at >= $2`
+	var total int
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*)`+from, productID, since).Scan(&total); err != nil {
+		return none, fmt.Errorf("failed to count price history: %w", err)
+	}
+
+	query := `
+        SELECT h.id, h.product_id, h.variant_id, h.price_cents, h.previous_price_cents,
+               h.unit_price_cents, h.base_unit, h.recorded_at, ` + historyKeyset.KeyText() + from
+	args := []interface{}{productID, since}
+	if after != nil {
+		query += " AND " + historyKeyset.After("$3", "$4")
+		args = append(args, after.Key, after.ID)
+	}
+	query += fmt.Sprintf(" ORDER BY %s LIMIT $%d", historyKeyset.OrderBy(), len(args)+1)
+	args = append(args, page.FetchLimit())
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return none, fmt.Errorf("failed to get price history: %w", err)
+	}
+	defer rows.Close()
+
+	var points []models.PricePoint
+	var keys []string
+	for rows.Next() {
+		var pt models.PricePoint
+		var key string
+		if err := rows.Scan(&pt.ID, &pt.ProductID, &pt.VariantID, &pt.PriceCents, &pt.PreviousPriceCents,
+			&pt.UnitPriceCents, &pt.BaseUnit, &pt.RecordedAt, &key); err != nil {
+			return none, fmt.Errorf("failed to scan price point: %w", err)
+		}
+		points = append(points, pt)
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return none, fmt.Errorf("failed to get price history: %w", err)
+	}
+
+	return pagination.NewPage(points, page.Limit, func(i int) pagination.Cursor {
+		return pagination.Cursor{Key: keys[i], ID: points[i].ID.String(), Sort: historySort}
+	}).WithTotal(total), nil
+}
+
+// Start loads the indices and keeps them fresh: they are recomputed every
+// interval, and the feed, when configured, is imported every feedInterval
+func (s *Service) Start(interval, feedInterval time.Duration) {
+	s.once.Do(func() {
+		log.Printf("Starting market price indices (interval: %v)", interval)
+
+		go func() {
+			if err := s.Reload(s.ctx); err != nil {
+				log.Printf("Market price indices not loaded: %v", err)
+			}
+
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			feedTicker := time.NewTicker(feedInterval)
+			defer feedTicker.Stop()
+
+			for {
+				select {
+				case <-s.ctx.Done():
+					return
+				case <-feedTicker.C:
+					if s.feed == nil {
+						continue
+					}
+					report, err := s.ImportFeed(s.ctx)
+					if err != nil {
+						log.Printf("Commodity price feed import failed: %v", err)
+						continue
+					}
+					log.Printf("Imported %d commodity prices from %s (%d skipped)", report.Imported, report.Source, report.Skipped)
+				case <-ticker.C:
+					if err := s.Recompute(s.ctx); err != nil {
+						log.Printf("Market price recompute failed: %v", err)
+					}
+				}
+			}
+		}()
+	})
+}
+
+// Stop stops the background recompute and feed imports
+func (s *Service) Stop() {
+	s.cancel()
+}
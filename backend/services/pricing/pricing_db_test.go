@@ -0,0 +1,70 @@
+package pricing
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+
+	"github.com/google/uuid"
+	_ "github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Andrew-mugwe/agroai/pagination"
+)
+
+// These tests page through indices in a migrated database.
+
+func setupPricingDB(t *testing.T) *sql.DB {
+	databaseURL := os.Getenv("DATABASE_URL")
+	if databaseURL == "" {
+		t.Skip("DATABASE_URL not set, skipping integration test")
+	}
+
+	db, err := sql.Open("postgres", databaseURL)
+	require.NoError(t, err)
+	require.NoError(t, db.Ping())
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestListIndicesPages(t *testing.T) {
+	db := setupPricingDB(t)
+	category := "test-" + uuid.NewString()[:8]
+	_, err := db.Exec(`
+		INSERT INTO market_price_indices (category, region, base_unit, currency,
+			median_unit_price_cents, p25_unit_price_cents, p75_unit_price_cents, listing_count)
+		VALUES ($1, '', 'kg', 'KES', 100, 90, 110, 3),
+		       ($1, '', 'kg', 'UGX', 100, 90, 110, 3),
+		       ($1, 'eldoret', 'kg', 'KES', 100, 90, 110, 3),
+		       ($1, 'eldoret', 'l', 'KES', 100, 90, 110, 3),
+		       ($1, 'nakuru', 'kg', 'KES', 100, 90, 110, 3)`, category)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Exec(`DELETE FROM market_price_indices WHERE category = $1`, category) })
+
+	s := &Service{db: db}
+	seen := map[string]bool{}
+	page := pagination.Params{Limit: 2}
+	for pages := 0; ; pages++ {
+		require.Less(t, pages, 3)
+		got, err := s.ListIndices(context.Background(), category, "", page)
+		require.NoError(t, err)
+		assert.Equal(t, 5, *got.Total)
+		for _, idx := range got.Items {
+			key := idx.Region + "/" + string(idx.BaseUnit) + "/" + idx.Currency
+			assert.False(t, seen[key], "index %s listed twice", key)
+			seen[key] = true
+		}
+		if got.Next == nil {
+			break
+		}
+		page.Cursor = got.Next
+	}
+	assert.Len(t, seen, 5)
+
+	_, err = s.ListIndices(context.Background(), category, "", pagination.Params{
+		Cursor: &pagination.Cursor{Key: "x", ID: "KES", Sort: historySort},
+	})
+	assert.ErrorIs(t, err, pagination.ErrInvalidCursor)
+}
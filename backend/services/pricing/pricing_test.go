@@ -0,0 +1,192 @@
+package pricing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/Andrew-mugwe/agroai/models"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testIndex(category models.ProductCategory, region string, median int64, samples int) *models.MarketPriceIndex {
+	return &models.MarketPriceIndex{
+		Category:     category,
+		Region:       region,
+		BaseUnit:     models.UnitKilogram,
+		Currency:     "KES",
+		MedianCents:  decimal.NewFromInt(median),
+		LowCents:     decimal.NewFromInt(median * 8 / 10),
+		HighCents:    decimal.NewFromInt(median * 12 / 10),
+		ListingCount: samples,
+	}
+}
+
+func testSet(indices ...*models.MarketPriceIndex) indexSet {
+	set := indexSet{}
+	for _, idx := range indices {
+		set[indexKey{idx.Category, idx.Region, idx.BaseUnit, idx.Currency}] = idx
+	}
+	return set
+}
+
+func testProduct(region string, variants ...models.ProductVariant) *models.Product {
+	p := &models.Product{Category: models.CategoryFertilizer, Currency: "KES", Variants: variants}
+	if region != "" {
+		p.SellerLocation = &region
+	}
+	return p
+}
+
+func testVariant(packKg, priceCents int64) models.ProductVariant {
+	v := models.ProductVariant{
+		PackSize:   decimal.NewFromInt(packKg),
+		Unit:       models.UnitKilogram,
+		PriceCents: priceCents,
+		IsActive:   true,
+	}
+	v.ComputeUnitPrice()
+	return v
+}
+
+func TestHintPositions(t *testing.T) {
+	set := testSet(testIndex(models.CategoryFertilizer, "", 7000, 20))
+
+	for name, tc := range map[string]struct {
+		priceCents int64
+		position   models.MarketPosition
+		diff       float64
+	}{
+		"below": {300000, models.MarketBelow, -14.3},
+		"at":    {370000, models.MarketAt, 5.7},
+		"above": {400000, models.MarketAbove, 14.3},
+	} {
+		hint := hintFor(testProduct("", testVariant(50, tc.priceCents)), set)
+		require.NotNil(t, hint, name)
+		assert.Equal(t, tc.position, hint.Position, name)
+		assert.Equal(t, tc.diff, hint.DifferencePercent, name)
+		assert.Equal(t, 20, hint.SampleSize, name)
+	}
+}
+
+func TestHintUsesCheapestActiveVariant(t *testing.T) {
+	set := testSet(testIndex(models.CategoryFertilizer, "", 7000, 20))
+	inactive := testVariant(50, 100000)
+	inactive.IsActive = false
+
+	hint := hintFor(testProduct("", inactive, testVariant(10, 80000), testVariant(50, 350000)), set)
+	require.NotNil(t, hint)
+	assert.True(t, hint.UnitPriceCents.Equal(decimal.NewFromInt(7000)))
+	assert.Equal(t, models.MarketAt, hint.Position)
+}
+
+func TestHintFallsBackToAllRegions(t *testing.T) {
+	set := testSet(
+		testIndex(models.CategoryFertilizer, "", 7000, 40),
+		testIndex(models.CategoryFertilizer, "nakuru", 6000, 12),
+		testIndex(models.CategoryFertilizer, "kitale", 9000, 3),
+	)
+
+	hint := hintFor(testProduct("Nakuru", testVariant(50, 350000)), set)
+	require.NotNil(t, hint)
+	assert.Equal(t, "nakuru", hint.Region)
+	assert.Equal(t, models.MarketAbove, hint.Position)
+
+	// Too few samples in Kitale to trust its index
+	hint = hintFor(testProduct("Kitale", testVariant(50, 350000)), set)
+	require.NotNil(t, hint)
+	assert.Equal(t, "", hint.Region)
+	assert.Equal(t, models.MarketAt, hint.Position)
+
+	// Nothing covers other categories or units
+	p := testProduct("Nakuru", testVariant(50, 350000))
+	p.Category = models.CategoryTools
+	assert.Nil(t, hintFor(p, set))
+	assert.Nil(t, hintFor(testProduct(""), set))
+}
+
+func TestSuggestPack(t *testing.T) {
+	idx := testIndex(models.CategoryFertilizer, "", 7000, 20)
+
+	v := testVariant(25, 200000)
+	pack := suggestPack(&v, idx, true)
+	assert.Equal(t, int64(175000), pack.SuggestedPriceCents)
+	assert.Equal(t, int64(140000), pack.LowPriceCents)
+	assert.Equal(t, int64(210000), pack.HighPriceCents)
+	require.NotNil(t, pack.Position)
+	assert.Equal(t, models.MarketAbove, *pack.Position)
+	assert.Equal(t, int64(200000), *pack.CurrentPriceCents)
+
+	// A new 500g pack is priced from the per-kg index
+	grams := models.ProductVariant{PackSize: decimal.NewFromInt(500), Unit: models.UnitGram}
+	pack = suggestPack(&grams, idx, false)
+	assert.Equal(t, int64(3500), pack.SuggestedPriceCents)
+	assert.Nil(t, pack.Position)
+	assert.Nil(t, pack.VariantID)
+}
+
+func TestInferCategory(t *testing.T) {
+	assert.Equal(t, models.CategoryFertilizer, inferCategory("DAP 50kg"))
+	assert.Equal(t, models.CategoryFertilizer, inferCategory("NPK 17:17:17"))
+	assert.Equal(t, models.CategorySeeds, inferCategory("Hybrid maize seeds"))
+	assert.Equal(t, models.ProductCategory(""), inferCategory("Tomatoes"))
+	// Whole words only
+	assert.Equal(t, models.ProductCategory(""), inferCategory("Cannabis"))
+}
+
+func TestFeedFetch(t *testing.T) {
+	fixture, err := os.ReadFile("testdata/commodity_prices.json")
+	require.NoError(t, err)
+
+	var auth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(fixture)
+	}))
+	defer server.Close()
+
+	feed := NewFeed(server.URL+"/v1/prices", "test-key")
+	observations, report, err := feed.fetch(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer test-key", auth)
+	assert.Equal(t, feed.Source(), report.Source)
+
+	require.Len(t, observations, 3)
+	assert.Equal(t, 4, report.Skipped)
+	assert.Len(t, report.Errors, 4)
+
+	dap := observations[0]
+	assert.Equal(t, models.CategoryFertilizer, dap.Category)
+	assert.Equal(t, "nakuru", dap.Region)
+	assert.Equal(t, models.UnitKilogram, dap.BaseUnit)
+	assert.True(t, dap.UnitPriceCents.Equal(decimal.NewFromInt(7000)), dap.UnitPriceCents.String())
+
+	seed := observations[1]
+	assert.Equal(t, "eldoret", seed.Region)
+	assert.Equal(t, "KES", seed.Currency)
+	assert.True(t, seed.UnitPriceCents.Equal(decimal.NewFromInt(35000)), seed.UnitPriceCents.String())
+
+	foliar := observations[2]
+	assert.Equal(t, models.UnitLitre, foliar.BaseUnit)
+	assert.Equal(t, models.DefaultProductCurrency, foliar.Currency)
+	assert.True(t, foliar.UnitPriceCents.Equal(decimal.NewFromInt(90000)), foliar.UnitPriceCents.String())
+}
+
+func TestFeedFetchErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "rate limited", http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	_, _, err := NewFeed(server.URL, "").fetch(context.Background())
+	assert.ErrorContains(t, err, "429")
+
+	assert.Nil(t, NewFeed("", "key"))
+	_, err = NewService(nil, nil).ImportFeed(context.Background())
+	assert.ErrorIs(t, err, ErrFeedNotConfigured)
+}
@@ -4,27 +4,50 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"strings"
+
 	"github.com/Andrew-mugwe/agroai/models"
+	"github.com/Andrew-mugwe/agroai/pagination"
 	"github.com/Andrew-mugwe/agroai/repository"
 
 	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
 )
 
 var (
 	ErrProductUnauthorized = errors.New("unauthorized: only traders can manage products")
-	ErrNotFound     = errors.New("product not found")
+	ErrNotFound            = errors.New("product not found")
+	ErrInvalidProduct      = errors.New("invalid product")
+	ErrVariantNotFound     = errors.New("product variant not found")
+	ErrDuplicateSKU        = errors.New("another variant of this product already uses this SKU")
+	ErrLastVariant         = errors.New("a product must keep at least one variant")
 )
 
 type ProductService interface {
-	CreateProduct(ctx context.Context, traderID uuid.UUID, req *models.CreateProductRequest) (*models.Product, error)
-	UpdateProduct(ctx context.Context, productID, traderID uuid.UUID, req *models.UpdateProductRequest) (*models.Product, error)
-	DeleteProduct(ctx context.Context, productID, traderID uuid.UUID) error
-	GetTraderProducts(ctx context.Context, traderID uuid.UUID, page, pageSize int) ([]*models.Product, int, error)
+	CreateProduct(ctx context.Context, sellerID uuid.UUID, req *models.CreateProductRequest) (*models.Product, error)
+	UpdateProduct(ctx context.Context, productID, sellerID uuid.UUID, req *models.UpdateProductRequest) (*models.Product, error)
+	DeleteProduct(ctx context.Context, productID, sellerID uuid.UUID) error
+	ListSellerProducts(ctx context.Context, sellerID uuid.UUID, filter repository.ProductFilter, page pagination.Params) (pagination.Page[*models.Product], error)
 	GetProductByID(ctx context.Context, productID uuid.UUID) (*models.Product, error)
+
+	AddVariant(ctx context.Context, productID, sellerID uuid.UUID, req *models.ProductVariantRequest) (*models.ProductVariant, error)
+	UpdateVariant(ctx context.Context, productID, variantID, sellerID uuid.UUID, req *models.UpdateProductVariantRequest) (*models.ProductVariant, error)
+	DeleteVariant(ctx context.Context, productID, variantID, sellerID uuid.UUID) error
+
+	// SetStockWatcher registers who is told when a product's stock changes
+	SetStockWatcher(watcher StockWatcher)
+}
+
+// StockWatcher is told which products' stock may have changed, e.g. to
+// raise low-stock alerts
+type StockWatcher interface {
+	StockChanged(ctx context.Context, productIDs ...uuid.UUID)
 }
 
 type productService struct {
 	productRepo repository.ProductRepository
+	watcher     StockWatcher
 }
 
 func NewProductService(productRepo repository.ProductRepository) ProductService {
@@ -33,29 +56,81 @@ func NewProductService(productRepo repository.ProductRepository) ProductService
 	}
 }
 
-func (s *productService) CreateProduct(ctx context.Context, traderID uuid.UUID, req *models.CreateProductRequest) (*models.Product, error) {
+func (s *productService) CreateProduct(ctx context.Context, sellerID uuid.UUID, req *models.CreateProductRequest) (*models.Product, error) {
 	// Note: Role verification should be done at the handler level
 
+	product, err := NewProduct(sellerID, req)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.productRepo.Create(ctx, product)
+	if err != nil {
+		return nil, err
+	}
+	s.stockChanged(ctx, product.ID)
+
+	return product, nil
+}
+
+func (s *productService) SetStockWatcher(watcher StockWatcher) {
+	s.watcher = watcher
+}
+
+func (s *productService) stockChanged(ctx context.Context, productID uuid.UUID) {
+	if s.watcher != nil {
+		s.watcher.StockChanged(ctx, productID)
+	}
+}
+
+// NewProduct builds and validates the catalogue record for a create request
+// without saving it
+func NewProduct(sellerID uuid.UUID, req *models.CreateProductRequest) (*models.Product, error) {
 	product := &models.Product{
-		TraderID:    traderID,
-		Name:        req.Name,
-		Description: req.Description,
-		Price:       req.Price,
-		Stock:       req.Stock,
+		SellerID:    sellerID,
+		Title:       strings.TrimSpace(req.Title),
+		Description: strings.TrimSpace(req.Description),
 		Category:    req.Category,
-		ImageURL:    req.ImageURL,
+		Currency:    strings.ToUpper(req.Currency),
+		Images:      req.Images,
 		IsActive:    true,
+
+		ReorderThreshold: req.ReorderThreshold,
+	}
+	if product.Currency == "" {
+		product.Currency = models.DefaultProductCurrency
+	}
+	if product.Category == "" {
+		product.Category = models.CategoryOther
 	}
 
-	err := s.productRepo.Create(ctx, product)
-	if err != nil {
+	// Without explicit variants the product is sold per piece
+	variants := req.Variants
+	if len(variants) == 0 {
+		variants = []models.ProductVariantRequest{{
+			PackSize:   decimal.NewFromInt(1),
+			Unit:       models.UnitPiece,
+			PriceCents: req.PriceCents,
+			Stock:      req.Stock,
+		}}
+	}
+	for _, v := range variants {
+		variant := newVariant(v, sellerID)
+		if err := ValidateVariant(&variant, product.Variants); err != nil {
+			return nil, err
+		}
+		product.Variants = append(product.Variants, variant)
+	}
+	product.SummariseVariants()
+
+	if err := ValidateProduct(product); err != nil {
 		return nil, err
 	}
 
 	return product, nil
 }
 
-func (s *productService) UpdateProduct(ctx context.Context, productID, traderID uuid.UUID, req *models.UpdateProductRequest) (*models.Product, error) {
+func (s *productService) UpdateProduct(ctx context.Context, productID, sellerID uuid.UUID, req *models.UpdateProductRequest) (*models.Product, error) {
 	// Get existing product
 	product, err := s.productRepo.GetByID(ctx, productID)
 	if err != nil {
@@ -66,33 +141,34 @@ func (s *productService) UpdateProduct(ctx context.Context, productID, traderID
 	}
 
 	// Verify ownership
-	if product.TraderID != traderID {
+	if product.SellerID != sellerID {
 		return nil, ErrProductUnauthorized
 	}
 
 	// Update fields if provided
-	if req.Name != nil {
-		product.Name = *req.Name
+	if req.Title != nil {
+		product.Title = strings.TrimSpace(*req.Title)
 	}
 	if req.Description != nil {
-		product.Description = *req.Description
+		product.Description = strings.TrimSpace(*req.Description)
 	}
-	if req.Price != nil {
-		product.Price = *req.Price
-	}
-	if req.Stock != nil {
-		product.Stock = *req.Stock
+	if req.Currency != nil {
+		product.Currency = strings.ToUpper(*req.Currency)
 	}
 	if req.Category != nil {
 		product.Category = *req.Category
 	}
-	if req.ImageURL != nil {
-		product.ImageURL = *req.ImageURL
+	if req.Images != nil {
+		product.Images = *req.Images
 	}
 	if req.IsActive != nil {
 		product.IsActive = *req.IsActive
 	}
 
+	if err := ValidateProduct(product); err != nil {
+		return nil, err
+	}
+
 	err = s.productRepo.Update(ctx, product)
 	if err != nil {
 		return nil, err
@@ -101,8 +177,8 @@ func (s *productService) UpdateProduct(ctx context.Context, productID, traderID
 	return product, nil
 }
 
-func (s *productService) DeleteProduct(ctx context.Context, productID, traderID uuid.UUID) error {
-	// Verify product exists and belongs to trader
+func (s *productService) DeleteProduct(ctx context.Context, productID, sellerID uuid.UUID) error {
+	// Verify product exists and belongs to the seller
 	product, err := s.productRepo.GetByID(ctx, productID)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -111,33 +187,29 @@ func (s *productService) DeleteProduct(ctx context.Context, productID, traderID
 		return err
 	}
 
-	if product.TraderID != traderID {
+	if product.SellerID != sellerID {
 		return ErrProductUnauthorized
 	}
 
-	return s.productRepo.Delete(ctx, productID, traderID)
+	return s.productRepo.Delete(ctx, productID, sellerID)
 }
 
-func (s *productService) GetTraderProducts(ctx context.Context, traderID uuid.UUID, page, pageSize int) ([]*models.Product, int, error) {
+func (s *productService) ListSellerProducts(ctx context.Context, sellerID uuid.UUID, filter repository.ProductFilter, page pagination.Params) (pagination.Page[*models.Product], error) {
+	filter.SellerID = &sellerID
+
 	// Get total count
-	total, err := s.productRepo.CountByTrader(ctx, traderID)
+	total, err := s.productRepo.Count(ctx, filter)
 	if err != nil {
-		return nil, 0, err
-	}
-
-	// Calculate offset
-	offset := (page - 1) * pageSize
-	if offset < 0 {
-		offset = 0
+		return pagination.Page[*models.Product]{}, err
 	}
 
 	// Get products
-	products, err := s.productRepo.GetByTrader(ctx, traderID, pageSize, offset)
+	products, err := s.productRepo.ListPage(ctx, filter, page.Normalize())
 	if err != nil {
-		return nil, 0, err
+		return pagination.Page[*models.Product]{}, err
 	}
 
-	return products, total, nil
+	return products.WithTotal(total), nil
 }
 
 func (s *productService) GetProductByID(ctx context.Context, productID uuid.UUID) (*models.Product, error) {
@@ -151,3 +223,206 @@ func (s *productService) GetProductByID(ctx context.Context, productID uuid.UUID
 
 	return product, nil
 }
+
+func (s *productService) AddVariant(ctx context.Context, productID, sellerID uuid.UUID, req *models.ProductVariantRequest) (*models.ProductVariant, error) {
+	product, err := s.ownedProduct(ctx, productID, sellerID)
+	if err != nil {
+		return nil, err
+	}
+
+	variant := newVariant(*req, sellerID)
+	variant.ProductID = product.ID
+	if variant.SKU == "" {
+		variant.SKU = variant.DefaultSKU()
+	}
+	if err := ValidateVariant(&variant, product.Variants); err != nil {
+		return nil, err
+	}
+
+	if err := s.productRepo.CreateVariant(ctx, &variant); err != nil {
+		return nil, err
+	}
+	s.stockChanged(ctx, productID)
+
+	return &variant, nil
+}
+
+func (s *productService) UpdateVariant(ctx context.Context, productID, variantID, sellerID uuid.UUID, req *models.UpdateProductVariantRequest) (*models.ProductVariant, error) {
+	product, err := s.ownedProduct(ctx, productID, sellerID)
+	if err != nil {
+		return nil, err
+	}
+
+	existing, ok := product.Variant(variantID)
+	if !ok {
+		return nil, ErrVariantNotFound
+	}
+	variant := *existing
+
+	if req.SKU != nil {
+		variant.SKU = strings.TrimSpace(*req.SKU)
+	}
+	if req.PackSize != nil {
+		variant.PackSize = *req.PackSize
+	}
+	if req.Unit != nil {
+		variant.Unit = *req.Unit
+	}
+	if req.PriceCents != nil {
+		variant.PriceCents = *req.PriceCents
+	}
+	if req.Stock != nil {
+		variant.Stock = *req.Stock
+		variant.StockChange = stockChange(req.StockReason, sellerID)
+	}
+	if req.Barcode != nil {
+		variant.Barcode = normaliseBarcode(req.Barcode)
+	}
+	if req.IsActive != nil {
+		variant.IsActive = *req.IsActive
+	}
+	if variant.SKU == "" {
+		variant.SKU = variant.DefaultSKU()
+	}
+
+	others := make([]models.ProductVariant, 0, len(product.Variants))
+	for _, v := range product.Variants {
+		if v.ID != variantID {
+			others = append(others, v)
+		}
+	}
+	if err := ValidateVariant(&variant, others); err != nil {
+		return nil, err
+	}
+
+	if err := s.productRepo.UpdateVariant(ctx, &variant); err != nil {
+		return nil, err
+	}
+	s.stockChanged(ctx, productID)
+
+	return &variant, nil
+}
+
+func (s *productService) DeleteVariant(ctx context.Context, productID, variantID, sellerID uuid.UUID) error {
+	product, err := s.ownedProduct(ctx, productID, sellerID)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := product.Variant(variantID); !ok {
+		return ErrVariantNotFound
+	}
+	if len(product.Variants) == 1 {
+		return ErrLastVariant
+	}
+
+	if err := s.productRepo.DeleteVariant(ctx, productID, variantID); err != nil {
+		return err
+	}
+	s.stockChanged(ctx, productID)
+	return nil
+}
+
+// ownedProduct loads a product and checks it belongs to sellerID
+func (s *productService) ownedProduct(ctx context.Context, productID, sellerID uuid.UUID) (*models.Product, error) {
+	product, err := s.productRepo.GetByID(ctx, productID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	if product.SellerID != sellerID {
+		return nil, ErrProductUnauthorized
+	}
+
+	return product, nil
+}
+
+func newVariant(req models.ProductVariantRequest, sellerID uuid.UUID) models.ProductVariant {
+	return models.ProductVariant{
+		SKU:         strings.TrimSpace(req.SKU),
+		PackSize:    req.PackSize,
+		Unit:        req.Unit,
+		PriceCents:  req.PriceCents,
+		Stock:       req.Stock,
+		Barcode:     normaliseBarcode(req.Barcode),
+		IsActive:    true,
+		StockChange: stockChange(req.StockReason, sellerID),
+	}
+}
+
+// stockChange is the ledger entry for stock a seller sets; without a
+// reason it is a manual adjustment
+func stockChange(reason models.StockReason, sellerID uuid.UUID) *models.StockChange {
+	if reason == "" {
+		reason = models.StockAdjustment
+	}
+	return &models.StockChange{Reason: reason, ActorID: &sellerID}
+}
+
+// normaliseBarcode trims the barcode; an empty barcode clears it
+func normaliseBarcode(barcode *string) *string {
+	if barcode == nil {
+		return nil
+	}
+	trimmed := strings.TrimSpace(*barcode)
+	if trimmed == "" {
+		return nil
+	}
+	return &trimmed
+}
+
+// ValidateVariant checks a variant against the product's other variants
+func ValidateVariant(v *models.ProductVariant, others []models.ProductVariant) error {
+	switch {
+	case !v.Unit.IsValid():
+		return fmt.Errorf("%w: unknown unit %q", ErrInvalidProduct, v.Unit)
+	case v.PackSize.Sign() <= 0:
+		return fmt.Errorf("%w: pack size must be greater than zero", ErrInvalidProduct)
+	case v.PriceCents <= 0:
+		return fmt.Errorf("%w: variant price must be greater than zero", ErrInvalidProduct)
+	case v.Stock < 0:
+		return fmt.Errorf("%w: variant stock cannot be negative", ErrInvalidProduct)
+	case len(v.SKU) > 64:
+		return fmt.Errorf("%w: SKU must be at most 64 characters", ErrInvalidProduct)
+	case v.Barcode != nil && !models.ValidBarcode(*v.Barcode):
+		return fmt.Errorf("%w: barcode must be a valid GTIN-8, GTIN-12, GTIN-13 or GTIN-14", ErrInvalidProduct)
+	}
+	for _, other := range others {
+		if v.SKU != "" && strings.EqualFold(other.SKU, v.SKU) {
+			return ErrDuplicateSKU
+		}
+	}
+	return nil
+}
+
+// ValidateProduct checks a catalogue record before it is written
+func ValidateProduct(p *models.Product) error {
+	switch {
+	case len(p.Title) < 3 || len(p.Title) > 255:
+		return fmt.Errorf("%w: title must be between 3 and 255 characters", ErrInvalidProduct)
+	case len(p.Description) < 10:
+		return fmt.Errorf("%w: description must be at least 10 characters", ErrInvalidProduct)
+	case p.PriceCents <= 0:
+		return fmt.Errorf("%w: price must be greater than zero", ErrInvalidProduct)
+	case len(p.Currency) != 3:
+		return fmt.Errorf("%w: currency must be a three-letter code", ErrInvalidProduct)
+	case p.Stock < 0:
+		return fmt.Errorf("%w: stock cannot be negative", ErrInvalidProduct)
+	case p.ReorderThreshold != nil && *p.ReorderThreshold < 0:
+		return fmt.Errorf("%w: reorder threshold cannot be negative", ErrInvalidProduct)
+	case !p.Category.IsValid():
+		return fmt.Errorf("%w: unknown category %q", ErrInvalidProduct, p.Category)
+	}
+	for _, image := range p.Images {
+		if strings.TrimSpace(image) == "" {
+			return fmt.Errorf("%w: image URLs cannot be empty", ErrInvalidProduct)
+		}
+		if _, ok := models.ParseMediaRef(image); !ok && strings.HasPrefix(image, "media:") {
+			return fmt.Errorf("%w: invalid media reference %q", ErrInvalidProduct, image)
+		}
+	}
+	return nil
+}
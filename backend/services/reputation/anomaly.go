@@ -0,0 +1,189 @@
+package reputation
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Reasons a review can be held for moderation
+const (
+	ReasonReviewVelocity    = "review_velocity"
+	ReasonNewAccountCluster = "new_account_cluster"
+	ReasonSharedIPCluster   = "shared_ip_cluster"
+	ReasonSharedIPSeller    = "shared_ip_with_seller"
+)
+
+// AnomalyConfig holds the thresholds used to flag suspicious reviews
+type AnomalyConfig struct {
+	// VelocityWindow is the recent window compared against the seller's baseline
+	VelocityWindow time.Duration
+	// BaselineWindow is the history used to estimate the seller's normal review rate
+	BaselineWindow time.Duration
+	// VelocityMinReviews is the minimum burst size before velocity is considered
+	VelocityMinReviews int
+	// VelocityMultiplier is how far above baseline a burst must be
+	VelocityMultiplier float64
+	// NewAccountAge is the age below which a reviewer account counts as new
+	NewAccountAge time.Duration
+	// NewAccountClusterSize is how many new-account reviews in the velocity window form a cluster
+	NewAccountClusterSize int
+	// IPLookback is how far back activity logs are searched for shared IPs
+	IPLookback time.Duration
+	// SharedIPReviewers is how many other reviewers sharing an IP form a cluster
+	SharedIPReviewers int
+}
+
+// ReviewSignals are the facts about a new review used for anomaly detection
+type ReviewSignals struct {
+	RecentReviews          int           `json:"recent_reviews"`
+	BaselineReviews        int           `json:"baseline_reviews"`
+	ReviewerAccountAge     time.Duration `json:"reviewer_account_age"`
+	RecentNewAccounts      int           `json:"recent_new_accounts"`
+	SharedIPReviewers      int           `json:"shared_ip_reviewers"`
+	ReviewerSharesSellerIP bool          `json:"reviewer_shares_seller_ip"`
+}
+
+// AnomalyDetector flags reviews that look like review bombing or manipulation
+type AnomalyDetector struct {
+	db     *sql.DB
+	config AnomalyConfig
+}
+
+// DefaultAnomalyConfig returns the default detection thresholds
+func DefaultAnomalyConfig() AnomalyConfig {
+	return AnomalyConfig{
+		VelocityWindow:        24 * time.Hour,
+		BaselineWindow:        30 * 24 * time.Hour,
+		VelocityMinReviews:    5,
+		VelocityMultiplier:    4,
+		NewAccountAge:         7 * 24 * time.Hour,
+		NewAccountClusterSize: 3,
+		IPLookback:            30 * 24 * time.Hour,
+		SharedIPReviewers:     2,
+	}
+}
+
+// NewAnomalyDetector creates a new anomaly detector with default thresholds
+func NewAnomalyDetector(db *sql.DB) *AnomalyDetector {
+	return &AnomalyDetector{db: db, config: DefaultAnomalyConfig()}
+}
+
+// Config returns the thresholds in use
+func (d *AnomalyDetector) Config() AnomalyConfig {
+	return d.config
+}
+
+// Check gathers signals for a review about to be created and returns the reasons to hold it
+func (d *AnomalyDetector) Check(ctx context.Context, reviewerID, sellerID uuid.UUID) ([]string, error) {
+	signals, err := d.Signals(ctx, reviewerID, sellerID)
+	if err != nil {
+		return nil, err
+	}
+	return d.config.Evaluate(signals), nil
+}
+
+// Signals loads review velocity and reviewer cluster signals from the database.
+// Counts include the review being submitted.
+func (d *AnomalyDetector) Signals(ctx context.Context, reviewerID, sellerID uuid.UUID) (ReviewSignals, error) {
+	var sig ReviewSignals
+	now := time.Now()
+	velocitySince := now.Add(-d.config.VelocityWindow)
+	baselineSince := now.Add(-d.config.BaselineWindow)
+	newAccountSince := now.Add(-d.config.NewAccountAge)
+	ipSince := now.Add(-d.config.IPLookback)
+
+	err := d.db.QueryRowContext(ctx, `
+		SELECT
+			COUNT(*) FILTER (WHERE created_at >= $2) + 1,
+			COUNT(*) FILTER (WHERE created_at >= $3 AND created_at < $2)
+		FROM reviews
+		WHERE seller_id = $1
+	`, sellerID, velocitySince, baselineSince).Scan(&sig.RecentReviews, &sig.BaselineReviews)
+	if err != nil {
+		return sig, fmt.Errorf("failed to count review velocity: %w", err)
+	}
+
+	var accountCreated time.Time
+	err = d.db.QueryRowContext(ctx, `SELECT created_at FROM users WHERE id = $1`, reviewerID).Scan(&accountCreated)
+	if err != nil {
+		return sig, fmt.Errorf("failed to load reviewer account: %w", err)
+	}
+	sig.ReviewerAccountAge = now.Sub(accountCreated)
+
+	err = d.db.QueryRowContext(ctx, `
+		SELECT COUNT(DISTINCT r.buyer_id)
+		FROM reviews r
+		JOIN users u ON u.id = r.buyer_id
+		WHERE r.seller_id = $1 AND r.created_at >= $2 AND u.created_at >= $3
+	`, sellerID, velocitySince, newAccountSince).Scan(&sig.RecentNewAccounts)
+	if err != nil {
+		return sig, fmt.Errorf("failed to count new account reviewers: %w", err)
+	}
+	if sig.ReviewerAccountAge < d.config.NewAccountAge {
+		sig.RecentNewAccounts++
+	}
+
+	err = d.db.QueryRowContext(ctx, `
+		SELECT COUNT(DISTINCT r.buyer_id)
+		FROM reviews r
+		JOIN activity_logs other ON other.user_id = r.buyer_id AND other.created_at >= $3
+		JOIN activity_logs mine ON mine.user_id = $2 AND mine.created_at >= $3
+			AND mine.ip_address = other.ip_address
+		WHERE r.seller_id = $1 AND r.buyer_id <> $2
+			AND r.created_at >= $3 AND other.ip_address IS NOT NULL
+	`, sellerID, reviewerID, ipSince).Scan(&sig.SharedIPReviewers)
+	if err != nil {
+		return sig, fmt.Errorf("failed to check shared reviewer IPs: %w", err)
+	}
+
+	err = d.db.QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1
+			FROM activity_logs mine
+			JOIN activity_logs seller ON seller.ip_address = mine.ip_address
+			WHERE mine.user_id = $1 AND seller.user_id = $2
+				AND mine.created_at >= $3 AND seller.created_at >= $3
+				AND mine.ip_address IS NOT NULL
+		)
+	`, reviewerID, sellerID, ipSince).Scan(&sig.ReviewerSharesSellerIP)
+	if err != nil {
+		return sig, fmt.Errorf("failed to check seller IP overlap: %w", err)
+	}
+
+	return sig, nil
+}
+
+// Evaluate returns the reasons, if any, that the signals look suspicious
+func (c AnomalyConfig) Evaluate(sig ReviewSignals) []string {
+	var reasons []string
+
+	// Compare the recent burst with the seller's normal rate over an equal-length window
+	if sig.RecentReviews >= c.VelocityMinReviews {
+		baselineSpan := c.BaselineWindow - c.VelocityWindow
+		expected := 0.0
+		if baselineSpan > 0 {
+			expected = float64(sig.BaselineReviews) * float64(c.VelocityWindow) / float64(baselineSpan)
+		}
+		if float64(sig.RecentReviews) > expected*c.VelocityMultiplier {
+			reasons = append(reasons, ReasonReviewVelocity)
+		}
+	}
+
+	if sig.ReviewerAccountAge < c.NewAccountAge && sig.RecentNewAccounts >= c.NewAccountClusterSize {
+		reasons = append(reasons, ReasonNewAccountCluster)
+	}
+
+	if sig.SharedIPReviewers >= c.SharedIPReviewers {
+		reasons = append(reasons, ReasonSharedIPCluster)
+	}
+
+	if sig.ReviewerSharesSellerIP {
+		reasons = append(reasons, ReasonSharedIPSeller)
+	}
+
+	return reasons
+}
@@ -0,0 +1,61 @@
+package reputation
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnomalyEvaluate(t *testing.T) {
+	cfg := DefaultAnomalyConfig()
+	established := 90 * 24 * time.Hour
+
+	tests := []struct {
+		name    string
+		signals ReviewSignals
+		want    []string
+	}{
+		{
+			name:    "normal review",
+			signals: ReviewSignals{RecentReviews: 1, BaselineReviews: 20, ReviewerAccountAge: established},
+			want:    nil,
+		},
+		{
+			name:    "burst on a quiet seller",
+			signals: ReviewSignals{RecentReviews: 8, BaselineReviews: 10, ReviewerAccountAge: established},
+			want:    []string{ReasonReviewVelocity},
+		},
+		{
+			name:    "busy seller with a normal day",
+			signals: ReviewSignals{RecentReviews: 12, BaselineReviews: 290, ReviewerAccountAge: established},
+			want:    nil,
+		},
+		{
+			name:    "single new account is allowed",
+			signals: ReviewSignals{RecentReviews: 1, ReviewerAccountAge: time.Hour, RecentNewAccounts: 1},
+			want:    nil,
+		},
+		{
+			name:    "cluster of new accounts",
+			signals: ReviewSignals{RecentReviews: 3, ReviewerAccountAge: time.Hour, RecentNewAccounts: 3},
+			want:    []string{ReasonNewAccountCluster},
+		},
+		{
+			name:    "reviewers sharing IPs",
+			signals: ReviewSignals{RecentReviews: 1, BaselineReviews: 30, ReviewerAccountAge: established, SharedIPReviewers: 2},
+			want:    []string{ReasonSharedIPCluster},
+		},
+		{
+			name:    "reviewer shares IP with seller",
+			signals: ReviewSignals{RecentReviews: 1, BaselineReviews: 30, ReviewerAccountAge: established, ReviewerSharesSellerIP: true},
+			want:    []string{ReasonSharedIPSeller},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.want, cfg.Evaluate(test.signals))
+		})
+	}
+}
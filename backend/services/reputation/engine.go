@@ -0,0 +1,372 @@
+package reputation
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Engine is the single place reputation scores are computed and stored
+type Engine struct {
+	db  *sql.DB
+	now func() time.Time
+}
+
+// ScoreDiff compares a seller's score under the active and a candidate model
+type ScoreDiff struct {
+	SellerID       uuid.UUID `json:"seller_id"`
+	CurrentScore   float64   `json:"current_score"`
+	CandidateScore float64   `json:"candidate_score"`
+	Delta          float64   `json:"delta"`
+}
+
+// DryRunReport summarises the impact of rolling out a candidate model
+type DryRunReport struct {
+	ActiveVersion    string      `json:"active_version"`
+	CandidateVersion string      `json:"candidate_version"`
+	SellersEvaluated int         `json:"sellers_evaluated"`
+	Improved         int         `json:"improved"`
+	Declined         int         `json:"declined"`
+	Unchanged        int         `json:"unchanged"`
+	MeanDelta        float64     `json:"mean_delta"`
+	MaxAbsDelta      float64     `json:"max_abs_delta"`
+	Diffs            []ScoreDiff `json:"diffs"`
+}
+
+// NewEngine creates a new reputation engine
+func NewEngine(db *sql.DB) *Engine {
+	return &Engine{db: db, now: time.Now}
+}
+
+// ActiveModel returns the currently active model, falling back to the built-in default
+func (e *Engine) ActiveModel(ctx context.Context) (Model, error) {
+	query := `
+		SELECT version, description, weights, active, created_at
+		FROM reputation_models
+		WHERE active = true
+		ORDER BY created_at DESC
+		LIMIT 1
+	`
+
+	m, err := e.scanModel(e.db.QueryRowContext(ctx, query))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return DefaultModel(), nil
+		}
+		return Model{}, fmt.Errorf("failed to load active reputation model: %w", err)
+	}
+
+	return m, nil
+}
+
+// GetModel returns a stored model by version
+func (e *Engine) GetModel(ctx context.Context, version string) (Model, error) {
+	query := `
+		SELECT version, description, weights, active, created_at
+		FROM reputation_models
+		WHERE version = $1
+	`
+
+	m, err := e.scanModel(e.db.QueryRowContext(ctx, query, version))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return Model{}, fmt.Errorf("reputation model %s not found", version)
+		}
+		return Model{}, fmt.Errorf("failed to load reputation model: %w", err)
+	}
+
+	return m, nil
+}
+
+// ListModels returns all stored models, newest first
+func (e *Engine) ListModels(ctx context.Context) ([]Model, error) {
+	rows, err := e.db.QueryContext(ctx, `
+		SELECT version, description, weights, active, created_at
+		FROM reputation_models
+		ORDER BY created_at DESC
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query reputation models: %w", err)
+	}
+	defer rows.Close()
+
+	var models []Model
+	for rows.Next() {
+		m, err := e.scanModel(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan reputation model: %w", err)
+		}
+		models = append(models, m)
+	}
+
+	return models, rows.Err()
+}
+
+// SaveModel stores a new inactive candidate model
+func (e *Engine) SaveModel(ctx context.Context, m Model) (Model, error) {
+	if err := m.Validate(); err != nil {
+		return Model{}, err
+	}
+
+	weightsJSON, err := json.Marshal(m.Weights)
+	if err != nil {
+		return Model{}, fmt.Errorf("failed to marshal weights: %w", err)
+	}
+
+	err = e.db.QueryRowContext(ctx, `
+		INSERT INTO reputation_models (version, description, weights, active)
+		VALUES ($1, $2, $3, false)
+		RETURNING created_at
+	`, m.Version, m.Description, weightsJSON).Scan(&m.CreatedAt)
+	if err != nil {
+		return Model{}, fmt.Errorf("failed to save reputation model: %w", err)
+	}
+
+	m.Active = false
+	return m, nil
+}
+
+// ActivateModel makes the given version the active model
+func (e *Engine) ActivateModel(ctx context.Context, version string) error {
+	tx, err := e.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `UPDATE reputation_models SET active = false WHERE active = true`); err != nil {
+		return fmt.Errorf("failed to deactivate current model: %w", err)
+	}
+
+	result, err := tx.ExecContext(ctx, `UPDATE reputation_models SET active = true WHERE version = $1`, version)
+	if err != nil {
+		return fmt.Errorf("failed to activate model: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("reputation model %s not found", version)
+	}
+
+	return tx.Commit()
+}
+
+// LoadInputs gathers the signals used to score a seller
+func (e *Engine) LoadInputs(ctx context.Context, sellerID uuid.UUID) (Inputs, error) {
+	var in Inputs
+
+	// Only published reviews count; held, hidden and rejected reviews are excluded
+	rows, err := e.db.QueryContext(ctx, `
+		SELECT rating, COALESCE(created_at, NOW()) FROM reviews
+		WHERE seller_id = $1 AND rating IS NOT NULL AND status = 'published'
+	`, sellerID)
+	if err != nil {
+		return in, fmt.Errorf("failed to query ratings: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var r RatingInput
+		if err := rows.Scan(&r.Stars, &r.CreatedAt); err != nil {
+			return in, fmt.Errorf("failed to scan rating: %w", err)
+		}
+		in.Ratings = append(in.Ratings, r)
+	}
+	if err := rows.Err(); err != nil {
+		return in, fmt.Errorf("failed to read ratings: %w", err)
+	}
+
+	err = e.db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM orders
+		WHERE seller_id = $1 AND status IN ('completed', 'delivered')
+	`, sellerID).Scan(&in.CompletedOrders)
+	if err != nil {
+		return in, fmt.Errorf("failed to count completed orders: %w", err)
+	}
+
+	disputeRows, err := e.db.QueryContext(ctx, `
+		SELECT created_at FROM disputes
+		WHERE seller_id = $1 AND status IN ('RESOLVED_BUYER', 'ESCALATED')
+	`, sellerID)
+	if err != nil {
+		return in, fmt.Errorf("failed to query disputes: %w", err)
+	}
+	defer disputeRows.Close()
+
+	for disputeRows.Next() {
+		var at time.Time
+		if err := disputeRows.Scan(&at); err != nil {
+			return in, fmt.Errorf("failed to scan dispute: %w", err)
+		}
+		in.LostDisputes = append(in.LostDisputes, at)
+	}
+	if err := disputeRows.Err(); err != nil {
+		return in, fmt.Errorf("failed to read disputes: %w", err)
+	}
+
+	// Expired verifications no longer earn the bonus, even before the expiry sweep runs
+	err = e.db.QueryRowContext(ctx, `
+		SELECT COALESCE(
+			(SELECT CASE WHEN verification_expires_at IS NULL OR verification_expires_at > NOW()
+			             THEN verification_level ELSE 'none' END
+			 FROM sellers WHERE user_id = $1),
+			(SELECT CASE WHEN verified THEN 'identity' ELSE 'none' END FROM users WHERE id = $1),
+			'none'
+		)
+	`, sellerID).Scan(&in.VerificationLevel)
+	if err != nil {
+		return in, fmt.Errorf("failed to load verification status: %w", err)
+	}
+
+	return in, nil
+}
+
+// Compute scores a seller under the active model
+func (e *Engine) Compute(ctx context.Context, sellerID uuid.UUID) (ReputationBreakdown, error) {
+	model, err := e.ActiveModel(ctx)
+	if err != nil {
+		return ReputationBreakdown{}, err
+	}
+	return e.ComputeWith(ctx, model, sellerID)
+}
+
+// ComputeWith scores a seller under an explicit model
+func (e *Engine) ComputeWith(ctx context.Context, model Model, sellerID uuid.UUID) (ReputationBreakdown, error) {
+	in, err := e.LoadInputs(ctx, sellerID)
+	if err != nil {
+		return ReputationBreakdown{}, err
+	}
+	return model.Score(in, e.now()), nil
+}
+
+// Record computes a seller's score under the active model and appends it to history
+func (e *Engine) Record(ctx context.Context, sellerID uuid.UUID, reason string) (ReputationBreakdown, error) {
+	breakdown, err := e.Compute(ctx, sellerID)
+	if err != nil {
+		return ReputationBreakdown{}, fmt.Errorf("failed to compute reputation: %w", err)
+	}
+
+	breakdownJSON, err := json.Marshal(breakdown)
+	if err != nil {
+		return ReputationBreakdown{}, fmt.Errorf("failed to marshal breakdown: %w", err)
+	}
+
+	_, err = e.db.ExecContext(ctx, `
+		INSERT INTO reputation_history (user_id, score, reason, metadata, model_version)
+		VALUES ($1, $2, $3, $4, $5)
+	`, sellerID, breakdown.CalculatedScore, reason, breakdownJSON, breakdown.ModelVersion)
+	if err != nil {
+		return ReputationBreakdown{}, fmt.Errorf("failed to insert reputation history: %w", err)
+	}
+
+	return breakdown, nil
+}
+
+// DryRun recomputes every seller under a candidate model without storing anything
+func (e *Engine) DryRun(ctx context.Context, candidate Model) (*DryRunReport, error) {
+	if err := candidate.Validate(); err != nil {
+		return nil, err
+	}
+
+	active, err := e.ActiveModel(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	sellerIDs, err := e.sellerIDs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &DryRunReport{
+		ActiveVersion:    active.Version,
+		CandidateVersion: candidate.Version,
+		Diffs:            make([]ScoreDiff, 0, len(sellerIDs)),
+	}
+
+	now := e.now()
+	var totalDelta float64
+	for _, sellerID := range sellerIDs {
+		in, err := e.LoadInputs(ctx, sellerID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load inputs for seller %s: %w", sellerID, err)
+		}
+
+		diff := ScoreDiff{
+			SellerID:       sellerID,
+			CurrentScore:   active.Score(in, now).CalculatedScore,
+			CandidateScore: candidate.Score(in, now).CalculatedScore,
+		}
+		diff.Delta = round2(diff.CandidateScore - diff.CurrentScore)
+
+		switch {
+		case diff.Delta > 0:
+			report.Improved++
+		case diff.Delta < 0:
+			report.Declined++
+		default:
+			report.Unchanged++
+		}
+
+		totalDelta += diff.Delta
+		report.MaxAbsDelta = math.Max(report.MaxAbsDelta, math.Abs(diff.Delta))
+		report.Diffs = append(report.Diffs, diff)
+	}
+
+	report.SellersEvaluated = len(report.Diffs)
+	if report.SellersEvaluated > 0 {
+		report.MeanDelta = round2(totalDelta / float64(report.SellersEvaluated))
+	}
+
+	return report, nil
+}
+
+// sellerIDs returns every user that can hold a seller reputation
+func (e *Engine) sellerIDs(ctx context.Context) ([]uuid.UUID, error) {
+	rows, err := e.db.QueryContext(ctx, `
+		SELECT id FROM users WHERE role IN ('trader', 'seller') ORDER BY id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sellers: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan seller: %w", err)
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func (e *Engine) scanModel(row rowScanner) (Model, error) {
+	var m Model
+	var description sql.NullString
+	var weightsJSON []byte
+
+	if err := row.Scan(&m.Version, &description, &weightsJSON, &m.Active, &m.CreatedAt); err != nil {
+		return Model{}, err
+	}
+	m.Description = description.String
+
+	// Start from defaults so older rows missing newer weights still score sensibly
+	m.Weights = DefaultModel().Weights
+	if len(weightsJSON) > 0 {
+		if err := json.Unmarshal(weightsJSON, &m.Weights); err != nil {
+			return Model{}, fmt.Errorf("invalid weights for model %s: %w", m.Version, err)
+		}
+	}
+
+	return m, nil
+}
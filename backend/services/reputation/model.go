@@ -0,0 +1,191 @@
+package reputation
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/Andrew-mugwe/agroai/models"
+)
+
+// DefaultModelVersion is the version used when no model has been activated yet
+const DefaultModelVersion = "v1"
+
+// Model describes a versioned set of reputation weights
+type Model struct {
+	Version     string    `json:"version"`
+	Description string    `json:"description,omitempty"`
+	Weights     Weights   `json:"weights"`
+	Active      bool      `json:"active"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Weights holds the configurable components of a reputation model
+type Weights struct {
+	BaseScore         float64 `json:"base_score"`
+	NeutralRating     float64 `json:"neutral_rating"`
+	RatingWeight      float64 `json:"rating_weight"`
+	OrderWeight       float64 `json:"order_weight"`
+	OrderCap          float64 `json:"order_cap"`
+	DisputePenalty    float64 `json:"dispute_penalty"`
+	DisputeWindowDays int     `json:"dispute_window_days"`
+	VerifiedBonus     float64 `json:"verified_bonus"`
+	// BusinessVerifiedBonus is added on top of VerifiedBonus for business-verified sellers
+	BusinessVerifiedBonus float64 `json:"business_verified_bonus"`
+	// RecencyHalfLifeDays halves the weight of a rating every N days; 0 disables decay
+	RecencyHalfLifeDays float64 `json:"recency_half_life_days"`
+	// PriorMean and PriorWeight smooth the average towards PriorMean as if
+	// PriorWeight extra ratings had been received; a weight of 0 uses the raw average
+	PriorMean   float64 `json:"prior_mean"`
+	PriorWeight float64 `json:"prior_weight"`
+}
+
+// Prior is the pseudo-evidence a Bayesian average starts from
+type Prior struct {
+	Mean   float64 `json:"mean"`
+	Weight float64 `json:"weight"`
+}
+
+// Prior returns the rating prior configured on the model
+func (w Weights) Prior() Prior {
+	return Prior{Mean: w.PriorMean, Weight: w.PriorWeight}
+}
+
+// BayesianAverage smooths an average of count ratings summing to sum towards the prior
+func BayesianAverage(sum, count float64, prior Prior) float64 {
+	if prior.Weight <= 0 {
+		if count == 0 {
+			return 0
+		}
+		return sum / count
+	}
+	return (prior.Mean*prior.Weight + sum) / (prior.Weight + count)
+}
+
+// RatingInput is a single star rating used as engine input
+type RatingInput struct {
+	Stars     int       `json:"stars"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Inputs holds the raw seller signals a model is evaluated against
+type Inputs struct {
+	Ratings         []RatingInput `json:"ratings"`
+	CompletedOrders int           `json:"completed_orders"`
+	LostDisputes    []time.Time   `json:"lost_disputes"`
+	// VerificationLevel is the seller's current, unexpired KYC level
+	VerificationLevel models.VerificationLevel `json:"verification_level"`
+}
+
+// DefaultModel returns the built-in model matching the original SQL scoring
+func DefaultModel() Model {
+	return Model{
+		Version:     DefaultModelVersion,
+		Description: "Baseline model ported from calculate_reputation_score",
+		Weights: Weights{
+			BaseScore:         50,
+			NeutralRating:     3,
+			RatingWeight:      10,
+			OrderWeight:       0.5,
+			OrderCap:          15,
+			DisputePenalty:    2,
+			DisputeWindowDays: 180,
+			VerifiedBonus:     10,
+		},
+		Active: true,
+	}
+}
+
+// Validate checks that a model is usable for scoring
+func (m Model) Validate() error {
+	if m.Version == "" {
+		return fmt.Errorf("model version is required")
+	}
+
+	w := m.Weights
+	if w.NeutralRating < 1 || w.NeutralRating > 5 {
+		return fmt.Errorf("neutral_rating must be between 1 and 5")
+	}
+	if w.RatingWeight < 0 || w.OrderWeight < 0 || w.OrderCap < 0 || w.DisputePenalty < 0 || w.VerifiedBonus < 0 ||
+		w.BusinessVerifiedBonus < 0 {
+		return fmt.Errorf("weights must not be negative")
+	}
+	if w.DisputeWindowDays < 0 || w.RecencyHalfLifeDays < 0 {
+		return fmt.Errorf("windows must not be negative")
+	}
+	if w.PriorWeight < 0 {
+		return fmt.Errorf("prior_weight must not be negative")
+	}
+	if w.PriorWeight > 0 && (w.PriorMean < 1 || w.PriorMean > 5) {
+		return fmt.Errorf("prior_mean must be between 1 and 5")
+	}
+
+	return nil
+}
+
+// Score evaluates the model against seller inputs at the given point in time
+func (m Model) Score(in Inputs, now time.Time) ReputationBreakdown {
+	w := m.Weights
+
+	breakdown := ReputationBreakdown{
+		BaseScore:    w.BaseScore,
+		TotalRatings: len(in.Ratings),
+		TotalOrders:  in.CompletedOrders,
+		ModelVersion: m.Version,
+	}
+
+	// Rating component uses a recency-weighted, prior-smoothed average around the neutral rating
+	if avg, ok := m.weightedAverage(in.Ratings, now); ok {
+		breakdown.RatingContrib = round2((avg - w.NeutralRating) * w.RatingWeight)
+	}
+
+	// Orders component is linear up to the cap
+	breakdown.OrdersContrib = round2(math.Min(float64(in.CompletedOrders)*w.OrderWeight, w.OrderCap))
+
+	// Disputes penalty only counts disputes inside the window
+	cutoff := now.AddDate(0, 0, -w.DisputeWindowDays)
+	for _, at := range in.LostDisputes {
+		if w.DisputeWindowDays == 0 || !at.Before(cutoff) {
+			breakdown.TotalDisputes++
+		}
+	}
+	breakdown.DisputesPenalty = round2(-float64(breakdown.TotalDisputes) * w.DisputePenalty)
+
+	if in.VerificationLevel.AtLeast(models.VerificationLevelIdentity) {
+		breakdown.VerifiedBonus = w.VerifiedBonus
+	}
+	if in.VerificationLevel.AtLeast(models.VerificationLevelBusiness) {
+		breakdown.VerifiedBonus += w.BusinessVerifiedBonus
+	}
+
+	score := breakdown.BaseScore + breakdown.RatingContrib + breakdown.OrdersContrib +
+		breakdown.DisputesPenalty + breakdown.VerifiedBonus
+	breakdown.CalculatedScore = round2(math.Max(0, math.Min(100, score)))
+
+	return breakdown
+}
+
+// weightedAverage returns the decayed, prior-smoothed average star rating, if any ratings exist
+func (m Model) weightedAverage(ratings []RatingInput, now time.Time) (float64, bool) {
+	var sum, weight float64
+	for _, r := range ratings {
+		wt := 1.0
+		if m.Weights.RecencyHalfLifeDays > 0 {
+			ageDays := now.Sub(r.CreatedAt).Hours() / 24
+			if ageDays > 0 {
+				wt = math.Pow(0.5, ageDays/m.Weights.RecencyHalfLifeDays)
+			}
+		}
+		sum += float64(r.Stars) * wt
+		weight += wt
+	}
+
+	if weight == 0 {
+		return 0, false
+	}
+	return BayesianAverage(sum, weight, m.Weights.Prior()), true
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
@@ -1,6 +1,7 @@
 package reputation
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
@@ -11,28 +12,33 @@ import (
 
 // ReputationService handles reputation calculations and management
 type ReputationService struct {
-	db *sql.DB
+	db     *sql.DB
+	engine *Engine
 }
 
 // ReputationBreakdown represents the components of a reputation score
 type ReputationBreakdown struct {
+	BaseScore       float64 `json:"base_score"`
 	RatingContrib   float64 `json:"rating_contrib"`
 	OrdersContrib   float64 `json:"orders_contrib"`
 	DisputesPenalty float64 `json:"disputes_penalty"`
 	VerifiedBonus   float64 `json:"verified_bonus"`
 	TotalRatings    int     `json:"total_ratings"`
 	TotalOrders     int     `json:"total_orders"`
+	TotalDisputes   int     `json:"total_disputes"`
 	CalculatedScore float64 `json:"calculated_score"`
+	ModelVersion    string  `json:"model_version"`
 }
 
 // ReputationHistory represents a historical reputation entry
 type ReputationHistory struct {
-	ID        int             `json:"id"`
-	UserID    uuid.UUID       `json:"user_id"`
-	Score     float64         `json:"score"`
-	Reason    string          `json:"reason"`
-	Metadata  json.RawMessage `json:"metadata"`
-	CreatedAt time.Time       `json:"created_at"`
+	ID           int             `json:"id"`
+	UserID       uuid.UUID       `json:"user_id"`
+	Score        float64         `json:"score"`
+	Reason       string          `json:"reason"`
+	Metadata     json.RawMessage `json:"metadata"`
+	ModelVersion string          `json:"model_version,omitempty"`
+	CreatedAt    time.Time       `json:"created_at"`
 }
 
 // SellerReputation represents current reputation for a seller
@@ -54,61 +60,30 @@ type SellerReputation struct {
 
 // Rating represents a single rating/review
 type Rating struct {
-	ID         int       `json:"id"`
-	OrderID    int       `json:"order_id"`
-	ReviewerID uuid.UUID `json:"reviewer_id"`
-	SellerID   uuid.UUID `json:"seller_id"`
-	Rating     int       `json:"rating"`
-	Review     string    `json:"review"`
-	CreatedAt  time.Time `json:"created_at"`
+	ID               uuid.UUID  `json:"id"`
+	OrderID          *uuid.UUID `json:"order_id,omitempty"`
+	ReviewerID       uuid.UUID  `json:"reviewer_id"`
+	SellerID         uuid.UUID  `json:"seller_id"`
+	Rating           int        `json:"rating"`
+	Review           string     `json:"review"`
+	VerifiedPurchase bool       `json:"verified_purchase"`
+	CreatedAt        time.Time  `json:"created_at"`
 }
 
 // NewReputationService creates a new reputation service
 func NewReputationService(db *sql.DB) *ReputationService {
-	return &ReputationService{db: db}
+	return &ReputationService{db: db, engine: NewEngine(db)}
 }
 
-// ComputeReputation calculates the reputation score for a user
-func (rs *ReputationService) ComputeReputation(userID uuid.UUID) (float64, ReputationBreakdown, error) {
-	var breakdown ReputationBreakdown
-
-	// Get reputation breakdown from database view
-	query := `
-		SELECT 
-			rating_contrib,
-			orders_contrib,
-			disputes_penalty,
-			verified_bonus,
-			total_ratings,
-			total_orders,
-			calculated_score
-		FROM reputation_breakdown 
-		WHERE user_id = $1
-	`
-
-	err := rs.db.QueryRow(query, userID).Scan(
-		&breakdown.RatingContrib,
-		&breakdown.OrdersContrib,
-		&breakdown.DisputesPenalty,
-		&breakdown.VerifiedBonus,
-		&breakdown.TotalRatings,
-		&breakdown.TotalOrders,
-		&breakdown.CalculatedScore,
-	)
+// Engine exposes the underlying scoring engine
+func (rs *ReputationService) Engine() *Engine {
+	return rs.engine
+}
 
+// ComputeReputation calculates the reputation score for a user under the active model
+func (rs *ReputationService) ComputeReputation(userID uuid.UUID) (float64, ReputationBreakdown, error) {
+	breakdown, err := rs.engine.Compute(context.Background(), userID)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			// User has no ratings yet, return default score
-			return 50.0, ReputationBreakdown{
-				RatingContrib:   0,
-				OrdersContrib:   0,
-				DisputesPenalty: 0,
-				VerifiedBonus:   0,
-				TotalRatings:    0,
-				TotalOrders:     0,
-				CalculatedScore: 50.0,
-			}, nil
-		}
 		return 0, ReputationBreakdown{}, err
 	}
 
@@ -117,39 +92,8 @@ func (rs *ReputationService) ComputeReputation(userID uuid.UUID) (float64, Reput
 
 // RecalculateReputation recalculates and stores reputation for a user
 func (rs *ReputationService) RecalculateReputation(userID uuid.UUID) error {
-	// Start transaction
-	tx, err := rs.db.Begin()
-	if err != nil {
-		return fmt.Errorf("failed to start transaction: %w", err)
-	}
-	defer tx.Rollback()
-
-	// Compute new reputation
-	score, breakdown, err := rs.ComputeReputation(userID)
-	if err != nil {
-		return fmt.Errorf("failed to compute reputation: %w", err)
-	}
-
-	// Convert breakdown to JSON
-	breakdownJSON, err := json.Marshal(breakdown)
-	if err != nil {
-		return fmt.Errorf("failed to marshal breakdown: %w", err)
-	}
-
-	// Insert into reputation history
-	insertQuery := `
-		INSERT INTO reputation_history (user_id, score, reason, metadata)
-		VALUES ($1, $2, $3, $4)
-	`
-
-	_, err = tx.Exec(insertQuery, userID, score, "Manual recalculation", breakdownJSON)
-	if err != nil {
-		return fmt.Errorf("failed to insert reputation history: %w", err)
-	}
-
-	// Commit transaction
-	if err = tx.Commit(); err != nil {
-		return fmt.Errorf("failed to commit transaction: %w", err)
+	if _, err := rs.engine.Record(context.Background(), userID, "Manual recalculation"); err != nil {
+		return err
 	}
 
 	return nil
@@ -165,7 +109,7 @@ func (rs *ReputationService) GetReputation(userID uuid.UUID) (float64, []Reputat
 
 	// Get history
 	historyQuery := `
-		SELECT id, user_id, score, reason, metadata, created_at
+		SELECT id, user_id, score, reason, metadata, COALESCE(model_version, ''), created_at
 		FROM reputation_history
 		WHERE user_id = $1
 		ORDER BY created_at DESC
@@ -189,6 +133,7 @@ func (rs *ReputationService) GetReputation(userID uuid.UUID) (float64, []Reputat
 			&h.Score,
 			&h.Reason,
 			&metadataStr,
+			&h.ModelVersion,
 			&h.CreatedAt,
 		)
 		if err != nil {
@@ -260,12 +205,14 @@ func (rs *ReputationService) GetSellerReputation(sellerID uuid.UUID) (*SellerRep
 		return nil, fmt.Errorf("failed to get reputation breakdown: %w", err)
 	}
 	reputation.Breakdown = breakdown
+	reputation.CurrentScore = breakdown.CalculatedScore
 
 	// Get recent reviews
 	reviewsQuery := `
-		SELECT r.id, r.order_id, r.reviewer_id, r.seller_id, r.rating, r.review, r.created_at
-		FROM ratings r
-		WHERE r.seller_id = $1
+		SELECT r.id, r.order_id, r.buyer_id, r.seller_id, r.rating, COALESCE(r.comment, ''),
+		       r.verified_purchase, r.created_at
+		FROM reviews r
+		WHERE r.seller_id = $1 AND r.status = 'published'
 		ORDER BY r.created_at DESC
 		LIMIT 5
 	`
@@ -285,6 +232,7 @@ func (rs *ReputationService) GetSellerReputation(sellerID uuid.UUID) (*SellerRep
 			&review.SellerID,
 			&review.Rating,
 			&review.Review,
+			&review.VerifiedPurchase,
 			&review.CreatedAt,
 		)
 		if err != nil {
@@ -366,6 +314,7 @@ func (rs *ReputationService) GetReputationReport(since time.Time) ([]SellerReput
 		_, breakdown, err := rs.ComputeReputation(reputation.SellerID)
 		if err == nil {
 			reputation.Breakdown = breakdown
+			reputation.CurrentScore = breakdown.CalculatedScore
 		}
 
 		// Generate badge
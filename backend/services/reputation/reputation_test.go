@@ -1,254 +1,187 @@
 package reputation
 
 import (
-	"database/sql"
 	"testing"
 	"time"
 
-	"github.com/google/uuid"
+	"github.com/Andrew-mugwe/agroai/models"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
-// MockDB is a simple mock database for testing
-type MockDB struct {
-	users             map[uuid.UUID]User
-	ratings           []Rating
-	orders            []Order
-	disputes          []Dispute
-	reputationHistory []ReputationHistory
-}
+var testNow = time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
 
-type User struct {
-	ID       uuid.UUID
-	Role     string
-	Verified bool
+func ratingsOf(stars ...int) []RatingInput {
+	ratings := make([]RatingInput, len(stars))
+	for i, s := range stars {
+		ratings[i] = RatingInput{Stars: s, CreatedAt: testNow.AddDate(0, 0, -i)}
+	}
+	return ratings
 }
 
-type Order struct {
-	ID       int
-	SellerID uuid.UUID
-	Status   string
-}
+func TestComputeReputation_Simple(t *testing.T) {
+	in := Inputs{
+		Ratings:           ratingsOf(4, 4, 4, 4),
+		CompletedOrders:   5,
+		VerificationLevel: models.VerificationLevelIdentity,
+	}
 
-type Dispute struct {
-	ID        int
-	SellerID  uuid.UUID
-	Status    string
-	CreatedAt time.Time
-}
+	breakdown := DefaultModel().Score(in, testNow)
 
-func NewMockDB() *MockDB {
-	return &MockDB{
-		users:             make(map[uuid.UUID]User),
-		ratings:           []Rating{},
-		orders:            []Order{},
-		disputes:          []Dispute{},
-		reputationHistory: []ReputationHistory{},
-	}
+	assert.Equal(t, 50.0, breakdown.BaseScore)
+	assert.Equal(t, 10.0, breakdown.RatingContrib)
+	assert.Equal(t, 2.5, breakdown.OrdersContrib)
+	assert.Equal(t, 10.0, breakdown.VerifiedBonus)
+	assert.Equal(t, 72.5, breakdown.CalculatedScore)
+	assert.Equal(t, DefaultModelVersion, breakdown.ModelVersion)
 }
 
-func (m *MockDB) QueryRow(query string, args ...interface{}) *sql.Row {
-	// Mock implementation - return basic data for testing
-	userID := args[0].(uuid.UUID)
+func TestComputeReputation_UnverifiedSeller(t *testing.T) {
+	in := Inputs{Ratings: ratingsOf(5), VerificationLevel: models.VerificationLevelNone}
 
-	// Calculate mock breakdown
-	avgRating := 4.0
-	totalRatings := 10
-	totalOrders := 5
-	disputesPenalty := 0.0
-	verifiedBonus := 10.0
+	breakdown := DefaultModel().Score(in, testNow)
 
-	if user, exists := m.users[userID]; exists && user.Verified {
-		verifiedBonus = 10.0
-	}
-
-	ratingContrib := avgRating * 10 * 0.5 // 50% weight
-	ordersContrib := float64(totalOrders) * 0.5
-	calculatedScore := ratingContrib + ordersContrib + disputesPenalty + verifiedBonus
-
-	// Return mock row data
-	return sql.Row{
-		ratingContrib,
-		ordersContrib,
-		disputesPenalty,
-		verifiedBonus,
-		totalRatings,
-		totalOrders,
-		calculatedScore,
-	}
+	assert.Equal(t, 0.0, breakdown.VerifiedBonus)
+	assert.Equal(t, 70.0, breakdown.CalculatedScore)
 }
 
-func (m *MockDB) Query(query string, args ...interface{}) (*sql.Rows, error) {
-	// Mock implementation
-	return nil, nil
-}
+func TestComputeReputation_VerificationLevels(t *testing.T) {
+	model := DefaultModel()
+	model.Weights.BusinessVerifiedBonus = 5
 
-func (m *MockDB) Exec(query string, args ...interface{}) (sql.Result, error) {
-	// Mock implementation
-	return nil, nil
-}
+	none := model.Score(Inputs{}, testNow)
+	identity := model.Score(Inputs{VerificationLevel: models.VerificationLevelIdentity}, testNow)
+	business := model.Score(Inputs{VerificationLevel: models.VerificationLevelBusiness}, testNow)
 
-func (m *MockDB) Begin() (*sql.Tx, error) {
-	// Mock implementation
-	return nil, nil
+	assert.Equal(t, 0.0, none.VerifiedBonus)
+	assert.Equal(t, 10.0, identity.VerifiedBonus)
+	assert.Equal(t, 15.0, business.VerifiedBonus)
+	assert.Equal(t, 65.0, business.CalculatedScore)
 }
 
-func (m *MockDB) Ping() error {
-	return nil
-}
+func TestComputeReputation_NewSeller(t *testing.T) {
+	breakdown := DefaultModel().Score(Inputs{}, testNow)
 
-func (m *MockDB) AddUser(user User) {
-	m.users[user.ID] = user
+	assert.Equal(t, 50.0, breakdown.CalculatedScore)
+	assert.Equal(t, 0, breakdown.TotalRatings)
+	assert.Equal(t, 0, breakdown.TotalOrders)
+	assert.Equal(t, 0.0, breakdown.RatingContrib)
 }
 
-func (m *MockDB) AddRating(rating Rating) {
-	m.ratings = append(m.ratings, rating)
-}
+func TestComputeReputation_OrdersCapped(t *testing.T) {
+	breakdown := DefaultModel().Score(Inputs{CompletedOrders: 100}, testNow)
 
-func (m *MockDB) AddOrder(order Order) {
-	m.orders = append(m.orders, order)
+	assert.Equal(t, 15.0, breakdown.OrdersContrib)
 }
 
-func (m *MockDB) AddDispute(dispute Dispute) {
-	m.disputes = append(m.disputes, dispute)
-}
+func TestComputeReputation_DisputeWindow(t *testing.T) {
+	in := Inputs{
+		LostDisputes: []time.Time{
+			testNow.AddDate(0, 0, -10),
+			testNow.AddDate(0, 0, -100),
+			testNow.AddDate(0, 0, -400), // outside the 180 day window
+		},
+	}
 
-func TestComputeReputation_Simple(t *testing.T) {
-	// Setup
-	mockDB := NewMockDB()
-	service := NewReputationService(mockDB)
-
-	// Test user with verified status
-	userID := uuid.New()
-	mockDB.AddUser(User{
-		ID:       userID,
-		Role:     "trader",
-		Verified: true,
-	})
-
-	// Test
-	score, breakdown, err := service.ComputeReputation(userID)
-
-	// Assertions
-	require.NoError(t, err)
-	assert.GreaterOrEqual(t, score, 0.0)
-	assert.LessOrEqual(t, score, 100.0)
-	assert.Equal(t, 10.0, breakdown.VerifiedBonus)
-	assert.GreaterOrEqual(t, breakdown.RatingContrib, 0.0)
-	assert.GreaterOrEqual(t, breakdown.OrdersContrib, 0.0)
+	breakdown := DefaultModel().Score(in, testNow)
+
+	assert.Equal(t, 2, breakdown.TotalDisputes)
+	assert.Equal(t, -4.0, breakdown.DisputesPenalty)
+	assert.Equal(t, 46.0, breakdown.CalculatedScore)
 }
 
-func TestComputeReputation_UnverifiedSeller(t *testing.T) {
-	// Setup
-	mockDB := NewMockDB()
-	service := NewReputationService(mockDB)
-
-	// Test user without verified status
-	userID := uuid.New()
-	mockDB.AddUser(User{
-		ID:       userID,
-		Role:     "trader",
-		Verified: false,
-	})
-
-	// Test
-	score, breakdown, err := service.ComputeReputation(userID)
-
-	// Assertions
-	require.NoError(t, err)
-	assert.Equal(t, 0.0, breakdown.VerifiedBonus)
-	assert.GreaterOrEqual(t, score, 0.0)
-	assert.LessOrEqual(t, score, 100.0)
+func TestComputeReputation_ScoreClamped(t *testing.T) {
+	model := DefaultModel()
+	model.Weights.VerifiedBonus = 80
+
+	breakdown := model.Score(Inputs{Ratings: ratingsOf(5), VerificationLevel: models.VerificationLevelIdentity}, testNow)
+	assert.Equal(t, 100.0, breakdown.CalculatedScore)
+
+	model = DefaultModel()
+	model.Weights.DisputePenalty = 60
+	breakdown = model.Score(Inputs{LostDisputes: []time.Time{testNow}}, testNow)
+	assert.Equal(t, 0.0, breakdown.CalculatedScore)
 }
 
-func TestComputeReputation_NewSeller(t *testing.T) {
-	// Setup
-	mockDB := NewMockDB()
-	service := NewReputationService(mockDB)
+func TestComputeReputation_RecencyDecay(t *testing.T) {
+	in := Inputs{
+		Ratings: []RatingInput{
+			{Stars: 5, CreatedAt: testNow},
+			{Stars: 1, CreatedAt: testNow.AddDate(0, 0, -365)},
+		},
+	}
 
-	// Test user that doesn't exist in mock DB
-	userID := uuid.New()
+	flat := DefaultModel().Score(in, testNow)
 
-	// Test
-	score, breakdown, err := service.ComputeReputation(userID)
+	decayed := DefaultModel()
+	decayed.Version = "v2"
+	decayed.Weights.RecencyHalfLifeDays = 90
+	recent := decayed.Score(in, testNow)
 
-	// Assertions
-	require.NoError(t, err)
-	assert.Equal(t, 50.0, score) // Default score for new sellers
-	assert.Equal(t, 0, breakdown.TotalRatings)
-	assert.Equal(t, 0, breakdown.TotalOrders)
+	// Without decay the two ratings average to neutral; with decay the recent 5 dominates
+	assert.Equal(t, 0.0, flat.RatingContrib)
+	assert.Greater(t, recent.RatingContrib, 15.0)
+	assert.Equal(t, "v2", recent.ModelVersion)
 }
 
-func TestRecalculateReputation(t *testing.T) {
-	// Setup
-	mockDB := NewMockDB()
-	service := NewReputationService(mockDB)
-
-	userID := uuid.New()
-	mockDB.AddUser(User{
-		ID:       userID,
-		Role:     "trader",
-		Verified: true,
-	})
-
-	// Test
-	err := service.RecalculateReputation(userID)
-
-	// Assertions
-	require.NoError(t, err)
-	// In a real test, we would verify that reputation history was updated
+func TestComputeReputation_BayesianPrior(t *testing.T) {
+	model := DefaultModel()
+	model.Weights.PriorMean = 3.5
+	model.Weights.PriorWeight = 5
+
+	newcomer := model.Score(Inputs{Ratings: ratingsOf(5)}, testNow)
+
+	established := make([]int, 100)
+	for i := range established {
+		established[i] = 4
+		if i%2 == 0 {
+			established[i] = 5
+		}
+	}
+	veteran := model.Score(Inputs{Ratings: ratingsOf(established...)}, testNow)
+
+	// A single 5-star review must not outrank a long 4.5-star record
+	assert.Equal(t, 7.5, newcomer.RatingContrib)
+	assert.Greater(t, veteran.CalculatedScore, newcomer.CalculatedScore)
 }
 
-func TestGetReputation(t *testing.T) {
-	// Setup
-	mockDB := NewMockDB()
-	service := NewReputationService(mockDB)
-
-	userID := uuid.New()
-	mockDB.AddUser(User{
-		ID:       userID,
-		Role:     "trader",
-		Verified: true,
-	})
-
-	// Test
-	score, history, err := service.GetReputation(userID)
-
-	// Assertions
-	require.NoError(t, err)
-	assert.GreaterOrEqual(t, score, 0.0)
-	assert.LessOrEqual(t, score, 100.0)
-	assert.NotNil(t, history)
+func TestBayesianAverage(t *testing.T) {
+	prior := Prior{Mean: 3.5, Weight: 5}
+
+	assert.Equal(t, 3.5, BayesianAverage(0, 0, prior))
+	assert.InDelta(t, 3.75, BayesianAverage(5, 1, prior), 0.0001)
+	assert.Equal(t, 4.0, BayesianAverage(8, 2, Prior{}))
+	assert.Equal(t, 0.0, BayesianAverage(0, 0, Prior{}))
 }
 
-func TestGetSellerReputation(t *testing.T) {
-	// Setup
-	mockDB := NewMockDB()
-	service := NewReputationService(mockDB)
-
-	sellerID := uuid.New()
-	mockDB.AddUser(User{
-		ID:       sellerID,
-		Role:     "trader",
-		Verified: true,
-	})
-
-	// Test
-	reputation, err := service.GetSellerReputation(sellerID)
-
-	// Assertions
-	require.NoError(t, err)
-	assert.NotNil(t, reputation)
-	assert.Equal(t, sellerID, reputation.SellerID)
-	assert.GreaterOrEqual(t, reputation.CurrentScore, 0.0)
-	assert.LessOrEqual(t, reputation.CurrentScore, 100.0)
+func TestModelValidate(t *testing.T) {
+	require.NoError(t, DefaultModel().Validate())
+
+	tests := []struct {
+		name   string
+		mutate func(m *Model)
+	}{
+		{"missing version", func(m *Model) { m.Version = "" }},
+		{"neutral rating out of range", func(m *Model) { m.Weights.NeutralRating = 6 }},
+		{"negative weight", func(m *Model) { m.Weights.OrderWeight = -1 }},
+		{"negative business bonus", func(m *Model) { m.Weights.BusinessVerifiedBonus = -1 }},
+		{"negative window", func(m *Model) { m.Weights.DisputeWindowDays = -1 }},
+		{"negative prior weight", func(m *Model) { m.Weights.PriorWeight = -1 }},
+		{"prior mean out of range", func(m *Model) { m.Weights.PriorWeight = 5; m.Weights.PriorMean = 0 }},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := DefaultModel()
+			test.mutate(&m)
+			assert.Error(t, m.Validate())
+		})
+	}
 }
 
 func TestGenerateReputationBadge(t *testing.T) {
 	// Setup
-	mockDB := NewMockDB()
-	service := NewReputationService(mockDB)
+	service := NewReputationService(nil)
 
 	tests := []struct {
 		score           float64
@@ -275,109 +208,18 @@ func TestGenerateReputationBadge(t *testing.T) {
 	}
 }
 
-func TestGetReputationReport(t *testing.T) {
-	// Setup
-	mockDB := NewMockDB()
-	service := NewReputationService(mockDB)
-
-	// Add test sellers with different scores
-	seller1 := uuid.New()
-	seller2 := uuid.New()
-
-	mockDB.AddUser(User{ID: seller1, Role: "trader", Verified: true})
-	mockDB.AddUser(User{ID: seller2, Role: "trader", Verified: false})
-
-	// Test
-	report, err := service.GetReputationReport(time.Now().AddDate(0, 0, -30))
-
-	// Assertions
-	require.NoError(t, err)
-	assert.NotNil(t, report)
-}
-
-func TestHealthCheck(t *testing.T) {
-	// Setup
-	mockDB := NewMockDB()
-	service := NewReputationService(mockDB)
-
-	// Test
-	err := service.HealthCheck()
-
-	// Assertions
-	require.NoError(t, err)
-}
-
-func TestRatingCreateTriggersRecalc(t *testing.T) {
-	// This test would verify that creating a rating triggers reputation recalculation
-	// In a real implementation, this would test the database trigger or service integration
-
-	// Setup
-	mockDB := NewMockDB()
-	service := NewReputationService(mockDB)
-
-	sellerID := uuid.New()
-	mockDB.AddUser(User{
-		ID:       sellerID,
-		Role:     "trader",
-		Verified: true,
-	})
-
-	// Get initial reputation
-	initialScore, _, err := service.ComputeReputation(sellerID)
-	require.NoError(t, err)
-
-	// Simulate adding a rating
-	mockDB.AddRating(Rating{
-		ID:        1,
-		SellerID:  sellerID,
-		Rating:    5,
-		Review:    "Great product!",
-		CreatedAt: time.Now(),
-	})
-
-	// Recalculate reputation
-	err = service.RecalculateReputation(sellerID)
-	require.NoError(t, err)
-
-	// Get updated reputation
-	updatedScore, _, err := service.ComputeReputation(sellerID)
-	require.NoError(t, err)
-
-	// In a real test, we would assert that the score changed appropriately
-	assert.GreaterOrEqual(t, updatedScore, initialScore)
-}
-
 // Benchmark tests
 func BenchmarkComputeReputation(b *testing.B) {
-	mockDB := NewMockDB()
-	service := NewReputationService(mockDB)
-
-	userID := uuid.New()
-	mockDB.AddUser(User{
-		ID:       userID,
-		Role:     "trader",
-		Verified: true,
-	})
-
-	b.ResetTimer()
-	for i := 0; i < b.N; i++ {
-		_, _, _ = service.ComputeReputation(userID)
+	model := DefaultModel()
+	model.Weights.RecencyHalfLifeDays = 90
+	in := Inputs{
+		Ratings:           ratingsOf(5, 4, 3, 5, 4, 2, 5, 5, 4, 3),
+		CompletedOrders:   20,
+		VerificationLevel: models.VerificationLevelBusiness,
 	}
-}
-
-func BenchmarkRecalculateReputation(b *testing.B) {
-	mockDB := NewMockDB()
-	service := NewReputationService(mockDB)
-
-	userID := uuid.New()
-	mockDB.AddUser(User{
-		ID:       userID,
-		Role:     "trader",
-		Verified: true,
-	})
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		_ = service.RecalculateReputation(userID)
+		_ = model.Score(in, testNow)
 	}
 }
@@ -3,39 +3,116 @@ package reputation
 import (
 	"context"
 	"database/sql"
+	"fmt"
 	"log"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
 )
 
-// Scheduler handles background reputation updates
+// EventType identifies what caused a seller's reputation to need recalculation
+type EventType string
+
+const (
+	EventRatingCreated       EventType = "rating_created"
+	EventOrderDelivered      EventType = "order_delivered"
+	EventDisputeResolved     EventType = "dispute_resolved"
+	EventVerificationChanged EventType = "verification_changed"
+	EventSafetySweep         EventType = "safety_sweep"
+)
+
+// Notifier receives reputation events from other services
+type Notifier interface {
+	Enqueue(sellerID uuid.UUID, event EventType)
+}
+
+const (
+	// DefaultDebounce is how long a seller must be quiet before recalculation
+	DefaultDebounce = 30 * time.Second
+	// DefaultMaxDelay bounds how long a busy seller can be deferred by debouncing
+	DefaultMaxDelay = 5 * time.Minute
+)
+
+// pendingUpdate coalesces all events received for a seller since the last recalculation
+type pendingUpdate struct {
+	firstQueued time.Time
+	lastQueued  time.Time
+	events      map[EventType]int
+}
+
+// Scheduler recalculates reputation in response to events, with a periodic safety sweep
 type Scheduler struct {
 	db                *sql.DB
 	reputationService *ReputationService
 	interval          time.Duration
+	debounce          time.Duration
+	maxDelay          time.Duration
 	ctx               context.Context
 	cancel            context.CancelFunc
+
+	// recalculate is swapped out in tests
+	recalculate func(ctx context.Context, sellerID uuid.UUID, reason string) error
+	now         func() time.Time
+
+	mu        sync.Mutex
+	pending   map[uuid.UUID]*pendingUpdate
+	wake      chan struct{}
+	received  int64
+	coalesced int64
+	processed int64
+	failed    int64
+	lastLag   time.Duration
+	maxLag    time.Duration
+	lastSweep time.Time
 }
 
-// NewScheduler creates a new reputation scheduler
+// NewScheduler creates a new reputation scheduler; interval controls the safety sweep
 func NewScheduler(db *sql.DB, reputationService *ReputationService, interval time.Duration) *Scheduler {
 	ctx, cancel := context.WithCancel(context.Background())
 
-	return &Scheduler{
+	s := &Scheduler{
 		db:                db,
 		reputationService: reputationService,
 		interval:          interval,
+		debounce:          DefaultDebounce,
+		maxDelay:          DefaultMaxDelay,
 		ctx:               ctx,
 		cancel:            cancel,
+		now:               time.Now,
+		pending:           make(map[uuid.UUID]*pendingUpdate),
+		wake:              make(chan struct{}, 1),
 	}
+
+	if reputationService != nil {
+		s.recalculate = func(ctx context.Context, sellerID uuid.UUID, reason string) error {
+			_, err := reputationService.Engine().Record(ctx, sellerID, reason)
+			return err
+		}
+	}
+
+	return s
+}
+
+// SetDebounce configures the quiet period and the maximum deferral per seller
+func (s *Scheduler) SetDebounce(debounce, maxDelay time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.debounce = debounce
+	s.maxDelay = maxDelay
 }
 
-// Start begins the background reputation update process
+// Start begins processing queued events and the periodic safety sweep
 func (s *Scheduler) Start() {
-	log.Printf("Starting reputation scheduler with interval: %v", s.interval)
+	log.Printf("Starting reputation scheduler (debounce: %v, sweep interval: %v)", s.debounce, s.interval)
 
 	go s.run()
+	if s.interval > 0 {
+		go s.sweepLoop()
+	}
 }
 
 // Stop stops the background reputation update process
@@ -44,18 +121,129 @@ func (s *Scheduler) Stop() {
 	s.cancel()
 }
 
-// run executes the reputation update loop
+// Enqueue records that a seller needs recalculation; repeated events for the
+// same seller are coalesced into a single update
+func (s *Scheduler) Enqueue(sellerID uuid.UUID, event EventType) {
+	now := s.now()
+
+	s.mu.Lock()
+	s.received++
+	update, exists := s.pending[sellerID]
+	if exists {
+		s.coalesced++
+	} else {
+		update = &pendingUpdate{firstQueued: now, events: make(map[EventType]int)}
+		s.pending[sellerID] = update
+	}
+	update.lastQueued = now
+	update.events[event]++
+	s.mu.Unlock()
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run processes due updates until the scheduler is stopped
 func (s *Scheduler) run() {
+	timer := time.NewTimer(s.debounce)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			log.Println("Reputation scheduler stopped")
+			return
+		case <-s.wake:
+		case <-timer.C:
+		}
+
+		next := s.processDue()
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(next)
+	}
+}
+
+// processDue recalculates every seller whose debounce has elapsed and returns
+// how long to wait before the next check
+func (s *Scheduler) processDue() time.Duration {
+	now := s.now()
+
+	s.mu.Lock()
+	due := make(map[uuid.UUID]*pendingUpdate)
+	next := s.debounce
+	for sellerID, update := range s.pending {
+		readyAt := update.lastQueued.Add(s.debounce)
+		if deadline := update.firstQueued.Add(s.maxDelay); deadline.Before(readyAt) {
+			readyAt = deadline
+		}
+
+		if !readyAt.After(now) {
+			due[sellerID] = update
+			delete(s.pending, sellerID)
+		} else if wait := readyAt.Sub(now); wait < next {
+			next = wait
+		}
+	}
+	s.mu.Unlock()
+
+	for sellerID, update := range due {
+		s.process(sellerID, update)
+	}
+
+	return next
+}
+
+// process recalculates a single seller and records lag statistics
+func (s *Scheduler) process(sellerID uuid.UUID, update *pendingUpdate) {
+	err := s.recalculate(s.ctx, sellerID, update.reason())
+	lag := s.now().Sub(update.firstQueued)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err != nil {
+		log.Printf("Failed to update reputation for seller %s: %v", sellerID, err)
+		s.failed++
+	} else {
+		s.processed++
+	}
+	s.lastLag = lag
+	if lag > s.maxLag {
+		s.maxLag = lag
+	}
+}
+
+// reason summarises the coalesced events for the reputation history entry
+func (u *pendingUpdate) reason() string {
+	events := make([]string, 0, len(u.events))
+	for event, count := range u.events {
+		if count > 1 {
+			events = append(events, fmt.Sprintf("%s x%d", event, count))
+		} else {
+			events = append(events, string(event))
+		}
+	}
+	sort.Strings(events)
+
+	return "Event recalculation: " + strings.Join(events, ", ")
+}
+
+// sweepLoop periodically enqueues recently active sellers in case an event was missed
+func (s *Scheduler) sweepLoop() {
 	ticker := time.NewTicker(s.interval)
 	defer ticker.Stop()
 
-	// Run immediately on start
-	s.updateActiveSellers()
-
 	for {
 		select {
 		case <-s.ctx.Done():
-			log.Println("Reputation scheduler stopped")
 			return
 		case <-ticker.C:
 			s.updateActiveSellers()
@@ -63,35 +251,23 @@ func (s *Scheduler) run() {
 	}
 }
 
-// updateActiveSellers recalculates reputation for active sellers
+// updateActiveSellers enqueues a safety sweep for active sellers
 func (s *Scheduler) updateActiveSellers() {
-	log.Println("Starting reputation update for active sellers...")
-
-	startTime := time.Now()
-
-	// Get active sellers (those with recent activity)
 	activeSellers, err := s.getActiveSellers()
 	if err != nil {
 		log.Printf("Failed to get active sellers: %v", err)
 		return
 	}
 
-	log.Printf("Found %d active sellers to update", len(activeSellers))
-
-	successCount := 0
-	errorCount := 0
+	log.Printf("Reputation safety sweep queued %d active sellers", len(activeSellers))
 
 	for _, sellerID := range activeSellers {
-		if err := s.reputationService.RecalculateReputation(sellerID); err != nil {
-			log.Printf("Failed to update reputation for seller %s: %v", sellerID, err)
-			errorCount++
-		} else {
-			successCount++
-		}
+		s.Enqueue(sellerID, EventSafetySweep)
 	}
 
-	duration := time.Since(startTime)
-	log.Printf("Reputation update completed in %v. Success: %d, Errors: %d", duration, successCount, errorCount)
+	s.mu.Lock()
+	s.lastSweep = s.now()
+	s.mu.Unlock()
 }
 
 // getActiveSellers returns a list of seller IDs that need reputation updates
@@ -100,7 +276,7 @@ func (s *Scheduler) getActiveSellers() ([]uuid.UUID, error) {
 	query := `
 		SELECT DISTINCT u.id
 		FROM users u
-		WHERE u.role = 'trader' OR u.role = 'seller'
+		WHERE u.role IN ('trader', 'seller')
 		AND (
 			EXISTS (
 				SELECT 1 FROM orders o 
@@ -108,7 +284,7 @@ func (s *Scheduler) getActiveSellers() ([]uuid.UUID, error) {
 				AND o.created_at >= $1
 			)
 			OR EXISTS (
-				SELECT 1 FROM ratings r 
+				SELECT 1 FROM reviews r 
 				WHERE r.seller_id = u.id 
 				AND r.created_at >= $1
 			)
@@ -141,27 +317,11 @@ func (s *Scheduler) getActiveSellers() ([]uuid.UUID, error) {
 	return sellers, nil
 }
 
-// UpdateSpecificSellers updates reputation for specific sellers
-func (s *Scheduler) UpdateSpecificSellers(sellerIDs []uuid.UUID) error {
-	log.Printf("Updating reputation for %d specific sellers", len(sellerIDs))
-
-	startTime := time.Now()
-	successCount := 0
-	errorCount := 0
-
+// UpdateSpecificSellers queues reputation updates for specific sellers
+func (s *Scheduler) UpdateSpecificSellers(sellerIDs []uuid.UUID, event EventType) {
 	for _, sellerID := range sellerIDs {
-		if err := s.reputationService.RecalculateReputation(sellerID); err != nil {
-			log.Printf("Failed to update reputation for seller %s: %v", sellerID, err)
-			errorCount++
-		} else {
-			successCount++
-		}
+		s.Enqueue(sellerID, event)
 	}
-
-	duration := time.Since(startTime)
-	log.Printf("Specific seller reputation update completed in %v. Success: %d, Errors: %d", duration, successCount, errorCount)
-
-	return nil
 }
 
 // GetSchedulerStats returns statistics about the scheduler
@@ -177,14 +337,6 @@ func (s *Scheduler) GetSchedulerStats() map[string]interface{} {
 		stats["total_sellers"] = totalSellers
 	}
 
-	// Get active sellers count
-	activeSellers, err := s.getActiveSellers()
-	if err != nil {
-		stats["active_sellers_error"] = err.Error()
-	} else {
-		stats["active_sellers"] = len(activeSellers)
-	}
-
 	// Get last reputation update
 	var lastUpdate time.Time
 	err = s.db.QueryRow("SELECT MAX(created_at) FROM reputation_history").Scan(&lastUpdate)
@@ -203,8 +355,45 @@ func (s *Scheduler) GetSchedulerStats() map[string]interface{} {
 		stats["history_count"] = historyCount
 	}
 
+	for key, value := range s.QueueStats() {
+		stats[key] = value
+	}
+
 	stats["scheduler_interval"] = s.interval.String()
 	stats["scheduler_running"] = s.ctx.Err() == nil
 
 	return stats
 }
+
+// QueueStats reports queue depth and processing lag without touching the database
+func (s *Scheduler) QueueStats() map[string]interface{} {
+	now := s.now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var oldest time.Duration
+	for _, update := range s.pending {
+		if lag := now.Sub(update.firstQueued); lag > oldest {
+			oldest = lag
+		}
+	}
+
+	stats := map[string]interface{}{
+		"queue_depth":         len(s.pending),
+		"oldest_pending_lag":  oldest.String(),
+		"last_processed_lag":  s.lastLag.String(),
+		"max_processed_lag":   s.maxLag.String(),
+		"events_received":     s.received,
+		"events_coalesced":    s.coalesced,
+		"recalculations":      s.processed,
+		"recalculation_fails": s.failed,
+		"debounce":            s.debounce.String(),
+		"max_delay":           s.maxDelay.String(),
+	}
+	if !s.lastSweep.IsZero() {
+		stats["last_sweep"] = s.lastSweep
+	}
+
+	return stats
+}
@@ -0,0 +1,114 @@
+package reputation
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+type recordedRecalc struct {
+	sellerID uuid.UUID
+	reason   string
+}
+
+func newTestScheduler(t *testing.T) (*Scheduler, *time.Time, *[]recordedRecalc) {
+	t.Helper()
+
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	var mu sync.Mutex
+	var calls []recordedRecalc
+
+	s := NewScheduler(nil, nil, 0)
+	s.now = func() time.Time { return now }
+	s.recalculate = func(ctx context.Context, sellerID uuid.UUID, reason string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		calls = append(calls, recordedRecalc{sellerID: sellerID, reason: reason})
+		return nil
+	}
+	s.SetDebounce(10*time.Second, time.Minute)
+	t.Cleanup(s.Stop)
+
+	return s, &now, &calls
+}
+
+func TestSchedulerCoalescesEventsPerSeller(t *testing.T) {
+	s, now, calls := newTestScheduler(t)
+	seller := uuid.New()
+
+	s.Enqueue(seller, EventRatingCreated)
+	s.Enqueue(seller, EventRatingCreated)
+	s.Enqueue(seller, EventOrderDelivered)
+
+	assert.Equal(t, 1, s.QueueStats()["queue_depth"])
+	assert.Equal(t, int64(2), s.QueueStats()["events_coalesced"])
+
+	// Still inside the debounce window
+	*now = now.Add(5 * time.Second)
+	s.processDue()
+	assert.Empty(t, *calls)
+
+	*now = now.Add(10 * time.Second)
+	s.processDue()
+
+	if assert.Len(t, *calls, 1) {
+		assert.Equal(t, seller, (*calls)[0].sellerID)
+		assert.Equal(t, "Event recalculation: order_delivered, rating_created x2", (*calls)[0].reason)
+	}
+	assert.Equal(t, 0, s.QueueStats()["queue_depth"])
+	assert.Equal(t, "15s", s.QueueStats()["last_processed_lag"])
+}
+
+func TestSchedulerDebounceResetsOnNewEvents(t *testing.T) {
+	s, now, calls := newTestScheduler(t)
+	seller := uuid.New()
+
+	s.Enqueue(seller, EventRatingCreated)
+	*now = now.Add(8 * time.Second)
+	s.Enqueue(seller, EventRatingCreated)
+
+	*now = now.Add(8 * time.Second)
+	s.processDue()
+	assert.Empty(t, *calls)
+
+	*now = now.Add(2 * time.Second)
+	s.processDue()
+	assert.Len(t, *calls, 1)
+}
+
+func TestSchedulerMaxDelayPreventsStarvation(t *testing.T) {
+	s, now, calls := newTestScheduler(t)
+	seller := uuid.New()
+
+	// A continuous stream of events never lets the debounce elapse
+	for i := 0; i < 12; i++ {
+		s.Enqueue(seller, EventOrderDelivered)
+		s.processDue()
+		*now = now.Add(6 * time.Second)
+	}
+
+	assert.Len(t, *calls, 1)
+}
+
+func TestSchedulerKeepsSellersIndependent(t *testing.T) {
+	s, now, calls := newTestScheduler(t)
+	first, second := uuid.New(), uuid.New()
+
+	s.Enqueue(first, EventDisputeResolved)
+	*now = now.Add(6 * time.Second)
+	s.Enqueue(second, EventVerificationChanged)
+
+	*now = now.Add(5 * time.Second)
+	next := s.processDue()
+
+	if assert.Len(t, *calls, 1) {
+		assert.Equal(t, first, (*calls)[0].sellerID)
+	}
+	assert.Equal(t, 5*time.Second, next)
+	assert.Equal(t, 1, s.QueueStats()["queue_depth"])
+	assert.Equal(t, "5s", s.QueueStats()["oldest_pending_lag"])
+}
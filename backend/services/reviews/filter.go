@@ -0,0 +1,77 @@
+package reviews
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Content filter flag reasons
+const (
+	FlagProfanity = "profanity_filtered"
+	FlagPII       = "pii_redacted"
+)
+
+// redacted replaces personal information removed from review text
+const redacted = "[redacted]"
+
+var (
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+	// Phone numbers: international (+254 712 345 678) and local (0712345678) formats
+	phonePattern = regexp.MustCompile(`(?:\+\d{1,3}[\s\-]?\d{2,3}|\b0\d{2,3})(?:[\s\-]?\d{3}){2}`)
+	// National ID and account numbers are long digit runs
+	idNumberPattern = regexp.MustCompile(`\b\d{7,10}\b`)
+	wordPattern     = regexp.MustCompile(`[\p{L}']+`)
+)
+
+// defaultProfanity is a small English and Swahili block list; it is matched on whole words
+var defaultProfanity = []string{
+	"fuck", "fucking", "shit", "bitch", "bastard", "asshole", "dick", "cunt", "idiot", "stupid",
+	"malaya", "mjinga", "mpumbavu", "kuma", "msenge", "fala",
+}
+
+// ContentFilter masks profanity and redacts personal information in user text
+type ContentFilter struct {
+	profanity map[string]struct{}
+}
+
+// FilterResult is the cleaned text plus what was changed
+type FilterResult struct {
+	Text  string   `json:"text"`
+	Flags []string `json:"flags,omitempty"`
+}
+
+// NewContentFilter creates a filter with the default block list
+func NewContentFilter() *ContentFilter {
+	f := &ContentFilter{profanity: make(map[string]struct{}, len(defaultProfanity))}
+	for _, word := range defaultProfanity {
+		f.profanity[word] = struct{}{}
+	}
+	return f
+}
+
+// Apply masks profanity and redacts emails, phone numbers and ID numbers
+func (f *ContentFilter) Apply(text string) FilterResult {
+	result := FilterResult{Text: text}
+
+	cleaned := emailPattern.ReplaceAllString(result.Text, redacted)
+	cleaned = phonePattern.ReplaceAllString(cleaned, redacted)
+	cleaned = idNumberPattern.ReplaceAllString(cleaned, redacted)
+	if cleaned != result.Text {
+		result.Flags = append(result.Flags, FlagPII)
+		result.Text = cleaned
+	}
+
+	masked := wordPattern.ReplaceAllStringFunc(result.Text, func(word string) string {
+		if _, blocked := f.profanity[strings.ToLower(word)]; blocked {
+			runes := []rune(word)
+			return string(runes[0]) + strings.Repeat("*", len(runes)-1)
+		}
+		return word
+	})
+	if masked != result.Text {
+		result.Flags = append(result.Flags, FlagProfanity)
+		result.Text = masked
+	}
+
+	return result
+}
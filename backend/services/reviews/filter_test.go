@@ -0,0 +1,57 @@
+package reviews
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContentFilter_CleanText(t *testing.T) {
+	result := NewContentFilter().Apply("Fresh maize, delivered on time. Will buy again!")
+
+	assert.Equal(t, "Fresh maize, delivered on time. Will buy again!", result.Text)
+	assert.Empty(t, result.Flags)
+}
+
+func TestContentFilter_Profanity(t *testing.T) {
+	result := NewContentFilter().Apply("This seller is STUPID and a mjinga")
+
+	assert.Equal(t, "This seller is S***** and a m*****", result.Text)
+	assert.Equal(t, []string{FlagProfanity}, result.Flags)
+}
+
+func TestContentFilter_ProfanityWholeWordsOnly(t *testing.T) {
+	result := NewContentFilter().Apply("Dickson sold me good shitake mushrooms")
+
+	assert.Equal(t, "Dickson sold me good shitake mushrooms", result.Text)
+	assert.Empty(t, result.Flags)
+}
+
+func TestContentFilter_RedactsPII(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"email", "Contact me at farmer.john@example.co.ke", "Contact me at [redacted]"},
+		{"international phone", "Call +254 712 345 678 for more", "Call [redacted] for more"},
+		{"local phone", "Call 0712345678 for more", "Call [redacted] for more"},
+		{"id number", "My ID is 12345678", "My ID is [redacted]"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := NewContentFilter().Apply(test.input)
+
+			assert.Equal(t, test.expected, result.Text)
+			assert.Equal(t, []string{FlagPII}, result.Flags)
+		})
+	}
+}
+
+func TestContentFilter_BothFlags(t *testing.T) {
+	result := NewContentFilter().Apply("Idiot, email me at a@b.com")
+
+	assert.Equal(t, "I****, email me at [redacted]", result.Text)
+	assert.ElementsMatch(t, []string{FlagPII, FlagProfanity}, result.Flags)
+}
@@ -0,0 +1,611 @@
+package reviews
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Andrew-mugwe/agroai/pagination"
+	"github.com/Andrew-mugwe/agroai/services/reputation"
+	"github.com/google/uuid"
+)
+
+// Review statuses
+const (
+	StatusPublished = "published"
+	StatusHeld      = "held"
+	StatusHidden    = "hidden"
+	StatusRejected  = "rejected"
+)
+
+// Moderation actions an admin can take on a review
+const (
+	ActionPublish = "publish"
+	ActionHide    = "hide"
+	ActionReject  = "reject"
+)
+
+// ReportThreshold is the number of open reports that pulls a review into moderation
+const ReportThreshold = 3
+
+// Review errors
+var (
+	ErrReviewNotFound   = errors.New("review not found")
+	ErrAlreadyReviewed  = errors.New("review already exists for this order")
+	ErrNotEligible      = errors.New("order not found or not eligible for review")
+	ErrReplyExists      = errors.New("seller has already replied to this review")
+	ErrNotReviewSeller  = errors.New("only the reviewed seller can reply")
+	ErrAlreadyReported  = errors.New("you have already reported this review")
+	ErrInvalidReason    = errors.New("invalid report reason")
+	ErrReasonRequired   = errors.New("a reason is required to hide or reject a review")
+	ErrInvalidAction    = errors.New("invalid moderation action")
+	ErrEmptyReply       = errors.New("reply cannot be empty")
+	ErrReviewNotVisible = errors.New("review is not published")
+)
+
+// ReportReasons are the accepted reasons for reporting a review
+var ReportReasons = []string{"abusive", "spam", "fake", "off_topic", "personal_info", "other"}
+
+// Review is the single review model shared by sellers, ratings and moderation
+type Review struct {
+	ID               uuid.UUID  `json:"id"`
+	OrderID          *uuid.UUID `json:"order_id,omitempty"`
+	BuyerID          uuid.UUID  `json:"buyer_id"`
+	BuyerName        string     `json:"buyer_name,omitempty"`
+	SellerID         uuid.UUID  `json:"seller_id"`
+	Rating           int        `json:"rating"`
+	Comment          string     `json:"comment,omitempty"`
+	VerifiedPurchase bool       `json:"verified_purchase"`
+	Status           string     `json:"status"`
+	Reply            *Reply     `json:"reply,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
+}
+
+// Reply is the seller's single public response to a review
+type Reply struct {
+	SellerID  uuid.UUID `json:"seller_id"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CreateReviewRequest represents a request to create a review
+type CreateReviewRequest struct {
+	OrderID uuid.UUID `json:"order_id" validate:"required"`
+	Rating  int       `json:"rating" validate:"required,min=1,max=5"`
+	Comment string    `json:"comment,omitempty" validate:"max=500"`
+	// SellerID, when set, must match the order's seller
+	SellerID *uuid.UUID `json:"-"`
+}
+
+// ReportRequest represents a request to report a review
+type ReportRequest struct {
+	Reason  string `json:"reason" validate:"required"`
+	Details string `json:"details,omitempty" validate:"max=500"`
+}
+
+// ModerationItem is a review in the admin moderation queue
+type ModerationItem struct {
+	Review
+	Flags         []string `json:"flags"`
+	OpenReports   int      `json:"open_reports"`
+	ReportReasons []string `json:"report_reasons"`
+}
+
+// Service handles review creation, replies, reports and moderation
+type Service struct {
+	db       *sql.DB
+	detector *reputation.AnomalyDetector
+	filter   *ContentFilter
+	notifier reputation.Notifier
+}
+
+// NewService creates a new review service
+func NewService(db *sql.DB) *Service {
+	return &Service{
+		db:       db,
+		detector: reputation.NewAnomalyDetector(db),
+		filter:   NewContentFilter(),
+	}
+}
+
+// SetReputationNotifier registers the receiver for review reputation events
+func (s *Service) SetReputationNotifier(notifier reputation.Notifier) {
+	s.notifier = notifier
+}
+
+// Create stores a review for a delivered order. The seller comes from the
+// order, the verified-purchase flag from its payment status, and the text is
+// filtered for profanity and personal information. Reviews that look like
+// manipulation are held for moderation.
+func (s *Service) Create(ctx context.Context, buyerID uuid.UUID, req *CreateReviewRequest) (*Review, error) {
+	if req.Rating < 1 || req.Rating > 5 {
+		return nil, fmt.Errorf("rating must be between 1 and 5")
+	}
+
+	var sellerID uuid.UUID
+	var status, paymentStatus string
+	err := s.db.QueryRowContext(ctx, `
+		SELECT seller_id, status, COALESCE(payment_status, '')
+		FROM orders
+		WHERE id = $1 AND user_id = $2`, req.OrderID, buyerID).Scan(&sellerID, &status, &paymentStatus)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrNotEligible
+		}
+		return nil, fmt.Errorf("failed to load order: %w", err)
+	}
+	if req.SellerID != nil && *req.SellerID != sellerID {
+		return nil, ErrNotEligible
+	}
+	if status != "delivered" && status != "completed" {
+		return nil, fmt.Errorf("can only review delivered orders")
+	}
+
+	var exists bool
+	err = s.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM reviews WHERE order_id = $1)`, req.OrderID).Scan(&exists)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check existing review: %w", err)
+	}
+	if exists {
+		return nil, ErrAlreadyReviewed
+	}
+
+	filtered := s.filter.Apply(strings.TrimSpace(req.Comment))
+
+	reasons, err := s.detector.Check(ctx, buyerID, sellerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check review: %w", err)
+	}
+
+	orderID := req.OrderID
+	review := &Review{
+		OrderID:          &orderID,
+		BuyerID:          buyerID,
+		SellerID:         sellerID,
+		Rating:           req.Rating,
+		Comment:          filtered.Text,
+		VerifiedPurchase: paymentStatus == "paid",
+		Status:           StatusPublished,
+	}
+	if len(reasons) > 0 {
+		review.Status = StatusHeld
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO reviews (order_id, buyer_id, seller_id, rating, comment, verified_purchase, status)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at`,
+		review.OrderID, review.BuyerID, review.SellerID, review.Rating, review.Comment,
+		review.VerifiedPurchase, review.Status,
+	).Scan(&review.ID, &review.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create review: %w", err)
+	}
+
+	if err := insertFlags(ctx, tx, review.ID, reasons, "anomaly_detection"); err != nil {
+		return nil, err
+	}
+	if err := insertFlags(ctx, tx, review.ID, filtered.Flags, "content_filter"); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit review: %w", err)
+	}
+
+	if review.Status == StatusPublished {
+		s.notify(sellerID)
+	}
+
+	return review, nil
+}
+
+// Get returns a single review with its reply
+func (s *Service) Get(ctx context.Context, reviewID uuid.UUID) (*Review, error) {
+	row := s.db.QueryRowContext(ctx, selectReviews+` WHERE r.id = $1`, reviewID)
+
+	review, err := scanReview(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrReviewNotFound
+		}
+		return nil, fmt.Errorf("failed to get review: %w", err)
+	}
+
+	return review, nil
+}
+
+// List sort orders; cursors carry them
+const (
+	sortNewest = "newest"
+	sortOldest = "oldest"
+)
+
+var (
+	// sellerReviewsKeyset lists a seller's reviews newest first
+	sellerReviewsKeyset = pagination.Keyset{Key: "r.created_at", ID: "r.id", Dir: pagination.Desc}
+	// moderationKeyset lists the moderation queue oldest first
+	moderationKeyset = pagination.Keyset{Key: "r.created_at", ID: "r.id", Dir: pagination.Asc}
+)
+
+// ListForSeller returns a page of a seller's published reviews, newest first
+func (s *Service) ListForSeller(ctx context.Context, sellerID uuid.UUID, page pagination.Params) (pagination.Page[Review], error) {
+	var none pagination.Page[Review]
+	page = page.Normalize()
+	after, err := page.After(sortNewest)
+	if err != nil {
+		return none, err
+	}
+
+	where := "r.seller_id = $1 AND r.status = $2"
+	args := []interface{}{sellerID, StatusPublished}
+
+	var total int
+	if err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM reviews r WHERE "+where, args...).Scan(&total); err != nil {
+		return none, fmt.Errorf("failed to count reviews: %w", err)
+	}
+
+	if after != nil {
+		args = append(args, after.Key, after.ID)
+		where += " AND " + sellerReviewsKeyset.After("$3", "$4")
+	}
+	args = append(args, page.FetchLimit())
+	rows, err := s.db.QueryContext(ctx, selectReviewsWith(sellerReviewsKeyset.KeyText())+fmt.Sprintf(`
+		WHERE %s
+		ORDER BY %s
+		LIMIT $%d`, where, sellerReviewsKeyset.OrderBy(), len(args)), args...)
+	if err != nil {
+		return none, fmt.Errorf("failed to query reviews: %w", err)
+	}
+	defer rows.Close()
+
+	var reviews []Review
+	var keys []string
+	for rows.Next() {
+		var key string
+		review, err := scanReview(rows, &key)
+		if err != nil {
+			return none, fmt.Errorf("failed to scan review: %w", err)
+		}
+		reviews = append(reviews, *review)
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return none, fmt.Errorf("failed to query reviews: %w", err)
+	}
+
+	return pagination.NewPage(reviews, page.Limit, func(i int) pagination.Cursor {
+		return pagination.Cursor{Key: keys[i], ID: reviews[i].ID.String(), Sort: sortNewest}
+	}).WithTotal(total), nil
+}
+
+// Reply adds the seller's one public reply to a review
+func (s *Service) Reply(ctx context.Context, sellerID, reviewID uuid.UUID, body string) (*Reply, error) {
+	review, err := s.Get(ctx, reviewID)
+	if err != nil {
+		return nil, err
+	}
+	if review.SellerID != sellerID {
+		return nil, ErrNotReviewSeller
+	}
+	if review.Reply != nil {
+		return nil, ErrReplyExists
+	}
+
+	filtered := s.filter.Apply(strings.TrimSpace(body))
+	if filtered.Text == "" {
+		return nil, ErrEmptyReply
+	}
+
+	reply := &Reply{SellerID: sellerID, Body: filtered.Text}
+	err = s.db.QueryRowContext(ctx, `
+		INSERT INTO review_replies (review_id, seller_id, body)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (review_id) DO NOTHING
+		RETURNING created_at`, reviewID, sellerID, reply.Body).Scan(&reply.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrReplyExists
+		}
+		return nil, fmt.Errorf("failed to create reply: %w", err)
+	}
+
+	return reply, nil
+}
+
+// Report records a user's report against a published review; enough open
+// reports pull the review out of public view and into the moderation queue
+func (s *Service) Report(ctx context.Context, reporterID, reviewID uuid.UUID, req *ReportRequest) error {
+	if !validReportReason(req.Reason) {
+		return ErrInvalidReason
+	}
+
+	review, err := s.Get(ctx, reviewID)
+	if err != nil {
+		return err
+	}
+	if review.Status != StatusPublished {
+		return ErrReviewNotVisible
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var reportID uuid.UUID
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO review_reports (review_id, reporter_id, reason, details)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (review_id, reporter_id) DO NOTHING
+		RETURNING id`, reviewID, reporterID, req.Reason, s.filter.Apply(req.Details).Text).Scan(&reportID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrAlreadyReported
+		}
+		return fmt.Errorf("failed to report review: %w", err)
+	}
+
+	var openReports int
+	err = tx.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM review_reports WHERE review_id = $1 AND status = 'open'`, reviewID).Scan(&openReports)
+	if err != nil {
+		return fmt.Errorf("failed to count reports: %w", err)
+	}
+
+	held := false
+	if openReports >= ReportThreshold {
+		result, err := tx.ExecContext(ctx, `
+			UPDATE reviews SET status = $1 WHERE id = $2 AND status = $3`,
+			StatusHeld, reviewID, StatusPublished)
+		if err != nil {
+			return fmt.Errorf("failed to hold reported review: %w", err)
+		}
+		if n, _ := result.RowsAffected(); n > 0 {
+			held = true
+			if err := insertFlags(ctx, tx, reviewID, []string{"reported"}, "user_reports"); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit report: %w", err)
+	}
+
+	// A held review no longer counts towards the seller's score
+	if held {
+		s.notify(review.SellerID)
+	}
+
+	return nil
+}
+
+// ModerationQueue returns a page of held reviews and published reviews with
+// open reports, oldest first
+func (s *Service) ModerationQueue(ctx context.Context, page pagination.Params) (pagination.Page[ModerationItem], error) {
+	var none pagination.Page[ModerationItem]
+	page = page.Normalize()
+	after, err := page.After(sortOldest)
+	if err != nil {
+		return none, err
+	}
+
+	where := `(r.status = $1
+		   OR EXISTS (SELECT 1 FROM review_reports rp WHERE rp.review_id = r.id AND rp.status = 'open'))`
+	args := []interface{}{StatusHeld}
+
+	var total int
+	if err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM reviews r WHERE "+where, args...).Scan(&total); err != nil {
+		return none, fmt.Errorf("failed to count moderation queue: %w", err)
+	}
+
+	if after != nil {
+		args = append(args, after.Key, after.ID)
+		where += " AND " + moderationKeyset.After("$2", "$3")
+	}
+	args = append(args, page.FetchLimit())
+	query := fmt.Sprintf(`
+		SELECT r.id, r.order_id, r.buyer_id, COALESCE(u.name, ''), r.seller_id, r.rating,
+		       COALESCE(r.comment, ''), r.verified_purchase, r.status, r.created_at,
+		       COALESCE((SELECT json_agg(DISTINCT f.reason) FROM review_flags f WHERE f.review_id = r.id), '[]'),
+		       (SELECT COUNT(*) FROM review_reports rp WHERE rp.review_id = r.id AND rp.status = 'open'),
+		       COALESCE((SELECT json_agg(DISTINCT rp.reason) FROM review_reports rp
+		                 WHERE rp.review_id = r.id AND rp.status = 'open'), '[]'),
+		       %s
+		FROM reviews r
+		LEFT JOIN users u ON r.buyer_id = u.id
+		WHERE %s
+		ORDER BY %s
+		LIMIT $%d`, moderationKeyset.KeyText(), where, moderationKeyset.OrderBy(), len(args))
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return none, fmt.Errorf("failed to query moderation queue: %w", err)
+	}
+	defer rows.Close()
+
+	var items []ModerationItem
+	var keys []string
+	for rows.Next() {
+		var item ModerationItem
+		var flagsJSON, reasonsJSON []byte
+		var key string
+		err := rows.Scan(
+			&item.ID, &item.OrderID, &item.BuyerID, &item.BuyerName, &item.SellerID, &item.Rating,
+			&item.Comment, &item.VerifiedPurchase, &item.Status, &item.CreatedAt,
+			&flagsJSON, &item.OpenReports, &reasonsJSON, &key,
+		)
+		if err != nil {
+			return none, fmt.Errorf("failed to scan moderation item: %w", err)
+		}
+		if err := json.Unmarshal(flagsJSON, &item.Flags); err != nil {
+			return none, fmt.Errorf("failed to parse review flags: %w", err)
+		}
+		if err := json.Unmarshal(reasonsJSON, &item.ReportReasons); err != nil {
+			return none, fmt.Errorf("failed to parse report reasons: %w", err)
+		}
+		items = append(items, item)
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return none, fmt.Errorf("failed to query moderation queue: %w", err)
+	}
+
+	return pagination.NewPage(items, page.Limit, func(i int) pagination.Cursor {
+		return pagination.Cursor{Key: keys[i], ID: items[i].ID.String(), Sort: sortOldest}
+	}).WithTotal(total), nil
+}
+
+// Moderate publishes, hides or rejects a review, resolves its open reports
+// and records the moderator's reason
+func (s *Service) Moderate(ctx context.Context, reviewID, moderatorID uuid.UUID, action, reason string) error {
+	var status, reportStatus string
+	switch action {
+	case ActionPublish:
+		status, reportStatus = StatusPublished, "dismissed"
+	case ActionHide:
+		status, reportStatus = StatusHidden, "resolved"
+	case ActionReject:
+		status, reportStatus = StatusRejected, "resolved"
+	default:
+		return ErrInvalidAction
+	}
+	if action != ActionPublish && strings.TrimSpace(reason) == "" {
+		return ErrReasonRequired
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var sellerID uuid.UUID
+	var previous string
+	err = tx.QueryRowContext(ctx, `SELECT seller_id, status FROM reviews WHERE id = $1 FOR UPDATE`, reviewID).
+		Scan(&sellerID, &previous)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrReviewNotFound
+		}
+		return fmt.Errorf("failed to load review: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE reviews
+		SET status = $1, moderated_by = $2, moderated_at = now(), moderation_note = $3
+		WHERE id = $4`, status, moderatorID, reason, reviewID)
+	if err != nil {
+		return fmt.Errorf("failed to moderate review: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE review_reports
+		SET status = $1, resolved_by = $2, resolved_at = now()
+		WHERE review_id = $3 AND status = 'open'`, reportStatus, moderatorID, reviewID)
+	if err != nil {
+		return fmt.Errorf("failed to resolve reports: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO review_moderation_actions (review_id, moderator_id, action, previous_status, reason)
+		VALUES ($1, $2, $3, $4, $5)`, reviewID, moderatorID, action, previous, reason)
+	if err != nil {
+		return fmt.Errorf("failed to record moderation action: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit moderation: %w", err)
+	}
+
+	// Only changes in and out of the published set affect reputation
+	if (previous == StatusPublished) != (status == StatusPublished) {
+		s.notify(sellerID)
+	}
+
+	return nil
+}
+
+func (s *Service) notify(sellerID uuid.UUID) {
+	if s.notifier != nil {
+		s.notifier.Enqueue(sellerID, reputation.EventRatingCreated)
+	}
+}
+
+func validReportReason(reason string) bool {
+	for _, r := range ReportReasons {
+		if r == reason {
+			return true
+		}
+	}
+	return false
+}
+
+func insertFlags(ctx context.Context, tx *sql.Tx, reviewID uuid.UUID, reasons []string, source string) error {
+	for _, reason := range reasons {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO review_flags (review_id, reason, source)
+			VALUES ($1, $2, $3)`, reviewID, reason, source)
+		if err != nil {
+			return fmt.Errorf("failed to flag review: %w", err)
+		}
+	}
+	return nil
+}
+
+var selectReviews = selectReviewsWith()
+
+// selectReviewsWith is selectReviews followed by any extra columns
+func selectReviewsWith(extra ...string) string {
+	columns := append([]string{"rr.seller_id", "rr.body", "rr.created_at"}, extra...)
+	return `
+	SELECT r.id, r.order_id, r.buyer_id, COALESCE(u.name, ''), r.seller_id, r.rating,
+	       COALESCE(r.comment, ''), r.verified_purchase, r.status, r.created_at,
+	       ` + strings.Join(columns, ", ") + `
+	FROM reviews r
+	LEFT JOIN users u ON r.buyer_id = u.id
+	LEFT JOIN review_replies rr ON rr.review_id = r.id`
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanReview reads a row of selectReviews; extra receives any extra columns
+func scanReview(row rowScanner, extra ...interface{}) (*Review, error) {
+	var review Review
+	var replySeller uuid.NullUUID
+	var replyBody sql.NullString
+	var replyCreated sql.NullTime
+
+	dest := []interface{}{
+		&review.ID, &review.OrderID, &review.BuyerID, &review.BuyerName, &review.SellerID, &review.Rating,
+		&review.Comment, &review.VerifiedPurchase, &review.Status, &review.CreatedAt,
+		&replySeller, &replyBody, &replyCreated,
+	}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+
+	if replyBody.Valid {
+		review.Reply = &Reply{
+			SellerID:  replySeller.UUID,
+			Body:      replyBody.String,
+			CreatedAt: replyCreated.Time,
+		}
+	}
+
+	return &review, nil
+}
@@ -0,0 +1,269 @@
+package search
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/google/uuid"
+)
+
+// Term kinds
+const (
+	// KindSynonym links words with the same meaning, e.g. "dap" and "fertilizer"
+	KindSynonym = "synonym"
+	// KindSpelling links spelling variants, e.g. "fertiliser" and "fertilizer"
+	KindSpelling = "spelling"
+	// KindTranslation links a local-language word to its English term, e.g. "mbolea" and "fertilizer"
+	KindTranslation = "translation"
+)
+
+// maxPhraseWords is the longest multi-word term the analyzer looks up, e.g. "sukuma wiki"
+const maxPhraseWords = 3
+
+// Dictionary errors
+var (
+	ErrTermNotFound  = errors.New("search term not found")
+	ErrInvalidTerm   = errors.New("invalid search term")
+	ErrDuplicateTerm = errors.New("search term already exists")
+)
+
+// Term is one dictionary entry. Entries work in both directions: a query
+// for either side also matches listings that use the other.
+type Term struct {
+	ID        uuid.UUID `json:"id"`
+	Term      string    `json:"term"`
+	Expansion string    `json:"expansion"`
+	Kind      string    `json:"kind"`
+	Locale    string    `json:"locale"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Validate normalises the entry and checks it can be stored
+func (t *Term) Validate() error {
+	t.Term = normalisePhrase(t.Term)
+	t.Expansion = normalisePhrase(t.Expansion)
+	t.Locale = strings.ToLower(strings.TrimSpace(t.Locale))
+	if t.Locale == "" {
+		t.Locale = "en"
+	}
+
+	switch {
+	case t.Term == "" || t.Expansion == "":
+		return fmt.Errorf("%w: term and expansion are required", ErrInvalidTerm)
+	case t.Term == t.Expansion:
+		return fmt.Errorf("%w: term and expansion must differ", ErrInvalidTerm)
+	case len(strings.Fields(t.Term)) > maxPhraseWords:
+		return fmt.Errorf("%w: terms are at most %d words", ErrInvalidTerm, maxPhraseWords)
+	case t.Kind != KindSynonym && t.Kind != KindSpelling && t.Kind != KindTranslation:
+		return fmt.Errorf("%w: unknown kind %q", ErrInvalidTerm, t.Kind)
+	}
+	return nil
+}
+
+// Dictionary maps words and phrases to their alternatives
+type Dictionary struct {
+	mu    sync.RWMutex
+	terms map[string][]string
+}
+
+// NewDictionary builds a dictionary from entries
+func NewDictionary(entries []Term) *Dictionary {
+	d := &Dictionary{}
+	d.Replace(entries)
+	return d
+}
+
+// Replace swaps the dictionary contents for entries
+func (d *Dictionary) Replace(entries []Term) {
+	terms := make(map[string][]string)
+	link := func(from, to string) {
+		for _, existing := range terms[from] {
+			if existing == to {
+				return
+			}
+		}
+		terms[from] = append(terms[from], to)
+	}
+	for _, e := range entries {
+		term, expansion := normalisePhrase(e.Term), normalisePhrase(e.Expansion)
+		if term == "" || expansion == "" || term == expansion {
+			continue
+		}
+		link(term, expansion)
+		link(expansion, term)
+	}
+	for _, alternatives := range terms {
+		sort.Strings(alternatives)
+	}
+
+	d.mu.Lock()
+	d.terms = terms
+	d.mu.Unlock()
+}
+
+// Alternatives returns the phrases linked to phrase, without phrase itself
+func (d *Dictionary) Alternatives(phrase string) []string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.terms[normalisePhrase(phrase)]
+}
+
+// Clause is one part of a query: a word or dictionary phrase and the
+// alternatives that also satisfy it
+type Clause struct {
+	Text         string   `json:"text"`
+	Alternatives []string `json:"alternatives,omitempty"`
+}
+
+// TSQuery renders the clause as a prefix-matching tsquery, e.g.
+// "(dap:* | fertilizer:* | diammonium:* <-> phosphate:*)"
+func (c Clause) TSQuery() string {
+	options := make([]string, 0, len(c.Alternatives)+1)
+	for _, phrase := range append([]string{c.Text}, c.Alternatives...) {
+		words := strings.Fields(phrase)
+		for i, w := range words {
+			words[i] = w + ":*"
+		}
+		options = append(options, strings.Join(words, " <-> "))
+	}
+	return "(" + strings.Join(options, " | ") + ")"
+}
+
+// Plan is an analysed query
+type Plan struct {
+	Text    string   `json:"text"`
+	Clauses []Clause `json:"clauses"`
+}
+
+// Empty reports whether the query has nothing to match
+func (p Plan) Empty() bool {
+	return len(p.Clauses) == 0
+}
+
+// MatchAny renders a tsquery matching any clause; used for ranking so
+// listings that match more of the query rank higher
+func (p Plan) MatchAny() string {
+	parts := make([]string, len(p.Clauses))
+	for i, c := range p.Clauses {
+		parts[i] = c.TSQuery()
+	}
+	return strings.Join(parts, " | ")
+}
+
+// Analyze splits a query into clauses, preferring the longest dictionary
+// phrase at each position
+func (d *Dictionary) Analyze(query string) Plan {
+	words := strings.Fields(normalisePhrase(query))
+	plan := Plan{Text: strings.Join(words, " ")}
+
+	for i := 0; i < len(words); {
+		size := 1
+		var alternatives []string
+		for n := min(maxPhraseWords, len(words)-i); n > 0; n-- {
+			if alt := d.Alternatives(strings.Join(words[i:i+n], " ")); len(alt) > 0 {
+				size, alternatives = n, alt
+				break
+			}
+		}
+		plan.Clauses = append(plan.Clauses, Clause{
+			Text:         strings.Join(words[i:i+size], " "),
+			Alternatives: alternatives,
+		})
+		i += size
+	}
+	return plan
+}
+
+// normalisePhrase lowercases s and keeps letters and digits, so the result
+// is safe to embed in a tsquery
+func normalisePhrase(s string) string {
+	cleaned := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return ' '
+	}, s)
+	return strings.Join(strings.Fields(cleaned), " ")
+}
+
+// Store persists dictionary entries in search_terms
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+// List returns all entries, optionally for one locale
+func (s *Store) List(ctx context.Context, locale string) ([]Term, error) {
+	query := `
+		SELECT id, term, expansion, kind, locale, created_at
+		FROM search_terms`
+	var args []interface{}
+	if locale != "" {
+		query += ` WHERE locale = $1`
+		args = append(args, locale)
+	}
+	query += ` ORDER BY term, expansion`
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list search terms: %w", err)
+	}
+	defer rows.Close()
+
+	terms := []Term{}
+	for rows.Next() {
+		var t Term
+		if err := rows.Scan(&t.ID, &t.Term, &t.Expansion, &t.Kind, &t.Locale, &t.CreatedAt); err != nil {
+			return nil, err
+		}
+		terms = append(terms, t)
+	}
+	return terms, rows.Err()
+}
+
+// Create stores a new entry
+func (s *Store) Create(ctx context.Context, t *Term) error {
+	if err := t.Validate(); err != nil {
+		return err
+	}
+
+	err := s.db.QueryRowContext(ctx, `
+		INSERT INTO search_terms (term, expansion, kind, locale)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (term, expansion) DO NOTHING
+		RETURNING id, created_at
+	`, t.Term, t.Expansion, t.Kind, t.Locale).Scan(&t.ID, &t.CreatedAt)
+	if err == sql.ErrNoRows {
+		return ErrDuplicateTerm
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create search term: %w", err)
+	}
+	return nil
+}
+
+// Delete removes an entry
+func (s *Store) Delete(ctx context.Context, id uuid.UUID) error {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM search_terms WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete search term: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrTermNotFound
+	}
+	return nil
+}
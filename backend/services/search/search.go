@@ -0,0 +1,541 @@
+package search
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Andrew-mugwe/agroai/models"
+	"github.com/Andrew-mugwe/agroai/pagination"
+	"github.com/Andrew-mugwe/agroai/repository"
+	"github.com/google/uuid"
+)
+
+// Sort orders
+const (
+	SortRelevance = "relevance"
+	SortNewest    = "newest"
+	SortPriceAsc  = "price_asc"
+	SortPriceDesc = "price_desc"
+	// SortUnitPriceAsc orders by the cheapest price per base unit; it needs Query.BaseUnit
+	SortUnitPriceAsc = "unit_price_asc"
+	// SortDistance orders nearest sellers first; it needs Query.Near
+	SortDistance = "distance"
+)
+
+// PriceBand is a price facet bucket in cents; Max is exclusive and nil means no upper bound
+type PriceBand struct {
+	Key   string `json:"key"`
+	Label string `json:"label"`
+	Min   int64  `json:"min"`
+	Max   *int64 `json:"max,omitempty"`
+}
+
+func cents(v int64) *int64 { return &v }
+
+// PriceBands are the price facet buckets, in the default currency
+var PriceBands = []PriceBand{
+	{Key: "under_500", Label: "Under 500", Min: 0, Max: cents(50000)},
+	{Key: "500_2000", Label: "500 - 2,000", Min: 50000, Max: cents(200000)},
+	{Key: "2000_10000", Label: "2,000 - 10,000", Min: 200000, Max: cents(1000000)},
+	{Key: "over_10000", Label: "Over 10,000", Min: 1000000},
+}
+
+// Weights blend the ranking signals; each signal is scaled to 0..1
+type Weights struct {
+	Text       float64 `json:"text"`
+	Fuzzy      float64 `json:"fuzzy"`
+	Reputation float64 `json:"reputation"`
+}
+
+// Config tunes matching and ranking
+type Config struct {
+	Weights Weights
+	// FuzzyThreshold is the minimum pg_trgm word similarity for a typo to
+	// match. It is set as pg_trgm.word_similarity_threshold so the <%
+	// operator can use the trigram index on titles.
+	FuzzyThreshold float64
+	// FuzzyMinLength is the shortest word matched fuzzily; shorter words
+	// such as "dap" only match exactly or through the dictionary
+	FuzzyMinLength int
+	// NeutralReputation is used for sellers without a reputation score
+	NeutralReputation float64
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Weights:           Weights{Text: 0.6, Fuzzy: 0.15, Reputation: 0.25},
+		FuzzyThreshold:    0.5,
+		FuzzyMinLength:    4,
+		NeutralReputation: 50,
+	}
+}
+
+// Query is a faceted search request. Facet filters (Category, PriceBand,
+// Verified, Location, InStock) narrow results and the other facets' counts.
+type Query struct {
+	Text      string
+	Category  string
+	PriceBand string
+	MinPrice  *int64
+	MaxPrice  *int64
+	Verified  *bool
+	Location  string
+	InStock   *bool
+	SellerID  *uuid.UUID
+	BaseUnit  models.UnitOfMeasure
+	// Near, RadiusKm and DeliversTo work as in repository.ProductFilter
+	Near       *models.GeoPoint
+	RadiusKm   float64
+	DeliversTo bool
+	Sort       string
+	Page       pagination.Params
+}
+
+// FacetValue is one bucket and the number of listings in it
+type FacetValue struct {
+	Value string `json:"value"`
+	Label string `json:"label,omitempty"`
+	Count int    `json:"count"`
+}
+
+// Facets are counts for each filterable dimension. Each facet is counted
+// with every filter except its own, so selecting a category still shows
+// how many listings the other categories have.
+type Facets struct {
+	Category       []FacetValue `json:"category"`
+	PriceBand      []FacetValue `json:"price_band"`
+	SellerVerified []FacetValue `json:"seller_verified"`
+	Location       []FacetValue `json:"location"`
+	InStock        []FacetValue `json:"in_stock"`
+}
+
+// Result is a page of ranked listings with facet counts
+type Result struct {
+	Page   pagination.Page[*models.Product] `json:"-"`
+	Facets Facets                           `json:"facets"`
+	Plan   Plan                             `json:"query"`
+}
+
+// Service runs catalogue searches. Matching and ranking run here; the
+// listings themselves are loaded through the product repository.
+type Service struct {
+	db       *sql.DB
+	products repository.ProductRepository
+	dict     *Dictionary
+	store    *Store
+	config   Config
+}
+
+func NewService(db *sql.DB, products repository.ProductRepository) *Service {
+	return &Service{
+		db:       db,
+		products: products,
+		dict:     NewDictionary(nil),
+		store:    NewStore(db),
+		config:   DefaultConfig(),
+	}
+}
+
+// Dictionary returns the live dictionary
+func (s *Service) Dictionary() *Dictionary {
+	return s.dict
+}
+
+// Store returns the dictionary store
+func (s *Service) Store() *Store {
+	return s.store
+}
+
+// ReloadDictionary reads the dictionary from the database
+func (s *Service) ReloadDictionary(ctx context.Context) error {
+	terms, err := s.store.List(ctx, "")
+	if err != nil {
+		return err
+	}
+	s.dict.Replace(terms)
+	log.Printf("search: loaded %d dictionary terms", len(terms))
+	return nil
+}
+
+// Search matches, ranks and facets active listings
+func (s *Service) Search(ctx context.Context, q Query) (*Result, error) {
+	if q.Page.Limit <= 0 {
+		q.Page.Limit = 12
+	}
+	q.Page = q.Page.Normalize()
+
+	if q.Near != nil && q.Near.Validate() != nil {
+		q.Near = nil
+	}
+
+	plan := s.dict.Analyze(q.Text)
+	b := s.newBuilder(plan, q)
+
+	result := &Result{Plan: plan}
+
+	// The threshold is a setting, so the matching queries share a
+	// transaction to see it
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to start search: %w", err)
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, `SELECT set_config('pg_trgm.word_similarity_threshold', $1, true)`,
+		sqlFloat(s.config.FuzzyThreshold)); err != nil {
+		return nil, fmt.Errorf("failed to set fuzzy threshold: %w", err)
+	}
+
+	var total int
+	where, args := b.where("")
+	if err := tx.QueryRowContext(ctx, `SELECT COUNT(*)`+searchFrom+where, args...).Scan(&total); err != nil {
+		return nil, fmt.Errorf("failed to count search results: %w", err)
+	}
+
+	ranked, distances, err := s.rankedIDs(ctx, tx, b, q)
+	if err != nil {
+		return nil, err
+	}
+	items, err := s.products.ListByIDs(ctx, ranked.Items)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load search results: %w", err)
+	}
+	result.Page = pagination.Page[*models.Product]{Items: items, Limit: ranked.Limit, Next: ranked.Next}.WithTotal(total)
+	for _, p := range result.Page.Items {
+		if d, ok := distances[p.ID]; ok {
+			p.DistanceKm = d
+		}
+	}
+
+	if result.Facets, err = s.facets(ctx, tx, b); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// searchFrom joins each listing to its seller and latest reputation score
+const searchFrom = `
+		FROM marketplace_products p
+		LEFT JOIN sellers s ON s.user_id = p.seller_id
+		LEFT JOIN LATERAL (
+			SELECT rh.score FROM reputation_history rh
+			WHERE rh.user_id = p.seller_id
+			ORDER BY rh.created_at DESC
+			LIMIT 1
+		) rep ON true`
+
+// locationExpr is the seller's city, falling back to the country
+const locationExpr = repository.SellerLocationExpr
+
+// Facet names, used to leave a facet's own filter out of its counts
+const (
+	facetCategory = "category"
+	facetPrice    = "price_band"
+	facetVerified = "seller_verified"
+	facetLocation = "location"
+	facetInStock  = "in_stock"
+	facetNone     = ""
+)
+
+type condition struct {
+	facet string
+	sql   string
+	args  []interface{}
+}
+
+// builder collects conditions with numbered placeholders that are
+// renumbered per statement
+type builder struct {
+	conditions []condition
+	plan       Plan
+	config     Config
+	// distanceKm is the seller distance column, NULL without Query.Near
+	distanceKm string
+}
+
+func (s *Service) newBuilder(plan Plan, q Query) *builder {
+	b := &builder{plan: plan, config: s.config, distanceKm: "NULL::float8"}
+
+	b.add(facetNone, "p.is_active = true")
+	for _, c := range plan.Clauses {
+		if utf8.RuneCountInString(c.Text) >= s.config.FuzzyMinLength && !strings.Contains(c.Text, " ") {
+			b.add(facetNone, "(p.search_tsv @@ to_tsquery('simple', ?) OR ? <% p.title)", c.TSQuery(), c.Text)
+		} else {
+			b.add(facetNone, "p.search_tsv @@ to_tsquery('simple', ?)", c.TSQuery())
+		}
+	}
+	if q.SellerID != nil {
+		b.add(facetNone, "p.seller_id = ?", *q.SellerID)
+	}
+	if q.MinPrice != nil {
+		b.add(facetNone, "p.price_cents >= ?", *q.MinPrice)
+	}
+	if q.MaxPrice != nil {
+		b.add(facetNone, "p.price_cents <= ?", *q.MaxPrice)
+	}
+	if q.Near != nil {
+		// Coordinates are validated floats, so they are inlined rather than
+		// bound; each appears several times in the geo expressions
+		lat, lng := sqlFloat(q.Near.Lat), sqlFloat(q.Near.Lng)
+		b.distanceKm = repository.SellerDistanceKmSQL(lat, lng)
+		if q.RadiusKm > 0 {
+			b.add(facetNone, repository.SellerWithinSQL(lat, lng, sqlFloat(q.RadiusKm*1000)))
+		}
+		if q.DeliversTo {
+			b.add(facetNone, repository.SellerDeliversToSQL(lat, lng))
+		}
+	}
+	if q.BaseUnit != "" {
+		b.add(facetNone, `EXISTS (
+			SELECT 1 FROM product_variants v
+			WHERE v.product_id = p.id AND v.is_active AND v.base_unit = ?)`, q.BaseUnit)
+	}
+
+	if q.Category != "" {
+		b.add(facetCategory, "p.category::text = ?", q.Category)
+	}
+	if band, ok := priceBand(q.PriceBand); ok {
+		if band.Max != nil {
+			b.add(facetPrice, "p.price_cents >= ? AND p.price_cents < ?", band.Min, *band.Max)
+		} else {
+			b.add(facetPrice, "p.price_cents >= ?", band.Min)
+		}
+	}
+	if q.Verified != nil {
+		b.add(facetVerified, "COALESCE(s.verified, false) = ?", *q.Verified)
+	}
+	if location := strings.TrimSpace(q.Location); location != "" {
+		b.add(facetLocation, "lower("+locationExpr+") = lower(?)", location)
+	}
+	if q.InStock != nil {
+		b.add(facetInStock, "(p.stock > 0) = ?", *q.InStock)
+	}
+	return b
+}
+
+func (b *builder) add(facet, sql string, args ...interface{}) {
+	b.conditions = append(b.conditions, condition{facet: facet, sql: sql, args: args})
+}
+
+// where renders every condition except those of the excluded facet
+func (b *builder) where(exclude string) (string, []interface{}) {
+	var parts []string
+	var args []interface{}
+	for _, c := range b.conditions {
+		if exclude != facetNone && c.facet == exclude {
+			continue
+		}
+		parts = append(parts, c.sql)
+		args = append(args, c.args...)
+	}
+	return number(" WHERE "+strings.Join(parts, " AND "), 0), args
+}
+
+// number replaces each ? with $n, starting after offset
+func number(sql string, offset int) string {
+	var sb strings.Builder
+	n := offset
+	for _, r := range sql {
+		if r == '?' {
+			n++
+			fmt.Fprintf(&sb, "$%d", n)
+			continue
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+// score blends text relevance, fuzzy title similarity and seller reputation
+func (b *builder) score(offset int) (string, []interface{}) {
+	w := b.config.Weights
+	reputation := fmt.Sprintf("COALESCE(rep.score, %g) / 100.0", b.config.NeutralReputation)
+	if b.plan.Empty() {
+		return number(fmt.Sprintf("%g * %s", w.Reputation, reputation), offset), nil
+	}
+	expr := fmt.Sprintf(
+		"%g * ts_rank_cd(p.search_tsv, to_tsquery('simple', ?), 32) + %g * word_similarity(?, p.title) + %g * %s",
+		w.Text, w.Fuzzy, w.Reputation, reputation)
+	return number(expr, offset), []interface{}{b.plan.MatchAny(), b.plan.Text}
+}
+
+// sortOf is the effective sort order of q: relevance for text queries and
+// newest otherwise, unless q asks for one it has the filters for
+func sortOf(q Query, plan Plan) string {
+	switch q.Sort {
+	case SortNewest, SortPriceAsc, SortPriceDesc:
+		return q.Sort
+	case SortDistance:
+		if q.Near != nil {
+			return q.Sort
+		}
+	case SortUnitPriceAsc:
+		if q.BaseUnit != "" {
+			return q.Sort
+		}
+	}
+	if plan.Empty() {
+		return SortNewest
+	}
+	return SortRelevance
+}
+
+// rankedIDs returns the page of matching IDs in rank order with each
+// listing's distance. Listings are ranked in a subquery so the keyset can
+// compare the computed sort key.
+func (s *Service) rankedIDs(ctx context.Context, tx *sql.Tx, b *builder, q Query) (pagination.Page[uuid.UUID], map[uuid.UUID]*float64, error) {
+	var none pagination.Page[uuid.UUID]
+
+	where, args := b.where("")
+
+	sort := sortOf(q, b.plan)
+	after, err := q.Page.After(sort)
+	if err != nil {
+		return none, nil, err
+	}
+
+	var sortKey string
+	dir := pagination.Desc
+	switch sort {
+	case SortRelevance:
+		var scoreArgs []interface{}
+		sortKey, scoreArgs = b.score(len(args))
+		args = append(args, scoreArgs...)
+	case SortNewest:
+		sortKey = "p.created_at"
+	case SortPriceAsc:
+		sortKey, dir = "p.price_cents", pagination.Asc
+	case SortPriceDesc:
+		sortKey = "p.price_cents"
+	case SortDistance:
+		// Sellers without coordinates sort last
+		sortKey, dir = "COALESCE("+b.distanceKm+", 'Infinity'::float8)", pagination.Asc
+	case SortUnitPriceAsc:
+		args = append(args, q.BaseUnit)
+		sortKey, dir = fmt.Sprintf(`(
+			SELECT MIN(v.unit_price_cents) FROM product_variants v
+			WHERE v.product_id = p.id AND v.is_active AND v.base_unit = $%d)`, len(args)), pagination.Asc
+	}
+	keyset := pagination.Keyset{Key: "ranked.sort_key", ID: "ranked.id", Dir: dir}
+
+	ranked := fmt.Sprintf(`SELECT p.id, %s AS distance_km, %s AS sort_key%s%s`, b.distanceKm, sortKey, searchFrom, where)
+	var afterCond string
+	if after != nil {
+		args = append(args, after.Key, after.ID)
+		afterCond = " WHERE " + keyset.After(fmt.Sprintf("$%d", len(args)-1), fmt.Sprintf("$%d", len(args)))
+	}
+	args = append(args, q.Page.FetchLimit())
+	query := fmt.Sprintf(`SELECT ranked.id, ranked.distance_km, %s FROM (%s) ranked%s ORDER BY %s LIMIT $%d`,
+		keyset.KeyText(), ranked, afterCond, keyset.OrderBy(), len(args))
+
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return none, nil, fmt.Errorf("failed to search products: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []uuid.UUID
+	var keys []string
+	distances := make(map[uuid.UUID]*float64)
+	for rows.Next() {
+		var id uuid.UUID
+		var distance *float64
+		var key string
+		if err := rows.Scan(&id, &distance, &key); err != nil {
+			return none, nil, err
+		}
+		ids = append(ids, id)
+		keys = append(keys, key)
+		distances[id] = distance
+	}
+	if err := rows.Err(); err != nil {
+		return none, nil, err
+	}
+
+	page := pagination.NewPage(ids, q.Page.Limit, func(i int) pagination.Cursor {
+		return pagination.Cursor{Key: keys[i], ID: ids[i].String(), Sort: sort}
+	})
+	return page, distances, nil
+}
+
+func (s *Service) facets(ctx context.Context, tx *sql.Tx, b *builder) (Facets, error) {
+	var f Facets
+	var err error
+
+	if f.Category, err = s.countBy(ctx, tx, b, facetCategory, "p.category::text"); err != nil {
+		return f, err
+	}
+	if f.SellerVerified, err = s.countBy(ctx, tx, b, facetVerified, "COALESCE(s.verified, false)::text"); err != nil {
+		return f, err
+	}
+	if f.Location, err = s.countBy(ctx, tx, b, facetLocation, locationExpr); err != nil {
+		return f, err
+	}
+	if f.InStock, err = s.countBy(ctx, tx, b, facetInStock, "(p.stock > 0)::text"); err != nil {
+		return f, err
+	}
+
+	// Price bands are counted in one pass so empty bands are still listed
+	where, args := b.where(facetPrice)
+	var cols []string
+	for _, band := range PriceBands {
+		cond := fmt.Sprintf("p.price_cents >= %d", band.Min)
+		if band.Max != nil {
+			cond += fmt.Sprintf(" AND p.price_cents < %d", *band.Max)
+		}
+		cols = append(cols, "COUNT(*) FILTER (WHERE "+cond+")")
+	}
+	counts := make([]int, len(PriceBands))
+	dest := make([]interface{}, len(counts))
+	for i := range counts {
+		dest[i] = &counts[i]
+	}
+	if err := tx.QueryRowContext(ctx, "SELECT "+strings.Join(cols, ", ")+searchFrom+where, args...).Scan(dest...); err != nil {
+		return f, fmt.Errorf("failed to count price facets: %w", err)
+	}
+	for i, band := range PriceBands {
+		f.PriceBand = append(f.PriceBand, FacetValue{Value: band.Key, Label: band.Label, Count: counts[i]})
+	}
+
+	return f, nil
+}
+
+// countBy groups matching listings by expr, leaving facet's own filter out
+func (s *Service) countBy(ctx context.Context, tx *sql.Tx, b *builder, facet, expr string) ([]FacetValue, error) {
+	where, args := b.where(facet)
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf(`
+		SELECT %[1]s AS value, COUNT(*)%[2]s%[3]s AND %[1]s IS NOT NULL
+		GROUP BY 1
+		ORDER BY 2 DESC, 1`, expr, searchFrom, where), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count %s facet: %w", facet, err)
+	}
+	defer rows.Close()
+
+	values := []FacetValue{}
+	for rows.Next() {
+		var v FacetValue
+		if err := rows.Scan(&v.Value, &v.Count); err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, rows.Err()
+}
+
+func sqlFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+func priceBand(key string) (PriceBand, bool) {
+	for _, band := range PriceBands {
+		if band.Key == key {
+			return band, true
+		}
+	}
+	return PriceBand{}, false
+}
@@ -0,0 +1,100 @@
+package search
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testDictionary() *Dictionary {
+	return NewDictionary([]Term{
+		{Term: "fertiliser", Expansion: "fertilizer", Kind: KindSpelling},
+		{Term: "DAP", Expansion: "fertilizer", Kind: KindSynonym},
+		{Term: "dap", Expansion: "diammonium phosphate", Kind: KindSynonym},
+		{Term: "mbolea", Expansion: "fertilizer", Kind: KindTranslation, Locale: "sw"},
+		{Term: "sukuma wiki", Expansion: "kale", Kind: KindTranslation, Locale: "sw"},
+	})
+}
+
+func TestAnalyzeExpandsDictionaryTerms(t *testing.T) {
+	plan := testDictionary().Analyze("  Mbolea, 50kg! ")
+
+	assert.Equal(t, "mbolea 50kg", plan.Text)
+	assert.Len(t, plan.Clauses, 2)
+	assert.Equal(t, Clause{Text: "mbolea", Alternatives: []string{"fertilizer"}}, plan.Clauses[0])
+	assert.Equal(t, Clause{Text: "50kg"}, plan.Clauses[1])
+	assert.Equal(t, "(mbolea:* | fertilizer:*) | (50kg:*)", plan.MatchAny())
+}
+
+func TestAnalyzeWorksInBothDirections(t *testing.T) {
+	plan := testDictionary().Analyze("fertilizer")
+
+	assert.Equal(t, []string{"dap", "fertiliser", "mbolea"}, plan.Clauses[0].Alternatives)
+}
+
+func TestAnalyzePrefersLongestPhrase(t *testing.T) {
+	plan := testDictionary().Analyze("sukuma wiki seeds")
+
+	assert.Len(t, plan.Clauses, 2)
+	assert.Equal(t, "sukuma wiki", plan.Clauses[0].Text)
+	assert.Equal(t, "(sukuma:* <-> wiki:* | kale:*)", plan.Clauses[0].TSQuery())
+}
+
+func TestClauseTSQueryRendersPhrases(t *testing.T) {
+	clause := testDictionary().Analyze("dap").Clauses[0]
+
+	assert.Equal(t, "(dap:* | diammonium:* <-> phosphate:* | fertilizer:*)", clause.TSQuery())
+}
+
+func TestAnalyzeDropsTSQueryOperators(t *testing.T) {
+	plan := NewDictionary(nil).Analyze("maize & !(seed:*) | 'x'")
+
+	assert.Equal(t, "maize seed x", plan.Text)
+	assert.False(t, strings.ContainsAny(plan.MatchAny(), "&!'"))
+}
+
+func TestTermValidate(t *testing.T) {
+	term := Term{Term: " Mbegu ", Expansion: "Seeds", Kind: KindTranslation, Locale: "SW"}
+	assert.NoError(t, term.Validate())
+	assert.Equal(t, "mbegu", term.Term)
+	assert.Equal(t, "seeds", term.Expansion)
+	assert.Equal(t, "sw", term.Locale)
+
+	assert.ErrorIs(t, (&Term{Term: "seed", Expansion: "SEED", Kind: KindSynonym}).Validate(), ErrInvalidTerm)
+	assert.ErrorIs(t, (&Term{Term: "seed", Expansion: "seeds", Kind: "other"}).Validate(), ErrInvalidTerm)
+	assert.ErrorIs(t, (&Term{Term: "", Expansion: "seeds", Kind: KindSynonym}).Validate(), ErrInvalidTerm)
+}
+
+func TestFacetCountsLeaveOutOwnFilter(t *testing.T) {
+	verified, inStock := true, true
+	s := &Service{config: DefaultConfig()}
+	b := s.newBuilder(testDictionary().Analyze("dap"), Query{
+		Category:  "fertilizer",
+		PriceBand: "500_2000",
+		Verified:  &verified,
+		InStock:   &inStock,
+	})
+
+	where, args := b.where("")
+	assert.Contains(t, where, "p.category::text = $2")
+	assert.Contains(t, where, "p.price_cents >= $3 AND p.price_cents < $4")
+	assert.Len(t, args, 6)
+
+	where, args = b.where(facetCategory)
+	assert.NotContains(t, where, "p.category")
+	assert.Contains(t, where, "p.price_cents >= $2 AND p.price_cents < $3")
+	assert.Len(t, args, 5)
+}
+
+func TestFuzzyMatchingSkipsShortWords(t *testing.T) {
+	s := &Service{config: DefaultConfig()}
+
+	where, _ := s.newBuilder(NewDictionary(nil).Analyze("dap"), Query{}).where("")
+	assert.NotContains(t, where, "<%")
+
+	where, args := s.newBuilder(NewDictionary(nil).Analyze("fertilzer"), Query{}).where("")
+	assert.Contains(t, where, "$2 <% p.title")
+	assert.Equal(t, "fertilzer", args[1])
+	assert.Len(t, args, 2, "the threshold is a setting, not an argument")
+}
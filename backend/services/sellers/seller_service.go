@@ -7,6 +7,10 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/Andrew-mugwe/agroai/models"
+	"github.com/Andrew-mugwe/agroai/pagination"
+	"github.com/Andrew-mugwe/agroai/services/reputation"
+	"github.com/Andrew-mugwe/agroai/services/reviews"
 	"github.com/google/uuid"
 	"github.com/shopspring/decimal"
 )
@@ -20,8 +24,11 @@ type Seller struct {
 	ProfileImage string    `json:"profile_image,omitempty"`
 	Location     Location  `json:"location"`
 	Verified     bool      `json:"verified"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	// VerificationLevel and VerificationExpiresAt are maintained by the KYC workflow
+	VerificationLevel     models.VerificationLevel `json:"verification_level"`
+	VerificationExpiresAt *time.Time               `json:"verification_expires_at,omitempty"`
+	CreatedAt             time.Time                `json:"created_at"`
+	UpdatedAt             time.Time                `json:"updated_at"`
 }
 
 // Location represents seller location information
@@ -32,16 +39,15 @@ type Location struct {
 	Lng     *float64 `json:"lng,omitempty"`
 }
 
-// Review represents a seller review
-type Review struct {
-	ID        uuid.UUID  `json:"id"`
-	OrderID   *uuid.UUID `json:"order_id,omitempty"`
-	BuyerID   uuid.UUID  `json:"buyer_id"`
-	BuyerName string     `json:"buyer_name,omitempty"`
-	SellerID  uuid.UUID  `json:"seller_id"`
-	Rating    int        `json:"rating"`
-	Comment   string     `json:"comment,omitempty"`
-	CreatedAt time.Time  `json:"created_at"`
+// Validate checks that coordinates, when given, are complete and in range
+func (l Location) Validate() error {
+	if l.Lat == nil && l.Lng == nil {
+		return nil
+	}
+	if l.Lat == nil || l.Lng == nil {
+		return fmt.Errorf("%w: lat and lng must be given together", models.ErrInvalidLocation)
+	}
+	return models.GeoPoint{Lat: *l.Lat, Lng: *l.Lng}.Validate()
 }
 
 // SellerProfile represents a complete seller profile with stats
@@ -49,12 +55,13 @@ type SellerProfile struct {
 	Seller
 	Stats         SellerStats         `json:"stats"`
 	Reputation    ReputationBreakdown `json:"reputation"`
-	RecentReviews []Review            `json:"recent_reviews,omitempty"`
+	RecentReviews []reviews.Review    `json:"recent_reviews,omitempty"`
 }
 
 // SellerStats represents aggregated seller statistics
 type SellerStats struct {
 	AvgRating       decimal.Decimal `json:"avg_rating"`
+	BayesianRating  decimal.Decimal `json:"bayesian_rating"`
 	TotalReviews    int             `json:"total_reviews"`
 	FiveStarReviews int             `json:"five_star_reviews"`
 	PositiveReviews int             `json:"positive_reviews"`
@@ -77,13 +84,7 @@ type ReputationBreakdown struct {
 	FinalScore      decimal.Decimal `json:"final_score"`
 	Badge           string          `json:"badge"`
 	Message         string          `json:"message"`
-}
-
-// CreateReviewRequest represents a request to create a review
-type CreateReviewRequest struct {
-	OrderID uuid.UUID `json:"order_id" validate:"required"`
-	Rating  int       `json:"rating" validate:"required,min=1,max=5"`
-	Comment string    `json:"comment,omitempty" validate:"max=500"`
+	ModelVersion    string          `json:"model_version"`
 }
 
 // UpdateSellerRequest represents a request to update seller profile
@@ -96,12 +97,18 @@ type UpdateSellerRequest struct {
 
 // SellerService handles seller-related operations
 type SellerService struct {
-	db *sql.DB
+	db      *sql.DB
+	engine  *reputation.Engine
+	reviews *reviews.Service
 }
 
 // NewSellerService creates a new seller service
 func NewSellerService(db *sql.DB) *SellerService {
-	return &SellerService{db: db}
+	return &SellerService{
+		db:      db,
+		engine:  reputation.NewEngine(db),
+		reviews: reviews.NewService(db),
+	}
 }
 
 // GetSellerProfile retrieves a complete seller profile by seller ID
@@ -118,14 +125,14 @@ func (s *SellerService) GetSellerProfile(ctx context.Context, sellerID uuid.UUID
 		return nil, fmt.Errorf("failed to get seller stats: %w", err)
 	}
 
-	// Get reputation breakdown
-	reputation, err := s.ComputeReputation(ctx, sellerID)
+	// Get reputation breakdown (reputation is keyed by the seller's user ID)
+	breakdown, err := s.ComputeReputation(ctx, seller.UserID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to compute reputation: %w", err)
 	}
 
-	// Get recent reviews
-	reviews, err := s.getRecentReviews(ctx, sellerID, 5)
+	// Get recent reviews (reviews are keyed by the seller's user ID)
+	recentReviews, err := s.reviews.ListForSeller(ctx, seller.UserID, pagination.Params{Limit: 5})
 	if err != nil {
 		return nil, fmt.Errorf("failed to get recent reviews: %w", err)
 	}
@@ -133,8 +140,8 @@ func (s *SellerService) GetSellerProfile(ctx context.Context, sellerID uuid.UUID
 	return &SellerProfile{
 		Seller:        *seller,
 		Stats:         *stats,
-		Reputation:    *reputation,
-		RecentReviews: reviews,
+		Reputation:    *breakdown,
+		RecentReviews: recentReviews.Items,
 	}, nil
 }
 
@@ -145,6 +152,10 @@ func (s *SellerService) GetSellerByUserID(ctx context.Context, userID uuid.UUID)
 
 // CreateOrUpdateSellerProfile creates or updates a seller profile
 func (s *SellerService) CreateOrUpdateSellerProfile(ctx context.Context, userID uuid.UUID, req *UpdateSellerRequest) error {
+	if err := req.Location.Validate(); err != nil {
+		return err
+	}
+
 	// Check if seller exists
 	existing, err := s.getSellerByUserID(ctx, userID)
 	if err != nil && err != sql.ErrNoRows {
@@ -160,107 +171,36 @@ func (s *SellerService) CreateOrUpdateSellerProfile(ctx context.Context, userID
 	}
 }
 
-// CreateReview creates a new review for a seller
-func (s *SellerService) CreateReview(ctx context.Context, buyerID uuid.UUID, sellerID uuid.UUID, req *CreateReviewRequest) error {
-	// Validate order ownership and completion
-	if err := s.validateReviewEligibility(ctx, buyerID, req.OrderID); err != nil {
-		return err
-	}
-
-	// Check if review already exists for this order
-	var existingReviewID uuid.UUID
-	checkQuery := `SELECT id FROM reviews WHERE order_id = $1`
-	err := s.db.QueryRowContext(ctx, checkQuery, req.OrderID).Scan(&existingReviewID)
-	if err != sql.ErrNoRows {
-		return fmt.Errorf("review already exists for this order")
-	}
-
-	// Create review
-	query := `
-		INSERT INTO reviews (order_id, buyer_id, seller_id, rating, comment)
-		VALUES ($1, $2, $3, $4, $5)
-		RETURNING id, created_at`
-
-	var reviewID uuid.UUID
-	var createdAt time.Time
-	err = s.db.QueryRowContext(ctx, query, req.OrderID, buyerID, sellerID, req.Rating, req.Comment).
-		Scan(&reviewID, &createdAt)
+// ComputeReputation calculates the reputation score and breakdown for a seller
+func (s *SellerService) ComputeReputation(ctx context.Context, sellerID uuid.UUID) (*ReputationBreakdown, error) {
+	result, err := s.engine.Compute(ctx, sellerID)
 	if err != nil {
-		return fmt.Errorf("failed to create review: %w", err)
+		return nil, fmt.Errorf("failed to calculate reputation score: %w", err)
 	}
 
-	return nil
+	return newReputationBreakdown(result), nil
 }
 
-// GetSellerReviews retrieves reviews for a seller with pagination
-func (s *SellerService) GetSellerReviews(ctx context.Context, sellerID uuid.UUID, limit, offset int) ([]Review, error) {
-	query := `
-		SELECT r.id, r.order_id, r.buyer_id, u.name, r.seller_id, r.rating, r.comment, r.created_at
-		FROM reviews r
-		JOIN users u ON r.buyer_id = u.id
-		WHERE r.seller_id = $1
-		ORDER BY r.created_at DESC
-		LIMIT $2 OFFSET $3`
-
-	rows, err := s.db.QueryContext(ctx, query, sellerID, limit, offset)
-	if err != nil {
-		return nil, fmt.Errorf("failed to query reviews: %w", err)
-	}
-	defer rows.Close()
-
-	var reviews []Review
-	for rows.Next() {
-		var review Review
-		err := rows.Scan(
-			&review.ID, &review.OrderID, &review.BuyerID, &review.BuyerName,
-			&review.SellerID, &review.Rating, &review.Comment, &review.CreatedAt,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan review: %w", err)
-		}
-		reviews = append(reviews, review)
+// RecalculateReputation forces a reputation recalculation and stores it in history
+func (s *SellerService) RecalculateReputation(ctx context.Context, sellerID uuid.UUID) error {
+	if _, err := s.engine.Record(ctx, sellerID, "Manual recalculation"); err != nil {
+		return fmt.Errorf("failed to store reputation history: %w", err)
 	}
 
-	return reviews, nil
+	return nil
 }
 
-// ComputeReputation calculates the reputation score and breakdown for a seller
-func (s *SellerService) ComputeReputation(ctx context.Context, sellerID uuid.UUID) (*ReputationBreakdown, error) {
-	query := `SELECT calculate_reputation_score($1)`
-	var score decimal.Decimal
-	err := s.db.QueryRowContext(ctx, query, sellerID).Scan(&score)
-	if err != nil {
-		return nil, fmt.Errorf("failed to calculate reputation score: %w", err)
-	}
-
-	// Get breakdown components
-	breakdownQuery := `
-		SELECT 
-			COALESCE((AVG(r.rating) - 3) * 10, 0) as rating_contrib,
-			LEAST(COUNT(DISTINCT o.id) * 0.5, 15) as orders_contrib,
-			COALESCE((SELECT COUNT(*) * -2 FROM disputes WHERE seller_id = $1 AND created_at >= NOW() - INTERVAL '180 days' AND status IN ('RESOLVED_BUYER', 'ESCALATED')), 0) as disputes_penalty,
-			(SELECT CASE WHEN verified THEN 10 ELSE 0 END FROM sellers WHERE user_id = $1) as verified_bonus
-		FROM reviews r
-		LEFT JOIN orders o ON r.seller_id = o.seller_id AND o.status = 'completed'
-		WHERE r.seller_id = $1
-		GROUP BY r.seller_id`
-
-	var ratingContrib, ordersContrib, disputesPenalty, verifiedBonus decimal.Decimal
-	err = s.db.QueryRowContext(ctx, breakdownQuery, sellerID).Scan(
-		&ratingContrib, &ordersContrib, &disputesPenalty, &verifiedBonus,
-	)
-	if err != nil && err != sql.ErrNoRows {
-		return nil, fmt.Errorf("failed to get reputation breakdown: %w", err)
-	}
-
-	baseScore := decimal.NewFromInt(50)
+// newReputationBreakdown converts an engine result into the seller-facing breakdown
+func newReputationBreakdown(result reputation.ReputationBreakdown) *ReputationBreakdown {
+	score := decimal.NewFromFloat(result.CalculatedScore)
 	breakdown := &ReputationBreakdown{
-		BaseScore:       baseScore,
-		RatingContrib:   ratingContrib,
-		OrdersContrib:   ordersContrib,
-		DisputesPenalty: disputesPenalty,
-		VerifiedBonus:   verifiedBonus,
+		BaseScore:       decimal.NewFromFloat(result.BaseScore),
+		RatingContrib:   decimal.NewFromFloat(result.RatingContrib),
+		OrdersContrib:   decimal.NewFromFloat(result.OrdersContrib),
+		DisputesPenalty: decimal.NewFromFloat(result.DisputesPenalty),
+		VerifiedBonus:   decimal.NewFromFloat(result.VerifiedBonus),
 		FinalScore:      score,
+		ModelVersion:    result.ModelVersion,
 	}
 
 	// Determine badge and message
@@ -281,54 +221,25 @@ func (s *SellerService) ComputeReputation(ctx context.Context, sellerID uuid.UUI
 		breakdown.Message = "Seller with concerning feedback"
 	}
 
-	return breakdown, nil
-}
-
-// RecalculateReputation forces a reputation recalculation and stores it in history
-func (s *SellerService) RecalculateReputation(ctx context.Context, sellerID uuid.UUID) error {
-	reputation, err := s.ComputeReputation(ctx, sellerID)
-	if err != nil {
-		return fmt.Errorf("failed to compute reputation: %w", err)
-	}
-
-	// Store in reputation history
-	query := `
-		INSERT INTO reputation_history (seller_id, score, breakdown, reason)
-		VALUES ($1, $2, $3, $4)`
-
-	_, err = s.db.ExecContext(ctx, query, sellerID, reputation.FinalScore, reputation, "Manual recalculation")
-	if err != nil {
-		return fmt.Errorf("failed to store reputation history: %w", err)
-	}
-
-	return nil
-}
-
-// VerifySeller updates the verification status of a seller
-func (s *SellerService) VerifySeller(ctx context.Context, sellerID uuid.UUID, verified bool) error {
-	query := `UPDATE sellers SET verified = $1, updated_at = now() WHERE user_id = $2`
-	_, err := s.db.ExecContext(ctx, query, verified, sellerID)
-	if err != nil {
-		return fmt.Errorf("failed to update seller verification: %w", err)
-	}
-
-	// Recalculate reputation as verification affects score
-	return s.RecalculateReputation(ctx, sellerID)
+	return breakdown
 }
 
 // Private helper methods
 
 func (s *SellerService) getSellerByID(ctx context.Context, sellerID uuid.UUID) (*Seller, error) {
 	query := `
-		SELECT id, user_id, name, bio, profile_image, location, verified, created_at, updated_at
+		SELECT id, user_id, name, bio, profile_image, location, verified,
+		       verification_level, verification_expires_at, created_at, updated_at
 		FROM sellers
 		WHERE id = $1`
 
 	var seller Seller
 	var locationJSON []byte
+	var expiresAt sql.NullTime
 	err := s.db.QueryRowContext(ctx, query, sellerID).Scan(
 		&seller.ID, &seller.UserID, &seller.Name, &seller.Bio, &seller.ProfileImage,
-		&locationJSON, &seller.Verified, &seller.CreatedAt, &seller.UpdatedAt,
+		&locationJSON, &seller.Verified, &seller.VerificationLevel, &expiresAt,
+		&seller.CreatedAt, &seller.UpdatedAt,
 	)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -337,6 +248,10 @@ func (s *SellerService) getSellerByID(ctx context.Context, sellerID uuid.UUID) (
 		return nil, fmt.Errorf("failed to get seller: %w", err)
 	}
 
+	if expiresAt.Valid {
+		seller.VerificationExpiresAt = &expiresAt.Time
+	}
+
 	// Parse location JSON
 	if len(locationJSON) > 0 {
 		if err := json.Unmarshal(locationJSON, &seller.Location); err != nil {
@@ -349,20 +264,27 @@ func (s *SellerService) getSellerByID(ctx context.Context, sellerID uuid.UUID) (
 
 func (s *SellerService) getSellerByUserID(ctx context.Context, userID uuid.UUID) (*Seller, error) {
 	query := `
-		SELECT id, user_id, name, bio, profile_image, location, verified, created_at, updated_at
+		SELECT id, user_id, name, bio, profile_image, location, verified,
+		       verification_level, verification_expires_at, created_at, updated_at
 		FROM sellers
 		WHERE user_id = $1`
 
 	var seller Seller
 	var locationJSON []byte
+	var expiresAt sql.NullTime
 	err := s.db.QueryRowContext(ctx, query, userID).Scan(
 		&seller.ID, &seller.UserID, &seller.Name, &seller.Bio, &seller.ProfileImage,
-		&locationJSON, &seller.Verified, &seller.CreatedAt, &seller.UpdatedAt,
+		&locationJSON, &seller.Verified, &seller.VerificationLevel, &expiresAt,
+		&seller.CreatedAt, &seller.UpdatedAt,
 	)
 	if err != nil {
 		return nil, err
 	}
 
+	if expiresAt.Valid {
+		seller.VerificationExpiresAt = &expiresAt.Time
+	}
+
 	// Parse location JSON
 	if len(locationJSON) > 0 {
 		if err := json.Unmarshal(locationJSON, &seller.Location); err != nil {
@@ -394,61 +316,17 @@ func (s *SellerService) getSellerStats(ctx context.Context, sellerID uuid.UUID)
 		return nil, fmt.Errorf("failed to get seller stats: %w", err)
 	}
 
-	return &stats, nil
-}
-
-func (s *SellerService) getRecentReviews(ctx context.Context, sellerID uuid.UUID, limit int) ([]Review, error) {
-	query := `
-		SELECT r.id, r.order_id, r.buyer_id, u.name, r.seller_id, r.rating, r.comment, r.created_at
-		FROM reviews r
-		JOIN users u ON r.buyer_id = u.id
-		WHERE r.seller_id = $1
-		ORDER BY r.created_at DESC
-		LIMIT $2`
-
-	rows, err := s.db.QueryContext(ctx, query, sellerID, limit)
+	// Smooth the raw average with the active model's prior so a handful of
+	// reviews cannot outrank an established seller
+	model, err := s.engine.ActiveModel(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query recent reviews: %w", err)
-	}
-	defer rows.Close()
-
-	var reviews []Review
-	for rows.Next() {
-		var review Review
-		err := rows.Scan(
-			&review.ID, &review.OrderID, &review.BuyerID, &review.BuyerName,
-			&review.SellerID, &review.Rating, &review.Comment, &review.CreatedAt,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan review: %w", err)
-		}
-		reviews = append(reviews, review)
-	}
-
-	return reviews, nil
-}
-
-func (s *SellerService) validateReviewEligibility(ctx context.Context, buyerID uuid.UUID, orderID uuid.UUID) error {
-	// Check if order exists, is completed, and belongs to buyer
-	query := `
-		SELECT status, buyer_id FROM orders 
-		WHERE id = $1 AND buyer_id = $2`
-
-	var status string
-	var orderBuyerID uuid.UUID
-	err := s.db.QueryRowContext(ctx, query, orderID, buyerID).Scan(&status, &orderBuyerID)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return fmt.Errorf("order not found or does not belong to buyer")
-		}
-		return fmt.Errorf("failed to validate order: %w", err)
-	}
-
-	if status != "completed" {
-		return fmt.Errorf("can only review completed orders")
+		return nil, err
 	}
+	count, _ := decimal.NewFromInt(int64(stats.TotalReviews)).Float64()
+	sum, _ := stats.AvgRating.Mul(decimal.NewFromInt(int64(stats.TotalReviews))).Float64()
+	stats.BayesianRating = decimal.NewFromFloat(reputation.BayesianAverage(sum, count, model.Weights.Prior())).Round(2)
 
-	return nil
+	return &stats, nil
 }
 
 func (s *SellerService) createSeller(ctx context.Context, userID uuid.UUID, req *UpdateSellerRequest) error {
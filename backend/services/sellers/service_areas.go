@@ -0,0 +1,102 @@
+package sellers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/Andrew-mugwe/agroai/models"
+	"github.com/google/uuid"
+)
+
+// maxServiceAreas bounds how many delivery areas one seller can define
+const maxServiceAreas = 20
+
+var (
+	ErrServiceAreaNotFound = errors.New("service area not found")
+	ErrTooManyServiceAreas = fmt.Errorf("a seller can define at most %d service areas", maxServiceAreas)
+)
+
+// ListServiceAreas returns the delivery areas of the seller with user ID sellerID
+func (s *SellerService) ListServiceAreas(ctx context.Context, sellerID uuid.UUID) ([]models.ServiceArea, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, seller_id, name, kind, center_lat, center_lng, radius_km, boundary::text, created_at
+		FROM seller_service_areas
+		WHERE seller_id = $1
+		ORDER BY created_at`, sellerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list service areas: %w", err)
+	}
+	defer rows.Close()
+
+	areas := []models.ServiceArea{}
+	for rows.Next() {
+		var area models.ServiceArea
+		var lat, lng sql.NullFloat64
+		var boundary sql.NullString
+		if err := rows.Scan(&area.ID, &area.SellerID, &area.Name, &area.Kind,
+			&lat, &lng, &area.RadiusKm, &boundary, &area.CreatedAt); err != nil {
+			return nil, err
+		}
+		if lat.Valid && lng.Valid {
+			area.Center = &models.GeoPoint{Lat: lat.Float64, Lng: lng.Float64}
+		}
+		if boundary.Valid {
+			if area.Polygon, err = models.ParsePolygonLiteral(boundary.String); err != nil {
+				return nil, err
+			}
+		}
+		areas = append(areas, area)
+	}
+	return areas, rows.Err()
+}
+
+// AddServiceArea stores a radius or polygon the seller delivers to
+func (s *SellerService) AddServiceArea(ctx context.Context, sellerID uuid.UUID, area *models.ServiceArea) error {
+	if err := area.Validate(); err != nil {
+		return err
+	}
+	area.SellerID = sellerID
+
+	var count int
+	if err := s.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM seller_service_areas WHERE seller_id = $1`, sellerID).Scan(&count); err != nil {
+		return fmt.Errorf("failed to count service areas: %w", err)
+	}
+	if count >= maxServiceAreas {
+		return ErrTooManyServiceAreas
+	}
+
+	var lat, lng *float64
+	if area.Center != nil {
+		lat, lng = &area.Center.Lat, &area.Center.Lng
+	}
+	err := s.db.QueryRowContext(ctx, `
+		INSERT INTO seller_service_areas (seller_id, name, kind, center_lat, center_lng, radius_km, boundary)
+		VALUES ($1, $2, $3, $4, $5, $6, $7::polygon)
+		RETURNING id, created_at`,
+		sellerID, area.Name, area.Kind, lat, lng, area.RadiusKm, area.PolygonLiteral(),
+	).Scan(&area.ID, &area.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to add service area: %w", err)
+	}
+	return nil
+}
+
+// DeleteServiceArea removes one of the seller's service areas
+func (s *SellerService) DeleteServiceArea(ctx context.Context, sellerID, areaID uuid.UUID) error {
+	result, err := s.db.ExecContext(ctx,
+		`DELETE FROM seller_service_areas WHERE id = $1 AND seller_id = $2`, areaID, sellerID)
+	if err != nil {
+		return fmt.Errorf("failed to delete service area: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrServiceAreaNotFound
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package sms
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Andrew-mugwe/agroai/config"
+)
+
+// AfricasTalking sends SMS through the Africa's Talking messaging API
+type AfricasTalking struct {
+	endpoint string
+	username string
+	apiKey   string
+	from     string
+	client   *http.Client
+}
+
+// NewAfricasTalking creates an Africa's Talking gateway
+func NewAfricasTalking(cfg config.SMSConfig) *AfricasTalking {
+	return &AfricasTalking{
+		endpoint: cfg.Endpoint,
+		username: cfg.Username,
+		apiKey:   cfg.APIKey,
+		from:     cfg.SenderID,
+		client:   &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+// atResponse is the messaging API reply
+type atResponse struct {
+	SMSMessageData struct {
+		Message    string `json:"Message"`
+		Recipients []struct {
+			StatusCode int    `json:"statusCode"`
+			Number     string `json:"number"`
+			Status     string `json:"status"`
+			MessageID  string `json:"messageId"`
+		} `json:"Recipients"`
+	} `json:"SMSMessageData"`
+}
+
+// Send implements Gateway
+func (g *AfricasTalking) Send(ctx context.Context, to, message string) (string, error) {
+	form := url.Values{}
+	form.Set("username", g.username)
+	form.Set("to", to)
+	form.Set("message", message)
+	if g.from != "" {
+		form.Set("from", g.from)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, g.endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("failed to create sms request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("apiKey", g.apiKey)
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to send sms: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return "", fmt.Errorf("sms gateway returned %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var result atResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("failed to decode sms response: %w", err)
+	}
+	recipients := result.SMSMessageData.Recipients
+	if len(recipients) == 0 {
+		return "", fmt.Errorf("%w: %s", ErrRejected, result.SMSMessageData.Message)
+	}
+
+	// 100 Processed, 101 Sent and 102 Queued are accepted
+	r := recipients[0]
+	if r.StatusCode < 100 || r.StatusCode > 102 {
+		return "", fmt.Errorf("%w: %s (%d)", ErrRejected, r.Status, r.StatusCode)
+	}
+	return r.MessageID, nil
+}
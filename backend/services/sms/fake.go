@@ -0,0 +1,74 @@
+package sms
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// Message is a text message recorded by the fake gateway
+type Message struct {
+	ID     string
+	To     string
+	Body   string
+	SentAt time.Time
+}
+
+// Fake is a gateway for local development and tests. It keeps every
+// message instead of sending it.
+type Fake struct {
+	logMessages bool
+
+	mu       sync.Mutex
+	messages []Message
+	// Err, when set, fails every send
+	Err error
+}
+
+// NewFake creates a fake gateway; with logMessages each message is also
+// logged, which is how OTPs are read during local development
+func NewFake(logMessages bool) *Fake {
+	return &Fake{logMessages: logMessages}
+}
+
+// Send implements Gateway
+func (f *Fake) Send(ctx context.Context, to, message string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Err != nil {
+		return "", f.Err
+	}
+	msg := Message{
+		ID:     fmt.Sprintf("fake-%d", len(f.messages)+1),
+		To:     to,
+		Body:   message,
+		SentAt: time.Now(),
+	}
+	f.messages = append(f.messages, msg)
+	if f.logMessages {
+		log.Printf("sms (not sent): to %s: %s", to, message)
+	}
+	return msg.ID, nil
+}
+
+// Messages returns the messages sent so far
+func (f *Fake) Messages() []Message {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Message(nil), f.messages...)
+}
+
+// Last returns the latest message sent to a number
+func (f *Fake) Last(to string) (Message, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i := len(f.messages) - 1; i >= 0; i-- {
+		if f.messages[i].To == to {
+			return f.messages[i], true
+		}
+	}
+	return Message{}, false
+}
@@ -0,0 +1,167 @@
+package sms
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// OTP errors
+var (
+	ErrOTPInvalid     = errors.New("the code is wrong or has expired")
+	ErrOTPTooMany     = errors.New("too many wrong codes; request a new one")
+	ErrOTPRateLimited = errors.New("too many codes requested; try again later")
+)
+
+// PurposeVerifyPhone verifies a number before SMS and USSD use it
+const PurposeVerifyPhone = "verify_phone"
+
+const (
+	otpDigits = 6
+	otpTTL    = 10 * time.Minute
+	// otpMaxAttempts wrong codes invalidate an OTP
+	otpMaxAttempts = 5
+	// otpMaxPerWindow codes can be sent to a number per otpWindow
+	otpMaxPerWindow = 3
+	otpWindow       = 15 * time.Minute
+)
+
+// OTPService sends one-time codes by SMS and checks them
+type OTPService struct {
+	db      *sql.DB
+	gateway Gateway
+	now     func() time.Time
+}
+
+// NewOTPService creates an OTP service sending through gateway
+func NewOTPService(db *sql.DB, gateway Gateway) *OTPService {
+	return &OTPService{db: db, gateway: gateway, now: time.Now}
+}
+
+// Request sends a new code to phone for the user and purpose. Earlier
+// codes for the same purpose stop working.
+func (s *OTPService) Request(ctx context.Context, userID uuid.UUID, phone, purpose string) error {
+	phone, err := NormalizeNumber(phone)
+	if err != nil {
+		return err
+	}
+
+	var recent int
+	err = s.db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM sms_otps WHERE phone = $1 AND created_at > $2
+	`, phone, s.now().Add(-otpWindow)).Scan(&recent)
+	if err != nil {
+		return fmt.Errorf("failed to count recent codes: %w", err)
+	}
+	if recent >= otpMaxPerWindow {
+		return ErrOTPRateLimited
+	}
+
+	code, err := newCode()
+	if err != nil {
+		return err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(code), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("failed to hash code: %w", err)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE sms_otps SET consumed_at = $3
+		WHERE user_id = $1 AND purpose = $2 AND consumed_at IS NULL
+	`, userID, purpose, s.now())
+	if err != nil {
+		return fmt.Errorf("failed to expire earlier codes: %w", err)
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO sms_otps (user_id, phone, purpose, code_hash, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, userID, phone, purpose, string(hash), s.now().Add(otpTTL), s.now())
+	if err != nil {
+		return fmt.Errorf("failed to save code: %w", err)
+	}
+
+	// Only commit a code the user can receive
+	message := fmt.Sprintf("Your AgroAI code is %s. It expires in %d minutes. Do not share it.", code, int(otpTTL.Minutes()))
+	if _, err := s.gateway.Send(ctx, phone, message); err != nil {
+		return fmt.Errorf("failed to send code: %w", err)
+	}
+	return tx.Commit()
+}
+
+// Verify checks a code sent to phone and uses it up. Wrong codes count
+// against the OTP until it is invalidated.
+func (s *OTPService) Verify(ctx context.Context, userID uuid.UUID, phone, purpose, code string) error {
+	phone, err := NormalizeNumber(phone)
+	if err != nil {
+		return err
+	}
+
+	var id uuid.UUID
+	var hash string
+	var attempts int
+	err = s.db.QueryRowContext(ctx, `
+		SELECT id, code_hash, attempts FROM sms_otps
+		WHERE user_id = $1 AND purpose = $2 AND phone = $3
+		  AND consumed_at IS NULL AND expires_at > $4
+		ORDER BY created_at DESC
+		LIMIT 1
+	`, userID, purpose, phone, s.now()).Scan(&id, &hash, &attempts)
+	if err == sql.ErrNoRows {
+		return ErrOTPInvalid
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get code: %w", err)
+	}
+	if attempts >= otpMaxAttempts {
+		return ErrOTPTooMany
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(code)) != nil {
+		if _, err := s.db.ExecContext(ctx, `UPDATE sms_otps SET attempts = attempts + 1 WHERE id = $1`, id); err != nil {
+			return fmt.Errorf("failed to record attempt: %w", err)
+		}
+		if attempts+1 >= otpMaxAttempts {
+			return ErrOTPTooMany
+		}
+		return ErrOTPInvalid
+	}
+
+	// Consume atomically so a code cannot be used twice
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE sms_otps SET consumed_at = $2 WHERE id = $1 AND consumed_at IS NULL
+	`, id, s.now())
+	if err != nil {
+		return fmt.Errorf("failed to use code: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrOTPInvalid
+	}
+	return nil
+}
+
+// newCode returns a random numeric code
+func newCode() (string, error) {
+	max := big.NewInt(1)
+	for i := 0; i < otpDigits; i++ {
+		max.Mul(max, big.NewInt(10))
+	}
+	n, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate code: %w", err)
+	}
+	return fmt.Sprintf("%0*d", otpDigits, n), nil
+}
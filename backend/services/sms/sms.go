@@ -0,0 +1,56 @@
+package sms
+
+import (
+	"context"
+	"errors"
+	"log"
+	"regexp"
+	"strings"
+
+	"github.com/Andrew-mugwe/agroai/config"
+)
+
+// SMS errors
+var (
+	ErrInvalidNumber = errors.New("phone must be in international format, e.g. +254712345678")
+	// ErrRejected is returned when the gateway accepts the request but not
+	// the message, e.g. for an unreachable number
+	ErrRejected = errors.New("sms rejected by gateway")
+)
+
+// Gateway sends text messages
+type Gateway interface {
+	// Send delivers message to an E.164 number and returns the gateway's
+	// message ID
+	Send(ctx context.Context, to, message string) (string, error)
+}
+
+var numberPattern = regexp.MustCompile(`^\+[1-9][0-9]{7,14}$`)
+
+// NormalizeNumber strips spaces and dashes from a phone number and checks
+// it is in international format
+func NormalizeNumber(phone string) (string, error) {
+	phone = strings.NewReplacer(" ", "", "-", "", "(", "", ")", "").Replace(strings.TrimSpace(phone))
+	if !numberPattern.MatchString(phone) {
+		return "", ErrInvalidNumber
+	}
+	return phone, nil
+}
+
+// NewGateway returns the configured gateway. Without a provider or API key
+// it falls back to the fake, which only logs messages.
+func NewGateway(cfg config.SMSConfig) Gateway {
+	switch cfg.Provider {
+	case "africastalking":
+		if cfg.APIKey == "" {
+			log.Printf("sms: SMS_API_KEY is not set, logging messages instead of sending them")
+			return NewFake(true)
+		}
+		return NewAfricasTalking(cfg)
+	case "", "fake":
+		return NewFake(true)
+	default:
+		log.Printf("sms: unknown provider %q, logging messages instead of sending them", cfg.Provider)
+		return NewFake(true)
+	}
+}
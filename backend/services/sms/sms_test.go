@@ -0,0 +1,124 @@
+package sms
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Andrew-mugwe/agroai/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeNumber(t *testing.T) {
+	tests := []struct {
+		phone string
+		want  string
+		err   error
+	}{
+		{phone: "+254712345678", want: "+254712345678"},
+		{phone: " +254 712-345 678 ", want: "+254712345678"},
+		{phone: "+1 (555) 010-9999", want: "+15550109999"},
+		{phone: "0712345678", err: ErrInvalidNumber},
+		{phone: "+0712345678", err: ErrInvalidNumber},
+		{phone: "+2547123", err: ErrInvalidNumber},
+		{phone: "", err: ErrInvalidNumber},
+	}
+
+	for _, tt := range tests {
+		got, err := NormalizeNumber(tt.phone)
+		if tt.err != nil {
+			assert.ErrorIs(t, err, tt.err, tt.phone)
+			continue
+		}
+		require.NoError(t, err, tt.phone)
+		assert.Equal(t, tt.want, got)
+	}
+}
+
+func TestNewGateway(t *testing.T) {
+	assert.IsType(t, &Fake{}, NewGateway(config.SMSConfig{}))
+	assert.IsType(t, &Fake{}, NewGateway(config.SMSConfig{Provider: "africastalking"}), "no key falls back to the fake")
+	assert.IsType(t, &AfricasTalking{}, NewGateway(config.SMSConfig{Provider: "africastalking", APIKey: "key"}))
+}
+
+func TestAfricasTalkingSend(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "secret", r.Header.Get("apiKey"))
+		require.NoError(t, r.ParseForm())
+		assert.Equal(t, "sandbox", r.PostForm.Get("username"))
+		assert.Equal(t, "+254712345678", r.PostForm.Get("to"))
+		assert.Equal(t, "Your code is 123456", r.PostForm.Get("message"))
+		assert.Equal(t, "AGROAI", r.PostForm.Get("from"))
+
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"SMSMessageData": {"Message": "Sent to 1/1", "Recipients": [
+			{"statusCode": 101, "number": "+254712345678", "status": "Success", "messageId": "ATXid_1"}]}}`))
+	}))
+	defer server.Close()
+
+	gateway := NewAfricasTalking(config.SMSConfig{Username: "sandbox", APIKey: "secret", SenderID: "AGROAI", Endpoint: server.URL})
+	id, err := gateway.Send(context.Background(), "+254712345678", "Your code is 123456")
+	require.NoError(t, err)
+	assert.Equal(t, "ATXid_1", id)
+}
+
+func TestAfricasTalkingRejected(t *testing.T) {
+	replies := map[string]struct {
+		status int
+		body   string
+	}{
+		"recipient": {http.StatusCreated, `{"SMSMessageData": {"Recipients": [{"statusCode": 403, "status": "InvalidPhoneNumber"}]}}`},
+		"empty":     {http.StatusCreated, `{"SMSMessageData": {"Message": "InvalidSenderId", "Recipients": []}}`},
+		"http":      {http.StatusUnauthorized, `The supplied authentication is invalid`},
+	}
+
+	for name, reply := range replies {
+		t.Run(name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(reply.status)
+				w.Write([]byte(reply.body))
+			}))
+			defer server.Close()
+
+			gateway := NewAfricasTalking(config.SMSConfig{APIKey: "secret", Endpoint: server.URL})
+			_, err := gateway.Send(context.Background(), "+254712345678", "hello")
+			require.Error(t, err)
+			if reply.status == http.StatusCreated {
+				assert.ErrorIs(t, err, ErrRejected)
+			}
+		})
+	}
+}
+
+func TestFake(t *testing.T) {
+	fake := NewFake(false)
+	_, err := fake.Send(context.Background(), "+254712345678", "first")
+	require.NoError(t, err)
+	_, err = fake.Send(context.Background(), "+254700000000", "other")
+	require.NoError(t, err)
+	_, err = fake.Send(context.Background(), "+254712345678", "second")
+	require.NoError(t, err)
+
+	assert.Len(t, fake.Messages(), 3)
+	last, ok := fake.Last("+254712345678")
+	require.True(t, ok)
+	assert.Equal(t, "second", last.Body)
+	_, ok = fake.Last("+255700000000")
+	assert.False(t, ok)
+
+	fake.Err = errors.New("gateway down")
+	_, err = fake.Send(context.Background(), "+254712345678", "third")
+	assert.EqualError(t, err, "gateway down")
+	assert.Len(t, fake.Messages(), 3)
+}
+
+func TestNewCode(t *testing.T) {
+	for i := 0; i < 20; i++ {
+		code, err := newCode()
+		require.NoError(t, err)
+		assert.Regexp(t, `^[0-9]{6}$`, code)
+	}
+}
@@ -1,28 +1,24 @@
 package services
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"time"
+
+	"github.com/Andrew-mugwe/agroai/models"
+	"github.com/Andrew-mugwe/agroai/pagination"
+	"github.com/Andrew-mugwe/agroai/repository"
+	"github.com/google/uuid"
 )
 
 type TraderService struct {
-	db *sql.DB
-}
-
-func NewTraderService(db *sql.DB) *TraderService {
-	return &TraderService{db: db}
+	db       *sql.DB
+	products ProductService
 }
 
-type Product struct {
-	ID          string    `json:"id"`
-	Name        string    `json:"name"`
-	Description string    `json:"description"`
-	Price       float64   `json:"price"`
-	Stock       int       `json:"stock"`
-	Category    string    `json:"category"`
-	Status      string    `json:"status"`
-	CreatedAt   time.Time `json:"created_at"`
+func NewTraderService(db *sql.DB, products ProductService) *TraderService {
+	return &TraderService{db: db, products: products}
 }
 
 type Order struct {
@@ -51,48 +47,24 @@ type Analytics struct {
 	} `json:"monthly_trends"`
 }
 
-// GetProducts returns a trader's product listings with optional filtering
-func (s *TraderService) GetProducts(traderID string, category string, status string) ([]Product, error) {
-	query := `
-		SELECT id, name, description, price, stock, category, status, created_at
-		FROM marketplace_products
-		WHERE trader_id = $1
-	`
-	args := []interface{}{traderID}
-
-	if category != "" {
-		query += " AND category = $2"
-		args = append(args, category)
-	}
-	if status != "" {
-		query += " AND status = $" + fmt.Sprint(len(args)+1)
-		args = append(args, status)
+// GetProducts returns a page of a trader's catalogue listings with optional
+// filtering. status is "active" or "inactive"; anything else returns both.
+func (s *TraderService) GetProducts(ctx context.Context, traderID string, category string, status string, page pagination.Params) (pagination.Page[*models.Product], error) {
+	sellerID, err := uuid.Parse(traderID)
+	if err != nil {
+		return pagination.Page[*models.Product]{}, fmt.Errorf("invalid trader ID: %w", err)
 	}
 
-	query += " ORDER BY created_at DESC"
-
-	rows, err := s.db.Query(query, args...)
-	if err != nil {
-		return nil, fmt.Errorf("error querying products: %v", err)
+	filter := repository.ProductFilter{Category: category}
+	switch status {
+	case "active", "inactive":
+		active := status == "active"
+		filter.Active = &active
 	}
-	defer rows.Close()
 
-	var products []Product
-	for rows.Next() {
-		var p Product
-		if err := rows.Scan(
-			&p.ID,
-			&p.Name,
-			&p.Description,
-			&p.Price,
-			&p.Stock,
-			&p.Category,
-			&p.Status,
-			&p.CreatedAt,
-		); err != nil {
-			return nil, fmt.Errorf("error scanning product: %v", err)
-		}
-		products = append(products, p)
+	products, err := s.products.ListSellerProducts(ctx, sellerID, filter, page)
+	if err != nil {
+		return pagination.Page[*models.Product]{}, fmt.Errorf("error querying products: %w", err)
 	}
 
 	return products, nil
@@ -168,13 +140,13 @@ func (s *TraderService) GetAnalytics(traderID string) (*Analytics, error) {
 	// Get top products
 	rows, err := s.db.Query(`
 		SELECT 
-			p.name,
+			p.title,
 			SUM(o.total_price) as revenue,
 			SUM(o.quantity) as quantity
 		FROM orders o
 		JOIN marketplace_products p ON o.product_id = p.id
 		WHERE o.trader_id = $1 AND o.status != 'cancelled'
-		GROUP BY p.name
+		GROUP BY p.title
 		ORDER BY revenue DESC
 		LIMIT 5
 	`, traderID)
@@ -0,0 +1,102 @@
+package ussd
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// PIN errors
+var (
+	ErrInvalidPIN = errors.New("PIN must be 4 digits")
+	ErrPINNotSet  = errors.New("no USSD PIN has been set")
+	ErrPINWrong   = errors.New("wrong PIN")
+	ErrPINLocked  = errors.New("too many wrong PINs; set a new PIN in the app")
+)
+
+const (
+	pinDigits = 4
+	// pinMaxAttempts wrong PINs in a row lock the PIN until it is set again
+	pinMaxAttempts = 5
+)
+
+// validPIN reports whether pin is pinDigits digits
+func validPIN(pin string) bool {
+	if len(pin) != pinDigits {
+		return false
+	}
+	for _, c := range pin {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// SetPIN sets the PIN the user enters over USSD before moving money, and
+// unlocks it after too many wrong attempts
+func (s *Service) SetPIN(ctx context.Context, userID uuid.UUID, pin string) error {
+	if !validPIN(pin) {
+		return ErrInvalidPIN
+	}
+	return s.directory.SetPIN(ctx, userID, pin)
+}
+
+func (d *dbDirectory) SetPIN(ctx context.Context, userID uuid.UUID, pin string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(pin), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("failed to hash PIN: %w", err)
+	}
+	result, err := d.db.ExecContext(ctx, `
+		UPDATE users SET ussd_pin_hash = $2, ussd_pin_attempts = 0 WHERE id = $1
+	`, userID, string(hash))
+	if err != nil {
+		return fmt.Errorf("failed to set PIN: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("failed to set PIN: user %s not found", userID)
+	}
+	return nil
+}
+
+// VerifyPIN checks the user's PIN. Wrong PINs count across sessions, so
+// the PIN cannot be guessed by redialling.
+func (d *dbDirectory) VerifyPIN(ctx context.Context, userID uuid.UUID, pin string) error {
+	var hash sql.NullString
+	var attempts int
+	err := d.db.QueryRowContext(ctx, `
+		SELECT ussd_pin_hash, ussd_pin_attempts FROM users WHERE id = $1
+	`, userID).Scan(&hash, &attempts)
+	if err != nil {
+		return fmt.Errorf("failed to get PIN: %w", err)
+	}
+	if !hash.Valid {
+		return ErrPINNotSet
+	}
+	if attempts >= pinMaxAttempts {
+		return ErrPINLocked
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(hash.String), []byte(pin)) != nil {
+		if _, err := d.db.ExecContext(ctx, `
+			UPDATE users SET ussd_pin_attempts = ussd_pin_attempts + 1 WHERE id = $1
+		`, userID); err != nil {
+			return fmt.Errorf("failed to record attempt: %w", err)
+		}
+		if attempts+1 >= pinMaxAttempts {
+			return ErrPINLocked
+		}
+		return ErrPINWrong
+	}
+
+	if attempts > 0 {
+		if _, err := d.db.ExecContext(ctx, `UPDATE users SET ussd_pin_attempts = 0 WHERE id = $1`, userID); err != nil {
+			return fmt.Errorf("failed to reset attempts: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package ussd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+// ErrSessionNotFound is returned for unknown or expired sessions
+var ErrSessionNotFound = errors.New("ussd session not found")
+
+// Session is a caller's place in the menus between requests
+type Session struct {
+	ID     string    `json:"id"`
+	Phone  string    `json:"phone"`
+	UserID uuid.UUID `json:"user_id"`
+	Screen Screen    `json:"screen"`
+	// Options are the IDs behind the numbered choices on screen
+	Options []string `json:"options,omitempty"`
+	// Selected is the ID chosen on the previous screen
+	Selected string `json:"selected,omitempty"`
+	// Steps counts the inputs handled, to tell a new input from a resend
+	Steps int `json:"steps"`
+}
+
+// SessionStore keeps sessions between the gateway's requests
+type SessionStore interface {
+	Load(ctx context.Context, id string) (*Session, error)
+	Save(ctx context.Context, session *Session) error
+	Delete(ctx context.Context, id string) error
+}
+
+// RedisStore keeps sessions in Redis, so any instance can answer a
+// session's next request
+type RedisStore struct {
+	client *redis.Client
+	ttl    time.Duration
+}
+
+// NewRedisStore creates a Redis session store; sessions expire after ttl
+// without input
+func NewRedisStore(client *redis.Client, ttl time.Duration) *RedisStore {
+	return &RedisStore{client: client, ttl: ttl}
+}
+
+func sessionKey(id string) string {
+	return "ussd:session:" + id
+}
+
+// Load implements SessionStore
+func (s *RedisStore) Load(ctx context.Context, id string) (*Session, error) {
+	data, err := s.client.Get(ctx, sessionKey(id)).Bytes()
+	if err == redis.Nil {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load ussd session: %w", err)
+	}
+
+	var session Session
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, fmt.Errorf("failed to decode ussd session: %w", err)
+	}
+	return &session, nil
+}
+
+// Save implements SessionStore
+func (s *RedisStore) Save(ctx context.Context, session *Session) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return fmt.Errorf("failed to encode ussd session: %w", err)
+	}
+	if err := s.client.Set(ctx, sessionKey(session.ID), data, s.ttl).Err(); err != nil {
+		return fmt.Errorf("failed to save ussd session: %w", err)
+	}
+	return nil
+}
+
+// Delete implements SessionStore
+func (s *RedisStore) Delete(ctx context.Context, id string) error {
+	if err := s.client.Del(ctx, sessionKey(id)).Err(); err != nil {
+		return fmt.Errorf("failed to delete ussd session: %w", err)
+	}
+	return nil
+}
+
+// MemoryStore keeps sessions in process, for tests and single-instance
+// development without Redis
+type MemoryStore struct {
+	ttl time.Duration
+
+	mu       sync.Mutex
+	sessions map[string]memorySession
+}
+
+type memorySession struct {
+	session   Session
+	expiresAt time.Time
+}
+
+// NewMemoryStore creates an in-process session store
+func NewMemoryStore(ttl time.Duration) *MemoryStore {
+	return &MemoryStore{ttl: ttl, sessions: make(map[string]memorySession)}
+}
+
+// Load implements SessionStore
+func (s *MemoryStore) Load(ctx context.Context, id string) (*Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.sessions[id]
+	if !ok || time.Now().After(stored.expiresAt) {
+		delete(s.sessions, id)
+		return nil, ErrSessionNotFound
+	}
+	session := stored.session
+	return &session, nil
+}
+
+// Save implements SessionStore
+func (s *MemoryStore) Save(ctx context.Context, session *Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sessions[session.ID] = memorySession{session: *session, expiresAt: time.Now().Add(s.ttl)}
+	return nil
+}
+
+// Delete implements SessionStore
+func (s *MemoryStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.sessions, id)
+	return nil
+}
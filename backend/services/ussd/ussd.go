@@ -0,0 +1,526 @@
+package ussd
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Andrew-mugwe/agroai/models"
+	"github.com/Andrew-mugwe/agroai/pagination"
+	"github.com/Andrew-mugwe/agroai/services/sms"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// ErrUnknownNumber is returned for numbers no user has verified
+var ErrUnknownNumber = errors.New("phone number is not registered")
+
+// Screen is a menu in a USSD session
+type Screen string
+
+const (
+	ScreenMain       Screen = "main"
+	ScreenOrders     Screen = "orders"
+	ScreenDeliveries Screen = "deliveries"
+	ScreenConfirm    Screen = "confirm"
+	ScreenPIN        Screen = "pin"
+	ScreenAlerts     Screen = "alerts"
+)
+
+const (
+	// maxScreen is the most a USSD screen shows
+	maxScreen = 182
+	// listSize is how many orders or alerts a menu lists
+	listSize = 5
+)
+
+// Request is one step of a session from the gateway. Text is every input
+// so far joined by "*", e.g. "2*1*1"; it is empty when the session starts.
+type Request struct {
+	SessionID string
+	Phone     string
+	Text      string
+}
+
+// Response is the next screen; End closes the session
+type Response struct {
+	Text string
+	End  bool
+}
+
+// String renders the response in the gateway's CON/END format
+func (r Response) String() string {
+	if r.End {
+		return "END " + r.Text
+	}
+	return "CON " + r.Text
+}
+
+func prompt(text string) Response { return Response{Text: fit(text)} }
+
+func end(text string) Response { return Response{Text: fit(text), End: true} }
+
+// fit cuts text to one USSD screen
+func fit(text string) string {
+	if runes := []rune(text); len(runes) > maxScreen {
+		return string(runes[:maxScreen-3]) + "..."
+	}
+	return text
+}
+
+// Account is the user behind a phone number
+type Account struct {
+	UserID uuid.UUID
+	Name   string
+}
+
+// Alert is a pest alert from the user's inbox
+type Alert struct {
+	ID        uuid.UUID
+	Message   string
+	CreatedAt time.Time
+}
+
+// Directory finds callers and their pest alerts, and checks the PIN they
+// enter before moving money
+type Directory interface {
+	AccountByPhone(ctx context.Context, phone string) (*Account, error)
+	PestAlerts(ctx context.Context, userID uuid.UUID, limit int) ([]Alert, error)
+	SetPIN(ctx context.Context, userID uuid.UUID, pin string) error
+	VerifyPIN(ctx context.Context, userID uuid.UUID, pin string) error
+}
+
+// Orders is the order service as used by the menus
+type Orders interface {
+	GetOrder(ctx context.Context, orderID uuid.UUID) (*models.Order, error)
+	GetUserOrders(ctx context.Context, userID uuid.UUID, page pagination.Params) (pagination.Page[models.Order], error)
+	UpdateOrderStatus(ctx context.Context, orderID uuid.UUID, status models.OrderStatus, notes string, updatedBy *uuid.UUID) error
+}
+
+// Escrow is the escrow service as used by the menus
+type Escrow interface {
+	ConfirmDelivery(orderID, buyerID uuid.UUID) (decimal.Decimal, error)
+	GetUserBalances(userID uuid.UUID) ([]models.EscrowBalance, error)
+}
+
+// Service runs menu-driven USSD sessions for farmers on feature phones:
+// order status, delivery confirmation, pest alerts and balances
+type Service struct {
+	sessions  SessionStore
+	directory Directory
+	orders    Orders
+	escrow    Escrow
+}
+
+// NewService creates a USSD service keeping sessions in sessions
+func NewService(sessions SessionStore, directory Directory, orders Orders, escrow Escrow) *Service {
+	return &Service{sessions: sessions, directory: directory, orders: orders, escrow: escrow}
+}
+
+// Handle answers one step of a session
+func (s *Service) Handle(ctx context.Context, req Request) Response {
+	var inputs []string
+	if req.Text != "" {
+		inputs = strings.Split(req.Text, "*")
+	}
+
+	session, err := s.sessions.Load(ctx, req.SessionID)
+	if errors.Is(err, ErrSessionNotFound) || len(inputs) == 0 {
+		return s.start(ctx, req, len(inputs))
+	}
+	if err != nil {
+		log.Printf("ussd: %v", err)
+		return end("Service unavailable. Please try again later.")
+	}
+	if session.Phone != req.Phone {
+		return end("Service unavailable. Please try again later.")
+	}
+
+	// A gateway retry repeats the last input; show the same screen again
+	var resp Response
+	if len(inputs) <= session.Steps {
+		resp = s.enter(ctx, session, session.Screen)
+	} else {
+		session.Steps = len(inputs)
+		resp = s.choose(ctx, session, strings.TrimSpace(inputs[len(inputs)-1]))
+	}
+	return s.finish(ctx, session, resp)
+}
+
+// start opens a session on the main menu for a registered caller
+func (s *Service) start(ctx context.Context, req Request, steps int) Response {
+	phone, err := sms.NormalizeNumber(req.Phone)
+	if err != nil {
+		return end("This number is not registered with AgroAI.")
+	}
+	account, err := s.directory.AccountByPhone(ctx, phone)
+	if errors.Is(err, ErrUnknownNumber) {
+		return end("This number is not registered with AgroAI. Verify your phone number in the AgroAI app to use this service.")
+	}
+	if err != nil {
+		log.Printf("ussd: failed to look up caller: %v", err)
+		return end("Service unavailable. Please try again later.")
+	}
+
+	session := &Session{ID: req.SessionID, Phone: req.Phone, UserID: account.UserID, Steps: steps}
+	return s.finish(ctx, session, s.enter(ctx, session, ScreenMain))
+}
+
+// finish saves an open session and drops a closed one
+func (s *Service) finish(ctx context.Context, session *Session, resp Response) Response {
+	if resp.End {
+		if err := s.sessions.Delete(ctx, session.ID); err != nil {
+			log.Printf("ussd: %v", err)
+		}
+		return resp
+	}
+	if err := s.sessions.Save(ctx, session); err != nil {
+		log.Printf("ussd: %v", err)
+		return end("Service unavailable. Please try again later.")
+	}
+	return resp
+}
+
+// choose handles an input on the session's current screen
+func (s *Service) choose(ctx context.Context, session *Session, input string) Response {
+	if input == "0" && session.Screen != ScreenMain {
+		switch session.Screen {
+		case ScreenConfirm:
+			return s.enter(ctx, session, ScreenDeliveries)
+		case ScreenPIN:
+			return s.enter(ctx, session, ScreenConfirm)
+		}
+		return s.enter(ctx, session, ScreenMain)
+	}
+
+	switch session.Screen {
+	case ScreenMain:
+		switch input {
+		case "1":
+			return s.enter(ctx, session, ScreenOrders)
+		case "2":
+			return s.enter(ctx, session, ScreenDeliveries)
+		case "3":
+			return s.enter(ctx, session, ScreenAlerts)
+		case "4":
+			return s.balances(session)
+		}
+
+	case ScreenOrders:
+		if id, ok := option(session, input); ok {
+			return s.orderStatus(ctx, session, id)
+		}
+
+	case ScreenDeliveries:
+		if id, ok := option(session, input); ok {
+			session.Selected = id
+			return s.enter(ctx, session, ScreenConfirm)
+		}
+
+	case ScreenConfirm:
+		switch input {
+		case "1":
+			return s.enter(ctx, session, ScreenPIN)
+		case "2":
+			return end("Delivery not confirmed. Contact the seller if there is a problem with your order.")
+		}
+
+	case ScreenPIN:
+		err := s.directory.VerifyPIN(ctx, session.UserID, input)
+		switch {
+		case err == nil:
+			return s.confirmDelivery(ctx, session)
+		case errors.Is(err, ErrPINWrong):
+			resp := s.enter(ctx, session, ScreenPIN)
+			if !resp.End {
+				resp = prompt("Wrong PIN.\n" + resp.Text)
+			}
+			return resp
+		case errors.Is(err, ErrPINLocked):
+			return end("Too many wrong PINs. Set a new USSD PIN in the AgroAI app to confirm deliveries.")
+		case errors.Is(err, ErrPINNotSet):
+			return end("Set a USSD PIN in the AgroAI app to confirm deliveries.")
+		default:
+			return unavailable(err)
+		}
+
+	case ScreenAlerts:
+		if id, ok := option(session, input); ok {
+			return s.alert(ctx, session, id)
+		}
+	}
+
+	resp := s.enter(ctx, session, session.Screen)
+	if !resp.End {
+		resp = prompt("Invalid choice.\n" + resp.Text)
+	}
+	return resp
+}
+
+// option maps a numbered choice to the ID behind it
+func option(session *Session, input string) (string, bool) {
+	n, err := strconv.Atoi(input)
+	if err != nil || n < 1 || n > len(session.Options) {
+		return "", false
+	}
+	return session.Options[n-1], true
+}
+
+// enter shows a screen, loading what it lists
+func (s *Service) enter(ctx context.Context, session *Session, screen Screen) Response {
+	session.Screen = screen
+	session.Options = nil
+
+	switch screen {
+	case ScreenOrders:
+		orders, err := s.recentOrders(ctx, session.UserID, listSize, "")
+		if err != nil {
+			return unavailable(err)
+		}
+		if len(orders) == 0 {
+			return end("You have no orders yet.")
+		}
+		return prompt("Your orders\n" + s.listOrders(session, orders) + "0. Back")
+
+	case ScreenDeliveries:
+		orders, err := s.recentOrders(ctx, session.UserID, listSize, models.OrderStatusShipped)
+		if err != nil {
+			return unavailable(err)
+		}
+		if len(orders) == 0 {
+			return end("No orders are waiting for you to confirm delivery.")
+		}
+		return prompt("Which order did you receive?\n" + s.listOrders(session, orders) + "0. Back")
+
+	case ScreenConfirm:
+		order, resp, ok := s.deliverable(ctx, session)
+		if !ok {
+			return resp
+		}
+		return prompt(fmt.Sprintf("Confirm you received order %s (%s)?\n1. Yes, I received it\n2. No\n0. Back",
+			order.OrderNumber, formatAmount(order.TotalAmount, order.Currency)))
+
+	case ScreenPIN:
+		// Confirming releases the payment to the seller, so the caller
+		// shows they hold the account and not just the phone
+		order, resp, ok := s.deliverable(ctx, session)
+		if !ok {
+			return resp
+		}
+		return prompt(fmt.Sprintf("Enter your AgroAI PIN to confirm order %s\n0. Back", order.OrderNumber))
+
+	case ScreenAlerts:
+		alerts, err := s.directory.PestAlerts(ctx, session.UserID, listSize)
+		if err != nil {
+			return unavailable(err)
+		}
+		if len(alerts) == 0 {
+			return end("No pest alerts for you right now.")
+		}
+		var b strings.Builder
+		b.WriteString("Pest alerts\n")
+		for i, alert := range alerts {
+			session.Options = append(session.Options, alert.ID.String())
+			fmt.Fprintf(&b, "%d. %s\n", i+1, headline(alert.Message, 28))
+		}
+		b.WriteString("0. Back")
+		return prompt(b.String())
+	}
+
+	session.Screen = ScreenMain
+	return prompt("AgroAI\n1. My orders\n2. Confirm delivery\n3. Pest alerts\n4. My balance")
+}
+
+// recentOrders lists the user's latest orders, optionally in one status
+func (s *Service) recentOrders(ctx context.Context, userID uuid.UUID, limit int, status models.OrderStatus) ([]models.Order, error) {
+	page, err := s.orders.GetUserOrders(ctx, userID, pagination.Params{Limit: 50})
+	if err != nil {
+		return nil, err
+	}
+	var orders []models.Order
+	for _, order := range page.Items {
+		if status != "" && order.Status != status {
+			continue
+		}
+		orders = append(orders, order)
+		if len(orders) == limit {
+			break
+		}
+	}
+	return orders, nil
+}
+
+func (s *Service) listOrders(session *Session, orders []models.Order) string {
+	var b strings.Builder
+	for i, order := range orders {
+		session.Options = append(session.Options, order.ID.String())
+		fmt.Fprintf(&b, "%d. %s %s\n", i+1, order.OrderNumber, order.Status)
+	}
+	return b.String()
+}
+
+// ownOrder loads one of the caller's orders
+func (s *Service) ownOrder(ctx context.Context, session *Session, id string) (*models.Order, error) {
+	orderID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, err
+	}
+	order, err := s.orders.GetOrder(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	if order.UserID != session.UserID {
+		return nil, fmt.Errorf("order %s does not belong to %s", orderID, session.UserID)
+	}
+	return order, nil
+}
+
+func (s *Service) orderStatus(ctx context.Context, session *Session, id string) Response {
+	order, err := s.ownOrder(ctx, session, id)
+	if err != nil {
+		return unavailable(err)
+	}
+	return end(fmt.Sprintf("Order %s\nStatus: %s\nTotal: %s\nPlaced: %s",
+		order.OrderNumber, order.Status, formatAmount(order.TotalAmount, order.Currency), order.CreatedAt.Format("2 Jan 2006")))
+}
+
+// deliverable loads the selected order if it still awaits confirmation
+func (s *Service) deliverable(ctx context.Context, session *Session) (*models.Order, Response, bool) {
+	order, err := s.ownOrder(ctx, session, session.Selected)
+	if err != nil {
+		return nil, unavailable(err), false
+	}
+	if order.Status != models.OrderStatusShipped {
+		return nil, end(fmt.Sprintf("Order %s is %s and cannot be confirmed.", order.OrderNumber, order.Status)), false
+	}
+	return order, Response{}, true
+}
+
+// confirmDelivery marks the order delivered and releases its escrow to the
+// seller
+func (s *Service) confirmDelivery(ctx context.Context, session *Session) Response {
+	order, resp, ok := s.deliverable(ctx, session)
+	if !ok {
+		return resp
+	}
+
+	err := s.orders.UpdateOrderStatus(ctx, order.ID, models.OrderStatusDelivered, "Delivery confirmed by buyer over USSD", &session.UserID)
+	if err != nil {
+		log.Printf("ussd: failed to confirm delivery of order %s: %v", order.ID, err)
+		return end("Could not confirm delivery. Please try again later.")
+	}
+
+	released, err := s.escrow.ConfirmDelivery(order.ID, session.UserID)
+	if err != nil {
+		log.Printf("ussd: failed to release escrow for order %s: %v", order.ID, err)
+		return end(fmt.Sprintf("Thank you. Order %s is confirmed delivered. Payment to the seller is being processed.", order.OrderNumber))
+	}
+	if released.IsPositive() {
+		return end(fmt.Sprintf("Thank you. Order %s is confirmed delivered and %s has been released to the seller.",
+			order.OrderNumber, formatAmount(released, order.Currency)))
+	}
+	return end(fmt.Sprintf("Thank you. Order %s is confirmed delivered.", order.OrderNumber))
+}
+
+func (s *Service) alert(ctx context.Context, session *Session, id string) Response {
+	alerts, err := s.directory.PestAlerts(ctx, session.UserID, listSize)
+	if err != nil {
+		return unavailable(err)
+	}
+	for _, alert := range alerts {
+		if alert.ID.String() == id {
+			return end(alert.CreatedAt.Format("2 Jan") + ": " + alert.Message)
+		}
+	}
+	return end("This alert is no longer available.")
+}
+
+func (s *Service) balances(session *Session) Response {
+	balances, err := s.escrow.GetUserBalances(session.UserID)
+	if err != nil {
+		return unavailable(err)
+	}
+	if len(balances) == 0 {
+		return end("You have no payments in escrow.")
+	}
+
+	var b strings.Builder
+	b.WriteString("Your balance")
+	for _, balance := range balances {
+		fmt.Fprintf(&b, "\nTo receive: %s\nPaid (30 days): %s\nHeld for your orders: %s",
+			formatAmount(balance.PendingPayout, balance.Currency),
+			formatAmount(balance.PaidOut30Days, balance.Currency),
+			formatAmount(balance.HeldForPurchases, balance.Currency))
+	}
+	return end(b.String())
+}
+
+func unavailable(err error) Response {
+	log.Printf("ussd: %v", err)
+	return end("Service unavailable. Please try again later.")
+}
+
+// formatAmount renders an amount, e.g. "KES 1200.00"
+func formatAmount(amount decimal.Decimal, currency string) string {
+	return currency + " " + amount.StringFixed(2)
+}
+
+// headline shortens a message to its first n characters
+func headline(message string, n int) string {
+	if runes := []rune(message); len(runes) > n {
+		return strings.TrimSpace(string(runes[:n-1])) + "…"
+	}
+	return message
+}
+
+// dbDirectory looks callers up by verified phone number
+type dbDirectory struct {
+	db *sql.DB
+}
+
+// NewDirectory creates a directory over the users and notifications tables
+func NewDirectory(db *sql.DB) Directory {
+	return &dbDirectory{db: db}
+}
+
+func (d *dbDirectory) AccountByPhone(ctx context.Context, phone string) (*Account, error) {
+	var account Account
+	err := d.db.QueryRowContext(ctx, `
+		SELECT id, name FROM users WHERE phone = $1 AND phone_verified_at IS NOT NULL
+	`, phone).Scan(&account.UserID, &account.Name)
+	if err == sql.ErrNoRows {
+		return nil, ErrUnknownNumber
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up phone: %w", err)
+	}
+	return &account, nil
+}
+
+func (d *dbDirectory) PestAlerts(ctx context.Context, userID uuid.UUID, limit int) ([]Alert, error) {
+	rows, err := d.db.QueryContext(ctx, `
+		SELECT id, message, created_at FROM notifications
+		WHERE user_id = $1 AND type = 'pest'
+		ORDER BY created_at DESC
+		LIMIT $2
+	`, userID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pest alerts: %w", err)
+	}
+	defer rows.Close()
+
+	var alerts []Alert
+	for rows.Next() {
+		var alert Alert
+		if err := rows.Scan(&alert.ID, &alert.Message, &alert.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan pest alert: %w", err)
+		}
+		alerts = append(alerts, alert)
+	}
+	return alerts, rows.Err()
+}
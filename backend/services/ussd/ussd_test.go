@@ -0,0 +1,408 @@
+package ussd
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Andrew-mugwe/agroai/models"
+	"github.com/Andrew-mugwe/agroai/pagination"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	farmerPhone = "+254712345678"
+	farmerPIN   = "4821"
+)
+
+type fakeDirectory struct {
+	accounts map[string]Account
+	alerts   []Alert
+	pins     map[uuid.UUID]string
+	attempts map[uuid.UUID]int
+}
+
+func (d *fakeDirectory) AccountByPhone(ctx context.Context, phone string) (*Account, error) {
+	account, ok := d.accounts[phone]
+	if !ok {
+		return nil, ErrUnknownNumber
+	}
+	return &account, nil
+}
+
+func (d *fakeDirectory) PestAlerts(ctx context.Context, userID uuid.UUID, limit int) ([]Alert, error) {
+	return d.alerts, nil
+}
+
+func (d *fakeDirectory) SetPIN(ctx context.Context, userID uuid.UUID, pin string) error {
+	d.pins[userID] = pin
+	d.attempts[userID] = 0
+	return nil
+}
+
+func (d *fakeDirectory) VerifyPIN(ctx context.Context, userID uuid.UUID, pin string) error {
+	want, ok := d.pins[userID]
+	if !ok {
+		return ErrPINNotSet
+	}
+	if d.attempts[userID] >= pinMaxAttempts {
+		return ErrPINLocked
+	}
+	if pin != want {
+		d.attempts[userID]++
+		if d.attempts[userID] >= pinMaxAttempts {
+			return ErrPINLocked
+		}
+		return ErrPINWrong
+	}
+	d.attempts[userID] = 0
+	return nil
+}
+
+type fakeOrders struct {
+	orders []models.Order
+}
+
+func (o *fakeOrders) GetOrder(ctx context.Context, orderID uuid.UUID) (*models.Order, error) {
+	for i := range o.orders {
+		if o.orders[i].ID == orderID {
+			order := o.orders[i]
+			return &order, nil
+		}
+	}
+	return nil, assert.AnError
+}
+
+func (o *fakeOrders) GetUserOrders(ctx context.Context, userID uuid.UUID, page pagination.Params) (pagination.Page[models.Order], error) {
+	var items []models.Order
+	for _, order := range o.orders {
+		if order.UserID == userID {
+			items = append(items, order)
+		}
+	}
+	return pagination.Page[models.Order]{Items: items, Limit: page.Limit}, nil
+}
+
+func (o *fakeOrders) UpdateOrderStatus(ctx context.Context, orderID uuid.UUID, status models.OrderStatus, notes string, updatedBy *uuid.UUID) error {
+	for i := range o.orders {
+		if o.orders[i].ID == orderID {
+			o.orders[i].Status = status
+			return nil
+		}
+	}
+	return assert.AnError
+}
+
+type fakeEscrow struct {
+	released map[uuid.UUID]decimal.Decimal
+	balances []models.EscrowBalance
+}
+
+func (e *fakeEscrow) ConfirmDelivery(orderID, buyerID uuid.UUID) (decimal.Decimal, error) {
+	return e.released[orderID], nil
+}
+
+func (e *fakeEscrow) GetUserBalances(userID uuid.UUID) ([]models.EscrowBalance, error) {
+	return e.balances, nil
+}
+
+type fixture struct {
+	service   *Service
+	userID    uuid.UUID
+	directory *fakeDirectory
+	orders    *fakeOrders
+	escrow    *fakeEscrow
+}
+
+func newFixture() *fixture {
+	userID := uuid.New()
+	order := func(number string, status models.OrderStatus, total int64) models.Order {
+		return models.Order{
+			ID:          uuid.New(),
+			OrderNumber: number,
+			UserID:      userID,
+			Status:      status,
+			TotalAmount: decimal.NewFromInt(total),
+			Currency:    "KES",
+			CreatedAt:   time.Date(2026, 10, 1, 9, 0, 0, 0, time.UTC),
+		}
+	}
+
+	orders := &fakeOrders{orders: []models.Order{
+		order("ORD-1001", models.OrderStatusShipped, 1200),
+		order("ORD-1002", models.OrderStatusPending, 800),
+		order("ORD-1003", models.OrderStatusShipped, 450),
+	}}
+	escrow := &fakeEscrow{
+		released: map[uuid.UUID]decimal.Decimal{orders.orders[0].ID: decimal.NewFromInt(1200)},
+		balances: []models.EscrowBalance{{
+			Currency:         "KES",
+			PendingPayout:    decimal.NewFromInt(3000),
+			PaidOut30Days:    decimal.NewFromInt(12500),
+			HeldForPurchases: decimal.NewFromInt(1650),
+		}},
+	}
+	directory := &fakeDirectory{
+		accounts: map[string]Account{farmerPhone: {UserID: userID, Name: "Wanjiku"}},
+		alerts: []Alert{{
+			ID:        uuid.New(),
+			Message:   "Fall armyworm reported within 5km of your farm. Inspect maize whorls.",
+			CreatedAt: time.Date(2026, 10, 17, 8, 0, 0, 0, time.UTC),
+		}},
+		pins:     map[uuid.UUID]string{userID: farmerPIN},
+		attempts: map[uuid.UUID]int{},
+	}
+
+	return &fixture{
+		service:   NewService(NewMemoryStore(time.Minute), directory, orders, escrow),
+		userID:    userID,
+		directory: directory,
+		orders:    orders,
+		escrow:    escrow,
+	}
+}
+
+func (f *fixture) dial(t *testing.T, session, text string) Response {
+	t.Helper()
+	resp := f.service.Handle(context.Background(), Request{SessionID: session, Phone: farmerPhone, Text: text})
+	assert.LessOrEqual(t, len([]rune(resp.Text)), maxScreen)
+	return resp
+}
+
+func TestUnregisteredNumber(t *testing.T) {
+	f := newFixture()
+	resp := f.service.Handle(context.Background(), Request{SessionID: "s1", Phone: "+254700000000"})
+	assert.True(t, resp.End)
+	assert.Contains(t, resp.Text, "not registered")
+}
+
+func TestMainMenu(t *testing.T) {
+	f := newFixture()
+	resp := f.dial(t, "s1", "")
+	assert.False(t, resp.End)
+	assert.True(t, strings.HasPrefix(resp.String(), "CON AgroAI"))
+	assert.Contains(t, resp.Text, "2. Confirm delivery")
+}
+
+func TestOrderStatus(t *testing.T) {
+	f := newFixture()
+	f.dial(t, "s1", "")
+
+	resp := f.dial(t, "s1", "1")
+	require.False(t, resp.End)
+	assert.Contains(t, resp.Text, "1. ORD-1001 shipped")
+	assert.Contains(t, resp.Text, "2. ORD-1002 pending")
+
+	resp = f.dial(t, "s1", "1*2")
+	assert.True(t, resp.End)
+	assert.Contains(t, resp.Text, "Order ORD-1002")
+	assert.Contains(t, resp.Text, "Total: KES 800.00")
+}
+
+func TestConfirmDelivery(t *testing.T) {
+	f := newFixture()
+	f.dial(t, "s1", "")
+
+	resp := f.dial(t, "s1", "2")
+	require.False(t, resp.End)
+	assert.Contains(t, resp.Text, "1. ORD-1001")
+	assert.Contains(t, resp.Text, "2. ORD-1003")
+	assert.NotContains(t, resp.Text, "ORD-1002", "only shipped orders can be confirmed")
+
+	resp = f.dial(t, "s1", "2*1")
+	require.False(t, resp.End)
+	assert.Contains(t, resp.Text, "ORD-1001 (KES 1200.00)")
+
+	resp = f.dial(t, "s1", "2*1*1")
+	require.False(t, resp.End)
+	assert.Contains(t, resp.Text, "Enter your AgroAI PIN to confirm order ORD-1001")
+	assert.Equal(t, models.OrderStatusShipped, f.orders.orders[0].Status)
+
+	resp = f.dial(t, "s1", "2*1*1*"+farmerPIN)
+	assert.True(t, resp.End)
+	assert.Contains(t, resp.Text, "KES 1200.00 has been released to the seller")
+	assert.Equal(t, models.OrderStatusDelivered, f.orders.orders[0].Status)
+
+	// The session is closed once delivery is confirmed
+	resp = f.dial(t, "s2", "")
+	require.False(t, resp.End)
+	resp = f.dial(t, "s2", "2")
+	assert.NotContains(t, resp.Text, "ORD-1001")
+}
+
+func TestConfirmDeliveryWithoutRelease(t *testing.T) {
+	f := newFixture()
+	f.dial(t, "s1", "")
+	f.dial(t, "s1", "2")
+	f.dial(t, "s1", "2*2")
+	f.dial(t, "s1", "2*2*1")
+
+	resp := f.dial(t, "s1", "2*2*1*"+farmerPIN)
+	assert.True(t, resp.End)
+	assert.Equal(t, "Thank you. Order ORD-1003 is confirmed delivered.", resp.Text)
+	assert.Equal(t, models.OrderStatusDelivered, f.orders.orders[2].Status)
+}
+
+func TestConfirmDeliveryWrongPIN(t *testing.T) {
+	f := newFixture()
+	f.dial(t, "s1", "")
+	f.dial(t, "s1", "2")
+	f.dial(t, "s1", "2*1")
+	f.dial(t, "s1", "2*1*1")
+
+	resp := f.dial(t, "s1", "2*1*1*0000")
+	require.False(t, resp.End)
+	assert.True(t, strings.HasPrefix(resp.Text, "Wrong PIN.\nEnter your AgroAI PIN"))
+	assert.Equal(t, models.OrderStatusShipped, f.orders.orders[0].Status)
+
+	// Back returns to the confirmation without confirming
+	resp = f.dial(t, "s1", "2*1*1*0000*0")
+	require.False(t, resp.End)
+	assert.Contains(t, resp.Text, "Confirm you received order ORD-1001")
+	assert.Equal(t, models.OrderStatusShipped, f.orders.orders[0].Status)
+}
+
+func TestConfirmDeliveryPINLocked(t *testing.T) {
+	f := newFixture()
+	f.directory.attempts[f.userID] = pinMaxAttempts - 1
+	f.dial(t, "s1", "")
+	f.dial(t, "s1", "2")
+	f.dial(t, "s1", "2*1")
+	f.dial(t, "s1", "2*1*1")
+
+	resp := f.dial(t, "s1", "2*1*1*0000")
+	assert.True(t, resp.End)
+	assert.Contains(t, resp.Text, "Too many wrong PINs")
+
+	// Locked even with the right PIN, in a new session
+	f.dial(t, "s2", "")
+	f.dial(t, "s2", "2")
+	f.dial(t, "s2", "2*1")
+	f.dial(t, "s2", "2*1*1")
+	resp = f.dial(t, "s2", "2*1*1*"+farmerPIN)
+	assert.True(t, resp.End)
+	assert.Equal(t, models.OrderStatusShipped, f.orders.orders[0].Status)
+}
+
+func TestConfirmDeliveryWithoutPIN(t *testing.T) {
+	f := newFixture()
+	delete(f.directory.pins, f.userID)
+	f.dial(t, "s1", "")
+	f.dial(t, "s1", "2")
+	f.dial(t, "s1", "2*1")
+	f.dial(t, "s1", "2*1*1")
+
+	resp := f.dial(t, "s1", "2*1*1*1234")
+	assert.True(t, resp.End)
+	assert.Contains(t, resp.Text, "Set a USSD PIN")
+	assert.Equal(t, models.OrderStatusShipped, f.orders.orders[0].Status)
+}
+
+func TestSetPIN(t *testing.T) {
+	f := newFixture()
+	ctx := context.Background()
+
+	for _, pin := range []string{"", "123", "12345", "12a4", "١٢٣٤"} {
+		assert.ErrorIs(t, f.service.SetPIN(ctx, f.userID, pin), ErrInvalidPIN, pin)
+	}
+	require.NoError(t, f.service.SetPIN(ctx, f.userID, "0042"))
+	assert.Equal(t, "0042", f.directory.pins[f.userID])
+}
+
+func TestDeclineDelivery(t *testing.T) {
+	f := newFixture()
+	f.dial(t, "s1", "")
+	f.dial(t, "s1", "2")
+	f.dial(t, "s1", "2*1")
+
+	resp := f.dial(t, "s1", "2*1*2")
+	assert.True(t, resp.End)
+	assert.Equal(t, models.OrderStatusShipped, f.orders.orders[0].Status)
+}
+
+func TestBackAndInvalidChoice(t *testing.T) {
+	f := newFixture()
+	f.dial(t, "s1", "")
+	f.dial(t, "s1", "2")
+	f.dial(t, "s1", "2*1")
+
+	resp := f.dial(t, "s1", "2*1*0")
+	require.False(t, resp.End)
+	assert.Contains(t, resp.Text, "Which order did you receive?")
+
+	resp = f.dial(t, "s1", "2*1*0*9")
+	require.False(t, resp.End)
+	assert.True(t, strings.HasPrefix(resp.Text, "Invalid choice.\nWhich order"))
+
+	resp = f.dial(t, "s1", "2*1*0*9*0")
+	require.False(t, resp.End)
+	assert.True(t, strings.HasPrefix(resp.Text, "AgroAI"))
+}
+
+func TestResendShowsSameScreen(t *testing.T) {
+	f := newFixture()
+	f.dial(t, "s1", "")
+	first := f.dial(t, "s1", "2")
+	f.dial(t, "s1", "2*1")
+
+	// A retried request must not be taken as a new choice
+	again := f.dial(t, "s1", "2*1")
+	require.False(t, again.End)
+	assert.Contains(t, again.Text, "Confirm you received order ORD-1001")
+	assert.NotEqual(t, first.Text, again.Text)
+	assert.Equal(t, models.OrderStatusShipped, f.orders.orders[0].Status)
+}
+
+func TestPestAlerts(t *testing.T) {
+	f := newFixture()
+	f.dial(t, "s1", "")
+
+	resp := f.dial(t, "s1", "3")
+	require.False(t, resp.End)
+	assert.Contains(t, resp.Text, "1. Fall armyworm reported")
+
+	resp = f.dial(t, "s1", "3*1")
+	assert.True(t, resp.End)
+	assert.Equal(t, "17 Oct: Fall armyworm reported within 5km of your farm. Inspect maize whorls.", resp.Text)
+}
+
+func TestBalances(t *testing.T) {
+	f := newFixture()
+	f.dial(t, "s1", "")
+
+	resp := f.dial(t, "s1", "4")
+	assert.True(t, resp.End)
+	assert.Contains(t, resp.Text, "To receive: KES 3000.00")
+	assert.Contains(t, resp.Text, "Held for your orders: KES 1650.00")
+}
+
+func TestExpiredSessionRestarts(t *testing.T) {
+	f := newFixture()
+	f.service.sessions = NewMemoryStore(0)
+	f.dial(t, "s1", "")
+
+	// With the session gone, a later input starts over on the main menu
+	resp := f.dial(t, "s1", "2")
+	require.False(t, resp.End)
+	assert.True(t, strings.HasPrefix(resp.Text, "AgroAI"))
+}
+
+func TestSessionBoundToPhone(t *testing.T) {
+	f := newFixture()
+	f.dial(t, "s1", "")
+
+	resp := f.service.Handle(context.Background(), Request{SessionID: "s1", Phone: "+254700000000", Text: "4"})
+	assert.True(t, resp.End)
+	assert.NotContains(t, resp.Text, "KES")
+}
+
+func TestFit(t *testing.T) {
+	long := strings.Repeat("x", 300)
+	assert.Len(t, []rune(fit(long)), maxScreen)
+	assert.Equal(t, "short", fit("short"))
+	assert.Equal(t, "END bye", end("bye").String())
+}
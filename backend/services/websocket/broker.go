@@ -0,0 +1,114 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// threadChannelPrefix namespaces thread events on Redis
+const threadChannelPrefix = "marketplace:thread:"
+
+// Broker carries thread events between API instances, so a message
+// published on one reaches subscribers connected to any of them
+type Broker interface {
+	// Publish sends an event to every instance
+	Publish(ctx context.Context, message *Message) error
+	// Subscribe delivers every published event until ctx is done
+	Subscribe(ctx context.Context, deliver func(*Message)) error
+}
+
+// MemoryBroker is a Broker for a single instance
+type MemoryBroker struct {
+	mu          sync.RWMutex
+	subscribers map[int]func(*Message)
+	next        int
+}
+
+// NewMemoryBroker creates an in-process broker
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{subscribers: make(map[int]func(*Message))}
+}
+
+// Publish delivers the event to the broker's subscribers
+func (b *MemoryBroker) Publish(ctx context.Context, message *Message) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, deliver := range b.subscribers {
+		deliver(message)
+	}
+	return nil
+}
+
+// Subscribe registers deliver until ctx is done
+func (b *MemoryBroker) Subscribe(ctx context.Context, deliver func(*Message)) error {
+	b.mu.Lock()
+	id := b.next
+	b.next++
+	b.subscribers[id] = deliver
+	b.mu.Unlock()
+
+	<-ctx.Done()
+
+	b.mu.Lock()
+	delete(b.subscribers, id)
+	b.mu.Unlock()
+	return nil
+}
+
+// RedisBroker is a Broker over Redis pub/sub, one channel per thread
+type RedisBroker struct {
+	client *redis.Client
+}
+
+// NewRedisBroker creates a broker on a Redis client
+func NewRedisBroker(client *redis.Client) *RedisBroker {
+	return &RedisBroker{client: client}
+}
+
+// Publish publishes the event on its thread's channel
+func (b *RedisBroker) Publish(ctx context.Context, message *Message) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+	if err := b.client.Publish(ctx, threadChannelPrefix+message.ThreadRef, data).Err(); err != nil {
+		return fmt.Errorf("failed to publish event: %w", err)
+	}
+	return nil
+}
+
+// Subscribe receives events for every thread until ctx is done. The
+// client reconnects and resubscribes by itself after connection errors.
+func (b *RedisBroker) Subscribe(ctx context.Context, deliver func(*Message)) error {
+	pubsub := b.client.PSubscribe(ctx, threadChannelPrefix+"*")
+	defer pubsub.Close()
+
+	if _, err := pubsub.Receive(ctx); err != nil {
+		return fmt.Errorf("failed to subscribe to thread events: %w", err)
+	}
+
+	events := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-events:
+			if !ok {
+				return nil
+			}
+			var message Message
+			if err := json.Unmarshal([]byte(event.Payload), &message); err != nil {
+				log.Printf("websocket: dropping malformed event on %s: %v", event.Channel, err)
+				continue
+			}
+			message.ThreadRef = strings.TrimPrefix(event.Channel, threadChannelPrefix)
+			deliver(&message)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package websocket
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/Andrew-mugwe/agroai/services/messaging"
+)
+
+// Event types sent to clients
+const (
+	EventSubscribed       = "subscribed"
+	EventError            = "error"
+	EventNewMessage       = "new_message"
+	EventThreadEscalated  = "thread_escalated"
+	EventParticipantAdded = "participant_added"
+	EventTyping           = "typing"
+	EventDelivered        = "delivered"
+	EventRead             = "read"
+	EventPresence         = "presence"
+)
+
+// ParticipantState is a participant's receipts and presence, sent to
+// clients when they subscribe to a thread
+type ParticipantState struct {
+	UserID          uuid.UUID  `json:"user_id"`
+	Role            string     `json:"role"`
+	LastDeliveredAt time.Time  `json:"last_delivered_at"`
+	LastReadAt      time.Time  `json:"last_read_at"`
+	Online          bool       `json:"online"`
+	LastSeen        *time.Time `json:"last_seen,omitempty"`
+}
+
+// participantStates adds presence to the participants' receipts; presence
+// is left out if it cannot be looked up
+func (ws *MarketplaceWebSocketService) participantStates(ctx context.Context, participants []*messaging.MarketplaceParticipant) []ParticipantState {
+	userIDs := make([]uuid.UUID, 0, len(participants))
+	for _, participant := range participants {
+		userIDs = append(userIDs, participant.UserID)
+	}
+	statuses, err := ws.presence.Status(ctx, userIDs)
+	if err != nil {
+		log.Printf("websocket: failed to look up presence: %v", err)
+	}
+
+	states := make([]ParticipantState, 0, len(participants))
+	for _, participant := range participants {
+		status := statuses[participant.UserID]
+		states = append(states, ParticipantState{
+			UserID:          participant.UserID,
+			Role:            participant.Role,
+			LastDeliveredAt: participant.LastDeliveredAt,
+			LastReadAt:      participant.LastReadAt,
+			Online:          status.Online,
+			LastSeen:        status.LastSeen,
+		})
+	}
+	return states
+}
+
+// markDelivered records that the thread's messages reached the client
+func (ws *MarketplaceWebSocketService) markDelivered(client *Client, threadRef string) {
+	ctx, cancel := context.WithTimeout(ws.ctx, requestTimeout)
+	defer cancel()
+
+	deliveredAt, err := ws.threads.MarkThreadAsDelivered(ctx, threadRef, client.UserID)
+	if err != nil {
+		log.Printf("Failed to mark thread %s delivered for client %s: %v", threadRef, client.ID, err)
+		ws.reply(client, errorEvent(threadRef, "failed to record delivery"))
+		return
+	}
+	ws.publish(receiptEvent(EventDelivered, threadRef, client.UserID, deliveredAt))
+}
+
+// markRead records that the client's user read the thread
+func (ws *MarketplaceWebSocketService) markRead(client *Client, threadRef string) {
+	ctx, cancel := context.WithTimeout(ws.ctx, requestTimeout)
+	defer cancel()
+
+	readAt, err := ws.threads.MarkThreadAsRead(ctx, threadRef, client.UserID)
+	if err != nil {
+		log.Printf("Failed to mark thread %s read for client %s: %v", threadRef, client.ID, err)
+		ws.reply(client, errorEvent(threadRef, "failed to record read receipt"))
+		return
+	}
+	ws.BroadcastRead(threadRef, client.UserID, readAt)
+}
+
+// BroadcastRead tells a thread's subscribers that a participant has read
+// the messages created up to readAt
+func (ws *MarketplaceWebSocketService) BroadcastRead(threadRef string, userID uuid.UUID, readAt time.Time) {
+	ws.publish(receiptEvent(EventRead, threadRef, userID, readAt))
+}
+
+// heartbeat keeps the client's user online
+func (ws *MarketplaceWebSocketService) heartbeat(client *Client) {
+	ctx, cancel := context.WithTimeout(ws.ctx, requestTimeout)
+	defer cancel()
+
+	if err := ws.presence.Connect(ctx, client.UserID, client.ID); err != nil {
+		log.Printf("websocket: failed to record presence for client %s: %v", client.ID, err)
+	}
+}
+
+// leave marks the client's connection offline and, once the user has no
+// other connection, announces it in the threads the client followed
+func (ws *MarketplaceWebSocketService) leave(client *Client, threadRefs []string) {
+	ctx, cancel := context.WithTimeout(ws.ctx, requestTimeout)
+	defer cancel()
+
+	if err := ws.presence.Disconnect(ctx, client.UserID, client.ID); err != nil {
+		log.Printf("websocket: failed to record presence for client %s: %v", client.ID, err)
+		return
+	}
+	if len(threadRefs) == 0 {
+		return
+	}
+
+	statuses, err := ws.presence.Status(ctx, []uuid.UUID{client.UserID})
+	if err != nil {
+		log.Printf("websocket: failed to look up presence: %v", err)
+		return
+	}
+	status := statuses[client.UserID]
+	if status.Online {
+		return
+	}
+	for _, threadRef := range threadRefs {
+		ws.publish(presenceEvent(threadRef, client.UserID, status))
+	}
+}
+
+func typingEvent(threadRef string, userID uuid.UUID, typing bool) *Message {
+	return &Message{
+		Type:      EventTyping,
+		ThreadRef: threadRef,
+		Data:      map[string]interface{}{"user_id": userID, "typing": typing},
+		Timestamp: time.Now(),
+	}
+}
+
+func receiptEvent(eventType, threadRef string, userID uuid.UUID, at time.Time) *Message {
+	return &Message{
+		Type:      eventType,
+		ThreadRef: threadRef,
+		Data:      map[string]interface{}{"user_id": userID, "at": at},
+		Timestamp: time.Now(),
+	}
+}
+
+func presenceEvent(threadRef string, userID uuid.UUID, status PresenceStatus) *Message {
+	data := map[string]interface{}{"user_id": userID, "online": status.Online}
+	if status.LastSeen != nil {
+		data["last_seen"] = status.LastSeen
+	}
+	return &Message{
+		Type:      EventPresence,
+		ThreadRef: threadRef,
+		Data:      data,
+		Timestamp: time.Now(),
+	}
+}
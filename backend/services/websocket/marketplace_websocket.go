@@ -1,26 +1,53 @@
 package websocket
 
 import (
+	"context"
 	"encoding/json"
 	"log"
 	"net/http"
+	"net/url"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 
+	"github.com/Andrew-mugwe/agroai/middleware"
 	"github.com/Andrew-mugwe/agroai/services/messaging"
 )
 
-// MarketplaceWebSocketService handles WebSocket connections for marketplace messaging
+const (
+	// publishTimeout bounds publishing an event to the broker
+	publishTimeout = 5 * time.Second
+	// requestTimeout bounds the lookups and updates a client request makes
+	requestTimeout = 5 * time.Second
+	// resubscribeDelay is the wait before retrying a failed broker subscription
+	resubscribeDelay = 5 * time.Second
+)
+
+// Threads looks up who may follow a thread and records their receipts
+type Threads interface {
+	GetThreadParticipants(ctx context.Context, threadRef string) ([]*messaging.MarketplaceParticipant, error)
+	MarkThreadAsDelivered(ctx context.Context, threadRef string, userID uuid.UUID) (time.Time, error)
+	MarkThreadAsRead(ctx context.Context, threadRef string, userID uuid.UUID) (time.Time, error)
+}
+
+// MarketplaceWebSocketService handles WebSocket connections for marketplace
+// messaging. Events are published through the broker and delivered by every
+// instance to its own subscribers, so clients on different instances share
+// threads.
 type MarketplaceWebSocketService struct {
-	clients    map[*Client]bool
-	rooms      map[string]map[*Client]bool
-	register   chan *Client
-	unregister chan *Client
-	broadcast  chan *Message
-	mutex      sync.RWMutex
+	clients  map[*Client]bool
+	rooms    map[string]map[*Client]bool
+	mutex    sync.RWMutex
+	threads  Threads
+	broker   Broker
+	presence Presence
+	origins  map[string]bool
+	upgrader websocket.Upgrader
+	ctx      context.Context
+	cancel   context.CancelFunc
 }
 
 // Client represents a WebSocket client
@@ -30,7 +57,7 @@ type Client struct {
 	Conn     *websocket.Conn
 	Send     chan []byte
 	Rooms    map[string]bool // Thread references this client is subscribed to
-	LastPing time.Time
+	LastPing time.Time       // Guarded by the service mutex
 }
 
 // Message represents a WebSocket message
@@ -41,35 +68,64 @@ type Message struct {
 	Timestamp time.Time              `json:"timestamp"`
 }
 
-// NewMarketplaceWebSocketService creates a new WebSocket service
-func NewMarketplaceWebSocketService() *MarketplaceWebSocketService {
-	return &MarketplaceWebSocketService{
-		clients:    make(map[*Client]bool),
-		rooms:      make(map[string]map[*Client]bool),
-		register:   make(chan *Client),
-		unregister: make(chan *Client),
-		broadcast:  make(chan *Message),
+// NewMarketplaceWebSocketService creates a new WebSocket service. Browsers
+// may connect from allowedOrigins or the API's own host.
+func NewMarketplaceWebSocketService(threads Threads, broker Broker, presence Presence, allowedOrigins []string) *MarketplaceWebSocketService {
+	ctx, cancel := context.WithCancel(context.Background())
+	ws := &MarketplaceWebSocketService{
+		clients:  make(map[*Client]bool),
+		rooms:    make(map[string]map[*Client]bool),
+		threads:  threads,
+		broker:   broker,
+		presence: presence,
+		origins:  make(map[string]bool),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+	for _, origin := range allowedOrigins {
+		ws.origins[strings.TrimSuffix(origin, "/")] = true
+	}
+	ws.upgrader = websocket.Upgrader{
+		CheckOrigin:     ws.checkOrigin,
+		ReadBufferSize:  1024,
+		WriteBufferSize: 1024,
 	}
+	return ws
 }
 
 // Run starts the WebSocket service
 func (ws *MarketplaceWebSocketService) Run() {
+	go ws.receive()
+
 	ticker := time.NewTicker(30 * time.Second)
 	defer ticker.Stop()
 
 	for {
 		select {
-		case client := <-ws.register:
-			ws.registerClient(client)
+		case <-ticker.C:
+			ws.cleanupDeadConnections()
 
-		case client := <-ws.unregister:
-			ws.unregisterClient(client)
+		case <-ws.ctx.Done():
+			return
+		}
+	}
+}
 
-		case message := <-ws.broadcast:
-			ws.broadcastMessage(message)
+// Stop stops the service and its broker subscription
+func (ws *MarketplaceWebSocketService) Stop() {
+	ws.cancel()
+}
 
-		case <-ticker.C:
-			ws.cleanupDeadConnections()
+// receive delivers events published by any instance to local subscribers
+func (ws *MarketplaceWebSocketService) receive() {
+	for {
+		if err := ws.broker.Subscribe(ws.ctx, ws.broadcastMessage); err != nil {
+			log.Printf("websocket: broker subscription failed: %v", err)
+		}
+		select {
+		case <-ws.ctx.Done():
+			return
+		case <-time.After(resubscribeDelay):
 		}
 	}
 }
@@ -77,36 +133,47 @@ func (ws *MarketplaceWebSocketService) Run() {
 // registerClient registers a new client
 func (ws *MarketplaceWebSocketService) registerClient(client *Client) {
 	ws.mutex.Lock()
-	defer ws.mutex.Unlock()
-
 	ws.clients[client] = true
+	ws.mutex.Unlock()
+
+	ws.heartbeat(client)
 	log.Printf("Client %s connected", client.ID)
 }
 
-// unregisterClient unregisters a client
+// unregisterClient unregisters a client, announcing the user offline in
+// its threads unless they are still connected elsewhere. Unregistering a
+// client twice does nothing the second time.
 func (ws *MarketplaceWebSocketService) unregisterClient(client *Client) {
 	ws.mutex.Lock()
-	defer ws.mutex.Unlock()
+	if _, ok := ws.clients[client]; !ok {
+		ws.mutex.Unlock()
+		return
+	}
+
+	threadRefs := make([]string, 0, len(client.Rooms))
+	for threadRef := range client.Rooms {
+		threadRefs = append(threadRefs, threadRef)
+	}
+
+	delete(ws.clients, client)
+	close(client.Send)
 
-	if _, ok := ws.clients[client]; ok {
-		delete(ws.clients, client)
-		close(client.Send)
-
-		// Remove client from all rooms
-		for threadRef := range client.Rooms {
-			if room, exists := ws.rooms[threadRef]; exists {
-				delete(room, client)
-				if len(room) == 0 {
-					delete(ws.rooms, threadRef)
-				}
+	// Remove client from all rooms
+	for _, threadRef := range threadRefs {
+		if room, exists := ws.rooms[threadRef]; exists {
+			delete(room, client)
+			if len(room) == 0 {
+				delete(ws.rooms, threadRef)
 			}
 		}
-
-		log.Printf("Client %s disconnected", client.ID)
 	}
+	ws.mutex.Unlock()
+
+	log.Printf("Client %s disconnected", client.ID)
+	ws.leave(client, threadRefs)
 }
 
-// broadcastMessage broadcasts a message to all clients in a room
+// broadcastMessage broadcasts a message to this instance's clients in a room
 func (ws *MarketplaceWebSocketService) broadcastMessage(message *Message) {
 	ws.mutex.RLock()
 	defer ws.mutex.RUnlock()
@@ -119,54 +186,127 @@ func (ws *MarketplaceWebSocketService) broadcastMessage(message *Message) {
 		}
 
 		for client := range room {
-			select {
-			case client.Send <- data:
-			default:
-				close(client.Send)
-				delete(ws.clients, client)
-				delete(room, client)
-			}
+			ws.queue(client, data)
 		}
 	}
 }
 
-// cleanupDeadConnections removes dead connections
-func (ws *MarketplaceWebSocketService) cleanupDeadConnections() {
+// queue queues data for a client; the caller holds the mutex, which keeps
+// the Send channel from being closed. A client too slow to keep up is
+// disconnected, and unregistered once its read pump stops.
+func (ws *MarketplaceWebSocketService) queue(client *Client, data []byte) {
+	select {
+	case client.Send <- data:
+	default:
+		log.Printf("Client %s is not keeping up; disconnecting", client.ID)
+		client.Conn.Close()
+	}
+}
+
+// reply sends an event to one client
+func (ws *MarketplaceWebSocketService) reply(client *Client, message *Message) {
+	data, err := json.Marshal(message)
+	if err != nil {
+		log.Printf("Error marshaling message: %v", err)
+		return
+	}
+
+	ws.mutex.RLock()
+	defer ws.mutex.RUnlock()
+	if ws.clients[client] {
+		ws.queue(client, data)
+	}
+}
+
+// touch records that a client is still alive
+func (ws *MarketplaceWebSocketService) touch(client *Client) {
 	ws.mutex.Lock()
-	defer ws.mutex.Unlock()
+	client.LastPing = time.Now()
+	ws.mutex.Unlock()
+}
 
+// cleanupDeadConnections disconnects clients that stopped answering pings.
+// They leave like any other disconnect; closing the connection then stops
+// their read pump, whose own unregister finds them already gone.
+func (ws *MarketplaceWebSocketService) cleanupDeadConnections() {
+	ws.mutex.RLock()
+	var dead []*Client
 	now := time.Now()
 	for client := range ws.clients {
 		if now.Sub(client.LastPing) > 60*time.Second {
-			delete(ws.clients, client)
-			close(client.Send)
-
-			// Remove from rooms
-			for threadRef := range client.Rooms {
-				if room, exists := ws.rooms[threadRef]; exists {
-					delete(room, client)
-					if len(room) == 0 {
-						delete(ws.rooms, threadRef)
-					}
-				}
-			}
+			dead = append(dead, client)
 		}
 	}
+	ws.mutex.RUnlock()
+
+	for _, client := range dead {
+		ws.unregisterClient(client)
+		client.Conn.Close()
+	}
 }
 
-// subscribeToThread subscribes a client to a thread
+// subscribeToThread subscribes a client to a thread it participates in.
+// The client is sent the participants' receipts and presence, and the
+// others are told the user is online.
 func (ws *MarketplaceWebSocketService) subscribeToThread(client *Client, threadRef string) {
-	ws.mutex.Lock()
-	defer ws.mutex.Unlock()
+	ctx, cancel := context.WithTimeout(ws.ctx, requestTimeout)
+	defer cancel()
+
+	participants, err := ws.threads.GetThreadParticipants(ctx, threadRef)
+	if err != nil {
+		log.Printf("Failed to authorise client %s for thread %s: %v", client.ID, threadRef, err)
+		ws.reply(client, errorEvent(threadRef, "failed to subscribe to thread"))
+		return
+	}
+	if !isParticipant(participants, client.UserID) {
+		ws.reply(client, errorEvent(threadRef, "not a participant in this thread"))
+		return
+	}
 
+	ws.mutex.Lock()
 	client.Rooms[threadRef] = true
 
 	if ws.rooms[threadRef] == nil {
 		ws.rooms[threadRef] = make(map[*Client]bool)
 	}
 	ws.rooms[threadRef][client] = true
+	ws.mutex.Unlock()
 
 	log.Printf("Client %s subscribed to thread %s", client.ID, threadRef)
+	ws.reply(client, &Message{
+		Type:      EventSubscribed,
+		ThreadRef: threadRef,
+		Data:      map[string]interface{}{"participants": ws.participantStates(ctx, participants)},
+		Timestamp: time.Now(),
+	})
+	ws.publish(presenceEvent(threadRef, client.UserID, PresenceStatus{Online: true}))
+}
+
+// isParticipant reports whether the user is among the participants
+func isParticipant(participants []*messaging.MarketplaceParticipant, userID uuid.UUID) bool {
+	for _, participant := range participants {
+		if participant.UserID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// isSubscribed reports whether a client has subscribed to a thread
+func (ws *MarketplaceWebSocketService) isSubscribed(client *Client, threadRef string) bool {
+	ws.mutex.RLock()
+	defer ws.mutex.RUnlock()
+	return client.Rooms[threadRef]
+}
+
+// errorEvent tells a client why its request was refused
+func errorEvent(threadRef, reason string) *Message {
+	return &Message{
+		Type:      EventError,
+		ThreadRef: threadRef,
+		Data:      map[string]interface{}{"error": reason},
+		Timestamp: time.Now(),
+	}
 }
 
 // unsubscribeFromThread unsubscribes a client from a thread
@@ -189,7 +329,7 @@ func (ws *MarketplaceWebSocketService) unsubscribeFromThread(client *Client, thr
 // BroadcastNewMessage broadcasts a new message to thread participants
 func (ws *MarketplaceWebSocketService) BroadcastNewMessage(threadRef string, message *messaging.MarketplaceMessage) {
 	wsMessage := &Message{
-		Type:      "new_message",
+		Type:      EventNewMessage,
 		ThreadRef: threadRef,
 		Data: map[string]interface{}{
 			"id":           message.ID,
@@ -202,12 +342,11 @@ func (ws *MarketplaceWebSocketService) BroadcastNewMessage(threadRef string, mes
 		},
 		Timestamp: time.Now(),
 	}
-
-	select {
-	case ws.broadcast <- wsMessage:
-	default:
-		log.Printf("Failed to broadcast message to thread %s", threadRef)
+	if message.Offer != nil {
+		wsMessage.Data["offer"] = message.Offer
 	}
+
+	ws.publish(wsMessage)
 }
 
 // BroadcastThreadUpdate broadcasts thread status updates
@@ -219,42 +358,44 @@ func (ws *MarketplaceWebSocketService) BroadcastThreadUpdate(threadRef string, u
 		Timestamp: time.Now(),
 	}
 
-	select {
-	case ws.broadcast <- wsMessage:
-	default:
-		log.Printf("Failed to broadcast update to thread %s", threadRef)
+	ws.publish(wsMessage)
+}
+
+// publish sends an event to the thread's subscribers on every instance
+func (ws *MarketplaceWebSocketService) publish(message *Message) {
+	ctx, cancel := context.WithTimeout(ws.ctx, publishTimeout)
+	defer cancel()
+
+	if err := ws.broker.Publish(ctx, message); err != nil {
+		log.Printf("Failed to broadcast %s to thread %s: %v", message.Type, message.ThreadRef, err)
 	}
 }
 
-// HandleWebSocket handles WebSocket connections
+// HandleWebSocket handles WebSocket connections. The user is authenticated
+// from the same bearer token AuthMiddleware accepts, before upgrading.
 func (ws *MarketplaceWebSocketService) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
-	// Upgrade connection to WebSocket
-	upgrader := websocket.Upgrader{
-		CheckOrigin: func(r *http.Request) bool {
-			// In production, you should implement proper origin checking
-			return true
-		},
-		ReadBufferSize:  1024,
-		WriteBufferSize: 1024,
+	token := bearerToken(r)
+	if token == "" {
+		http.Error(w, "Authorization token required", http.StatusUnauthorized)
+		return
 	}
 
-	conn, err := upgrader.Upgrade(w, r, nil)
+	claims, err := middleware.ParseToken(token)
 	if err != nil {
-		log.Printf("WebSocket upgrade error: %v", err)
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
 		return
 	}
 
-	// Extract user ID from query parameters or headers
-	// In production, you should validate JWT token
-	userIDStr := r.URL.Query().Get("user_id")
-	if userIDStr == "" {
-		conn.Close()
+	userID, err := uuid.Parse(claims.UserID)
+	if err != nil {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
 		return
 	}
 
-	userID, err := uuid.Parse(userIDStr)
+	// Upgrade connection to WebSocket
+	conn, err := ws.upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		conn.Close()
+		log.Printf("WebSocket upgrade error: %v", err)
 		return
 	}
 
@@ -269,17 +410,41 @@ func (ws *MarketplaceWebSocketService) HandleWebSocket(w http.ResponseWriter, r
 	}
 
 	// Register client
-	ws.register <- client
+	ws.registerClient(client)
 
 	// Start goroutines for reading and writing
 	go ws.writePump(client)
 	go ws.readPump(client)
 }
 
+// bearerToken reads the token from the Authorization header or, as browsers
+// cannot set headers on websocket requests, the token query parameter
+func bearerToken(r *http.Request) string {
+	if header := r.Header.Get("Authorization"); header != "" {
+		parts := strings.Split(header, " ")
+		if len(parts) == 2 && parts[0] == "Bearer" {
+			return parts[1]
+		}
+		return ""
+	}
+	return r.URL.Query().Get("token")
+}
+
+// checkOrigin accepts requests without an Origin, which come from native
+// clients, and browsers on an allowed origin or the API's own host
+func (ws *MarketplaceWebSocketService) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || ws.origins[origin] {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
 // readPump pumps messages from the WebSocket connection to the hub
 func (ws *MarketplaceWebSocketService) readPump(client *Client) {
 	defer func() {
-		ws.unregister <- client
+		ws.unregisterClient(client)
 		client.Conn.Close()
 	}()
 
@@ -287,7 +452,8 @@ func (ws *MarketplaceWebSocketService) readPump(client *Client) {
 	client.Conn.SetReadDeadline(time.Now().Add(60 * time.Second))
 	client.Conn.SetPongHandler(func(string) error {
 		client.Conn.SetReadDeadline(time.Now().Add(60 * time.Second))
-		client.LastPing = time.Now()
+		ws.touch(client)
+		ws.heartbeat(client)
 		return nil
 	})
 
@@ -322,20 +488,8 @@ func (ws *MarketplaceWebSocketService) writePump(client *Client) {
 				return
 			}
 
-			w, err := client.Conn.NextWriter(websocket.TextMessage)
-			if err != nil {
-				return
-			}
-			w.Write(message)
-
-			// Add queued chat messages to the current websocket message
-			n := len(client.Send)
-			for i := 0; i < n; i++ {
-				w.Write([]byte{'\n'})
-				w.Write(<-client.Send)
-			}
-
-			if err := w.Close(); err != nil {
+			// One event per frame, so clients can parse each as JSON
+			if err := client.Conn.WriteMessage(websocket.TextMessage, message); err != nil {
 				return
 			}
 
@@ -368,8 +522,32 @@ func (ws *MarketplaceWebSocketService) handleMessage(client *Client, message map
 			ws.unsubscribeFromThread(client, threadRef)
 		}
 
+	case "typing", "delivered", "read":
+		threadRef, ok := message["thread_ref"].(string)
+		if !ok {
+			return
+		}
+		if !ws.isSubscribed(client, threadRef) {
+			ws.reply(client, errorEvent(threadRef, "not subscribed to this thread"))
+			return
+		}
+		switch messageType {
+		case "typing":
+			// A bare typing message means the user started typing
+			typing, ok := message["typing"].(bool)
+			if !ok {
+				typing = true
+			}
+			ws.publish(typingEvent(threadRef, client.UserID, typing))
+		case "delivered":
+			ws.markDelivered(client, threadRef)
+		case "read":
+			ws.markRead(client, threadRef)
+		}
+
 	case "ping":
-		client.LastPing = time.Now()
+		ws.touch(client)
+		ws.heartbeat(client)
 
 	default:
 		log.Printf("Unknown message type: %s", messageType)
@@ -0,0 +1,353 @@
+package websocket
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Andrew-mugwe/agroai/middleware"
+	"github.com/Andrew-mugwe/agroai/models"
+	"github.com/Andrew-mugwe/agroai/services/messaging"
+)
+
+const testSecret = "test-secret"
+
+type fakeThreads struct {
+	mu           sync.Mutex
+	participants map[string][]uuid.UUID
+	delivered    map[uuid.UUID]time.Time
+	read         map[uuid.UUID]time.Time
+}
+
+func newFakeThreads(participants map[string][]uuid.UUID) *fakeThreads {
+	return &fakeThreads{
+		participants: participants,
+		delivered:    make(map[uuid.UUID]time.Time),
+		read:         make(map[uuid.UUID]time.Time),
+	}
+}
+
+func (f *fakeThreads) GetThreadParticipants(ctx context.Context, threadRef string) ([]*messaging.MarketplaceParticipant, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var participants []*messaging.MarketplaceParticipant
+	for _, userID := range f.participants[threadRef] {
+		participants = append(participants, &messaging.MarketplaceParticipant{
+			UserID:          userID,
+			LastDeliveredAt: f.delivered[userID],
+			LastReadAt:      f.read[userID],
+		})
+	}
+	return participants, nil
+}
+
+func (f *fakeThreads) MarkThreadAsDelivered(ctx context.Context, threadRef string, userID uuid.UUID) (time.Time, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.delivered[userID] = time.Now()
+	return f.delivered[userID], nil
+}
+
+func (f *fakeThreads) MarkThreadAsRead(ctx context.Context, threadRef string, userID uuid.UUID) (time.Time, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.read[userID] = time.Now()
+	f.delivered[userID] = f.read[userID]
+	return f.read[userID], nil
+}
+
+// instance is one API replica serving the marketplace websocket
+type instance struct {
+	service *MarketplaceWebSocketService
+	server  *httptest.Server
+}
+
+func newInstance(t *testing.T, threads Threads, broker Broker, presence Presence) *instance {
+	t.Helper()
+	service := NewMarketplaceWebSocketService(threads, broker, presence, []string{"https://agroai.example"})
+	go service.Run()
+	server := httptest.NewServer(http.HandlerFunc(service.HandleWebSocket))
+	t.Cleanup(func() {
+		server.Close()
+		service.Stop()
+	})
+	return &instance{service: service, server: server}
+}
+
+func signToken(t *testing.T, userID uuid.UUID) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, &middleware.Claims{
+		UserID: userID.String(),
+		Role:   models.RoleFarmer,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	})
+	signed, err := token.SignedString([]byte(testSecret))
+	require.NoError(t, err)
+	return signed
+}
+
+func (i *instance) dial(t *testing.T, header http.Header, query string) (*websocket.Conn, *http.Response, error) {
+	t.Helper()
+	url := "ws" + strings.TrimPrefix(i.server.URL, "http") + "/ws/marketplace" + query
+	conn, resp, err := websocket.DefaultDialer.Dial(url, header)
+	if conn != nil {
+		t.Cleanup(func() { conn.Close() })
+	}
+	return conn, resp, err
+}
+
+func (i *instance) connect(t *testing.T, userID uuid.UUID) *websocket.Conn {
+	t.Helper()
+	conn, _, err := i.dial(t, http.Header{"Authorization": {"Bearer " + signToken(t, userID)}}, "")
+	require.NoError(t, err)
+	return conn
+}
+
+func subscribe(t *testing.T, conn *websocket.Conn, threadRef string) Message {
+	t.Helper()
+	require.NoError(t, conn.WriteJSON(map[string]string{"type": "subscribe", "thread_ref": threadRef}))
+	return read(t, conn)
+}
+
+func read(t *testing.T, conn *websocket.Conn) Message {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var message Message
+	require.NoError(t, conn.ReadJSON(&message))
+	return message
+}
+
+func TestHandleWebSocketRequiresToken(t *testing.T) {
+	t.Setenv("JWT_SECRET", testSecret)
+	i := newInstance(t, newFakeThreads(nil), NewMemoryBroker(), NewMemoryPresence())
+
+	_, resp, err := i.dial(t, nil, "?user_id="+uuid.NewString())
+	require.Error(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	_, resp, err = i.dial(t, nil, "?token=not-a-jwt")
+	require.Error(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	// Browsers pass the token as a query parameter
+	_, _, err = i.dial(t, nil, "?token="+signToken(t, uuid.New()))
+	assert.NoError(t, err)
+}
+
+func TestHandleWebSocketChecksOrigin(t *testing.T) {
+	t.Setenv("JWT_SECRET", testSecret)
+	i := newInstance(t, newFakeThreads(nil), NewMemoryBroker(), NewMemoryPresence())
+	token := "?token=" + signToken(t, uuid.New())
+
+	_, resp, err := i.dial(t, http.Header{"Origin": {"https://evil.example"}}, token)
+	require.Error(t, err)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	_, _, err = i.dial(t, http.Header{"Origin": {"https://agroai.example"}}, token)
+	assert.NoError(t, err)
+	_, _, err = i.dial(t, http.Header{"Origin": {i.server.URL}}, token)
+	assert.NoError(t, err)
+}
+
+func TestSubscribeRequiresParticipant(t *testing.T) {
+	t.Setenv("JWT_SECRET", testSecret)
+	buyer, outsider := uuid.New(), uuid.New()
+	i := newInstance(t, newFakeThreads(map[string][]uuid.UUID{"THR-1": {buyer}}), NewMemoryBroker(), NewMemoryPresence())
+
+	conn := i.connect(t, outsider)
+	reply := subscribe(t, conn, "THR-1")
+	assert.Equal(t, EventError, reply.Type)
+	assert.Equal(t, "not a participant in this thread", reply.Data["error"])
+	assert.Equal(t, 0, i.service.GetThreadSubscribers("THR-1"))
+
+	conn = i.connect(t, buyer)
+	reply = subscribe(t, conn, "THR-1")
+	assert.Equal(t, EventSubscribed, reply.Type)
+	assert.Equal(t, 1, i.service.GetThreadSubscribers("THR-1"))
+}
+
+func TestBroadcastReachesOtherInstances(t *testing.T) {
+	t.Setenv("JWT_SECRET", testSecret)
+	buyer, seller := uuid.New(), uuid.New()
+	threads := newFakeThreads(map[string][]uuid.UUID{"THR-1": {buyer, seller}})
+	broker, presence := NewMemoryBroker(), NewMemoryPresence()
+	first := newInstance(t, threads, broker, presence)
+	second := newInstance(t, threads, broker, presence)
+
+	buyerConn := first.connect(t, buyer)
+	sellerConn := second.connect(t, seller)
+	require.Equal(t, EventSubscribed, subscribe(t, buyerConn, "THR-1").Type)
+	require.Equal(t, EventSubscribed, subscribe(t, sellerConn, "THR-1").Type)
+	// The buyer hears themselves, then the seller, come online
+	require.Equal(t, EventPresence, read(t, buyerConn).Type)
+	require.Equal(t, EventPresence, read(t, buyerConn).Type)
+	require.Equal(t, EventPresence, read(t, sellerConn).Type)
+
+	first.service.BroadcastNewMessage("THR-1", &messaging.MarketplaceMessage{
+		ID:       1,
+		SenderID: buyer,
+		Body:     "Is the maize still available?",
+	})
+
+	for _, conn := range []*websocket.Conn{buyerConn, sellerConn} {
+		event := read(t, conn)
+		assert.Equal(t, EventNewMessage, event.Type)
+		assert.Equal(t, "THR-1", event.ThreadRef)
+		assert.Equal(t, "Is the maize still available?", event.Data["body"])
+	}
+}
+
+// chat connects a buyer and seller to THR-1 and drains the presence events
+// sent as each joins
+func chat(t *testing.T, threads *fakeThreads, presence Presence) (buyer, seller uuid.UUID, buyerConn, sellerConn *websocket.Conn) {
+	t.Helper()
+	buyer, seller = uuid.New(), uuid.New()
+	threads.participants = map[string][]uuid.UUID{"THR-1": {buyer, seller}}
+	i := newInstance(t, threads, NewMemoryBroker(), presence)
+
+	buyerConn = i.connect(t, buyer)
+	require.Equal(t, EventSubscribed, subscribe(t, buyerConn, "THR-1").Type)
+	sellerConn = i.connect(t, seller)
+	require.Equal(t, EventSubscribed, subscribe(t, sellerConn, "THR-1").Type)
+	for _, conn := range []*websocket.Conn{buyerConn, buyerConn, sellerConn} {
+		require.Equal(t, EventPresence, read(t, conn).Type)
+	}
+	return buyer, seller, buyerConn, sellerConn
+}
+
+func TestTyping(t *testing.T) {
+	t.Setenv("JWT_SECRET", testSecret)
+	_, seller, buyerConn, sellerConn := chat(t, newFakeThreads(nil), NewMemoryPresence())
+
+	require.NoError(t, sellerConn.WriteJSON(map[string]interface{}{"type": "typing", "thread_ref": "THR-1"}))
+	event := read(t, buyerConn)
+	assert.Equal(t, EventTyping, event.Type)
+	assert.Equal(t, seller.String(), event.Data["user_id"])
+	assert.Equal(t, true, event.Data["typing"])
+
+	require.NoError(t, sellerConn.WriteJSON(map[string]interface{}{"type": "typing", "thread_ref": "THR-1", "typing": false}))
+	assert.Equal(t, false, read(t, buyerConn).Data["typing"])
+
+	// Typing in a thread the client has not subscribed to is refused
+	require.NoError(t, sellerConn.WriteJSON(map[string]interface{}{"type": "typing", "thread_ref": "THR-2"}))
+	for {
+		event := read(t, sellerConn)
+		if event.ThreadRef == "THR-2" {
+			assert.Equal(t, EventError, event.Type)
+			break
+		}
+	}
+}
+
+func TestReceipts(t *testing.T) {
+	t.Setenv("JWT_SECRET", testSecret)
+	threads := newFakeThreads(nil)
+	_, seller, buyerConn, sellerConn := chat(t, threads, NewMemoryPresence())
+
+	require.NoError(t, sellerConn.WriteJSON(map[string]string{"type": "delivered", "thread_ref": "THR-1"}))
+	event := read(t, buyerConn)
+	assert.Equal(t, EventDelivered, event.Type)
+	assert.Equal(t, seller.String(), event.Data["user_id"])
+
+	require.NoError(t, sellerConn.WriteJSON(map[string]string{"type": "read", "thread_ref": "THR-1"}))
+	event = read(t, buyerConn)
+	assert.Equal(t, EventRead, event.Type)
+	assert.NotEmpty(t, event.Data["at"])
+
+	threads.mu.Lock()
+	defer threads.mu.Unlock()
+	assert.False(t, threads.read[seller].IsZero())
+	assert.Equal(t, threads.read[seller], threads.delivered[seller], "reading delivers")
+}
+
+func TestPresence(t *testing.T) {
+	t.Setenv("JWT_SECRET", testSecret)
+	presence := NewMemoryPresence()
+	buyer, seller, buyerConn, sellerConn := chat(t, newFakeThreads(nil), presence)
+
+	statuses, err := presence.Status(context.Background(), []uuid.UUID{buyer, seller})
+	require.NoError(t, err)
+	assert.True(t, statuses[buyer].Online)
+	assert.True(t, statuses[seller].Online)
+
+	sellerConn.Close()
+	event := read(t, buyerConn)
+	assert.Equal(t, EventPresence, event.Type)
+	assert.Equal(t, seller.String(), event.Data["user_id"])
+	assert.Equal(t, false, event.Data["online"])
+	assert.NotEmpty(t, event.Data["last_seen"])
+
+	// Subscribers are sent each participant's state
+	conn := newInstance(t, newFakeThreads(map[string][]uuid.UUID{"THR-1": {buyer, seller}}), NewMemoryBroker(), presence).connect(t, buyer)
+	reply := subscribe(t, conn, "THR-1")
+	require.Equal(t, EventSubscribed, reply.Type)
+	participants := reply.Data["participants"].([]interface{})
+	require.Len(t, participants, 2)
+	assert.Equal(t, true, participants[0].(map[string]interface{})["online"])
+	assert.Equal(t, false, participants[1].(map[string]interface{})["online"])
+}
+
+func TestCleanupDeadConnections(t *testing.T) {
+	t.Setenv("JWT_SECRET", testSecret)
+	buyer, seller := uuid.New(), uuid.New()
+	i := newInstance(t, newFakeThreads(map[string][]uuid.UUID{"THR-1": {buyer, seller}}), NewMemoryBroker(), NewMemoryPresence())
+
+	buyerConn := i.connect(t, buyer)
+	require.Equal(t, EventSubscribed, subscribe(t, buyerConn, "THR-1").Type)
+	sellerConn := i.connect(t, seller)
+	require.Equal(t, EventSubscribed, subscribe(t, sellerConn, "THR-1").Type)
+	for _, conn := range []*websocket.Conn{buyerConn, buyerConn, sellerConn} {
+		require.Equal(t, EventPresence, read(t, conn).Type)
+	}
+
+	// The seller stops answering pings
+	i.service.mutex.Lock()
+	for client := range i.service.clients {
+		if client.UserID == seller {
+			client.LastPing = time.Now().Add(-2 * time.Minute)
+		}
+	}
+	i.service.mutex.Unlock()
+	i.service.cleanupDeadConnections()
+
+	event := read(t, buyerConn)
+	assert.Equal(t, EventPresence, event.Type)
+	assert.Equal(t, seller.String(), event.Data["user_id"])
+	assert.Equal(t, false, event.Data["online"])
+	assert.Equal(t, 1, i.service.GetConnectedClients())
+	assert.Equal(t, 1, i.service.GetThreadSubscribers("THR-1"))
+
+	sellerConn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, _, err := sellerConn.ReadMessage()
+	assert.Error(t, err, "the dead connection is closed")
+}
+
+func TestMemoryPresenceExpires(t *testing.T) {
+	presence := NewMemoryPresence()
+	userID, first, second := uuid.New(), uuid.New(), uuid.New()
+	ctx := context.Background()
+
+	require.NoError(t, presence.Connect(ctx, userID, first))
+	require.NoError(t, presence.Connect(ctx, userID, second))
+	require.NoError(t, presence.Disconnect(ctx, userID, first))
+	statuses, _ := presence.Status(ctx, []uuid.UUID{userID})
+	assert.True(t, statuses[userID].Online, "still connected on another device")
+
+	// A connection that stops heartbeating expires
+	presence.now = func() time.Time { return time.Now().Add(presenceTTL + time.Second) }
+	statuses, _ = presence.Status(ctx, []uuid.UUID{userID})
+	assert.False(t, statuses[userID].Online)
+	assert.NotNil(t, statuses[userID].LastSeen)
+}
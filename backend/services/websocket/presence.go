@@ -0,0 +1,172 @@
+package websocket
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+const (
+	// presenceTTL is how long a connection counts as online without a
+	// heartbeat; connections refresh it with every pong
+	presenceTTL = 90 * time.Second
+	// lastSeenTTL is how long last seen times are kept
+	lastSeenTTL = 30 * 24 * time.Hour
+
+	presenceKeyPrefix = "marketplace:presence:"
+	lastSeenKeyPrefix = "marketplace:last_seen:"
+)
+
+// PresenceStatus is whether a user is connected, and when they last were
+type PresenceStatus struct {
+	Online   bool       `json:"online"`
+	LastSeen *time.Time `json:"last_seen,omitempty"`
+}
+
+// Presence tracks which users have a connection on any instance. A user is
+// online while any of their connections is; connections that stop
+// heartbeating, e.g. on an instance that died, expire.
+type Presence interface {
+	// Connect marks a connection online, and refreshes it on heartbeats
+	Connect(ctx context.Context, userID, connID uuid.UUID) error
+	// Disconnect marks a connection offline
+	Disconnect(ctx context.Context, userID, connID uuid.UUID) error
+	// Status looks up users' presence
+	Status(ctx context.Context, userIDs []uuid.UUID) (map[uuid.UUID]PresenceStatus, error)
+}
+
+// MemoryPresence is Presence for a single instance
+type MemoryPresence struct {
+	mu          sync.Mutex
+	connections map[uuid.UUID]map[uuid.UUID]time.Time
+	lastSeen    map[uuid.UUID]time.Time
+	now         func() time.Time
+}
+
+// NewMemoryPresence creates an in-process presence store
+func NewMemoryPresence() *MemoryPresence {
+	return &MemoryPresence{
+		connections: make(map[uuid.UUID]map[uuid.UUID]time.Time),
+		lastSeen:    make(map[uuid.UUID]time.Time),
+		now:         time.Now,
+	}
+}
+
+// Connect marks a connection online
+func (p *MemoryPresence) Connect(ctx context.Context, userID, connID uuid.UUID) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.now()
+	if p.connections[userID] == nil {
+		p.connections[userID] = make(map[uuid.UUID]time.Time)
+	}
+	p.connections[userID][connID] = now.Add(presenceTTL)
+	p.lastSeen[userID] = now
+	return nil
+}
+
+// Disconnect marks a connection offline
+func (p *MemoryPresence) Disconnect(ctx context.Context, userID, connID uuid.UUID) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	delete(p.connections[userID], connID)
+	if len(p.connections[userID]) == 0 {
+		delete(p.connections, userID)
+	}
+	p.lastSeen[userID] = p.now()
+	return nil
+}
+
+// Status looks up users' presence
+func (p *MemoryPresence) Status(ctx context.Context, userIDs []uuid.UUID) (map[uuid.UUID]PresenceStatus, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.now()
+	statuses := make(map[uuid.UUID]PresenceStatus, len(userIDs))
+	for _, userID := range userIDs {
+		var status PresenceStatus
+		for _, expires := range p.connections[userID] {
+			if expires.After(now) {
+				status.Online = true
+				break
+			}
+		}
+		if lastSeen, ok := p.lastSeen[userID]; ok {
+			status.LastSeen = &lastSeen
+		}
+		statuses[userID] = status
+	}
+	return statuses, nil
+}
+
+// RedisPresence is Presence shared by instances over Redis. Each user has
+// a sorted set of connections scored by when they expire.
+type RedisPresence struct {
+	client *redis.Client
+}
+
+// NewRedisPresence creates a presence store on a Redis client
+func NewRedisPresence(client *redis.Client) *RedisPresence {
+	return &RedisPresence{client: client}
+}
+
+// Connect marks a connection online
+func (p *RedisPresence) Connect(ctx context.Context, userID, connID uuid.UUID) error {
+	now := time.Now()
+	key := presenceKeyPrefix + userID.String()
+
+	pipe := p.client.TxPipeline()
+	pipe.ZAdd(ctx, key, &redis.Z{Score: float64(now.Add(presenceTTL).Unix()), Member: connID.String()})
+	pipe.Expire(ctx, key, presenceTTL)
+	pipe.Set(ctx, lastSeenKeyPrefix+userID.String(), now.Unix(), lastSeenTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to record presence: %w", err)
+	}
+	return nil
+}
+
+// Disconnect marks a connection offline
+func (p *RedisPresence) Disconnect(ctx context.Context, userID, connID uuid.UUID) error {
+	pipe := p.client.TxPipeline()
+	pipe.ZRem(ctx, presenceKeyPrefix+userID.String(), connID.String())
+	pipe.Set(ctx, lastSeenKeyPrefix+userID.String(), time.Now().Unix(), lastSeenTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to record presence: %w", err)
+	}
+	return nil
+}
+
+// Status looks up users' presence
+func (p *RedisPresence) Status(ctx context.Context, userIDs []uuid.UUID) (map[uuid.UUID]PresenceStatus, error) {
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+
+	pipe := p.client.Pipeline()
+	online := make([]*redis.IntCmd, len(userIDs))
+	lastSeen := make([]*redis.StringCmd, len(userIDs))
+	for i, userID := range userIDs {
+		online[i] = pipe.ZCount(ctx, presenceKeyPrefix+userID.String(), "("+now, "+inf")
+		lastSeen[i] = pipe.Get(ctx, lastSeenKeyPrefix+userID.String())
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("failed to look up presence: %w", err)
+	}
+
+	statuses := make(map[uuid.UUID]PresenceStatus, len(userIDs))
+	for i, userID := range userIDs {
+		status := PresenceStatus{Online: online[i].Val() > 0}
+		if seconds, err := lastSeen[i].Int64(); err == nil {
+			seen := time.Unix(seconds, 0).UTC()
+			status.LastSeen = &seen
+		}
+		statuses[userID] = status
+	}
+	return statuses, nil
+}
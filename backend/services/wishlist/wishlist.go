@@ -0,0 +1,849 @@
+package wishlist
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Andrew-mugwe/agroai/models"
+	"github.com/Andrew-mugwe/agroai/pagination"
+	"github.com/Andrew-mugwe/agroai/repository"
+	"github.com/Andrew-mugwe/agroai/services/marketplace"
+	"github.com/Andrew-mugwe/agroai/services/notifications"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// Limits
+const (
+	// maxSavedSearches is how many searches one user may save
+	maxSavedSearches = 25
+	// matchLimit is the most new listings one saved search is matched
+	// against per sweep
+	matchLimit = 50
+	// searchBatch and recipientBatch bound the work done per sweep
+	searchBatch    = 200
+	recipientBatch = 200
+)
+
+// Wishlist and saved search errors
+var (
+	ErrItemNotFound       = errors.New("wishlist item not found")
+	ErrSearchNotFound     = errors.New("saved search not found")
+	ErrInvalidSearch      = errors.New("invalid saved search")
+	ErrTooManySearches    = fmt.Errorf("at most %d searches can be saved", maxSavedSearches)
+	ErrInvalidPreferences = errors.New("frequency must be instant, daily, weekly or off")
+)
+
+// wishlistSort is the only wishlist order; cursors carry it
+const wishlistSort = "newest"
+
+// wishlistKeyset lists wishlist items newest first
+var wishlistKeyset = pagination.Keyset{Key: "w.created_at", ID: "w.id", Dir: pagination.Desc}
+
+// SavedSearch is a marketplace search whose new listings a user is alerted to
+type SavedSearch struct {
+	ID     uuid.UUID              `json:"id"`
+	UserID uuid.UUID              `json:"user_id"`
+	Name   string                 `json:"name"`
+	Filter marketplace.ListFilter `json:"filter"`
+	// Notify turns alerts for new listings on
+	Notify    bool      `json:"notify"`
+	CheckedAt time.Time `json:"checked_at"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// SavedSearchRequest creates a saved search or, with only some fields set,
+// updates one
+type SavedSearchRequest struct {
+	Name   *string                 `json:"name,omitempty"`
+	Filter *marketplace.ListFilter `json:"filter,omitempty"`
+	Notify *bool                   `json:"notify,omitempty"`
+}
+
+// Notifier stores notifications in the user's inbox
+type Notifier interface {
+	SendNotification(req notifications.NotificationRequest) (*notifications.Notification, error)
+}
+
+// Pusher pushes notifications to the user's open websocket connections
+type Pusher interface {
+	SendToUser(userID string, message notifications.NotificationMessage)
+}
+
+// Service keeps wishlists and saved searches, and a background matcher
+// that alerts buyers to new matching listings, wishlist price drops and
+// restocks, alone or in digests
+type Service struct {
+	db       *sql.DB
+	market   *marketplace.Service
+	products repository.ProductRepository
+	notifier Notifier
+	pusher   Pusher
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	once   sync.Once
+}
+
+// NewService creates a new wishlist service
+func NewService(db *sql.DB, market *marketplace.Service, products repository.ProductRepository) *Service {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Service{
+		db:       db,
+		market:   market,
+		products: products,
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+}
+
+// SetNotifier registers the inbox alerts are stored in
+func (s *Service) SetNotifier(notifier Notifier) {
+	s.notifier = notifier
+}
+
+// SetPusher registers the realtime channel alerts are pushed on. It is
+// not needed with a notifier that delivers over websockets itself, such as
+// the notification dispatcher.
+func (s *Service) SetPusher(pusher Pusher) {
+	s.pusher = pusher
+}
+
+// Wishlist pages through a user's wishlist, newest first, with each
+// listing as it is now
+func (s *Service) Wishlist(ctx context.Context, userID uuid.UUID, page pagination.Params) (pagination.Page[*models.WishlistItem], error) {
+	var none pagination.Page[*models.WishlistItem]
+	page = page.Normalize()
+	after, err := page.After(wishlistSort)
+	if err != nil {
+		return none, err
+	}
+
+	var total int
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM wishlist_items WHERE user_id = $1`, userID).Scan(&total); err != nil {
+		return none, fmt.Errorf("failed to count wishlist: %w", err)
+	}
+
+	where := "w.user_id = $1"
+	args := []interface{}{userID}
+	if after != nil {
+		args = append(args, after.Key, after.ID)
+		where += " AND " + wishlistKeyset.After("$2", "$3")
+	}
+	args = append(args, page.FetchLimit())
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(`
+        SELECT w.id, w.user_id, w.product_id, w.seen_price_cents, w.created_at, %s
+        FROM wishlist_items w
+        WHERE %s
+        ORDER BY %s
+        LIMIT $%d`, wishlistKeyset.KeyText(), where, wishlistKeyset.OrderBy(), len(args)), args...)
+	if err != nil {
+		return none, fmt.Errorf("failed to get wishlist: %w", err)
+	}
+	defer rows.Close()
+
+	var items []*models.WishlistItem
+	var keys []string
+	for rows.Next() {
+		item := &models.WishlistItem{}
+		var key string
+		if err := rows.Scan(&item.ID, &item.UserID, &item.ProductID, &item.SeenPriceCents, &item.CreatedAt, &key); err != nil {
+			return none, fmt.Errorf("failed to scan wishlist item: %w", err)
+		}
+		items = append(items, item)
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return none, fmt.Errorf("failed to get wishlist: %w", err)
+	}
+
+	result := pagination.NewPage(items, page.Limit, func(i int) pagination.Cursor {
+		return pagination.Cursor{Key: keys[i], ID: items[i].ID.String(), Sort: wishlistSort}
+	}).WithTotal(total)
+	if err := s.attachProducts(ctx, result.Items); err != nil {
+		return none, err
+	}
+	return result, nil
+}
+
+// attachProducts loads the listings of wishlist items
+func (s *Service) attachProducts(ctx context.Context, items []*models.WishlistItem) error {
+	if len(items) == 0 {
+		return nil
+	}
+	ids := make([]uuid.UUID, len(items))
+	for i, item := range items {
+		ids[i] = item.ProductID
+	}
+	products, err := s.products.ListByIDs(ctx, ids)
+	if err != nil {
+		return fmt.Errorf("failed to load wishlist products: %w", err)
+	}
+	byID := make(map[uuid.UUID]*models.Product, len(products))
+	for _, p := range products {
+		byID[p.ID] = p
+	}
+	for _, item := range items {
+		item.Product = byID[item.ProductID]
+	}
+	return nil
+}
+
+// AddToWishlist saves an active listing to a user's wishlist. Adding a
+// listing twice returns the existing item.
+func (s *Service) AddToWishlist(ctx context.Context, userID, productID uuid.UUID) (*models.WishlistItem, error) {
+	product, err := s.market.GetPublicProduct(ctx, productID)
+	if err != nil {
+		return nil, err
+	}
+
+	item := &models.WishlistItem{UserID: userID, ProductID: productID, Product: product}
+	err = s.db.QueryRowContext(ctx, `
+        INSERT INTO wishlist_items (user_id, product_id, seen_price_cents, seen_in_stock)
+        VALUES ($1, $2, $3, $4)
+        ON CONFLICT (user_id, product_id) DO UPDATE SET user_id = EXCLUDED.user_id
+        RETURNING id, seen_price_cents, created_at`,
+		userID, productID, product.PriceCents, product.Stock > 0,
+	).Scan(&item.ID, &item.SeenPriceCents, &item.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to add to wishlist: %w", err)
+	}
+	return item, nil
+}
+
+// RemoveFromWishlist removes a listing from a user's wishlist
+func (s *Service) RemoveFromWishlist(ctx context.Context, userID, productID uuid.UUID) error {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM wishlist_items WHERE user_id = $1 AND product_id = $2`, userID, productID)
+	if err != nil {
+		return fmt.Errorf("failed to remove from wishlist: %w", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return ErrItemNotFound
+	}
+	return nil
+}
+
+const savedSearchColumns = `id, user_id, name, filter, notify, checked_at, created_at, updated_at`
+
+func scanSavedSearch(row interface{ Scan(...interface{}) error }) (*SavedSearch, error) {
+	var search SavedSearch
+	var filter []byte
+	if err := row.Scan(&search.ID, &search.UserID, &search.Name, &filter, &search.Notify,
+		&search.CheckedAt, &search.CreatedAt, &search.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(filter, &search.Filter); err != nil {
+		return nil, fmt.Errorf("failed to decode saved search %s: %w", search.ID, err)
+	}
+	return &search, nil
+}
+
+// SavedSearches lists a user's saved searches, newest first
+func (s *Service) SavedSearches(ctx context.Context, userID uuid.UUID) ([]*SavedSearch, error) {
+	rows, err := s.db.QueryContext(ctx, `
+        SELECT `+savedSearchColumns+`
+        FROM saved_searches
+        WHERE user_id = $1
+        ORDER BY created_at DESC`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get saved searches: %w", err)
+	}
+	defer rows.Close()
+
+	searches := []*SavedSearch{}
+	for rows.Next() {
+		search, err := scanSavedSearch(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan saved search: %w", err)
+		}
+		searches = append(searches, search)
+	}
+	return searches, rows.Err()
+}
+
+// CreateSavedSearch saves a search; its alerts cover listings created from
+// now on
+func (s *Service) CreateSavedSearch(ctx context.Context, userID uuid.UUID, req *SavedSearchRequest) (*SavedSearch, error) {
+	search := &SavedSearch{UserID: userID, Notify: true}
+	if err := applySearchRequest(search, req); err != nil {
+		return nil, err
+	}
+	if search.Name == "" {
+		return nil, fmt.Errorf("%w: name is required", ErrInvalidSearch)
+	}
+	filter, err := json.Marshal(search.Filter)
+	if err != nil {
+		return nil, err
+	}
+
+	row := s.db.QueryRowContext(ctx, `
+        INSERT INTO saved_searches (user_id, name, filter, notify)
+        SELECT $1, $2, $3, $4
+        WHERE (SELECT COUNT(*) FROM saved_searches WHERE user_id = $1) < $5
+        RETURNING `+savedSearchColumns,
+		userID, search.Name, filter, search.Notify, maxSavedSearches)
+	saved, err := scanSavedSearch(row)
+	if err == sql.ErrNoRows {
+		return nil, ErrTooManySearches
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to save search: %w", err)
+	}
+	return saved, nil
+}
+
+// UpdateSavedSearch renames a saved search, changes its filter or turns
+// its alerts on or off. A new filter is matched from now on.
+func (s *Service) UpdateSavedSearch(ctx context.Context, userID, id uuid.UUID, req *SavedSearchRequest) (*SavedSearch, error) {
+	search, err := s.savedSearch(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := applySearchRequest(search, req); err != nil {
+		return nil, err
+	}
+	filter, err := json.Marshal(search.Filter)
+	if err != nil {
+		return nil, err
+	}
+
+	row := s.db.QueryRowContext(ctx, `
+        UPDATE saved_searches
+        SET name = $3, filter = $4, notify = $5,
+            checked_at = CASE WHEN $6 THEN now() ELSE checked_at END,
+            updated_at = now()
+        WHERE id = $1 AND user_id = $2
+        RETURNING `+savedSearchColumns,
+		id, userID, search.Name, filter, search.Notify, req.Filter != nil)
+	updated, err := scanSavedSearch(row)
+	if err == sql.ErrNoRows {
+		return nil, ErrSearchNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update saved search: %w", err)
+	}
+	return updated, nil
+}
+
+// DeleteSavedSearch deletes a saved search and its pending alerts
+func (s *Service) DeleteSavedSearch(ctx context.Context, userID, id uuid.UUID) error {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM saved_searches WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete saved search: %w", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return ErrSearchNotFound
+	}
+	return nil
+}
+
+func (s *Service) savedSearch(ctx context.Context, userID, id uuid.UUID) (*SavedSearch, error) {
+	row := s.db.QueryRowContext(ctx, `
+        SELECT `+savedSearchColumns+`
+        FROM saved_searches
+        WHERE id = $1 AND user_id = $2`, id, userID)
+	search, err := scanSavedSearch(row)
+	if err == sql.ErrNoRows {
+		return nil, ErrSearchNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get saved search: %w", err)
+	}
+	return search, nil
+}
+
+// applySearchRequest copies the fields set on req onto search. Paging is
+// never saved.
+func applySearchRequest(search *SavedSearch, req *SavedSearchRequest) error {
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" || len(name) > 100 {
+			return fmt.Errorf("%w: name must be 1 to 100 characters", ErrInvalidSearch)
+		}
+		search.Name = name
+	}
+	if req.Filter != nil {
+		search.Filter = *req.Filter
+		search.Filter.Page = pagination.Params{}
+	}
+	if req.Notify != nil {
+		search.Notify = *req.Notify
+	}
+	return nil
+}
+
+// Preferences returns how often a user's alerts are delivered
+func (s *Service) Preferences(ctx context.Context, userID uuid.UUID) (*models.WatchPreferences, error) {
+	prefs := &models.WatchPreferences{Frequency: models.AlertInstant}
+	err := s.db.QueryRowContext(ctx, `
+        SELECT frequency, last_digest_at FROM watch_preferences WHERE user_id = $1`, userID,
+	).Scan(&prefs.Frequency, &prefs.LastDigestAt)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to get alert preferences: %w", err)
+	}
+	return prefs, nil
+}
+
+// SetPreferences changes how often a user's alerts are delivered. The
+// first digest comes one period after digests are turned on.
+func (s *Service) SetPreferences(ctx context.Context, userID uuid.UUID, frequency models.AlertFrequency) (*models.WatchPreferences, error) {
+	if !frequency.IsValid() {
+		return nil, ErrInvalidPreferences
+	}
+	prefs := &models.WatchPreferences{}
+	err := s.db.QueryRowContext(ctx, `
+        INSERT INTO watch_preferences (user_id, frequency, last_digest_at)
+        VALUES ($1, $2, now())
+        ON CONFLICT (user_id) DO UPDATE
+        SET frequency = EXCLUDED.frequency,
+            last_digest_at = COALESCE(watch_preferences.last_digest_at, now()),
+            updated_at = now()
+        RETURNING frequency, last_digest_at`, userID, frequency,
+	).Scan(&prefs.Frequency, &prefs.LastDigestAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set alert preferences: %w", err)
+	}
+	return prefs, nil
+}
+
+// Match looks for new listings matching saved searches and for wishlist
+// price drops and restocks, then delivers the alerts that are due
+func (s *Service) Match(ctx context.Context) error {
+	if err := s.matchSearches(ctx); err != nil {
+		return err
+	}
+	if err := s.matchWishlists(ctx); err != nil {
+		return err
+	}
+	return s.Deliver(ctx, time.Now())
+}
+
+// matchSearches queues alerts for listings created since each saved
+// search was last checked
+func (s *Service) matchSearches(ctx context.Context) error {
+	var latest sql.NullTime
+	if err := s.db.QueryRowContext(ctx, `SELECT MAX(created_at) FROM marketplace_products WHERE is_active`).Scan(&latest); err != nil {
+		return fmt.Errorf("failed to get latest listing: %w", err)
+	}
+	if !latest.Valid {
+		return nil
+	}
+
+	// Only searches that have not seen the latest listing need running
+	rows, err := s.db.QueryContext(ctx, `
+        SELECT `+savedSearchColumns+`
+        FROM saved_searches
+        WHERE notify AND checked_at < $1
+        ORDER BY checked_at
+        LIMIT $2`, latest.Time, searchBatch)
+	if err != nil {
+		return fmt.Errorf("failed to get saved searches to match: %w", err)
+	}
+	var searches []*SavedSearch
+	for rows.Next() {
+		search, err := scanSavedSearch(rows)
+		if err != nil {
+			log.Printf("wishlist: skipping saved search: %v", err)
+			continue
+		}
+		searches = append(searches, search)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to get saved searches to match: %w", err)
+	}
+
+	for _, search := range searches {
+		if err := s.matchSearch(ctx, search); err != nil {
+			log.Printf("wishlist: failed to match saved search %s: %v", search.ID, err)
+		}
+	}
+	return nil
+}
+
+// matchSearch runs one saved search over the newest listings
+func (s *Service) matchSearch(ctx context.Context, search *SavedSearch) error {
+	checkedAt := time.Now()
+
+	filter := search.Filter
+	filter.Sort = repository.ProductSortNewest
+	filter.Page = pagination.Params{Limit: matchLimit}
+	page, err := s.market.ListPublicProducts(ctx, filter)
+	if err != nil {
+		return err
+	}
+
+	matches := newListings(page.Items, search.UserID, search.CheckedAt)
+	if len(matches) > 0 {
+		ids := make([]uuid.UUID, len(matches))
+		prices := make([]int64, len(matches))
+		for i, p := range matches {
+			ids[i] = p.ID
+			prices[i] = p.PriceCents
+		}
+		_, err := s.db.ExecContext(ctx, `
+            INSERT INTO watch_alerts (user_id, kind, product_id, saved_search_id, price_cents)
+            SELECT $1, 'new_listing', m.id, $2, m.price
+            FROM unnest($3::uuid[], $4::bigint[]) AS m(id, price)
+            ON CONFLICT DO NOTHING`,
+			search.UserID, search.ID, pq.Array(uuidStrings(ids)), pq.Array(prices))
+		if err != nil {
+			return fmt.Errorf("failed to queue new listing alerts: %w", err)
+		}
+	}
+
+	_, err = s.db.ExecContext(ctx, `UPDATE saved_searches SET checked_at = $2 WHERE id = $1`, search.ID, checkedAt)
+	return err
+}
+
+// newListings keeps the listings created after since, leaving out the
+// user's own
+func newListings(products []*models.Product, userID uuid.UUID, since time.Time) []*models.Product {
+	var matches []*models.Product
+	for _, p := range products {
+		if p.CreatedAt.After(since) && p.SellerID != userID {
+			matches = append(matches, p)
+		}
+	}
+	return matches
+}
+
+// matchWishlists queues alerts for wishlisted listings that got cheaper or
+// came back into stock, and remembers each listing's new price and
+// availability so every change is alerted once
+func (s *Service) matchWishlists(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, `
+        WITH changed AS (
+            SELECT w.id, w.user_id, w.product_id, w.seen_price_cents, w.seen_in_stock,
+                   p.price_cents, p.stock > 0 AS in_stock
+            FROM wishlist_items w
+            JOIN marketplace_products p ON p.id = w.product_id
+            WHERE p.is_active
+              AND (p.price_cents <> w.seen_price_cents OR (p.stock > 0) <> w.seen_in_stock)
+            FOR UPDATE OF w SKIP LOCKED
+        ), seen AS (
+            UPDATE wishlist_items w
+            SET seen_price_cents = c.price_cents, seen_in_stock = c.in_stock
+            FROM changed c
+            WHERE w.id = c.id
+        )
+        INSERT INTO watch_alerts (user_id, kind, product_id, price_cents, previous_price_cents)
+        SELECT user_id, 'price_drop', product_id, price_cents, seen_price_cents
+        FROM changed
+        WHERE price_cents < seen_price_cents
+        UNION ALL
+        SELECT user_id, 'back_in_stock', product_id, price_cents, NULL
+        FROM changed
+        WHERE in_stock AND NOT seen_in_stock`)
+	if err != nil {
+		return fmt.Errorf("failed to match wishlists: %w", err)
+	}
+	return nil
+}
+
+// recipient is a user with pending alerts
+type recipient struct {
+	userID uuid.UUID
+	role   string
+	prefs  models.WatchPreferences
+	alerts []models.WatchAlert
+}
+
+// Deliver sends pending alerts: one at a time to users who want them
+// straight away, and as a digest to users whose digest is due. Alerts of
+// users who turned alerts off are dropped.
+func (s *Service) Deliver(ctx context.Context, now time.Time) error {
+	recipients, err := s.pendingAlerts(ctx, now)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range recipients {
+		var delivered []uuid.UUID
+		digest := false
+		switch {
+		case r.prefs.Frequency == models.AlertOff:
+			for _, a := range r.alerts {
+				delivered = append(delivered, a.ID)
+			}
+		case r.prefs.Frequency.Period() == 0:
+			for _, a := range r.alerts {
+				if s.send(r, alertNotice(a)) {
+					delivered = append(delivered, a.ID)
+				}
+			}
+		case digestDue(r.prefs, now):
+			if !s.send(r, digestNotice(r.alerts, r.prefs.Frequency)) {
+				continue
+			}
+			for _, a := range r.alerts {
+				delivered = append(delivered, a.ID)
+			}
+			digest = true
+		}
+
+		if err := s.markDelivered(ctx, r.userID, delivered, digest, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pendingAlerts loads every undelivered alert of up to recipientBatch users
+// with something to send now, longest waiting first. Users whose digest is
+// not due yet are left out, so they do not hold up instant alerts.
+func (s *Service) pendingAlerts(ctx context.Context, now time.Time) ([]*recipient, error) {
+	rows, err := s.db.QueryContext(ctx, `
+        WITH due AS (
+            SELECT a.user_id
+            FROM watch_alerts a
+            LEFT JOIN watch_preferences wp ON wp.user_id = a.user_id
+            WHERE a.delivered_at IS NULL
+              AND (COALESCE(wp.frequency, 'instant') IN ('instant', 'off')
+                   OR wp.last_digest_at IS NULL
+                   OR (wp.frequency = 'daily' AND wp.last_digest_at <= $2)
+                   OR (wp.frequency = 'weekly' AND wp.last_digest_at <= $3))
+            GROUP BY a.user_id
+            ORDER BY MIN(a.created_at)
+            LIMIT $1
+        )
+        SELECT a.id, a.user_id, a.kind, a.product_id, p.title, p.currency,
+               a.saved_search_id, COALESCE(ss.name, ''), a.price_cents, a.previous_price_cents,
+               a.created_at, u.role, COALESCE(wp.frequency, 'instant'), wp.last_digest_at
+        FROM watch_alerts a
+        JOIN due ON due.user_id = a.user_id
+        JOIN marketplace_products p ON p.id = a.product_id
+        JOIN users u ON u.id = a.user_id
+        LEFT JOIN saved_searches ss ON ss.id = a.saved_search_id
+        LEFT JOIN watch_preferences wp ON wp.user_id = a.user_id
+        WHERE a.delivered_at IS NULL
+        ORDER BY a.user_id, a.created_at`,
+		recipientBatch, now.Add(-models.AlertDaily.Period()), now.Add(-models.AlertWeekly.Period()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pending alerts: %w", err)
+	}
+	defer rows.Close()
+
+	var recipients []*recipient
+	var current *recipient
+	for rows.Next() {
+		var a models.WatchAlert
+		var role string
+		var prefs models.WatchPreferences
+		if err := rows.Scan(&a.ID, &a.UserID, &a.Kind, &a.ProductID, &a.ProductTitle, &a.Currency,
+			&a.SavedSearchID, &a.SearchName, &a.PriceCents, &a.PreviousPriceCents,
+			&a.CreatedAt, &role, &prefs.Frequency, &prefs.LastDigestAt); err != nil {
+			return nil, fmt.Errorf("failed to scan alert: %w", err)
+		}
+		if current == nil || current.userID != a.UserID {
+			current = &recipient{userID: a.UserID, role: notificationRole(role), prefs: prefs}
+			recipients = append(recipients, current)
+		}
+		current.alerts = append(current.alerts, a)
+	}
+	return recipients, rows.Err()
+}
+
+// markDelivered marks alerts delivered and, after a digest, starts the
+// next digest period
+func (s *Service) markDelivered(ctx context.Context, userID uuid.UUID, ids []uuid.UUID, digest bool, now time.Time) error {
+	if len(ids) > 0 {
+		if _, err := s.db.ExecContext(ctx, `
+            UPDATE watch_alerts SET delivered_at = $2 WHERE id = ANY($1::uuid[])`,
+			pq.Array(uuidStrings(ids)), now); err != nil {
+			return fmt.Errorf("failed to mark alerts delivered: %w", err)
+		}
+	}
+	if digest {
+		if _, err := s.db.ExecContext(ctx, `
+            UPDATE watch_preferences SET last_digest_at = $2 WHERE user_id = $1`, userID, now); err != nil {
+			return fmt.Errorf("failed to record digest: %w", err)
+		}
+	}
+	return nil
+}
+
+// digestDue reports whether a digest period has passed since the last one
+func digestDue(prefs models.WatchPreferences, now time.Time) bool {
+	return prefs.LastDigestAt == nil || now.Sub(*prefs.LastDigestAt) >= prefs.Frequency.Period()
+}
+
+// notice is an alert ready to send
+type notice struct {
+	// kind is the inbox notification type and event the realtime one
+	kind    string
+	event   string
+	title   string
+	message string
+	data    map[string]interface{}
+}
+
+// alertNotice describes a single alert
+func alertNotice(a models.WatchAlert) notice {
+	n := notice{
+		event: string(a.Kind),
+		data: map[string]interface{}{
+			"alert_id":    a.ID.String(),
+			"product_id":  a.ProductID.String(),
+			"price_cents": a.PriceCents,
+			"currency":    a.Currency,
+		},
+	}
+	price := formatPrice(a.PriceCents, a.Currency)
+	switch a.Kind {
+	case models.WatchNewListing:
+		n.kind, n.title = "market", "New listing"
+		n.message = fmt.Sprintf("New listing for %q: %s at %s", a.SearchName, a.ProductTitle, price)
+		if a.SavedSearchID != nil {
+			n.data["saved_search_id"] = a.SavedSearchID.String()
+		}
+	case models.WatchPriceDrop:
+		n.kind, n.title = "price", "Price drop"
+		n.message = fmt.Sprintf("%s is now %s", a.ProductTitle, price)
+		if a.PreviousPriceCents != nil {
+			n.message = fmt.Sprintf("%s dropped from %s to %s", a.ProductTitle, formatPrice(*a.PreviousPriceCents, a.Currency), price)
+			n.data["previous_price_cents"] = *a.PreviousPriceCents
+		}
+	case models.WatchBackInStock:
+		n.kind, n.title = "stock", "Back in stock"
+		n.message = fmt.Sprintf("%s is back in stock at %s", a.ProductTitle, price)
+	}
+	return n
+}
+
+// digestNotice sums up a period's alerts in one notification
+func digestNotice(alerts []models.WatchAlert, frequency models.AlertFrequency) notice {
+	counts := map[models.WatchAlertKind]int{}
+	items := make([]map[string]interface{}, len(alerts))
+	for i, a := range alerts {
+		counts[a.Kind]++
+		n := alertNotice(a)
+		items[i] = map[string]interface{}{
+			"kind":       a.Kind,
+			"product_id": a.ProductID.String(),
+			"message":    n.message,
+		}
+	}
+
+	var parts []string
+	for _, part := range []struct {
+		kind models.WatchAlertKind
+		noun string
+	}{
+		{models.WatchNewListing, "new listing"},
+		{models.WatchPriceDrop, "price drop"},
+		{models.WatchBackInStock, "restock"},
+	} {
+		if c := counts[part.kind]; c == 1 {
+			parts = append(parts, "1 "+part.noun)
+		} else if c > 1 {
+			parts = append(parts, fmt.Sprintf("%d %ss", c, part.noun))
+		}
+	}
+
+	return notice{
+		kind:    "market",
+		event:   "watch_digest",
+		title:   fmt.Sprintf("Your %s marketplace digest", frequency),
+		message: "Since your last digest: " + strings.Join(parts, ", "),
+		data: map[string]interface{}{
+			"frequency": frequency,
+			"alerts":    items,
+		},
+	}
+}
+
+// send stores a notice in the user's inbox and pushes it to their open
+// connections. It reports whether the notice was stored.
+func (s *Service) send(r *recipient, n notice) bool {
+	if s.notifier != nil {
+		// A dispatching notifier delivers the notice under its event and title
+		metadata := make(map[string]interface{}, len(n.data)+2)
+		for k, v := range n.data {
+			metadata[k] = v
+		}
+		metadata["event"] = n.event
+		metadata["title"] = n.title
+
+		_, err := s.notifier.SendNotification(notifications.NotificationRequest{
+			UserID:   r.userID,
+			Role:     r.role,
+			Type:     n.kind,
+			Message:  n.message,
+			Metadata: metadata,
+		})
+		if err != nil {
+			log.Printf("wishlist: failed to notify %s: %v", r.userID, err)
+			return false
+		}
+	}
+	if s.pusher != nil {
+		s.pusher.SendToUser(r.userID.String(), notifications.NotificationMessage{
+			Type:      n.event,
+			Title:     n.title,
+			Message:   n.message,
+			Data:      n.data,
+			Timestamp: time.Now(),
+		})
+	}
+	return true
+}
+
+// notificationRole is the inbox role for a user; marketplace buyers
+// without a notification role are treated as farmers
+func notificationRole(role string) string {
+	switch models.UserRole(role) {
+	case models.RoleFarmer, models.RoleNGO, models.RoleTrader, models.RoleAdmin:
+		return role
+	}
+	return string(models.RoleFarmer)
+}
+
+// formatPrice renders cents as an amount, e.g. "KES 3500.00"
+func formatPrice(cents int64, currency string) string {
+	return fmt.Sprintf("%s %.2f", currency, float64(cents)/100)
+}
+
+func uuidStrings(ids []uuid.UUID) []string {
+	out := make([]string, len(ids))
+	for i, id := range ids {
+		out[i] = id.String()
+	}
+	return out
+}
+
+// Start runs the matcher on an interval
+func (s *Service) Start(interval time.Duration) {
+	s.once.Do(func() {
+		log.Printf("Starting wishlist and saved search alerts (interval: %v)", interval)
+
+		go func() {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-s.ctx.Done():
+					return
+				case <-ticker.C:
+					if err := s.Match(s.ctx); err != nil {
+						log.Printf("Wishlist alert matching failed: %v", err)
+					}
+				}
+			}
+		}()
+	})
+}
+
+// Stop stops the background matcher
+func (s *Service) Stop() {
+	s.cancel()
+}
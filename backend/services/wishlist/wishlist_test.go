@@ -0,0 +1,102 @@
+package wishlist
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/Andrew-mugwe/agroai/models"
+	"github.com/Andrew-mugwe/agroai/pagination"
+	"github.com/Andrew-mugwe/agroai/services/marketplace"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewListings(t *testing.T) {
+	since := time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+	buyer, seller := uuid.New(), uuid.New()
+
+	fresh := &models.Product{ID: uuid.New(), SellerID: seller, CreatedAt: since.Add(time.Minute)}
+	own := &models.Product{ID: uuid.New(), SellerID: buyer, CreatedAt: since.Add(time.Minute)}
+	old := &models.Product{ID: uuid.New(), SellerID: seller, CreatedAt: since}
+
+	matches := newListings([]*models.Product{fresh, own, old}, buyer, since)
+	require.Len(t, matches, 1)
+	assert.Equal(t, fresh.ID, matches[0].ID)
+}
+
+func TestDigestDue(t *testing.T) {
+	now := time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+	at := func(ago time.Duration) *time.Time {
+		t := now.Add(-ago)
+		return &t
+	}
+
+	assert.True(t, digestDue(models.WatchPreferences{Frequency: models.AlertDaily}, now))
+	assert.True(t, digestDue(models.WatchPreferences{Frequency: models.AlertDaily, LastDigestAt: at(25 * time.Hour)}, now))
+	assert.False(t, digestDue(models.WatchPreferences{Frequency: models.AlertDaily, LastDigestAt: at(23 * time.Hour)}, now))
+	assert.False(t, digestDue(models.WatchPreferences{Frequency: models.AlertWeekly, LastDigestAt: at(6 * 24 * time.Hour)}, now))
+	assert.True(t, digestDue(models.WatchPreferences{Frequency: models.AlertWeekly, LastDigestAt: at(7 * 24 * time.Hour)}, now))
+}
+
+func TestAlertNotice(t *testing.T) {
+	searchID := uuid.New()
+	previous := int64(400000)
+
+	n := alertNotice(models.WatchAlert{
+		Kind: models.WatchNewListing, ProductTitle: "DAP 50kg", Currency: "KES",
+		SavedSearchID: &searchID, SearchName: "Fertiliser", PriceCents: 350000,
+	})
+	assert.Equal(t, "market", n.kind)
+	assert.Equal(t, `New listing for "Fertiliser": DAP 50kg at KES 3500.00`, n.message)
+	assert.Equal(t, searchID.String(), n.data["saved_search_id"])
+
+	n = alertNotice(models.WatchAlert{
+		Kind: models.WatchPriceDrop, ProductTitle: "DAP 50kg", Currency: "KES",
+		PriceCents: 350000, PreviousPriceCents: &previous,
+	})
+	assert.Equal(t, "price", n.kind)
+	assert.Equal(t, "DAP 50kg dropped from KES 4000.00 to KES 3500.00", n.message)
+
+	n = alertNotice(models.WatchAlert{Kind: models.WatchBackInStock, ProductTitle: "DAP 50kg", Currency: "KES", PriceCents: 350000})
+	assert.Equal(t, "stock", n.kind)
+	assert.Equal(t, "back_in_stock", n.event)
+}
+
+func TestDigestNotice(t *testing.T) {
+	alerts := []models.WatchAlert{
+		{Kind: models.WatchNewListing, ProductTitle: "Maize seed", Currency: "KES"},
+		{Kind: models.WatchNewListing, ProductTitle: "Bean seed", Currency: "KES"},
+		{Kind: models.WatchBackInStock, ProductTitle: "DAP 50kg", Currency: "KES"},
+	}
+	n := digestNotice(alerts, models.AlertDaily)
+	assert.Equal(t, "watch_digest", n.event)
+	assert.Equal(t, "Since your last digest: 2 new listings, 1 restock", n.message)
+	assert.Len(t, n.data["alerts"], 3)
+}
+
+func TestApplySearchRequest(t *testing.T) {
+	name := "  Maize seed  "
+	notify := false
+	filter := marketplace.ListFilter{Query: "maize", Category: "seeds", Page: pagination.Params{Limit: 5, Cursor: &pagination.Cursor{ID: "abc"}}}
+
+	search := &SavedSearch{Notify: true}
+	require.NoError(t, applySearchRequest(search, &SavedSearchRequest{Name: &name, Filter: &filter, Notify: &notify}))
+	assert.Equal(t, "Maize seed", search.Name)
+	assert.False(t, search.Notify)
+	assert.Equal(t, pagination.Params{}, search.Filter.Page)
+
+	// Filters are stored under their query parameter names
+	raw, err := json.Marshal(search.Filter)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"q":"maize","category":"seeds"}`, string(raw))
+
+	blank := " "
+	assert.ErrorIs(t, applySearchRequest(search, &SavedSearchRequest{Name: &blank}), ErrInvalidSearch)
+}
+
+func TestNotificationRole(t *testing.T) {
+	assert.Equal(t, "trader", notificationRole("trader"))
+	assert.Equal(t, "farmer", notificationRole("buyer"))
+}
@@ -52,7 +52,7 @@ func TestMessageSeedingAndRetrieval(t *testing.T) {
 	defer cleanupTestDB(t, db)
 
 	// Create messaging service and handler
-	messagingService := messaging.NewMessagingService(db)
+	messagingService := messaging.NewMessagingService(db, messaging.NewMarketplaceMessagingService(db))
 	messageHandler := handlers.NewMessageHandler(messagingService)
 
 	// Test user IDs (should exist in seeded data)
@@ -153,7 +153,7 @@ func TestAPIIntegration(t *testing.T) {
 	db := setupTestDB(t)
 	defer db.Close()
 
-	messagingService := messaging.NewMessagingService(db)
+	messagingService := messaging.NewMessagingService(db, messaging.NewMarketplaceMessagingService(db))
 	messageHandler := handlers.NewMessageHandler(messagingService)
 
 	t.Run("Should handle GET /api/messages/conversations", func(t *testing.T) {
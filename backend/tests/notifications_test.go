@@ -12,6 +12,7 @@ import (
 
 	"github.com/Andrew-mugwe/agroai/handlers"
 	"github.com/Andrew-mugwe/agroai/models"
+	"github.com/Andrew-mugwe/agroai/pagination"
 	"github.com/Andrew-mugwe/agroai/services/notifications"
 )
 
@@ -247,8 +248,7 @@ func TestNotificationService(t *testing.T) {
 		userID := uuid.MustParse(testUser.ID)
 		query := notifications.NotificationQuery{
 			UserID: &userID,
-			Limit:  10,
-			Offset: 0,
+			Page:   pagination.Params{Limit: 10},
 		}
 
 		response, err := notificationService.GetNotifications(query)
@@ -265,8 +265,7 @@ func TestNotificationService(t *testing.T) {
 			Role:   "farmer",
 			Type:   "weather",
 			Status: "unread",
-			Limit:  5,
-			Offset: 0,
+			Page:   pagination.Params{Limit: 5},
 		}
 
 		response, err := notificationService.GetNotifications(query)
@@ -319,7 +318,7 @@ func TestNotificationService(t *testing.T) {
 func TestNotificationHandler(t *testing.T) {
 	// Create mock notification service
 	notificationService := &notifications.NotificationService{}
-	notificationHandler := handlers.NewNotificationHandler(notificationService)
+	notificationHandler := handlers.NewNotificationHandler(notificationService, notifications.NewDatabaseNotificationService(nil), nil, nil)
 
 	t.Run("GetNotifications - Unauthorized", func(t *testing.T) {
 		req := httptest.NewRequest("GET", "/api/notifications", nil)
@@ -23,18 +23,6 @@ func RespondWithValidationError(w http.ResponseWriter, message string) {
 	RespondWithError(w, http.StatusBadRequest, message)
 }
 
-func RespondWithPagination(w http.ResponseWriter, code int, data interface{}, page, pageSize, total int) {
-	response := map[string]interface{}{
-		"data": data,
-		"pagination": map[string]interface{}{
-			"page":      page,
-			"page_size": pageSize,
-			"total":     total,
-		},
-	}
-	RespondWithJSON(w, code, response)
-}
-
 func GetUserIDFromContext(r *http.Request) (uuid.UUID, error) {
 	userID, ok := r.Context().Value("user_id").(uuid.UUID)
 	if !ok {
@@ -3,6 +3,7 @@ package utils
 import (
 	"crypto/tls"
 	"fmt"
+	"mime"
 	"net/smtp"
 	"os"
 	"strings"
@@ -74,6 +75,33 @@ func SendEmailAlert(subject string, body string) error {
 	return sendEmail(config, message)
 }
 
+// SendEmail sends a plain-text email to users. Unlike the alert helpers it
+// takes its SMTP settings from the caller; FromEmail defaults to the
+// SMTP username.
+func SendEmail(config *EmailConfig, to []string, subject string, body string) error {
+	return SendHTMLEmail(config, to, subject, body, "")
+}
+
+// SendHTMLEmail sends an email to users with plain-text and HTML
+// alternatives; without html it is plain text only
+func SendHTMLEmail(config *EmailConfig, to []string, subject, body, html string) error {
+	if config == nil || config.SMTPHost == "" {
+		return fmt.Errorf("SMTP is not configured")
+	}
+	if len(to) == 0 {
+		return fmt.Errorf("no recipients")
+	}
+	cfg := *config
+	if cfg.FromEmail == "" {
+		cfg.FromEmail = cfg.SMTPUsername
+	}
+	if cfg.SMTPPort == "" {
+		cfg.SMTPPort = "587"
+	}
+
+	return sendEmail(&cfg, &EmailMessage{To: to, Subject: subject, Body: body, HTML: html})
+}
+
 // SendEmailTestFailureAlert sends a test failure alert email
 func SendEmailTestFailureAlert(testName string, errorMsg string, buildURL string) error {
 	config, err := GetEmailConfig()
@@ -262,11 +290,20 @@ func sendEmail(config *EmailConfig, message *EmailMessage) error {
 	// Write email headers and body
 	emailData := fmt.Sprintf("From: %s\r\n", config.FromEmail)
 	emailData += fmt.Sprintf("To: %s\r\n", strings.Join(message.To, ", "))
-	emailData += fmt.Sprintf("Subject: %s\r\n", message.Subject)
+	emailData += fmt.Sprintf("Subject: %s\r\n", mime.QEncoding.Encode("utf-8", message.Subject))
 	emailData += "MIME-Version: 1.0\r\n"
-	emailData += "Content-Type: text/plain; charset=UTF-8\r\n"
-	emailData += "\r\n"
-	emailData += message.Body
+	if message.HTML == "" {
+		emailData += "Content-Type: text/plain; charset=UTF-8\r\n"
+		emailData += "\r\n"
+		emailData += message.Body
+	} else {
+		boundary := fmt.Sprintf("agroai-%d", time.Now().UnixNano())
+		emailData += fmt.Sprintf("Content-Type: multipart/alternative; boundary=%q\r\n", boundary)
+		emailData += "\r\n"
+		emailData += fmt.Sprintf("--%s\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n%s\r\n", boundary, message.Body)
+		emailData += fmt.Sprintf("--%s\r\nContent-Type: text/html; charset=UTF-8\r\n\r\n%s\r\n", boundary, message.HTML)
+		emailData += fmt.Sprintf("--%s--\r\n", boundary)
+	}
 
 	_, err = writer.Write([]byte(emailData))
 	if err != nil {
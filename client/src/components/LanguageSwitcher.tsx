@@ -2,6 +2,7 @@ import React, { useState } from 'react';
 import { useTranslation } from 'react-i18next';
 import { motion, AnimatePresence } from 'framer-motion';
 import { Globe, Check, ChevronDown } from 'lucide-react';
+import { setNotificationLanguage } from '../services/notificationApi';
 
 interface Language {
   code: string;
@@ -30,6 +31,11 @@ export const LanguageSwitcher: React.FC = () => {
       if (userRole) {
         const { loadRoleNamespace } = await import('../i18n');
         await loadRoleNamespace(userRole, langCode);
+
+        // Notifications are rendered on the server in the user's language
+        setNotificationLanguage(langCode).catch(error => {
+          console.error('Failed to save notification language:', error);
+        });
       }
       
       setIsOpen(false);
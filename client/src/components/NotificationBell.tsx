@@ -16,14 +16,14 @@ interface Notification {
 }
 
 interface NotificationResponse {
-  success: boolean;
-  message: string;
-  notifications: Notification[];
-  total: number;
+  data: Notification[];
+  pagination: {
+    limit: number;
+    next_cursor?: string;
+    has_more: boolean;
+    total?: number;
+  };
   unread_count: number;
-  page: number;
-  page_size: number;
-  total_pages: number;
 }
 
 const NotificationBell: React.FC = () => {
@@ -45,10 +45,8 @@ const NotificationBell: React.FC = () => {
         },
       });
 
-      if (response.data.success) {
-        setNotifications(response.data.notifications);
-        setUnreadCount(response.data.unread_count);
-      }
+      setNotifications(response.data.data);
+      setUnreadCount(response.data.unread_count);
     } catch (error) {
       console.error('Failed to fetch notifications:', error);
     } finally {
@@ -37,6 +37,7 @@ export default function ChatRoom({ conversationId, currentUserId, onBack }: Chat
   const [error, setError] = useState<string | null>(null)
   const [hasMore, setHasMore] = useState(false)
   const [loadingMore, setLoadingMore] = useState(false)
+  const [nextCursor, setNextCursor] = useState<string | undefined>()
   const [conversation, setConversation] = useState<ConversationPreview | null>(null)
   
   const messagesEndRef = useRef<HTMLDivElement>(null)
@@ -46,9 +47,10 @@ export default function ChatRoom({ conversationId, currentUserId, onBack }: Chat
     messagesEndRef.current?.scrollIntoView({ behavior: 'smooth' })
   }
 
-  const fetchMessages = async (afterTimestamp?: string) => {
+  // cursor continues to older messages; without it the newest page is loaded
+  const fetchMessages = async (cursor?: string) => {
     try {
-      if (afterTimestamp) {
+      if (cursor) {
         setLoadingMore(true)
       } else {
         setLoading(true)
@@ -64,8 +66,8 @@ export default function ChatRoom({ conversationId, currentUserId, onBack }: Chat
         limit: '50'
       })
       
-      if (afterTimestamp) {
-        params.append('after', afterTimestamp)
+      if (cursor) {
+        params.append('cursor', cursor)
       }
 
       const response = await axios.get(`/api/messages/thread/${conversationId}?${params}`, {
@@ -74,19 +76,16 @@ export default function ChatRoom({ conversationId, currentUserId, onBack }: Chat
         }
       })
 
-      if (response.data.success) {
-        const newMessages = response.data.messages
-        setHasMore(response.data.has_more)
-        
-        if (afterTimestamp) {
-          // Prepend older messages
-          setMessages(prev => [...prev, ...newMessages])
-        } else {
-          // Replace with new messages
-          setMessages(newMessages)
-        }
+      const newMessages = response.data.data
+      setHasMore(response.data.pagination.has_more)
+      setNextCursor(response.data.pagination.next_cursor)
+
+      if (cursor) {
+        // Append older messages
+        setMessages(prev => [...prev, ...newMessages])
       } else {
-        throw new Error(response.data.message || 'Failed to fetch messages')
+        // Replace with new messages
+        setMessages(newMessages)
       }
     } catch (err) {
       setError(err instanceof Error ? err.message : 'Failed to fetch messages')
@@ -124,9 +123,8 @@ export default function ChatRoom({ conversationId, currentUserId, onBack }: Chat
   }
 
   const handleLoadMore = () => {
-    if (messages.length > 0 && hasMore && !loadingMore) {
-      const oldestMessage = messages[messages.length - 1]
-      fetchMessages(oldestMessage.created_at)
+    if (nextCursor && hasMore && !loadingMore) {
+      fetchMessages(nextCursor)
     }
   }
 
@@ -149,9 +147,9 @@ export default function ChatRoom({ conversationId, currentUserId, onBack }: Chat
   // Poll for new messages every 5 seconds
   useEffect(() => {
     const interval = setInterval(() => {
-      if (messages.length > 0) {
-        const latestMessage = messages[0]
-        fetchMessages(latestMessage.created_at)
+      // Refresh the newest page unless older pages have been loaded
+      if (messages.length > 0 && !loadingMore && messages.length <= 50) {
+        fetchMessages()
       }
     }, 5000)
 
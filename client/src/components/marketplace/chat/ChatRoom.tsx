@@ -66,7 +66,7 @@ const ChatRoom: React.FC<ChatRoomProps> = ({
   const messagesContainerRef = useRef<HTMLDivElement>(null);
 
   // WebSocket hook
-  const { isConnected, subscribe, unsubscribe } = useMarketplaceSocket({
+  const { isConnected, subscribe, unsubscribe, markRead } = useMarketplaceSocket({
     userId: currentUserId,
     onMessage: handleWebSocketMessage,
     onConnect: () => {
@@ -95,6 +95,11 @@ const ChatRoom: React.FC<ChatRoomProps> = ({
       
       setMessages(prev => [...prev, newMessage]);
       scrollToBottom();
+
+      // The thread is open, so the message has been read
+      if (newMessage.sender_id !== currentUserId) {
+        markRead(threadRef);
+      }
     } else if (message.type === 'thread_escalated' && message.thread_ref === threadRef) {
       // Handle thread escalation
       if (threadInfo) {
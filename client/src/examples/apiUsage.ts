@@ -22,9 +22,9 @@ export async function exampleRawApiClient() {
 
     // Create a product
     const newProduct = await apiClient.post('/trader/products', {
-      name: 'Test Product',
+      title: 'Test Product',
       description: 'A test product',
-      price: 99.99,
+      price_cents: 9999,
       stock: 10,
       category: 'seeds',
     })
@@ -72,7 +72,7 @@ export async function exampleDedicatedApis() {
     console.log('Login result:', authResult)
 
     // Marketplace operations
-    const products = await marketplaceApi.getProducts(1, 10)
+    const products = await marketplaceApi.getProducts(undefined, 10)
     console.log('Marketplace products:', products)
 
     const sellers = await marketplaceApi.getSellers()
@@ -14,6 +14,15 @@ interface UseMarketplaceSocketProps {
   onDisconnect?: () => void;
 }
 
+const getAuthToken = (): string | null => {
+  try {
+    const user = localStorage.getItem('user');
+    return user ? JSON.parse(user).token : null;
+  } catch {
+    return null;
+  }
+};
+
 export const useMarketplaceSocket = ({ 
   userId, 
   onMessage, 
@@ -28,7 +37,13 @@ export const useMarketplaceSocket = ({
 
   const connect = () => {
     try {
-      const wsUrl = `ws://localhost:8080/ws/marketplace?user_id=${userId}`;
+      // Browsers can't set headers on a WebSocket, so the token goes in the URL
+      const token = getAuthToken();
+      if (!token) {
+        setError('Not signed in');
+        return;
+      }
+      const wsUrl = `ws://localhost:8080/ws/marketplace?token=${encodeURIComponent(token)}`;
       const ws = new WebSocket(wsUrl);
       
       ws.onopen = () => {
@@ -107,6 +122,27 @@ export const useMarketplaceSocket = ({
     }
   };
 
+  const send = (message: Record<string, unknown>) => {
+    if (wsRef.current && wsRef.current.readyState === WebSocket.OPEN) {
+      wsRef.current.send(JSON.stringify(message));
+    }
+  };
+
+  // Typing indicators are relayed to the other participants; send
+  // typing: false when the user stops
+  const sendTyping = (threadRef: string, typing = true) => {
+    send({ type: 'typing', thread_ref: threadRef, typing });
+  };
+
+  // Receipts cover every message in the thread up to now
+  const markDelivered = (threadRef: string) => {
+    send({ type: 'delivered', thread_ref: threadRef });
+  };
+
+  const markRead = (threadRef: string) => {
+    send({ type: 'read', thread_ref: threadRef });
+  };
+
   const sendPing = () => {
     if (wsRef.current && wsRef.current.readyState === WebSocket.OPEN) {
       wsRef.current.send(JSON.stringify({
@@ -139,6 +175,9 @@ export const useMarketplaceSocket = ({
     error,
     subscribe,
     unsubscribe,
+    sendTyping,
+    markDelivered,
+    markRead,
     connect,
     disconnect
   };
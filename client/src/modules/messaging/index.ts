@@ -39,11 +39,14 @@ export interface SendMessageResponse {
   conversation_id?: number;
 }
 
+// Messages come newest first; pagination.next_cursor loads older ones
 export interface MessagesResponse {
-  success: boolean;
-  messages: Message[];
-  has_more: boolean;
-  next_after?: string;
+  data: Message[];
+  pagination: {
+    limit: number;
+    next_cursor?: string;
+    has_more: boolean;
+  };
 }
 
 export interface ConversationsResponse {
@@ -101,11 +104,11 @@ class MessagingAPI {
   async getConversationMessages(
     conversationId: number,
     limit: number = 50,
-    after?: string
+    cursor?: string
   ): Promise<MessagesResponse> {
     const params = new URLSearchParams({
       limit: limit.toString(),
-      ...(after && { after }),
+      ...(cursor && { cursor }),
     });
 
     return this.request<MessagesResponse>(
@@ -49,7 +49,7 @@ export const useMessaging = (options: UseMessagingOptions = {}): UseMessagingRet
 
   // Refs
   const pollerRef = useRef<MessagePoller | null>(null);
-  const lastMessageTimeRef = useRef<string | null>(null);
+  const nextCursorRef = useRef<string | null>(null);
 
   // Load conversations
   const loadConversations = useCallback(async () => {
@@ -71,20 +71,17 @@ export const useMessaging = (options: UseMessagingOptions = {}): UseMessagingRet
       setLoading(true);
       setError(null);
 
-      const after = refresh ? undefined : lastMessageTimeRef.current;
-      const response = await messagingAPI.getConversationMessages(conversationId, 50, after);
+      const cursor = refresh ? undefined : nextCursorRef.current ?? undefined;
+      const response = await messagingAPI.getConversationMessages(conversationId, 50, cursor);
 
       if (refresh) {
-        setMessages(response.messages);
+        setMessages(response.data);
       } else {
-        setMessages(prev => [...prev, ...response.messages]);
+        setMessages(prev => [...prev, ...response.data]);
       }
 
-      setHasMoreMessages(response.has_more);
-      
-      if (response.messages.length > 0) {
-        lastMessageTimeRef.current = response.messages[0].created_at;
-      }
+      setHasMoreMessages(response.pagination.has_more);
+      nextCursorRef.current = response.pagination.next_cursor ?? null;
     } catch (err) {
       setError(err instanceof Error ? err.message : 'Failed to load messages');
     } finally {
@@ -124,7 +121,7 @@ export const useMessaging = (options: UseMessagingOptions = {}): UseMessagingRet
     setCurrentConversationId(conversationId);
     setMessages([]);
     setHasMoreMessages(false);
-    lastMessageTimeRef.current = null;
+    nextCursorRef.current = null;
   }, []);
 
   // Load more messages (pagination)
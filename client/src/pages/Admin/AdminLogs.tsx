@@ -26,11 +26,13 @@ interface ActivityLog {
 }
 
 interface LogsResponse {
-  logs: ActivityLog[];
-  total: number;
-  page: number;
-  page_size: number;
-  total_pages: number;
+  data: ActivityLog[];
+  pagination: {
+    limit: number;
+    next_cursor?: string;
+    has_more: boolean;
+    total?: number;
+  };
 }
 
 interface LogStats {
@@ -64,12 +66,13 @@ export function AdminLogs() {
     search: '',
   });
   
-  // Pagination
+  // Pagination; cursors[i] is the cursor that loads page i + 1
   const [pagination, setPagination] = useState({
     page: 1,
     pageSize: 50,
     total: 0,
     totalPages: 0,
+    cursors: [''] as string[],
   });
 
   // Fetch logs
@@ -79,9 +82,10 @@ export function AdminLogs() {
       setError(null);
       
       const params = new URLSearchParams({
-        page: pagination.page.toString(),
         limit: pagination.pageSize.toString(),
       });
+      const cursor = pagination.cursors[pagination.page - 1];
+      if (cursor) params.append('cursor', cursor);
       
       if (filters.role) params.append('role', filters.role);
       if (filters.action) params.append('action', filters.action);
@@ -99,12 +103,18 @@ export function AdminLogs() {
       }
       
       const data: LogsResponse = await response.json();
-      setLogs(data.logs);
-      setPagination(prev => ({
-        ...prev,
-        total: data.total,
-        totalPages: data.total_pages,
-      }));
+      setLogs(data.data);
+      setPagination(prev => {
+        const cursors = prev.cursors.slice(0, prev.page);
+        if (data.pagination.next_cursor) cursors.push(data.pagination.next_cursor);
+        const total = data.pagination.total ?? 0;
+        return {
+          ...prev,
+          cursors,
+          total,
+          totalPages: Math.ceil(total / prev.pageSize),
+        };
+      });
     } catch (err) {
       setError(err instanceof Error ? err.message : 'An error occurred');
     } finally {
@@ -159,11 +169,13 @@ export function AdminLogs() {
 
   const handleFilterChange = (key: string, value: string) => {
     setFilters(prev => ({ ...prev, [key]: value }));
-    setPagination(prev => ({ ...prev, page: 1 }));
+    setPagination(prev => ({ ...prev, page: 1, cursors: [''] }));
   };
 
+  // Pages are reached by cursor, so only the pages already seen and the
+  // next one can be opened
   const handlePageChange = (newPage: number) => {
-    setPagination(prev => ({ ...prev, page: newPage }));
+    setPagination(prev => (newPage > prev.cursors.length ? prev : { ...prev, page: newPage }));
   };
 
   const getRoleColor = (role: string) => {
@@ -485,7 +497,7 @@ export function AdminLogs() {
                 </button>
                 <button
                   onClick={() => handlePageChange(pagination.page + 1)}
-                  disabled={pagination.page === pagination.totalPages}
+                  disabled={pagination.page >= pagination.cursors.length}
                   className="btn btn-outline btn-sm"
                 >
                   Next
@@ -155,13 +155,16 @@ export function AdminMonitoring() {
     }
   };
 
-  const handleVerifySeller = async (sellerId: string, verified: boolean) => {
+  // Sellers are verified through the KYC review queue; admins can only revoke here
+  const handleRevokeVerification = async (sellerId: string) => {
+    const note = window.prompt('Reason for revoking verification');
+    if (!note) return;
     try {
-      await apiClient.patch(`/admin/sellers/${sellerId}/verify`, { verified });
+      await apiClient.post(`/admin/sellers/${sellerId}/revoke-verification`, { note });
       loadSellers();
       loadOverview();
     } catch (err) {
-      console.error('Failed to update seller verification:', err);
+      console.error('Failed to revoke seller verification:', err);
     }
   };
 
@@ -438,16 +441,14 @@ export function AdminMonitoring() {
                           </td>
                           <td className="px-6 py-4 whitespace-nowrap text-sm font-medium">
                             <div className="flex items-center gap-2">
-                              <button
-                                onClick={() => handleVerifySeller(seller.user_id, !seller.verified)}
-                                className={`px-3 py-1 rounded text-xs font-medium ${
-                                  seller.verified
-                                    ? 'bg-red-100 text-red-700 hover:bg-red-200'
-                                    : 'bg-green-100 text-green-700 hover:bg-green-200'
-                                }`}
-                              >
-                                {seller.verified ? 'Unverify' : 'Verify'}
-                              </button>
+                              {seller.verified && (
+                                <button
+                                  onClick={() => handleRevokeVerification(seller.user_id)}
+                                  className="px-3 py-1 rounded text-xs font-medium bg-red-100 text-red-700 hover:bg-red-200"
+                                >
+                                  Revoke
+                                </button>
+                              )}
                               <button
                                 onClick={() => handleRecalculateReputation(seller.user_id)}
                                 className="px-3 py-1 bg-blue-100 text-blue-700 rounded text-xs font-medium hover:bg-blue-200"
@@ -431,12 +431,11 @@ function MarketplaceContent() {
       setLoading(true)
       try {
         const resp = await listProducts({
-          page: 1,
           limit: 12,
           q: searchQuery || undefined,
           category: selectedCategory !== 'all' ? selectedCategory : undefined,
         })
-        if (mounted) setApiItems(resp.items)
+        if (mounted) setApiItems(resp.data)
       } catch (_) {
         if (mounted) setApiItems([])
       } finally {
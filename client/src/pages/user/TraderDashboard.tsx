@@ -157,7 +157,16 @@ export function TraderDashboard() {
               {products.map((product: any, index: number) => (
                 <ProductListingCard
                   key={product.id}
-                  product={product}
+                  product={{
+                    id: product.id,
+                    name: product.title,
+                    description: product.description,
+                    price: product.price_cents / 100,
+                    stock: product.stock,
+                    category: product.category,
+                    status: product.is_active ? 'active' : 'inactive',
+                    imageUrl: product.images?.[0],
+                  }}
                   onEdit={(id) => console.log('Edit product:', id)}
                   onArchive={(id) => console.log('Archive product:', id)}
                 />
@@ -213,12 +222,12 @@ export function TraderDashboard() {
                         <div className="flex items-center">
                           <div className="w-10 h-10 bg-gray-100 rounded-lg mr-3"></div>
                           <div>
-                            <div className="font-medium text-gray-900">{product.name}</div>
+                            <div className="font-medium text-gray-900">{product.title}</div>
                             <div className="text-sm text-gray-500">{product.description}</div>
                           </div>
                         </div>
                       </td>
-                      <td className="px-4 py-3 text-gray-900">${product.price}</td>
+                      <td className="px-4 py-3 text-gray-900">${(product.price_cents / 100).toFixed(2)}</td>
                       <td className="px-4 py-3 text-gray-900">{product.stock}</td>
                       <td className="px-4 py-3">
                         <span className="px-2 py-1 bg-gray-100 text-gray-600 rounded-full text-sm">
@@ -227,11 +236,11 @@ export function TraderDashboard() {
                       </td>
                       <td className="px-4 py-3">
                         <span className={`px-2 py-1 rounded-full text-sm ${
-                          product.status === 'active'
+                          product.is_active
                             ? 'bg-green-100 text-green-800'
                             : 'bg-gray-100 text-gray-800'
                         }`}>
-                          {product.status}
+                          {product.is_active ? 'active' : 'inactive'}
                         </span>
                       </td>
                     </tr>
@@ -9,12 +9,14 @@ jest.mock('../../../services/api')
 const mockProducts = [
   {
     id: '1',
-    name: 'Maize Seeds',
+    title: 'Maize Seeds',
     description: 'High-quality maize seeds',
-    price: 29.99,
+    price_cents: 2999,
+    currency: 'KES',
     stock: 100,
-    category: 'Seeds',
-    status: 'active'
+    category: 'seeds',
+    images: [],
+    is_active: true
   }
 ]
 
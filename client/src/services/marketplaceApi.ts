@@ -1,48 +1,298 @@
 import { apiClient } from './apiClient'
 
+export type UnitOfMeasure = 'g' | 'kg' | 't' | 'ml' | 'l' | 'piece' | 'seedling'
+
+export interface ProductVariant {
+  id: string
+  product_id: string
+  sku: string
+  pack_size: string
+  unit: UnitOfMeasure
+  price_cents: number
+  // Available to sell; reserved is held for placed orders
+  stock: number
+  reserved: number
+  barcode?: string
+  is_active: boolean
+  base_unit: UnitOfMeasure
+  unit_price_cents: string
+  created_at: string
+  updated_at: string
+}
+
+export interface ProductVariantRequest {
+  sku?: string
+  pack_size: string | number
+  unit: UnitOfMeasure
+  price_cents: number
+  stock: number
+  barcode?: string
+}
+
+// An uploaded image. URLs are signed and expire, so store ref (not a
+// URL) in a product's images and re-read the product for fresh URLs.
+export interface MediaVariant {
+  name: 'large' | 'medium' | 'thumb'
+  format: 'jpeg' | 'png' | 'webp'
+  content_type: string
+  width: number
+  height: number
+  size_bytes: number
+  url?: string
+}
+
+export interface MediaAsset {
+  id: string
+  owner_id: string
+  kind: 'product' | 'pest'
+  content_type: string
+  width: number
+  height: number
+  size_bytes: number
+  variants: MediaVariant[]
+  created_at: string
+  ref?: string
+}
+
+// Market prices are per base unit (kg, l, piece or seedling). An index
+// with region '' covers all regions.
+export type MarketPosition = 'below' | 'at' | 'above'
+
+export interface MarketPriceIndex {
+  category: string
+  region: string
+  base_unit: UnitOfMeasure
+  currency: string
+  median_unit_price_cents: string
+  p25_unit_price_cents: string
+  p75_unit_price_cents: string
+  listing_count: number
+  order_count: number
+  feed_count: number
+  computed_at: string
+}
+
+export interface MarketPriceHint {
+  position: MarketPosition
+  // Negative when the listing is cheaper than the median
+  difference_percent: number
+  unit_price_cents: string
+  median_unit_price_cents: string
+  base_unit: UnitOfMeasure
+  region: string
+  sample_size: number
+}
+
+export interface PricePoint {
+  id: string
+  product_id: string
+  variant_id: string
+  price_cents: number
+  previous_price_cents?: number
+  unit_price_cents: string
+  base_unit: UnitOfMeasure
+  recorded_at: string
+}
+
+export interface PackSuggestion {
+  variant_id?: string
+  sku?: string
+  pack_size: string
+  unit: UnitOfMeasure
+  current_price_cents?: number
+  position?: MarketPosition
+  suggested_price_cents: number
+  low_price_cents: number
+  high_price_cents: number
+}
+
+export interface PriceSuggestion {
+  index: MarketPriceIndex
+  packs: PackSuggestion[]
+}
+
+export type PriceSuggestionParams =
+  | { product_id: string }
+  | { category: string; unit: UnitOfMeasure; pack_size?: string | number; currency?: string }
+
 export interface Product {
   id: string
-  trader_id: string
-  name: string
+  seller_id: string
+  title: string
   description: string
-  price: number
+  price_cents: number
+  currency: string
   stock: number
   category: string
-  image_url?: string
+  // Bare image URLs and "media:<id>" refs to uploaded images
+  images: string[]
   is_active: boolean
   created_at: string
   updated_at: string
+  // Low-stock alerts are sent when stock falls to this level
+  reorder_threshold?: number
+  variants: ProductVariant[]
+  // The uploaded images referenced from images, in order
+  media?: MediaAsset[]
+  seller_name?: string
+  seller_verified?: boolean
+  seller_rating?: number
+  seller_reviews_count?: number
 }
 
+// Without variants the product is sold per piece at price_cents
 export interface CreateProductRequest {
-  name: string
+  title: string
   description: string
-  price: number
-  stock: number
+  price_cents?: number
+  currency?: string
+  stock?: number
   category: string
-  image_url?: string
+  images?: string[]
+  reorder_threshold?: number
+  variants?: ProductVariantRequest[]
 }
 
+// Price and stock are managed per variant
 export interface UpdateProductRequest {
-  name?: string
+  title?: string
   description?: string
-  price?: number
-  stock?: number
+  currency?: string
   category?: string
-  image_url?: string
+  images?: string[]
   is_active?: boolean
 }
 
 export interface ProductListResponse {
-  products: Product[]
+  data: Product[]
   pagination: {
-    page: number
-    page_size: number
-    total: number
-    total_pages: number
+    limit: number
+    next_cursor?: string
+    has_more: boolean
+    total?: number
   }
 }
 
+export type CatalogField =
+  | 'sku' | 'title' | 'description' | 'category' | 'currency' | 'pack_size' | 'unit'
+  | 'price' | 'stock' | 'barcode' | 'images' | 'is_active' | 'variant_active'
+
+export interface ImportRowError {
+  row: number
+  sku?: string
+  column?: CatalogField
+  message: string
+}
+
+// Dry-run preview of a catalogue import
+export interface ImportReport {
+  dry_run: boolean
+  total_rows: number
+  created: number
+  updated: number
+  unchanged: number
+  failed: number
+  rows?: { row: number; sku: string; action: 'create' | 'add_variant' | 'update' | 'unchanged' | 'error'; product_id?: string }[]
+  errors: ImportRowError[]
+}
+
+export interface ImportJob {
+  id: string
+  status: 'queued' | 'running' | 'completed' | 'failed'
+  filename: string
+  format: 'csv' | 'xlsx'
+  total_rows: number
+  processed_rows: number
+  progress: number
+  created: number
+  updated: number
+  unchanged: number
+  failed: number
+  error?: string
+  created_at: string
+  started_at?: string
+  finished_at?: string
+  // Present when the import finished within the request
+  errors?: ImportRowError[]
+}
+
+export type StockReason = 'adjustment' | 'import' | 'reservation' | 'release' | 'sale' | 'return'
+
+// One inventory ledger entry. quantity changes the available stock and
+// reserved_change the stock held for orders.
+export interface StockMovement {
+  id: string
+  product_id: string
+  variant_id?: string
+  seller_id: string
+  reason: StockReason
+  quantity: number
+  reserved_change: number
+  stock_after: number
+  reserved_after: number
+  price_cents: number
+  order_id?: string
+  actor_id?: string
+  note?: string
+  created_at: string
+}
+
+export interface StockMovementListResponse {
+  data: StockMovement[]
+  pagination: ProductListResponse['pagination']
+}
+
+// Traders record restocks and corrections as adjustments, and returned goods as returns
+export interface StockAdjustmentRequest {
+  quantity: number
+  reason?: 'adjustment' | 'return'
+  note?: string
+  order_id?: string
+}
+
+export interface MovementFilter {
+  product_id?: string
+  variant_id?: string
+  order_id?: string
+  reason?: StockReason
+  since?: string
+}
+
+export interface InventoryReportItem {
+  product_id: string
+  variant_id: string
+  title: string
+  sku: string
+  pack_size: string
+  unit: UnitOfMeasure
+  currency: string
+  stock: number
+  reserved: number
+  on_hand: number
+  price_cents: number
+  value_cents: number
+  opening_on_hand: number
+  closing_on_hand: number
+  sold_units: number
+  sold_value_cents: number
+  turnover?: number
+  days_of_cover?: number
+}
+
+export interface InventoryReport {
+  from: string
+  to: string
+  items: InventoryReportItem[]
+  totals: {
+    currency: string
+    on_hand: number
+    value_cents: number
+    sold_units: number
+    sold_value_cents: number
+    turnover?: number
+  }[]
+}
+
 export interface Order {
   id: string
   buyer_id: string
@@ -57,10 +307,28 @@ export interface Order {
 
 export interface CreateOrderRequest {
   product_id: string
+  // Required when the product is sold in more than one pack size
+  variant_id?: string
   quantity: number
   seller_id: string
 }
 
+export interface GeoPoint {
+  lat: number
+  lng: number
+}
+
+// A region a seller delivers to: a radius around a center or a polygon
+export interface ServiceArea {
+  id?: string
+  name?: string
+  kind: 'radius' | 'polygon'
+  center?: GeoPoint
+  radius_km?: number
+  polygon?: GeoPoint[]
+  created_at?: string
+}
+
 export interface Seller {
   id: string
   name: string
@@ -74,10 +342,10 @@ export interface Seller {
 
 class MarketplaceApi {
   // Products
-  async getProducts(page = 1, pageSize = 10, category?: string): Promise<ProductListResponse> {
+  async getProducts(cursor?: string, limit = 10, category?: string): Promise<ProductListResponse> {
     const params = new URLSearchParams({
-      page: page.toString(),
-      page_size: pageSize.toString(),
+      limit: limit.toString(),
+      ...(cursor && { cursor }),
       ...(category && { category }),
     })
     return apiClient.get(`/products?${params}`)
@@ -99,14 +367,118 @@ class MarketplaceApi {
     return apiClient.delete(`/trader/products/${id}`)
   }
 
-  async getTraderProducts(page = 1, pageSize = 10): Promise<ProductListResponse> {
+  async addVariant(productId: string, variant: ProductVariantRequest): Promise<ProductVariant> {
+    return apiClient.post(`/trader/products/${productId}/variants`, variant)
+  }
+
+  async updateVariant(
+    productId: string,
+    variantId: string,
+    variant: Partial<ProductVariantRequest> & { is_active?: boolean }
+  ): Promise<ProductVariant> {
+    return apiClient.put(`/trader/products/${productId}/variants/${variantId}`, variant)
+  }
+
+  async deleteVariant(productId: string, variantId: string): Promise<void> {
+    return apiClient.delete(`/trader/products/${productId}/variants/${variantId}`)
+  }
+
+  // Inventory ledger
+  async adjustStock(productId: string, variantId: string, adjustment: StockAdjustmentRequest): Promise<StockMovement> {
+    return apiClient.post(`/trader/products/${productId}/variants/${variantId}/stock`, adjustment)
+  }
+
+  // A null threshold turns low-stock alerts off
+  async setReorderThreshold(productId: string, threshold: number | null): Promise<Product> {
+    return apiClient.put(`/trader/products/${productId}/reorder-threshold`, { threshold })
+  }
+
+  async getStockMovements(filter: MovementFilter = {}, cursor?: string, limit = 20): Promise<StockMovementListResponse> {
+    const params = new URLSearchParams({
+      limit: limit.toString(),
+      ...(cursor && { cursor }),
+      ...Object.fromEntries(Object.entries(filter).filter(([, v]) => v)),
+    })
+    return apiClient.get(`/trader/inventory/movements?${params}`)
+  }
+
+  // Dates are YYYY-MM-DD; the report covers the last 30 days by default
+  async getInventoryReport(from?: string, to?: string): Promise<InventoryReport> {
     const params = new URLSearchParams({
-      page: page.toString(),
-      page_size: pageSize.toString(),
+      ...(from && { from }),
+      ...(to && { to }),
+    })
+    return apiClient.get(`/trader/inventory/report?${params}`)
+  }
+
+  async getServiceAreas(): Promise<ServiceArea[]> {
+    return apiClient.get('/seller/service-areas')
+  }
+
+  async addServiceArea(area: ServiceArea): Promise<ServiceArea> {
+    return apiClient.post('/seller/service-areas', area)
+  }
+
+  async deleteServiceArea(id: string): Promise<void> {
+    return apiClient.delete(`/seller/service-areas/${id}`)
+  }
+
+  async getTraderProducts(cursor?: string, limit = 10): Promise<ProductListResponse> {
+    const params = new URLSearchParams({
+      limit: limit.toString(),
+      ...(cursor && { cursor }),
     })
     return apiClient.get(`/trader/products?${params}`)
   }
 
+  // Product images: add the returned ref to the product's images
+  async uploadProductImage(file: File, onUploadProgress?: (progress: number) => void): Promise<MediaAsset> {
+    return apiClient.upload('/trader/media', file, onUploadProgress)
+  }
+
+  async deleteMedia(id: string): Promise<void> {
+    return apiClient.delete(`/media/${id}`)
+  }
+
+  // Suggested pack prices from the market index for the trader's region
+  async suggestPrice(params: PriceSuggestionParams): Promise<PriceSuggestion> {
+    const qs = new URLSearchParams(
+      Object.entries(params).filter(([, v]) => v !== undefined).map(([k, v]) => [k, String(v)])
+    )
+    return apiClient.get(`/trader/pricing/suggest?${qs}`)
+  }
+
+  // Bulk catalogue import/export. mapping maps catalogue fields to the
+  // file's column headers when they are not named after the fields.
+  async previewProductImport(file: File, mapping?: Partial<Record<CatalogField, string>>): Promise<ImportReport> {
+    return apiClient.upload('/trader/products/import', file, undefined, {
+      dry_run: 'true',
+      ...(mapping && { mapping: JSON.stringify(mapping) }),
+    })
+  }
+
+  async importProducts(
+    file: File,
+    mapping?: Partial<Record<CatalogField, string>>,
+    onUploadProgress?: (progress: number) => void
+  ): Promise<ImportJob> {
+    return apiClient.upload('/trader/products/import', file, onUploadProgress, {
+      ...(mapping && { mapping: JSON.stringify(mapping) }),
+    })
+  }
+
+  async getImportJob(jobId: string): Promise<ImportJob> {
+    return apiClient.get(`/trader/products/import/${jobId}`)
+  }
+
+  async downloadImportErrors(jobId: string, format: 'csv' | 'xlsx' = 'csv'): Promise<void> {
+    return apiClient.download(`/trader/products/import/${jobId}/errors?format=${format}`, `import-errors.${format}`)
+  }
+
+  async exportProducts(format: 'csv' | 'xlsx' = 'csv'): Promise<void> {
+    return apiClient.download(`/trader/products/export?format=${format}`, `products.${format}`)
+  }
+
   // Sellers
   async getSellers(): Promise<Seller[]> {
     return apiClient.get('/sellers')
@@ -116,10 +488,10 @@ class MarketplaceApi {
     return apiClient.get(`/sellers/${id}`)
   }
 
-  async getSellerProducts(sellerId: string, page = 1, pageSize = 10): Promise<ProductListResponse> {
+  async getSellerProducts(sellerId: string, cursor?: string, limit = 10): Promise<ProductListResponse> {
     const params = new URLSearchParams({
-      page: page.toString(),
-      page_size: pageSize.toString(),
+      limit: limit.toString(),
+      ...(cursor && { cursor }),
     })
     return apiClient.get(`/sellers/${sellerId}/products?${params}`)
   }
@@ -146,11 +518,11 @@ class MarketplaceApi {
   }
 
   // Search
-  async searchProducts(query: string, page = 1, pageSize = 10): Promise<ProductListResponse> {
+  async searchProducts(query: string, cursor?: string, limit = 10): Promise<ProductListResponse> {
     const params = new URLSearchParams({
       q: query,
-      page: page.toString(),
-      page_size: pageSize.toString(),
+      limit: limit.toString(),
+      ...(cursor && { cursor }),
     })
     return apiClient.get(`/products/search?${params}`)
   }
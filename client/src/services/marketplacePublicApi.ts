@@ -1,5 +1,13 @@
 // Flow14.1.1
 import { apiClient } from './apiClient'
+import type {
+  MarketPriceHint,
+  MarketPriceIndex,
+  MediaAsset,
+  PricePoint,
+  ProductVariant,
+  UnitOfMeasure,
+} from './marketplaceApi'
 
 export interface PublicProduct {
   id: string
@@ -13,29 +21,91 @@ export interface PublicProduct {
   images: string[]
   created_at: string
   updated_at: string
+  variants: ProductVariant[]
+  // Uploaded images with signed URLs; thumb variants suit list views
+  media?: MediaAsset[]
   seller_name?: string
   seller_verified?: boolean
   seller_rating?: number
   seller_reviews_count?: number
+  seller_location?: string
+  // Set when browsing near a location
+  distance_km?: number
+  // Below, at or above the market median, when an index covers the listing
+  market_price?: MarketPriceHint
+}
+
+// Every list endpoint returns { data, pagination }; pass next_cursor back as
+// cursor to load the following page
+export interface PageMeta {
+  limit: number
+  next_cursor?: string
+  has_more: boolean
+  total?: number
+}
+
+export interface ListResponse<T> {
+  data: T[]
+  pagination: PageMeta
 }
 
 export interface ListParams {
-  page?: number
+  cursor?: string
   limit?: number
   category?: string
   min_price?: number
   max_price?: number
   q?: string
   seller_id?: string
-  sort?: 'price_asc' | 'price_desc' | 'newest'
+  // Compare listings per kg, litre or item; pair with sort=unit_price_asc
+  unit?: UnitOfMeasure
+  sort?: 'price_asc' | 'price_desc' | 'newest' | 'unit_price_asc' | 'relevance' | 'distance'
+  // Buyer location; radius_km and delivers_to_me narrow to nearby sellers
+  lat?: number
+  lng?: number
+  radius_km?: number
+  delivers_to_me?: boolean
+  // Facet filters
+  price_band?: string
+  verified?: boolean
+  location?: string
+  in_stock?: boolean
 }
 
-export async function listProducts(params: ListParams = {}): Promise<{ items: PublicProduct[]; meta: { page: number; limit: number; total: number } }> {
+export interface FacetValue {
+  value: string
+  label?: string
+  count: number
+}
+
+export interface SearchFacets {
+  category: FacetValue[]
+  price_band: FacetValue[]
+  seller_verified: FacetValue[]
+  location: FacetValue[]
+  in_stock: FacetValue[]
+}
+
+export interface SearchResponse extends ListResponse<PublicProduct> {
+  facets: SearchFacets
+  query: { text: string; clauses: { text: string; alternatives?: string[] }[] }
+}
+
+function toQueryString(params: ListParams): string {
   const qs = new URLSearchParams()
   Object.entries(params).forEach(([k, v]) => {
     if (v !== undefined && v !== null && v !== '') qs.set(k, String(v))
   })
-  return apiClient.get(`/marketplace/products?${qs.toString()}`)
+  return qs.toString()
+}
+
+export async function listProducts(params: ListParams = {}): Promise<ListResponse<PublicProduct>> {
+  return apiClient.get(`/marketplace/products?${toQueryString(params)}`)
+}
+
+// Ranked, typo-tolerant search with facet counts
+export async function searchProducts(params: ListParams = {}): Promise<SearchResponse> {
+  return apiClient.get(`/marketplace/search?${toQueryString(params)}`)
 }
 
 export async function getProduct(id: string): Promise<PublicProduct> {
@@ -46,4 +116,96 @@ export async function listCategories(): Promise<{ items: string[] }> {
   return apiClient.get('/marketplace/categories')
 }
 
+// Oldest price first
+export async function getPriceHistory(
+  id: string,
+  days = 90,
+  cursor?: string,
+  limit = 20
+): Promise<ListResponse<PricePoint>> {
+  return apiClient.get(`/marketplace/products/${id}/price-history?${toQueryString({ days, cursor, limit } as ListParams)}`)
+}
+
+export async function listMarketPrices(
+  params: { category?: string; region?: string; cursor?: string; limit?: number } = {}
+): Promise<ListResponse<MarketPriceIndex>> {
+  return apiClient.get(`/marketplace/prices?${toQueryString(params as ListParams)}`)
+}
 
+
+
+// Wishlists and saved searches need a signed-in user. Wishlisted listings
+// alert on price drops and restocks; saved searches on new listings.
+export interface WishlistItem {
+  id: string
+  user_id: string
+  product_id: string
+  // The price drops are measured from
+  seen_price_cents: number
+  created_at: string
+  product?: PublicProduct
+}
+
+// A saved filter uses the list parameters, without paging
+export type SavedSearchFilter = Omit<ListParams, 'cursor' | 'limit'>
+
+export interface SavedSearch {
+  id: string
+  user_id: string
+  name: string
+  filter: SavedSearchFilter
+  notify: boolean
+  checked_at: string
+  created_at: string
+  updated_at: string
+}
+
+export interface SavedSearchRequest {
+  name?: string
+  filter?: SavedSearchFilter
+  notify?: boolean
+}
+
+// Daily and weekly bundle alerts into a digest
+export type AlertFrequency = 'instant' | 'daily' | 'weekly' | 'off'
+
+export interface AlertPreferences {
+  frequency: AlertFrequency
+  last_digest_at?: string
+}
+
+export async function getWishlist(cursor?: string, limit = 20): Promise<ListResponse<WishlistItem>> {
+  return apiClient.get(`/marketplace/wishlist?${toQueryString({ cursor, limit })}`)
+}
+
+export async function addToWishlist(productId: string): Promise<WishlistItem> {
+  return apiClient.post('/marketplace/wishlist', { product_id: productId })
+}
+
+export async function removeFromWishlist(productId: string): Promise<void> {
+  return apiClient.delete(`/marketplace/wishlist/${productId}`)
+}
+
+export async function listSavedSearches(): Promise<{ items: SavedSearch[] }> {
+  return apiClient.get('/marketplace/saved-searches')
+}
+
+export async function saveSearch(name: string, filter: SavedSearchFilter, notify = true): Promise<SavedSearch> {
+  return apiClient.post('/marketplace/saved-searches', { name, filter, notify })
+}
+
+export async function updateSavedSearch(id: string, changes: SavedSearchRequest): Promise<SavedSearch> {
+  return apiClient.put(`/marketplace/saved-searches/${id}`, changes)
+}
+
+export async function deleteSavedSearch(id: string): Promise<void> {
+  return apiClient.delete(`/marketplace/saved-searches/${id}`)
+}
+
+export async function getAlertPreferences(): Promise<AlertPreferences> {
+  return apiClient.get('/marketplace/alerts/preferences')
+}
+
+export async function setAlertFrequency(frequency: AlertFrequency): Promise<AlertPreferences> {
+  return apiClient.put('/marketplace/alerts/preferences', { frequency })
+}
@@ -0,0 +1,117 @@
+import { apiClient } from './apiClient'
+
+// Channels a notification can be delivered on; in_app is the inbox
+export type NotificationChannel = 'in_app' | 'websocket' | 'email' | 'sms' | 'push'
+
+// '*' applies a preference to every notification type
+export type NotificationPreferenceType =
+  | '*'
+  | 'weather'
+  | 'pest'
+  | 'training'
+  | 'stock'
+  | 'price'
+  | 'system'
+  | 'market'
+  | 'crop'
+  | 'general'
+
+export interface ChannelPreference {
+  type: NotificationPreferenceType
+  channel: NotificationChannel
+  enabled: boolean
+}
+
+// Email, SMS and push wait until quiet hours end; times are HH:MM in the
+// given timezone, e.g. 22:00-07:00 Africa/Nairobi
+export interface QuietHours {
+  start: string
+  end: string
+  timezone: string
+}
+
+// Batches normal-priority email, SMS and push notifications into one
+// summary; daily digests go out at `at` (HH:MM, default 08:00). The
+// timezone must match the quiet hours one when both are set.
+export interface NotificationDigest {
+  frequency: 'hourly' | 'daily'
+  channel: 'email' | 'sms' | 'push'
+  at?: string
+  timezone: string
+}
+
+export interface NotificationPreferences {
+  channels: ChannelPreference[]
+  quiet_hours?: QuietHours
+  digest?: NotificationDigest
+}
+
+export type DeliveryStatus = 'sent' | 'failed' | 'skipped' | 'deferred'
+
+export interface NotificationDelivery {
+  id: string
+  notification_id: string
+  channel: NotificationChannel
+  status: DeliveryStatus
+  attempts: number
+  error?: string
+  next_attempt_at?: string
+  created_at: string
+  updated_at: string
+}
+
+export interface NotificationDigestRecord {
+  id: string
+  channel: NotificationChannel
+  status: Exclude<DeliveryStatus, 'deferred'>
+  item_count: number
+  error?: string
+  created_at: string
+}
+
+export type DevicePlatform = 'android' | 'ios' | 'web'
+
+export async function getNotificationPreferences(): Promise<NotificationPreferences> {
+  return apiClient.get('/notifications/preferences')
+}
+
+// Replaces every preference; omit quiet_hours or digest to turn them off
+export async function setNotificationPreferences(prefs: NotificationPreferences): Promise<NotificationPreferences> {
+  return apiClient.put('/notifications/preferences', prefs)
+}
+
+export async function registerPushDevice(token: string, platform: DevicePlatform = 'web'): Promise<void> {
+  return apiClient.post('/notifications/devices', { token, platform })
+}
+
+export async function removePushDevice(token: string): Promise<void> {
+  return apiClient.delete(`/notifications/devices/${encodeURIComponent(token)}`)
+}
+
+// Texts a verification code to the number SMS notifications and USSD use,
+// e.g. +254712345678; '' removes the number
+export async function setNotificationPhone(phone: string): Promise<void> {
+  return apiClient.put('/notifications/contact', { phone })
+}
+
+// Confirms the number with the code sent by setNotificationPhone
+export async function verifyNotificationPhone(phone: string, code: string): Promise<void> {
+  return apiClient.post('/notifications/contact/verify', { phone, code })
+}
+
+// The language notifications are sent in, and the languages available
+export async function getNotificationLanguage(): Promise<{ language: string; available: string[] }> {
+  return apiClient.get('/notifications/language')
+}
+
+export async function setNotificationLanguage(language: string): Promise<void> {
+  return apiClient.put('/notifications/language', { language })
+}
+
+export async function getNotificationDigests(): Promise<{ items: NotificationDigestRecord[] }> {
+  return apiClient.get('/notifications/digests')
+}
+
+export async function getNotificationDeliveries(notificationId: string): Promise<{ items: NotificationDelivery[] }> {
+  return apiClient.get(`/notifications/${notificationId}/deliveries`)
+}
@@ -98,11 +98,8 @@ describe('AdminLogs', () => {
       .mockResolvedValueOnce({
         ok: true,
         json: async () => ({
-          logs: mockLogs,
-          total: 150,
-          page: 1,
-          page_size: 50,
-          total_pages: 3,
+          data: mockLogs,
+          pagination: { limit: 50, next_cursor: 'eyJpIjoiMyJ9', has_more: true, total: 150 },
         }),
       })
       .mockResolvedValueOnce({
@@ -346,11 +343,8 @@ describe('AdminLogs', () => {
       .mockResolvedValueOnce({
         ok: true,
         json: async () => ({
-          logs: [],
-          total: 0,
-          page: 1,
-          page_size: 50,
-          total_pages: 0,
+          data: [],
+          pagination: { limit: 50, has_more: false, total: 0 },
         }),
       })
       .mockResolvedValueOnce({